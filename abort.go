@@ -0,0 +1,132 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// AbortStats reports on the work done by AbortStalePending.
+type AbortStats struct {
+	// Found is the number of stale preparing or prepared transactions.
+	Found int
+
+	// Aborted is the number of those transactions that were aborted. In a
+	// dry run this is the number that would have been aborted.
+	Aborted int
+
+	// Skipped is the number of transactions that moved on to another
+	// state while we were looking at them, and so were left alone.
+	Skipped int
+
+	// DocsUpdated is the number of documents whose txn-queue had the
+	// aborted transactions' tokens removed.
+	DocsUpdated int
+}
+
+// staleTxnDoc holds the fields of a pending transaction that we need to
+// abort it.
+type staleTxnDoc struct {
+	Id    bson.ObjectId `bson:"_id"`
+	State TxnState      `bson:"s"`
+	Ops   []docKey      `bson:"o"`
+}
+
+// AbortStalePending aborts transactions that have been left in the
+// preparing or prepared state for longer than olderThan, typically by a
+// process that crashed part way through running them. Until they are
+// aborted or resumed, their tokens block the txn-queue of every document
+// they touch.
+//
+// A transaction is only aborted if it is still preparing or prepared at
+// the moment we mark it as aborting, which is the same transition mgo/txn
+// makes when a transaction's assertions fail. Transactions that have
+// started applying are left alone. If dryRun is true, nothing is changed
+// and the stats report what would have been done.
+func AbortStalePending(db *mgo.Database, txnsName string, olderThan time.Duration, dryRun bool) (AbortStats, error) {
+	var stats AbortStats
+	txns := db.C(txnsName)
+	txnsStash := db.C(txnsName + ".stash")
+	threshold := bson.NewObjectIdWithTime(time.Now().Add(-olderThan))
+	query := txns.Find(bson.M{
+		"_id": bson.M{"$lt": threshold},
+		"s":   bson.M{"$in": []TxnState{TxnPreparing, TxnPrepared}},
+	})
+	query.Select(bson.M{"_id": 1, "s": 1, "o.c": 1, "o.d": 1})
+	iter := query.Iter()
+	var doc staleTxnDoc
+	for iter.Next(&doc) {
+		stats.Found++
+		if dryRun {
+			resumeLogger.Infof("would abort %s transaction %s", doc.State, doc.Id.Hex())
+			stats.Aborted++
+			continue
+		}
+		aborted, docsUpdated, err := abortStaleTxn(txns, txnsStash, doc)
+		if err != nil {
+			iter.Close()
+			return stats, errors.Annotatef(err, "aborting transaction %s", doc.Id.Hex())
+		}
+		stats.DocsUpdated += docsUpdated
+		if aborted {
+			resumeLogger.Infof("aborted stale %s transaction %s", doc.State, doc.Id.Hex())
+			stats.Aborted++
+		} else {
+			resumeLogger.Debugf("transaction %s changed state, not aborting", doc.Id.Hex())
+			stats.Skipped++
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return stats, errors.Trace(err)
+	}
+	return stats, nil
+}
+
+// abortStaleTxn moves doc to aborting, removes its tokens from the queues of
+// the documents it touched, and then marks it aborted. It returns false if
+// the transaction was no longer in the state we read it in.
+func abortStaleTxn(txns, txnsStash *mgo.Collection, doc staleTxnDoc) (bool, int, error) {
+	err := txns.Update(
+		bson.M{"_id": doc.Id, "s": doc.State},
+		bson.M{"$set": bson.M{"s": TxnAborting}},
+	)
+	if err == mgo.ErrNotFound {
+		return false, 0, nil
+	} else if err != nil {
+		return false, 0, errors.Trace(err)
+	}
+	// Tokens are the txn id followed by a nonce, and the same transaction
+	// may be in a queue more than once with different nonces.
+	tokens := bson.RegEx{Pattern: "^" + doc.Id.Hex() + "_"}
+	pull := bson.M{"$pull": bson.M{"txn-queue": tokens}}
+	docsUpdated := 0
+	seen := make(map[docKey]bool)
+	for _, op := range doc.Ops {
+		if seen[op] {
+			continue
+		}
+		seen[op] = true
+		err := txns.Database.C(op.Collection).Update(bson.M{"_id": op.DocId, "txn-queue": tokens}, pull)
+		if err == mgo.ErrNotFound {
+			// Documents that don't exist yet are in the stash.
+			stashId := stashDocKey{Collection: op.Collection, Id: op.DocId}
+			err = txnsStash.Update(bson.M{"_id": stashId, "txn-queue": tokens}, pull)
+		}
+		if err == mgo.ErrNotFound {
+			continue
+		} else if err != nil {
+			return false, docsUpdated, errors.Trace(err)
+		}
+		docsUpdated++
+	}
+	err = txns.UpdateId(doc.Id, bson.M{"$set": bson.M{"s": TxnAborted}})
+	if err != nil && err != mgo.ErrNotFound {
+		return false, docsUpdated, errors.Trace(err)
+	}
+	return true, docsUpdated, nil
+}
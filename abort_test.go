@@ -0,0 +1,111 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type AbortStalePendingSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&AbortStalePendingSuite{})
+
+func (s *AbortStalePendingSuite) txnState(c *gc.C, id bson.ObjectId) jujutxn.TxnState {
+	var doc struct {
+		State jujutxn.TxnState `bson:"s"`
+	}
+	c.Assert(s.txns.FindId(id).One(&doc), jc.ErrorIsNil)
+	return doc.State
+}
+
+func (s *AbortStalePendingSuite) setUpStale(c *gc.C) (bson.ObjectId, bson.ObjectId) {
+	existing := s.runTxn(c, txn.Op{
+		C:      "coll",
+		Id:     "existing",
+		Insert: bson.M{},
+	})
+	stale := s.runInterruptedTxn(c, txn.Op{
+		C:      "coll",
+		Id:     "existing",
+		Update: bson.M{"$set": bson.M{"key": "value"}},
+	}, txn.Op{
+		C:      "coll",
+		Id:     "new",
+		Insert: bson.M{},
+	})
+	c.Assert(s.txnState(c, stale), gc.Equals, jujutxn.TxnPrepared)
+	return existing, stale
+}
+
+func (s *AbortStalePendingSuite) TestAbortsStaleTransactions(c *gc.C) {
+	existing, stale := s.setUpStale(c)
+	stats, err := jujutxn.AbortStalePending(s.db, "txns", 0, false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats, jc.DeepEquals, jujutxn.AbortStats{
+		Found:       1,
+		Aborted:     1,
+		DocsUpdated: 2,
+	})
+	c.Check(s.txnState(c, stale), gc.Equals, jujutxn.TxnAborted)
+	s.assertDocQueue(c, "coll", "existing", existing)
+	s.assertStashDocQueue(c, "coll", "new")
+	// The queue is usable again.
+	s.runTxn(c, txn.Op{
+		C:      "coll",
+		Id:     "existing",
+		Update: bson.M{"$set": bson.M{"key": "other"}},
+	})
+}
+
+func (s *AbortStalePendingSuite) TestDryRun(c *gc.C) {
+	existing, stale := s.setUpStale(c)
+	stats, err := jujutxn.AbortStalePending(s.db, "txns", 0, true)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats, jc.DeepEquals, jujutxn.AbortStats{
+		Found:   1,
+		Aborted: 1,
+	})
+	c.Check(s.txnState(c, stale), gc.Equals, jujutxn.TxnPrepared)
+	s.assertDocQueue(c, "coll", "existing", existing, stale)
+}
+
+func (s *AbortStalePendingSuite) TestIgnoresRecentTransactions(c *gc.C) {
+	_, stale := s.setUpStale(c)
+	stats, err := jujutxn.AbortStalePending(s.db, "txns", time.Hour, false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats, jc.DeepEquals, jujutxn.AbortStats{})
+	c.Check(s.txnState(c, stale), gc.Equals, jujutxn.TxnPrepared)
+}
+
+func (s *AbortStalePendingSuite) TestIgnoresApplyingTransactions(c *gc.C) {
+	s.runTxn(c, txn.Op{
+		C:      "coll",
+		Id:     "existing",
+		Insert: bson.M{},
+	})
+	txn.SetChaos(txn.Chaos{
+		KillChance: 1,
+		Breakpoint: "set-applied",
+	})
+	applying := s.runFailingTxn(c, txn.ErrChaos, txn.Op{
+		C:      "coll",
+		Id:     "existing",
+		Update: bson.M{"$set": bson.M{"key": "value"}},
+	})
+	txn.SetChaos(txn.Chaos{})
+	c.Assert(s.txnState(c, applying), gc.Equals, jujutxn.TxnApplying)
+	stats, err := jujutxn.AbortStalePending(s.db, "txns", 0, false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats, jc.DeepEquals, jujutxn.AbortStats{})
+	c.Check(s.txnState(c, applying), gc.Equals, jujutxn.TxnApplying)
+}
@@ -0,0 +1,178 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"sort"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// maxQueueBucket is the lower bound of the last QueueLengthBucket, which
+// has no upper bound. mgo/txn refuses to add to queues of 1000 tokens, so
+// longer queues are rare.
+const maxQueueBucket = 1024
+
+// AnalyzeOptions controls AnalyzeWithOptions.
+type AnalyzeOptions struct {
+	// MaxTime, if not zero, only counts the transactions created before
+	// it as prunable, like CleanAndPruneArgs.MaxTime.
+	MaxTime time.Time
+}
+
+// QueueLengthBucket counts the documents whose txn-queue has between Min
+// and Max tokens, inclusive. Max is 0 for the last bucket, which has no
+// upper bound.
+type QueueLengthBucket struct {
+	Min  int `json:"min"`
+	Max  int `json:"max"`
+	Docs int `json:"docs"`
+}
+
+// AnalyzeReport is returned by Analyze.
+type AnalyzeReport struct {
+	// Analyzed is when the report was made, and Duration is how long it
+	// took.
+	Analyzed time.Time     `json:"analyzed"`
+	Duration time.Duration `json:"duration"`
+
+	// TxnCount is the number of transactions, PrunableTxns is how many of
+	// them are complete and old enough to be pruned, and PendingTxns is
+	// how many haven't completed.
+	TxnCount     int `json:"txn-count"`
+	PrunableTxns int `json:"prunable-txns"`
+	PendingTxns  int `json:"pending-txns"`
+
+	// StashCount is the number of documents in txns.stash, and
+	// StashBytes is their total size, if it could be read.
+	StashCount int   `json:"stash-count"`
+	StashBytes int64 `json:"stash-bytes"`
+
+	// QueueLengths is the distribution of the lengths of the non-empty
+	// txn-queues across all the collections, in buckets whose bounds are
+	// powers of two, up to the longest queue.
+	QueueLengths []QueueLengthBucket `json:"queue-lengths"`
+
+	// Collections summarises the txn-queues of each collection, with
+	// those whose queues refer to the most transactions first.
+	Collections []QueueDepth `json:"collections"`
+}
+
+// Analyze reads the transactions in txnsName and the documents that may
+// refer to them, and reports how much there is to prune, with the default
+// AnalyzeOptions. See AnalyzeWithOptions.
+func Analyze(db *mgo.Database, txnsName string) (AnalyzeReport, error) {
+	return AnalyzeWithOptions(db, txnsName, AnalyzeOptions{})
+}
+
+// AnalyzeWithOptions reports how much there is to prune in txnsName, and
+// where, without writing anything. It only counts and aggregates, so it is
+// much faster than a dry run of pruning, but it can't tell which
+// transactions would be left behind because their documents can't be
+// cleaned.
+func AnalyzeWithOptions(db *mgo.Database, txnsName string, opts AnalyzeOptions) (AnalyzeReport, error) {
+	tStart := time.Now()
+	report := AnalyzeReport{Analyzed: tStart.UTC()}
+	txns := db.C(txnsName)
+	var err error
+	if report.TxnCount, err = txns.Count(); err != nil {
+		return report, errors.Annotate(err, "counting transactions")
+	}
+	if report.PrunableTxns, err = txns.Find(completedOldTransactionMatch(opts.MaxTime)).Count(); err != nil {
+		return report, errors.Annotate(err, "counting prunable transactions")
+	}
+	if report.PendingTxns, err = txns.Find(bson.M{"s": bson.M{"$in": pendingTxnStates}}).Count(); err != nil {
+		return report, errors.Annotate(err, "counting pending transactions")
+	}
+	stash := db.C(txnsName + ".stash")
+	if report.StashCount, err = stash.Count(); err != nil {
+		return report, errors.Annotate(err, "counting stash documents")
+	}
+	var stashStats collStorageStats
+	if err := db.Run(bson.D{{"collStats", stash.Name}}, &stashStats); err != nil {
+		pruneLogger.Debugf("unable to read the size of %q: %v", stash.Name, err)
+	} else {
+		report.StashBytes = stashStats.Size
+	}
+	lengths := make(map[int]int)
+	if report.Collections, err = queueLengths(db, txnsName, lengths); err != nil {
+		return report, errors.Trace(err)
+	}
+	sort.SliceStable(report.Collections, func(i, j int) bool {
+		return report.Collections[i].Tokens > report.Collections[j].Tokens
+	})
+	report.QueueLengths = queueLengthBuckets(lengths)
+	report.Duration = time.Since(tStart)
+	return report, nil
+}
+
+// queueLengths returns the QueueDepth of each collection that may hold
+// references to transactions in txnsName, and has documents with a
+// txn-queue, and counts the documents with each length of queue in
+// lengths.
+func queueLengths(db *mgo.Database, txnsName string, lengths map[int]int) ([]QueueDepth, error) {
+	it, err := NewTxnCollectionIterator(db.C(txnsName), nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	depths := []QueueDepth{}
+	var name string
+	for it.Next(&name) {
+		iter := db.C(name).Pipe([]bson.M{
+			{"$match": bson.M{"txn-queue.0": bson.M{"$exists": true}}},
+			{"$group": bson.M{
+				"_id":  bson.M{"$size": "$txn-queue"},
+				"docs": bson.M{"$sum": 1},
+			}},
+		}).Iter()
+		depth := QueueDepth{Collection: name}
+		var result struct {
+			Length int `bson:"_id"`
+			Docs   int `bson:"docs"`
+		}
+		for iter.Next(&result) {
+			depth.Docs += result.Docs
+			depth.Tokens += result.Length * result.Docs
+			depth.MaxLength = maxInt(depth.MaxLength, result.Length)
+			lengths[result.Length] += result.Docs
+		}
+		if err := iter.Close(); err != nil {
+			it.Close()
+			return nil, errors.Annotatef(err, "reading txn-queues of %q", name)
+		}
+		if depth.Docs > 0 {
+			depths = append(depths, depth)
+		}
+	}
+	return depths, errors.Trace(it.Close())
+}
+
+// queueLengthBuckets puts the counts of documents by queue length into
+// buckets whose bounds are powers of two, up to the longest queue.
+func queueLengthBuckets(lengths map[int]int) []QueueLengthBucket {
+	buckets := []QueueLengthBucket{}
+	longest := 0
+	for length := range lengths {
+		longest = maxInt(longest, length)
+	}
+	for min := 1; min <= longest; min *= 2 {
+		bucket := QueueLengthBucket{Min: min, Max: 2*min - 1}
+		if min >= maxQueueBucket {
+			bucket.Max = 0
+		}
+		for length, docs := range lengths {
+			if length >= bucket.Min && (bucket.Max == 0 || length <= bucket.Max) {
+				bucket.Docs += docs
+			}
+		}
+		buckets = append(buckets, bucket)
+		if bucket.Max == 0 {
+			break
+		}
+	}
+	return buckets
+}
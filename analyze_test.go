@@ -0,0 +1,84 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type AnalyzeSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&AnalyzeSuite{})
+
+func (s *AnalyzeSuite) TestEmpty(c *gc.C) {
+	report, err := jujutxn.Analyze(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(report.TxnCount, gc.Equals, 0)
+	c.Check(report.QueueLengths, gc.HasLen, 0)
+	c.Check(report.Collections, gc.HasLen, 0)
+}
+
+func (s *AnalyzeSuite) TestReport(c *gc.C) {
+	s.runTxn(c, txn.Op{C: "coll", Id: "a", Insert: bson.M{}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "a", Update: bson.M{"$set": bson.M{"x": 1}}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "b", Insert: bson.M{}})
+	s.runTxn(c, txn.Op{C: "other", Id: "a", Insert: bson.M{}})
+	s.runInterruptedTxn(c, txn.Op{C: "coll", Id: "c", Insert: bson.M{}})
+
+	report, err := jujutxn.Analyze(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(report.TxnCount, gc.Equals, 5)
+	c.Check(report.PrunableTxns, gc.Equals, 4)
+	c.Check(report.PendingTxns, gc.Equals, 1)
+	c.Check(report.StashCount, gc.Equals, 1)
+	c.Assert(report.Collections, gc.HasLen, 3)
+	c.Check(report.Collections[0], gc.DeepEquals, jujutxn.QueueDepth{
+		Collection: "coll",
+		Docs:       2,
+		Tokens:     3,
+		MaxLength:  2,
+	})
+
+	// Nothing was written.
+	count, err := s.txns.Count()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(count, gc.Equals, 5)
+}
+
+func (s *AnalyzeSuite) TestMaxTime(c *gc.C) {
+	s.runTxnWithTimestamp(c, nil, time.Now().Add(-2*time.Hour),
+		txn.Op{C: "coll", Id: "a", Insert: bson.M{}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "b", Insert: bson.M{}})
+
+	report, err := jujutxn.AnalyzeWithOptions(s.db, "txns", jujutxn.AnalyzeOptions{
+		MaxTime: time.Now().Add(-time.Hour),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(report.TxnCount, gc.Equals, 2)
+	c.Check(report.PrunableTxns, gc.Equals, 1)
+}
+
+func (s *AnalyzeSuite) TestQueueLengthBuckets(c *gc.C) {
+	c.Check(jujutxn.QueueLengthBuckets(map[int]int{}), gc.DeepEquals, []jujutxn.QueueLengthBucket{})
+	c.Check(jujutxn.QueueLengthBuckets(map[int]int{1: 10, 2: 3, 3: 2, 9: 1}), gc.DeepEquals, []jujutxn.QueueLengthBucket{
+		{Min: 1, Max: 1, Docs: 10},
+		{Min: 2, Max: 3, Docs: 5},
+		{Min: 4, Max: 7, Docs: 0},
+		{Min: 8, Max: 15, Docs: 1},
+	})
+
+	buckets := jujutxn.QueueLengthBuckets(map[int]int{1: 1, 1000: 2, 5000: 3})
+	c.Assert(buckets, gc.HasLen, 11)
+	c.Check(buckets[9], gc.DeepEquals, jujutxn.QueueLengthBucket{Min: 512, Max: 1023, Docs: 2})
+	c.Check(buckets[10], gc.DeepEquals, jujutxn.QueueLengthBucket{Min: 1024, Max: 0, Docs: 3})
+}
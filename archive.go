@@ -0,0 +1,309 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// archiveMagic starts every archive stream, before the name of the
+// compression used for the rest of the stream.
+const archiveMagic = "TXNARCH1"
+
+// maxArchiveDocBytes is the largest document we will read from an
+// archive, which is mongo's own limit with some headroom.
+const maxArchiveDocBytes = 32 * 1024 * 1024
+
+// ArchiveCompression names the compression used for an archive stream.
+type ArchiveCompression string
+
+const (
+	// ArchiveCompressionNone writes the archive uncompressed.
+	ArchiveCompressionNone ArchiveCompression = "none"
+
+	// ArchiveCompressionGzip compresses the archive with gzip.
+	ArchiveCompressionGzip ArchiveCompression = "gzip"
+)
+
+// ArchiveCodec implements a compression for archive streams.
+type ArchiveCodec interface {
+	// NewWriter returns a writer that compresses to w at the given
+	// level. A level of 0 selects the codec's default.
+	NewWriter(w io.Writer, level int) (io.WriteCloser, error)
+
+	// NewReader returns a reader that decompresses r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	archiveCodecsMu sync.RWMutex
+	archiveCodecs   = map[ArchiveCompression]ArchiveCodec{
+		ArchiveCompressionNone: noneCodec{},
+		ArchiveCompressionGzip: gzipCodec{},
+	}
+)
+
+// RegisterArchiveCodec makes a compression available to archive writers
+// and readers. Only gzip is built in, so that this package doesn't depend
+// on third party compressors; applications that want zstd or snappy (eg
+// from github.com/klauspost/compress) register them under their own name,
+// and must register them before reading archives written with them. For
+// example, ignoring the level:
+//
+//	type zstdCodec struct{}
+//
+//	func (zstdCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+//		return zstd.NewWriter(w)
+//	}
+//
+//	func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+//		d, err := zstd.NewReader(r)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return d.IOReadCloser(), nil
+//	}
+//
+//	txn.RegisterArchiveCodec("zstd", zstdCodec{})
+func RegisterArchiveCodec(name ArchiveCompression, codec ArchiveCodec) {
+	archiveCodecsMu.Lock()
+	defer archiveCodecsMu.Unlock()
+	archiveCodecs[name] = codec
+}
+
+func archiveCodec(name ArchiveCompression) (ArchiveCodec, error) {
+	archiveCodecsMu.RLock()
+	defer archiveCodecsMu.RUnlock()
+	codec, ok := archiveCodecs[name]
+	if !ok {
+		return nil, errors.NotSupportedf("archive compression %q", name)
+	}
+	return codec, nil
+}
+
+type noneCodec struct{}
+
+func (noneCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (noneCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// ArchiveOptions configure an ArchiveWriter.
+type ArchiveOptions struct {
+	// Compression is the compression to use. It defaults to
+	// ArchiveCompressionGzip.
+	Compression ArchiveCompression
+
+	// Level is the compression level, whose meaning depends on the
+	// compression. A value of 0 uses the compression's default.
+	Level int
+
+	// Redactor, if not nil, redacts the ops of the transactions written
+	// with WriteRaw, so that archives can be kept where secrets can't.
+	Redactor Redactor
+}
+
+// ArchiveWriter writes a stream of bson documents, such as pruned
+// transactions and prune history records, compressed as configured. It is
+// safe for concurrent use. Set IncrementalPruneArgs.Archive or
+// CleanAndPruneArgs.Archive to archive transactions as they are pruned,
+// and use WritePruneRecords as a PruneOptions.PruneHistoryExporter.
+type ArchiveWriter struct {
+	mu       sync.Mutex
+	w        io.WriteCloser
+	redactor Redactor
+}
+
+// NewArchiveWriter starts an archive on w. The compression is recorded at
+// the start of the stream, so readers don't need to be told what it is.
+// Close must be called to flush the archive; it does not close w.
+func NewArchiveWriter(w io.Writer, opts ArchiveOptions) (*ArchiveWriter, error) {
+	if opts.Compression == "" {
+		opts.Compression = ArchiveCompressionGzip
+	}
+	if len(opts.Compression) > 255 {
+		return nil, errors.NotValidf("archive compression name %q", opts.Compression)
+	}
+	codec, err := archiveCodec(opts.Compression)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	header := append([]byte(archiveMagic), byte(len(opts.Compression)))
+	header = append(header, opts.Compression...)
+	if _, err := w.Write(header); err != nil {
+		return nil, errors.Annotate(err, "writing archive header")
+	}
+	cw, err := codec.NewWriter(w, opts.Level)
+	if err != nil {
+		return nil, errors.Annotatef(err, "starting %s compression", opts.Compression)
+	}
+	return &ArchiveWriter{w: cw, redactor: opts.Redactor}, nil
+}
+
+// Write appends doc to the archive.
+func (a *ArchiveWriter) Write(doc interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return errors.Annotate(err, "encoding archive document")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.w.Write(data)
+	return errors.Annotate(err, "writing archive")
+}
+
+// WriteRaw appends the already encoded transaction documents to the
+// archive, redacted by ArchiveOptions.Redactor if it was set.
+func (a *ArchiveWriter) WriteRaw(docs []bson.Raw) error {
+	if a.redactor != nil {
+		redacted := make([]bson.Raw, len(docs))
+		for i, doc := range docs {
+			var err error
+			if redacted[i], err = redactTxnRaw(a.redactor, doc); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		docs = redacted
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, doc := range docs {
+		if _, err := a.w.Write(doc.Data); err != nil {
+			return errors.Annotate(err, "writing archive")
+		}
+	}
+	return nil
+}
+
+// WritePruneRecords appends the records to the archive. It has the
+// signature of PruneOptions.PruneHistoryExporter.
+func (a *ArchiveWriter) WritePruneRecords(records []PruneRecord) error {
+	for _, record := range records {
+		if err := a.Write(record); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// Close flushes the archive.
+func (a *ArchiveWriter) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return errors.Annotate(a.w.Close(), "closing archive")
+}
+
+// ArchiveReader reads the documents written by an ArchiveWriter.
+type ArchiveReader struct {
+	r   *bufio.Reader
+	rc  io.ReadCloser
+	err error
+}
+
+// NewArchiveReader starts reading the archive on r. The codec for its
+// compression must have been registered.
+func NewArchiveReader(r io.Reader) (*ArchiveReader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(archiveMagic)+1)
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, errors.Annotate(err, "reading archive header")
+	}
+	if string(magic[:len(archiveMagic)]) != archiveMagic {
+		return nil, errors.NotValidf("archive header")
+	}
+	name := make([]byte, magic[len(archiveMagic)])
+	if _, err := io.ReadFull(br, name); err != nil {
+		return nil, errors.Annotate(err, "reading archive header")
+	}
+	codec, err := archiveCodec(ArchiveCompression(name))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	rc, err := codec.NewReader(br)
+	if err != nil {
+		return nil, errors.Annotatef(err, "starting %s decompression", name)
+	}
+	return &ArchiveReader{r: bufio.NewReader(rc), rc: rc}, nil
+}
+
+// Next decodes the next document into result, returning false at the end
+// of the archive or on error (see Err).
+func (a *ArchiveReader) Next(result interface{}) bool {
+	data, err := a.nextDoc()
+	if err != nil {
+		if err != io.EOF {
+			a.err = err
+		}
+		return false
+	}
+	if err := bson.Unmarshal(data, result); err != nil {
+		a.err = errors.Annotate(err, "decoding archive document")
+		return false
+	}
+	return true
+}
+
+func (a *ArchiveReader) nextDoc() ([]byte, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(a.r, size[:]); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, errors.Annotate(err, "reading archive")
+	}
+	n := binary.LittleEndian.Uint32(size[:])
+	if n < 5 || n > maxArchiveDocBytes {
+		return nil, errors.NotValidf("archive document size %d", n)
+	}
+	data := make([]byte, n)
+	copy(data, size[:])
+	if _, err := io.ReadFull(a.r, data[4:]); err != nil {
+		return nil, errors.Annotate(err, "reading archive")
+	}
+	return data, nil
+}
+
+// Err returns the error that stopped Next, if any.
+func (a *ArchiveReader) Err() error {
+	return a.err
+}
+
+// Close releases the decompressor. It does not close the underlying
+// reader.
+func (a *ArchiveReader) Close() error {
+	return a.rc.Close()
+}
@@ -0,0 +1,109 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type ArchiveSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&ArchiveSuite{})
+
+func (*ArchiveSuite) roundTrip(c *gc.C, opts jujutxn.ArchiveOptions) []byte {
+	var buf bytes.Buffer
+	w, err := jujutxn.NewArchiveWriter(&buf, opts)
+	c.Assert(err, jc.ErrorIsNil)
+	for i := 0; i < 100; i++ {
+		c.Assert(w.Write(bson.D{{"_id", i}, {"payload", "the same text, again and again"}}), jc.ErrorIsNil)
+	}
+	raw := bson.Raw{Kind: 3}
+	raw.Data, err = bson.Marshal(bson.M{"_id": "raw"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(w.WriteRaw([]bson.Raw{raw}), jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+	data := buf.Bytes()
+
+	r, err := jujutxn.NewArchiveReader(bytes.NewReader(data))
+	c.Assert(err, jc.ErrorIsNil)
+	defer r.Close()
+	var ids []interface{}
+	var doc bson.M
+	for r.Next(&doc) {
+		ids = append(ids, doc["_id"])
+		doc = nil
+	}
+	c.Assert(r.Err(), jc.ErrorIsNil)
+	c.Assert(ids, gc.HasLen, 101)
+	c.Check(ids[0], gc.Equals, 0)
+	c.Check(ids[99], gc.Equals, 99)
+	c.Check(ids[100], gc.Equals, "raw")
+	return data
+}
+
+func (s *ArchiveSuite) TestRoundTrip(c *gc.C) {
+	plain := s.roundTrip(c, jujutxn.ArchiveOptions{Compression: jujutxn.ArchiveCompressionNone})
+	gzipped := s.roundTrip(c, jujutxn.ArchiveOptions{})
+	best := s.roundTrip(c, jujutxn.ArchiveOptions{Level: 9})
+	c.Check(len(gzipped) < len(plain)/4, jc.IsTrue)
+	c.Check(len(best) <= len(gzipped), jc.IsTrue)
+}
+
+type flateCodec struct{}
+
+func (flateCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	return flate.NewWriter(w, level)
+}
+
+func (flateCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+func (s *ArchiveSuite) TestRegisteredCodec(c *gc.C) {
+	jujutxn.RegisterArchiveCodec("test-flate", flateCodec{})
+	s.roundTrip(c, jujutxn.ArchiveOptions{Compression: "test-flate"})
+}
+
+func (*ArchiveSuite) TestUnknownCompression(c *gc.C) {
+	_, err := jujutxn.NewArchiveWriter(&bytes.Buffer{}, jujutxn.ArchiveOptions{Compression: "lzma"})
+	c.Check(err, gc.ErrorMatches, `archive compression "lzma" not supported`)
+}
+
+func (*ArchiveSuite) TestBadHeader(c *gc.C) {
+	_, err := jujutxn.NewArchiveReader(bytes.NewReader([]byte("not an archive")))
+	c.Check(err, gc.ErrorMatches, "archive header not valid")
+}
+
+func (*ArchiveSuite) TestWritePruneRecords(c *gc.C) {
+	var buf bytes.Buffer
+	w, err := jujutxn.NewArchiveWriter(&buf, jujutxn.ArchiveOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	var export func([]jujutxn.PruneRecord) error = w.WritePruneRecords
+	id := bson.NewObjectId()
+	c.Assert(export([]jujutxn.PruneRecord{{Id: id, TxnsAfter: 7}}), jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+
+	r, err := jujutxn.NewArchiveReader(&buf)
+	c.Assert(err, jc.ErrorIsNil)
+	var record jujutxn.PruneRecord
+	c.Assert(r.Next(&record), jc.IsTrue)
+	c.Check(record.Id, gc.Equals, id)
+	c.Check(record.TxnsAfter, gc.Equals, 7)
+	c.Check(r.Next(&record), jc.IsFalse)
+	c.Check(r.Err(), jc.ErrorIsNil)
+}
@@ -0,0 +1,184 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+)
+
+// backupPollInterval is how often PrepareForBackup checks for pending
+// transactions while it waits for them to be resolved.
+const backupPollInterval = time.Second
+
+// BackupToken is returned by PrepareForBackup. It asserts that, when it
+// was made, the runners were quiesced and no transactions were pending, so
+// a snapshot of the database would be consistent.
+type BackupToken struct {
+	// Database and TxnsName identify the transactions.
+	Database string
+	TxnsName string
+
+	// Prepared is when the database was found to be clean.
+	Prepared time.Time
+
+	// LastTxnId is the id of the newest transaction at that time, or
+	// empty if there were none.
+	LastTxnId bson.ObjectId
+
+	// Resumed is the number of pending transactions that were resolved
+	// to get there, by being applied or, if their assertions no longer
+	// held, aborted.
+	Resumed int
+
+	// Quiesced reports on each of the runners, in the order they were
+	// passed to PrepareForBackup.
+	Quiesced []QuiesceReport
+
+	runners     []ReadOnlyRunner
+	wasReadOnly []bool
+}
+
+// Verify checks that no transaction has been started since the token was
+// made, so that a snapshot taken since then is consistent. It returns an
+// error satisfying errors.IsNotValid if there is a newer transaction.
+// Transactions that have been pruned since don't count.
+func (t *BackupToken) Verify(db *mgo.Database) error {
+	lastId, err := newestTxnId(db.C(t.TxnsName))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if lastId != t.LastTxnId {
+		return errors.NotValidf("backup token: transaction %s started since %s",
+			lastId.Hex(), t.Prepared.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Release puts the runners back in the mode they were in before
+// PrepareForBackup, once the backup has been taken. Runners that were
+// already read-only stay that way.
+func (t *BackupToken) Release() {
+	for i, runner := range t.runners {
+		runner.SetReadOnly(t.wasReadOnly[i])
+	}
+}
+
+// PrepareForBackup gets the transactions in txnsName ready for a
+// filesystem snapshot or mongodump. It quiesces runners (see
+// ReadOnlyRunner.Quiesce), so that they start no new transactions, and then
+// resumes any pending transactions, waiting for those being run by other
+// processes, until none are pending. Call Release on the returned token
+// once the backup has been taken.
+//
+// Runners in other processes can't be quiesced, so check with
+// BackupToken.Verify after the backup that none of them wrote anything.
+//
+// If ctx is done first, the runners are released, and the error says how
+// many transactions are still pending.
+func PrepareForBackup(ctx context.Context, db *mgo.Database, txnsName string, runners ...Runner) (*BackupToken, error) {
+	token := &BackupToken{
+		Database: db.Name,
+		TxnsName: txnsName,
+	}
+	for _, r := range runners {
+		runner, ok := r.(ReadOnlyRunner)
+		if !ok {
+			token.Release()
+			return nil, errors.NotSupportedf("quiescing runner %T", r)
+		}
+		wasReadOnly := runner.ReadOnly()
+		report, err := runner.Quiesce(ctx)
+		if err != nil {
+			token.Release()
+			return nil, errors.Annotate(err, "quiescing runners")
+		}
+		token.runners = append(token.runners, runner)
+		token.wasReadOnly = append(token.wasReadOnly, wasReadOnly)
+		token.Quiesced = append(token.Quiesced, report)
+	}
+
+	txns := db.C(txnsName)
+	resumer, err := backupResumer(db, txnsName)
+	if err != nil {
+		token.Release()
+		return nil, errors.Trace(err)
+	}
+	for {
+		pending, err := txns.Find(bson.M{"s": bson.M{"$in": pendingTxnStates}}).Count()
+		if err != nil {
+			token.Release()
+			return nil, errors.Annotate(err, "counting pending transactions")
+		}
+		if pending == 0 {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			token.Release()
+			return nil, errors.Annotatef(err, "%d transactions still pending", pending)
+		}
+		resumeLogger.Infof("resuming %d pending transactions before backup", pending)
+		err = resumePages(resumer, txns, nil, "", defaultResumePageSize, 0, func(resumed, aborted int, _ bson.ObjectId) {
+			token.Resumed += resumed + aborted
+		})
+		if err != nil {
+			// Another process may be running the same transactions, so
+			// wait and try again rather than giving up.
+			resumeLogger.Debugf("resuming transactions before backup: %v", err)
+		}
+		// Transactions started by other processes may still be pending,
+		// so give them time to finish before counting again.
+		select {
+		case <-ctx.Done():
+		case <-time.After(backupPollInterval):
+		}
+	}
+
+	token.Prepared = time.Now().UTC()
+	if token.LastTxnId, err = newestTxnId(txns); err != nil {
+		token.Release()
+		return nil, errors.Trace(err)
+	}
+	return token, nil
+}
+
+// backupResumer returns a runner to resume pending transactions with. It
+// isn't quiesced, unlike the application's runners. Changes are written
+// to the change log, if there is one, as they would be by the
+// application.
+func backupResumer(db *mgo.Database, txnsName string) (*txn.Runner, error) {
+	runner := txn.NewRunner(db.C(txnsName))
+	iter, err := listCollections(db, bson.M{"name": txnsName + ".log"})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var info collectionInfo
+	if iter.Next(&info) {
+		runner.ChangeLog(db.C(info.Name))
+	}
+	if err := iter.Close(); err != nil {
+		return nil, errors.Annotate(err, "looking for change log")
+	}
+	return runner, nil
+}
+
+// newestTxnId returns the id of the newest transaction in txns, or "" if
+// there are none. Transaction ids start with the time they were made, so
+// unlike the number of transactions, it only changes when a transaction
+// is started, and not when transactions are pruned.
+func newestTxnId(txns *mgo.Collection) (bson.ObjectId, error) {
+	var last struct {
+		Id bson.ObjectId `bson:"_id"`
+	}
+	err := txns.Find(nil).Select(bson.M{"_id": 1}).Sort("-_id").One(&last)
+	if err != nil && err != mgo.ErrNotFound {
+		return "", errors.Annotate(err, "finding newest transaction")
+	}
+	return last.Id, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"context"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+	"github.com/juju/txn/v3/mocks"
+)
+
+type PrepareForBackupSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&PrepareForBackupSuite{})
+
+func (s *PrepareForBackupSuite) TestPrepareForBackup(c *gc.C) {
+	last := s.runTxn(c, txn.Op{C: "coll", Id: 0, Insert: bson.M{}})
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{Database: s.db}).(jujutxn.ReadOnlyRunner)
+
+	token, err := jujutxn.PrepareForBackup(context.Background(), s.db, "txns", runner)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(token.LastTxnId, gc.Equals, last)
+	c.Check(token.Quiesced, jc.DeepEquals, []jujutxn.QuiesceReport{{
+		Drained: true,
+		Waited:  token.Quiesced[0].Waited,
+	}})
+	c.Check(runner.ReadOnly(), jc.IsTrue)
+	c.Check(token.Verify(s.db), jc.ErrorIsNil)
+
+	token.Release()
+	c.Check(runner.ReadOnly(), jc.IsFalse)
+	s.runTxn(c, txn.Op{C: "coll", Id: 1, Insert: bson.M{}})
+	c.Check(token.Verify(s.db), jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *PrepareForBackupSuite) TestVerifyIgnoresPrunedTxns(c *gc.C) {
+	first := s.runTxn(c, txn.Op{C: "coll", Id: 0, Insert: bson.M{}})
+	s.runTxn(c, txn.Op{C: "coll", Id: 1, Insert: bson.M{}})
+	token, err := jujutxn.PrepareForBackup(context.Background(), s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	defer token.Release()
+
+	c.Assert(s.db.C("txns").RemoveId(first), jc.ErrorIsNil)
+	c.Check(token.Verify(s.db), jc.ErrorIsNil)
+}
+
+func (s *PrepareForBackupSuite) TestPrepareForBackupResumesPending(c *gc.C) {
+	s.runInterruptedTxn(c, txn.Op{C: "coll", Id: 0, Insert: bson.M{}})
+	last := s.runInterruptedTxn(c, txn.Op{C: "coll", Id: 1, Insert: bson.M{}})
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{Database: s.db}).(jujutxn.ReadOnlyRunner)
+
+	token, err := jujutxn.PrepareForBackup(context.Background(), s.db, "txns", runner)
+	c.Assert(err, jc.ErrorIsNil)
+	defer token.Release()
+	c.Check(token.Resumed, gc.Equals, 2)
+	c.Check(token.LastTxnId, gc.Equals, last)
+	s.assertCollCount(c, "coll", 2)
+}
+
+type PrepareForBackupQuiesceSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&PrepareForBackupQuiesceSuite{})
+
+func (*PrepareForBackupQuiesceSuite) TestQuiesceFailureReleasesRunners(c *gc.C) {
+	first := mocks.NewRunner()
+	second := mocks.NewRunner()
+	second.SetErrors(context.DeadlineExceeded)
+	db := &mgo.Database{Name: "juju"}
+
+	_, err := jujutxn.PrepareForBackup(context.Background(), db, "txns", first, second)
+	c.Check(err, gc.ErrorMatches, "quiescing runners: context deadline exceeded")
+	first.CheckCallNames(c, "ReadOnly", "Quiesce", "SetReadOnly")
+	first.CheckCall(c, 2, "SetReadOnly", false)
+	c.Check(first.IsReadOnly, jc.IsFalse)
+}
+
+func (*PrepareForBackupQuiesceSuite) TestRunnerMustBeReadOnlyRunner(c *gc.C) {
+	first := mocks.NewRunner()
+	// Embedding the interface hides the runner's other methods.
+	second := struct{ jujutxn.Runner }{mocks.NewRunner()}
+	db := &mgo.Database{Name: "juju"}
+
+	_, err := jujutxn.PrepareForBackup(context.Background(), db, "txns", first, second)
+	c.Check(err, gc.ErrorMatches, `quiescing runner struct \{ txn.Runner \} not supported`)
+	c.Check(err, jc.Satisfies, errors.IsNotSupported)
+	first.CheckCallNames(c, "ReadOnly", "Quiesce", "SetReadOnly")
+	c.Check(first.IsReadOnly, jc.IsFalse)
+}
+
+func (*PrepareForBackupQuiesceSuite) TestReleaseKeepsReadOnlyRunners(c *gc.C) {
+	first := mocks.NewRunner()
+	first.IsReadOnly = true
+	second := mocks.NewRunner()
+	second.SetErrors(context.DeadlineExceeded)
+	third := mocks.NewRunner()
+	db := &mgo.Database{Name: "juju"}
+
+	_, err := jujutxn.PrepareForBackup(context.Background(), db, "txns", first, third, second)
+	c.Check(err, gc.ErrorMatches, "quiescing runners: context deadline exceeded")
+	first.CheckCall(c, 2, "SetReadOnly", true)
+	c.Check(first.IsReadOnly, jc.IsTrue)
+	third.CheckCall(c, 2, "SetReadOnly", false)
+	c.Check(third.IsReadOnly, jc.IsFalse)
+}
@@ -0,0 +1,188 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	stderrors "errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// defaultBreakerCooldown is the default of RunnerParams.BreakerCooldown.
+const defaultBreakerCooldown = 30 * time.Second
+
+// BreakerState is the state of a Runner's circuit breaker.
+type BreakerState string
+
+const (
+	// BreakerClosed means transactions are attempted as normal.
+	BreakerClosed BreakerState = "closed"
+
+	// BreakerOpen means too many attempts in a row failed to reach the
+	// database, and transactions fail with ErrBackendUnavailable until
+	// the cool-down has passed.
+	BreakerOpen BreakerState = "open"
+
+	// BreakerHalfOpen means the cool-down has passed and a single
+	// attempt is testing the connection. Other transactions fail with
+	// ErrBackendUnavailable until it finishes.
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerStats reports the state of a Runner's circuit breaker. See
+// RunnerParams.BreakerFailures.
+type BreakerStats struct {
+	// State is the state of the breaker. It is BreakerClosed if the
+	// breaker isn't configured.
+	State BreakerState
+
+	// ConsecutiveFailures is how many attempts in a row have failed to
+	// reach the database.
+	ConsecutiveFailures int
+
+	// Opened is when the breaker last opened, if it is not closed.
+	Opened time.Time
+
+	// Trips is how many times the breaker has opened, and Rejected is
+	// how many transactions failed with ErrBackendUnavailable.
+	Trips    int64
+	Rejected int64
+}
+
+// circuitBreaker stops a runner from making attempts against a database
+// it can't reach.
+type circuitBreaker struct {
+	clock    Clock
+	failures int
+	cooldown time.Duration
+
+	mu      sync.Mutex
+	stats   BreakerStats
+	probing bool
+}
+
+// newCircuitBreaker returns a circuitBreaker for the settings in params,
+// or nil if there isn't to be one.
+func newCircuitBreaker(params RunnerParams, clock Clock) *circuitBreaker {
+	if params.BreakerFailures <= 0 {
+		return nil
+	}
+	cooldown := params.BreakerCooldown
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return &circuitBreaker{
+		clock:    clock,
+		failures: params.BreakerFailures,
+		cooldown: cooldown,
+		stats:    BreakerStats{State: BreakerClosed},
+	}
+}
+
+// allow returns ErrBackendUnavailable if an attempt may not be made now.
+// Otherwise the attempt must be reported to done, or to cancel if it
+// isn't made. It is safe to call on a nil circuitBreaker.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.stats.State {
+	case BreakerOpen:
+		if b.clock.Now().Sub(b.stats.Opened) < b.cooldown {
+			b.stats.Rejected++
+			return ErrBackendUnavailable
+		}
+		b.stats.State = BreakerHalfOpen
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			b.stats.Rejected++
+			return ErrBackendUnavailable
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// done records the outcome of an attempt allowed by allow. It is safe to
+// call on a nil circuitBreaker.
+func (b *circuitBreaker) done(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	probe := b.stats.State == BreakerHalfOpen
+	if probe {
+		b.probing = false
+	}
+	if !isConnectionError(err) {
+		b.stats.ConsecutiveFailures = 0
+		if probe {
+			runnerLogger.Infof("database reachable again, closing circuit breaker")
+		}
+		b.stats.State = BreakerClosed
+		b.stats.Opened = time.Time{}
+		return
+	}
+	b.stats.ConsecutiveFailures++
+	if probe || (b.stats.State == BreakerClosed && b.stats.ConsecutiveFailures >= b.failures) {
+		runnerLogger.Warningf("%d attempts in a row failed to reach the database, failing transactions for %s: %v",
+			b.stats.ConsecutiveFailures, b.cooldown, err)
+		b.stats.State = BreakerOpen
+		b.stats.Opened = b.clock.Now()
+		b.stats.Trips++
+	}
+}
+
+// cancel records that an attempt allowed by allow wasn't made, so that
+// another can test the connection instead. It is safe to call on a nil
+// circuitBreaker.
+func (b *circuitBreaker) cancel() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// snapshot returns a copy of the breaker's stats. It is safe to call on a
+// nil circuitBreaker.
+func (b *circuitBreaker) snapshot() BreakerStats {
+	if b == nil {
+		return BreakerStats{State: BreakerClosed}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// isConnectionError returns true if err shows that the database couldn't
+// be reached, rather than that it refused or failed an operation.
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	err = errors.Cause(err)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	var netErr net.Error
+	if stderrors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "no reachable servers") ||
+		strings.HasSuffix(msg, "i/o timeout") ||
+		strings.HasSuffix(msg, "connection refused") ||
+		strings.HasSuffix(msg, "connection reset by peer")
+}
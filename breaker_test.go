@@ -0,0 +1,122 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	stderrors "errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/juju/errors"
+	jujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type BreakerSuite struct {
+	jujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&BreakerSuite{})
+
+var errUnreachable = errors.Annotate(io.EOF, "running transaction")
+
+// attempt makes an attempt through b that fails with err, and returns
+// whether the breaker allowed it.
+func attempt(b *circuitBreaker, err error) bool {
+	if b.allow() != nil {
+		return false
+	}
+	b.done(err)
+	return true
+}
+
+func (s *BreakerSuite) TestNotConfigured(c *gc.C) {
+	b := newCircuitBreaker(RunnerParams{}, testclock.NewClock(time.Now()))
+	c.Assert(b, gc.IsNil)
+	for i := 0; i < 10; i++ {
+		c.Check(attempt(b, errUnreachable), jc.IsTrue)
+	}
+	c.Check(b.snapshot(), gc.Equals, BreakerStats{State: BreakerClosed})
+}
+
+func (s *BreakerSuite) TestOpensAfterConsecutiveFailures(c *gc.C) {
+	clock := testclock.NewClock(time.Now())
+	b := newCircuitBreaker(RunnerParams{BreakerFailures: 3}, clock)
+	c.Check(attempt(b, errUnreachable), jc.IsTrue)
+	c.Check(attempt(b, errUnreachable), jc.IsTrue)
+	// Other errors reset the count.
+	c.Check(attempt(b, stderrors.New("boom")), jc.IsTrue)
+	c.Check(b.snapshot().ConsecutiveFailures, gc.Equals, 0)
+
+	for i := 0; i < 3; i++ {
+		c.Check(attempt(b, errUnreachable), jc.IsTrue)
+	}
+	c.Check(b.allow(), gc.Equals, ErrBackendUnavailable)
+	c.Check(b.snapshot(), gc.Equals, BreakerStats{
+		State:               BreakerOpen,
+		ConsecutiveFailures: 3,
+		Opened:              clock.Now(),
+		Trips:               1,
+		Rejected:            1,
+	})
+}
+
+func (s *BreakerSuite) TestHalfOpenProbe(c *gc.C) {
+	clock := testclock.NewClock(time.Now())
+	b := newCircuitBreaker(RunnerParams{BreakerFailures: 1, BreakerCooldown: time.Minute}, clock)
+	c.Check(attempt(b, errUnreachable), jc.IsTrue)
+	clock.Advance(59 * time.Second)
+	c.Check(b.allow(), gc.Equals, ErrBackendUnavailable)
+
+	// After the cool-down, one attempt tests the connection, and opens
+	// the breaker again if it fails.
+	clock.Advance(time.Second)
+	c.Assert(b.allow(), jc.ErrorIsNil)
+	c.Check(b.snapshot().State, gc.Equals, BreakerHalfOpen)
+	c.Check(b.allow(), gc.Equals, ErrBackendUnavailable)
+	b.done(errUnreachable)
+	c.Check(b.snapshot().State, gc.Equals, BreakerOpen)
+	c.Check(b.snapshot().Trips, gc.Equals, int64(2))
+	c.Check(b.allow(), gc.Equals, ErrBackendUnavailable)
+
+	// A probe that isn't made lets another try.
+	clock.Advance(time.Minute)
+	c.Assert(b.allow(), jc.ErrorIsNil)
+	b.cancel()
+	c.Assert(b.allow(), jc.ErrorIsNil)
+
+	// The breaker closes once the database is reached.
+	b.done(nil)
+	c.Check(b.snapshot().State, gc.Equals, BreakerClosed)
+	c.Check(b.snapshot().ConsecutiveFailures, gc.Equals, 0)
+	c.Check(attempt(b, nil), jc.IsTrue)
+}
+
+func (s *BreakerSuite) TestDefaultCooldown(c *gc.C) {
+	b := newCircuitBreaker(RunnerParams{BreakerFailures: 1}, testclock.NewClock(time.Now()))
+	c.Check(b.cooldown, gc.Equals, defaultBreakerCooldown)
+}
+
+func (s *BreakerSuite) TestIsConnectionError(c *gc.C) {
+	for i, test := range []struct {
+		err    error
+		expect bool
+	}{
+		{nil, false},
+		{io.EOF, true},
+		{errUnreachable, true},
+		{&net.OpError{Op: "dial", Err: stderrors.New("connection refused")}, true},
+		{stderrors.New("no reachable servers"), true},
+		{stderrors.New("read tcp 10.0.0.1:37017: i/o timeout"), true},
+		{stderrors.New("transaction aborted"), false},
+		{ErrExcessiveContention, false},
+		{&ErrDirtyDoc{Collection: "coll"}, false},
+	} {
+		c.Logf("test %d: %v", i, test.err)
+		c.Check(isConnectionError(test.err), gc.Equals, test.expect)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	stderrors "errors"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// pruneCheckpointId is the _id of the document in txns.prune that records
+// where PruneBudgeted got to.
+const pruneCheckpointId = "checkpoint"
+
+// PruneCheckpoint records how far PruneBudgeted has got through the
+// transactions, so that the next slice can carry on from there.
+type PruneCheckpoint struct {
+	Id string `bson:"_id"`
+
+	// After is the id of the last transaction dealt with. It is empty
+	// once a slice has got to the end of the transactions, so that the
+	// next slice starts again from the oldest.
+	After bson.ObjectId `bson:"after,omitempty"`
+
+	// Updated is when the checkpoint was written.
+	Updated time.Time `bson:"updated"`
+}
+
+// BudgetedPruneResult describes the outcome of PruneBudgeted.
+type BudgetedPruneResult struct {
+	// Stats holds the work done in the slice.
+	Stats CleanupStats
+
+	// Complete is true if the slice got to the end of the transactions.
+	Complete bool
+
+	// Skipped is true if nothing was done because another process was
+	// already pruning.
+	Skipped bool
+
+	// Checkpoint is where the next slice will start.
+	Checkpoint PruneCheckpoint
+}
+
+// ReadPruneCheckpoint returns the checkpoint last written by PruneBudgeted
+// for txnsName. It returns a NotFound error if none has been written.
+func ReadPruneCheckpoint(db *mgo.Database, txnsName string) (*PruneCheckpoint, error) {
+	var checkpoint PruneCheckpoint
+	err := db.C(txnsPruneC(txnsName)).FindId(pruneCheckpointId).One(&checkpoint)
+	if err == mgo.ErrNotFound {
+		return nil, errors.NotFoundf("prune checkpoint for %q", txnsName)
+	} else if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &checkpoint, nil
+}
+
+// PruneBudgeted prunes txnsName for at most slice, and is meant to be
+// called from a periodic job, eg to prune for 5 minutes every hour. It
+// carries on from the checkpoint left by the previous call, prunes until
+// the slice is used up, and then records a new checkpoint before
+// returning. Once a slice gets to the end of the transactions, the next
+// one starts again from the oldest.
+//
+// Unlike MaybePrune, it doesn't check whether the transactions have grown
+// enough to be worth pruning, and it doesn't record prune history. It does
+// nothing if another process is already pruning.
+func PruneBudgeted(db *mgo.Database, txnsName string, slice time.Duration, pruneOpts PruneOptions) (BudgetedPruneResult, error) {
+	return pruneBudgeted(db, txnsName, slice, pruneOpts, nil, nil)
+}
+
+// pruneBudgeted is PruneBudgeted, but also ends the slice early if stop is
+// closed, and passes the prune job to started, if set, once it is running.
+func pruneBudgeted(
+	db *mgo.Database,
+	txnsName string,
+	slice time.Duration,
+	pruneOpts PruneOptions,
+	stop <-chan struct{},
+	started func(*PruneJob),
+) (BudgetedPruneResult, error) {
+	var result BudgetedPruneResult
+	if slice <= 0 {
+		return result, errors.NotValidf("slice %s", slice)
+	}
+	validatePruneOptions(&pruneOpts)
+	checkpoint, err := ReadPruneCheckpoint(db, txnsName)
+	if errors.IsNotFound(err) {
+		checkpoint = &PruneCheckpoint{}
+	} else if err != nil {
+		return result, errors.Trace(err)
+	}
+	session := db.Session.Copy()
+	defer session.Close()
+	txns := db.C(txnsName).With(session)
+	if pruneOpts.MinFreeDiskBytes != 0 {
+		txnsCount, err := txns.Count()
+		if err != nil {
+			return result, errors.Annotate(err, "counting txns")
+		}
+		if err := checkDiskSpace(db, txnsCount, pruneOpts); err != nil {
+			return result, errors.Trace(err)
+		}
+	}
+	job, err := StartCleanAndPrune(CleanAndPruneArgs{
+		Txns:                     txns,
+		MaxTime:                  pruneOpts.MaxTime,
+		StartAfter:               checkpoint.After,
+		MaxTransactionsToProcess: pruneOpts.MaxBatchTransactions,
+		TxnBatchSize:             pruneOpts.SmallBatchTransactionCount,
+		TxnBatchSleepTime:        pruneOpts.BatchTransactionSleepTime,
+		MaxPasses:                pruneOpts.MaxBatches,
+		MaxRuntime:               slice,
+		LoadMonitor:              pruneOpts.LoadMonitor,
+		ConcurrentPrune:          ConcurrentPruneSkip,
+	})
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+	if started != nil {
+		started(job)
+	}
+	timer := time.NewTimer(slice)
+	select {
+	case <-job.Done():
+		timer.Stop()
+	case <-timer.C:
+		pruneLogger.Debugf("pruning slice of %s used up, stopping", slice)
+		job.Cancel()
+	case <-stop:
+		pruneLogger.Infof("pruning slice stopped early")
+		timer.Stop()
+		job.Cancel()
+	}
+	stats, err := job.Wait()
+	result.Stats = stats
+	if stats.ConcurrentPrune == ConcurrentPruneSkip {
+		result.Skipped = true
+		result.Checkpoint = *checkpoint
+		return result, nil
+	}
+	cancelled := stderrors.Is(err, ErrPruneCancelled)
+	if err != nil && !cancelled {
+		// Keep the work that was done before the error.
+		if stats.Checkpoint > checkpoint.After {
+			if _, werr := writePruneCheckpoint(db, txnsName, stats.Checkpoint); werr != nil {
+				pruneLogger.Warningf("unable to write prune checkpoint: %v", werr)
+			}
+		}
+		return result, errors.Trace(err)
+	}
+	result.Complete = !cancelled && !stats.ShouldRetry
+	next := stats.Checkpoint
+	if result.Complete {
+		next = ""
+	} else if next == "" {
+		// No batch was finished in the slice.
+		next = checkpoint.After
+	}
+	result.Checkpoint, err = writePruneCheckpoint(db, txnsName, next)
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+	pruneLogger.Infof("pruning slice removed %d txns, complete: %v", stats.TransactionsRemoved, result.Complete)
+	return result, nil
+}
+
+// writePruneCheckpoint records that the next slice should start after the
+// transaction with id after.
+func writePruneCheckpoint(db *mgo.Database, txnsName string, after bson.ObjectId) (PruneCheckpoint, error) {
+	checkpoint := PruneCheckpoint{
+		Id:      pruneCheckpointId,
+		After:   after,
+		Updated: time.Now(),
+	}
+	if _, err := db.C(txnsPruneC(txnsName)).UpsertId(pruneCheckpointId, checkpoint); err != nil {
+		return checkpoint, errors.Annotate(err, "writing prune checkpoint")
+	}
+	return checkpoint, nil
+}
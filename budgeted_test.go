@@ -0,0 +1,87 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type PruneBudgetedSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&PruneBudgetedSuite{})
+
+func (s *PruneBudgetedSuite) TestPrunesEverything(c *gc.C) {
+	for i := 0; i < 5; i++ {
+		s.runTxn(c, txn.Op{C: "coll", Id: i, Insert: bson.M{}})
+	}
+	result, err := jujutxn.PruneBudgeted(s.db, "txns", time.Minute, jujutxn.PruneOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.Complete, jc.IsTrue)
+	c.Check(result.Skipped, jc.IsFalse)
+	c.Check(result.Stats.TransactionsRemoved, gc.Equals, 5)
+	s.assertTxns(c)
+
+	checkpoint, err := jujutxn.ReadPruneCheckpoint(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(checkpoint.After, gc.Equals, bson.ObjectId(""))
+}
+
+func (s *PruneBudgetedSuite) TestStartsFromCheckpoint(c *gc.C) {
+	var ids []bson.ObjectId
+	for i := 0; i < 4; i++ {
+		ids = append(ids, s.runTxn(c, txn.Op{C: "coll", Id: i, Insert: bson.M{}}))
+	}
+	err := s.db.C("txns.prune").Insert(bson.M{"_id": "checkpoint", "after": ids[1]})
+	c.Assert(err, jc.ErrorIsNil)
+
+	result, err := jujutxn.PruneBudgeted(s.db, "txns", time.Minute, jujutxn.PruneOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.Complete, jc.IsTrue)
+	c.Check(result.Stats.TransactionsRemoved, gc.Equals, 2)
+	s.assertTxns(c, ids[0], ids[1])
+	// Having got to the end, the next slice starts from the beginning.
+	c.Check(result.Checkpoint.After, gc.Equals, bson.ObjectId(""))
+
+	result, err = jujutxn.PruneBudgeted(s.db, "txns", time.Minute, jujutxn.PruneOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.Stats.TransactionsRemoved, gc.Equals, 2)
+	s.assertTxns(c)
+}
+
+func (s *PruneBudgetedSuite) TestCheckpointWhenIncomplete(c *gc.C) {
+	var ids []bson.ObjectId
+	for i := 0; i < 4; i++ {
+		ids = append(ids, s.runTxn(c, txn.Op{C: "coll", Id: i, Insert: bson.M{}}))
+	}
+	result, err := jujutxn.PruneBudgeted(s.db, "txns", time.Minute, jujutxn.PruneOptions{
+		MaxBatchTransactions: 2,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.Complete, jc.IsFalse)
+	c.Check(result.Checkpoint.After, gc.Equals, ids[1])
+
+	checkpoint, err := jujutxn.ReadPruneCheckpoint(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(checkpoint.After, gc.Equals, ids[1])
+}
+
+func (s *PruneBudgetedSuite) TestNoCheckpoint(c *gc.C) {
+	_, err := jujutxn.ReadPruneCheckpoint(s.db, "txns")
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *PruneBudgetedSuite) TestInvalidSlice(c *gc.C) {
+	_, err := jujutxn.PruneBudgeted(s.db, "txns", 0, jujutxn.PruneOptions{})
+	c.Check(err, gc.ErrorMatches, "slice 0s not valid")
+}
@@ -33,6 +33,32 @@ type CollectionConfig struct {
 	// cleaner never removes documents.
 	MaxRemoveQueue int
 
+	// RemoveChunking selects how the removal of queued documents is split
+	// into separate remove filters. The default is ChunkRemovesByCount.
+	RemoveChunking RemoveChunking
+
+	// MaxRemoveFilterBytes is the largest encoded size of the ids in a
+	// single remove filter when RemoveChunking is ChunkRemovesBySize. It
+	// defaults to 1MiB.
+	MaxRemoveFilterBytes int
+
+	// DeleteStrategy selects how queued documents are removed, for
+	// collections with a collation or ids that need comparing one by
+	// one. See DeleteStrategy.
+	DeleteStrategy DeleteStrategy
+
+	// ReadWholeDocuments reads whole documents rather than just their _id
+	// and txn-queue. It is only for servers which mishandle projections.
+	ReadWholeDocuments bool
+
+	// SoftDelete moves removed documents into the trash collection of
+	// Source instead of removing them outright. See NewTrashRemover.
+	SoftDelete bool
+
+	// Features, if not nil, restricts the behaviours above to those that
+	// are enabled. See Features.
+	Features *Features
+
 	// LogInterval defines how often we will show progress
 	LogInterval time.Duration
 }
@@ -62,9 +88,18 @@ type CollectionStats struct {
 	// PulledCount is the number of tokens that were removed from documents.
 	PulledTokenCount int
 
+	// InvalidTokenCount is the number of malformed tokens found in
+	// document queues. They are left alone.
+	InvalidTokenCount int
+
 	// RemovedCount represents the number of txns.stash documents that we
 	// decided to remove entirely.
 	RemovedCount int
+
+	// ConcurrentlyRemovedCount is the number of documents we decided to
+	// remove that were already gone when we removed them. They are not
+	// included in RemovedCount.
+	ConcurrentlyRemovedCount int
 }
 
 // txnDocument represents the fields we care about for objects that participate
@@ -105,15 +140,25 @@ func (stats CollectionStats) HasChanges() bool {
 }
 
 func (stats CollectionStats) Details() string {
-	return fmt.Sprintf("processed %d documents, removed %d, updated %d (%d tokens)\n"+
+	details := fmt.Sprintf("processed %d documents, removed %d, updated %d (%d tokens)\n"+
 		"checked %d tokens (%d completed unique) across %d completed transactions",
 		stats.DocCount, stats.RemovedCount, stats.UpdatedDocCount, stats.PulledTokenCount,
 		stats.TokenCount, stats.CompletedTokenCount, stats.CompletedTxnCount)
+	if stats.InvalidTokenCount > 0 {
+		details += fmt.Sprintf("\nskipped %d invalid tokens", stats.InvalidTokenCount)
+	}
+	if stats.ConcurrentlyRemovedCount > 0 {
+		details += fmt.Sprintf("\n%d documents were already removed", stats.ConcurrentlyRemovedCount)
+	}
+	return details
 }
 
 // NewCollectionCleaner creates an object that can remove transaction tokens
 // from document queues when the transactions have been marked as completed.
 func NewCollectionCleaner(config CollectionConfig) *collectionCleaner {
+	if config.Features != nil {
+		config.Features.applyToCleaner(&config)
+	}
 	if config.NumBatchTokens == 0 {
 		config.NumBatchTokens = queueBatchSize
 	}
@@ -136,6 +181,9 @@ func NewCollectionCleaner(config CollectionConfig) *collectionCleaner {
 // It is different because when we find all references from a document have been
 // removed, we can remove the document.
 func NewStashCleaner(config CollectionConfig) *collectionCleaner {
+	if config.Features != nil {
+		config.Features.applyToCleaner(&config)
+	}
 	return &collectionCleaner{
 		config:         config,
 		docIdsToRemove: make([]interface{}, 0),
@@ -151,6 +199,11 @@ func (cleaner *collectionCleaner) includeDoc(doc txnDocument) error {
 	cleaner.stats.DocCount++
 	cleaner.docsToProcess = append(cleaner.docsToProcess, doc)
 	for _, token := range doc.Queue {
+		if _, err := ParseToken(token); err != nil {
+			pruneLogger.Debugf("document %v in %q: %v", doc.Id, cleaner.config.Source.Name, err)
+			cleaner.stats.InvalidTokenCount++
+			continue
+		}
 		cleaner.tokensToLookup = append(cleaner.tokensToLookup, token)
 	}
 	return nil
@@ -191,8 +244,7 @@ func (cleaner *collectionCleaner) processStashDocs() error {
 	if err != nil {
 		return fmt.Errorf("error looking up completed transactions: %v", err)
 	}
-	pullChunk := cleaner.config.Source.Bulk()
-	pullChunk.Unordered()
+	pullChunk := newBulk(cleaner.config.Source)
 	pullCount := 0
 	pullsToApply := 0
 	flushPulls := func() error {
@@ -206,8 +258,7 @@ func (cleaner *collectionCleaner) processStashDocs() error {
 		}
 		cleaner.stats.UpdatedDocCount += result.Matched
 		cleaner.stats.PulledTokenCount += pullsToApply
-		pullChunk = cleaner.config.Source.Bulk()
-		pullChunk.Unordered()
+		pullChunk = newBulk(cleaner.config.Source)
 		pullCount = 0
 		pullsToApply = 0
 		return nil
@@ -266,29 +317,67 @@ func (cleaner *collectionCleaner) flushRemoveQueue() error {
 	if len(cleaner.docIdsToRemove) == 0 {
 		return nil
 	}
-	remover := newBatchRemover(cleaner.config.Source)
+	var remover Remover
+	if cleaner.config.SoftDelete {
+		remover = newTrashRemover(cleaner.config.Source,
+			cleaner.config.RemoveChunking, cleaner.config.MaxRemoveFilterBytes,
+			cleaner.config.DeleteStrategy)
+	} else {
+		remover = newBatchRemover(cleaner.config.Source,
+			cleaner.config.RemoveChunking, cleaner.config.MaxRemoveFilterBytes,
+			cleaner.config.DeleteStrategy)
+	}
 	for _, docId := range cleaner.docIdsToRemove {
 		if err := remover.Remove(docId); err != nil {
-			return fmt.Errorf("failed while removing document %v from %q",
-				docId, cleaner.config.Source.Name)
+			cleaner.abortRemover(remover)
+			return fmt.Errorf("failed while removing document %v from %q: %v",
+				docId, cleaner.config.Source.Name, err)
 		}
 	}
 	if err := remover.Flush(); err != nil {
-		return fmt.Errorf("failed while removing documents from %q",
-			cleaner.config.Source.Name)
+		cleaner.abortRemover(remover)
+		return fmt.Errorf("failed while removing documents from %q: %v",
+			cleaner.config.Source.Name, err)
 	}
 	cleaner.stats.RemovedCount += remover.Removed()
-	logger.Debugf("flushing %d documents removed %d (%d total)",
+	if missing := len(cleaner.docIdsToRemove) - remover.Removed(); missing > 0 {
+		cleaner.stats.ConcurrentlyRemovedCount += missing
+	}
+	pruneLogger.Debugf("flushing %d documents removed %d (%d total)",
 		len(cleaner.docIdsToRemove), remover.Removed(), cleaner.stats.RemovedCount)
 	cleaner.docIdsToRemove = cleaner.docIdsToRemove[:0]
 	return nil
 }
 
+// abortRemover discards what remover still has queued, while counting the
+// documents it did remove before it failed. The remove queue is kept, so
+// that the removals can be retried by the next flush.
+func (cleaner *collectionCleaner) abortRemover(remover Remover) {
+	remover.Abort()
+	cleaner.stats.RemovedCount += remover.Removed()
+}
+
+// abortRemoveQueue discards the documents queued for removal, when
+// cleaning stops early.
+func (cleaner *collectionCleaner) abortRemoveQueue() {
+	if len(cleaner.docIdsToRemove) > 0 {
+		pruneLogger.Debugf("abandoning removal of %d documents from %q",
+			len(cleaner.docIdsToRemove), cleaner.config.Source.Name)
+		cleaner.docIdsToRemove = cleaner.docIdsToRemove[:0]
+	}
+}
+
 // Cleanup iterates the collection and ensures that all documents no longer
-// reference completed transactions.
-func (cleaner *collectionCleaner) Cleanup() error {
+// reference completed transactions. If it fails, any documents it had
+// queued for removal are left alone.
+func (cleaner *collectionCleaner) Cleanup() (err error) {
+	defer func() {
+		if err != nil {
+			cleaner.abortRemoveQueue()
+		}
+	}()
 	startCount, _ := cleaner.config.Source.Count()
-	logger.Debugf("cleaning up completed references from %q with %d docs",
+	pruneLogger.Debugf("cleaning up completed references from %q with %d docs",
 		cleaner.config.Source.Name, startCount)
 	t := newSimpleTimer(cleaner.config.LogInterval)
 	// If we delete documents while we iterate, it can cause the iterator to
@@ -306,19 +395,24 @@ func (cleaner *collectionCleaner) Cleanup() error {
 			filter = bson.M{"txn-queue": bson.M{"$exists": 1}}
 		}
 		query := cleaner.config.Source.Find(filter)
+		if !cleaner.config.ReadWholeDocuments {
+			query.Select(bson.M{"_id": 1, "txn-queue": 1})
+		}
 		query.Batch(maxBatchDocs)
 		iter := query.Iter()
 		for iter.Next(&doc) {
 			if err := cleaner.includeDoc(doc); err != nil {
+				iter.Close()
 				return err
 			}
 			if t.isAfter() {
-				logger.Debugf("processed %d/%d docs from %q (removed %d)",
+				pruneLogger.Debugf("processed %d/%d docs from %q (removed %d)",
 					cleaner.stats.DocCount, startCount,
 					cleaner.config.Source.Name, cleaner.stats.RemovedCount)
 			}
 			didFlush, err := cleaner.checkFlush()
 			if err != nil {
+				iter.Close()
 				return err
 			}
 			if didFlush {
@@ -326,9 +420,11 @@ func (cleaner *collectionCleaner) Cleanup() error {
 			}
 		}
 		if err := cleaner.processStashDocs(); err != nil {
+			iter.Close()
 			return err
 		}
 		if err := cleaner.flushRemoveQueue(); err != nil {
+			iter.Close()
 			return err
 		}
 		if err := iter.Close(); err != nil {
@@ -340,15 +436,15 @@ func (cleaner *collectionCleaner) Cleanup() error {
 		}
 	}
 	if cleaner.stats.HasChanges() {
-		logger.Debugf("%q %s",
+		pruneLogger.Debugf("%q %s",
 			cleaner.config.Source.Name, cleaner.stats.Details())
 	} else {
-		logger.Debugf("%q: nothing to do",
+		pruneLogger.Debugf("%q: nothing to do",
 			cleaner.config.Source.Name)
 	}
 	if cleaner.removeIfEmpty {
 		finalCount, _ := cleaner.config.Source.Count()
-		logger.Debugf("%s has %d documents left",
+		pruneLogger.Debugf("%s has %d documents left",
 			cleaner.config.Source.Name, finalCount)
 	}
 	return nil
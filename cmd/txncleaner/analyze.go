@@ -0,0 +1,102 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+
+	"github.com/juju/txn/v3"
+)
+
+// analyzeCommand prints how much there is to prune, without pruning. args
+// follow "analyze".
+func analyzeCommand(args []string) int {
+	if *dbName == "" || len(args) != 0 {
+		log.Println("usage: -db NAME analyze")
+		return exitFailed
+	}
+	session, err := dial()
+	if err != nil {
+		log.Printf("failed to connect to mongo: %v", err)
+		return exitTransient
+	}
+	defer session.Close()
+	if *samplePercent != 0 {
+		return estimateCommand(session.DB(*dbName))
+	}
+	report, err := txn.Analyze(session.DB(*dbName), *txnsName)
+	if err != nil {
+		log.Printf("failed to analyze txns: %v", err)
+		return exitTransient
+	}
+	if *jsonOutput {
+		return writeJSON(report)
+	}
+	fmt.Printf("%d txns, %d prunable, %d pending\n", report.TxnCount, report.PrunableTxns, report.PendingTxns)
+	fmt.Printf("%d stash docs, %dMiB\n", report.StashCount, report.StashBytes>>20)
+	fmt.Println("txn-queue lengths:")
+	for _, bucket := range report.QueueLengths {
+		bounds := fmt.Sprintf("%d-%d", bucket.Min, bucket.Max)
+		if bucket.Max == 0 {
+			bounds = fmt.Sprintf("%d+", bucket.Min)
+		}
+		fmt.Printf("  %10s: %d docs\n", bounds, bucket.Docs)
+	}
+	fmt.Println("collections by txn references:")
+	for _, coll := range report.Collections {
+		fmt.Printf("  %s: %d tokens in %d docs, longest queue %d\n", coll.Collection, coll.Tokens, coll.Docs, coll.MaxLength)
+	}
+	fmt.Printf("analyzed in %s\n", report.Duration.Round(time.Millisecond))
+	return exitDone
+}
+
+// estimateCommand prints an estimate of how much there is to prune, from a
+// sample of -sample percent of the txns and docs.
+func estimateCommand(db *mgo.Database) int {
+	estimate, err := txn.EstimatePrune(db, *txnsName, txn.EstimateOptions{
+		SampleFraction: *samplePercent / 100,
+	})
+	if errors.IsNotValid(err) {
+		log.Printf("-sample must be between 0 and 100: %v", err)
+		return exitFailed
+	} else if err != nil {
+		log.Printf("failed to estimate pruning: %v", err)
+		return exitTransient
+	}
+	if *jsonOutput {
+		return writeJSON(estimate)
+	}
+	fmt.Printf("%d txns, sampled %d\n", estimate.TxnCount, estimate.TxnsSampled)
+	fmt.Printf("prunable txns: %.0f (95%% %.0f-%.0f)\n",
+		estimate.PrunableTxns.Value, estimate.PrunableTxns.Low, estimate.PrunableTxns.High)
+	fmt.Printf("txn-queue tokens: %.0f (95%% %.0f-%.0f), sampled %d docs\n",
+		estimate.QueueTokens.Value, estimate.QueueTokens.Low, estimate.QueueTokens.High, estimate.DocsSampled)
+	if estimate.PruneRate > 0 {
+		runtime := estimate.Runtime
+		fmt.Printf("pruning at %.0f txns/s would take %s (95%% %s-%s)\n", estimate.PruneRate,
+			runtime.Value.Round(time.Second), runtime.Low.Round(time.Second), runtime.High.Round(time.Second))
+	} else {
+		fmt.Println("no prunes recorded to estimate the runtime from")
+	}
+	fmt.Printf("estimated in %s\n", estimate.Duration.Round(time.Millisecond))
+	return exitDone
+}
+
+// writeJSON writes v to stdout as indented JSON.
+func writeJSON(v interface{}) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Println(err)
+		return exitFailed
+	}
+	return exitDone
+}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -25,36 +26,49 @@ var insecureTLS = flag.Bool("insecuretls", false, "connect with insecure TLS han
 var dialTimeout = flag.Int("dialtimeout", 10, "dial timeout")
 var syncTimeout = flag.Int("synctimeout", 7, "session sync timeout")
 var socketTimeout = flag.Int("sockettimeout", 60, "session socket timeout")
+var skipIfRunning = flag.Bool("skipifrunning", false, "exit if another process is already pruning")
+var jsonOutput = flag.Bool("json", false, "write the outcome and stats to stdout as JSON")
+var compactTxns = flag.Bool("compact", false, "compact the txns collections after large prunes, rather than only advising it")
+var explainSlow = flag.Duration("explainslow", 0, "explain pruning queries that take longer than this")
+var oplogFraction = flag.Float64("oplogfraction", 0, "the most of the oplog window pruning may consume per hour, 0 to not pace")
+var indexHints = flag.Bool("indexhints", false, "choose the indexes pruning queries use, and warn of collection scans")
+var redactFields = flag.String("redact", "", "comma separated fields whose values show redacts")
+var samplePercent = flag.Float64("sample", 0, "percent of txns and docs that analyze samples to estimate pruning, rather than reading them all")
+var only = flag.String("only", "", `"clean" to only clean document queues, or "prune" to only remove txns that are no longer referenced`)
+
+// Exit codes, so that scheduled jobs can tell the outcomes apart.
+const (
+	exitDone      = 0
+	exitFailed    = 1
+	exitPartial   = 3
+	exitLockHeld  = 4
+	exitTransient = 5
+)
+
+// result is written to stdout when -json is given.
+type result struct {
+	Outcome  string            `json:"outcome"`
+	Error    string            `json:"error,omitempty"`
+	Duration string            `json:"duration"`
+	Stats    *txn.CleanupStats `json:"stats,omitempty"`
+}
 
 func main() {
 	flag.Usage = wrapUsage(flag.Usage)
 	flag.Parse()
 
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
 	if *dbName == "" {
 		flag.PrintDefaults()
-		os.Exit(1)
+		os.Exit(exitFailed)
 	}
 
-	var (
-		session *mgo.Session
-		err     error
-	)
-
-	if *insecureTLS {
-		info, err := mgo.ParseURL(*url)
-		if err != nil {
-			log.Fatalf("failed to parse url: %v", err)
-		}
-		info.DialServer = dialInsecureTLS
-		session, err = mgo.DialWithInfo(info)
-		if err != nil {
-			log.Fatalf("failed to connect to mongo: %v", err)
-		}
-	} else {
-		session, err = mgo.DialWithTimeout(*url, time.Second*time.Duration(*dialTimeout))
-		if err != nil {
-			log.Fatalf("failed to connect to mongo: %v", err)
-		}
+	startTime := time.Now()
+	session, err := dial()
+	if err != nil {
+		exit(startTime, exitTransient, nil, fmt.Errorf("failed to connect to mongo: %v", err))
 	}
 	session.SetSyncTimeout(time.Second * time.Duration(*syncTimeout))
 	session.SetSocketTimeout(time.Second * time.Duration(*socketTimeout))
@@ -62,15 +76,98 @@ func main() {
 	db := session.DB(*dbName)
 	txnsC := db.C(*txnsName)
 
-	startTime := time.Now()
-	stats, err := txn.CleanAndPrune(txn.CleanAndPruneArgs{Txns: txnsC})
-	if err != nil {
-		log.Fatalf("failed to clean and prune txns: %v", err)
+	args := txn.CleanAndPruneArgs{Txns: txnsC}
+	if *skipIfRunning {
+		args.ConcurrentPrune = txn.ConcurrentPruneSkip
+	}
+	args.ExplainSlowQueries = *explainSlow
+	args.Compaction = &txn.CompactionPolicy{Compact: *compactTxns}
+	if *oplogFraction != 0 {
+		args.OplogPacing = &txn.OplogPacing{MaxWindowFractionPerHour: *oplogFraction}
+	}
+	if *indexHints {
+		args.IndexHints = &txn.IndexHints{Auto: true}
+	}
+	cleanAndPrune := txn.CleanAndPrune
+	switch *only {
+	case "":
+	case "clean":
+		cleanAndPrune = txn.CleanDocQueues
+	case "prune":
+		cleanAndPrune = txn.PruneTxns
+	default:
+		exit(startTime, exitFailed, nil, fmt.Errorf("-only must be clean or prune, not %q", *only))
+	}
+	stats, err := cleanAndPrune(args)
+	switch {
+	case err != nil && txn.IsTransientPruneError(err):
+		exit(startTime, exitTransient, &stats, fmt.Errorf("failed to clean and prune txns: %v", err))
+	case err != nil:
+		exit(startTime, exitFailed, &stats, fmt.Errorf("failed to clean and prune txns: %v", err))
+	case stats.ConcurrentPrune == txn.ConcurrentPruneSkip:
+		log.Println("another process is already pruning")
+		exit(startTime, exitLockHeld, &stats, nil)
 	}
 
 	log.Println("clean and prune complete after", time.Since(startTime))
 	log.Println(stats.DocsCleaned, "docs cleaned,", stats.TransactionsRemoved, "txns removed,",
 		stats.StashDocumentsRemoved, "txns.stash docs removed")
+	for _, advice := range stats.Compaction {
+		switch {
+		case advice.Compacted:
+			log.Printf("compacted %s", advice.Collection)
+		case advice.CompactError != "":
+			log.Printf("failed to compact %s: %s", advice.Collection, advice.CompactError)
+		case advice.Recommended:
+			log.Printf("%s has %dMiB to reclaim, consider running compact", advice.Collection, advice.ReclaimableBytes>>20)
+		}
+	}
+	if stats.ShouldRetry {
+		log.Println("pruning incomplete, run again to carry on")
+		exit(startTime, exitPartial, &stats, nil)
+	}
+	exit(startTime, exitDone, &stats, nil)
+}
+
+func dial() (*mgo.Session, error) {
+	if !*insecureTLS {
+		return mgo.DialWithTimeout(*url, time.Second*time.Duration(*dialTimeout))
+	}
+	info, err := mgo.ParseURL(*url)
+	if err != nil {
+		log.Fatalf("failed to parse url: %v", err)
+	}
+	info.DialServer = dialInsecureTLS
+	return mgo.DialWithInfo(info)
+}
+
+// exit reports the outcome, and exits with code.
+func exit(startTime time.Time, code int, stats *txn.CleanupStats, err error) {
+	if err != nil {
+		log.Println(err)
+	}
+	if *jsonOutput {
+		out := result{
+			Outcome:  outcomes[code],
+			Duration: time.Since(startTime).String(),
+			Stats:    stats,
+		}
+		if err != nil {
+			out.Error = err.Error()
+		}
+		if encErr := json.NewEncoder(os.Stdout).Encode(out); encErr != nil {
+			log.Printf("failed to write JSON: %v", encErr)
+		}
+	}
+	os.Exit(code)
+}
+
+var outcomes = map[int]string{
+	exitDone:      "done",
+	exitFailed:    "failed",
+	exitPartial:   "partial",
+	exitLockHeld:  "lock-held",
+	exitTransient: "transient-error",
 }
 
 func dialInsecureTLS(addr *mgo.ServerAddr) (net.Conn, error) {
@@ -96,6 +193,31 @@ Do not use this utility unless you understand mgo/txn internals and
 know what you are doing. Data loss may result from inappropriate or
 incorrect usage. Good luck!
 
+Commands:
+  stats compare BEFORE.json AFTER.json
+     compare the pruner stats of two runs saved with -json
+  analyze
+     report how many txns could be pruned, the lengths of txn-queues and
+     the collections that refer to the most txns, without writing (as JSON
+     with -json). With -sample, estimates them from a sample instead, with
+     how long pruning would take
+  show TXNID...
+     describe the transactions with the given ids in the -txns collection,
+     with the values of the -redact fields hidden
+  soak [-duration 1h] [-docs N] [-batch N] [-interrupt P] [-prefix soak]
+       [-stepdown P] [-killconns P] [-clockskew D]
+     run, interrupt, resume and prune synthetic transactions in the soak
+     collections of -db, checking invariants after each round, to burn in
+     a new server version or storage engine; optionally with primary
+     step-downs, killed connections and skewed txn id clocks
+
+Exit codes:
+  0  pruning is done
+  1  pruning failed
+  3  pruning is incomplete, and should be run again
+  4  another process is already pruning (with -skipifrunning)
+  5  pruning failed with an error that may go away if run again
+
 `, filepath.Base(os.Args[0]))
 		f()
 	}
@@ -0,0 +1,59 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+
+	"github.com/juju/txn/v3"
+)
+
+// showCommand prints a description of each transaction whose id is in
+// args, which follow "show".
+func showCommand(args []string) int {
+	if *dbName == "" || len(args) == 0 {
+		log.Println("usage: -db NAME show TXNID...")
+		return exitFailed
+	}
+	for _, arg := range args {
+		if !bson.IsObjectIdHex(arg) {
+			log.Printf("invalid txn id %q", arg)
+			return exitFailed
+		}
+	}
+	session, err := dial()
+	if err != nil {
+		log.Printf("failed to connect to mongo: %v", err)
+		return exitTransient
+	}
+	defer session.Close()
+	txns := session.DB(*dbName).C(*txnsName)
+	var redactor txn.Redactor
+	if *redactFields != "" {
+		redactor = txn.FieldRedactor{Fields: strings.Split(*redactFields, ",")}
+	}
+	code := exitDone
+	for _, arg := range args {
+		var raw bson.Raw
+		err := txns.FindId(bson.ObjectIdHex(arg)).One(&raw)
+		if err == mgo.ErrNotFound {
+			log.Printf("txn %s not found", arg)
+			code = exitFailed
+			continue
+		} else if err != nil {
+			log.Printf("reading txn %s: %v", arg, err)
+			return exitTransient
+		}
+		// Damaged transactions are shown as well as they can be, with
+		// their problems.
+		doc := txn.RedactTxn(redactor, txn.DecodeTxnLenient(raw))
+		fmt.Println(txn.FormatTxn(doc))
+	}
+	return code
+}
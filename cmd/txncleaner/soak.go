@@ -0,0 +1,363 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	mgotxn "github.com/juju/mgo/v3/txn"
+
+	"github.com/juju/txn/v3"
+)
+
+// maxChaosAttempts is how many times resuming and pruning are attempted
+// while chaos is being injected.
+const maxChaosAttempts = 10
+
+// soakConfig is set by the flags of the soak command.
+type soakConfig struct {
+	duration  time.Duration
+	docs      int
+	batch     int
+	interrupt float64
+	prefix    string
+	chaos     soakChaos
+}
+
+// soakCommand runs the soak command with args, which follow "soak".
+func soakCommand(args []string) int {
+	var config soakConfig
+	flags := flag.NewFlagSet("soak", flag.ContinueOnError)
+	flags.DurationVar(&config.duration, "duration", time.Hour, "how long to run for")
+	flags.IntVar(&config.docs, "docs", 1000, "how many documents the transactions touch")
+	flags.IntVar(&config.batch, "batch", 1000, "how many transactions to run between prunes")
+	flags.Float64Var(&config.interrupt, "interrupt", 0.01, "the chance of interrupting a transaction, to be resumed later")
+	flags.StringVar(&config.prefix, "prefix", "soak", "prefix of the collections used, which are dropped first")
+	flags.Float64Var(&config.chaos.stepDown, "stepdown", 0, "the chance each round of stepping down the primary")
+	flags.Float64Var(&config.chaos.killConns, "killconns", 0, "the chance of killing a connection before each reply")
+	flags.DurationVar(&config.chaos.clockSkew, "clockskew", 0, "the most txn ids are skewed by, either way")
+	if err := flags.Parse(args); err != nil {
+		return exitFailed
+	}
+	chaos := &config.chaos
+	if *dbName == "" || config.docs < 1 || config.batch < 1 ||
+		!isChance(config.interrupt) || !isChance(chaos.stepDown) || !isChance(chaos.killConns) || chaos.clockSkew < 0 {
+		flags.Usage()
+		return exitFailed
+	}
+	// Invariants are checked, and the primary stepped down, without
+	// chaos.
+	session, err := dial()
+	if err != nil {
+		log.Printf("failed to connect to mongo: %v", err)
+		return exitTransient
+	}
+	defer session.Close()
+	chaosSession, err := dialChaos(chaos)
+	if err != nil {
+		log.Printf("failed to connect to mongo: %v", err)
+		return exitTransient
+	}
+	defer chaosSession.Close()
+	if chaos.stepDown > 0 {
+		caps, err := txn.DetectServerCapabilities(session)
+		if err != nil {
+			log.Println(err)
+			return exitTransient
+		}
+		if !caps.ReplicaSet {
+			log.Println("-stepdown needs a replica set")
+			return exitFailed
+		}
+	}
+	soak, err := newSoak(session.DB(*dbName), chaosSession.DB(*dbName), config)
+	if err != nil {
+		log.Println(err)
+		return exitFailed
+	}
+	if err := soak.run(); err != nil {
+		log.Printf("soak failed: %v", err)
+		return exitFailed
+	}
+	return exitDone
+}
+
+func isChance(p float64) bool {
+	return p >= 0 && p < 1
+}
+
+// soak generates, resumes and prunes transactions against a database,
+// checking after each round that nothing was lost or left behind.
+type soak struct {
+	config soakConfig
+
+	// docs and txns are read without chaos, and chaosDB is used to run,
+	// resume and prune transactions.
+	docs    *mgo.Collection
+	txns    *mgo.Collection
+	chaosDB *mgo.Database
+	runner  txn.ResumingRunner
+	lastId  bson.ObjectId
+
+	// counts holds how many transactions have incremented each document;
+	// documents that haven't been inserted yet are missing.
+	counts map[int]int
+
+	// uncertain holds the transactions that failed without saying
+	// whether they were made, and tainted the documents they touched,
+	// which aren't used again until the transactions are accounted for.
+	uncertain map[bson.ObjectId][]int
+	tainted   map[int]bool
+}
+
+func newSoak(db, chaosDB *mgo.Database, config soakConfig) (*soak, error) {
+	s := &soak{
+		config:    config,
+		docs:      db.C(config.prefix),
+		txns:      db.C(config.prefix + ".txns"),
+		chaosDB:   chaosDB,
+		counts:    make(map[int]int),
+		uncertain: make(map[bson.ObjectId][]int),
+		tainted:   make(map[int]bool),
+	}
+	for _, name := range []string{s.docs.Name, s.txns.Name, s.txns.Name + ".stash", s.txns.Name + ".log"} {
+		if err := db.C(name).DropCollection(); err != nil && !isNamespaceNotFound(err) {
+			return nil, errors.Annotatef(err, "dropping %q", name)
+		}
+	}
+	s.runner = txn.NewRunner(txn.RunnerParams{
+		Database:                  chaosDB,
+		TransactionCollectionName: s.txns.Name,
+		ChangeLogName:             s.txns.Name + ".log",
+		IdSource: func() bson.ObjectId {
+			s.lastId = s.config.chaos.newTxnId()
+			return s.lastId
+		},
+	}).(txn.ResumingRunner)
+	return s, nil
+}
+
+func isNamespaceNotFound(err error) bool {
+	qerr, ok := err.(*mgo.QueryError)
+	return ok && (qerr.Code == 26 || qerr.Message == "ns not found")
+}
+
+func (s *soak) run() error {
+	deadline := time.Now().Add(s.config.duration)
+	total := 0
+	for round := 1; time.Now().Before(deadline); round++ {
+		interrupted, err := s.runTxns()
+		if err != nil {
+			return errors.Annotatef(err, "round %d", round)
+		}
+		var resumed txn.ResumeStats
+		err = s.retry("resuming", func() error {
+			var err error
+			resumed, err = s.runner.ResumeTransactionsWithOptions(txn.ResumeOptions{})
+			return err
+		})
+		if err != nil {
+			return errors.Annotatef(err, "round %d", round)
+		}
+		uncertain := len(s.uncertain)
+		if err := s.settleUncertain(); err != nil {
+			return errors.Annotatef(err, "round %d", round)
+		}
+		var stats txn.CleanupStats
+		err = s.retry("pruning", func() error {
+			var err error
+			// Txns with ids in the future, from skewed clocks, are
+			// left for a later round.
+			stats, err = txn.CleanAndPrune(txn.CleanAndPruneArgs{
+				Txns:    s.chaosDB.C(s.txns.Name),
+				MaxTime: time.Now(),
+			})
+			return err
+		})
+		if err != nil {
+			return errors.Annotatef(err, "round %d", round)
+		}
+		if err := s.checkInvariants(); err != nil {
+			return errors.Annotatef(err, "round %d", round)
+		}
+		total += s.config.batch
+		log.Printf("round %d: ran %d txns (%d interrupted, %d uncertain, %d resumed), pruned %d, %d txns in all; invariants hold",
+			round, s.config.batch, interrupted, uncertain, resumed.Resumed, stats.TransactionsRemoved, total)
+		if s.config.chaos.killConns > 0 {
+			log.Printf("round %d: %d connections killed so far", round, atomic.LoadInt64(&s.config.chaos.connsKilled))
+		}
+	}
+	return nil
+}
+
+// retry calls f until it succeeds, up to maxChaosAttempts times if chaos
+// is being injected.
+func (s *soak) retry(what string, f func() error) error {
+	attempts := 1
+	if s.config.chaos.enabled() {
+		attempts = maxChaosAttempts
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = f(); err == nil {
+			return nil
+		}
+		log.Printf("%s failed, attempt %d of %d: %v", what, i+1, attempts, err)
+		s.chaosDB.Session.Refresh()
+	}
+	return errors.Annotate(err, what)
+}
+
+// runTxns runs a batch of transactions, interrupting some of them so that
+// they are left pending, and returns how many were interrupted.
+func (s *soak) runTxns() (int, error) {
+	if s.config.interrupt > 0 {
+		mgotxn.SetChaos(mgotxn.Chaos{KillChance: s.config.interrupt, Breakpoint: "set-applying"})
+		defer mgotxn.SetChaos(mgotxn.Chaos{})
+	}
+	stepDownAt := -1
+	if rand.Float64() < s.config.chaos.stepDown {
+		stepDownAt = rand.Intn(s.config.batch)
+	}
+	interrupted := 0
+	for i := 0; i < s.config.batch; i++ {
+		if i == stepDownAt {
+			stepDownPrimary(s.docs.Database.Session)
+			s.chaosDB.Session.Refresh()
+		}
+		ids := s.pickDocs()
+		if ids == nil {
+			// Every document is tainted.
+			break
+		}
+		ops := make([]mgotxn.Op, len(ids))
+		for j, id := range ids {
+			if _, ok := s.counts[id]; ok {
+				ops[j] = mgotxn.Op{C: s.docs.Name, Id: id, Assert: mgotxn.DocExists, Update: bson.M{"$inc": bson.M{"n": 1}}}
+			} else {
+				ops[j] = mgotxn.Op{C: s.docs.Name, Id: id, Assert: mgotxn.DocMissing, Insert: bson.M{"n": 1}}
+			}
+		}
+		err := s.runner.RunTransaction(&txn.Transaction{Ops: ops})
+		switch errors.Cause(err) {
+		case nil:
+		case mgotxn.ErrChaos:
+			// Transactions interrupted once they are being applied are
+			// completed when resumed.
+			interrupted++
+		default:
+			if !s.config.chaos.enabled() {
+				return interrupted, errors.Annotatef(err, "running txn on %v", ids)
+			}
+			// The txn may or may not have been made; find out once
+			// pending txns have been resumed.
+			s.uncertain[s.lastId] = ids
+			for _, id := range ids {
+				s.tainted[id] = true
+			}
+			s.chaosDB.Session.Refresh()
+			continue
+		}
+		for _, id := range ids {
+			s.counts[id]++
+		}
+	}
+	return interrupted, nil
+}
+
+// pickDocs returns the ids of one to three different documents that
+// aren't tainted, or nil if there aren't any.
+func (s *soak) pickDocs() []int {
+	count := 1 + rand.Intn(3)
+	var ids []int
+	for _, id := range rand.Perm(s.config.docs) {
+		if len(ids) == count {
+			break
+		}
+		if !s.tainted[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// settleUncertain counts the uncertain transactions that were applied,
+// once they have been resumed.
+func (s *soak) settleUncertain() error {
+	for txnId, ids := range s.uncertain {
+		var doc struct {
+			State txn.TxnState `bson:"s"`
+		}
+		err := s.txns.FindId(txnId).One(&doc)
+		switch {
+		case err == mgo.ErrNotFound:
+			// The txn was never made.
+		case err != nil:
+			return errors.Trace(err)
+		case doc.State == txn.TxnApplied:
+			for _, id := range ids {
+				s.counts[id]++
+			}
+		case doc.State != txn.TxnAborted:
+			return errors.Errorf("txn %s on %v is %s after resuming", txnId.Hex(), ids, doc.State)
+		}
+		delete(s.uncertain, txnId)
+		for _, id := range ids {
+			delete(s.tainted, id)
+		}
+	}
+	return nil
+}
+
+// checkInvariants checks that no transactions are pending or were lost,
+// and that the documents are consistent with the transactions (see
+// txn.CheckInvariants).
+func (s *soak) checkInvariants() error {
+	pending, err := s.txns.Find(bson.M{"s": bson.M{"$nin": []txn.TxnState{txn.TxnApplied, txn.TxnAborted}}}).Count()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if pending > 0 {
+		return errors.Errorf("%d txns still pending after resuming", pending)
+	}
+	var doc struct {
+		Id int `bson:"_id"`
+		N  int `bson:"n"`
+	}
+	seen := 0
+	iter := s.docs.Find(nil).Iter()
+	for iter.Next(&doc) {
+		seen++
+		if expected := s.counts[doc.Id]; doc.N != expected {
+			iter.Close()
+			return errors.Errorf("doc %d was updated by %d txns, expected %d", doc.Id, doc.N, expected)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	if seen != len(s.counts) {
+		return errors.Errorf("found %d docs, expected %d", seen, len(s.counts))
+	}
+	report, err := txn.CheckInvariantsWithOptions(s.txns.Database, s.txns.Name, txn.InvariantOptions{
+		Collections: []string{s.docs.Name, s.txns.Name + ".stash"},
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !report.OK() {
+		for _, violation := range report.Violations {
+			log.Println(violation)
+		}
+		return errors.Errorf("%d invariants violated", len(report.Violations))
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package main
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// soakChaos is the chaos injected by the soak command.
+type soakChaos struct {
+	// stepDown is the chance, each round, of stepping down the primary
+	// part way through running transactions.
+	stepDown float64
+
+	// killConns is the chance of closing a connection before reading
+	// each reply, so that the client can't tell whether an operation
+	// was made.
+	killConns float64
+
+	// clockSkew is the most the times of transaction ids are skewed by,
+	// either way, as if they were made by clients whose clocks disagree.
+	clockSkew time.Duration
+
+	// connsKilled counts the connections closed.
+	connsKilled int64
+}
+
+func (c *soakChaos) enabled() bool {
+	return c.stepDown > 0 || c.killConns > 0 || c.clockSkew > 0
+}
+
+var errConnKilled = errors.New("connection killed by soak chaos")
+
+// chaosConn closes its connection at random before reads.
+type chaosConn struct {
+	net.Conn
+	chaos *soakChaos
+}
+
+func (c *chaosConn) Read(b []byte) (int, error) {
+	if rand.Float64() < c.chaos.killConns {
+		atomic.AddInt64(&c.chaos.connsKilled, 1)
+		c.Conn.Close()
+		return 0, errConnKilled
+	}
+	return c.Conn.Read(b)
+}
+
+// dialChaos dials like dial, but with connections that are killed at
+// random if killConns is set.
+func dialChaos(chaos *soakChaos) (*mgo.Session, error) {
+	if chaos.killConns == 0 {
+		return dial()
+	}
+	info, err := mgo.ParseURL(*url)
+	if err != nil {
+		return nil, err
+	}
+	info.Timeout = time.Second * time.Duration(*dialTimeout)
+	info.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+		var conn net.Conn
+		var err error
+		if *insecureTLS {
+			conn, err = dialInsecureTLS(addr)
+		} else {
+			conn, err = net.DialTimeout("tcp", addr.String(), info.Timeout)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &chaosConn{Conn: conn, chaos: chaos}, nil
+	}
+	return mgo.DialWithInfo(info)
+}
+
+// newTxnId returns a unique transaction id, whose time is skewed at
+// random by up to clockSkew.
+func (c *soakChaos) newTxnId() bson.ObjectId {
+	id := bson.NewObjectId()
+	if c.clockSkew <= 0 {
+		return id
+	}
+	skew := time.Duration(rand.Int63n(int64(2*c.clockSkew))) - c.clockSkew
+	skewed := []byte(bson.NewObjectIdWithTime(id.Time().Add(skew)))
+	copy(skewed[4:], []byte(id)[4:])
+	return bson.ObjectId(skewed)
+}
+
+// stepDownPrimary asks the primary to step down, and waits for session to
+// find the new one.
+func stepDownPrimary(session *mgo.Session) {
+	err := session.DB("admin").Run(bson.D{
+		{"replSetStepDown", 10},
+		{"secondaryCatchUpPeriodSecs", 5},
+	}, nil)
+	// Servers before 4.2 close all connections when stepping down, so
+	// the command fails even if it worked.
+	if err != nil {
+		log.Printf("stepping down primary: %v", err)
+	}
+	deadline := time.Now().Add(time.Minute)
+	for {
+		session.Refresh()
+		if err = session.Ping(); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		log.Printf("no primary after stepping down: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/juju/txn/v3"
+)
+
+// runCommand runs the subcommand named by args, returning the exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "soak":
+		return soakCommand(args[1:])
+	case "show":
+		return showCommand(args[1:])
+	case "analyze":
+		return analyzeCommand(args[1:])
+	}
+	if len(args) < 2 || args[0] != "stats" || args[1] != "compare" {
+		log.Printf("unknown command %q", strings.Join(args, " "))
+		return exitFailed
+	}
+	if len(args) != 4 {
+		log.Println("usage: stats compare BEFORE.json AFTER.json")
+		return exitFailed
+	}
+	return statsCompare(args[2], args[3])
+}
+
+// statsCompare prints how the pruner stats changed between two runs whose
+// outcomes were saved with -json.
+func statsCompare(beforePath, afterPath string) int {
+	before, err := readPrunerStats(beforePath)
+	if err != nil {
+		log.Println(err)
+		return exitFailed
+	}
+	after, err := readPrunerStats(afterPath)
+	if err != nil {
+		log.Println(err)
+		return exitFailed
+	}
+	fmt.Println(txn.DiffPrunerStats(before, after))
+	return exitDone
+}
+
+// readPrunerStats reads the pruner stats from the -json output of a run.
+func readPrunerStats(path string) (txn.PrunerStats, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return txn.PrunerStats{}, err
+	}
+	var out result
+	if err := json.Unmarshal(data, &out); err != nil {
+		return txn.PrunerStats{}, fmt.Errorf("reading %s: %v", path, err)
+	}
+	if out.Stats == nil {
+		return txn.PrunerStats{}, fmt.Errorf("reading %s: no stats (outcome %q)", path, out.Outcome)
+	}
+	return out.Stats.Pruner, nil
+}
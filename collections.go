@@ -0,0 +1,236 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// collectionBatchSize is the number of collection names we ask mongo for
+// at a time when listing the collections in a database.
+const collectionBatchSize = 100
+
+// collectionInfo holds the fields of a listCollections result that we
+// care about.
+type collectionInfo struct {
+	Name string `bson:"name"`
+	Type string `bson:"type"`
+}
+
+// isView returns true if the collection is a view, which has no documents
+// of its own to clean.
+func (info collectionInfo) isView() bool {
+	return info.Type == "view"
+}
+
+// TxnCollectionIterator streams the names of the collections in a database
+// that may hold references to transactions. Names are read from mongo in
+// batches, so memory use does not grow with the number of collections.
+// Views are skipped. It is the only way this package lists collections;
+// the pruner doesn't list them at all, but only reads the collections
+// named by the operations of each batch of transactions.
+type TxnCollectionIterator struct {
+	txnsName string
+	session  *mgo.Session
+	lister   collectionLister
+	priority []string
+	seen     map[string]struct{}
+	skipped  []string
+	iter     docIter
+	err      error
+}
+
+// NewTxnCollectionIterator returns an iterator over the collections that
+// share a database with txns and may reference its transactions.
+//
+// density optionally maps collection names to an estimate of how many txn
+// references they hold (for example, from the stats of a previous prune).
+// Collections with an estimate are returned first, densest first, followed
+// by every other collection in the order mongo lists them. The caller must
+// call Close when finished.
+func NewTxnCollectionIterator(txns *mgo.Collection, density map[string]float64) (*TxnCollectionIterator, error) {
+	session := txns.Database.Session.Copy()
+	if session.Mode() == mgo.Eventual {
+		// Cursors must be read from the server that created them.
+		session.SetMode(mgo.Monotonic, false)
+	}
+	it := &TxnCollectionIterator{
+		txnsName: txns.Name,
+		session:  session,
+		lister:   mgoStore{db: txns.Database.With(session)},
+		seen:     make(map[string]struct{}, len(density)),
+	}
+	if len(density) > 0 {
+		if err := it.loadPriority(density); err != nil {
+			session.Close()
+			return nil, errors.Trace(err)
+		}
+	}
+	return it, nil
+}
+
+// loadPriority finds which of the collections with a density estimate
+// actually exist, and orders them densest first.
+func (it *TxnCollectionIterator) loadPriority(density map[string]float64) error {
+	names := make([]string, 0, len(density))
+	for name := range density {
+		if hasTxnReferences(name, it.txnsName) {
+			names = append(names, name)
+		}
+	}
+	iter, err := it.lister.listCollections(bson.M{"name": bson.M{"$in": names}})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var coll collectionInfo
+	for iter.Next(&coll) {
+		it.seen[coll.Name] = struct{}{}
+		if coll.isView() {
+			it.skipped = append(it.skipped, coll.Name)
+			continue
+		}
+		it.priority = append(it.priority, coll.Name)
+	}
+	if err := iter.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	sort.SliceStable(it.priority, func(i, j int) bool {
+		return density[it.priority[i]] > density[it.priority[j]]
+	})
+	return nil
+}
+
+// Next sets name to the next collection to process, and returns false when
+// there are no more collections or an error occurred. Check Err or Close
+// to distinguish the two.
+func (it *TxnCollectionIterator) Next(name *string) bool {
+	if len(it.priority) > 0 {
+		*name = it.priority[0]
+		it.priority = it.priority[1:]
+		return true
+	}
+	if it.err != nil {
+		return false
+	}
+	if it.iter == nil {
+		it.iter, it.err = it.lister.listCollections(nil)
+		if it.err != nil {
+			return false
+		}
+	}
+	var coll collectionInfo
+	for it.iter.Next(&coll) {
+		if _, ok := it.seen[coll.Name]; ok {
+			continue
+		}
+		if !hasTxnReferences(coll.Name, it.txnsName) {
+			continue
+		}
+		if coll.isView() {
+			it.skipped = append(it.skipped, coll.Name)
+			continue
+		}
+		*name = coll.Name
+		return true
+	}
+	return false
+}
+
+// Skipped returns the names of the views that have been skipped so far.
+func (it *TxnCollectionIterator) Skipped() []string {
+	return it.skipped
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *TxnCollectionIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	if it.iter != nil {
+		return it.iter.Err()
+	}
+	return nil
+}
+
+// Close releases the resources held by the iterator, and returns any
+// error encountered while listing collections.
+func (it *TxnCollectionIterator) Close() error {
+	err := it.err
+	if it.iter != nil {
+		if closeErr := it.iter.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	it.session.Close()
+	return errors.Trace(err)
+}
+
+// listCollections runs the listCollections command and returns an iterator
+// over its cursor, so that the names are fetched in batches. If the server
+// doesn't report the cursor's namespace reliably, all of the names are
+// fetched in the first batch.
+func listCollections(db *mgo.Database, filter bson.M) (*mgo.Iter, error) {
+	cursorReliable := capabilitiesFor(db).ListCollectionsCursor
+	cursor := bson.D{}
+	if cursorReliable {
+		cursor = bson.D{{"batchSize", collectionBatchSize}}
+	}
+	cmd := bson.D{
+		{"listCollections", 1},
+		{"cursor", cursor},
+	}
+	if filter != nil {
+		cmd = append(cmd, bson.DocElem{"filter", filter})
+	}
+	var result struct {
+		Cursor struct {
+			FirstBatch []bson.Raw `bson:"firstBatch"`
+			NS         string     `bson:"ns"`
+			Id         int64      `bson:"id"`
+		} `bson:"cursor"`
+	}
+	if err := db.Run(cmd, &result); err != nil {
+		return nil, errors.Annotate(err, "listing collections")
+	}
+	coll := db.C("$cmd.listCollections")
+	if ns := strings.SplitN(result.Cursor.NS, ".", 2); cursorReliable && len(ns) == 2 {
+		coll = db.Session.DB(ns[0]).C(ns[1])
+	}
+	return coll.NewIter(nil, result.Cursor.FirstBatch, result.Cursor.Id, nil), nil
+}
+
+// Error codes returned by mongo when the txn-queue of a document can't be
+// updated because of the kind of collection it is in.
+const (
+	// errCodeCappedSizeChange is returned when an update would change the
+	// size of a document in a capped collection.
+	errCodeCappedSizeChange = 10003
+
+	// errCodeCommandNotSupportedOnView is returned when writing to a view.
+	errCodeCommandNotSupportedOnView = 166
+)
+
+// uncleanableReason returns why err means the documents of a collection
+// can't have tokens pulled from their txn-queues, or "" if it doesn't.
+func uncleanableReason(err error) string {
+	code := 0
+	switch err := errors.Cause(err).(type) {
+	case *mgo.LastError:
+		code = err.Code
+	case *mgo.QueryError:
+		code = err.Code
+	}
+	switch code {
+	case errCodeCappedSizeChange:
+		return "capped collection"
+	case errCodeCommandNotSupportedOnView:
+		return "view"
+	}
+	return ""
+}
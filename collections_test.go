@@ -0,0 +1,75 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"github.com/juju/mgo/v3/bson"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type CollectionIteratorSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&CollectionIteratorSuite{})
+
+func (s *CollectionIteratorSuite) createCollections(c *gc.C, names ...string) {
+	for _, name := range names {
+		c.Assert(s.db.C(name).Insert(bson.M{}), jc.ErrorIsNil)
+	}
+}
+
+func (s *CollectionIteratorSuite) collectNames(c *gc.C, density map[string]float64) []string {
+	iter, err := jujutxn.NewTxnCollectionIterator(s.txns, density)
+	c.Assert(err, jc.ErrorIsNil)
+	var names []string
+	var name string
+	for iter.Next(&name) {
+		names = append(names, name)
+	}
+	c.Assert(iter.Close(), jc.ErrorIsNil)
+	return names
+}
+
+func (s *CollectionIteratorSuite) TestSkipsTxnCollections(c *gc.C) {
+	s.createCollections(c, "a", "b", "txns", "txns.stash", "txns.log", "statuseshistory")
+	names := s.collectNames(c, nil)
+	c.Check(names, jc.SameContents, []string{"a", "b", "txns.stash"})
+}
+
+func (s *CollectionIteratorSuite) TestDensityOrdersFirst(c *gc.C) {
+	s.createCollections(c, "a", "b", "c", "d")
+	names := s.collectNames(c, map[string]float64{
+		"c":       1.0,
+		"b":       5.0,
+		"missing": 10.0,
+		"txns":    20.0,
+	})
+	c.Assert(names, gc.HasLen, 4)
+	c.Check(names[:2], jc.DeepEquals, []string{"b", "c"})
+	c.Check(names[2:], jc.SameContents, []string{"a", "d"})
+}
+
+func (s *CollectionIteratorSuite) TestSkipsViews(c *gc.C) {
+	s.createCollections(c, "a")
+	err := s.db.Run(bson.D{
+		{"create", "v"},
+		{"viewOn", "a"},
+		{"pipeline", []bson.M{}},
+	}, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	iter, err := jujutxn.NewTxnCollectionIterator(s.txns, map[string]float64{"v": 1.0})
+	c.Assert(err, jc.ErrorIsNil)
+	var names []string
+	var name string
+	for iter.Next(&name) {
+		names = append(names, name)
+	}
+	c.Assert(iter.Close(), jc.ErrorIsNil)
+	c.Check(names, jc.DeepEquals, []string{"a"})
+	c.Check(iter.Skipped(), jc.DeepEquals, []string{"v"})
+}
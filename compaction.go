@@ -0,0 +1,158 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+const (
+	// defaultCompactMinTxnsRemoved and defaultCompactMinReclaimable are
+	// the defaults of CompactionPolicy.
+	defaultCompactMinTxnsRemoved = 100000
+	defaultCompactMinReclaimable = 256 << 20
+)
+
+// CompactionPolicy says what CleanAndPrune does about the disk space
+// left behind by the transactions it removes. Removed documents don't
+// return disk space to the operating system: WiredTiger reuses it for new
+// documents, but the files only shrink when the collection is compacted.
+//
+// After a prune that removed at least MinTxnsRemoved transactions, the
+// space that compacting txns and txns.stash would reclaim is estimated
+// and returned in CleanupStats.Compaction, and compacting is recommended
+// in the log for each collection with at least MinReclaimableBytes to
+// reclaim.
+type CompactionPolicy struct {
+	// MinTxnsRemoved is how many transactions a prune must remove before
+	// the space is estimated. Defaults to 100000.
+	MinTxnsRemoved int
+
+	// MinReclaimableBytes is how much space must be reclaimable for
+	// compacting to be recommended. Defaults to 256MiB.
+	MinReclaimableBytes int64
+
+	// Compact, if true, runs the compact command on the collections for
+	// which it is recommended, instead of only recommending it. Before
+	// MongoDB 4.4, compact blocks all operations on the database while it
+	// runs, and it is run on a primary with force; only set this if that
+	// is acceptable.
+	Compact bool
+}
+
+// Validate returns an error if the policy can't be used.
+func (p CompactionPolicy) Validate() error {
+	if p.MinTxnsRemoved < 0 {
+		return errors.NotValidf("negative MinTxnsRemoved %d", p.MinTxnsRemoved)
+	}
+	if p.MinReclaimableBytes < 0 {
+		return errors.NotValidf("negative MinReclaimableBytes %d", p.MinReclaimableBytes)
+	}
+	return nil
+}
+
+// CompactionAdvice estimates the disk space that compacting a collection
+// would return to the operating system.
+type CompactionAdvice struct {
+	Collection string
+
+	// DataSize is the uncompressed size of the documents, and
+	// StorageSize the size of the collection's file.
+	DataSize    int64
+	StorageSize int64
+
+	// ReclaimableBytes is the space in the file that is free for reuse,
+	// as reported by WiredTiger. If the server doesn't report it, it is
+	// estimated as the amount StorageSize exceeds DataSize by, which
+	// underestimates it when documents compress well.
+	ReclaimableBytes int64
+
+	// Recommended is true if ReclaimableBytes is at least
+	// CompactionPolicy.MinReclaimableBytes.
+	Recommended bool
+
+	// Compacted is true if compact was run on the collection, and
+	// CompactError is why it failed, if it did.
+	Compacted    bool
+	CompactError string
+}
+
+// collStorageStats is what adviseCompaction needs from collStats.
+type collStorageStats struct {
+	Size        int64 `bson:"size"`
+	StorageSize int64 `bson:"storageSize"`
+	WiredTiger  struct {
+		BlockManager struct {
+			Reusable int64 `bson:"file bytes available for reuse"`
+		} `bson:"block-manager"`
+	} `bson:"wiredTiger"`
+}
+
+// adviseCompaction estimates the space reclaimable from txns and its
+// stash after a prune that removed transactions, compacting them if the
+// policy says to. Collections whose stats can't be read are left out.
+func adviseCompaction(txns *mgo.Collection, removed int, policy CompactionPolicy) []CompactionAdvice {
+	minRemoved := policy.MinTxnsRemoved
+	if minRemoved == 0 {
+		minRemoved = defaultCompactMinTxnsRemoved
+	}
+	if removed < minRemoved {
+		return nil
+	}
+	minReclaimable := policy.MinReclaimableBytes
+	if minReclaimable == 0 {
+		minReclaimable = defaultCompactMinReclaimable
+	}
+	var advice []CompactionAdvice
+	for _, name := range []string{txns.Name, txns.Name + ".stash"} {
+		var stats collStorageStats
+		if err := txns.Database.Run(bson.D{{"collStats", name}}, &stats); err != nil {
+			pruneLogger.Debugf("unable to read storage stats of %q: %v", name, err)
+			continue
+		}
+		a := compactionAdvice(name, stats, minReclaimable)
+		if a.Recommended && policy.Compact {
+			compact(txns.Database, &a)
+		} else if a.Recommended {
+			pruneLogger.Infof("about %dMiB of %q could be returned to the OS by running compact on it",
+				a.ReclaimableBytes>>20, name)
+		}
+		advice = append(advice, a)
+	}
+	return advice
+}
+
+// compactionAdvice returns the advice for the collection name with stats.
+func compactionAdvice(name string, stats collStorageStats, minReclaimable int64) CompactionAdvice {
+	a := CompactionAdvice{
+		Collection:       name,
+		DataSize:         stats.Size,
+		StorageSize:      stats.StorageSize,
+		ReclaimableBytes: stats.WiredTiger.BlockManager.Reusable,
+	}
+	if a.ReclaimableBytes == 0 && a.StorageSize > a.DataSize {
+		a.ReclaimableBytes = a.StorageSize - a.DataSize
+	}
+	a.Recommended = a.ReclaimableBytes >= minReclaimable
+	return a
+}
+
+// compact runs compact on the collection of a, recording the outcome.
+func compact(db *mgo.Database, a *CompactionAdvice) {
+	pruneLogger.Infof("compacting %q to return about %dMiB to the OS",
+		a.Collection, a.ReclaimableBytes>>20)
+	cmd := bson.D{{"compact", a.Collection}}
+	if caps := capabilitiesFor(db); caps.ReplicaSet && !atLeast(caps.Version, 4, 4) {
+		// Older servers refuse to compact a primary without force.
+		cmd = append(cmd, bson.DocElem{"force", true})
+	}
+	if err := db.Run(cmd, nil); err != nil {
+		pruneLogger.Warningf("unable to compact %q: %v", a.Collection, err)
+		a.CompactError = err.Error()
+		return
+	}
+	a.Compacted = true
+}
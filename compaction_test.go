@@ -0,0 +1,91 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type CompactionSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&CompactionSuite{})
+
+func (s *CompactionSuite) makeTxns(c *gc.C, count int) {
+	for i := 0; i < count; i++ {
+		s.runTxn(c, txn.Op{C: "coll", Id: i, Insert: bson.M{}})
+	}
+}
+
+func (s *CompactionSuite) TestNoAdviceForSmallPrunes(c *gc.C) {
+	s.makeTxns(c, 5)
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:       s.txns,
+		Compaction: &jujutxn.CompactionPolicy{},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 5)
+	c.Check(stats.Compaction, gc.HasLen, 0)
+}
+
+func (s *CompactionSuite) TestCompact(c *gc.C) {
+	s.makeTxns(c, 5)
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns: s.txns,
+		Compaction: &jujutxn.CompactionPolicy{
+			MinTxnsRemoved:      1,
+			MinReclaimableBytes: 1,
+			Compact:             true,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(stats.Compaction, gc.Not(gc.HasLen), 0)
+	advice := stats.Compaction[0]
+	c.Check(advice.Collection, gc.Equals, "txns")
+	c.Check(advice.StorageSize > 0, jc.IsTrue)
+	if advice.Recommended {
+		c.Check(advice.Compacted, jc.IsTrue, gc.Commentf("%s", advice.CompactError))
+	}
+}
+
+type CompactionPolicySuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&CompactionPolicySuite{})
+
+func (*CompactionPolicySuite) TestValidate(c *gc.C) {
+	c.Check(jujutxn.CompactionPolicy{}.Validate(), jc.ErrorIsNil)
+	err := jujutxn.CompactionPolicy{MinReclaimableBytes: -1}.Validate()
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, "negative MinReclaimableBytes -1 not valid")
+}
+
+func (*CompactionPolicySuite) TestAdvice(c *gc.C) {
+	var stats jujutxn.CollStorageStats
+	stats.Size = 100
+	stats.StorageSize = 1000
+	advice := jujutxn.CompactionAdviceFor("txns", stats, 500)
+	c.Check(advice, gc.Equals, jujutxn.CompactionAdvice{
+		Collection:       "txns",
+		DataSize:         100,
+		StorageSize:      1000,
+		ReclaimableBytes: 900,
+		Recommended:      true,
+	})
+
+	// WiredTiger's count of free space is used if there is one.
+	stats.WiredTiger.BlockManager.Reusable = 300
+	advice = jujutxn.CompactionAdviceFor("txns", stats, 500)
+	c.Check(advice.ReclaimableBytes, gc.Equals, int64(300))
+	c.Check(advice.Recommended, jc.IsFalse)
+}
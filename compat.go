@@ -0,0 +1,259 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// ServerFlavour identifies the server implementation we are talking to.
+type ServerFlavour string
+
+const (
+	// FlavourMongoDB is MongoDB itself.
+	FlavourMongoDB ServerFlavour = "mongodb"
+
+	// FlavourFerretDB is FerretDB, which implements the MongoDB wire
+	// protocol on top of a SQL database.
+	FlavourFerretDB ServerFlavour = "ferretdb"
+
+	// FlavourDocumentDB is Amazon DocumentDB.
+	FlavourDocumentDB ServerFlavour = "documentdb"
+)
+
+// ServerCapabilities records which server features can be relied on, so
+// that the runner and pruner can pick strategies that work. MongoDB
+// versions from 3.6 to 7.0 are supported, as well as MongoDB-compatible
+// services; the latter differ from MongoDB in ways that don't cause
+// errors, but can make pruning silently do nothing, so features are
+// avoided when they aren't known to work.
+type ServerCapabilities struct {
+	// Flavour is the server implementation.
+	Flavour ServerFlavour
+
+	// Version is the server version reported by buildInfo.
+	Version []int
+
+	// ReplicaSet is true if the server is a member of a replica set, and
+	// Sharded is true if it is a mongos.
+	ReplicaSet bool
+	Sharded    bool
+
+	// BulkWrite is true if the server supports the bulk write commands.
+	BulkWrite bool
+
+	// UnorderedBulk is true if unordered bulk writes report accurate
+	// results. When it is false, bulk writes are made in order.
+	UnorderedBulk bool
+
+	// Aggregation is true if the server supports aggregation pipelines
+	// that return cursors.
+	Aggregation bool
+
+	// AggregateOut is true if aggregation pipelines support $out.
+	AggregateOut bool
+
+	// ListCollectionsCursor is true if the cursor returned by
+	// listCollections reports the namespace it should be continued on.
+	// When it is false, collections are listed in a single batch.
+	ListCollectionsCursor bool
+
+	// ChangeStreams is true if the server supports change streams.
+	ChangeStreams bool
+
+	// Transactions is true if the server supports multi-document
+	// (server-side) transactions in its current topology.
+	Transactions bool
+
+	// TimeSeries is true if the server supports time-series collections
+	// whose documents expire.
+	TimeSeries bool
+}
+
+// atLeast returns true if version is at least major.minor.
+func atLeast(version []int, major, minor int) bool {
+	if len(version) < 2 {
+		return false
+	}
+	return version[0] > major || (version[0] == major && version[1] >= minor)
+}
+
+// serverInfo is what we learn about a server when probing it.
+type serverInfo struct {
+	flavour    ServerFlavour
+	version    []int
+	replicaSet bool
+	sharded    bool
+}
+
+// DetectServerCapabilities asks the server behind session what it is, and
+// returns the capabilities it can be relied on to have.
+func DetectServerCapabilities(session *mgo.Session) (ServerCapabilities, error) {
+	admin := session.DB("admin")
+	var buildInfo struct {
+		VersionArray    []int  `bson:"versionArray"`
+		FerretDBVersion string `bson:"ferretdbVersion"`
+		FerretDB        bson.M `bson:"ferretdb"`
+	}
+	if err := admin.Run(bson.M{"buildInfo": 1}, &buildInfo); err != nil {
+		return ServerCapabilities{}, errors.Annotate(err, "reading build info")
+	}
+	var isMaster struct {
+		Me      string   `bson:"me"`
+		Hosts   []string `bson:"hosts"`
+		SetName string   `bson:"setName"`
+		Msg     string   `bson:"msg"`
+	}
+	if err := admin.Run(bson.M{"isMaster": 1}, &isMaster); err != nil {
+		return ServerCapabilities{}, errors.Annotate(err, "reading server status")
+	}
+	info := serverInfo{
+		flavour:    FlavourMongoDB,
+		version:    buildInfo.VersionArray,
+		replicaSet: isMaster.SetName != "",
+		sharded:    isMaster.Msg == "isdbgrid",
+	}
+	switch {
+	case buildInfo.FerretDBVersion != "" || buildInfo.FerretDB != nil:
+		info.flavour = FlavourFerretDB
+	case isDocumentDBHost(isMaster.Me) || anyDocumentDBHost(isMaster.Hosts):
+		info.flavour = FlavourDocumentDB
+	}
+	return capabilitiesOf(info), nil
+}
+
+// capabilitiesOf returns the capabilities of the server described by info.
+func capabilitiesOf(info serverInfo) ServerCapabilities {
+	caps := ServerCapabilities{
+		Flavour:    info.flavour,
+		Version:    info.version,
+		ReplicaSet: info.replicaSet,
+		Sharded:    info.sharded,
+	}
+	clustered := info.replicaSet || info.sharded
+	switch info.flavour {
+	case FlavourMongoDB:
+		// Bulk writes and $out were introduced in Mongo 2.6
+		// https://docs.mongodb.com/manual/reference/operator/aggregation/out/
+		caps.BulkWrite = atLeast(info.version, 2, 6)
+		caps.UnorderedBulk = caps.BulkWrite
+		caps.Aggregation = atLeast(info.version, 2, 6)
+		caps.AggregateOut = caps.Aggregation
+		caps.ListCollectionsCursor = true
+		caps.ChangeStreams = clustered && atLeast(info.version, 3, 6)
+		caps.Transactions = (info.replicaSet && atLeast(info.version, 4, 0)) ||
+			(info.sharded && atLeast(info.version, 4, 2))
+		caps.TimeSeries = atLeast(info.version, 5, 0)
+	case FlavourDocumentDB:
+		caps.BulkWrite = true
+		caps.Aggregation = true
+		caps.AggregateOut = true
+		caps.ChangeStreams = clustered
+		caps.Transactions = clustered && atLeast(info.version, 4, 0)
+	case FlavourFerretDB:
+		caps.BulkWrite = true
+		caps.Aggregation = true
+	}
+	return caps
+}
+
+func isDocumentDBHost(host string) bool {
+	host, _, _ = strings.Cut(host, ":")
+	return strings.HasSuffix(host, ".docdb.amazonaws.com")
+}
+
+func anyDocumentDBHost(hosts []string) bool {
+	for _, host := range hosts {
+		if isDocumentDBHost(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// capabilitiesProbeRetry is how long the MongoDB fallback is used for
+// after a probe fails, before probing again.
+const capabilitiesProbeRetry = time.Minute
+
+// capabilitiesCache holds the cachedCapabilities of the servers we have
+// probed, keyed on their addresses, so each server is only probed once.
+var capabilitiesCache sync.Map
+
+// cachedCapabilities is an entry in capabilitiesCache.
+type cachedCapabilities struct {
+	caps ServerCapabilities
+
+	// retryAt is set if the probe failed, to when it should be tried
+	// again.
+	retryAt time.Time
+}
+
+// capabilitiesKey returns the key of the servers behind db in
+// capabilitiesCache.
+func capabilitiesKey(db *mgo.Database) string {
+	servers := db.Session.LiveServers()
+	sort.Strings(servers)
+	return strings.Join(servers, ",")
+}
+
+// setCapabilities records the capabilities of the servers behind db,
+// overriding what a probe would find.
+func setCapabilities(db *mgo.Database, caps ServerCapabilities) {
+	if key := capabilitiesKey(db); key != "" {
+		capabilitiesCache.Store(key, cachedCapabilities{caps: caps})
+	}
+}
+
+// capabilitiesFor returns the capabilities of the servers behind db,
+// probing them the first time they are seen. If the probe fails we assume
+// MongoDB, which is how we behaved before probing, and don't probe again
+// for capabilitiesProbeRetry.
+func capabilitiesFor(db *mgo.Database) ServerCapabilities {
+	return cachedCapabilitiesFor(capabilitiesKey(db), time.Now(), func() (ServerCapabilities, error) {
+		return DetectServerCapabilities(db.Session)
+	})
+}
+
+// cachedCapabilitiesFor implements capabilitiesFor for the servers with
+// the given key, using probe to find their capabilities.
+func cachedCapabilitiesFor(key string, now time.Time, probe func() (ServerCapabilities, error)) ServerCapabilities {
+	if cached, ok := capabilitiesCache.Load(key); ok {
+		entry := cached.(cachedCapabilities)
+		if entry.retryAt.IsZero() || now.Before(entry.retryAt) {
+			return entry.caps
+		}
+	}
+	caps, err := probe()
+	entry := cachedCapabilities{caps: caps}
+	if err != nil {
+		pruneLogger.Warningf("unable to probe server capabilities, assuming MongoDB: %v", err)
+		entry = cachedCapabilities{
+			caps:    capabilitiesOf(serverInfo{flavour: FlavourMongoDB}),
+			retryAt: now.Add(capabilitiesProbeRetry),
+		}
+	} else if caps.Flavour != FlavourMongoDB {
+		pruneLogger.Infof("using %s compatibility mode", caps.Flavour)
+	}
+	if key != "" {
+		capabilitiesCache.Store(key, entry)
+	}
+	return entry.caps
+}
+
+// newBulk returns a bulk writer for coll, which is unordered if the server
+// reports accurate results for unordered writes.
+func newBulk(coll *mgo.Collection) *mgo.Bulk {
+	bulk := coll.Bulk()
+	if capabilitiesFor(coll.Database).UnorderedBulk {
+		bulk.Unordered()
+	}
+	return bulk
+}
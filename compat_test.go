@@ -0,0 +1,133 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type CapabilitiesSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&CapabilitiesSuite{})
+
+func (*CapabilitiesSuite) TestMongoDB(c *gc.C) {
+	caps := capabilitiesOf(serverInfo{flavour: FlavourMongoDB, version: []int{4, 4, 0}, replicaSet: true})
+	c.Check(caps, jc.DeepEquals, ServerCapabilities{
+		Flavour:               FlavourMongoDB,
+		Version:               []int{4, 4, 0},
+		ReplicaSet:            true,
+		BulkWrite:             true,
+		UnorderedBulk:         true,
+		Aggregation:           true,
+		AggregateOut:          true,
+		ListCollectionsCursor: true,
+		ChangeStreams:         true,
+		Transactions:          true,
+	})
+	c.Check(capabilitiesOf(serverInfo{flavour: FlavourMongoDB, version: []int{2, 4}}).AggregateOut, jc.IsFalse)
+	c.Check(capabilitiesOf(serverInfo{flavour: FlavourMongoDB}).AggregateOut, jc.IsFalse)
+	c.Check(capabilitiesOf(serverInfo{flavour: FlavourMongoDB, version: []int{5, 0, 3}}).TimeSeries, jc.IsTrue)
+}
+
+func (*CapabilitiesSuite) TestMongoDBTopology(c *gc.C) {
+	for i, test := range []struct {
+		info          serverInfo
+		changeStreams bool
+		transactions  bool
+	}{
+		{serverInfo{version: []int{3, 6, 23}}, false, false},
+		{serverInfo{version: []int{3, 6, 23}, replicaSet: true}, true, false},
+		{serverInfo{version: []int{4, 0, 0}}, false, false},
+		{serverInfo{version: []int{4, 0, 0}, replicaSet: true}, true, true},
+		{serverInfo{version: []int{4, 0, 0}, sharded: true}, true, false},
+		{serverInfo{version: []int{4, 2, 0}, sharded: true}, true, true},
+		{serverInfo{version: []int{7, 0, 2}, replicaSet: true}, true, true},
+	} {
+		c.Logf("test %d: %+v", i, test.info)
+		test.info.flavour = FlavourMongoDB
+		caps := capabilitiesOf(test.info)
+		c.Check(caps.ChangeStreams, gc.Equals, test.changeStreams)
+		c.Check(caps.Transactions, gc.Equals, test.transactions)
+	}
+}
+
+func (*CapabilitiesSuite) TestCompatibleServices(c *gc.C) {
+	caps := capabilitiesOf(serverInfo{flavour: FlavourFerretDB, version: []int{7, 0, 42}})
+	c.Check(caps.BulkWrite, jc.IsTrue)
+	c.Check(caps.UnorderedBulk, jc.IsFalse)
+	c.Check(caps.ListCollectionsCursor, jc.IsFalse)
+	c.Check(caps.AggregateOut, jc.IsFalse)
+	c.Check(caps.Transactions, jc.IsFalse)
+
+	caps = capabilitiesOf(serverInfo{flavour: FlavourDocumentDB, version: []int{5, 0, 0}, replicaSet: true})
+	c.Check(caps.UnorderedBulk, jc.IsFalse)
+	c.Check(caps.ListCollectionsCursor, jc.IsFalse)
+	c.Check(caps.AggregateOut, jc.IsTrue)
+	c.Check(caps.Transactions, jc.IsTrue)
+}
+
+func (*CapabilitiesSuite) TestDocumentDBHosts(c *gc.C) {
+	c.Check(isDocumentDBHost("db.cluster-abc.us-east-1.docdb.amazonaws.com:27017"), jc.IsTrue)
+	c.Check(isDocumentDBHost("localhost:27017"), jc.IsFalse)
+	c.Check(anyDocumentDBHost([]string{"a:1", "b.docdb.amazonaws.com"}), jc.IsTrue)
+	c.Check(anyDocumentDBHost(nil), jc.IsFalse)
+}
+
+func (*CapabilitiesSuite) TestFailedProbeCached(c *gc.C) {
+	const key = "failed-probe:27017"
+	defer capabilitiesCache.Delete(key)
+	probes := 0
+	probe := func() (ServerCapabilities, error) {
+		probes++
+		if probes == 1 {
+			return ServerCapabilities{}, errors.New("isMaster not allowed")
+		}
+		return capabilitiesOf(serverInfo{flavour: FlavourFerretDB}), nil
+	}
+	fallback := capabilitiesOf(serverInfo{flavour: FlavourMongoDB})
+	now := time.Now()
+	c.Check(cachedCapabilitiesFor(key, now, probe), jc.DeepEquals, fallback)
+	c.Check(cachedCapabilitiesFor(key, now.Add(time.Second), probe), jc.DeepEquals, fallback)
+	c.Check(probes, gc.Equals, 1)
+
+	// Once the fallback has expired, the servers are probed again, and
+	// a successful probe is kept.
+	later := now.Add(capabilitiesProbeRetry + time.Second)
+	c.Check(cachedCapabilitiesFor(key, later, probe).Flavour, gc.Equals, FlavourFerretDB)
+	c.Check(cachedCapabilitiesFor(key, later.Add(time.Hour), probe).Flavour, gc.Equals, FlavourFerretDB)
+	c.Check(probes, gc.Equals, 2)
+}
+
+type ProbeCapabilitiesSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&ProbeCapabilitiesSuite{})
+
+func (s *ProbeCapabilitiesSuite) TestProbeMongoDB(c *gc.C) {
+	caps, err := DetectServerCapabilities(s.Session)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(caps.Flavour, gc.Equals, FlavourMongoDB)
+	c.Check(caps.UnorderedBulk, jc.IsTrue)
+	c.Check(capabilitiesFor(s.db), jc.DeepEquals, caps)
+}
+
+func (s *ProbeCapabilitiesSuite) TestRunnerCapabilitiesOverride(c *gc.C) {
+	defer capabilitiesCache.Delete(capabilitiesKey(s.db))
+	caps := capabilitiesOf(serverInfo{flavour: FlavourFerretDB, version: []int{7, 0, 0}})
+	runner := NewRunner(RunnerParams{
+		Database:               s.db,
+		ServerSideTransactions: true,
+		Capabilities:           &caps,
+	})
+	c.Check(runner.(*transactionRunner).serverSideTransactions, jc.IsFalse)
+	c.Check(capabilitiesFor(s.db), jc.DeepEquals, caps)
+}
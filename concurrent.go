@@ -0,0 +1,160 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// ConcurrentPruneMode selects what CleanAndPrune does when another process
+// is already pruning the same transactions.
+type ConcurrentPruneMode string
+
+const (
+	// ConcurrentPruneIgnore prunes anyway, duplicating some of the other
+	// pruner's work. This is the default.
+	ConcurrentPruneIgnore ConcurrentPruneMode = "ignore"
+
+	// ConcurrentPruneWait waits for the other pruner to finish before
+	// starting.
+	ConcurrentPruneWait ConcurrentPruneMode = "wait"
+
+	// ConcurrentPruneSkip returns without pruning.
+	ConcurrentPruneSkip ConcurrentPruneMode = "skip"
+
+	// ConcurrentPruneJoin prunes alongside the other pruner as an extra
+	// worker. The other pruner starts with the oldest transactions, so we
+	// start with the newest and work back towards it.
+	ConcurrentPruneJoin ConcurrentPruneMode = "join"
+)
+
+// activePruneId is the _id of the document in txns.prune that records which
+// process is pruning. The owner refreshes its heartbeat while it prunes,
+// and the document is treated as stale once the heartbeat is older than
+// pruneLockTimeout, so a crashed pruner doesn't block others for long.
+const activePruneId = "active"
+
+var (
+	// pruneLockTimeout is how old a heartbeat can be before the pruner
+	// that wrote it is assumed to have gone away.
+	pruneLockTimeout = time.Minute
+
+	// pruneHeartbeatInterval is how often the active pruner refreshes
+	// its heartbeat.
+	pruneHeartbeatInterval = 15 * time.Second
+
+	// pruneLockPollInterval is how often ConcurrentPruneWait checks
+	// whether the other pruner has finished.
+	pruneLockPollInterval = 5 * time.Second
+)
+
+type activePruneDoc struct {
+	Id        string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	Heartbeat time.Time `bson:"heartbeat"`
+}
+
+// pruneLock is held by a process while it prunes.
+type pruneLock struct {
+	coll  *mgo.Collection
+	owner string
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// acquirePruneLock tries to take the active pruner document, returning nil
+// if another process holds it. The caller must release the lock.
+func acquirePruneLock(txnsPrune *mgo.Collection) (*pruneLock, error) {
+	owner := bson.NewObjectId().Hex()
+	now := time.Now()
+	_, err := txnsPrune.Upsert(
+		bson.M{
+			"_id":       activePruneId,
+			"heartbeat": bson.M{"$lt": now.Add(-pruneLockTimeout)},
+		},
+		bson.M{"$set": bson.M{"owner": owner, "heartbeat": now}},
+	)
+	if mgo.IsDup(err) {
+		// The document exists with a live heartbeat.
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Annotate(err, "acquiring prune lock")
+	}
+	lock := &pruneLock{
+		coll:  txnsPrune,
+		owner: owner,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go lock.heartbeat()
+	return lock, nil
+}
+
+func (lock *pruneLock) heartbeat() {
+	defer close(lock.done)
+	ticker := time.NewTicker(pruneHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lock.stop:
+			return
+		case <-ticker.C:
+			err := lock.coll.Update(
+				bson.M{"_id": activePruneId, "owner": lock.owner},
+				bson.M{"$set": bson.M{"heartbeat": time.Now()}},
+			)
+			if err == mgo.ErrNotFound {
+				pruneLogger.Warningf("lost prune lock to another pruner")
+				return
+			} else if err != nil {
+				pruneLogger.Warningf("unable to update prune heartbeat: %v", err)
+			}
+		}
+	}
+}
+
+// release stops the heartbeat and removes the lock, if we still hold it.
+func (lock *pruneLock) release() {
+	close(lock.stop)
+	<-lock.done
+	err := lock.coll.Remove(bson.M{"_id": activePruneId, "owner": lock.owner})
+	if err != nil && err != mgo.ErrNotFound {
+		pruneLogger.Warningf("unable to release prune lock: %v", err)
+	}
+}
+
+// claimPrune decides how CleanAndPrune should proceed, given the other
+// pruners that are running. It returns the lock to release once pruning is
+// done, which may be nil, and the mode that was used if another pruner was
+// found. A mode of ConcurrentPruneSkip means we should not prune at all.
+func claimPrune(args CleanAndPruneArgs) (*pruneLock, ConcurrentPruneMode, error) {
+	txnsPrune := args.Txns.Database.C(txnsPruneC(args.Txns.Name))
+	lock, err := acquirePruneLock(txnsPrune)
+	if err != nil || lock != nil {
+		return lock, "", errors.Trace(err)
+	}
+	mode := args.ConcurrentPrune
+	if mode == "" {
+		mode = ConcurrentPruneIgnore
+	}
+	pruneLogger.Infof("another process is pruning %q, mode %q", args.Txns.Name, mode)
+	if mode != ConcurrentPruneWait {
+		return nil, mode, nil
+	}
+	for lock == nil {
+		if err := args.job.checkpoint(); err != nil {
+			return nil, mode, errors.Trace(err)
+		}
+		time.Sleep(pruneLockPollInterval)
+		if lock, err = acquirePruneLock(txnsPrune); err != nil {
+			return nil, mode, errors.Trace(err)
+		}
+	}
+	pruneLogger.Debugf("other pruner finished, starting to prune")
+	return lock, mode, nil
+}
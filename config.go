@@ -0,0 +1,493 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds the settings read by LoadConfig. The database, collections
+// and callbacks can't be configured in a file, so they are left for the
+// caller to fill in before use.
+type Config struct {
+	PruneOptions  PruneOptions
+	CleanAndPrune CleanAndPruneArgs
+	Runner        RunnerParams
+}
+
+// configSchema is the format of the file read by LoadConfig.
+type configSchema struct {
+	Prune         pruneSchema         `yaml:"prune"`
+	CleanAndPrune cleanAndPruneSchema `yaml:"clean-and-prune"`
+	Runner        runnerSchema        `yaml:"runner"`
+	Features      *featuresSchema     `yaml:"features"`
+}
+
+type pruneSchema struct {
+	PruneFactor                float32       `yaml:"prune-factor"`
+	MinNewTransactions         int           `yaml:"min-new-transactions"`
+	MaxNewTransactions         int           `yaml:"max-new-transactions"`
+	MaxTxnAge                  time.Duration `yaml:"max-txn-age"`
+	MaxBatchTransactions       int           `yaml:"max-batch-transactions"`
+	MaxBatches                 int           `yaml:"max-batches"`
+	SmallBatchTransactionCount int           `yaml:"small-batch-transaction-count"`
+	BatchTransactionSleepTime  time.Duration `yaml:"batch-transaction-sleep-time"`
+	MaxPruneHistory            int           `yaml:"max-prune-history"`
+	MaxPruneHistoryAge         time.Duration `yaml:"max-prune-history-age"`
+	MinFreeDiskBytes           int64         `yaml:"min-free-disk-bytes"`
+	DiskCheckWarnOnly          bool          `yaml:"disk-check-warn-only"`
+}
+
+type cleanAndPruneSchema struct {
+	MaxTxnAge                time.Duration `yaml:"max-txn-age"`
+	MaxTransactionsToProcess int           `yaml:"max-transactions-to-process"`
+	Multithreaded            bool          `yaml:"multithreaded"`
+	CollectionConcurrency    int           `yaml:"collection-concurrency"`
+	MaxOplogWindowFraction   float64       `yaml:"max-oplog-window-fraction"`
+	TxnBatchSize             int           `yaml:"txn-batch-size"`
+	TxnBatchSleepTime        time.Duration `yaml:"txn-batch-sleep-time"`
+	MaxPasses                int           `yaml:"max-passes"`
+	ErrorBudget              int           `yaml:"error-budget"`
+	MaxRuntime               time.Duration `yaml:"max-runtime"`
+	MaxScanLag               time.Duration `yaml:"max-scan-lag"`
+	ReadWholeDocuments       bool          `yaml:"read-whole-documents"`
+	StripInvalidTokens       bool          `yaml:"strip-invalid-tokens"`
+	CheckMissingTxns         bool          `yaml:"check-missing-txns"`
+	SessionMode              string        `yaml:"session-mode"`
+	SyncTimeout              time.Duration `yaml:"sync-timeout"`
+	SocketTimeout            time.Duration `yaml:"socket-timeout"`
+	StashOrder               string        `yaml:"stash-order"`
+	BulkStashCleanup         bool          `yaml:"bulk-stash-cleanup"`
+	ConcurrentPrune          string        `yaml:"concurrent-prune"`
+	ProgressInterval         time.Duration `yaml:"progress-interval"`
+}
+
+type featuresSchema struct {
+	EnableParallelPrune      bool `yaml:"enable-parallel-prune"`
+	EnableProjectionScan     bool `yaml:"enable-projection-scan"`
+	EnableServerTxns         bool `yaml:"enable-server-txns"`
+	EnableBulkStashCleanup   bool `yaml:"enable-bulk-stash-cleanup"`
+	EnableStripInvalidTokens bool `yaml:"enable-strip-invalid-tokens"`
+	EnableMultiPassPrune     bool `yaml:"enable-multi-pass-prune"`
+	EnableSessionRefresh     bool `yaml:"enable-session-refresh"`
+}
+
+type runnerSchema struct {
+	TransactionCollectionName string        `yaml:"transaction-collection-name"`
+	ChangeLogName             string        `yaml:"change-log-name"`
+	ServerSideTransactions    bool          `yaml:"server-side-transactions"`
+	MaxRetryAttempts          int           `yaml:"max-retry-attempts"`
+	RetryBackoff              time.Duration `yaml:"retry-backoff"`
+	RetryFuzzPercent          int           `yaml:"retry-fuzz-percent"`
+	MaxOpsPerTxn              int           `yaml:"max-ops-per-txn"`
+	MaxTxnDocBytes            int           `yaml:"max-txn-doc-bytes"`
+	TxnLimitPolicy            string        `yaml:"txn-limit-policy"`
+	MaxTxnQueueLength         int           `yaml:"max-txn-queue-length"`
+	MaxTxnQueueAge            time.Duration `yaml:"max-txn-queue-age"`
+	OperationTimeout          time.Duration `yaml:"operation-timeout"`
+	SortOps                   bool          `yaml:"sort-ops"`
+}
+
+// LoadConfig reads PruneOptions, CleanAndPruneArgs and RunnerParams from
+// the YAML or JSON file at path, so that they can be tuned without
+// recompiling. Every setting is optional, and unknown settings are an
+// error. Settings that are left out get the same defaults as they would
+// in code. Durations are written like "10ms" or "1h", and max-txn-age
+// sets MaxTime to that long before the file is loaded. For example:
+//
+//	prune:
+//	  prune-factor: 2.0
+//	  min-new-transactions: 100
+//	  max-new-transactions: 100000
+//	  max-txn-age: 1h
+//	  max-batch-transactions: 1000000
+//	  max-batches: 1
+//	  small-batch-transaction-count: 1000
+//	  batch-transaction-sleep-time: 10ms
+//	  max-prune-history: 100
+//	  max-prune-history-age: 720h
+//	  min-free-disk-bytes: 0
+//	  disk-check-warn-only: false
+//	clean-and-prune:
+//	  max-txn-age: 1h
+//	  max-transactions-to-process: 0
+//	  multithreaded: false
+//	  collection-concurrency: 0
+//	  max-oplog-window-fraction: 0 # per hour, 0 to not pace
+//	  txn-batch-size: 1000
+//	  txn-batch-sleep-time: 10ms
+//	  max-passes: 1
+//	  error-budget: 0
+//	  max-runtime: 30m
+//	  max-scan-lag: 10s
+//	  read-whole-documents: false
+//	  strip-invalid-tokens: false
+//	  check-missing-txns: false
+//	  session-mode: monotonic      # or strong
+//	  sync-timeout: 7s
+//	  socket-timeout: 1m
+//	  stash-order: interleaved     # or first, last
+//	  bulk-stash-cleanup: false
+//	  concurrent-prune: ignore     # or wait, skip, join
+//	  progress-interval: 30s
+//	runner:
+//	  transaction-collection-name: txns
+//	  change-log-name: txns.log
+//	  server-side-transactions: false
+//	  max-retry-attempts: 3
+//	  retry-backoff: 10ms
+//	  retry-fuzz-percent: 20
+//	  max-ops-per-txn: 0
+//	  max-txn-doc-bytes: 0
+//	  txn-limit-policy: reject     # or split, warn
+//	  max-txn-queue-length: 0
+//	  max-txn-queue-age: 0s
+//	  operation-timeout: 0s
+//	  sort-ops: false
+//	features:
+//	  enable-parallel-prune: false
+//	  enable-projection-scan: false
+//	  enable-server-txns: false
+//	  enable-bulk-stash-cleanup: false
+//	  enable-strip-invalid-tokens: false
+//	  enable-multi-pass-prune: false
+//	  enable-session-refresh: false
+//
+// If the features section is present, it sets the Features of both
+// CleanAndPrune and Runner, and only the behaviours it enables are used.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotate(err, "reading txn config")
+	}
+	config, err := parseConfig(data, time.Now())
+	if err != nil {
+		return nil, errors.Annotatef(err, "txn config %q", path)
+	}
+	return config, nil
+}
+
+// parseConfig parses data in the format described by LoadConfig, with
+// ages relative to now.
+func parseConfig(data []byte, now time.Time) (*Config, error) {
+	var schema configSchema
+	// YAML is a superset of JSON, so this reads both.
+	if err := yaml.UnmarshalStrict(data, &schema); err != nil {
+		return nil, errors.Trace(err)
+	}
+	prune, err := schema.Prune.options(now)
+	if err != nil {
+		return nil, errors.Annotate(err, "prune")
+	}
+	cleanAndPrune, err := schema.CleanAndPrune.args(now)
+	if err != nil {
+		return nil, errors.Annotate(err, "clean-and-prune")
+	}
+	runner, err := schema.Runner.params()
+	if err != nil {
+		return nil, errors.Annotate(err, "runner")
+	}
+	config := &Config{
+		PruneOptions:  prune,
+		CleanAndPrune: cleanAndPrune,
+		Runner:        runner,
+	}
+	if f := schema.Features; f != nil {
+		features := &Features{
+			EnableParallelPrune:      f.EnableParallelPrune,
+			EnableProjectionScan:     f.EnableProjectionScan,
+			EnableServerTxns:         f.EnableServerTxns,
+			EnableBulkStashCleanup:   f.EnableBulkStashCleanup,
+			EnableStripInvalidTokens: f.EnableStripInvalidTokens,
+			EnableMultiPassPrune:     f.EnableMultiPassPrune,
+			EnableSessionRefresh:     f.EnableSessionRefresh,
+		}
+		config.CleanAndPrune.Features = features
+		config.Runner.Features = features
+	}
+	if err := config.validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return config, nil
+}
+
+// validate checks the settings, and fills in defaults.
+func (config *Config) validate() error {
+	if err := validatePruneSettings(&config.PruneOptions); err != nil {
+		return errors.Annotate(err, "prune")
+	}
+	if err := validateCleanAndPruneSettings(&config.CleanAndPrune); err != nil {
+		return errors.Annotate(err, "clean-and-prune")
+	}
+	if err := validateRunnerSettings(&config.Runner); err != nil {
+		return errors.Annotate(err, "runner")
+	}
+	return nil
+}
+
+func validatePruneSettings(opts *PruneOptions) error {
+	switch {
+	case opts.PruneFactor < 0:
+		return errors.Errorf("PruneFactor (%v) must not be negative", opts.PruneFactor)
+	case opts.MinNewTransactions < 0:
+		return errors.Errorf("MinNewTransactions (%d) must not be negative", opts.MinNewTransactions)
+	case opts.MaxNewTransactions < 0:
+		return errors.Errorf("MaxNewTransactions (%d) must not be negative", opts.MaxNewTransactions)
+	case opts.MaxBatchTransactions < 0:
+		return errors.Errorf("MaxBatchTransactions (%d) must not be negative", opts.MaxBatchTransactions)
+	case opts.MaxPruneHistory < 0:
+		return errors.Errorf("MaxPruneHistory (%d) must not be negative", opts.MaxPruneHistory)
+	case opts.MaxPruneHistoryAge < 0:
+		return errors.Errorf("MaxPruneHistoryAge (%s) must not be negative", opts.MaxPruneHistoryAge)
+	case opts.MinFreeDiskBytes < 0:
+		return errors.Errorf("MinFreeDiskBytes (%d) must not be negative", opts.MinFreeDiskBytes)
+	}
+	validatePruneOptions(opts)
+	return nil
+}
+
+func validateCleanAndPruneSettings(args *CleanAndPruneArgs) error {
+	if args.MaxTransactionsToProcess < 0 {
+		return errors.Errorf("MaxTransactionsToProcess (%d) must not be negative",
+			args.MaxTransactionsToProcess)
+	}
+	return errors.Trace(args.validateSettings())
+}
+
+func validateRunnerSettings(params *RunnerParams) error {
+	switch {
+	case params.MaxRetryAttempts < 0:
+		return errors.Errorf("MaxRetryAttempts (%d) must not be negative", params.MaxRetryAttempts)
+	case params.RetryBackoff < 0:
+		return errors.Errorf("RetryBackoff (%s) must not be negative", params.RetryBackoff)
+	case params.RetryFuzzPercent < 0 || params.RetryFuzzPercent > 100:
+		return errors.Errorf("RetryFuzzPercent (%d) must be between 0 and 100", params.RetryFuzzPercent)
+	case params.MaxOpsPerTxn < 0:
+		return errors.Errorf("MaxOpsPerTxn (%d) must not be negative", params.MaxOpsPerTxn)
+	case params.MaxTxnDocBytes < 0:
+		return errors.Errorf("MaxTxnDocBytes (%d) must not be negative", params.MaxTxnDocBytes)
+	case params.MaxTxnQueueLength < 0:
+		return errors.Errorf("MaxTxnQueueLength (%d) must not be negative", params.MaxTxnQueueLength)
+	case params.MaxTxnQueueAge < 0:
+		return errors.Errorf("MaxTxnQueueAge (%s) must not be negative", params.MaxTxnQueueAge)
+	case params.OperationTimeout < 0:
+		return errors.Errorf("OperationTimeout (%s) must not be negative", params.OperationTimeout)
+	}
+	if params.TransactionCollectionName == "" {
+		params.TransactionCollectionName = defaultTxnCollectionName
+	}
+	if params.ChangeLogName == "" {
+		params.ChangeLogName = defaultChangeLogName
+	}
+	if params.MaxRetryAttempts == 0 {
+		params.MaxRetryAttempts = defaultClientTxnRetries
+		if params.ServerSideTransactions {
+			params.MaxRetryAttempts = defaultServerTxnRetries
+		}
+	}
+	if params.RetryBackoff == 0 {
+		params.RetryBackoff = defaultRetryBackoff
+	}
+	if params.RetryFuzzPercent == 0 {
+		params.RetryFuzzPercent = defaultRetryFuzzPercent
+	}
+	return nil
+}
+
+// maxTimeForAge returns the MaxTime for transactions older than age, or
+// the zero time if age is zero.
+func maxTimeForAge(age time.Duration, now time.Time) (time.Time, error) {
+	if age < 0 {
+		return time.Time{}, errors.Errorf("max-txn-age (%s) must not be negative", age)
+	}
+	if age == 0 {
+		return time.Time{}, nil
+	}
+	return now.Add(-age), nil
+}
+
+func (s pruneSchema) options(now time.Time) (PruneOptions, error) {
+	maxTime, err := maxTimeForAge(s.MaxTxnAge, now)
+	if err != nil {
+		return PruneOptions{}, errors.Trace(err)
+	}
+	opts := PruneOptions{
+		PruneFactor:                s.PruneFactor,
+		MinNewTransactions:         s.MinNewTransactions,
+		MaxNewTransactions:         s.MaxNewTransactions,
+		MaxTime:                    maxTime,
+		MaxBatchTransactions:       s.MaxBatchTransactions,
+		MaxBatches:                 s.MaxBatches,
+		SmallBatchTransactionCount: s.SmallBatchTransactionCount,
+		BatchTransactionSleepTime:  s.BatchTransactionSleepTime,
+		MaxPruneHistory:            s.MaxPruneHistory,
+		MaxPruneHistoryAge:         s.MaxPruneHistoryAge,
+		MinFreeDiskBytes:           s.MinFreeDiskBytes,
+		DiskCheckWarnOnly:          s.DiskCheckWarnOnly,
+	}
+	return opts, nil
+}
+
+func (s cleanAndPruneSchema) args(now time.Time) (CleanAndPruneArgs, error) {
+	maxTime, err := maxTimeForAge(s.MaxTxnAge, now)
+	if err != nil {
+		return CleanAndPruneArgs{}, errors.Trace(err)
+	}
+	args := CleanAndPruneArgs{
+		MaxTime:                  maxTime,
+		MaxTransactionsToProcess: s.MaxTransactionsToProcess,
+		Multithreaded:            s.Multithreaded,
+		CollectionConcurrency:    s.CollectionConcurrency,
+		TxnBatchSize:             s.TxnBatchSize,
+		TxnBatchSleepTime:        s.TxnBatchSleepTime,
+		MaxPasses:                s.MaxPasses,
+		ErrorBudget:              s.ErrorBudget,
+		MaxRuntime:               s.MaxRuntime,
+		MaxScanLag:               s.MaxScanLag,
+		ReadWholeDocuments:       s.ReadWholeDocuments,
+		StripInvalidTokens:       s.StripInvalidTokens,
+		CheckMissingTxns:         s.CheckMissingTxns,
+		SessionMode:              PruneSessionMode(s.SessionMode),
+		SyncTimeout:              s.SyncTimeout,
+		SocketTimeout:            s.SocketTimeout,
+		StashOrder:               StashOrder(s.StashOrder),
+		BulkStashCleanup:         s.BulkStashCleanup,
+		ConcurrentPrune:          ConcurrentPruneMode(s.ConcurrentPrune),
+		ProgressInterval:         s.ProgressInterval,
+	}
+	if s.MaxOplogWindowFraction != 0 {
+		args.OplogPacing = &OplogPacing{MaxWindowFractionPerHour: s.MaxOplogWindowFraction}
+	}
+	return args, nil
+}
+
+func (s runnerSchema) params() (RunnerParams, error) {
+	params := RunnerParams{
+		TransactionCollectionName: s.TransactionCollectionName,
+		ChangeLogName:             s.ChangeLogName,
+		ServerSideTransactions:    s.ServerSideTransactions,
+		MaxRetryAttempts:          s.MaxRetryAttempts,
+		RetryBackoff:              s.RetryBackoff,
+		RetryFuzzPercent:          s.RetryFuzzPercent,
+		MaxOpsPerTxn:              s.MaxOpsPerTxn,
+		MaxTxnDocBytes:            s.MaxTxnDocBytes,
+		MaxTxnQueueLength:         s.MaxTxnQueueLength,
+		MaxTxnQueueAge:            s.MaxTxnQueueAge,
+		OperationTimeout:          s.OperationTimeout,
+		SortOps:                   s.SortOps,
+	}
+	switch s.TxnLimitPolicy {
+	case "", TxnLimitReject.String():
+		params.TxnLimitPolicy = TxnLimitReject
+	case TxnLimitSplit.String():
+		params.TxnLimitPolicy = TxnLimitSplit
+	case TxnLimitWarn.String():
+		params.TxnLimitPolicy = TxnLimitWarn
+	default:
+		return params, errors.Errorf("unknown txn-limit-policy %q", s.TxnLimitPolicy)
+	}
+	return params, nil
+}
+
+// EnvOverrides applies settings from these environment variables on top of
+// the config, so that an operator can tune a deployed program without
+// changing its code or config file:
+//
+//	TXN_PRUNE_BATCH_SIZE    SmallBatchTransactionCount and TxnBatchSize
+//	TXN_PRUNE_SLEEP         BatchTransactionSleepTime and TxnBatchSleepTime
+//	TXN_PRUNE_MAX_BATCHES   MaxBatches and MaxPasses
+//	TXN_PRUNE_MAX_TXNS      MaxBatchTransactions and MaxTransactionsToProcess
+//	TXN_PRUNE_MAX_RUNTIME   MaxRuntime
+//	TXN_PRUNE_FACTOR        PruneFactor
+//	TXN_MAX_RETRIES         MaxRetryAttempts
+//	TXN_RETRY_BACKOFF       RetryBackoff
+//	TXN_OPERATION_TIMEOUT   OperationTimeout
+//
+// Variables that are unset or empty leave the setting alone. It is opt-in:
+// nothing reads the environment unless EnvOverrides is called. Each
+// override is logged, and the config is checked again afterwards.
+func (config *Config) EnvOverrides() error {
+	return config.envOverrides(os.Getenv)
+}
+
+func (config *Config) envOverrides(getenv func(string) string) error {
+	for _, o := range []struct {
+		name string
+		ints []*int
+	}{
+		{"TXN_PRUNE_BATCH_SIZE", []*int{
+			&config.PruneOptions.SmallBatchTransactionCount,
+			&config.CleanAndPrune.TxnBatchSize,
+		}},
+		{"TXN_PRUNE_MAX_BATCHES", []*int{
+			&config.PruneOptions.MaxBatches,
+			&config.CleanAndPrune.MaxPasses,
+		}},
+		{"TXN_PRUNE_MAX_TXNS", []*int{
+			&config.PruneOptions.MaxBatchTransactions,
+			&config.CleanAndPrune.MaxTransactionsToProcess,
+		}},
+		{"TXN_MAX_RETRIES", []*int{
+			&config.Runner.MaxRetryAttempts,
+		}},
+	} {
+		value := getenv(o.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.Annotatef(err, "parsing %s", o.name)
+		}
+		logger.Infof("%s overrides txn config: %d", o.name, n)
+		for _, field := range o.ints {
+			*field = n
+		}
+	}
+	for _, o := range []struct {
+		name      string
+		durations []*time.Duration
+	}{
+		{"TXN_PRUNE_SLEEP", []*time.Duration{
+			&config.PruneOptions.BatchTransactionSleepTime,
+			&config.CleanAndPrune.TxnBatchSleepTime,
+		}},
+		{"TXN_PRUNE_MAX_RUNTIME", []*time.Duration{
+			&config.CleanAndPrune.MaxRuntime,
+		}},
+		{"TXN_RETRY_BACKOFF", []*time.Duration{
+			&config.Runner.RetryBackoff,
+		}},
+		{"TXN_OPERATION_TIMEOUT", []*time.Duration{
+			&config.Runner.OperationTimeout,
+		}},
+	} {
+		value := getenv(o.name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.Annotatef(err, "parsing %s", o.name)
+		}
+		logger.Infof("%s overrides txn config: %s", o.name, d)
+		for _, field := range o.durations {
+			*field = d
+		}
+	}
+	if value := getenv("TXN_PRUNE_FACTOR"); value != "" {
+		f, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return errors.Annotate(err, "parsing TXN_PRUNE_FACTOR")
+		}
+		logger.Infof("TXN_PRUNE_FACTOR overrides txn config: %v", f)
+		config.PruneOptions.PruneFactor = float32(f)
+	}
+	return errors.Annotate(config.validate(), "after environment overrides")
+}
@@ -0,0 +1,177 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type ConfigSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&ConfigSuite{})
+
+func (*ConfigSuite) TestParseYAML(c *gc.C) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	config, err := parseConfig([]byte(`
+prune:
+  max-txn-age: 1h
+  max-batches: 3
+clean-and-prune:
+  txn-batch-size: 500
+  max-runtime: 30m
+  stash-order: last
+  concurrent-prune: skip
+runner:
+  max-retry-attempts: 5
+  txn-limit-policy: split
+`), now)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(config.PruneOptions.MaxTime, gc.Equals, now.Add(-time.Hour))
+	c.Check(config.PruneOptions.MaxBatches, gc.Equals, 3)
+	c.Check(config.PruneOptions.PruneFactor, gc.Equals, float32(defaultPruneFactor))
+	c.Check(config.CleanAndPrune.TxnBatchSize, gc.Equals, 500)
+	c.Check(config.CleanAndPrune.MaxRuntime, gc.Equals, 30*time.Minute)
+	c.Check(config.CleanAndPrune.StashOrder, gc.Equals, StashLast)
+	c.Check(config.CleanAndPrune.ConcurrentPrune, gc.Equals, ConcurrentPruneSkip)
+	c.Check(config.CleanAndPrune.MaxPasses, gc.Equals, 1)
+	c.Check(config.Runner.MaxRetryAttempts, gc.Equals, 5)
+	c.Check(config.Runner.TxnLimitPolicy, gc.Equals, TxnLimitSplit)
+	c.Check(config.Runner.TransactionCollectionName, gc.Equals, defaultTxnCollectionName)
+}
+
+func (*ConfigSuite) TestFeatures(c *gc.C) {
+	config, err := parseConfig([]byte("clean-and-prune:\n  multithreaded: true\n"), time.Now())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(config.CleanAndPrune.Features, gc.IsNil)
+	c.Check(config.CleanAndPrune.Multithreaded, jc.IsTrue)
+
+	config, err = parseConfig([]byte(`
+clean-and-prune:
+  multithreaded: true
+  bulk-stash-cleanup: true
+features:
+  enable-parallel-prune: true
+`), time.Now())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(*config.CleanAndPrune.Features, gc.Equals, Features{EnableParallelPrune: true})
+	c.Check(config.Runner.Features, gc.Equals, config.CleanAndPrune.Features)
+	c.Check(config.CleanAndPrune.Multithreaded, jc.IsTrue)
+	c.Check(config.CleanAndPrune.BulkStashCleanup, jc.IsFalse)
+}
+
+func (*ConfigSuite) TestLoadJSON(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "txn.json")
+	err := os.WriteFile(path, []byte(`{"runner": {"retry-backoff": "50ms", "sort-ops": true}}`), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	config, err := LoadConfig(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(config.Runner.RetryBackoff, gc.Equals, 50*time.Millisecond)
+	c.Check(config.Runner.SortOps, jc.IsTrue)
+	c.Check(config.CleanAndPrune.TxnBatchSize, gc.Equals, pruneTxnBatchSize)
+}
+
+func (*ConfigSuite) TestInvalid(c *gc.C) {
+	for _, test := range []struct {
+		config string
+		err    string
+	}{{
+		config: "prune:\n  prune-fctor: 2",
+		err:    `(?s)yaml: unmarshal errors:.*field prune-fctor not found.*`,
+	}, {
+		config: "prune:\n  max-txn-age: -1h",
+		err:    `prune: max-txn-age \(-1h0m0s\) must not be negative`,
+	}, {
+		config: "prune:\n  min-free-disk-bytes: -1",
+		err:    `prune: MinFreeDiskBytes \(-1\) must not be negative`,
+	}, {
+		config: "clean-and-prune:\n  txn-batch-size: 1",
+		err:    `clean-and-prune: TxnBatchSize 1 too small, .*`,
+	}, {
+		config: "clean-and-prune:\n  concurrent-prune: sometimes",
+		err:    `clean-and-prune: unknown ConcurrentPrune mode "sometimes"`,
+	}, {
+		config: "clean-and-prune:\n  collection-concurrency: -2",
+		err:    `clean-and-prune: CollectionConcurrency \(-2\) must not be negative`,
+	}, {
+		config: "clean-and-prune:\n  max-oplog-window-fraction: 2",
+		err:    `clean-and-prune: MaxWindowFractionPerHour 2 outside \(0, 1\] not valid`,
+	}, {
+		config: "runner:\n  txn-limit-policy: ignore",
+		err:    `runner: unknown txn-limit-policy "ignore"`,
+	}, {
+		config: "runner:\n  retry-fuzz-percent: 150",
+		err:    `runner: RetryFuzzPercent \(150\) must be between 0 and 100`,
+	}} {
+		c.Logf("config %q", test.config)
+		_, err := parseConfig([]byte(test.config), time.Now())
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (*ConfigSuite) TestEnvOverrides(c *gc.C) {
+	config, err := parseConfig([]byte("prune:\n  max-batches: 3\n"), time.Now())
+	c.Assert(err, jc.ErrorIsNil)
+	env := map[string]string{
+		"TXN_PRUNE_BATCH_SIZE": "200",
+		"TXN_PRUNE_SLEEP":      "1s",
+		"TXN_PRUNE_FACTOR":     "1.5",
+		"TXN_MAX_RETRIES":      "7",
+	}
+	err = config.envOverrides(func(name string) string {
+		return env[name]
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(config.PruneOptions.SmallBatchTransactionCount, gc.Equals, 200)
+	c.Check(config.CleanAndPrune.TxnBatchSize, gc.Equals, 200)
+	c.Check(config.PruneOptions.BatchTransactionSleepTime, gc.Equals, time.Second)
+	c.Check(config.CleanAndPrune.TxnBatchSleepTime, gc.Equals, time.Second)
+	c.Check(config.PruneOptions.PruneFactor, gc.Equals, float32(1.5))
+	c.Check(config.Runner.MaxRetryAttempts, gc.Equals, 7)
+	// Settings without a variable are left alone.
+	c.Check(config.PruneOptions.MaxBatches, gc.Equals, 3)
+	c.Check(config.Runner.RetryBackoff, gc.Equals, defaultRetryBackoff)
+}
+
+func (*ConfigSuite) TestEnvOverridesInvalid(c *gc.C) {
+	for _, test := range []struct {
+		name  string
+		value string
+		err   string
+	}{{
+		name:  "TXN_MAX_RETRIES",
+		value: "lots",
+		err:   `parsing TXN_MAX_RETRIES: strconv.Atoi: parsing "lots": invalid syntax`,
+	}, {
+		name:  "TXN_PRUNE_SLEEP",
+		value: "a bit",
+		err:   `parsing TXN_PRUNE_SLEEP: time: invalid duration "a bit"`,
+	}, {
+		name:  "TXN_PRUNE_BATCH_SIZE",
+		value: "1",
+		err:   `after environment overrides: clean-and-prune: TxnBatchSize 1 too small, .*`,
+	}, {
+		name:  "TXN_RETRY_BACKOFF",
+		value: "-1s",
+		err:   `after environment overrides: runner: RetryBackoff \(-1s\) must not be negative`,
+	}} {
+		c.Logf("%s=%s", test.name, test.value)
+		config, err := parseConfig(nil, time.Now())
+		c.Assert(err, jc.ErrorIsNil)
+		err = config.envOverrides(func(name string) string {
+			if name == test.name {
+				return test.value
+			}
+			return ""
+		})
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
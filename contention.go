@@ -0,0 +1,169 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+)
+
+// ContentionAdvisor is consulted by Run whenever an attempt fails because
+// of contention, ie it was aborted or hit a retryable error, and there are
+// attempts left. Retrying every attempt the same way makes storms on hot
+// documents worse, so an advisor can use what it knows about the contended
+// documents to spread attempts out, or give up early.
+type ContentionAdvisor interface {
+	// Advise returns how the next attempt should be made.
+	Advise(Contention) ContentionAdvice
+}
+
+// ContentionAdvisorFunc adapts a func to a ContentionAdvisor.
+type ContentionAdvisorFunc func(Contention) ContentionAdvice
+
+// Advise is defined on ContentionAdvisor.
+func (f ContentionAdvisorFunc) Advise(c Contention) ContentionAdvice {
+	return f(c)
+}
+
+// Contention describes an attempt that failed because of contention.
+type Contention struct {
+	// Attempt is the attempt that failed, starting at 0.
+	Attempt int
+
+	// Ops are the operations of the attempt.
+	Ops []txn.Op
+
+	// Err is the error the attempt failed with.
+	Err error
+
+	// Contended are the documents that caused the failure. If the
+	// attempt was aborted, they are the documents whose assertions no
+	// longer hold; otherwise the server didn't say which documents
+	// conflicted, so they are all the documents in Ops.
+	Contended []DocRef
+}
+
+// DocRef identifies a document.
+type DocRef struct {
+	Collection string
+	Id         interface{}
+}
+
+// ContentionAdvice tells Run how to make the next attempt.
+type ContentionAdvice struct {
+	// GiveUp makes Run stop retrying, and return ErrExcessiveContention
+	// (or the error of the attempt, if it wasn't aborted).
+	GiveUp bool
+
+	// Backoff, if non-zero, is how long to pause before the next
+	// attempt, instead of the usual backoff. It is jittered by
+	// RunnerParams.RetryFuzzPercent, so that attempts contending on the
+	// same documents don't retry in lock step.
+	Backoff time.Duration
+
+	// ContendedFirst moves the operations on the contended documents to
+	// the start of the next attempt's operations, keeping the order of
+	// the others. A server-side transaction then writes to the hot
+	// documents before doing anything else, so it conflicts, if it is
+	// going to, before it has done other work.
+	ContendedFirst bool
+}
+
+// isContention returns true if err means that an attempt failed because
+// of other transactions.
+func isContention(err error) bool {
+	return err == txn.ErrAborted || mgo.IsRetryable(err) || mgo.IsSnapshotError(err)
+}
+
+// adviseContention asks the advisor how to follow the failed attempt, and
+// returns its advice with the documents it was told were contended.
+func (tr *transactionRunner) adviseContention(attempt int, ops []txn.Op, err error) (ContentionAdvice, []DocRef) {
+	contention := Contention{
+		Attempt: attempt,
+		Ops:     ops,
+		Err:     err,
+	}
+	if err == txn.ErrAborted {
+		contended, findErr := tr.failedAssertions(ops)
+		if findErr != nil {
+			runnerLogger.Debugf("cannot find contended documents: %v", findErr)
+		} else {
+			contention.Contended = contended
+		}
+	}
+	if contention.Contended == nil {
+		contention.Contended = opDocs(ops)
+	}
+	return tr.contentionAdvisor.Advise(contention), contention.Contended
+}
+
+// failedAssertions returns the documents in ops whose assertions don't
+// hold. Documents may have changed again since the attempt was aborted,
+// so this is the best guess at which ones it was aborted by.
+func (tr *transactionRunner) failedAssertions(ops []txn.Op) ([]DocRef, error) {
+	var contended []DocRef
+	for _, op := range ops {
+		if op.Assert == nil {
+			continue
+		}
+		query := bson.D{{"_id", op.Id}}
+		wantExists := true
+		switch op.Assert {
+		case txn.DocMissing:
+			wantExists = false
+		case txn.DocExists:
+		default:
+			query = append(query, bson.DocElem{"$and", []interface{}{op.Assert}})
+		}
+		// Count can't carry maxTimeMS, so look for the document instead.
+		var doc struct{}
+		err := tr.withMaxTime(tr.db.C(op.C).Find(query).Select(bson.M{"_id": 1})).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			return nil, errors.Annotatef(err, "checking assertion on %q %v", op.C, op.Id)
+		}
+		if (err == nil) != wantExists {
+			contended = append(contended, DocRef{Collection: op.C, Id: op.Id})
+		}
+	}
+	return contended, nil
+}
+
+// opDocs returns the documents touched by ops.
+func opDocs(ops []txn.Op) []DocRef {
+	docs := make([]DocRef, len(ops))
+	for i, op := range ops {
+		docs[i] = DocRef{Collection: op.C, Id: op.Id}
+	}
+	return docs
+}
+
+// contendedFirst returns ops with the operations on contended documents
+// moved to the start.
+func contendedFirst(ops []txn.Op, contended []DocRef) []txn.Op {
+	hot := func(op txn.Op) bool {
+		for _, doc := range contended {
+			if doc.Collection == op.C && reflect.DeepEqual(doc.Id, op.Id) {
+				return true
+			}
+		}
+		return false
+	}
+	result := make([]txn.Op, 0, len(ops))
+	for _, op := range ops {
+		if hot(op) {
+			result = append(result, op)
+		}
+	}
+	for _, op := range ops {
+		if !hot(op) {
+			result = append(result, op)
+		}
+	}
+	return result
+}
@@ -0,0 +1,122 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// DeleteMode selects how the ids queued by a Remover are matched.
+type DeleteMode string
+
+const (
+	// DeleteIn removes the queued documents with a single $in filter on
+	// their ids. It is the default.
+	DeleteIn DeleteMode = "in"
+
+	// DeleteEach removes each queued document with its own equality
+	// filter, limited to one document, in a single delete command. A
+	// collation or numeric comparison that makes different ids compare
+	// equal then can't remove more documents than were queued, and ids
+	// of mixed types are matched one by one rather than as a set.
+	DeleteEach DeleteMode = "each"
+)
+
+// DeleteStrategy selects how a Remover deletes the documents it has
+// queued. Collections can be given different strategies, so that those
+// with a collation or unusual ids are handled without slowing down the
+// rest.
+type DeleteStrategy struct {
+	// Mode selects how ids are matched. Defaults to DeleteIn.
+	Mode DeleteMode
+
+	// Collation, if not nil, is the collation ids are compared with. It
+	// should be the default collation of the collection, so that its _id
+	// index can be used, and so that documents are removed on the same
+	// terms as they were read. mgo doesn't support collations in
+	// removes, so the delete command is run directly; it needs MongoDB
+	// 3.4 or later.
+	Collation *mgo.Collation
+}
+
+// Validate returns an error if the strategy can't be used.
+func (s DeleteStrategy) Validate() error {
+	switch s.Mode {
+	case "", DeleteIn, DeleteEach:
+	default:
+		return errors.NotValidf("delete mode %q", string(s.Mode))
+	}
+	if s.Collation != nil && s.Collation.Locale == "" {
+		return errors.NotValidf("collation without locale")
+	}
+	return nil
+}
+
+// deleteStatement is one of the deletes of a delete command.
+type deleteStatement struct {
+	Query     bson.M         `bson:"q"`
+	Limit     int            `bson:"limit"`
+	Collation *mgo.Collation `bson:"collation,omitempty"`
+}
+
+// deleteResult is the reply to a delete command.
+type deleteResult struct {
+	N           int `bson:"n"`
+	WriteErrors []struct {
+		Index  int    `bson:"index"`
+		Code   int    `bson:"code"`
+		ErrMsg string `bson:"errmsg"`
+	} `bson:"writeErrors"`
+}
+
+// remove removes the documents in coll with the given ids, and returns
+// how many were removed.
+func (s DeleteStrategy) remove(coll *mgo.Collection, ids []interface{}) (int, error) {
+	if err := s.Validate(); err != nil {
+		return 0, errors.Trace(err)
+	}
+	if s.Mode != DeleteEach && s.Collation == nil {
+		info, err := coll.RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+		if info == nil {
+			return 0, err
+		}
+		return info.Removed, err
+	}
+	var result deleteResult
+	err := coll.Database.Run(bson.D{
+		{"delete", coll.Name},
+		{"deletes", s.statements(ids)},
+		{"ordered", false},
+	}, &result)
+	if err != nil {
+		return 0, errors.Annotatef(err, "deleting from %q", coll.Name)
+	}
+	if len(result.WriteErrors) > 0 {
+		first := result.WriteErrors[0]
+		return result.N, errors.Errorf("deleting from %q: %d of %d deletes failed, first with code %d: %s",
+			coll.Name, len(result.WriteErrors), len(ids), first.Code, first.ErrMsg)
+	}
+	return result.N, nil
+}
+
+// statements returns the deletes that remove the documents with ids.
+func (s DeleteStrategy) statements(ids []interface{}) []deleteStatement {
+	if s.Mode != DeleteEach {
+		return []deleteStatement{{
+			Query:     bson.M{"_id": bson.M{"$in": ids}},
+			Collation: s.Collation,
+		}}
+	}
+	statements := make([]deleteStatement, len(ids))
+	for i, id := range ids {
+		statements[i] = deleteStatement{
+			Query:     bson.M{"_id": id},
+			Limit:     1,
+			Collation: s.Collation,
+		}
+	}
+	return statements
+}
@@ -0,0 +1,91 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type DeleteStrategySuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&DeleteStrategySuite{})
+
+func (*DeleteStrategySuite) TestValidate(c *gc.C) {
+	c.Check(DeleteStrategy{}.Validate(), jc.ErrorIsNil)
+	c.Check(DeleteStrategy{Mode: DeleteEach, Collation: &mgo.Collation{Locale: "en"}}.Validate(), jc.ErrorIsNil)
+	err := DeleteStrategy{Mode: "some"}.Validate()
+	c.Check(err, gc.ErrorMatches, `delete mode "some" not valid`)
+	err = DeleteStrategy{Collation: &mgo.Collation{}}.Validate()
+	c.Check(err, gc.ErrorMatches, "collation without locale not valid")
+}
+
+func (*DeleteStrategySuite) TestStatements(c *gc.C) {
+	collation := &mgo.Collation{Locale: "en", Strength: 2}
+	ids := []interface{}{"a", 1}
+	c.Check(DeleteStrategy{Collation: collation}.statements(ids), jc.DeepEquals, []deleteStatement{{
+		Query:     bson.M{"_id": bson.M{"$in": ids}},
+		Collation: collation,
+	}})
+	c.Check(DeleteStrategy{Mode: DeleteEach}.statements(ids), jc.DeepEquals, []deleteStatement{
+		{Query: bson.M{"_id": "a"}, Limit: 1},
+		{Query: bson.M{"_id": 1}, Limit: 1},
+	})
+}
+
+type DeleteStrategyRemoveSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&DeleteStrategyRemoveSuite{})
+
+func (s *DeleteStrategyRemoveSuite) TestCollation(c *gc.C) {
+	collation := &mgo.Collation{Locale: "en", Strength: 2}
+	err := s.db.Run(bson.D{{"create", "docs"}, {"collation", collation}}, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	coll := s.db.C("docs")
+	c.Assert(coll.Insert(bson.M{"_id": "keep"}), jc.ErrorIsNil)
+	for _, mode := range []DeleteMode{DeleteIn, DeleteEach} {
+		c.Logf("mode %q", mode)
+		c.Assert(coll.Insert(bson.M{"_id": "Abc"}), jc.ErrorIsNil)
+		remover := NewRemover(coll, DeleteStrategy{Mode: mode, Collation: collation})
+		c.Assert(remover.Remove("aBC"), jc.ErrorIsNil)
+		c.Assert(remover.Remove("missing"), jc.ErrorIsNil)
+		c.Assert(remover.Flush(), jc.ErrorIsNil)
+		c.Check(remover.Removed(), gc.Equals, 1)
+		count, err := coll.Count()
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(count, gc.Equals, 1)
+	}
+}
+
+func (s *DeleteStrategyRemoveSuite) TestEachMixedIds(c *gc.C) {
+	coll := s.db.C("docs")
+	c.Assert(coll.Insert(
+		bson.M{"_id": 1},
+		bson.M{"_id": "1"},
+		bson.M{"_id": bson.D{{"c", "coll"}, {"id", 2}}},
+	), jc.ErrorIsNil)
+	remover := NewRemover(coll, DeleteStrategy{Mode: DeleteEach})
+	c.Assert(remover.Remove(1.0), jc.ErrorIsNil)
+	c.Assert(remover.Remove(bson.D{{"c", "coll"}, {"id", 2}}), jc.ErrorIsNil)
+	c.Assert(remover.Flush(), jc.ErrorIsNil)
+	c.Check(remover.Removed(), gc.Equals, 2)
+	c.Assert(coll.FindId("1").One(&bson.M{}), jc.ErrorIsNil)
+}
+
+func (s *DeleteStrategyRemoveSuite) TestInvalidStrategy(c *gc.C) {
+	coll := s.db.C("docs")
+	c.Assert(coll.Insert(bson.M{"_id": "a"}), jc.ErrorIsNil)
+	remover := NewRemover(coll, DeleteStrategy{Mode: "some"})
+	c.Assert(remover.Remove("a"), jc.ErrorIsNil)
+	c.Check(remover.Flush(), gc.ErrorMatches, `delete mode "some" not valid`)
+	c.Check(remover.Removed(), gc.Equals, 0)
+	c.Assert(coll.FindId("a").One(&bson.M{}), jc.ErrorIsNil)
+}
@@ -0,0 +1,123 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+
+	"github.com/juju/txn/v3/token"
+)
+
+// ErrDirtyDoc is returned by Run and RunTransaction when the runner is
+// configured with MaxTxnQueueLength or MaxTxnQueueAge, and one of the
+// documents in the transaction has a txn-queue that is too long, or holds
+// a token that is too old. Such a queue is usually the result of stuck or
+// unpruned transactions, and retrying against it is unlikely to help; the
+// caller should clean up the document's queue instead.
+type ErrDirtyDoc struct {
+	// Collection and Id identify the document.
+	Collection string
+	Id         interface{}
+
+	// QueueLength is the number of tokens in the document's txn-queue.
+	QueueLength int
+
+	// OldestToken is the first token in the txn-queue.
+	OldestToken string
+
+	// Age is how long ago the transaction of the oldest token was
+	// created.
+	Age time.Duration
+}
+
+// Error is part of the error interface.
+func (e *ErrDirtyDoc) Error() string {
+	return fmt.Sprintf("document %q %v has a dirty txn-queue (%d tokens, oldest %s old)",
+		e.Collection, e.Id, e.QueueLength, e.Age.Round(time.Second))
+}
+
+// IsDirtyDoc returns true if err is, or was caused by, an *ErrDirtyDoc.
+func IsDirtyDoc(err error) bool {
+	_, ok := errors.Cause(err).(*ErrDirtyDoc)
+	return ok
+}
+
+// queueSummary is the result of summarising a document's txn-queue.
+type queueSummary struct {
+	Id     interface{} `bson:"_id"`
+	Length int         `bson:"length"`
+	Oldest string      `bson:"oldest"`
+}
+
+// dirtyDocsEnabled returns true if the runner should check txn-queues
+// before running transactions.
+func (tr *transactionRunner) dirtyDocsEnabled() bool {
+	return !tr.serverSideTransactions && (tr.maxTxnQueueLength > 0 || tr.maxTxnQueueAge > 0)
+}
+
+// checkDirtyDocs returns an *ErrDirtyDoc for the first document touched by
+// ops whose txn-queue is over the configured limits. The queues are
+// summarised on the server so that long queues aren't read in full.
+func (tr *transactionRunner) checkDirtyDocs(db *mgo.Database, ops []txn.Op) error {
+	var collections []string
+	idsByCollection := make(map[string][]interface{})
+	for _, op := range ops {
+		if _, ok := idsByCollection[op.C]; !ok {
+			collections = append(collections, op.C)
+		}
+		idsByCollection[op.C] = append(idsByCollection[op.C], op.Id)
+	}
+	now := tr.clock.Now()
+	for _, collection := range collections {
+		ids := idsByCollection[collection]
+		// Run the aggregation as a command, rather than with Pipe, so
+		// that it can carry maxTimeMS. Ids are unique, so every result
+		// fits in the first batch.
+		command := bson.D{
+			{"aggregate", collection},
+			{"pipeline", []bson.M{
+				{"$match": bson.M{"_id": bson.M{"$in": ids}}},
+				{"$project": bson.M{
+					"length": bson.M{"$size": bson.M{"$ifNull": []interface{}{"$txn-queue", []interface{}{}}}},
+					"oldest": bson.M{"$arrayElemAt": []interface{}{"$txn-queue", 0}},
+				}},
+			}},
+			{"cursor", bson.M{"batchSize": len(ids)}},
+		}
+		if tr.operationTimeout > 0 {
+			command = append(command, bson.DocElem{"maxTimeMS", int64(tr.operationTimeout / time.Millisecond)})
+		}
+		var result struct {
+			Cursor struct {
+				FirstBatch []queueSummary `bson:"firstBatch"`
+			} `bson:"cursor"`
+		}
+		if err := db.Run(command, &result); err != nil {
+			return errors.Annotatef(err, "checking txn-queue of %q documents", collection)
+		}
+		for _, doc := range result.Cursor.FirstBatch {
+			dirty := &ErrDirtyDoc{
+				Collection:  collection,
+				Id:          doc.Id,
+				QueueLength: doc.Length,
+				OldestToken: doc.Oldest,
+			}
+			if t, err := token.Parse(doc.Oldest); err == nil {
+				dirty.Age = now.Sub(t.Id.Time())
+			}
+			if (tr.maxTxnQueueLength > 0 && dirty.QueueLength > tr.maxTxnQueueLength) ||
+				(tr.maxTxnQueueAge > 0 && dirty.Age > tr.maxTxnQueueAge) {
+				runnerLogger.Warningf("%v", dirty)
+				return dirty
+			}
+		}
+	}
+	return nil
+}
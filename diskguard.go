@@ -0,0 +1,99 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// pruneDiskBytesPerTxn estimates the disk space used while pruning for
+// each transaction pruned: the oplog entries of removing it and cleaning
+// the documents it touched, which are written faster than a busy oplog
+// may be truncated.
+const pruneDiskBytesPerTxn = 1024
+
+// InsufficientDiskError is returned by MaybePrune and PruneBudgeted when
+// PruneOptions.MinFreeDiskBytes is set and pruning could leave less than
+// that much disk free.
+type InsufficientDiskError struct {
+	// Free is the disk space free before pruning.
+	Free int64
+
+	// Overhead is the estimate of the space pruning will use.
+	Overhead int64
+
+	// MinFree is PruneOptions.MinFreeDiskBytes.
+	MinFree int64
+}
+
+func (e *InsufficientDiskError) Error() string {
+	return fmt.Sprintf("not pruning: %dMiB of disk is free, pruning could use %dMiB, leaving less than %dMiB",
+		e.Free>>20, e.Overhead>>20, e.MinFree>>20)
+}
+
+// IsInsufficientDisk returns true if err is an *InsufficientDiskError.
+func IsInsufficientDisk(err error) bool {
+	_, ok := errors.Cause(err).(*InsufficientDiskError)
+	return ok
+}
+
+// fsStats is the filesystem usage reported by dbStats, which is only
+// reported by MongoDB 3.6 and later.
+type fsStats struct {
+	FsUsedSize  int64 `bson:"fsUsedSize"`
+	FsTotalSize int64 `bson:"fsTotalSize"`
+}
+
+// checkDiskSpace checks, if opts.MinFreeDiskBytes is set, that pruning up
+// to txnsCount transactions won't leave less than that much disk free on
+// the filesystem holding db. It returns an *InsufficientDiskError if it
+// could, unless opts.DiskCheckWarnOnly is set, in which case a warning is
+// logged. The check is skipped if the server doesn't report the space.
+func checkDiskSpace(db *mgo.Database, txnsCount int, opts PruneOptions) error {
+	if opts.MinFreeDiskBytes == 0 {
+		return nil
+	}
+	var stats fsStats
+	if err := db.Run(bson.D{{"dbStats", 1}}, &stats); err != nil {
+		pruneLogger.Warningf("unable to check disk space before pruning: %v", err)
+		return nil
+	}
+	if stats.FsTotalSize == 0 {
+		pruneLogger.Debugf("server doesn't report disk space, not checking it before pruning")
+		return nil
+	}
+	err := diskSpaceError(stats, pruneTxnLimit(txnsCount, opts), opts.MinFreeDiskBytes)
+	if err != nil && opts.DiskCheckWarnOnly {
+		pruneLogger.Warningf("pruning anyway: %v", err)
+		return nil
+	}
+	return err
+}
+
+// pruneTxnLimit returns the most transactions that a prune with opts
+// will process, out of txnsCount.
+func pruneTxnLimit(txnsCount int, opts PruneOptions) int {
+	if opts.MaxBatchTransactions > 0 {
+		limit := opts.MaxBatchTransactions * maxInt(opts.MaxBatches, 1)
+		if limit < txnsCount {
+			return limit
+		}
+	}
+	return txnsCount
+}
+
+// diskSpaceError returns an *InsufficientDiskError if pruning txns
+// transactions could leave less than minFree of the filesystem free.
+func diskSpaceError(stats fsStats, txns int, minFree int64) error {
+	free := stats.FsTotalSize - stats.FsUsedSize
+	overhead := int64(txns) * pruneDiskBytesPerTxn
+	if free-overhead >= minFree {
+		return nil
+	}
+	return &InsufficientDiskError{Free: free, Overhead: overhead, MinFree: minFree}
+}
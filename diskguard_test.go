@@ -0,0 +1,73 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type DiskGuardSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&DiskGuardSuite{})
+
+// lotsOfDisk is more disk than any test machine has free.
+const lotsOfDisk = 1 << 60
+
+func (s *DiskGuardSuite) TestRefusesToPrune(c *gc.C) {
+	s.runTxn(c, txn.Op{C: "coll", Id: 0, Insert: bson.M{}})
+	result, err := jujutxn.MaybePrune(s.db, "txns", jujutxn.PruneOptions{MinFreeDiskBytes: lotsOfDisk})
+	c.Assert(err, jc.Satisfies, jujutxn.IsInsufficientDisk)
+	c.Check(result.Pruned, jc.IsFalse)
+	count, err := s.txns.Count()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(count, gc.Equals, 1)
+
+	_, err = jujutxn.PruneBudgeted(s.db, "txns", time.Minute, jujutxn.PruneOptions{MinFreeDiskBytes: lotsOfDisk})
+	c.Check(err, jc.Satisfies, jujutxn.IsInsufficientDisk)
+}
+
+func (s *DiskGuardSuite) TestWarnOnly(c *gc.C) {
+	s.runTxn(c, txn.Op{C: "coll", Id: 0, Insert: bson.M{}})
+	result, err := jujutxn.MaybePrune(s.db, "txns", jujutxn.PruneOptions{
+		MinFreeDiskBytes:  lotsOfDisk,
+		DiskCheckWarnOnly: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.Pruned, jc.IsTrue)
+}
+
+type DiskSpaceSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&DiskSpaceSuite{})
+
+func (*DiskSpaceSuite) TestDiskSpaceError(c *gc.C) {
+	stats := jujutxn.FsStats{FsUsedSize: 90 << 20, FsTotalSize: 100 << 20}
+	// 1024 txns use about 1MiB, leaving 9MiB.
+	c.Check(jujutxn.DiskSpaceError(stats, 1024, 9<<20), jc.ErrorIsNil)
+	err := jujutxn.DiskSpaceError(stats, 1024, 10<<20)
+	c.Check(err, gc.ErrorMatches, "not pruning: 10MiB of disk is free, pruning could use 1MiB, leaving less than 10MiB")
+	c.Check(err, jc.Satisfies, jujutxn.IsInsufficientDisk)
+	c.Check(jujutxn.IsInsufficientDisk(errors.Annotate(err, "pruning")), jc.IsTrue)
+	c.Check(jujutxn.IsInsufficientDisk(errors.New("boom")), jc.IsFalse)
+}
+
+func (*DiskSpaceSuite) TestPruneTxnLimit(c *gc.C) {
+	c.Check(jujutxn.PruneTxnLimit(5000, jujutxn.PruneOptions{}), gc.Equals, 5000)
+	c.Check(jujutxn.PruneTxnLimit(5000, jujutxn.PruneOptions{MaxBatchTransactions: 1000}), gc.Equals, 1000)
+	c.Check(jujutxn.PruneTxnLimit(5000, jujutxn.PruneOptions{MaxBatchTransactions: 1000, MaxBatches: 3}), gc.Equals, 3000)
+	c.Check(jujutxn.PruneTxnLimit(500, jujutxn.PruneOptions{MaxBatchTransactions: 1000}), gc.Equals, 500)
+}
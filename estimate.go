@@ -0,0 +1,293 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"math"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+const (
+	// minEstimateSample is the fewest transactions or documents of a
+	// collection sampled, however small SampleFraction is, so that the
+	// estimates of small collections aren't meaningless.
+	minEstimateSample = 100
+
+	// estimateHistory is how many of the most recent prunes the rate of
+	// pruning is measured over.
+	estimateHistory = 5
+
+	// confidenceZ is the z-score of the 95% confidence intervals of
+	// PruneEstimate.
+	confidenceZ = 1.96
+)
+
+// EstimateOptions controls EstimatePrune.
+type EstimateOptions struct {
+	// SampleFraction is the fraction of the transactions, and of the
+	// documents of each collection, that are read, between 0 and 1.
+	SampleFraction float64
+
+	// MaxTime, if not zero, only counts the transactions created before
+	// it as prunable, like CleanAndPruneArgs.MaxTime.
+	MaxTime time.Time
+}
+
+// Estimate is an estimated quantity, with the bounds of its 95%
+// confidence interval.
+type Estimate struct {
+	Value float64 `json:"value"`
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+}
+
+// DurationEstimate is an estimated duration, with the bounds of its 95%
+// confidence interval.
+type DurationEstimate struct {
+	Value time.Duration `json:"value"`
+	Low   time.Duration `json:"low"`
+	High  time.Duration `json:"high"`
+}
+
+// PruneEstimate is returned by EstimatePrune.
+type PruneEstimate struct {
+	// Estimated is when the estimate was made, and Duration is how long
+	// it took.
+	Estimated time.Time     `json:"estimated"`
+	Duration  time.Duration `json:"duration"`
+
+	// TxnCount is the number of transactions, and TxnsSampled is how
+	// many of them were read.
+	TxnCount    int `json:"txn-count"`
+	TxnsSampled int `json:"txns-sampled"`
+
+	// PrunableTxns estimates how many transactions are complete and old
+	// enough to be pruned.
+	PrunableTxns Estimate `json:"prunable-txns"`
+
+	// DocsSampled is how many documents were read from the collections
+	// that may refer to the transactions, and QueueTokens estimates how
+	// many txn-queue tokens they hold in total.
+	DocsSampled int      `json:"docs-sampled"`
+	QueueTokens Estimate `json:"queue-tokens"`
+
+	// PruneRate is how many transactions recent prunes removed per
+	// second, or 0 if none have been recorded, and Runtime is how long
+	// pruning the PrunableTxns is expected to take at that rate.
+	PruneRate float64          `json:"prune-rate"`
+	Runtime   DurationEstimate `json:"runtime"`
+}
+
+// EstimatePrune estimates how much there is to prune in txnsName, and how
+// long it would take, from a random sample of the transactions and of the
+// documents that may refer to them. It is for databases too big for
+// Analyze to read in full, and writes nothing. The estimates assume that
+// recent prunes ran at the rate the next one will.
+func EstimatePrune(db *mgo.Database, txnsName string, opts EstimateOptions) (PruneEstimate, error) {
+	if opts.SampleFraction <= 0 || opts.SampleFraction > 1 {
+		return PruneEstimate{}, errors.NotValidf("SampleFraction %v", opts.SampleFraction)
+	}
+	tStart := time.Now()
+	estimate := PruneEstimate{Estimated: tStart.UTC()}
+	txns := db.C(txnsName)
+	var err error
+	if estimate.TxnCount, err = txns.Count(); err != nil {
+		return estimate, errors.Annotate(err, "counting transactions")
+	}
+	if err := estimatePrunable(txns, opts, &estimate); err != nil {
+		return estimate, errors.Trace(err)
+	}
+	if err := estimateQueueTokens(db, txnsName, opts, &estimate); err != nil {
+		return estimate, errors.Trace(err)
+	}
+	if estimate.PruneRate, err = recentPruneRate(db, txnsName); err != nil {
+		return estimate, errors.Trace(err)
+	}
+	if estimate.PruneRate > 0 {
+		seconds := func(txns float64) time.Duration {
+			return time.Duration(txns / estimate.PruneRate * float64(time.Second))
+		}
+		estimate.Runtime = DurationEstimate{
+			Value: seconds(estimate.PrunableTxns.Value),
+			Low:   seconds(estimate.PrunableTxns.Low),
+			High:  seconds(estimate.PrunableTxns.High),
+		}
+	}
+	estimate.Duration = time.Since(tStart)
+	return estimate, nil
+}
+
+// sampleSize returns how many of count items to sample.
+func sampleSize(count int, fraction float64) int {
+	size := int(math.Ceil(float64(count) * fraction))
+	if size < minEstimateSample {
+		size = minEstimateSample
+	}
+	if size > count {
+		size = count
+	}
+	return size
+}
+
+// estimatePrunable samples the transactions and estimates the proportion
+// of them that are prunable.
+func estimatePrunable(txns *mgo.Collection, opts EstimateOptions, estimate *PruneEstimate) error {
+	size := sampleSize(estimate.TxnCount, opts.SampleFraction)
+	if size == 0 {
+		return nil
+	}
+	var maxId bson.ObjectId
+	if !opts.MaxTime.IsZero() {
+		maxId = bson.NewObjectIdWithTime(opts.MaxTime)
+	}
+	iter := txns.Pipe([]bson.M{
+		{"$sample": bson.M{"size": size}},
+		{"$project": bson.M{"s": 1}},
+	}).Iter()
+	var doc struct {
+		Id    bson.ObjectId `bson:"_id"`
+		State TxnState      `bson:"s"`
+	}
+	prunable := 0
+	for iter.Next(&doc) {
+		estimate.TxnsSampled++
+		if doc.State >= TxnAborted && (maxId == "" || doc.Id < maxId) {
+			prunable++
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return errors.Annotate(err, "sampling transactions")
+	}
+	estimate.PrunableTxns = proportionEstimate(prunable, estimate.TxnsSampled, estimate.TxnCount)
+	return nil
+}
+
+// estimateQueueTokens samples the documents of each collection that may
+// refer to the transactions, and estimates the total number of tokens in
+// their txn-queues.
+func estimateQueueTokens(db *mgo.Database, txnsName string, opts EstimateOptions, estimate *PruneEstimate) error {
+	it, err := NewTxnCollectionIterator(db.C(txnsName), nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var variance float64
+	var name string
+	for it.Next(&name) {
+		coll := db.C(name)
+		count, err := coll.Count()
+		if err != nil {
+			it.Close()
+			return errors.Annotatef(err, "counting %q", name)
+		}
+		size := sampleSize(count, opts.SampleFraction)
+		if size == 0 {
+			continue
+		}
+		iter := coll.Pipe([]bson.M{
+			{"$sample": bson.M{"size": size}},
+			{"$project": bson.M{"tokens": bson.M{"$size": bson.M{"$ifNull": []interface{}{"$txn-queue", []interface{}{}}}}}},
+		}).Iter()
+		var doc struct {
+			Tokens int `bson:"tokens"`
+		}
+		var tokens []float64
+		for iter.Next(&doc) {
+			tokens = append(tokens, float64(doc.Tokens))
+		}
+		if err := iter.Close(); err != nil {
+			it.Close()
+			return errors.Annotatef(err, "sampling %q", name)
+		}
+		estimate.DocsSampled += len(tokens)
+		total, totalVariance := totalEstimate(tokens, count)
+		estimate.QueueTokens.Value += total
+		variance += totalVariance
+	}
+	if err := it.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	margin := confidenceZ * math.Sqrt(variance)
+	estimate.QueueTokens.Low = math.Max(0, estimate.QueueTokens.Value-margin)
+	estimate.QueueTokens.High = estimate.QueueTokens.Value + margin
+	return nil
+}
+
+// proportionEstimate estimates how many of a population of count items
+// have a property that matched of a random sample of sampled items have.
+func proportionEstimate(matched, sampled, count int) Estimate {
+	if sampled == 0 {
+		return Estimate{}
+	}
+	p := float64(matched) / float64(sampled)
+	variance := p * (1 - p) / float64(sampled) * finitePopulationCorrection(sampled, count)
+	margin := confidenceZ * math.Sqrt(variance)
+	n := float64(count)
+	return Estimate{
+		Value: p * n,
+		Low:   math.Max(0, p-margin) * n,
+		High:  math.Min(1, p+margin) * n,
+	}
+}
+
+// totalEstimate estimates the total of a value over a population of count
+// items from a random sample of their values, and the variance of that
+// estimate.
+func totalEstimate(sample []float64, count int) (float64, float64) {
+	n := len(sample)
+	if n == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range sample {
+		sum += v
+	}
+	mean := sum / float64(n)
+	if n == 1 {
+		return mean * float64(count), 0
+	}
+	var squares float64
+	for _, v := range sample {
+		squares += (v - mean) * (v - mean)
+	}
+	sampleVariance := squares / float64(n-1)
+	N := float64(count)
+	variance := N * N * sampleVariance / float64(n) * finitePopulationCorrection(n, count)
+	return mean * N, variance
+}
+
+// finitePopulationCorrection shrinks the variance of a sample of sampled
+// items from count items, as the sample covers more of them.
+func finitePopulationCorrection(sampled, count int) float64 {
+	if count <= 1 {
+		return 0
+	}
+	return float64(count-sampled) / float64(count-1)
+}
+
+// recentPruneRate returns how many transactions per second were removed by
+// the most recent prunes of txnsName, or 0 if none removed any.
+func recentPruneRate(db *mgo.Database, txnsName string) (float64, error) {
+	var records []PruneRecord
+	err := db.C(txnsPruneC(txnsName)).Find(pruneRecordMatch()).Sort("-_id").Limit(estimateHistory).All(&records)
+	if err != nil {
+		return 0, errors.Annotate(err, "reading prune history")
+	}
+	var removed int
+	var elapsed time.Duration
+	for _, record := range records {
+		if record.TxnsBefore <= record.TxnsAfter || !record.Completed.After(record.Started) {
+			continue
+		}
+		removed += record.TxnsBefore - record.TxnsAfter
+		elapsed += record.Completed.Sub(record.Started)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return float64(removed) / elapsed.Seconds(), nil
+}
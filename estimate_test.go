@@ -0,0 +1,122 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type EstimateSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&EstimateSuite{})
+
+func (s *EstimateSuite) TestInvalidFraction(c *gc.C) {
+	for _, fraction := range []float64{0, -0.5, 1.5} {
+		_, err := jujutxn.EstimatePrune(s.db, "txns", jujutxn.EstimateOptions{SampleFraction: fraction})
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+	}
+}
+
+func (s *EstimateSuite) TestWholeSampleIsExact(c *gc.C) {
+	s.runTxn(c, txn.Op{C: "coll", Id: "a", Insert: bson.M{}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "a", Update: bson.M{"$set": bson.M{"x": 1}}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "b", Insert: bson.M{}})
+	s.runInterruptedTxn(c, txn.Op{C: "coll", Id: "c", Insert: bson.M{}})
+
+	estimate, err := jujutxn.EstimatePrune(s.db, "txns", jujutxn.EstimateOptions{SampleFraction: 1})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(estimate.TxnCount, gc.Equals, 4)
+	c.Check(estimate.TxnsSampled, gc.Equals, 4)
+	c.Check(estimate.PrunableTxns, gc.Equals, jujutxn.Estimate{Value: 3, Low: 3, High: 3})
+	c.Check(estimate.QueueTokens.Value, gc.Equals, estimate.QueueTokens.Low)
+	c.Check(estimate.QueueTokens.Value, gc.Equals, estimate.QueueTokens.High)
+	c.Check(estimate.PruneRate, gc.Equals, 0.0)
+	c.Check(estimate.Runtime, gc.Equals, jujutxn.DurationEstimate{})
+}
+
+func (s *EstimateSuite) TestMaxTime(c *gc.C) {
+	s.runTxnWithTimestamp(c, nil, time.Now().Add(-2*time.Hour),
+		txn.Op{C: "coll", Id: "a", Insert: bson.M{}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "b", Insert: bson.M{}})
+
+	estimate, err := jujutxn.EstimatePrune(s.db, "txns", jujutxn.EstimateOptions{
+		SampleFraction: 1,
+		MaxTime:        time.Now().Add(-time.Hour),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(estimate.PrunableTxns.Value, gc.Equals, 1.0)
+}
+
+func (s *EstimateSuite) TestRuntimeFromHistory(c *gc.C) {
+	s.runTxn(c, txn.Op{C: "coll", Id: "a", Insert: bson.M{}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "b", Insert: bson.M{}})
+	started := time.Now().Add(-time.Hour)
+	err := s.db.C("txns.prune").Insert(bson.M{
+		"_id":         bson.NewObjectId(),
+		"started":     started,
+		"completed":   started.Add(10 * time.Second),
+		"txns-before": 1100,
+		"txns-after":  100,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	estimate, err := jujutxn.EstimatePrune(s.db, "txns", jujutxn.EstimateOptions{SampleFraction: 1})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(estimate.PruneRate, gc.Equals, 100.0)
+	c.Check(estimate.Runtime.Value, gc.Equals, 20*time.Millisecond)
+}
+
+func (s *EstimateSuite) TestProportionEstimate(c *gc.C) {
+	c.Check(jujutxn.ProportionEstimate(0, 0, 10), gc.Equals, jujutxn.Estimate{})
+	estimate := jujutxn.ProportionEstimate(50, 100, 10000)
+	c.Check(estimate.Value, gc.Equals, 5000.0)
+	// 1.96 * sqrt(0.25 / 100 * 9900 / 9999) * 10000
+	c.Check(estimate.Low, jc.GreaterThan, 4020.0)
+	c.Check(estimate.Low, jc.LessThan, 4030.0)
+	c.Check(estimate.High, jc.GreaterThan, 5970.0)
+	c.Check(estimate.High, jc.LessThan, 5980.0)
+
+	// Intervals don't go beyond what's possible.
+	estimate = jujutxn.ProportionEstimate(1, 100, 10000)
+	c.Check(estimate.Low, gc.Equals, 0.0)
+	estimate = jujutxn.ProportionEstimate(100, 100, 10000)
+	c.Check(estimate.High, gc.Equals, 10000.0)
+}
+
+func (s *EstimateSuite) TestTotalEstimate(c *gc.C) {
+	total, variance := jujutxn.TotalEstimate(nil, 10)
+	c.Check(total, gc.Equals, 0.0)
+	c.Check(variance, gc.Equals, 0.0)
+
+	total, variance = jujutxn.TotalEstimate([]float64{1, 1, 1}, 100)
+	c.Check(total, gc.Equals, 100.0)
+	c.Check(variance, gc.Equals, 0.0)
+
+	total, variance = jujutxn.TotalEstimate([]float64{1, 3}, 2)
+	c.Check(total, gc.Equals, 4.0)
+	c.Check(variance, gc.Equals, 0.0)
+
+	total, variance = jujutxn.TotalEstimate([]float64{1, 3}, 101)
+	c.Check(total, gc.Equals, 202.0)
+	// 101^2 * 2 / 2 * 99 / 100
+	c.Check(variance, jc.GreaterThan, 10098.9)
+	c.Check(variance, jc.LessThan, 10099.1)
+}
+
+func (s *EstimateSuite) TestSampleSize(c *gc.C) {
+	c.Check(jujutxn.SampleSize(0, 0.1), gc.Equals, 0)
+	c.Check(jujutxn.SampleSize(50, 0.1), gc.Equals, 50)
+	c.Check(jujutxn.SampleSize(500, 0.1), gc.Equals, 100)
+	c.Check(jujutxn.SampleSize(10001, 0.1), gc.Equals, 1001)
+}
@@ -14,13 +14,26 @@ type TxnRunner txnRunner
 // Specify the function that creates the txnRunner for testing.
 func SetRunnerFunc(r Runner, f func() TxnRunner) {
 	inner := r.(*transactionRunner)
-	inner.newRunner = func() txnRunner {
+	inner.newRunner = func(*mgo.Database) txnRunner {
 		return f()
 	}
 }
 
 var CheckMongoSupportsOut = checkMongoSupportsOut
 
+var TxnGrowthRateAt = txnGrowthRate
+
+type CollStorageStats = collStorageStats
+
+var CompactionAdviceFor = compactionAdvice
+
+type FsStats = fsStats
+
+var (
+	DiskSpaceError = diskSpaceError
+	PruneTxnLimit  = pruneTxnLimit
+)
+
 // NewDBOracleNoOut is only used for testing. It forces the DBOracle to not ask
 // mongo to populate the working set in the aggregation pipeline, which is our
 // compatibility code for older mongo versions.
@@ -35,3 +48,40 @@ func NewDBOracleNoOut(txns *mgo.Collection, thresholdTime time.Time, maxTxns int
 	cleanup, err := oracle.prepare()
 	return oracle, cleanup, err
 }
+
+// SetPruneLockTimings overrides how long a prune heartbeat lasts and how
+// often waiting pruners poll, returning a func to restore them.
+func SetPruneLockTimings(timeout, poll time.Duration) func() {
+	oldTimeout, oldPoll := pruneLockTimeout, pruneLockPollInterval
+	pruneLockTimeout, pruneLockPollInterval = timeout, poll
+	return func() {
+		pruneLockTimeout, pruneLockPollInterval = oldTimeout, oldPoll
+	}
+}
+
+type ErrorBudget = errorBudget
+
+// Charge is errorBudget.charge, for testing.
+func (b *errorBudget) Charge(err error, budget int) error {
+	return b.charge(err, budget)
+}
+
+// Estimate is PruneProgress.estimate, for testing.
+func (p *PruneProgress) Estimate(now time.Time) {
+	p.estimate(now)
+}
+
+var QueueLengthBuckets = queueLengthBuckets
+
+var (
+	ProportionEstimate = proportionEstimate
+	TotalEstimate      = totalEstimate
+	SampleSize         = sampleSize
+)
+
+var AppliedRevnos = appliedRevnos
+
+var (
+	StartDocWatcherWithPoll = startDocWatcher
+	ParseChangeLogEntry     = parseChangeLogEntry
+)
@@ -0,0 +1,114 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Features switches on behaviours that are new or risky, so that they can
+// be rolled out one deployment at a time. The zero value, as returned by
+// DefaultFeatures, has them all disabled.
+//
+// Features are passed as CleanAndPruneArgs.Features,
+// CollectionConfig.Features and RunnerParams.Features. When those are
+// nil, the other args and params are used as they are, as they were
+// before Features existed. When they are set, a behaviour that is asked
+// for by the other args or params only happens if it is also enabled
+// here.
+type Features struct {
+	// EnableParallelPrune allows CleanAndPruneArgs.Multithreaded.
+	EnableParallelPrune bool
+
+	// EnableProjectionScan allows the collection and stash cleaners to
+	// read only the _id and txn-queue of documents, rather than whole
+	// documents. When disabled, CollectionConfig.ReadWholeDocuments is
+	// forced on. The projections CleanAndPrune has always used are not
+	// affected.
+	EnableProjectionScan bool
+
+	// EnableServerTxns allows RunnerParams.ServerSideTransactions.
+	EnableServerTxns bool
+
+	// EnableBulkStashCleanup allows CleanAndPruneArgs.BulkStashCleanup.
+	EnableBulkStashCleanup bool
+
+	// EnableStripInvalidTokens allows CleanAndPruneArgs.StripInvalidTokens.
+	EnableStripInvalidTokens bool
+
+	// EnableMultiPassPrune allows CleanAndPruneArgs.MaxPasses to be more
+	// than 1.
+	EnableMultiPassPrune bool
+
+	// EnableSessionRefresh allows RunnerParams.RefreshSessionAfter.
+	EnableSessionRefresh bool
+}
+
+// DefaultFeatures returns the features that are safe for every deployment,
+// which is none of them.
+func DefaultFeatures() Features {
+	return Features{}
+}
+
+// String returns the features as "name=value" pairs, for logs and
+// support bundles.
+func (f Features) String() string {
+	var parts []string
+	for _, feature := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"parallel-prune", f.EnableParallelPrune},
+		{"projection-scan", f.EnableProjectionScan},
+		{"server-txns", f.EnableServerTxns},
+		{"bulk-stash-cleanup", f.EnableBulkStashCleanup},
+		{"strip-invalid-tokens", f.EnableStripInvalidTokens},
+		{"multi-pass-prune", f.EnableMultiPassPrune},
+		{"session-refresh", f.EnableSessionRefresh},
+	} {
+		parts = append(parts, fmt.Sprintf("%s=%t", feature.name, feature.enabled))
+	}
+	return strings.Join(parts, " ")
+}
+
+// applyToPrune turns off the behaviours in args that aren't enabled.
+func (f Features) applyToPrune(args *CleanAndPruneArgs) {
+	if !f.EnableParallelPrune && args.Multithreaded {
+		pruneLogger.Debugf("parallel-prune feature disabled, pruning with one thread")
+		args.Multithreaded = false
+	}
+	if !f.EnableBulkStashCleanup && args.BulkStashCleanup {
+		pruneLogger.Debugf("bulk-stash-cleanup feature disabled, cleaning stash documents one by one")
+		args.BulkStashCleanup = false
+	}
+	if !f.EnableStripInvalidTokens && args.StripInvalidTokens {
+		pruneLogger.Debugf("strip-invalid-tokens feature disabled, leaving invalid tokens")
+		args.StripInvalidTokens = false
+	}
+	if !f.EnableMultiPassPrune && args.MaxPasses > 1 {
+		pruneLogger.Debugf("multi-pass-prune feature disabled, pruning with a single pass")
+		args.MaxPasses = 1
+	}
+}
+
+// applyToCleaner turns off the behaviours in config that aren't enabled.
+func (f Features) applyToCleaner(config *CollectionConfig) {
+	if !f.EnableProjectionScan && !config.ReadWholeDocuments {
+		pruneLogger.Debugf("projection-scan feature disabled, cleaning with whole documents")
+		config.ReadWholeDocuments = true
+	}
+}
+
+// applyToRunner turns off the behaviours in params that aren't enabled.
+func (f Features) applyToRunner(params *RunnerParams) {
+	if !f.EnableServerTxns && params.ServerSideTransactions {
+		runnerLogger.Debugf("server-txns feature disabled, using client-side transactions")
+		params.ServerSideTransactions = false
+	}
+	if !f.EnableSessionRefresh && params.RefreshSessionAfter > 0 {
+		runnerLogger.Debugf("session-refresh feature disabled, not refreshing sessions")
+		params.RefreshSessionAfter = 0
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type FeaturesSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&FeaturesSuite{})
+
+func (*FeaturesSuite) TestString(c *gc.C) {
+	c.Check(DefaultFeatures().String(), gc.Equals,
+		"parallel-prune=false projection-scan=false server-txns=false "+
+			"bulk-stash-cleanup=false strip-invalid-tokens=false "+
+			"multi-pass-prune=false session-refresh=false")
+	features := Features{EnableParallelPrune: true, EnableServerTxns: true}
+	c.Check(features.String(), gc.Equals,
+		"parallel-prune=true projection-scan=false server-txns=true "+
+			"bulk-stash-cleanup=false strip-invalid-tokens=false "+
+			"multi-pass-prune=false session-refresh=false")
+}
+
+func (*FeaturesSuite) TestDisabledFeaturesTurnOffArgs(c *gc.C) {
+	args := CleanAndPruneArgs{
+		Multithreaded:      true,
+		BulkStashCleanup:   true,
+		StripInvalidTokens: true,
+		MaxPasses:          5,
+		Features:           &Features{},
+	}
+	c.Assert(args.validateSettings(), jc.ErrorIsNil)
+	c.Check(args.Multithreaded, jc.IsFalse)
+	c.Check(args.BulkStashCleanup, jc.IsFalse)
+	c.Check(args.StripInvalidTokens, jc.IsFalse)
+	c.Check(args.MaxPasses, gc.Equals, 1)
+	// The pruner's own projections aren't gated.
+	c.Check(args.ReadWholeDocuments, jc.IsFalse)
+
+	cleaner := NewCollectionCleaner(CollectionConfig{Features: &Features{}})
+	c.Check(cleaner.config.ReadWholeDocuments, jc.IsTrue)
+	cleaner = NewStashCleaner(CollectionConfig{Features: &Features{}})
+	c.Check(cleaner.config.ReadWholeDocuments, jc.IsTrue)
+
+	params := RunnerParams{ServerSideTransactions: true, RefreshSessionAfter: 2}
+	DefaultFeatures().applyToRunner(&params)
+	c.Check(params.ServerSideTransactions, jc.IsFalse)
+	c.Check(params.RefreshSessionAfter, gc.Equals, 0)
+}
+
+func (*FeaturesSuite) TestEnabledFeaturesKeepArgs(c *gc.C) {
+	args := CleanAndPruneArgs{
+		Multithreaded:    true,
+		BulkStashCleanup: true,
+		MaxPasses:        5,
+		Features: &Features{
+			EnableParallelPrune:    true,
+			EnableProjectionScan:   true,
+			EnableBulkStashCleanup: true,
+			EnableMultiPassPrune:   true,
+		},
+	}
+	c.Assert(args.validateSettings(), jc.ErrorIsNil)
+	c.Check(args.Multithreaded, jc.IsTrue)
+	c.Check(args.BulkStashCleanup, jc.IsTrue)
+	c.Check(args.MaxPasses, gc.Equals, 5)
+	c.Check(args.ReadWholeDocuments, jc.IsFalse)
+
+	cleaner := NewCollectionCleaner(CollectionConfig{
+		Features: &Features{EnableProjectionScan: true},
+	})
+	c.Check(cleaner.config.ReadWholeDocuments, jc.IsFalse)
+
+	params := RunnerParams{RefreshSessionAfter: 2}
+	Features{EnableSessionRefresh: true}.applyToRunner(&params)
+	c.Check(params.RefreshSessionAfter, gc.Equals, 2)
+}
+
+func (*FeaturesSuite) TestNilFeaturesKeepArgs(c *gc.C) {
+	args := CleanAndPruneArgs{Multithreaded: true}
+	c.Assert(args.validateSettings(), jc.ErrorIsNil)
+	c.Check(args.Multithreaded, jc.IsTrue)
+	c.Check(args.ReadWholeDocuments, jc.IsFalse)
+
+	cleaner := NewCollectionCleaner(CollectionConfig{})
+	c.Check(cleaner.config.ReadWholeDocuments, jc.IsFalse)
+}
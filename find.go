@@ -0,0 +1,233 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+)
+
+// defaultFindLimit is the page size used by FindTransactions when the
+// filter doesn't set one.
+const defaultFindLimit = 100
+
+// TxnFilter selects the transactions returned by FindTransactions. Zero
+// valued fields match every transaction.
+type TxnFilter struct {
+	// Collection matches transactions with an operation on this
+	// collection.
+	Collection string
+
+	// DocId matches transactions with an operation on a document with
+	// this id. If Collection is also set, the operation must be on that
+	// collection.
+	DocId interface{}
+
+	// Label matches transactions whose TxnMetadata has this value as
+	// its Caller, ModelUUID or RequestId.
+	Label string
+
+	// From and To restrict the transactions to those created in the
+	// range [From, To), based on the time embedded in the transaction id.
+	From time.Time
+	To   time.Time
+
+	// State matches transactions in this state.
+	State TxnState
+
+	// After, if set, only returns transactions with an id greater than
+	// this. Pass the Next value of the previous page to get the next one.
+	After bson.ObjectId
+
+	// Limit is the maximum number of transactions to return. It defaults
+	// to 100.
+	Limit int
+}
+
+// TxnPage is a page of transactions returned by FindTransactions.
+type TxnPage struct {
+	// Txns are the matching transactions, in id order.
+	Txns []*TxnDoc
+
+	// Next is the id to use as TxnFilter.After to read the next page. It
+	// is empty if there are no more transactions.
+	Next bson.ObjectId
+}
+
+// query returns the mongo query for the filter.
+func (f TxnFilter) query() bson.D {
+	var query bson.D
+	idRange := bson.D{}
+	if f.After != "" {
+		idRange = append(idRange, bson.DocElem{"$gt", f.After})
+	}
+	if !f.From.IsZero() {
+		idRange = append(idRange, bson.DocElem{"$gte", bson.NewObjectIdWithTime(f.From)})
+	}
+	if !f.To.IsZero() {
+		idRange = append(idRange, bson.DocElem{"$lt", bson.NewObjectIdWithTime(f.To)})
+	}
+	if len(idRange) > 0 {
+		query = append(query, bson.DocElem{"_id", idRange})
+	}
+	switch {
+	case f.Collection != "" && f.DocId != nil:
+		query = append(query, bson.DocElem{"o", bson.M{"$elemMatch": bson.D{{"c", f.Collection}, {"d", f.DocId}}}})
+	case f.Collection != "":
+		query = append(query, bson.DocElem{"o.c", f.Collection})
+	case f.DocId != nil:
+		query = append(query, bson.DocElem{"o.d", f.DocId})
+	}
+	if f.Label != "" {
+		query = append(query, bson.DocElem{"$or", []bson.M{
+			{"i.caller": f.Label},
+			{"i.model-uuid": f.Label},
+			{"i.request-id": f.Label},
+		}})
+	}
+	if f.State != 0 {
+		query = append(query, bson.DocElem{"s", f.State})
+	}
+	return query
+}
+
+// FindTransactions returns a page of the transactions in txnsName that
+// match filter, in id order. Transactions are decoded leniently, so any
+// that don't match the mgo/txn schema are returned with their Problems
+// set rather than causing an error.
+func FindTransactions(db *mgo.Database, txnsName string, filter TxnFilter) (TxnPage, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultFindLimit
+	}
+	var page TxnPage
+	// Read one more than we need to find out if there is another page.
+	iter := db.C(txnsName).Find(filter.query()).Sort("_id").Limit(limit + 1).Iter()
+	var raw bson.Raw
+	for iter.Next(&raw) {
+		if len(page.Txns) == limit {
+			page.Next = page.Txns[limit-1].Id
+			break
+		}
+		page.Txns = append(page.Txns, DecodeTxnLenient(raw))
+	}
+	if err := iter.Close(); err != nil {
+		return TxnPage{}, errors.Trace(err)
+	}
+	return page, nil
+}
+
+// DocChange is a transaction in the history of a document.
+type DocChange struct {
+	// Txn is the transaction.
+	Txn *TxnDoc
+
+	// Ops are the operations of the transaction on the document.
+	Ops []txn.Op
+
+	// Archived is true if the transaction was read from an archive
+	// rather than the txns collection.
+	Archived bool
+}
+
+// Time returns when the transaction was created.
+func (c DocChange) Time() time.Time {
+	return c.Txn.Id.Time()
+}
+
+// DocHistory returns the transactions with operations on the document
+// docId in collection, oldest first. Live transactions are read from
+// txnsName in db, and pruned ones from archives, which must have been
+// written by an ArchiveWriter (see IncrementalPruneArgs.Archive). Either
+// db or archives may be nil. A transaction that is both archived and
+// still live is only returned once.
+//
+// Transactions in every state are returned, so check Txn.State to tell
+// the changes that were applied from those that were aborted.
+func DocHistory(
+	db *mgo.Database,
+	txnsName string,
+	archives []io.Reader,
+	collection string,
+	docId interface{},
+) ([]DocChange, error) {
+	var key struct {
+		Id bson.Raw `bson:"_id"`
+	}
+	data, err := bson.Marshal(bson.D{{"_id", docId}})
+	if err == nil {
+		err = bson.Unmarshal(data, &key)
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "encoding document id %v", docId)
+	}
+	changes := make(map[bson.ObjectId]DocChange)
+	add := func(doc *TxnDoc, archived bool) {
+		// Compare the encoded ids, as mgo/txn and mongo do, so that ids
+		// which don't survive a decode and re-encode (such as bson.D
+		// documents) still match.
+		var ops []txn.Op
+		for i, op := range doc.Ops {
+			if op.C != collection || i >= len(doc.opIds) {
+				continue
+			}
+			opId := doc.opIds[i]
+			if opId.Kind == key.Id.Kind && bytes.Equal(opId.Data, key.Id.Data) {
+				ops = append(ops, op)
+			}
+		}
+		if len(ops) > 0 {
+			changes[doc.Id] = DocChange{Txn: doc, Ops: ops, Archived: archived}
+		}
+	}
+	for i, archive := range archives {
+		r, err := NewArchiveReader(archive)
+		if err != nil {
+			return nil, errors.Annotatef(err, "reading archive %d", i)
+		}
+		var raw bson.Raw
+		for r.Next(&raw) {
+			// Archives may also hold prune records, which aren't
+			// transactions; skip anything that doesn't decode.
+			if doc, err := DecodeTxn(raw); err == nil {
+				add(doc, true)
+			}
+		}
+		r.Close()
+		if err := r.Err(); err != nil {
+			return nil, errors.Annotatef(err, "reading archive %d", i)
+		}
+	}
+	if db != nil {
+		filter := TxnFilter{Collection: collection, DocId: docId}
+		for {
+			page, err := FindTransactions(db, txnsName, filter)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			for _, doc := range page.Txns {
+				add(doc, false)
+			}
+			if page.Next == "" {
+				break
+			}
+			filter.After = page.Next
+		}
+	}
+	history := make([]DocChange, 0, len(changes))
+	for _, change := range changes {
+		history = append(history, change)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Txn.Id < history[j].Txn.Id
+	})
+	return history, nil
+}
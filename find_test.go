@@ -0,0 +1,195 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type FindTransactionsSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&FindTransactionsSuite{})
+
+func txnIds(page jujutxn.TxnPage) []bson.ObjectId {
+	ids := make([]bson.ObjectId, len(page.Txns))
+	for i, doc := range page.Txns {
+		ids[i] = doc.Id
+	}
+	return ids
+}
+
+func (s *FindTransactionsSuite) TestFilters(c *gc.C) {
+	base := time.Now().Add(-time.Hour)
+	txn1 := s.runTxnWithTimestamp(c, nil, base, txn.Op{
+		C:      "coll",
+		Id:     "a",
+		Insert: bson.M{},
+	})
+	txn2 := s.runTxnWithTimestamp(c, nil, base.Add(time.Minute), txn.Op{
+		C:      "other",
+		Id:     "a",
+		Insert: bson.M{},
+	})
+	txn3 := s.runTxnWithTimestamp(c, nil, base.Add(2*time.Minute), txn.Op{
+		C:      "coll",
+		Id:     "b",
+		Insert: bson.M{},
+	})
+	txn4 := bson.NewObjectIdWithTime(base.Add(3 * time.Minute))
+	err := s.runner.Run([]txn.Op{{
+		C:      "coll",
+		Id:     "a",
+		Assert: txn.DocMissing,
+	}}, txn4, jujutxn.TxnMetadata{Caller: "tester", RequestId: "req-1"})
+	c.Assert(err, gc.Equals, txn.ErrAborted)
+
+	for i, test := range []struct {
+		filter   jujutxn.TxnFilter
+		expected []bson.ObjectId
+	}{{
+		filter:   jujutxn.TxnFilter{},
+		expected: []bson.ObjectId{txn1, txn2, txn3, txn4},
+	}, {
+		filter:   jujutxn.TxnFilter{Collection: "coll"},
+		expected: []bson.ObjectId{txn1, txn3, txn4},
+	}, {
+		filter:   jujutxn.TxnFilter{DocId: "a"},
+		expected: []bson.ObjectId{txn1, txn2, txn4},
+	}, {
+		filter:   jujutxn.TxnFilter{Collection: "other", DocId: "a"},
+		expected: []bson.ObjectId{txn2},
+	}, {
+		filter:   jujutxn.TxnFilter{Collection: "other", DocId: "b"},
+		expected: nil,
+	}, {
+		filter:   jujutxn.TxnFilter{Label: "req-1"},
+		expected: []bson.ObjectId{txn4},
+	}, {
+		filter:   jujutxn.TxnFilter{State: jujutxn.TxnAborted},
+		expected: []bson.ObjectId{txn4},
+	}, {
+		filter:   jujutxn.TxnFilter{From: base.Add(time.Minute), To: base.Add(3 * time.Minute)},
+		expected: []bson.ObjectId{txn2, txn3},
+	}} {
+		c.Logf("test %d: %+v", i, test.filter)
+		page, err := jujutxn.FindTransactions(s.db, "txns", test.filter)
+		c.Assert(err, jc.ErrorIsNil)
+		checkTxnIds(c, test.expected, txnIds(page))
+		c.Check(page.Next, gc.Equals, bson.ObjectId(""))
+	}
+}
+
+func (s *FindTransactionsSuite) TestDecodesTransactions(c *gc.C) {
+	id := s.runTxn(c, txn.Op{
+		C:      "coll",
+		Id:     "a",
+		Insert: bson.M{"name": "a"},
+	})
+	page, err := jujutxn.FindTransactions(s.db, "txns", jujutxn.TxnFilter{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(page.Txns, gc.HasLen, 1)
+	doc := page.Txns[0]
+	c.Check(doc.Id, gc.Equals, id)
+	c.Check(doc.State, gc.Equals, jujutxn.TxnApplied)
+	c.Check(doc.Ops, jc.DeepEquals, []txn.Op{{
+		C:      "coll",
+		Id:     "a",
+		Insert: bson.M{"name": "a"},
+	}})
+	c.Check(doc.Problems, gc.HasLen, 0)
+}
+
+func (s *FindTransactionsSuite) TestPagination(c *gc.C) {
+	var ids []bson.ObjectId
+	for i := 0; i < 5; i++ {
+		ids = append(ids, s.runTxn(c, txn.Op{
+			C:      "coll",
+			Id:     i,
+			Insert: bson.M{},
+		}))
+	}
+	filter := jujutxn.TxnFilter{Limit: 2}
+	var pages [][]bson.ObjectId
+	for {
+		page, err := jujutxn.FindTransactions(s.db, "txns", filter)
+		c.Assert(err, jc.ErrorIsNil)
+		pages = append(pages, txnIds(page))
+		if page.Next == "" {
+			break
+		}
+		filter.After = page.Next
+	}
+	c.Check(pages, jc.DeepEquals, [][]bson.ObjectId{ids[0:2], ids[2:4], ids[4:5]})
+}
+
+func (s *FindTransactionsSuite) TestDocHistory(c *gc.C) {
+	txn1 := s.runTxn(c, txn.Op{C: "coll", Id: "a", Insert: bson.M{"x": 1}})
+	txn2 := s.runTxn(c, txn.Op{C: "coll", Id: "a", Update: bson.M{"$set": bson.M{"x": 2}}})
+
+	var buf bytes.Buffer
+	archive, err := jujutxn.NewArchiveWriter(&buf, jujutxn.ArchiveOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{Txns: s.txns, Archive: archive})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(archive.Close(), jc.ErrorIsNil)
+	s.assertCollCount(c, "txns", 0)
+
+	txn3 := s.runTxn(c,
+		txn.Op{C: "coll", Id: "b", Insert: bson.M{}},
+		txn.Op{C: "coll", Id: "a", Update: bson.M{"$set": bson.M{"x": 3}}},
+	)
+	s.runTxn(c, txn.Op{C: "other", Id: "a", Insert: bson.M{}})
+
+	history, err := jujutxn.DocHistory(s.db, "txns", []io.Reader{&buf}, "coll", "a")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.HasLen, 3)
+	for i, expected := range []bson.ObjectId{txn1, txn2, txn3} {
+		c.Check(history[i].Txn.Id, gc.Equals, expected)
+		c.Check(history[i].Archived, gc.Equals, i < 2)
+		c.Assert(history[i].Ops, gc.HasLen, 1)
+		c.Check(history[i].Ops[0].Id, gc.Equals, "a")
+	}
+	c.Check(history[2].Ops[0].Update, gc.NotNil)
+
+	// Without the archive only the live transaction is found.
+	history, err = jujutxn.DocHistory(s.db, "txns", nil, "coll", "a")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.HasLen, 1)
+	c.Check(history[0].Txn.Id, gc.Equals, txn3)
+}
+
+func (s *FindTransactionsSuite) TestDocHistoryDocumentId(c *gc.C) {
+	id := bson.D{{"a", 1}, {"b", 2}}
+	txn1 := s.runTxn(c, txn.Op{C: "coll", Id: id, Insert: bson.M{"x": 1}})
+
+	var buf bytes.Buffer
+	archive, err := jujutxn.NewArchiveWriter(&buf, jujutxn.ArchiveOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{Txns: s.txns, Archive: archive})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(archive.Close(), jc.ErrorIsNil)
+
+	txn2 := s.runTxn(c, txn.Op{C: "coll", Id: id, Update: bson.M{"$set": bson.M{"x": 2}}})
+	// The same fields in a different order are a different document.
+	s.runTxn(c, txn.Op{C: "coll", Id: bson.D{{"b", 2}, {"a", 1}}, Insert: bson.M{}})
+
+	history, err := jujutxn.DocHistory(s.db, "txns", []io.Reader{&buf}, "coll", id)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.HasLen, 2)
+	c.Check(history[0].Txn.Id, gc.Equals, txn1)
+	c.Check(history[0].Archived, jc.IsTrue)
+	c.Check(history[1].Txn.Id, gc.Equals, txn2)
+	c.Check(history[1].Archived, jc.IsFalse)
+}
@@ -0,0 +1,218 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+)
+
+// maxFormatValueLen is the most characters of an id or asserted value
+// that FormatOps shows.
+const maxFormatValueLen = 40
+
+// FormatOps returns a readable, multi-line description of ops, with the
+// collection, id and action of each op and a summary of its assert and
+// its update or inserted document. Asserted values are shortened, and only
+// the fields of updates and inserts are shown, so that large transactions
+// stay readable.
+func FormatOps(ops []txn.Op) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d ops:", len(ops))
+	for i, op := range ops {
+		writeOp(&b, i, op, -1)
+	}
+	return b.String()
+}
+
+// FormatTxn returns a readable, multi-line description of a transaction
+// document, with its state, metadata and ops (see FormatOps).
+func FormatTxn(doc *TxnDoc) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "txn %s: %s, created %s", doc.Id.Hex(), doc.State, doc.Id.Time().UTC().Format(time.RFC3339))
+	if doc.Nonce != "" {
+		fmt.Fprintf(&b, ", nonce %s", doc.Nonce)
+	}
+	if doc.Metadata != nil {
+		fmt.Fprintf(&b, "\n  metadata: %s", formatMetadata(doc.Metadata))
+	} else if doc.Info != nil {
+		fmt.Fprintf(&b, "\n  info: %s", formatValue(doc.Info))
+	}
+	for _, problem := range doc.Problems {
+		fmt.Fprintf(&b, "\n  problem: %s", problem)
+	}
+	fmt.Fprintf(&b, "\n  %d ops:", len(doc.Ops))
+	for i, op := range doc.Ops {
+		revno := int64(-1)
+		if i < len(doc.Revnos) {
+			revno = doc.Revnos[i]
+		}
+		writeOp(&b, i, op, revno)
+	}
+	return b.String()
+}
+
+// writeOp writes the description of the op at index i, and its revno if
+// it isn't negative.
+func writeOp(b *strings.Builder, i int, op txn.Op, revno int64) {
+	fmt.Fprintf(b, "\n  %d: %s %s %s", i, opAction(op), op.C, formatValue(op.Id))
+	if revno >= 0 {
+		fmt.Fprintf(b, " (revno %d)", revno)
+	}
+	if op.Assert != nil {
+		fmt.Fprintf(b, "\n       assert: %s", formatAssert(op.Assert))
+	}
+	switch {
+	case op.Insert != nil:
+		fmt.Fprintf(b, "\n       fields: %s", strings.Join(fieldNames(op.Insert), ", "))
+	case op.Update != nil:
+		fmt.Fprintf(b, "\n       update: %s", formatUpdate(op.Update))
+	}
+}
+
+func opAction(op txn.Op) string {
+	switch {
+	case op.Insert != nil:
+		return "insert"
+	case op.Remove:
+		return "remove"
+	case op.Update != nil:
+		return "update"
+	}
+	return "assert"
+}
+
+func formatAssert(assert interface{}) string {
+	switch assert {
+	case txn.DocExists:
+		return "doc exists"
+	case txn.DocMissing:
+		return "doc missing"
+	}
+	doc, ok := asD(assert)
+	if !ok {
+		return formatValue(assert)
+	}
+	parts := make([]string, len(doc))
+	for i, elem := range doc {
+		parts[i] = elem.Name + "=" + formatValue(elem.Value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatUpdate summarises an update as its operators and the fields each
+// changes, or as the fields of a replacement document.
+func formatUpdate(update interface{}) string {
+	doc, ok := asD(update)
+	if !ok {
+		return formatValue(update)
+	}
+	var parts []string
+	for _, elem := range doc {
+		if !strings.HasPrefix(elem.Name, "$") {
+			return "replace with " + strings.Join(fieldNames(update), ", ")
+		}
+		parts = append(parts, fmt.Sprintf("%s(%s)", elem.Name, strings.Join(fieldNames(elem.Value), ", ")))
+	}
+	return strings.Join(parts, " ")
+}
+
+// fieldNames returns the names of the fields of a document.
+func fieldNames(v interface{}) []string {
+	doc, ok := asD(v)
+	if !ok {
+		return []string{formatValue(v)}
+	}
+	names := make([]string, len(doc))
+	for i, elem := range doc {
+		names[i] = elem.Name
+	}
+	return names
+}
+
+// asD returns v as a bson.D, with the fields of maps sorted so that the
+// output is stable.
+func asD(v interface{}) (bson.D, bool) {
+	switch doc := v.(type) {
+	case bson.D:
+		return doc, true
+	case bson.M:
+		return sortedD(doc), true
+	case map[string]interface{}:
+		return sortedD(doc), true
+	case time.Time:
+		return nil, false
+	}
+	kind := reflect.Indirect(reflect.ValueOf(v)).Kind()
+	if kind != reflect.Struct && kind != reflect.Map {
+		return nil, false
+	}
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, false
+	}
+	if kind == reflect.Map {
+		sort.Slice(doc, func(i, j int) bool { return doc[i].Name < doc[j].Name })
+	}
+	return doc, true
+}
+
+func sortedD(m map[string]interface{}) bson.D {
+	doc := make(bson.D, 0, len(m))
+	for name, value := range m {
+		doc = append(doc, bson.DocElem{Name: name, Value: value})
+	}
+	sort.Slice(doc, func(i, j int) bool { return doc[i].Name < doc[j].Name })
+	return doc
+}
+
+// formatValue formats a value on one line, shortened to maxFormatValueLen.
+func formatValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = fmt.Sprintf("%q", v)
+	case bson.ObjectId:
+		s = v.Hex()
+	case bson.D:
+		parts := make([]string, len(v))
+		for i, elem := range v {
+			parts[i] = elem.Name + ": " + formatValue(elem.Value)
+		}
+		s = "{" + strings.Join(parts, ", ") + "}"
+	default:
+		if doc, ok := asD(v); ok {
+			return formatValue(doc)
+		}
+		s = fmt.Sprintf("%v", v)
+	}
+	if len(s) > maxFormatValueLen {
+		s = s[:maxFormatValueLen-3] + "..."
+	}
+	return s
+}
+
+func formatMetadata(m *TxnMetadata) string {
+	var parts []string
+	for _, field := range []struct{ name, value string }{
+		{"caller", m.Caller},
+		{"model", m.ModelUUID},
+		{"request", m.RequestId},
+	} {
+		if field.value != "" {
+			parts = append(parts, field.name+" "+field.value)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
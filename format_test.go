@@ -0,0 +1,82 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"strings"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type FormatSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&FormatSuite{})
+
+type formatDoc struct {
+	Name string `bson:"name"`
+	Life int    `bson:"life"`
+}
+
+func (*FormatSuite) TestFormatOps(c *gc.C) {
+	ops := []txn.Op{{
+		C:      "machines",
+		Id:     "0",
+		Assert: bson.D{{"life", 0}, {"series", strings.Repeat("x", 50)}},
+		Update: bson.M{"$set": bson.M{"life": 1, "jobs": nil}, "$inc": bson.M{"n": 1}},
+	}, {
+		C:      "units",
+		Id:     "u/0",
+		Assert: txn.DocMissing,
+		Insert: &formatDoc{Name: "u/0"},
+	}, {
+		C:      "settings",
+		Id:     bson.D{{"c", "units"}, {"id", 1}},
+		Assert: txn.DocExists,
+		Remove: true,
+	}, {
+		C:      "models",
+		Id:     "m",
+		Assert: bson.M{"life": 0},
+	}, {
+		C:      "annotations",
+		Id:     1,
+		Update: formatDoc{Name: "a"},
+	}}
+	c.Check(FormatOps(ops), gc.Equals, `5 ops:
+  0: update machines "0"
+       assert: life=0, series="xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx...
+       update: $inc(n) $set(jobs, life)
+  1: insert units "u/0"
+       assert: doc missing
+       fields: name, life
+  2: remove settings {c: "units", id: 1}
+       assert: doc exists
+  3: assert models "m"
+       assert: life=0
+  4: update annotations 1
+       update: replace with name, life`)
+}
+
+func (*FormatSuite) TestFormatTxn(c *gc.C) {
+	id := bson.ObjectIdHex("5f0000000000000000000001")
+	doc := &TxnDoc{
+		Id:       id,
+		State:    TxnApplied,
+		Metadata: &TxnMetadata{Caller: "provisioner", RequestId: "42"},
+		Nonce:    "abcdef01",
+		Ops:      []txn.Op{{C: "machines", Id: "0", Remove: true}},
+		Revnos:   []int64{3},
+		Problems: []string{"unknown field \"x\""},
+	}
+	c.Check(FormatTxn(doc), gc.Equals, `txn 5f0000000000000000000001: applied, created 2020-07-04T04:05:20Z, nonce abcdef01
+  metadata: caller provisioner, request 42
+  problem: unknown field "x"
+  1 ops:
+  0: remove machines "0" (revno 3)`)
+}
@@ -0,0 +1,119 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"math"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+)
+
+// GrowthEstimate is an estimate of how quickly the txns collection is
+// growing, returned by TxnGrowthRate.
+type GrowthEstimate struct {
+	// TxnsPerHour is the average number of transactions added per hour
+	// over the window, excluding the time spent pruning.
+	TxnsPerHour float64
+
+	// Samples is the number of intervals between prunes, including the
+	// interval since the last prune, that the estimate is based on.
+	Samples int
+
+	// CurrentCount is the number of transactions now.
+	CurrentCount int
+
+	// LastPruneCount is the number of transactions left after the last
+	// prune, or -1 if there has never been a prune.
+	LastPruneCount int
+}
+
+// NextPrune predicts how long it will be before MaybePruneTransactions,
+// called with opts, decides to prune. It returns false if that can't be
+// predicted because the collection isn't growing.
+func (e GrowthEstimate) NextPrune(opts PruneOptions) (time.Duration, bool) {
+	validatePruneOptions(&opts)
+	if e.LastPruneCount < 0 {
+		return 0, true
+	}
+	trigger := pruneTriggerCount(e.LastPruneCount, opts)
+	remaining := trigger - e.CurrentCount
+	if remaining <= 0 {
+		return 0, true
+	}
+	if e.TxnsPerHour <= 0 {
+		return 0, false
+	}
+	hours := float64(remaining) / e.TxnsPerHour
+	return time.Duration(hours * float64(time.Hour)), true
+}
+
+// pruneTriggerCount returns the smallest transaction count at which
+// shouldPrune will decide to prune, given the count after the last prune.
+func pruneTriggerCount(oldCount int, opts PruneOptions) int {
+	factored := int(math.Ceil(float64(float32(oldCount) * opts.PruneFactor)))
+	trigger := oldCount + opts.MaxNewTransactions + 1
+	if factored < trigger {
+		trigger = factored
+	}
+	if minimum := oldCount + opts.MinNewTransactions; trigger < minimum {
+		trigger = minimum
+	}
+	return trigger
+}
+
+// TxnGrowthRate estimates how quickly the txnsName collection has been
+// growing over the last window, using the prune history and the current
+// number of transactions. Growth is measured between the end of one prune
+// and the start of the next, so that transactions removed by pruning
+// don't count against it.
+func TxnGrowthRate(db *mgo.Database, txnsName string, window time.Duration) (GrowthEstimate, error) {
+	return txnGrowthRate(db, txnsName, window, time.Now())
+}
+
+func txnGrowthRate(db *mgo.Database, txnsName string, window time.Duration, now time.Time) (GrowthEstimate, error) {
+	estimate := GrowthEstimate{LastPruneCount: -1}
+	count, err := db.C(txnsName).Count()
+	if err != nil {
+		return estimate, errors.Annotate(err, "counting transactions")
+	}
+	estimate.CurrentCount = count
+	history, err := PruneHistory(db, txnsName)
+	if err != nil {
+		return estimate, errors.Trace(err)
+	}
+	if len(history) == 0 {
+		return estimate, nil
+	}
+	last := history[len(history)-1]
+	estimate.LastPruneCount = last.TxnsAfter
+
+	cutoff := now.Add(-window)
+	var growth float64
+	var elapsed time.Duration
+	addInterval := func(start, end time.Time, before, after int) {
+		if !end.After(cutoff) || !end.After(start) {
+			return
+		}
+		added := float64(after - before)
+		if start.Before(cutoff) {
+			// Only count the part of the interval inside the window.
+			added *= float64(end.Sub(cutoff)) / float64(end.Sub(start))
+			start = cutoff
+		}
+		growth += added
+		elapsed += end.Sub(start)
+		estimate.Samples++
+	}
+	for i := 1; i < len(history); i++ {
+		prev, next := history[i-1], history[i]
+		addInterval(prev.Completed, next.Started, prev.TxnsAfter, next.TxnsBefore)
+	}
+	addInterval(last.Completed, now, last.TxnsAfter, count)
+	if elapsed > 0 {
+		estimate.TxnsPerHour = growth / elapsed.Hours()
+	}
+	return estimate, nil
+}
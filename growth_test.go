@@ -0,0 +1,132 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type TxnGrowthRateSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&TxnGrowthRateSuite{})
+
+func (s *TxnGrowthRateSuite) addPruneRecord(c *gc.C, started, completed time.Time, before, after int) {
+	id := bson.NewObjectIdWithTime(started)
+	err := s.db.C("txns.prune").Insert(jujutxn.PruneRecord{
+		Id:         id,
+		Started:    started,
+		Completed:  completed,
+		TxnsBefore: before,
+		TxnsAfter:  after,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.db.C("txns.prune").UpsertId("last", bson.M{"$set": bson.M{"id": id}})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *TxnGrowthRateSuite) addTxns(c *gc.C, count int) {
+	for i := 0; i < count; i++ {
+		s.runTxn(c, txn.Op{
+			C:      "coll",
+			Id:     i,
+			Insert: bson.M{},
+		})
+	}
+}
+
+func (s *TxnGrowthRateSuite) TestNoHistory(c *gc.C) {
+	s.addTxns(c, 3)
+	estimate, err := jujutxn.TxnGrowthRate(s.db, "txns", time.Hour)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(estimate, jc.DeepEquals, jujutxn.GrowthEstimate{
+		CurrentCount:   3,
+		LastPruneCount: -1,
+	})
+	next, ok := estimate.NextPrune(jujutxn.PruneOptions{})
+	c.Check(ok, jc.IsTrue)
+	c.Check(next, gc.Equals, time.Duration(0))
+}
+
+func (s *TxnGrowthRateSuite) TestGrowthBetweenPrunes(c *gc.C) {
+	now := time.Now().Truncate(time.Second)
+	s.addPruneRecord(c, now.Add(-5*time.Hour), now.Add(-4*time.Hour), 100, 0)
+	s.addPruneRecord(c, now.Add(-3*time.Hour), now.Add(-2*time.Hour), 20, 0)
+	s.addTxns(c, 10)
+	// 20 txns in the hour between prunes, 10 in the 2 hours since.
+	estimate, err := jujutxn.TxnGrowthRateAt(s.db, "txns", 24*time.Hour, now)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(estimate, jc.DeepEquals, jujutxn.GrowthEstimate{
+		TxnsPerHour:    10,
+		Samples:        2,
+		CurrentCount:   10,
+		LastPruneCount: 0,
+	})
+	// Only half of the first interval is in the window.
+	estimate, err = jujutxn.TxnGrowthRateAt(s.db, "txns", 210*time.Minute, now)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(estimate.TxnsPerHour, gc.Equals, 8.0)
+	c.Check(estimate.Samples, gc.Equals, 2)
+	// The first interval is entirely outside the window.
+	estimate, err = jujutxn.TxnGrowthRateAt(s.db, "txns", 150*time.Minute, now)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(estimate.TxnsPerHour, gc.Equals, 5.0)
+	c.Check(estimate.Samples, gc.Equals, 1)
+}
+
+type GrowthEstimateSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&GrowthEstimateSuite{})
+
+func (*GrowthEstimateSuite) TestNextPrune(c *gc.C) {
+	opts := jujutxn.PruneOptions{
+		PruneFactor:        2.0,
+		MinNewTransactions: 100,
+		MaxNewTransactions: 10000,
+	}
+	for i, test := range []struct {
+		estimate jujutxn.GrowthEstimate
+		expected time.Duration
+		ok       bool
+	}{{
+		// Needs 1000 more to double.
+		estimate: jujutxn.GrowthEstimate{TxnsPerHour: 500, CurrentCount: 1000, LastPruneCount: 1000},
+		expected: 2 * time.Hour,
+		ok:       true,
+	}, {
+		// Needs MinNewTransactions even though it has doubled.
+		estimate: jujutxn.GrowthEstimate{TxnsPerHour: 100, CurrentCount: 20, LastPruneCount: 10},
+		expected: 54 * time.Minute,
+		ok:       true,
+	}, {
+		// MaxNewTransactions triggers before doubling.
+		estimate: jujutxn.GrowthEstimate{TxnsPerHour: 10001, CurrentCount: 50000, LastPruneCount: 50000},
+		expected: time.Hour,
+		ok:       true,
+	}, {
+		estimate: jujutxn.GrowthEstimate{TxnsPerHour: 10, CurrentCount: 5000, LastPruneCount: 1000},
+		expected: 0,
+		ok:       true,
+	}, {
+		estimate: jujutxn.GrowthEstimate{TxnsPerHour: 0, CurrentCount: 1000, LastPruneCount: 1000},
+		expected: 0,
+		ok:       false,
+	}} {
+		c.Logf("test %d", i)
+		next, ok := test.estimate.NextPrune(opts)
+		c.Check(ok, gc.Equals, test.ok)
+		c.Check(next, gc.Equals, test.expected)
+	}
+}
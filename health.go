@@ -0,0 +1,287 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// HealthStatus is how healthy one aspect of the transactions is.
+type HealthStatus int
+
+const (
+	HealthOK       HealthStatus = iota // Nothing to worry about
+	HealthWarn                         // Needs attention soon
+	HealthCritical                     // Needs attention now
+)
+
+var healthStatusNames = map[HealthStatus]string{
+	HealthOK:       "ok",
+	HealthWarn:     "warn",
+	HealthCritical: "critical",
+}
+
+// String returns the name of the status.
+func (s HealthStatus) String() string {
+	if name, ok := healthStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// MarshalText is part of encoding.TextMarshaler, so that the status
+// appears by name in JSON.
+func (s HealthStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// HealthDimension names one of the aspects of the transactions that is
+// scored by TxnHealth.
+type HealthDimension string
+
+const (
+	// HealthTxnsBacklog is the number of transactions in the txns
+	// collection.
+	HealthTxnsBacklog HealthDimension = "txns-backlog"
+
+	// HealthStashSize is the number of documents in txns.stash.
+	HealthStashSize HealthDimension = "stash-size"
+
+	// HealthQueueDepth is the length of the longest txn-queue.
+	HealthQueueDepth HealthDimension = "queue-depth"
+
+	// HealthOldestPending is the age of the oldest pending transaction.
+	HealthOldestPending HealthDimension = "oldest-pending"
+
+	// HealthLastPrune is how long ago the transactions were last pruned.
+	HealthLastPrune HealthDimension = "last-prune"
+)
+
+// CountLimits are the counts at which a dimension becomes a warning or
+// critical. A limit of 0 is never reached.
+type CountLimits struct {
+	Warn     int
+	Critical int
+}
+
+func (l CountLimits) status(n int) HealthStatus {
+	switch {
+	case l.Critical > 0 && n >= l.Critical:
+		return HealthCritical
+	case l.Warn > 0 && n >= l.Warn:
+		return HealthWarn
+	}
+	return HealthOK
+}
+
+// AgeLimits are the ages at which a dimension becomes a warning or
+// critical. A limit of 0 is never reached.
+type AgeLimits struct {
+	Warn     time.Duration
+	Critical time.Duration
+}
+
+func (l AgeLimits) status(age time.Duration) HealthStatus {
+	switch {
+	case l.Critical > 0 && age >= l.Critical:
+		return HealthCritical
+	case l.Warn > 0 && age >= l.Warn:
+		return HealthWarn
+	}
+	return HealthOK
+}
+
+// HealthThresholds are the limits used to score each HealthDimension.
+type HealthThresholds struct {
+	TxnsBacklog   CountLimits
+	StashSize     CountLimits
+	QueueDepth    CountLimits
+	OldestPending AgeLimits
+	LastPrune     AgeLimits
+}
+
+// DefaultHealthThresholds returns the thresholds used by TxnHealth. The
+// queue depth limits are well below the 1000 tokens at which mgo/txn
+// refuses to add to a txn-queue.
+func DefaultHealthThresholds() HealthThresholds {
+	return HealthThresholds{
+		TxnsBacklog:   CountLimits{Warn: 1000000, Critical: 5000000},
+		StashSize:     CountLimits{Warn: 100000, Critical: 1000000},
+		QueueDepth:    CountLimits{Warn: 200, Critical: 800},
+		OldestPending: AgeLimits{Warn: 10 * time.Minute, Critical: time.Hour},
+		LastPrune:     AgeLimits{Warn: 2 * 24 * time.Hour, Critical: 7 * 24 * time.Hour},
+	}
+}
+
+// HealthCheck is the score of one HealthDimension.
+type HealthCheck struct {
+	Dimension HealthDimension `json:"dimension"`
+	Status    HealthStatus    `json:"status"`
+	Message   string          `json:"message"`
+}
+
+// HealthReport is returned by TxnHealth.
+type HealthReport struct {
+	// Status is the worst status of the Checks.
+	Status HealthStatus `json:"status"`
+
+	// Checks score each HealthDimension, in a fixed order.
+	Checks []HealthCheck `json:"checks"`
+
+	// Checked is when the report was made.
+	Checked time.Time `json:"checked"`
+
+	// TxnCount and StashCount are the numbers of documents in the txns
+	// and txns.stash collections.
+	TxnCount   int `json:"txn-count"`
+	StashCount int `json:"stash-count"`
+
+	// MaxQueueLength is the length of the longest txn-queue, and
+	// MaxQueueCollection is the collection it is in.
+	MaxQueueLength     int    `json:"max-queue-length"`
+	MaxQueueCollection string `json:"max-queue-collection,omitempty"`
+
+	// OldestPending is the age of the oldest pending transaction, or 0
+	// if there are none.
+	OldestPending time.Duration `json:"oldest-pending"`
+
+	// LastPrune is when the transactions were last pruned, by MaybePrune
+	// or PruneBudgeted. It is zero if they never have been.
+	LastPrune time.Time `json:"last-prune"`
+}
+
+// Check returns the check of dimension d.
+func (r HealthReport) Check(d HealthDimension) (HealthCheck, bool) {
+	for _, check := range r.Checks {
+		if check.Dimension == d {
+			return check, true
+		}
+	}
+	return HealthCheck{}, false
+}
+
+// TxnHealth scores the health of the transactions in txnsName with
+// DefaultHealthThresholds, for use by health endpoints. See
+// TxnHealthWithThresholds.
+func TxnHealth(db *mgo.Database, txnsName string) (HealthReport, error) {
+	return TxnHealthWithThresholds(db, txnsName, DefaultHealthThresholds())
+}
+
+// TxnHealthWithThresholds scores the health of the transactions in
+// txnsName as ok, warn or critical in each HealthDimension, and overall.
+// Finding the longest txn-queue reads every document with a txn-queue, so
+// on a big database it shouldn't be called more often than every few
+// minutes.
+func TxnHealthWithThresholds(db *mgo.Database, txnsName string, thresholds HealthThresholds) (HealthReport, error) {
+	now := time.Now()
+	report := HealthReport{Checked: now.UTC()}
+	var err error
+	if report.TxnCount, err = db.C(txnsName).Count(); err != nil {
+		return report, errors.Annotate(err, "counting transactions")
+	}
+	if report.StashCount, err = db.C(txnsName + ".stash").Count(); err != nil {
+		return report, errors.Annotate(err, "counting stash documents")
+	}
+	depths, err := queueDepths(db, txnsName)
+	if err != nil {
+		return report, errors.Trace(err)
+	}
+	for _, depth := range depths {
+		if depth.MaxLength > report.MaxQueueLength {
+			report.MaxQueueLength = depth.MaxLength
+			report.MaxQueueCollection = depth.Collection
+		}
+	}
+	var oldest struct {
+		Id bson.ObjectId `bson:"_id"`
+	}
+	err = db.C(txnsName).Find(bson.M{"s": bson.M{"$in": pendingTxnStates}}).
+		Select(bson.M{"_id": 1}).Sort("_id").One(&oldest)
+	if err == nil {
+		report.OldestPending = now.Sub(oldest.Id.Time())
+	} else if err != mgo.ErrNotFound {
+		return report, errors.Annotate(err, "finding oldest pending transaction")
+	}
+	if report.LastPrune, err = lastPruned(db, txnsName); err != nil {
+		return report, errors.Trace(err)
+	}
+	report.score(thresholds, now)
+	return report, nil
+}
+
+// lastPruned returns when txnsName was last pruned, or the zero time if
+// it never has been.
+func lastPruned(db *mgo.Database, txnsName string) (time.Time, error) {
+	var last time.Time
+	var record PruneRecord
+	err := db.C(txnsPruneC(txnsName)).Find(pruneRecordMatch()).Sort("-_id").One(&record)
+	if err == nil {
+		last = record.Completed
+	} else if err != mgo.ErrNotFound {
+		return last, errors.Annotate(err, "reading last prune")
+	}
+	checkpoint, err := ReadPruneCheckpoint(db, txnsName)
+	if err == nil && checkpoint.Updated.After(last) {
+		last = checkpoint.Updated
+	} else if err != nil && !errors.IsNotFound(err) {
+		return last, errors.Trace(err)
+	}
+	return last, nil
+}
+
+// score fills in the Checks and Status of the report from its
+// measurements.
+func (r *HealthReport) score(thresholds HealthThresholds, now time.Time) {
+	r.Checks = []HealthCheck{{
+		Dimension: HealthTxnsBacklog,
+		Status:    thresholds.TxnsBacklog.status(r.TxnCount),
+		Message:   fmt.Sprintf("%d transactions", r.TxnCount),
+	}, {
+		Dimension: HealthStashSize,
+		Status:    thresholds.StashSize.status(r.StashCount),
+		Message:   fmt.Sprintf("%d stash documents", r.StashCount),
+	}, {
+		Dimension: HealthQueueDepth,
+		Status:    thresholds.QueueDepth.status(r.MaxQueueLength),
+		Message:   fmt.Sprintf("longest txn-queue has %d tokens", r.MaxQueueLength),
+	}}
+	if r.MaxQueueCollection != "" {
+		r.Checks[2].Message += fmt.Sprintf(" in %q", r.MaxQueueCollection)
+	}
+
+	pending := HealthCheck{
+		Dimension: HealthOldestPending,
+		Status:    thresholds.OldestPending.status(r.OldestPending),
+		Message:   "no pending transactions",
+	}
+	if r.OldestPending > 0 {
+		pending.Message = fmt.Sprintf("oldest pending transaction is %s old", r.OldestPending.Round(time.Second))
+	}
+	r.Checks = append(r.Checks, pending)
+
+	// A database that has never been pruned is only unhealthy if the
+	// backlog is, which is checked above.
+	prune := HealthCheck{
+		Dimension: HealthLastPrune,
+		Message:   "never pruned",
+	}
+	if !r.LastPrune.IsZero() {
+		age := now.Sub(r.LastPrune)
+		prune.Status = thresholds.LastPrune.status(age)
+		prune.Message = fmt.Sprintf("last pruned %s ago", age.Round(time.Second))
+	}
+	r.Checks = append(r.Checks, prune)
+
+	r.Status = HealthOK
+	for _, check := range r.Checks {
+		if check.Status > r.Status {
+			r.Status = check.Status
+		}
+	}
+}
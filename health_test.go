@@ -0,0 +1,133 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type HealthSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&HealthSuite{})
+
+func (*HealthSuite) TestScoreHealthy(c *gc.C) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	report := HealthReport{
+		TxnCount:  10,
+		LastPrune: now.Add(-time.Hour),
+	}
+	report.score(DefaultHealthThresholds(), now)
+	c.Check(report.Status, gc.Equals, HealthOK)
+	c.Check(report.Checks, jc.DeepEquals, []HealthCheck{
+		{HealthTxnsBacklog, HealthOK, "10 transactions"},
+		{HealthStashSize, HealthOK, "0 stash documents"},
+		{HealthQueueDepth, HealthOK, "longest txn-queue has 0 tokens"},
+		{HealthOldestPending, HealthOK, "no pending transactions"},
+		{HealthLastPrune, HealthOK, "last pruned 1h0m0s ago"},
+	})
+}
+
+func (*HealthSuite) TestScoreUnhealthy(c *gc.C) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	report := HealthReport{
+		TxnCount:           2000000,
+		MaxQueueLength:     900,
+		MaxQueueCollection: "machines",
+		OldestPending:      20 * time.Minute,
+	}
+	report.score(DefaultHealthThresholds(), now)
+	c.Check(report.Status, gc.Equals, HealthCritical)
+	for _, expect := range []HealthCheck{
+		{HealthTxnsBacklog, HealthWarn, "2000000 transactions"},
+		{HealthQueueDepth, HealthCritical, `longest txn-queue has 900 tokens in "machines"`},
+		{HealthOldestPending, HealthWarn, "oldest pending transaction is 20m0s old"},
+		{HealthLastPrune, HealthOK, "never pruned"},
+	} {
+		check, ok := report.Check(expect.Dimension)
+		c.Check(ok, jc.IsTrue)
+		c.Check(check, gc.Equals, expect)
+	}
+}
+
+func (*HealthSuite) TestZeroLimitsNeverReached(c *gc.C) {
+	c.Check(CountLimits{}.status(1<<30), gc.Equals, HealthOK)
+	c.Check(AgeLimits{Critical: time.Hour}.status(time.Hour), gc.Equals, HealthCritical)
+}
+
+func (*HealthSuite) TestStatusJSON(c *gc.C) {
+	data, err := json.Marshal(HealthCheck{Dimension: HealthStashSize, Status: HealthWarn})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, `{"dimension":"stash-size","status":"warn","message":""}`)
+}
+
+func (*HealthSuite) TestWatcherAlerts(c *gc.C) {
+	reports := make(chan HealthReport)
+	evaluate := func() (HealthReport, error) {
+		return <-reports, nil
+	}
+	alerts := make(chan Alert, 10)
+	w := startHealthWatcher(evaluate, time.Millisecond, func(alert Alert) {
+		alerts <- alert
+	})
+	defer func() {
+		// Closing reports makes further evaluations report nothing, so
+		// that the watcher can't block while stopping.
+		close(reports)
+		w.Stop()
+	}()
+
+	report := func(backlog, stash HealthStatus) HealthReport {
+		return HealthReport{Checks: []HealthCheck{
+			{HealthTxnsBacklog, backlog, backlog.String()},
+			{HealthStashSize, stash, stash.String()},
+		}}
+	}
+	expectAlerts := func(expect ...Alert) {
+		for _, e := range expect {
+			select {
+			case alert := <-alerts:
+				c.Check(alert, gc.Equals, e)
+			case <-time.After(testing.LongWait):
+				c.Fatalf("timed out waiting for %v alert", e.Dimension)
+			}
+		}
+	}
+
+	reports <- report(HealthOK, HealthOK)
+	reports <- report(HealthWarn, HealthOK)
+	expectAlerts(Alert{
+		Dimension: HealthTxnsBacklog,
+		Status:    HealthWarn,
+		Previous:  HealthOK,
+		Message:   "warn",
+	})
+	// The same status again isn't reported.
+	reports <- report(HealthWarn, HealthOK)
+	reports <- report(HealthOK, HealthCritical)
+	expectAlerts(Alert{
+		Dimension: HealthTxnsBacklog,
+		Status:    HealthOK,
+		Previous:  HealthWarn,
+		Recovered: true,
+		Message:   "ok",
+	}, Alert{
+		Dimension: HealthStashSize,
+		Status:    HealthCritical,
+		Previous:  HealthOK,
+		Message:   "critical",
+	})
+	reports <- report(HealthOK, HealthCritical)
+	select {
+	case alert := <-alerts:
+		c.Fatalf("unexpected alert %#v", alert)
+	default:
+	}
+}
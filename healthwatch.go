@@ -0,0 +1,129 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"time"
+
+	"github.com/juju/mgo/v3"
+)
+
+// healthWatchInterval is how often StartHealthWatcher evaluates health.
+const healthWatchInterval = 5 * time.Minute
+
+// Alert is passed to the notify function of StartHealthWatcher when the
+// status of a HealthDimension changes.
+type Alert struct {
+	// Dimension is the dimension whose status changed.
+	Dimension HealthDimension
+
+	// Status is the new status, and Previous is the status before.
+	Status   HealthStatus
+	Previous HealthStatus
+
+	// Recovered is true if the dimension is healthy again.
+	Recovered bool
+
+	// Message describes the new state of the dimension.
+	Message string
+
+	// Time is when the change was seen.
+	Time time.Time
+}
+
+// HealthWatcher periodically evaluates the health of the transactions.
+// It is returned by StartHealthWatcher.
+type HealthWatcher struct {
+	evaluate func() (HealthReport, error)
+	interval time.Duration
+	notify   func(Alert)
+	statuses map[HealthDimension]HealthStatus
+	stopCh   chan struct{}
+	done     chan struct{}
+}
+
+// StartHealthWatcher evaluates the health of the transactions in txnsName
+// against thresholds every 5 minutes, starting straight away, and calls
+// notify when a dimension's status changes. Alerts are deduplicated: a
+// dimension that stays at warn or critical is only reported once, and
+// notify is called again, with Recovered set, when it is back to ok.
+// Failures to evaluate health are logged, and leave the statuses as they
+// were. notify is called from the watcher's goroutine, so it should not
+// block for long. Call Stop to stop watching.
+func StartHealthWatcher(db *mgo.Database, txnsName string, thresholds HealthThresholds, notify func(Alert)) *HealthWatcher {
+	evaluate := func() (HealthReport, error) {
+		session := db.Session.Copy()
+		defer session.Close()
+		return TxnHealthWithThresholds(db.With(session), txnsName, thresholds)
+	}
+	return startHealthWatcher(evaluate, healthWatchInterval, notify)
+}
+
+func startHealthWatcher(evaluate func() (HealthReport, error), interval time.Duration, notify func(Alert)) *HealthWatcher {
+	w := &HealthWatcher{
+		evaluate: evaluate,
+		interval: interval,
+		notify:   notify,
+		statuses: make(map[HealthDimension]HealthStatus),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+// Stop stops the watcher, and waits for it to finish any evaluation in
+// progress.
+func (w *HealthWatcher) Stop() {
+	close(w.stopCh)
+	<-w.done
+}
+
+func (w *HealthWatcher) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.check()
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check evaluates health, and notifies any changes.
+func (w *HealthWatcher) check() {
+	report, err := w.evaluate()
+	if err != nil {
+		logger.Warningf("unable to evaluate txn health: %v", err)
+		return
+	}
+	for _, alert := range w.alerts(report) {
+		w.notify(alert)
+	}
+}
+
+// alerts returns an Alert for each dimension of report whose status has
+// changed since the last report, and records the new statuses.
+func (w *HealthWatcher) alerts(report HealthReport) []Alert {
+	var alerts []Alert
+	for _, check := range report.Checks {
+		previous := w.statuses[check.Dimension]
+		if check.Status == previous {
+			continue
+		}
+		w.statuses[check.Dimension] = check.Status
+		alerts = append(alerts, Alert{
+			Dimension: check.Dimension,
+			Status:    check.Status,
+			Previous:  previous,
+			Recovered: check.Status == HealthOK,
+			Message:   check.Message,
+			Time:      report.Checked,
+		})
+	}
+	return alerts
+}
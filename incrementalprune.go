@@ -6,6 +6,7 @@ package txn
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -22,16 +23,46 @@ const pruneMaxTxnBatchSize = 10000
 const defaultBatchSleepTime time.Duration = 0
 const maxBatchSleepTime = 1 * time.Second
 const queryDocBatchSize = 100
+const minDocBatchSize = 10
 const pruneDocCacheSize = 10000
 const missingKeyCacheSize = 2000
 const strCacheSize = 10000
 
+// defaultLargeDocSize is the average document size above which we warn
+// that a collection is expensive to prune.
+const defaultLargeDocSize = 64 * 1024
+
+// Pruner removes completed transactions from a transactions collection.
+// It is implemented by IncrementalPruner.
+type Pruner interface {
+	// Prune removes completed transactions from txns, cleaning up the
+	// documents that reference them.
+	Prune(txns *mgo.Collection) (PrunerStats, error)
+
+	// CollectionStats returns the work done against each collection by
+	// the last call to Prune, sorted by collection name.
+	CollectionStats() []CollectionPruneStats
+
+	// LimitReached returns true if the last call to Prune stopped early,
+	// leaving transactions that could be pruned by another pass.
+	LimitReached() bool
+}
+
+var _ Pruner = (*IncrementalPruner)(nil)
+
 // IncrementalPruner reads the transaction table incrementally, seeing if it can remove the current set of transactions,
 // and then moves on to newer transactions. It only thinks about 1k txns at a time, because that is the batch size that
 // can be deleted. Instead, it caches documents that it has seen.
 type IncrementalPruner struct {
 	maxTime        time.Time
 	reverse        bool
+	maxTxns        int
+	txnsRead       int
+	startAfter     bson.ObjectId
+	firstTxnId     bson.ObjectId
+	lastTxnId      bson.ObjectId
+	checkpoint     bson.ObjectId
+	limitReached   bool
 	txnBatchSize   int
 	batchSleepTime time.Duration
 	ProgressChan   chan ProgressMessage
@@ -40,14 +71,141 @@ type IncrementalPruner struct {
 	strCache       *lru.StringCache
 	strMu          sync.Mutex
 	stats          PrunerStats
+	// removals counts the work of the txn removals, which run in their
+	// own goroutines, until Prune adds it to stats.
+	removals     *removalCounters
+	collPriority map[string]float64
+	collStats    map[string]*CollectionPruneStats
+
+	loadMonitor      LoadMonitor
+	loadPollInterval time.Duration
+	maxLoadSuspend   time.Duration
+	deadline         time.Time
+	oplogPacer       *OplogPacer
+
+	scanSession *mgo.Session
+	maxScanLag  time.Duration
+
+	stashOrder       StashOrder
+	bulkStashCleanup bool
+
+	largeDocSize int
+	sizeSampled  map[string]bool
+
+	readWholeDocs bool
+
+	indexHints *IndexHints
+	// txnsHint is the key of the index used to scan the transactions.
+	txnsHint []string
+	// planChecked holds the collections whose query plans have been
+	// checked.
+	planChecked map[string]bool
+
+	// explainSlow is ExplainSlowQueries. slowExplains counts the
+	// queries being explained, and slowQueries holds those explained.
+	explainSlow  time.Duration
+	slowExplains int
+	slowQueries  []SlowQuery
+
+	// docBatchSize is the current size of document batches, which is
+	// reduced while batches are slow, up to maxDocBatchSize.
+	docBatchSize     int
+	maxDocBatchSize  int
+	docBatchDeadline time.Duration
+
+	collectionScans *ScanLimiter
+	// readMu guards the state changed while reading documents, which
+	// may be done from several collections at once.
+	readMu sync.Mutex
+
+	stripInvalidTokens bool
+	checkMissingTxns   bool
+
+	metadataFilter TxnMetadata
+
+	docFilter DocFilter
+	docFields bson.M
+	// filteredDocs are the documents of the current batch that docFilter
+	// said to skip.
+	filteredDocs map[docKey]struct{}
+
+	cleanOnly  bool
+	removeOnly bool
+
+	archive  *ArchiveWriter
+	onRemove RemoveHook
+
+	profileLabels bool
+	slowBatch     time.Duration
+	profileDir    string
+	batchProfile  *batchProfile
+	batchProfiles int
+
+	// batch counts the batches of transactions read, for progress
+	// messages.
+	batch int
+
+	job     *PruneJob
+	metrics *metricsWriter
 }
 
+// ProgressMessage is sent on IncrementalPruneArgs.ProgressChannel as the
+// pruner works. A message either counts work done since the last one, or
+// reports a change of Phase or Collection.
 type ProgressMessage struct {
 	TxnsRemoved int
 	DocsCleaned int
+
+	// Phase, if set, is the phase the pruner has moved on to.
+	Phase PrunePhase
+
+	// Collection is the collection whose documents are being cleaned,
+	// while Phase is PrunePhaseCleaningDocs.
+	Collection string
+
+	// Batch is the batch of transactions being worked on, starting at 1.
+	// It is 0 while removing stash documents, which happens once all the
+	// batches are done.
+	Batch int
+
+	// PeakHeapBytes, if not 0, is a new high for the heap memory used by
+	// the process while pruning. See PrunerStats.PeakHeapBytes.
+	PeakHeapBytes int64
 }
 
 // IncrementalPruneArgs specifies the parameters for running incremental cleanup steps.
+// StashOrder selects when the pruner processes documents in txns.stash,
+// which hold the txn-queues of documents that have been removed (or not
+// yet inserted).
+type StashOrder string
+
+const (
+	// StashInterleaved looks for documents in the stash when they can't
+	// be found in their collection, and cleans them in transaction order
+	// along with the other documents.
+	StashInterleaved StashOrder = "interleaved"
+
+	// StashFirst looks for documents in the stash before their
+	// collection, and cleans stash documents before the others in each
+	// batch. This suits workloads that remove and recreate documents
+	// often, where releasing the space held by the stash matters most.
+	StashFirst StashOrder = "first"
+
+	// StashLast looks for documents in the stash after their collection,
+	// and cleans stash documents after the others in each batch.
+	StashLast StashOrder = "last"
+)
+
+// Validate returns an error if the order is not known. The zero value is
+// valid, and means StashInterleaved.
+func (o StashOrder) Validate() error {
+	switch o {
+	case "", StashInterleaved, StashFirst, StashLast:
+		return nil
+	}
+	return errors.NotValidf("stash order %q", string(o))
+}
+
 type IncrementalPruneArgs struct {
 	// MaxTime is a timestamp that provides a threshold of transactions
 	// that we will actually prune. Only transactions that were created
@@ -55,6 +213,11 @@ type IncrementalPruneArgs struct {
 	// MaxTime can be set to the Zero value to indicate all transactions.
 	MaxTime time.Time
 
+	// StartAfter, if set, skips the transactions with ids up to and
+	// including it, so that pruning can carry on from where an earlier
+	// prune stopped. See CleanupStats.Checkpoint.
+	StartAfter bson.ObjectId
+
 	// If ProgressChannel is not nil, this will send updates when documents are
 	// processed and transactions are pruned.
 	ProgressChannel chan ProgressMessage
@@ -63,6 +226,11 @@ type IncrementalPruneArgs struct {
 	// oldest instead of form oldest to newest.
 	ReverseOrder bool
 
+	// MaxTransactionsToProcess limits how many completed transactions
+	// will be evaluated by a single call to Prune. A value of 0 indicates
+	// we should evaluate all completed transactions.
+	MaxTransactionsToProcess int
+
 	// TxnBatchSize is how many transactions to process at once.
 	TxnBatchSize int
 
@@ -73,6 +241,186 @@ type IncrementalPruneArgs struct {
 	// load while pruning.
 	TxnBatchSleepTime time.Duration
 
+	// CollectionPriority optionally ranks collections by how productive
+	// they were to prune previously (see CollectionPruneStats.Prunability).
+	// Within each batch, higher ranked collections are read and cleaned
+	// first.
+	CollectionPriority map[string]float64
+
+	// LoadMonitor, if not nil, is checked between batches. When the load
+	// is high we sleep for longer between batches, and if the database is
+	// overloaded we suspend pruning until the load drops.
+	LoadMonitor LoadMonitor
+
+	// LoadPollInterval is how often LoadMonitor is checked while pruning
+	// is suspended. Defaults to 5s.
+	LoadPollInterval time.Duration
+
+	// MaxLoadSuspend is the longest pruning is suspended waiting for the
+	// load to drop. After that, Prune gives up with ErrLoadTooHigh.
+	// Defaults to 10 minutes.
+	MaxLoadSuspend time.Duration
+
+	// OplogPacer, if not nil, is checked between batches, and we sleep
+	// until the transactions removed are within its pace. It may be
+	// shared with other pruners, so that the pace covers them all.
+	OplogPacer *OplogPacer
+
+	// ScanSession, if not nil, is used to read the txns collection while
+	// looking for transactions to prune, so that the scan can be served by
+	// a secondary such as an analytics or hidden member (see
+	// NewScanSession). Documents are still read and all writes are still
+	// made through the session of the collection passed to Prune.
+	// Completed transactions never change state, so a lagging secondary
+	// can only cause us to miss transactions, not prune live ones.
+	ScanSession *mgo.Session
+
+	// MaxScanLag, if not 0, is how far the ScanSession member may be
+	// behind the primary. It is checked before each batch is acted on,
+	// and pruning stops with an error if the member is too far behind.
+	MaxScanLag time.Duration
+
+	// LargeDocSize is the average document size, in bytes, above which a
+	// collection is reported as having large documents. The average size
+	// of each collection is read once per prune, and recorded in
+	// CollectionPruneStats.AvgDocSize. Defaults to 64KiB.
+	LargeDocSize int
+
+	// ReadWholeDocuments disables the projections used when reading
+	// transactions and documents, so that whole documents are read. The
+	// pruner only needs the _id and txn-queue of documents, so this is
+	// only for servers which mishandle projections.
+	ReadWholeDocuments bool
+
+	// IndexHints, if not nil, selects the indexes used to scan the
+	// transactions and read documents, and warns when the server plans
+	// to scan a whole collection instead. See IndexHints.
+	IndexHints *IndexHints
+
+	// ExplainSlowQueries, if not 0, is how long a query may take before
+	// it is explained, with execution stats, so that slow prunes can be
+	// diagnosed after the fact. The explanation is logged at debug level
+	// and kept (see SlowQueries). Reads of transactions are timed per
+	// batch, and reads of documents per query. At most 5 queries are
+	// explained per Prune, as explaining runs a query again; all are
+	// counted in PrunerStats.SlowQueries.
+	ExplainSlowQueries time.Duration
+
+	// DocBatchSize is how many documents are read from a collection with
+	// each query. Defaults to 200.
+	DocBatchSize int
+
+	// CollectionScans, if not nil, limits how many collections are read
+	// at once, and lets this pruner read the documents of a batch from
+	// several collections at once, up to the limit. The limiter may be
+	// shared with other pruners, so that the limit covers them all. If
+	// it is nil, collections are read one at a time.
+	CollectionScans *ScanLimiter
+
+	// DocBatchDeadline, if not 0, is how long reading a batch of
+	// documents may take. A batch that takes longer is cut short, and the
+	// documents that weren't read are read in smaller batches, as are the
+	// batches after it. Batches grow back towards DocBatchSize while they
+	// are read within half the deadline. Splits are counted in
+	// PrunerStats.DocBatchSplits.
+	DocBatchDeadline time.Duration
+
+	// StashOrder selects when documents in txns.stash are looked up and
+	// cleaned, relative to those in the other collections. The default is
+	// StashInterleaved.
+	StashOrder StashOrder
+
+	// BulkStashCleanup, if true, cleans the txn-queues of all the stash
+	// documents in a batch with a single update, rather than one update
+	// per document. The update is made before the other documents are
+	// cleaned, or after them if StashOrder is StashLast.
+	BulkStashCleanup bool
+
+	// CleanOnly pulls the tokens of the transactions from the documents
+	// they touched, but doesn't remove the transactions. As they are
+	// left in place, later runs should start after the checkpoint of
+	// this one.
+	CleanOnly bool
+
+	// RemoveOnly removes the transactions that no document refers to any
+	// more, without writing to the documents. Transactions whose tokens
+	// are still in a document are counted in PrunerStats.TxnsNotRemoved
+	// and left for a later run, once the documents have been cleaned.
+	// It is ignored if CleanOnly is set.
+	RemoveOnly bool
+
+	// Archive, if not nil, is written the complete transaction documents
+	// of each batch before they are removed. If archiving fails the batch
+	// is not removed and pruning stops with an error.
+	Archive *ArchiveWriter
+
+	// OnRemove, if not nil, is called with each transaction that is about
+	// to be removed, once the documents it touched have been cleaned. If
+	// it returns an error the batch is not removed and pruning stops with
+	// an error.
+	OnRemove RemoveHook
+
+	// StripInvalidTokens, if true, removes malformed tokens (see
+	// ParseToken) from the txn-queues of the documents that are cleaned.
+	// Otherwise they are only counted in PrunerStats.InvalidTokens.
+	StripInvalidTokens bool
+
+	// CheckMissingTxns, if true, looks up the transactions referred to by
+	// the other tokens in the txn-queues being cleaned, and counts those
+	// whose transaction no longer exists in PrunerStats.MissingTxnTokens.
+	// This costs a query of the transactions collection per batch.
+	CheckMissingTxns bool
+
+	// MetadataFilter, if not zero, restricts pruning to the transactions
+	// whose TxnMetadata has the same value for each non-empty field, eg
+	// all the transactions of a model that has been destroyed. MaxTime
+	// still applies, so leave it zero to prune them regardless of age.
+	MetadataFilter TxnMetadata
+
+	// DocFilter, if not nil, is called with each document read from its
+	// collection to be cleaned, and the document is only cleaned if it
+	// returns true. This lets documents that are eg being migrated, or
+	// are held by another tool, be left alone. The transactions that
+	// touched skipped documents are kept, to be pruned another time.
+	// Skipped documents are counted in PrunerStats.DocsFiltered.
+	// Setting DocFilter disables the document cache, so that each
+	// document is checked every time it is cleaned.
+	DocFilter DocFilter
+
+	// DocFilterFields are the fields, besides _id and txn-queue, that
+	// DocFilter needs to see. Other fields are left out of the raw
+	// document unless ReadWholeDocuments is set.
+	DocFilterFields []string
+
+	// ProfileLabels, if true, sets pprof labels on the pruning goroutines
+	// naming the phase (txn-prune-phase) and collection
+	// (txn-prune-collection) being worked on, so that CPU profiles of the
+	// process attribute time to them. Any labels already set on the
+	// goroutine calling Prune are replaced.
+	ProfileLabels bool
+
+	// StartCPUProfileOnSlowBatch, if not 0, is a debugging aid: when a
+	// batch takes longer than this, the CPU is profiled during the next
+	// batch and the profile written to CPUProfileDir. At most 3 profiles
+	// are written per Prune, and none if the process is already being
+	// profiled.
+	StartCPUProfileOnSlowBatch time.Duration
+
+	// CPUProfileDir is the directory batch profiles are written to. It
+	// defaults to os.TempDir().
+	CPUProfileDir string
+
+	// job, if not nil, is the PruneJob that started this pruner, which
+	// may ask it to pause or stop between batches.
+	job *PruneJob
+
+	// deadline, if not zero, is when CleanAndPrune's MaxRuntime runs
+	// out. Pruning that is suspended by the load stops at the deadline.
+	deadline time.Time
+
+	// metrics, if not nil, is written a PruneMetric for each batch.
+	metrics *metricsWriter
+
 	// TODO(jam): 2018-12-12 Include a github.com/juju/clock.Clock
 	// interface so that we can test that sleep is properly handled per
 	// batch. Potentially we could also test that we measure performance
@@ -81,31 +429,47 @@ type IncrementalPruneArgs struct {
 
 // PrunerStats collects statistics about how the prune progressed
 type PrunerStats struct {
-	CacheLookupTime    time.Duration
-	DocReadTime        time.Duration
-	DocLookupTime      time.Duration
-	DocCleanupTime     time.Duration
-	StashLookupTime    time.Duration
-	StashRemoveTime    time.Duration
-	TxnReadTime        time.Duration
-	TxnRemoveTime      time.Duration
-	DocCacheHits       int64
-	DocCacheMisses     int64
-	DocMissingCacheHit int64
-	DocsMissing        int64
-	CollectionQueries  int64
-	DocReads           int64
-	DocStillMissing    int64
-	StashQueries       int64
-	StashDocReads      int64
-	StashDocsRemoved   int64
-	DocQueuesCleaned   int64
-	DocTokensCleaned   int64
-	DocsAlreadyClean   int64
-	TxnsRemoved        int64
-	TxnsNotRemoved     int64
-	StrCacheHits       int64
-	StrCacheMisses     int64
+	CacheLookupTime      time.Duration `bson:"cache-lookup-time"`
+	DocReadTime          time.Duration `bson:"doc-read-time"`
+	DocLookupTime        time.Duration `bson:"doc-lookup-time"`
+	DocCleanupTime       time.Duration `bson:"doc-cleanup-time"`
+	StashLookupTime      time.Duration `bson:"stash-lookup-time"`
+	StashRemoveTime      time.Duration `bson:"stash-remove-time"`
+	TxnReadTime          time.Duration `bson:"txn-read-time"`
+	TxnRemoveTime        time.Duration `bson:"txn-remove-time"`
+	LoadSleepTime        time.Duration `bson:"load-sleep-time"`
+	OplogSleepTime       time.Duration `bson:"oplog-sleep-time"`
+	DocCacheHits         int64         `bson:"doc-cache-hits"`
+	DocCacheMisses       int64         `bson:"doc-cache-misses"`
+	DocMissingCacheHit   int64         `bson:"doc-missing-cache-hit"`
+	DocsMissing          int64         `bson:"docs-missing"`
+	CollectionQueries    int64         `bson:"collection-queries"`
+	DocReads             int64         `bson:"doc-reads"`
+	DocStillMissing      int64         `bson:"doc-still-missing"`
+	DocBatchSplits       int64         `bson:"doc-batch-splits"`
+	StashQueries         int64         `bson:"stash-queries"`
+	StashDocReads        int64         `bson:"stash-doc-reads"`
+	StashDocsRemoved     int64         `bson:"stash-docs-removed"`
+	StashBulkCleanups    int64         `bson:"stash-bulk-cleanups"`
+	DocQueuesCleaned     int64         `bson:"doc-queues-cleaned"`
+	DocTokensCleaned     int64         `bson:"doc-tokens-cleaned"`
+	DocsAlreadyClean     int64         `bson:"docs-already-clean"`
+	TxnsRemoved          int64         `bson:"txns-removed"`
+	TxnsNotRemoved       int64         `bson:"txns-not-removed"`
+	TxnsAlreadyRemoved   int64         `bson:"txns-already-removed"`
+	StrCacheHits         int64         `bson:"str-cache-hits"`
+	StrCacheMisses       int64         `bson:"str-cache-misses"`
+	InvalidTokens        int64         `bson:"invalid-tokens"`
+	InvalidTokensRemoved int64         `bson:"invalid-tokens-removed"`
+	MissingTxnTokens     int64         `bson:"missing-txn-tokens"`
+	DocsFiltered         int64         `bson:"docs-filtered"`
+	CollScans            int64         `bson:"coll-scans"`
+	SlowQueries          int64         `bson:"slow-queries"`
+
+	// PeakHeapBytes is the most heap memory the process was seen to use
+	// while pruning. It is sampled once per batch, and covers the whole
+	// process, not just the pruner.
+	PeakHeapBytes int64 `bson:"peak-heap-bytes"`
 }
 
 func (ps PrunerStats) String() string {
@@ -152,35 +516,149 @@ func (ps PrunerStats) String() string {
 	return strings.Join(resultStrs, "\n")
 }
 
+// CollectionPruneStats records the work done against a single collection
+// while pruning. They are persisted alongside the prune history so that the
+// next prune can visit the most productive collections first.
+type CollectionPruneStats struct {
+	// Name is the name of the collection.
+	Name string `bson:"name"`
+
+	// DocsRead is how many documents we loaded from the collection.
+	DocsRead int64 `bson:"docs-read"`
+
+	// DocsCleaned is how many documents had tokens pulled from their queue.
+	DocsCleaned int64 `bson:"docs-cleaned"`
+
+	// TokensCleaned is how many tokens were pulled from document queues.
+	TokensCleaned int64 `bson:"tokens-cleaned"`
+
+	// ReadTime is how long was spent reading documents.
+	ReadTime time.Duration `bson:"read-time"`
+
+	// AvgDocSize is the average size in bytes of the documents in the
+	// collection, as reported by the server, or 0 if it is not known.
+	AvgDocSize int64 `bson:"avg-doc-size"`
+
+	// Skipped is why the documents in the collection couldn't be cleaned,
+	// eg because it is a capped collection. The transactions that touched
+	// them are left in place. It is empty if the collection was cleaned.
+	Skipped string `bson:"skipped,omitempty"`
+}
+
+// Prunability estimates how many document queues we clean per second spent
+// reading the collection.
+func (s CollectionPruneStats) Prunability() float64 {
+	seconds := s.ReadTime.Seconds()
+	if seconds < 0.001 {
+		seconds = 0.001
+	}
+	return float64(s.DocsCleaned) / seconds
+}
+
+// CollectionPriorities turns the stats from a previous prune into a value
+// suitable for IncrementalPruneArgs.CollectionPriority.
+func CollectionPriorities(stats []CollectionPruneStats) map[string]float64 {
+	if len(stats) == 0 {
+		return nil
+	}
+	priority := make(map[string]float64, len(stats))
+	for _, s := range stats {
+		priority[s.Name] = s.Prunability()
+	}
+	return priority
+}
+
+// combineCollectionStats aggregates per-collection stats, returning them
+// sorted by collection name.
+func combineCollectionStats(a, b []CollectionPruneStats) []CollectionPruneStats {
+	byName := make(map[string]*CollectionPruneStats, len(a)+len(b))
+	for _, stats := range [][]CollectionPruneStats{a, b} {
+		for _, s := range stats {
+			existing, ok := byName[s.Name]
+			if !ok {
+				s := s
+				byName[s.Name] = &s
+				continue
+			}
+			existing.DocsRead += s.DocsRead
+			existing.DocsCleaned += s.DocsCleaned
+			existing.TokensCleaned += s.TokensCleaned
+			existing.ReadTime += s.ReadTime
+			if s.AvgDocSize > existing.AvgDocSize {
+				existing.AvgDocSize = s.AvgDocSize
+			}
+			if s.Skipped != "" {
+				existing.Skipped = s.Skipped
+			}
+		}
+	}
+	return sortedCollectionStats(byName)
+}
+
+func sortedCollectionStats(byName map[string]*CollectionPruneStats) []CollectionPruneStats {
+	result := make([]CollectionPruneStats, 0, len(byName))
+	for _, s := range byName {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
 // CombineStats aggregates two stats into a single value
 func CombineStats(a, b PrunerStats) PrunerStats {
-	return PrunerStats{
-		CacheLookupTime:    a.CacheLookupTime + b.CacheLookupTime,
-		DocLookupTime:      a.DocLookupTime + b.DocLookupTime,
-		DocCleanupTime:     a.DocCleanupTime + b.DocCleanupTime,
-		DocReadTime:        a.DocReadTime + b.DocReadTime,
-		StashLookupTime:    a.StashLookupTime + b.StashLookupTime,
-		StashRemoveTime:    a.StashRemoveTime + b.StashRemoveTime,
-		TxnReadTime:        a.TxnReadTime + b.TxnReadTime,
-		TxnRemoveTime:      a.TxnRemoveTime + b.TxnRemoveTime,
-		DocCacheHits:       a.DocCacheHits + b.DocCacheHits,
-		DocCacheMisses:     a.DocCacheMisses + b.DocCacheMisses,
-		DocMissingCacheHit: a.DocMissingCacheHit + b.DocMissingCacheHit,
-		DocsMissing:        a.DocsMissing + b.DocsMissing,
-		CollectionQueries:  a.CollectionQueries + b.CollectionQueries,
-		DocReads:           a.DocReads + b.DocReads,
-		DocStillMissing:    a.DocStillMissing + b.DocStillMissing,
-		StashQueries:       a.StashQueries + b.StashQueries,
-		StashDocReads:      a.StashDocReads + b.StashDocReads,
-		StashDocsRemoved:   a.StashDocsRemoved + b.StashDocsRemoved,
-		DocQueuesCleaned:   a.DocQueuesCleaned + b.DocQueuesCleaned,
-		DocTokensCleaned:   a.DocTokensCleaned + b.DocTokensCleaned,
-		DocsAlreadyClean:   a.DocsAlreadyClean + b.DocsAlreadyClean,
-		TxnsRemoved:        a.TxnsRemoved + b.TxnsRemoved,
-		TxnsNotRemoved:     a.TxnsNotRemoved + b.TxnsNotRemoved,
-		StrCacheHits:       a.StrCacheHits + b.StrCacheHits,
-		StrCacheMisses:     a.StrCacheMisses + b.StrCacheMisses,
+	a.Add(&b)
+	return a
+}
+
+// Add adds other to the stats in place. Unlike CombineStats, it doesn't
+// copy either struct, which matters when merging often.
+func (ps *PrunerStats) Add(other *PrunerStats) {
+	ps.CacheLookupTime += other.CacheLookupTime
+	ps.DocLookupTime += other.DocLookupTime
+	ps.DocCleanupTime += other.DocCleanupTime
+	ps.DocReadTime += other.DocReadTime
+	ps.StashLookupTime += other.StashLookupTime
+	ps.StashRemoveTime += other.StashRemoveTime
+	ps.TxnReadTime += other.TxnReadTime
+	ps.TxnRemoveTime += other.TxnRemoveTime
+	ps.LoadSleepTime += other.LoadSleepTime
+	ps.OplogSleepTime += other.OplogSleepTime
+	ps.DocCacheHits += other.DocCacheHits
+	ps.DocCacheMisses += other.DocCacheMisses
+	ps.DocMissingCacheHit += other.DocMissingCacheHit
+	ps.DocsMissing += other.DocsMissing
+	ps.CollectionQueries += other.CollectionQueries
+	ps.DocReads += other.DocReads
+	ps.DocStillMissing += other.DocStillMissing
+	ps.DocBatchSplits += other.DocBatchSplits
+	ps.StashQueries += other.StashQueries
+	ps.StashDocReads += other.StashDocReads
+	ps.StashDocsRemoved += other.StashDocsRemoved
+	ps.StashBulkCleanups += other.StashBulkCleanups
+	ps.DocQueuesCleaned += other.DocQueuesCleaned
+	ps.DocTokensCleaned += other.DocTokensCleaned
+	ps.DocsAlreadyClean += other.DocsAlreadyClean
+	ps.TxnsRemoved += other.TxnsRemoved
+	ps.TxnsNotRemoved += other.TxnsNotRemoved
+	ps.TxnsAlreadyRemoved += other.TxnsAlreadyRemoved
+	ps.StrCacheHits += other.StrCacheHits
+	ps.StrCacheMisses += other.StrCacheMisses
+	ps.InvalidTokens += other.InvalidTokens
+	ps.InvalidTokensRemoved += other.InvalidTokensRemoved
+	ps.MissingTxnTokens += other.MissingTxnTokens
+	ps.DocsFiltered += other.DocsFiltered
+	ps.CollScans += other.CollScans
+	ps.SlowQueries += other.SlowQueries
+	ps.PeakHeapBytes = maxInt64(ps.PeakHeapBytes, other.PeakHeapBytes)
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
 	}
+	return b
 }
 
 func NewIncrementalPruner(args IncrementalPruneArgs) *IncrementalPruner {
@@ -199,15 +677,79 @@ func NewIncrementalPruner(args IncrementalPruneArgs) *IncrementalPruner {
 	if args.TxnBatchSleepTime > maxBatchSleepTime {
 		args.TxnBatchSleepTime = maxBatchSleepTime
 	}
+	if args.LoadPollInterval <= 0 {
+		args.LoadPollInterval = defaultLoadPollInterval
+	}
+	if args.MaxLoadSuspend <= 0 {
+		args.MaxLoadSuspend = defaultMaxLoadSuspend
+	}
+	if args.LargeDocSize <= 0 {
+		args.LargeDocSize = defaultLargeDocSize
+	}
+	if args.DocBatchSize <= 0 {
+		args.DocBatchSize = queueBatchSize
+	}
 	return &IncrementalPruner{
 		maxTime:        args.MaxTime,
+		startAfter:     args.StartAfter,
 		reverse:        args.ReverseOrder,
+		maxTxns:        args.MaxTransactionsToProcess,
 		txnBatchSize:   args.TxnBatchSize,
 		batchSleepTime: args.TxnBatchSleepTime,
 		ProgressChan:   args.ProgressChannel,
 		docCache:       docCache{cache: lru.New(pruneDocCacheSize)},
 		missingCache:   missingKeyCache{cache: lru.New(missingKeyCacheSize)},
 		strCache:       lru.NewStringCache(strCacheSize),
+		collPriority:   args.CollectionPriority,
+		collStats:      make(map[string]*CollectionPruneStats),
+
+		loadMonitor:      args.LoadMonitor,
+		loadPollInterval: args.LoadPollInterval,
+		maxLoadSuspend:   args.MaxLoadSuspend,
+		deadline:         args.deadline,
+		oplogPacer:       args.OplogPacer,
+
+		scanSession: args.ScanSession,
+		maxScanLag:  args.MaxScanLag,
+
+		stashOrder:       args.StashOrder,
+		bulkStashCleanup: args.BulkStashCleanup,
+
+		largeDocSize: args.LargeDocSize,
+		sizeSampled:  make(map[string]bool),
+
+		readWholeDocs: args.ReadWholeDocuments,
+
+		indexHints:  args.IndexHints,
+		planChecked: make(map[string]bool),
+		explainSlow: args.ExplainSlowQueries,
+
+		docBatchSize:     args.DocBatchSize,
+		maxDocBatchSize:  args.DocBatchSize,
+		docBatchDeadline: args.DocBatchDeadline,
+		collectionScans:  args.CollectionScans,
+
+		stripInvalidTokens: args.StripInvalidTokens,
+		checkMissingTxns:   args.CheckMissingTxns,
+
+		metadataFilter: args.MetadataFilter,
+
+		docFilter:    args.DocFilter,
+		docFields:    docFields(args.DocFilterFields),
+		filteredDocs: make(map[docKey]struct{}),
+
+		removals:   &removalCounters{},
+		cleanOnly:  args.CleanOnly,
+		removeOnly: args.RemoveOnly && !args.CleanOnly,
+		archive:    args.Archive,
+		onRemove:   args.OnRemove,
+
+		profileLabels: args.ProfileLabels,
+		slowBatch:     args.StartCPUProfileOnSlowBatch,
+		profileDir:    args.CPUProfileDir,
+
+		job:     args.job,
+		metrics: args.metrics,
 	}
 }
 
@@ -215,16 +757,35 @@ func (p *IncrementalPruner) Prune(txns *mgo.Collection) (PrunerStats, error) {
 	session := txns.Database.Session.Copy()
 	defer session.Close()
 	txns = txns.With(session)
+	store := mgoStore{db: txns.Database, hints: p.indexHints}
 	txnsStashName := txns.Name + ".stash"
-	txnsStash := txns.Database.C(txnsStashName)
 	errorCh := make(chan error, 100)
 	var wg sync.WaitGroup
+	defer p.clearProfileLabels()
+	defer p.stopBatchProfile()
 
-	iter := p.findTxnsQuery(txns)
+	scanTxns := txns
+	if p.scanSession != nil {
+		scanSession := p.scanSession.Copy()
+		defer scanSession.Close()
+		scanTxns = txns.With(scanSession)
+	}
+	if p.indexHints != nil {
+		p.chooseTxnsHint(scanTxns)
+		p.checkPlan(mgoStore{db: scanTxns.Database}, p.txnsQuery(scanTxns.Name))
+	}
+	iter := p.findTxnsQuery(scanTxns)
 	done := false
 	for !done {
 		var err error
-		done, err = p.pruneNextBatch(iter, txns, txnsStash, errorCh, &wg)
+		if p.scanSession != nil {
+			err = checkScanLag(scanTxns.Database.Session, p.maxScanLag)
+		}
+		if err == nil {
+			batchStart := time.Now()
+			done, err = p.pruneNextBatch(iter, store, txns.Name, txnsStashName, errorCh, &wg)
+			p.profileSlowBatch(time.Since(batchStart))
+		}
 		if err != nil {
 			done = true
 			// It is a little weird to buffer an error to our own loop, but we have
@@ -235,13 +796,30 @@ func (p *IncrementalPruner) Prune(txns *mgo.Collection) (PrunerStats, error) {
 		if !done && p.batchSleepTime != 0 {
 			time.Sleep(p.batchSleepTime)
 		}
+		if !done {
+			more, err := p.waitForLoad()
+			if err != nil {
+				done = true
+				errorCh <- err
+			} else if !more {
+				done = true
+			}
+		}
+		if !done {
+			p.waitForOplog()
+			if err := p.job.checkpoint(); err != nil {
+				done = true
+				errorCh <- err
+			}
+		}
 	}
 	if err := iter.Close(); err != nil {
-		logger.Warningf("error closing iteration: %v", err)
+		pruneLogger.Warningf("error closing iteration: %v", err)
 		errorCh <- errors.Trace(err)
 	}
 	// Wait for all txn.Remove to be finished
 	wg.Wait()
+	p.removals.addTo(&p.stats)
 	var firstErr error
 	empty := false
 	for !empty {
@@ -250,7 +828,7 @@ func (p *IncrementalPruner) Prune(txns *mgo.Collection) (PrunerStats, error) {
 			if firstErr == nil {
 				firstErr = err
 			} else {
-				logger.Warningf("error while processing: %v", err)
+				pruneLogger.Warningf("error while processing: %v", err)
 			}
 		default:
 			empty = true
@@ -260,33 +838,215 @@ func (p *IncrementalPruner) Prune(txns *mgo.Collection) (PrunerStats, error) {
 	p.stats.StrCacheHits = hits.Hit
 	p.stats.StrCacheMisses = hits.Miss
 	if firstErr == nil {
-		firstErr = p.cleanupStash(txnsStash)
+		p.report(ProgressMessage{Phase: PrunePhaseRemovingStash})
+		firstErr = p.cleanupStash(store, txnsStashName)
+	}
+	if p.stats.InvalidTokens > 0 {
+		pruneLogger.Warningf("found %d invalid tokens in document queues, removed %d",
+			p.stats.InvalidTokens, p.stats.InvalidTokensRemoved)
+	}
+	if p.stats.MissingTxnTokens > 0 {
+		pruneLogger.Warningf("found %d tokens for missing transactions in document queues", p.stats.MissingTxnTokens)
 	}
-	logger.Debugf("%s", p.stats)
+	pruneLogger.Debugf("%s", p.stats)
 	return p.stats, errors.Trace(firstErr)
 }
 
-func (p *IncrementalPruner) findTxnsQuery(txns *mgo.Collection) *mgo.Iter {
+// worker names the pruner, as in WorkerError.
+func (p *IncrementalPruner) worker() string {
+	if p.reverse {
+		return "reverse"
+	}
+	return "forward"
+}
+
+// CollectionStats returns the work done against each collection by the
+// last call to Prune, sorted by collection name.
+func (p *IncrementalPruner) CollectionStats() []CollectionPruneStats {
+	return sortedCollectionStats(p.collStats)
+}
+
+// skipCollection records that the documents in collection can't have
+// their txn-queues cleaned, so that we stop trying and keep the
+// transactions that touched them.
+func (p *IncrementalPruner) skipCollection(collection, reason string, err error) {
+	pruneLogger.Warningf("skipping documents in %s %q: %v", reason, collection, err)
+	p.collectionStats(collection).Skipped = reason
+}
+
+// collectionSkipped returns true if the documents in collection can't be
+// cleaned.
+func (p *IncrementalPruner) collectionSkipped(collection string) bool {
+	s, ok := p.collStats[collection]
+	return ok && s.Skipped != ""
+}
+
+// touchesSkippedCollection returns true if txn has an op on a document in
+// a collection that we couldn't clean.
+func (p *IncrementalPruner) touchesSkippedCollection(txn txnDoc) bool {
+	for _, op := range txn.Ops {
+		if p.collectionSkipped(op.Collection) {
+			return true
+		}
+	}
+	return false
+}
+
+// touchesFilteredDoc returns true if txn touched a document of this batch
+// that DocFilter said to skip.
+func (p *IncrementalPruner) touchesFilteredDoc(txn txnDoc) bool {
+	if len(p.filteredDocs) == 0 {
+		return false
+	}
+	for _, op := range txn.Ops {
+		if _, ok := p.filteredDocs[op]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *IncrementalPruner) collectionStats(collection string) *CollectionPruneStats {
+	s, ok := p.collStats[collection]
+	if !ok {
+		s = &CollectionPruneStats{Name: collection}
+		p.collStats[collection] = s
+	}
+	return s
+}
+
+// collectionOrder returns the collections to be read, highest priority
+// first.
+func (p *IncrementalPruner) collectionOrder(docsByCollection map[string][]interface{}) []string {
+	names := make([]string, 0, len(docsByCollection))
+	for name := range docsByCollection {
+		names = append(names, name)
+	}
+	if len(p.collPriority) == 0 {
+		return names
+	}
+	sort.Slice(names, func(i, j int) bool {
+		pi, pj := p.collPriority[names[i]], p.collPriority[names[j]]
+		if pi != pj {
+			return pi > pj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// LimitReached returns true if the last call to Prune stopped early because
+// MaxTransactionsToProcess transactions had been evaluated. There may be
+// more transactions that could be pruned by another pass.
+func (p *IncrementalPruner) LimitReached() bool {
+	return p.limitReached
+}
+
+// queueFields selects the fields of a document that are needed to clean
+// its txn-queue.
+var queueFields = bson.M{"_id": 1, "txn-queue": 1}
+
+// DocFilter decides whether the pruner may clean the txn-queue of a
+// document. See IncrementalPruneArgs.DocFilter.
+type DocFilter func(collection string, raw bson.Raw) bool
+
+// docFields returns the fields to read from documents being cleaned: the
+// queueFields and any extra fields.
+func docFields(extra []string) bson.M {
+	if len(extra) == 0 {
+		return queueFields
+	}
+	fields := bson.M{}
+	for field := range queueFields {
+		fields[field] = 1
+	}
+	for _, field := range extra {
+		fields[field] = 1
+	}
+	return fields
+}
+
+// projection returns fields, or nil to read whole documents if projections
+// are disabled.
+func (p *IncrementalPruner) projection(fields bson.M) bson.M {
+	if p.readWholeDocs {
+		return nil
+	}
+	return fields
+}
+
+func (p *IncrementalPruner) findTxnsQuery(txns *mgo.Collection) docIter {
 	if !p.maxTime.IsZero() {
-		logger.Debugf("looking for completed transactions older than %s", p.maxTime)
+		pruneLogger.Debugf("looking for completed transactions older than %s", p.maxTime)
 	} else {
-		logger.Debugf("looking for all completed transactions")
+		pruneLogger.Debugf("looking for all completed transactions")
+	}
+	if !p.metadataFilter.IsZero() {
+		pruneLogger.Debugf("only pruning transactions with %s", p.metadataFilter)
 	}
-	query := txns.Find(completedOldTransactionMatch(p.maxTime))
-	query.Select(bson.M{
+	if p.startAfter != "" {
+		pruneLogger.Debugf("starting after transaction %s", p.startAfter.Hex())
+	}
+	query := txns.Find(p.txnsMatch())
+	query.Select(p.projection(bson.M{
 		"_id": 1,
 		"o.c": 1,
 		"o.d": 1,
-	})
+	}))
 	// Sorting by _id helps make sure that we are grouping the transactions close to each other for removals
 	if p.reverse {
 		query.Sort("-_id")
 	} else {
 		query.Sort("_id")
 	}
+	if p.txnsHint != nil {
+		query.Hint(p.txnsHint...)
+	}
 	query.Batch(p.txnBatchSize)
 	return query.Iter()
+}
+
+// txnsSort is the sort order of the scan of transactions, as sent to the
+// server.
+func (p *IncrementalPruner) txnsSort() bson.D {
+	if p.reverse {
+		return bson.D{{"_id", -1}}
+	}
+	return bson.D{{"_id", 1}}
+}
+
+// txnsMatch selects the transactions to be pruned.
+func (p *IncrementalPruner) txnsMatch() bson.M {
+	match := prunableTxnsMatch(p.maxTime, p.metadataFilter)
+	if p.startAfter != "" {
+		idMatch, _ := match["_id"].(bson.M)
+		if idMatch == nil {
+			idMatch = bson.M{}
+			match["_id"] = idMatch
+		}
+		idMatch["$gt"] = p.startAfter
+	}
+	return match
+}
 
+// prunableTxnsMatch matches the completed transactions older than maxTime,
+// if it is set, with metadata matching the filter.
+func prunableTxnsMatch(maxTime time.Time, metadataFilter TxnMetadata) bson.M {
+	match := completedOldTransactionMatch(maxTime)
+	for field, value := range metadataFilter.selector() {
+		match[field] = value
+	}
+	return match
+}
+
+// report sends msg on the progress channel, if there is one.
+func (p *IncrementalPruner) report(msg ProgressMessage) {
+	if msg.Phase != "" {
+		p.setProfileLabels(msg.Phase, msg.Collection)
+	}
+	if p.ProgressChan != nil {
+		p.ProgressChan <- msg
+	}
 }
 
 func checkTime(toAdd *time.Duration) func() {
@@ -296,52 +1056,124 @@ func checkTime(toAdd *time.Duration) func() {
 	}
 }
 
-func (p *IncrementalPruner) cleanupStash(txnsStash *mgo.Collection) error {
+func (p *IncrementalPruner) cleanupStash(writer bulkWriter, txnsStashName string) error {
 	tStart := time.Now()
 	// TODO(jam):  2018-12-12 Do we need to worry about the txn-remove/txn-insert
 	//  attributes?
-	info, err := txnsStash.RemoveAll(
+	removed, err := writer.removeAll(txnsStashName,
 		bson.M{"txn-queue.0": bson.M{"$exists": 0}},
 	)
 	p.stats.StashRemoveTime = time.Since(tStart)
-	p.stats.StashDocsRemoved = int64(info.Removed)
+	p.stats.StashDocsRemoved = int64(removed)
 	if err != nil {
 		return errors.Trace(err)
 	}
 	return nil
 }
 
-func (p *IncrementalPruner) pruneNextBatch(iter *mgo.Iter, txnsColl, txnsStash *mgo.Collection, errorCh chan error, wg *sync.WaitGroup) (bool, error) {
+func (p *IncrementalPruner) pruneNextBatch(
+	iter docIter,
+	store pruneStore,
+	txnsName, txnsStashName string,
+	errorCh chan error,
+	wg *sync.WaitGroup,
+) (bool, error) {
+	p.batch++
+	for key := range p.filteredDocs {
+		delete(p.filteredDocs, key)
+	}
+	tStart := time.Now()
+	cleanedBefore := p.stats.DocQueuesCleaned
+	p.report(ProgressMessage{Phase: PrunePhaseScanning, Batch: p.batch})
+	scanStart := time.Now()
 	done, txns, txnsBeingCleaned, docsToCheck := p.findTxnsAndDocsToLookup(iter)
+	p.explainSlowQuery(store, p.txnsQuery(txnsName), time.Since(scanStart))
 	// Now that we have a bunch of documents we want to look at, load them from the collections
-	foundDocs, err := p.lookupDocs(docsToCheck, txnsStash)
+	foundDocs, err := p.lookupDocs(docsToCheck, store, txnsStashName)
 	if err != nil {
 		return done, errors.Trace(err)
 	}
+	if p.checkMissingTxns {
+		if err := p.countMissingTxnTokens(foundDocs, txnsBeingCleaned, store, txnsName); err != nil {
+			return done, errors.Trace(err)
+		}
+	}
 
-	if err := p.cleanupDocs(foundDocs, txns, txnsBeingCleaned, txnsColl.Database, txnsStash); err != nil {
+	var referenced map[bson.ObjectId]bool
+	if p.removeOnly {
+		referenced = referencedTxns(foundDocs, txns)
+	} else if err := p.cleanupDocs(foundDocs, txns, txnsBeingCleaned, store, txnsStashName); err != nil {
 		return done, errors.Trace(err)
 	}
-	if len(txns) > 0 {
-		txnsToRemove := make([]bson.ObjectId, len(txns))
-		for i, txn := range txns {
-			txnsToRemove[i] = txn.Id
+	// The documents of the batch are still in memory.
+	p.sampleMemory()
+	txnsToRemove := make([]bson.ObjectId, 0, len(txns))
+	for _, txn := range txns {
+		if p.cleanOnly {
+			break
+		}
+		if p.touchesSkippedCollection(txn) || p.touchesFilteredDoc(txn) || referenced[txn.Id] {
+			// Its tokens are still in documents we couldn't, or
+			// weren't to, clean.
+			p.stats.TxnsNotRemoved++
+			continue
+		}
+		txnsToRemove = append(txnsToRemove, txn.Id)
+	}
+	if len(txnsToRemove) > 0 {
+		if err := p.archiveTxns(txnsToRemove, store, txnsName); err != nil {
+			return done, errors.Trace(err)
 		}
-		p.removeTxns(txnsToRemove, txnsColl, errorCh, wg)
+		p.removeTxns(txnsToRemove, store, txnsName, errorCh, wg)
 	}
+	if len(txns) > 0 {
+		// Everything up to here has been dealt with.
+		p.checkpoint = txns[len(txns)-1].Id
+	}
+	p.metrics.batch(p.worker(), PruneMetric{
+		Time:        time.Now().UTC(),
+		Seconds:     time.Since(tStart).Seconds(),
+		TxnsRemoved: len(txnsToRemove),
+		DocsCleaned: int(p.stats.DocQueuesCleaned - cleanedBefore),
+		Batch:       p.batch,
+		TxnsRead:    len(txns),
+	})
 	return done, nil
 }
 
+// referencedTxns returns the transactions whose tokens are still in the
+// queues of the documents they touched.
+func referencedTxns(foundDocs docMap, txns []txnDoc) map[bson.ObjectId]bool {
+	referenced := make(map[bson.ObjectId]bool)
+	for _, txn := range txns {
+		for _, key := range txn.Ops {
+			doc, ok := foundDocs[key]
+			if !ok {
+				continue
+			}
+			for _, id := range doc.txns {
+				if id == txn.Id {
+					referenced[txn.Id] = true
+				}
+			}
+		}
+	}
+	return referenced
+}
+
 // lookupDocs searches the cache and then looks in the database for the txn-queue of all the referenced document keys.
-func (p *IncrementalPruner) lookupDocs(keys docKeySet, txnsStash *mgo.Collection) (docMap, error) {
+func (p *IncrementalPruner) lookupDocs(keys docKeySet, finder docReader, txnsStashName string) (docMap, error) {
 	defer checkTime(&p.stats.DocLookupTime)()
 	docs, docsByCollection := p.lookupDocsInCache(keys)
-	missingKeys, err := p.updateDocsFromCollections(docs, docsByCollection, txnsStash.Database)
+	if p.stashOrder == StashFirst {
+		return docs, p.lookupStashFirst(docs, docsByCollection, finder, txnsStashName)
+	}
+	missingKeys, err := p.updateDocsFromCollections(docs, docsByCollection, finder)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 	if len(missingKeys) > 0 {
-		err := p.updateDocsFromStash(docs, missingKeys, txnsStash)
+		err := p.updateDocsFromStash(docs, missingKeys, finder, txnsStashName)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
@@ -350,7 +1182,42 @@ func (p *IncrementalPruner) lookupDocs(keys docKeySet, txnsStash *mgo.Collection
 	return docs, nil
 }
 
-func (p *IncrementalPruner) findTxnsAndDocsToLookup(iter *mgo.Iter) (bool, []txnDoc, map[bson.ObjectId]struct{}, docKeySet) {
+// lookupStashFirst reads the documents that weren't in the cache from the
+// stash, and then the ones that aren't in the stash from their
+// collections.
+func (p *IncrementalPruner) lookupStashFirst(
+	docs docMap,
+	docsByCollection map[string][]interface{},
+	finder docReader,
+	txnsStashName string,
+) error {
+	stashKeys := make(map[stashDocKey]struct{})
+	for collection, ids := range docsByCollection {
+		for _, id := range ids {
+			stashKeys[stashDocKey{Collection: collection, Id: id}] = struct{}{}
+		}
+	}
+	if len(stashKeys) == 0 {
+		return nil
+	}
+	if err := p.updateDocsFromStash(docs, stashKeys, finder, txnsStashName); err != nil {
+		return errors.Trace(err)
+	}
+	remaining := make(map[string][]interface{}, len(docsByCollection))
+	for collection, ids := range docsByCollection {
+		for _, id := range ids {
+			if _, found := docs[docKey{Collection: collection, DocId: id}]; !found {
+				remaining[collection] = append(remaining[collection], id)
+			}
+		}
+	}
+	// Anything not found in either place is dealt with as missing when
+	// the documents are cleaned.
+	_, err := p.updateDocsFromCollections(docs, remaining, finder)
+	return errors.Trace(err)
+}
+
+func (p *IncrementalPruner) findTxnsAndDocsToLookup(iter docIter) (bool, []txnDoc, map[bson.ObjectId]struct{}, docKeySet) {
 	defer checkTime(&p.stats.TxnReadTime)()
 	done := false
 	// First, read all the txns to find the document identities we might care about
@@ -358,10 +1225,22 @@ func (p *IncrementalPruner) findTxnsAndDocsToLookup(iter *mgo.Iter) (bool, []txn
 	// We expect a doc in each txn
 	docsToCheck := make(docKeySet, p.txnBatchSize)
 	txnsBeingCleaned := make(map[bson.ObjectId]struct{})
-	for count := 0; count < p.txnBatchSize; count++ {
+	batchSize := p.txnBatchSize
+	if p.maxTxns > 0 && p.maxTxns-p.txnsRead <= batchSize {
+		// This is the last batch we are allowed to read.
+		batchSize = p.maxTxns - p.txnsRead
+		p.limitReached = true
+		done = true
+	}
+	for count := 0; count < batchSize; count++ {
 		var txn txnDoc
 		if iter.Next(&txn) {
+			p.txnsRead++
 			txn.Id = p.cacheTxnId(txn.Id)
+			if p.firstTxnId == "" {
+				p.firstTxnId = txn.Id
+			}
+			p.lastTxnId = txn.Id
 			for i := range txn.Ops {
 				txn.Ops[i] = p.cacheKey(txn.Ops[i])
 			}
@@ -376,7 +1255,10 @@ func (p *IncrementalPruner) findTxnsAndDocsToLookup(iter *mgo.Iter) (bool, []txn
 			}
 			txnsBeingCleaned[txn.Id] = struct{}{}
 		} else {
+			// We ran out of transactions before hitting the limit.
+			p.limitReached = false
 			done = true
+			break
 		}
 	}
 	return done, txns, txnsBeingCleaned, docsToCheck
@@ -387,7 +1269,11 @@ func (p *IncrementalPruner) lookupDocsInCache(keys docKeySet) (docMap, map[strin
 	docs := make(docMap, len(docKeySet{}))
 	docsByCollection := make(map[string][]interface{}, 0)
 	for key, _ := range keys {
-		cacheDoc, exists := p.docCache.Get(key)
+		var cacheDoc docWithQueue
+		exists := false
+		if p.docFilter == nil {
+			cacheDoc, exists = p.docCache.Get(key)
+		}
 		if exists {
 			// Found in cache.
 			// Note that it is possible we'll actually be looking at a document that has since been updated.
@@ -435,17 +1321,18 @@ func (p *IncrementalPruner) cacheTxnId(objId bson.ObjectId) bson.ObjectId {
 	return bson.ObjectId(p.cacheString(string(objId)))
 }
 
-func (p *IncrementalPruner) cacheDoc(collection string, docId interface{}, queue []string, docs docMap) docWithQueue {
+func (p *IncrementalPruner) cacheDoc(collection string, docId interface{}, queue []string, stashed bool, docs docMap) docWithQueue {
 	docId = p.cacheObj(docId)
 	key := docKey{Collection: p.cacheString(collection), DocId: docId}
 	for i := range queue {
 		queue[i] = p.cacheString(queue[i])
 	}
-	txns := p.txnsFromTokens(queue)
+	txns := p.txnsFromTokens(key, queue)
 	doc := docWithQueue{
-		Id:    docId,
-		Queue: queue,
-		txns:  txns,
+		Id:      docId,
+		Queue:   queue,
+		txns:    txns,
+		stashed: stashed,
 	}
 	p.docCache.Add(key, doc)
 	docs[key] = doc
@@ -496,46 +1383,227 @@ func (mkc *missingKeyCache) IsMissing(key docKey) bool {
 func (p *IncrementalPruner) updateDocsFromCollections(
 	docs docMap,
 	docsByCollection map[string][]interface{},
-	db *mgo.Database,
+	finder docReader,
 ) (map[stashDocKey]struct{}, error) {
 	defer checkTime(&p.stats.DocReadTime)()
 	missingKeys := make(map[stashDocKey]struct{}, 0)
-	for collection, ids := range docsByCollection {
-		missing := make(map[interface{}]struct{}, len(ids))
-		for _, id := range ids {
-			missing[id] = struct{}{}
-		}
-		coll := db.C(collection)
-		query := coll.Find(bson.M{"_id": bson.M{"$in": ids}})
-		query.Select(bson.M{"_id": 1, "txn-queue": 1})
-		query.Batch(queryDocBatchSize)
-		iter := query.Iter()
-		p.stats.CollectionQueries++
+	order := p.collectionOrder(docsByCollection)
+	if p.collectionScans == nil {
+		for _, collection := range order {
+			err := p.readCollection(collection, docsByCollection[collection], docs, missingKeys, finder)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		return missingKeys, nil
+	}
+	// Start reading the collections in order, as many at once as the
+	// limiter allows.
+	var wg sync.WaitGroup
+	errs := make([]error, len(order))
+	for i, collection := range order {
+		p.collectionScans.acquire()
+		wg.Add(1)
+		go func(i int, collection string) {
+			defer wg.Done()
+			defer p.collectionScans.release()
+			errs[i] = p.readCollection(collection, docsByCollection[collection], docs, missingKeys, finder)
+		}(i, collection)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return missingKeys, nil
+}
+
+// readCollection reads the documents in collection whose _id is one of
+// ids into docs, and adds the ones that weren't found to missingKeys. It
+// may be called for several collections at once.
+func (p *IncrementalPruner) readCollection(
+	collection string,
+	ids []interface{},
+	docs docMap,
+	missingKeys map[stashDocKey]struct{},
+	finder docReader,
+) error {
+	p.readMu.Lock()
+	collStats := p.collectionStats(collection)
+	p.sampleDocSize(collection, collStats, finder)
+	p.checkDocPlan(collection, ids, finder)
+	p.readMu.Unlock()
+
+	tStart := time.Now()
+	missing := make(map[interface{}]struct{}, len(ids))
+	for _, id := range ids {
+		missing[id] = struct{}{}
+	}
+	var decodeErr error
+	err := p.findIdsInBatches(finder, collection, ids, p.docFields, func(iter docIter) (interface{}, bool) {
 		var doc docWithQueue
-		for iter.Next(&doc) {
-			doc = p.cacheDoc(collection, doc.Id, doc.Queue, docs)
-			p.stats.DocReads++
-			delete(missing, doc.Id)
+		var skip bool
+		if p.docFilter == nil {
+			if !iter.Next(&doc) {
+				return nil, false
+			}
+		} else {
+			var raw bson.Raw
+			if !iter.Next(&raw) {
+				return nil, false
+			}
+			if decodeErr = raw.Unmarshal(&doc); decodeErr != nil {
+				return nil, false
+			}
+			skip = !p.docFilter(collection, raw)
 		}
-		p.stats.DocStillMissing += int64(len(missing))
-		for id, _ := range missing {
-			stashKey := stashDocKey{Collection: collection, Id: id}
-			missingKeys[stashKey] = struct{}{}
+		p.readMu.Lock()
+		defer p.readMu.Unlock()
+		p.stats.DocReads++
+		collStats.DocsRead++
+		delete(missing, doc.Id)
+		if skip {
+			p.stats.DocsFiltered++
+			p.filteredDocs[docKey{Collection: p.cacheString(collection), DocId: p.cacheObj(doc.Id)}] = struct{}{}
+			return doc.Id, true
+		}
+		doc = p.cacheDoc(collection, doc.Id, doc.Queue, false, docs)
+		return doc.Id, true
+	}, &p.stats.CollectionQueries)
+
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	collStats.ReadTime += time.Since(tStart)
+	if err == nil {
+		err = decodeErr
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	p.stats.DocStillMissing += int64(len(missing))
+	for id := range missing {
+		stashKey := stashDocKey{Collection: collection, Id: id}
+		missingKeys[stashKey] = struct{}{}
+	}
+	return nil
+}
+
+// findIdsInBatches reads the given fields of the documents in collection
+// whose _id is one of ids, docBatchSize at a time, counting each query in
+// queries. next reads a document from the iterator and returns its _id,
+// or false once there are no more. A batch that takes longer than
+// docBatchDeadline is cut short, and the ids it didn't get to are read
+// again in smaller batches.
+func (p *IncrementalPruner) findIdsInBatches(
+	finder docReader,
+	collection string,
+	ids []interface{},
+	fields bson.M,
+	next func(docIter) (interface{}, bool),
+	queries *int64,
+) error {
+	for len(ids) > 0 {
+		p.readMu.Lock()
+		size := p.docBatchSize
+		*queries++
+		p.readMu.Unlock()
+		if size > len(ids) {
+			size = len(ids)
 		}
+		batch := ids[:size]
+		ids = ids[size:]
 
+		tStart := time.Now()
+		iter := finder.findIds(collection, batch, p.projection(fields))
+		read := make(map[interface{}]bool, len(batch))
+		cut := false
+		for {
+			id, ok := next(iter)
+			if !ok {
+				break
+			}
+			read[id] = true
+			if p.docBatchDeadline > 0 && len(batch) > minDocBatchSize && time.Since(tStart) > p.docBatchDeadline {
+				cut = len(read) < len(batch)
+				break
+			}
+		}
 		if err := iter.Close(); err != nil {
-			return nil, errors.Trace(err)
+			return errors.Trace(err)
+		}
+		elapsed := time.Since(tStart)
+		p.explainSlowQuery(finder, p.docsQuery(collection, batch), elapsed)
+		if cut {
+			var unread []interface{}
+			for _, id := range batch {
+				if !read[id] {
+					unread = append(unread, id)
+				}
+			}
+			ids = append(unread, ids...)
 		}
+		p.adjustDocBatchSize(collection, len(batch), cut, elapsed)
+	}
+	return nil
+}
+
+// adjustDocBatchSize halves the size of document batches after a batch of
+// size was cut short, and grows it back after batches that were quick.
+func (p *IncrementalPruner) adjustDocBatchSize(collection string, size int, cut bool, elapsed time.Duration) {
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	switch {
+	case cut:
+		p.docBatchSize = size / 2
+		if p.docBatchSize < minDocBatchSize {
+			p.docBatchSize = minDocBatchSize
+		}
+		p.stats.DocBatchSplits++
+		pruneLogger.Debugf("reading %d documents from %q took over %s, reducing batches to %d",
+			size, collection, p.docBatchDeadline, p.docBatchSize)
+	case p.docBatchDeadline > 0 && elapsed < p.docBatchDeadline/2 && p.docBatchSize < p.maxDocBatchSize:
+		p.docBatchSize *= 2
+		if p.docBatchSize > p.maxDocBatchSize {
+			p.docBatchSize = p.maxDocBatchSize
+		}
+	}
+}
+
+// sampleDocSize reads the average document size of collection, the first
+// time it is seen, and warns if the documents are large.
+func (p *IncrementalPruner) sampleDocSize(collection string, collStats *CollectionPruneStats, sizer docSizer) {
+	if p.sizeSampled[collection] {
+		return
+	}
+	p.sizeSampled[collection] = true
+	size, err := sizer.avgDocSize(collection)
+	if err != nil {
+		pruneLogger.Debugf("unable to read document size of %q: %v", collection, err)
+		return
+	}
+	collStats.AvgDocSize = size
+	if size > int64(p.largeDocSize) {
+		pruneLogger.Warningf("documents in %q average %d bytes (over %d); "+
+			"avoid ReadWholeDocuments, as reading them whole is expensive",
+			collection, size, p.largeDocSize)
 	}
-	return missingKeys, nil
 }
 
 // Txns returns the Transaction ObjectIds associated with each token.
 // These are cached on the doc object, so that we don't have to convert repeatedly.
-func (p *IncrementalPruner) txnsFromTokens(tokens []string) []bson.ObjectId {
+// Malformed tokens are counted, and get an empty id, which no transaction
+// being pruned has, so they are left in the queue.
+func (p *IncrementalPruner) txnsFromTokens(key docKey, tokens []string) []bson.ObjectId {
 	txns := make([]bson.ObjectId, len(tokens))
 	for i := range tokens {
-		txns[i] = p.cacheTxnId(txnTokenToId(tokens[i]))
+		tok, err := ParseToken(tokens[i])
+		if err != nil {
+			pruneLogger.Debugf("document %v in %q: %v", key.DocId, key.Collection, err)
+			p.stats.InvalidTokens++
+			continue
+		}
+		txns[i] = p.cacheTxnId(tok.Id)
 	}
 	return txns
 }
@@ -543,7 +1611,8 @@ func (p *IncrementalPruner) txnsFromTokens(tokens []string) []bson.ObjectId {
 func (p *IncrementalPruner) updateDocsFromStash(
 	docs docMap,
 	missingKeys map[stashDocKey]struct{},
-	txnsStash *mgo.Collection,
+	finder docReader,
+	txnsStashName string,
 ) error {
 	defer checkTime(&p.stats.StashLookupTime)()
 	// Note: there is some danger that new transactions will be adding and removing a document that we
@@ -552,24 +1621,20 @@ func (p *IncrementalPruner) updateDocsFromStash(
 	// referenced. However, the act of adding or remove a document should be cleaning up the txn queue anyway,
 	// which means it is safe to delete the document
 	// For all the other documents, now we need to check txns.stash
-	p.stats.StashQueries++
-	missingSlice := make([]stashDocKey, 0, len(missingKeys))
+	missingSlice := make([]interface{}, 0, len(missingKeys))
 	for key := range missingKeys {
 		missingSlice = append(missingSlice, key)
 	}
-	query := txnsStash.Find(bson.M{"_id": bson.M{"$in": missingSlice}})
-	query.Select(bson.M{"_id": 1, "txn-queue": 1})
-	query.Batch(queryDocBatchSize)
-	iter := query.Iter()
-	var doc stashEntry
-	for iter.Next(&doc) {
-		p.cacheDoc(doc.Id.Collection, doc.Id.Id, doc.Queue, docs)
+	err := p.findIdsInBatches(finder, txnsStashName, missingSlice, queueFields, func(iter docIter) (interface{}, bool) {
+		var doc stashEntry
+		if !iter.Next(&doc) {
+			return nil, false
+		}
+		p.cacheDoc(doc.Id.Collection, doc.Id.Id, doc.Queue, true, docs)
 		p.stats.StashDocReads++
-	}
-	if err := iter.Close(); err != nil {
-		return errors.Trace(err)
-	}
-	return nil
+		return doc.Id, true
+	}, &p.stats.StashQueries)
+	return errors.Trace(err)
 }
 
 func (p *IncrementalPruner) cleanupDoc(
@@ -577,8 +1642,8 @@ func (p *IncrementalPruner) cleanupDoc(
 	doc docWithQueue,
 	txnsBeingCleaned map[bson.ObjectId]struct{},
 	foundDocs docMap,
-	db *mgo.Database,
-	txnsStash *mgo.Collection,
+	writer bulkWriter,
+	txnsStashName string,
 ) (bool, error) {
 	tokensToPull, newQueue, newTxnIds := p.findTxnsToPull(doc, txnsBeingCleaned)
 	if len(tokensToPull) == 0 {
@@ -586,30 +1651,37 @@ func (p *IncrementalPruner) cleanupDoc(
 		p.stats.DocsAlreadyClean++
 		return false, nil
 	}
-	coll := db.C(collection)
-	p.stats.DocTokensCleaned += int64(len(tokensToPull))
-	p.stats.DocQueuesCleaned++
 	pull := bson.M{"$pullAll": bson.M{"txn-queue": tokensToPull}}
-	err := coll.UpdateId(doc.Id, pull)
+	err := writer.updateId(collection, doc.Id, pull)
 	if err != nil {
+		if reason := uncleanableReason(err); reason != "" {
+			p.skipCollection(collection, reason, err)
+			return false, nil
+		}
 		if err != mgo.ErrNotFound {
 			return false, errors.Trace(err)
 		}
 		// Look in txns.stash. One option here is to just delete the document if there are no more
 		// references in the queue.
-		err := txnsStash.UpdateId(stashDocKey{
+		err := writer.updateId(txnsStashName, stashDocKey{
 			Collection: collection,
 			Id:         doc.Id,
 		}, pull)
 		if err != nil {
 			if err == mgo.ErrNotFound {
-				logger.Warningf("trying to cleanup doc %v, could not be found in collection %q nor stash",
+				pruneLogger.Warningf("trying to cleanup doc %v, could not be found in collection %q nor stash",
 					doc.Id, collection)
 			} else {
 				return false, errors.Trace(err)
 			}
 		}
 	}
+	p.stats.DocTokensCleaned += int64(len(tokensToPull))
+	p.stats.DocQueuesCleaned++
+	p.stats.InvalidTokensRemoved += p.countInvalid(doc, tokensToPull)
+	collStats := p.collectionStats(collection)
+	collStats.TokensCleaned += int64(len(tokensToPull))
+	collStats.DocsCleaned++
 	dKey := docKey{
 		Collection: collection,
 		DocId:      doc.Id,
@@ -626,11 +1698,12 @@ func (p *IncrementalPruner) cleanupDocs(
 	foundDocs docMap,
 	txns []txnDoc,
 	txnsBeingCleaned map[bson.ObjectId]struct{},
-	db *mgo.Database,
-	txnsStash *mgo.Collection,
+	writer bulkWriter,
+	txnsStashName string,
 ) error {
 	defer checkTime(&p.stats.DocCleanupTime)()
-	docsCleanedUp := 0
+	// Work out which documents to clean, in transaction order.
+	var toClean []docKey
 	for _, txn := range txns {
 		missingDocKeys := make([]docKey, 0)
 		for _, docKey := range txn.Ops {
@@ -638,11 +1711,11 @@ func (p *IncrementalPruner) cleanupDocs(
 				// Document known to be missing
 				continue
 			}
-			doc, ok := foundDocs[docKey]
-			if !ok {
-				if p.missingCache.IsMissing(docKey) {
-					continue
-				}
+			if _, ok := p.filteredDocs[docKey]; ok {
+				// DocFilter said to leave it alone.
+				continue
+			}
+			if _, ok := foundDocs[docKey]; !ok {
 				p.stats.DocsMissing++
 				p.missingCache.KnownMissing(docKey)
 				if docKey.Collection == "metrics" {
@@ -650,32 +1723,173 @@ func (p *IncrementalPruner) cleanupDocs(
 					// *known* to violate the transaction guarantees. They are
 					// created and updated with the transaction logic, but are
 					// removed in bulk without transaction logic.
-					logger.Tracef("ignoring missing metrics doc: %v", docKey)
+					pruneLogger.Tracef("ignoring missing metrics doc: %v", docKey)
 				} else {
 					missingDocKeys = append(missingDocKeys, docKey)
 				}
 				continue
 			}
-			updated, err := p.cleanupDoc(docKey.Collection, doc, txnsBeingCleaned, foundDocs, db, txnsStash)
-			if err != nil {
-				return errors.Trace(err)
-			}
-			if updated {
-				docsCleanedUp++
-			}
+			toClean = append(toClean, docKey)
 		}
 		if len(missingDocKeys) > 0 {
 			// This might be corruption, or might be an issue, but humans probably can't do anything about it anyway
-			logger.Infof("transaction %q referenced documents that could not be found: %v",
+			pruneLogger.Infof("transaction %q referenced documents that could not be found: %v",
 				txn.Id.Hex(), missingDocKeys)
 		}
 	}
-	if docsCleanedUp > 0 && p.ProgressChan != nil {
-		p.ProgressChan <- ProgressMessage{DocsCleaned: docsCleanedUp}
+	toClean = p.orderStashDocs(toClean, foundDocs)
+
+	docsCleanedUp := 0
+	var stashed []docKey
+	if p.bulkStashCleanup {
+		toClean, stashed = splitStashDocs(toClean, foundDocs)
+	}
+	cleanStashed := func() error {
+		cleaned, err := p.cleanupStashDocs(stashed, txnsBeingCleaned, foundDocs, writer, txnsStashName)
+		docsCleanedUp += cleaned
+		return errors.Trace(err)
+	}
+	if p.stashOrder != StashLast {
+		if err := cleanStashed(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	collection := ""
+	for _, docKey := range toClean {
+		if p.collectionSkipped(docKey.Collection) {
+			continue
+		}
+		if docKey.Collection != collection {
+			collection = docKey.Collection
+			p.report(ProgressMessage{
+				Phase:      PrunePhaseCleaningDocs,
+				Collection: collection,
+				Batch:      p.batch,
+			})
+		}
+		updated, err := p.cleanupDoc(docKey.Collection, foundDocs[docKey], txnsBeingCleaned, foundDocs, writer, txnsStashName)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if updated {
+			docsCleanedUp++
+		}
+	}
+	if p.stashOrder == StashLast {
+		if err := cleanStashed(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if docsCleanedUp > 0 {
+		p.report(ProgressMessage{DocsCleaned: docsCleanedUp, Batch: p.batch})
 	}
 	return nil
 }
 
+// orderStashDocs moves the stash documents in keys before or after the
+// others, according to the pruner's StashOrder.
+func (p *IncrementalPruner) orderStashDocs(keys []docKey, foundDocs docMap) []docKey {
+	if p.stashOrder != StashFirst && p.stashOrder != StashLast {
+		return keys
+	}
+	others, stashed := splitStashDocs(keys, foundDocs)
+	if p.stashOrder == StashFirst {
+		return append(stashed, others...)
+	}
+	return append(others, stashed...)
+}
+
+// splitStashDocs separates the keys of documents found in the stash from
+// the others, keeping their order.
+func splitStashDocs(keys []docKey, foundDocs docMap) (others, stashed []docKey) {
+	for _, key := range keys {
+		if foundDocs[key].stashed {
+			stashed = append(stashed, key)
+		} else {
+			others = append(others, key)
+		}
+	}
+	return others, stashed
+}
+
+// cleanupStashDocs pulls the tokens of the transactions being cleaned from
+// all of the given stash documents with a single update. If any of the
+// documents have left the stash in the meantime, they are cleaned one at a
+// time instead. It returns how many documents were cleaned.
+func (p *IncrementalPruner) cleanupStashDocs(
+	keys []docKey,
+	txnsBeingCleaned map[bson.ObjectId]struct{},
+	foundDocs docMap,
+	writer bulkWriter,
+	txnsStashName string,
+) (int, error) {
+	var ids []stashDocKey
+	var dirty []docKey
+	var tokens []string
+	seen := make(map[string]bool)
+	queued := make(docKeySet)
+	for _, key := range keys {
+		tokensToPull, _, _ := p.findTxnsToPull(foundDocs[key], txnsBeingCleaned)
+		if _, ok := queued[key]; ok || len(tokensToPull) == 0 {
+			p.stats.DocsAlreadyClean++
+			continue
+		}
+		queued[key] = struct{}{}
+		ids = append(ids, stashDocKey{Collection: key.Collection, Id: key.DocId})
+		dirty = append(dirty, key)
+		for _, token := range tokensToPull {
+			if !seen[token] {
+				seen[token] = true
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	// The tokens belong to completed transactions that are being
+	// removed, or are malformed and being stripped, so it is safe to pull
+	// all of them from every document.
+	matched, err := writer.updateAll(txnsStashName,
+		bson.M{"_id": bson.M{"$in": ids}},
+		bson.M{"$pullAll": bson.M{"txn-queue": tokens}},
+	)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	p.stats.StashBulkCleanups++
+	if matched < len(ids) {
+		pruneLogger.Debugf("%d of %d stash documents moved while cleaning, cleaning individually",
+			len(ids)-matched, len(ids))
+		cleaned := 0
+		for _, key := range dirty {
+			updated, err := p.cleanupDoc(key.Collection, foundDocs[key], txnsBeingCleaned, foundDocs, writer, txnsStashName)
+			if err != nil {
+				return cleaned, errors.Trace(err)
+			}
+			if updated {
+				cleaned++
+			}
+		}
+		return cleaned, nil
+	}
+	for _, key := range dirty {
+		doc := foundDocs[key]
+		tokensToPull, newQueue, newTxnIds := p.findTxnsToPull(doc, txnsBeingCleaned)
+		p.stats.DocTokensCleaned += int64(len(tokensToPull))
+		p.stats.DocQueuesCleaned++
+		p.stats.InvalidTokensRemoved += p.countInvalid(doc, tokensToPull)
+		collStats := p.collectionStats(key.Collection)
+		collStats.TokensCleaned += int64(len(tokensToPull))
+		collStats.DocsCleaned++
+		doc.Queue = newQueue
+		doc.txns = newTxnIds
+		foundDocs[key] = doc
+		p.docCache.Add(key, doc)
+	}
+	return len(dirty), nil
+}
+
 func (p *IncrementalPruner) findTxnsToPull(doc docWithQueue, txnsBeingCleaned map[bson.ObjectId]struct{}) ([]string, []string, []bson.ObjectId) {
 	// We expect that *most* of the time, we won't pull any txns, because old txns will already have been removed
 	// Because of this, we actually do 2 passes over the data. The first time we are seeing if there is anything that
@@ -685,7 +1899,7 @@ func (p *IncrementalPruner) findTxnsToPull(doc docWithQueue, txnsBeingCleaned ma
 	// So about 100x more likely to not have anything to do. No need to allocate the slices we won't use.
 	hasChanges := false
 	for _, txnId := range doc.txns {
-		if _, isCleaned := txnsBeingCleaned[txnId]; isCleaned {
+		if p.pullable(txnId, txnsBeingCleaned) {
 			hasChanges = true
 			break
 		}
@@ -700,7 +1914,7 @@ func (p *IncrementalPruner) findTxnsToPull(doc docWithQueue, txnsBeingCleaned ma
 	for i := range doc.Queue {
 		token := doc.Queue[i]
 		txnId := doc.txns[i]
-		if _, isCleaned := txnsBeingCleaned[txnId]; isCleaned {
+		if p.pullable(txnId, txnsBeingCleaned) {
 			tokensToPull = append(tokensToPull, token)
 		} else {
 			newQueue = append(newQueue, token)
@@ -710,28 +1924,142 @@ func (p *IncrementalPruner) findTxnsToPull(doc docWithQueue, txnsBeingCleaned ma
 	return tokensToPull, newQueue, newTxns
 }
 
-func (p *IncrementalPruner) removeTxns(txnsToDelete []bson.ObjectId, txns *mgo.Collection, errorCh chan error, wg *sync.WaitGroup) {
+// pullable returns true if a token for txnId should be pulled from a
+// txn-queue. Malformed tokens have an empty txnId (see txnsFromTokens).
+func (p *IncrementalPruner) pullable(txnId bson.ObjectId, txnsBeingCleaned map[bson.ObjectId]struct{}) bool {
+	if txnId == "" {
+		return p.stripInvalidTokens
+	}
+	_, isCleaned := txnsBeingCleaned[txnId]
+	return isCleaned
+}
+
+// countInvalid returns how many of the tokens being pulled from doc are
+// malformed.
+func (p *IncrementalPruner) countInvalid(doc docWithQueue, tokensToPull []string) int64 {
+	if !p.stripInvalidTokens {
+		return 0
+	}
+	pulled := make(map[string]bool, len(tokensToPull))
+	for _, token := range tokensToPull {
+		pulled[token] = true
+	}
+	var count int64
+	for i, txnId := range doc.txns {
+		if txnId == "" && pulled[doc.Queue[i]] {
+			count++
+		}
+	}
+	return count
+}
+
+// countMissingTxnTokens counts the valid tokens in the queues of docs that
+// refer to transactions that aren't being cleaned and no longer exist.
+func (p *IncrementalPruner) countMissingTxnTokens(
+	docs docMap,
+	txnsBeingCleaned map[bson.ObjectId]struct{},
+	finder docFinder,
+	txnsName string,
+) error {
+	refs := make(map[bson.ObjectId]int)
+	for _, doc := range docs {
+		for _, txnId := range doc.txns {
+			if txnId == "" {
+				continue
+			}
+			if _, isCleaned := txnsBeingCleaned[txnId]; !isCleaned {
+				refs[txnId]++
+			}
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	ids := make([]bson.ObjectId, 0, len(refs))
+	for txnId := range refs {
+		ids = append(ids, txnId)
+	}
+	iter := finder.findIds(txnsName, ids, bson.M{"_id": 1})
+	var doc struct {
+		Id bson.ObjectId `bson:"_id"`
+	}
+	for iter.Next(&doc) {
+		delete(refs, doc.Id)
+	}
+	if err := iter.Close(); err != nil {
+		return errors.Annotate(err, "looking up transactions in txn-queues")
+	}
+	for txnId, count := range refs {
+		pruneLogger.Debugf("txn-queues refer to missing transaction %s", txnId.Hex())
+		p.stats.MissingTxnTokens += int64(count)
+	}
+	return nil
+}
+
+// RemoveHook is called by the pruner with each transaction that is about
+// to be removed, so that applications can keep things derived from their
+// transactions, such as search indexes or external ledgers, in step with
+// pruning. The transaction is decoded leniently, so its Problems may be
+// set. When pruning is multithreaded it may be called concurrently.
+type RemoveHook func(*TxnDoc) error
+
+// archiveTxns writes the transactions that are about to be removed to the
+// archive, if there is one, and passes them to the OnRemove hook.
+func (p *IncrementalPruner) archiveTxns(ids []bson.ObjectId, finder docFinder, txnsName string) error {
+	if p.archive == nil && p.onRemove == nil {
+		return nil
+	}
+	iter := finder.findIds(txnsName, ids, nil)
+	var docs []bson.Raw
+	var raw bson.Raw
+	for iter.Next(&raw) {
+		docs = append(docs, raw)
+		raw = bson.Raw{}
+	}
+	if err := iter.Close(); err != nil {
+		return errors.Annotate(err, "reading txns to archive")
+	}
+	if p.archive != nil {
+		if err := p.archive.WriteRaw(docs); err != nil {
+			return errors.Annotate(err, "archiving txns")
+		}
+	}
+	if p.onRemove != nil {
+		for _, raw := range docs {
+			doc := DecodeTxnLenient(raw)
+			if err := p.onRemove(doc); err != nil {
+				return errors.Annotatef(err, "remove hook for txn %s", doc.Id.Hex())
+			}
+		}
+	}
+	return nil
+}
+
+func (p *IncrementalPruner) removeTxns(txnsToDelete []bson.ObjectId, writer bulkWriter, txnsName string, errorCh chan error, wg *sync.WaitGroup) {
+	p.report(ProgressMessage{Phase: PrunePhaseRemovingTxns, Batch: p.batch})
+	if p.oplogPacer != nil {
+		p.oplogPacer.add(len(txnsToDelete))
+	}
+	batch := p.batch
 	wg.Add(1)
-	session := txns.Database.Session.Copy()
-	txns = txns.With(session)
 	go func() {
 		tStart := time.Now()
-		results, err := txns.RemoveAll(bson.M{
+		removed, err := writer.removeAll(txnsName, bson.M{
 			"_id": bson.M{"$in": txnsToDelete},
 		})
 		if err != nil {
 			errorCh <- errors.Trace(err)
 		} else {
-			logger.Tracef("removing %d txns removed %d", len(txnsToDelete), results.Removed)
-			p.stats.TxnsRemoved += int64(results.Removed)
-			p.stats.TxnRemoveTime += time.Since(tStart)
-			if p.ProgressChan != nil {
-				p.ProgressChan <- ProgressMessage{
-					TxnsRemoved: results.Removed,
-				}
+			pruneLogger.Tracef("removing %d txns removed %d", len(txnsToDelete), removed)
+			missing := len(txnsToDelete) - removed
+			if missing > 0 {
+				// We only count what we removed, so that concurrent
+				// pruners don't both claim the same txns.
+				pruneLogger.Debugf("%d of %d txns were already removed", missing, len(txnsToDelete))
 			}
+			p.removals.add(removed, missing, time.Since(tStart))
+			p.report(ProgressMessage{TxnsRemoved: removed, Batch: batch})
 		}
-		session.Close()
 		wg.Done()
 	}()
 }
@@ -741,6 +2069,28 @@ type docWithQueue struct {
 	Id    interface{}     `bson:"_id"`
 	Queue []string        `bson:"txn-queue"`
 	txns  []bson.ObjectId `bson:"-"`
+
+	// stashed is true if the document was found in txns.stash.
+	stashed bool
+}
+
+// SetBSON implements bson.Setter, decoding the _id with hashableDocId.
+func (doc *docWithQueue) SetBSON(raw bson.Raw) error {
+	var fields struct {
+		Id    bson.Raw `bson:"_id"`
+		Queue []string `bson:"txn-queue"`
+	}
+	if err := raw.Unmarshal(&fields); err != nil {
+		return err
+	}
+	id, err := hashableDocId(fields.Id)
+	if err != nil {
+		return err
+	}
+	doc.Id = id
+	doc.Queue = fields.Queue
+	doc.txns = nil
+	return nil
 }
 
 // these are only the fields of txnDoc that we care about
@@ -754,11 +2104,100 @@ type docKey struct {
 	DocId      interface{} `bson:"d"`
 }
 
+// SetBSON implements bson.Setter, decoding the document id with hashableDocId.
+func (key *docKey) SetBSON(raw bson.Raw) error {
+	var fields struct {
+		Collection string   `bson:"c"`
+		DocId      bson.Raw `bson:"d"`
+	}
+	if err := raw.Unmarshal(&fields); err != nil {
+		return err
+	}
+	id, err := hashableDocId(fields.DocId)
+	if err != nil {
+		return err
+	}
+	key.Collection = fields.Collection
+	key.DocId = id
+	return nil
+}
+
 type stashDocKey struct {
 	Collection string      `bson:"c"`
 	Id         interface{} `bson:"id"`
 }
 
+// SetBSON implements bson.Setter, decoding the document id with hashableDocId.
+func (key *stashDocKey) SetBSON(raw bson.Raw) error {
+	var fields struct {
+		Collection string   `bson:"c"`
+		Id         bson.Raw `bson:"id"`
+	}
+	if err := raw.Unmarshal(&fields); err != nil {
+		return err
+	}
+	id, err := hashableDocId(fields.Id)
+	if err != nil {
+		return err
+	}
+	key.Collection = fields.Collection
+	key.Id = id
+	return nil
+}
+
+// rawDocId holds a document _id that has no comparable Go representation,
+// such as a sub-document, an array or binary data. Keeping the raw bytes
+// means it can be used as part of a map or cache key, and it is written back
+// exactly as it was read, so sub-document field order is preserved when we
+// query or update by it.
+type rawDocId struct {
+	kind byte
+	data string
+}
+
+// GetBSON implements bson.Getter.
+func (id rawDocId) GetBSON() (interface{}, error) {
+	return bson.Raw{Kind: id.kind, Data: []byte(id.data)}, nil
+}
+
+// String returns the id in its extended JSON form, for logging.
+func (id rawDocId) String() string {
+	raw := bson.Raw{Kind: id.kind, Data: []byte(id.data)}
+	var err error
+	var value interface{}
+	if id.kind == kindDocument {
+		// Keep the field order.
+		var doc bson.D
+		err = raw.Unmarshal(&doc)
+		value = doc
+	} else {
+		err = raw.Unmarshal(&value)
+	}
+	if err != nil {
+		return fmt.Sprintf("<bson kind 0x%02x>", id.kind)
+	}
+	return fmt.Sprint(value)
+}
+
+// hashableDocId decodes a document _id into a value that can be used as a map
+// key. Ids of the simple types that almost every collection uses are decoded
+// to their natural Go values, anything else is kept as a rawDocId.
+func hashableDocId(raw bson.Raw) (interface{}, error) {
+	switch raw.Kind {
+	case 0:
+		// The field was missing.
+		return nil, nil
+	case kindDouble, kindString, kindObjectId, kindBool, kindDateTime,
+		kindNull, kindInt32, kindTimestamp, kindInt64, kindDecimal128:
+		var id interface{}
+		if err := raw.Unmarshal(&id); err != nil {
+			return nil, err
+		}
+		return id, nil
+	}
+	return rawDocId{kind: raw.Kind, data: string(raw.Data)}, nil
+}
+
 type stashEntry struct {
 	Id    stashDocKey `bson:"_id"`
 	Queue []string    `bson:"txn-queue"`
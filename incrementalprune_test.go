@@ -5,6 +5,7 @@ package txn
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/juju/errors"
@@ -182,6 +183,93 @@ func (s *IncrementalPruneSuite) TestPruneCleansUpStash(c *gc.C) {
 	c.Check(count, gc.Equals, 0)
 }
 
+func (s *IncrementalPruneSuite) TestPruneMixedIdTypes(c *gc.C) {
+	ids := []interface{}{
+		"1",
+		2,
+		bson.NewObjectId(),
+		bson.D{{"model", "a"}, {"name", "b"}},
+		bson.D{{"name", "b"}, {"model", "a"}},
+		bson.Binary{Kind: 0x00, Data: []byte("binary-id")},
+		[]interface{}{"x", 1},
+	}
+	for _, id := range ids {
+		s.runTxn(c, txn.Op{
+			C:      "docs",
+			Id:     id,
+			Insert: bson.M{"key": "value"},
+		})
+		s.runTxn(c, txn.Op{
+			C:      "docs",
+			Id:     id,
+			Update: bson.M{"$set": bson.M{"key": "newvalue"}},
+		})
+	}
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{})
+	stats, err := pruner.Prune(s.txns)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TxnsRemoved, gc.Equals, int64(2*len(ids)))
+	c.Check(stats.DocReads, gc.Equals, int64(len(ids)))
+	c.Check(stats.DocQueuesCleaned, gc.Equals, int64(len(ids)))
+	c.Check(stats.DocsMissing, gc.Equals, int64(0))
+	for _, id := range ids {
+		var doc docWithQueue
+		c.Assert(s.db.C("docs").FindId(id).One(&doc), jc.ErrorIsNil)
+		c.Check(doc.Queue, gc.DeepEquals, []string{}, gc.Commentf("id %v", id))
+	}
+	count, err := s.txns.Count()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(count, gc.Equals, 0)
+}
+
+func (s *IncrementalPruneSuite) TestPruneCleansUpStashWithCompositeId(c *gc.C) {
+	id := bson.D{{"model", "a"}, {"name", "b"}}
+	s.runTxn(c, txn.Op{
+		C:      "docs",
+		Id:     id,
+		Insert: bson.M{"key": "value"},
+	})
+	s.runTxn(c, txn.Op{
+		C:      "docs",
+		Id:     id,
+		Remove: true,
+	})
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{})
+	stats, err := pruner.Prune(s.txns)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TxnsRemoved, gc.Equals, int64(2))
+	c.Check(stats.StashDocReads, gc.Equals, int64(1))
+	c.Check(stats.StashDocsRemoved, gc.Equals, int64(1))
+	count, err := s.db.C("txns.stash").Count()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(count, gc.Equals, 0)
+}
+
+func (s *IncrementalPruneSuite) TestHashableDocId(c *gc.C) {
+	data, err := bson.Marshal(txnDoc{Id: bson.NewObjectId(), Ops: []docKey{
+		{Collection: "docs", DocId: "1"},
+		{Collection: "docs", DocId: bson.D{{"b", 1}, {"a", 2}}},
+		{Collection: "docs", DocId: bson.Binary{Data: []byte{1, 2}}},
+	}})
+	c.Assert(err, jc.ErrorIsNil)
+	var doc txnDoc
+	c.Assert(bson.Unmarshal(data, &doc), jc.ErrorIsNil)
+	c.Assert(doc.Ops, gc.HasLen, 3)
+	c.Check(doc.Ops[0].DocId, gc.Equals, "1")
+	c.Check(doc.Ops[1].DocId, gc.FitsTypeOf, rawDocId{})
+	c.Check(fmt.Sprint(doc.Ops[1].DocId), gc.Equals, "[{b 1} {a 2}]")
+	c.Check(doc.Ops[2].DocId, gc.FitsTypeOf, rawDocId{})
+	// All of the keys can be used in a map, and re-encode to the same id.
+	keys := make(docKeySet)
+	for _, key := range doc.Ops {
+		keys[key] = struct{}{}
+	}
+	c.Check(keys, gc.HasLen, 3)
+	reencoded, err := bson.Marshal(doc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(reencoded, jc.DeepEquals, data)
+}
+
 func (s *IncrementalPruneSuite) TestPruneDoesntRereadCachedDocs(c *gc.C) {
 	// We create a lot of trnansactions updating the same doc
 	s.runTxn(c, txn.Op{
@@ -320,6 +408,42 @@ func (s *TxnSuite) runInterruptedTxn(c *gc.C, breakpoint string, ops ...txn.Op)
 	return txnId
 }
 
+type CollectionPruneStatsSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&CollectionPruneStatsSuite{})
+
+func (*CollectionPruneStatsSuite) TestCombine(c *gc.C) {
+	combined := combineCollectionStats(
+		[]CollectionPruneStats{
+			{Name: "b", DocsRead: 1, DocsCleaned: 1, TokensCleaned: 2, ReadTime: time.Second},
+			{Name: "a", DocsRead: 3},
+		},
+		[]CollectionPruneStats{
+			{Name: "b", DocsRead: 4, DocsCleaned: 2, TokensCleaned: 3, ReadTime: time.Second},
+		},
+	)
+	c.Check(combined, jc.DeepEquals, []CollectionPruneStats{
+		{Name: "a", DocsRead: 3},
+		{Name: "b", DocsRead: 5, DocsCleaned: 3, TokensCleaned: 5, ReadTime: 2 * time.Second},
+	})
+}
+
+func (*CollectionPruneStatsSuite) TestCollectionOrder(c *gc.C) {
+	priority := CollectionPriorities([]CollectionPruneStats{
+		{Name: "slow", DocsCleaned: 10, ReadTime: 10 * time.Second},
+		{Name: "fast", DocsCleaned: 10, ReadTime: time.Second},
+	})
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{CollectionPriority: priority})
+	order := pruner.collectionOrder(map[string][]interface{}{
+		"unknown": nil,
+		"slow":    nil,
+		"fast":    nil,
+	})
+	c.Check(order, jc.DeepEquals, []string{"fast", "slow", "unknown"})
+}
+
 type PrunerStatsSuite struct {
 	testing.IsolationSuite
 }
@@ -330,31 +454,43 @@ func (*PrunerStatsSuite) TestBaseString(c *gc.C) {
 	v1 := PrunerStats{}
 	c.Check(v1.String(), gc.Equals, `
 PrunerStats(
-     CacheLookupTime: 0.000
-         DocReadTime: 0.000
-       DocLookupTime: 0.000
-      DocCleanupTime: 0.000
-     StashLookupTime: 0.000
-     StashRemoveTime: 0.000
-         TxnReadTime: 0.000
-       TxnRemoveTime: 0.000
-        DocCacheHits: 0
-      DocCacheMisses: 0
-  DocMissingCacheHit: 0
-         DocsMissing: 0
-   CollectionQueries: 0
-            DocReads: 0
-     DocStillMissing: 0
-        StashQueries: 0
-       StashDocReads: 0
-    StashDocsRemoved: 0
-    DocQueuesCleaned: 0
-    DocTokensCleaned: 0
-    DocsAlreadyClean: 0
-         TxnsRemoved: 0
-      TxnsNotRemoved: 0
-        StrCacheHits: 0
-      StrCacheMisses: 0
+       CacheLookupTime: 0.000
+           DocReadTime: 0.000
+         DocLookupTime: 0.000
+        DocCleanupTime: 0.000
+       StashLookupTime: 0.000
+       StashRemoveTime: 0.000
+           TxnReadTime: 0.000
+         TxnRemoveTime: 0.000
+         LoadSleepTime: 0.000
+        OplogSleepTime: 0.000
+          DocCacheHits: 0
+        DocCacheMisses: 0
+    DocMissingCacheHit: 0
+           DocsMissing: 0
+     CollectionQueries: 0
+              DocReads: 0
+       DocStillMissing: 0
+        DocBatchSplits: 0
+          StashQueries: 0
+         StashDocReads: 0
+      StashDocsRemoved: 0
+     StashBulkCleanups: 0
+      DocQueuesCleaned: 0
+      DocTokensCleaned: 0
+      DocsAlreadyClean: 0
+           TxnsRemoved: 0
+        TxnsNotRemoved: 0
+    TxnsAlreadyRemoved: 0
+          StrCacheHits: 0
+        StrCacheMisses: 0
+         InvalidTokens: 0
+  InvalidTokensRemoved: 0
+      MissingTxnTokens: 0
+          DocsFiltered: 0
+             CollScans: 0
+           SlowQueries: 0
+         PeakHeapBytes: 0
 )`[1:])
 }
 
@@ -366,31 +502,43 @@ func (*PrunerStatsSuite) TestAlignedTimes(c *gc.C) {
 	}
 	c.Check(v1.String(), gc.Equals, `
 PrunerStats(
-     CacheLookupTime: 12.345
-         DocReadTime: 23.457
-       DocLookupTime:  0.000
-      DocCleanupTime:  0.000
-     StashLookupTime:  0.200
-     StashRemoveTime:  0.000
-         TxnReadTime:  0.000
-       TxnRemoveTime:  0.000
-        DocCacheHits: 0
-      DocCacheMisses: 0
-  DocMissingCacheHit: 0
-         DocsMissing: 0
-   CollectionQueries: 0
-            DocReads: 0
-     DocStillMissing: 0
-        StashQueries: 0
-       StashDocReads: 0
-    StashDocsRemoved: 0
-    DocQueuesCleaned: 0
-    DocTokensCleaned: 0
-    DocsAlreadyClean: 0
-         TxnsRemoved: 0
-      TxnsNotRemoved: 0
-        StrCacheHits: 0
-      StrCacheMisses: 0
+       CacheLookupTime: 12.345
+           DocReadTime: 23.457
+         DocLookupTime:  0.000
+        DocCleanupTime:  0.000
+       StashLookupTime:  0.200
+       StashRemoveTime:  0.000
+           TxnReadTime:  0.000
+         TxnRemoveTime:  0.000
+         LoadSleepTime:  0.000
+        OplogSleepTime:  0.000
+          DocCacheHits: 0
+        DocCacheMisses: 0
+    DocMissingCacheHit: 0
+           DocsMissing: 0
+     CollectionQueries: 0
+              DocReads: 0
+       DocStillMissing: 0
+        DocBatchSplits: 0
+          StashQueries: 0
+         StashDocReads: 0
+      StashDocsRemoved: 0
+     StashBulkCleanups: 0
+      DocQueuesCleaned: 0
+      DocTokensCleaned: 0
+      DocsAlreadyClean: 0
+           TxnsRemoved: 0
+        TxnsNotRemoved: 0
+    TxnsAlreadyRemoved: 0
+          StrCacheHits: 0
+        StrCacheMisses: 0
+         InvalidTokens: 0
+  InvalidTokensRemoved: 0
+      MissingTxnTokens: 0
+          DocsFiltered: 0
+             CollScans: 0
+           SlowQueries: 0
+         PeakHeapBytes: 0
 )`[1:])
 }
 
@@ -401,30 +549,112 @@ func (*PrunerStatsSuite) TestAlignedValues(c *gc.C) {
 	}
 	c.Check(v1.String(), gc.Equals, `
 PrunerStats(
-     CacheLookupTime: 0.000
-         DocReadTime: 0.000
-       DocLookupTime: 0.000
-      DocCleanupTime: 0.000
-     StashLookupTime: 0.000
-     StashRemoveTime: 0.000
-         TxnReadTime: 0.000
-       TxnRemoveTime: 0.000
-        DocCacheHits:     0
-      DocCacheMisses:     0
-  DocMissingCacheHit:     0
-         DocsMissing:     0
-   CollectionQueries:     0
-            DocReads:     0
-     DocStillMissing:     0
-        StashQueries:     0
-       StashDocReads: 12345
-    StashDocsRemoved:  1000
-    DocQueuesCleaned:     0
-    DocTokensCleaned:     0
-    DocsAlreadyClean:     0
-         TxnsRemoved:     0
-      TxnsNotRemoved:     0
-        StrCacheHits:     0
-      StrCacheMisses:     0
+       CacheLookupTime: 0.000
+           DocReadTime: 0.000
+         DocLookupTime: 0.000
+        DocCleanupTime: 0.000
+       StashLookupTime: 0.000
+       StashRemoveTime: 0.000
+           TxnReadTime: 0.000
+         TxnRemoveTime: 0.000
+         LoadSleepTime: 0.000
+        OplogSleepTime: 0.000
+          DocCacheHits:     0
+        DocCacheMisses:     0
+    DocMissingCacheHit:     0
+           DocsMissing:     0
+     CollectionQueries:     0
+              DocReads:     0
+       DocStillMissing:     0
+        DocBatchSplits:     0
+          StashQueries:     0
+         StashDocReads: 12345
+      StashDocsRemoved:  1000
+     StashBulkCleanups:     0
+      DocQueuesCleaned:     0
+      DocTokensCleaned:     0
+      DocsAlreadyClean:     0
+           TxnsRemoved:     0
+        TxnsNotRemoved:     0
+    TxnsAlreadyRemoved:     0
+          StrCacheHits:     0
+        StrCacheMisses:     0
+         InvalidTokens:     0
+  InvalidTokensRemoved:     0
+      MissingTxnTokens:     0
+          DocsFiltered:     0
+             CollScans:     0
+           SlowQueries:     0
+         PeakHeapBytes:     0
 )`[1:])
 }
+
+type BatchRemoverSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&BatchRemoverSuite{})
+
+func (s *BatchRemoverSuite) insertDocs(c *gc.C, coll *mgo.Collection, ids ...string) {
+	for _, id := range ids {
+		c.Assert(coll.Insert(bson.M{"_id": id}), jc.ErrorIsNil)
+	}
+}
+
+func (s *BatchRemoverSuite) TestChunkBySizeSplitsFilters(c *gc.C) {
+	coll := s.db.C("docs")
+	long := func(prefix string) string {
+		return prefix + strings.Repeat("x", 100)
+	}
+	s.insertDocs(c, coll, long("a"), long("b"), long("c"), "keep")
+	size, err := encodedIdSize(long("a"))
+	c.Assert(err, jc.ErrorIsNil)
+	// Only two ids fit in each filter.
+	remover := newBatchRemover(coll, ChunkRemovesBySize, 2*size, DeleteStrategy{})
+	c.Assert(remover.Remove(long("a")), jc.ErrorIsNil)
+	c.Assert(remover.Remove(long("b")), jc.ErrorIsNil)
+	c.Check(remover.Removed(), gc.Equals, 0)
+	c.Assert(remover.Remove(long("c")), jc.ErrorIsNil)
+	c.Check(remover.Removed(), gc.Equals, 2)
+	c.Assert(remover.Flush(), jc.ErrorIsNil)
+	c.Check(remover.Removed(), gc.Equals, 3)
+	count, err := coll.Count()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(count, gc.Equals, 1)
+}
+
+func (s *BatchRemoverSuite) TestChunkBySizeRemovesOversizedId(c *gc.C) {
+	coll := s.db.C("docs")
+	s.insertDocs(c, coll, "small", strings.Repeat("x", 100))
+	remover := newBatchRemover(coll, ChunkRemovesBySize, 10, DeleteStrategy{})
+	c.Assert(remover.Remove("small"), jc.ErrorIsNil)
+	c.Assert(remover.Remove(strings.Repeat("x", 100)), jc.ErrorIsNil)
+	c.Check(remover.Removed(), gc.Equals, 1)
+	c.Assert(remover.Flush(), jc.ErrorIsNil)
+	c.Check(remover.Removed(), gc.Equals, 2)
+}
+
+func (s *BatchRemoverSuite) TestChunkByCountIgnoresSize(c *gc.C) {
+	coll := s.db.C("docs")
+	s.insertDocs(c, coll, "a", "b")
+	remover := newBatchRemover(coll, ChunkRemovesByCount, 10, DeleteStrategy{})
+	c.Assert(remover.Remove("a"), jc.ErrorIsNil)
+	c.Assert(remover.Remove("b"), jc.ErrorIsNil)
+	c.Check(remover.Removed(), gc.Equals, 0)
+	c.Assert(remover.Flush(), jc.ErrorIsNil)
+	c.Check(remover.Removed(), gc.Equals, 2)
+}
+
+func (s *BatchRemoverSuite) TestAbortDiscardsQueue(c *gc.C) {
+	coll := s.db.C("docs")
+	s.insertDocs(c, coll, "a", "b")
+	remover := newBatchRemover(coll, ChunkRemovesByCount, 0, DeleteStrategy{})
+	c.Assert(remover.Remove("a"), jc.ErrorIsNil)
+	remover.Abort()
+	c.Assert(remover.Remove("b"), jc.ErrorIsNil)
+	c.Assert(remover.Flush(), jc.ErrorIsNil)
+	// Flushing again does nothing.
+	c.Assert(remover.Flush(), jc.ErrorIsNil)
+	c.Check(remover.Removed(), gc.Equals, 1)
+	c.Assert(coll.FindId("a").One(&bson.M{}), jc.ErrorIsNil)
+}
@@ -0,0 +1,363 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+const (
+	// invariantLookupBatch is how many transactions are looked up at once
+	// while checking invariants.
+	invariantLookupBatch = 1000
+
+	// defaultMaxViolations is the default of
+	// InvariantOptions.MaxViolations.
+	defaultMaxViolations = 100
+)
+
+// InvariantKind names an invariant checked by CheckInvariants.
+type InvariantKind string
+
+const (
+	// InvariantMissingTxn is violated by a txn-queue token of a
+	// transaction that doesn't exist. mgo/txn can't resume or complete
+	// such a transaction, so the document can't be changed by later
+	// transactions until the token is removed.
+	InvariantMissingTxn InvariantKind = "missing-txn"
+
+	// InvariantStaleReference is violated by a token of a transaction
+	// that was applied longer ago than InvariantOptions.MaxAppliedAge,
+	// which shows that pruning isn't keeping up.
+	InvariantStaleReference InvariantKind = "stale-reference"
+
+	// InvariantStash is violated by a txns.stash document that can't be
+	// decoded, or whose document also exists in its collection although
+	// none of the transactions in its queue are pending.
+	InvariantStash InvariantKind = "stash"
+)
+
+// InvariantViolation is a document found breaking an invariant.
+type InvariantViolation struct {
+	Kind       InvariantKind `json:"kind"`
+	Collection string        `json:"collection"`
+	DocId      interface{}   `json:"doc-id"`
+
+	// Txn is the transaction the violation is about, if any.
+	Txn bson.ObjectId `json:"txn,omitempty"`
+
+	Detail string `json:"detail"`
+}
+
+func (v InvariantViolation) String() string {
+	return fmt.Sprintf("%s: %q doc %v: %s", v.Kind, v.Collection, v.DocId, v.Detail)
+}
+
+// InvariantOptions controls CheckInvariantsWithOptions.
+type InvariantOptions struct {
+	// MaxAppliedAge, if not 0, is how long ago a transaction may have
+	// been applied and still be referenced by a txn-queue.
+	MaxAppliedAge time.Duration
+
+	// MaxDocs, if not 0, is the most documents read from each
+	// collection, so that a big database can be spot-checked.
+	MaxDocs int
+
+	// MaxViolations is the most violations reported. Defaults to 100.
+	MaxViolations int
+
+	// Collections, if set, are the only collections checked, rather
+	// than every collection that may reference the transactions. Add
+	// the stash collection to check it too.
+	Collections []string
+}
+
+// InvariantReport is returned by CheckInvariants.
+type InvariantReport struct {
+	// Collections, DocsChecked and TokensChecked count what was read.
+	Collections   int `json:"collections"`
+	DocsChecked   int `json:"docs-checked"`
+	TokensChecked int `json:"tokens-checked"`
+
+	// Violations are the violations found, up to MaxViolations, and
+	// Truncated is true if there were more.
+	Violations []InvariantViolation `json:"violations"`
+	Truncated  bool                 `json:"truncated"`
+}
+
+// OK returns true if no violations were found.
+func (r InvariantReport) OK() bool {
+	return len(r.Violations) == 0 && !r.Truncated
+}
+
+// CheckInvariants checks that the documents of the collections that share
+// a database with txnsName are consistent with its transactions, with the
+// default InvariantOptions. See CheckInvariantsWithOptions.
+func CheckInvariants(db *mgo.Database, txnsName string) (InvariantReport, error) {
+	return CheckInvariantsWithOptions(db, txnsName, InvariantOptions{})
+}
+
+// CheckInvariantsWithOptions checks the invariants named by InvariantKind
+// over the collections that may reference transactions in txnsName,
+// including txns.stash. Transactions run while it is checking can cause
+// spurious violations of InvariantStash, and pruning can cause spurious
+// violations of InvariantMissingTxn, so violations should be checked
+// again before being acted on.
+func CheckInvariantsWithOptions(db *mgo.Database, txnsName string, opts InvariantOptions) (InvariantReport, error) {
+	if opts.MaxAppliedAge < 0 {
+		return InvariantReport{}, errors.NotValidf("negative MaxAppliedAge %s", opts.MaxAppliedAge)
+	}
+	if opts.MaxViolations <= 0 {
+		opts.MaxViolations = defaultMaxViolations
+	}
+	c := &invariantChecker{
+		db:    db,
+		txns:  db.C(txnsName),
+		stash: txnsName + ".stash",
+		opts:  opts,
+		refs:  make(map[bson.ObjectId][]invariantRef),
+	}
+	if opts.MaxAppliedAge > 0 {
+		c.staleBefore = time.Now().Add(-opts.MaxAppliedAge)
+	}
+	if err := c.checkCollections(); err != nil {
+		return c.report, errors.Trace(err)
+	}
+	if err := c.lookupRefs(); err != nil {
+		return c.report, errors.Trace(err)
+	}
+	if err := c.checkStashDuplicates(); err != nil {
+		return c.report, errors.Trace(err)
+	}
+	return c.report, nil
+}
+
+// invariantRef is a txn-queue token, by the document it was found in.
+type invariantRef struct {
+	collection string
+	docId      interface{}
+}
+
+// stashDuplicate is a stash document whose document also exists.
+type stashDuplicate struct {
+	docId interface{}
+	txns  []bson.ObjectId
+}
+
+type invariantChecker struct {
+	db          *mgo.Database
+	txns        *mgo.Collection
+	stash       string
+	opts        InvariantOptions
+	staleBefore time.Time
+	report      InvariantReport
+
+	// refs holds the tokens waiting to be looked up, by transaction.
+	refs       map[bson.ObjectId][]invariantRef
+	duplicates []stashDuplicate
+}
+
+func (c *invariantChecker) violation(v InvariantViolation) {
+	if len(c.report.Violations) >= c.opts.MaxViolations {
+		c.report.Truncated = true
+		return
+	}
+	c.report.Violations = append(c.report.Violations, v)
+}
+
+// checkCollections checks the documents of InvariantOptions.Collections,
+// or of every collection that may reference the transactions.
+func (c *invariantChecker) checkCollections() error {
+	for _, name := range c.opts.Collections {
+		c.report.Collections++
+		if err := c.checkCollection(name); err != nil {
+			return errors.Annotatef(err, "checking %q", name)
+		}
+	}
+	if len(c.opts.Collections) > 0 {
+		return nil
+	}
+	it, err := NewTxnCollectionIterator(c.txns, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var name string
+	for it.Next(&name) {
+		c.report.Collections++
+		if err := c.checkCollection(name); err != nil {
+			it.Close()
+			return errors.Annotatef(err, "checking %q", name)
+		}
+	}
+	return errors.Trace(it.Close())
+}
+
+func (c *invariantChecker) checkCollection(name string) error {
+	query := c.db.C(name).Find(bson.M{"txn-queue.0": bson.M{"$exists": true}})
+	if name != c.stash {
+		query = query.Select(bson.M{"_id": 1, "txn-queue": 1})
+	}
+	if c.opts.MaxDocs > 0 {
+		query = query.Limit(c.opts.MaxDocs)
+	}
+	iter := query.Iter()
+	var raw bson.Raw
+	for iter.Next(&raw) {
+		c.report.DocsChecked++
+		var err error
+		if name == c.stash {
+			err = c.checkStashDoc(raw)
+		} else {
+			err = c.checkDoc(name, raw)
+		}
+		if err != nil {
+			iter.Close()
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(iter.Close())
+}
+
+func (c *invariantChecker) checkDoc(collection string, raw bson.Raw) error {
+	var doc docWithQueue
+	if err := raw.Unmarshal(&doc); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(c.addTokens(collection, doc.Id, doc.Queue))
+}
+
+func (c *invariantChecker) checkStashDoc(raw bson.Raw) error {
+	doc, err := DecodeStashDoc(raw)
+	if err != nil {
+		var id struct {
+			Id interface{} `bson:"_id"`
+		}
+		raw.Unmarshal(&id)
+		c.violation(InvariantViolation{
+			Kind:       InvariantStash,
+			Collection: c.stash,
+			DocId:      id.Id,
+			Detail:     err.Error(),
+		})
+		return nil
+	}
+	docId := bson.D{{"c", doc.Collection}, {"id", doc.Id}}
+	if err := c.addTokens(c.stash, docId, doc.Queue); err != nil {
+		return errors.Trace(err)
+	}
+	count, err := c.db.C(doc.Collection).FindId(doc.Id).Count()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if count > 0 {
+		dup := stashDuplicate{docId: docId}
+		for _, token := range doc.Queue {
+			if parsed, err := ParseToken(token); err == nil {
+				dup.txns = append(dup.txns, parsed.Id)
+			}
+		}
+		c.duplicates = append(c.duplicates, dup)
+	}
+	return nil
+}
+
+// addTokens queues the tokens of a document to be looked up.
+func (c *invariantChecker) addTokens(collection string, docId interface{}, queue []string) error {
+	for _, token := range queue {
+		parsed, err := ParseToken(token)
+		if err != nil {
+			// Malformed tokens are reported by the pruner, which can
+			// remove them.
+			continue
+		}
+		c.report.TokensChecked++
+		c.refs[parsed.Id] = append(c.refs[parsed.Id], invariantRef{collection: collection, docId: docId})
+		if len(c.refs) >= invariantLookupBatch {
+			if err := c.lookupRefs(); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return nil
+}
+
+// lookupRefs looks up the transactions of the queued tokens.
+func (c *invariantChecker) lookupRefs() error {
+	if len(c.refs) == 0 {
+		return nil
+	}
+	ids := make([]bson.ObjectId, 0, len(c.refs))
+	for id := range c.refs {
+		ids = append(ids, id)
+	}
+	states := make(map[bson.ObjectId]TxnState, len(ids))
+	var doc struct {
+		Id    bson.ObjectId `bson:"_id"`
+		State TxnState      `bson:"s"`
+	}
+	iter := c.txns.Find(bson.M{"_id": bson.M{"$in": ids}}).Select(bson.M{"s": 1}).Iter()
+	for iter.Next(&doc) {
+		states[doc.Id] = doc.State
+	}
+	if err := iter.Close(); err != nil {
+		return errors.Annotate(err, "looking up transactions")
+	}
+	for _, id := range ids {
+		state, ok := states[id]
+		for _, ref := range c.refs[id] {
+			switch {
+			case !ok:
+				c.violation(InvariantViolation{
+					Kind:       InvariantMissingTxn,
+					Collection: ref.collection,
+					DocId:      ref.docId,
+					Txn:        id,
+					Detail:     fmt.Sprintf("txn %s doesn't exist", id.Hex()),
+				})
+			case state == TxnApplied && !c.staleBefore.IsZero() && id.Time().Before(c.staleBefore):
+				c.violation(InvariantViolation{
+					Kind:       InvariantStaleReference,
+					Collection: ref.collection,
+					DocId:      ref.docId,
+					Txn:        id,
+					Detail:     fmt.Sprintf("txn %s was applied at %s", id.Hex(), id.Time().UTC().Format(time.RFC3339)),
+				})
+			}
+		}
+	}
+	c.refs = make(map[bson.ObjectId][]invariantRef)
+	return nil
+}
+
+// checkStashDuplicates reports the stash documents whose documents exist,
+// unless a transaction in their queue is pending.
+func (c *invariantChecker) checkStashDuplicates() error {
+	for _, dup := range c.duplicates {
+		pending := 0
+		if len(dup.txns) > 0 {
+			var err error
+			pending, err = c.txns.Find(bson.M{
+				"_id": bson.M{"$in": dup.txns},
+				"s":   bson.M{"$in": pendingTxnStates},
+			}).Count()
+			if err != nil {
+				return errors.Annotate(err, "looking up stash transactions")
+			}
+		}
+		if pending == 0 {
+			c.violation(InvariantViolation{
+				Kind:       InvariantStash,
+				Collection: c.stash,
+				DocId:      dup.docId,
+				Detail:     "the document exists, but no transaction in its queue is pending",
+			})
+		}
+	}
+	return nil
+}
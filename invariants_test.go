@@ -0,0 +1,135 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type InvariantsSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&InvariantsSuite{})
+
+func (s *InvariantsSuite) TestConsistent(c *gc.C) {
+	s.runTxn(c, txn.Op{C: "coll", Id: "a", Insert: bson.M{}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "a", Update: bson.M{"$set": bson.M{"x": 1}}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "b", Insert: bson.M{}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "b", Remove: true})
+	s.runInterruptedTxn(c, txn.Op{C: "coll", Id: "c", Insert: bson.M{}})
+
+	report, err := jujutxn.CheckInvariants(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(report.OK(), jc.IsTrue)
+	c.Check(report.Violations, gc.HasLen, 0)
+	c.Check(report.Collections, jc.GreaterThan, 0)
+	c.Check(report.TokensChecked, jc.GreaterThan, 0)
+}
+
+// insertWithMissingTxn inserts a document whose queue refers to a
+// transaction that doesn't exist, and returns the transaction's id.
+func (s *InvariantsSuite) insertWithMissingTxn(c *gc.C, collection string, id interface{}) bson.ObjectId {
+	txnId := bson.NewObjectId()
+	err := s.db.C(collection).Insert(bson.M{
+		"_id":       id,
+		"txn-queue": []string{txnId.Hex() + "_12345678"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return txnId
+}
+
+func (s *InvariantsSuite) TestMissingTxn(c *gc.C) {
+	s.runTxn(c, txn.Op{C: "coll", Id: "b", Insert: bson.M{}})
+	txnId := s.insertWithMissingTxn(c, "coll", "a")
+
+	report, err := jujutxn.CheckInvariants(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(report.OK(), jc.IsFalse)
+	c.Assert(report.Violations, gc.HasLen, 1)
+	v := report.Violations[0]
+	c.Check(v.Kind, gc.Equals, jujutxn.InvariantMissingTxn)
+	c.Check(v.Collection, gc.Equals, "coll")
+	c.Check(v.DocId, gc.Equals, "a")
+	c.Check(v.Txn, gc.Equals, txnId)
+}
+
+func (s *InvariantsSuite) TestStaleReference(c *gc.C) {
+	old := s.runTxnWithTimestamp(c, nil, time.Now().Add(-2*time.Hour),
+		txn.Op{C: "coll", Id: "a", Insert: bson.M{}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "b", Insert: bson.M{}})
+
+	report, err := jujutxn.CheckInvariants(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(report.OK(), jc.IsTrue)
+
+	report, err = jujutxn.CheckInvariantsWithOptions(s.db, "txns", jujutxn.InvariantOptions{
+		MaxAppliedAge: time.Hour,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(report.Violations, gc.HasLen, 1)
+	v := report.Violations[0]
+	c.Check(v.Kind, gc.Equals, jujutxn.InvariantStaleReference)
+	c.Check(v.DocId, gc.Equals, "a")
+	c.Check(v.Txn, gc.Equals, old)
+}
+
+func (s *InvariantsSuite) TestStashDuplicate(c *gc.C) {
+	txnId := s.runTxn(c, txn.Op{C: "coll", Id: "a", Insert: bson.M{}})
+	token := txnId.Hex() + "_12345678"
+	err := s.db.C("txns.stash").Insert(bson.M{
+		"_id":       bson.D{{"c", "coll"}, {"id", "a"}},
+		"txn-queue": []string{token},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	report, err := jujutxn.CheckInvariants(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(report.Violations, gc.HasLen, 1)
+	v := report.Violations[0]
+	c.Check(v.Kind, gc.Equals, jujutxn.InvariantStash)
+	c.Check(v.Collection, gc.Equals, "txns.stash")
+}
+
+func (s *InvariantsSuite) TestCollections(c *gc.C) {
+	s.insertWithMissingTxn(c, "coll", "a")
+	s.runTxn(c, txn.Op{C: "other", Id: "a", Insert: bson.M{}})
+
+	report, err := jujutxn.CheckInvariantsWithOptions(s.db, "txns", jujutxn.InvariantOptions{
+		Collections: []string{"other"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(report.OK(), jc.IsTrue)
+	c.Check(report.Collections, gc.Equals, 1)
+}
+
+func (s *InvariantsSuite) TestMaxViolations(c *gc.C) {
+	for _, id := range []string{"a", "b", "c"} {
+		s.insertWithMissingTxn(c, "coll", id)
+	}
+
+	report, err := jujutxn.CheckInvariantsWithOptions(s.db, "txns", jujutxn.InvariantOptions{
+		MaxViolations: 2,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(report.Violations, gc.HasLen, 2)
+	c.Check(report.Truncated, jc.IsTrue)
+	c.Check(report.OK(), jc.IsFalse)
+}
+
+func (s *InvariantsSuite) TestInvalidOptions(c *gc.C) {
+	_, err := jujutxn.CheckInvariantsWithOptions(s.db, "txns", jujutxn.InvariantOptions{
+		MaxAppliedAge: -time.Second,
+	})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	c.Check(err, gc.ErrorMatches, "negative MaxAppliedAge -1s not valid")
+}
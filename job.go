@@ -0,0 +1,246 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	stderrors "errors"
+	"sync"
+	"time"
+)
+
+// ErrPruneCancelled is returned by a PruneJob that was cancelled.
+var ErrPruneCancelled = stderrors.New("pruning cancelled")
+
+// PruneJobState describes what a PruneJob is doing.
+type PruneJobState string
+
+const (
+	// PruneJobRunning means the job is pruning.
+	PruneJobRunning PruneJobState = "running"
+
+	// PruneJobPaused means the job has been asked to pause. It stops at
+	// the end of the batch of transactions it is working on.
+	PruneJobPaused PruneJobState = "paused"
+
+	// PruneJobCancelling means the job has been cancelled, and will stop
+	// at the end of its current batch.
+	PruneJobCancelling PruneJobState = "cancelling"
+
+	// PruneJobDone means the job has finished.
+	PruneJobDone PruneJobState = "done"
+)
+
+// PruneJobStatus is a snapshot of the progress of a PruneJob.
+type PruneJobStatus struct {
+	// State is what the job is currently doing.
+	State PruneJobState
+
+	// Started is when the job was started.
+	Started time.Time
+
+	// Paused is the total time the job has spent paused.
+	Paused time.Duration
+
+	// TxnsRemoved and DocsCleaned count the work done so far.
+	TxnsRemoved int
+	DocsCleaned int
+
+	// Phase, Collection and Batch are what the pruners last reported
+	// working on. See ProgressMessage.
+	Phase      PrunePhase
+	Collection string
+	Batch      int
+
+	// PeakHeapBytes is the most heap memory the process was seen to use
+	// while pruning. See PrunerStats.PeakHeapBytes.
+	PeakHeapBytes int64
+
+	// LastProgress is when the pruners last reported progress, or when
+	// the job was started if they haven't yet.
+	LastProgress time.Time
+}
+
+// PruneJob is a handle on a CleanAndPrune running in the background,
+// returned by StartCleanAndPrune. It lets embedding applications manage
+// pruning as a background job rather than blocking a goroutine on it.
+type PruneJob struct {
+	done chan struct{}
+
+	mu       sync.Mutex
+	resumed  *sync.Cond
+	status   PruneJobStatus
+	pausedAt time.Time
+	stats    CleanupStats
+	err      error
+}
+
+// StartCleanAndPrune validates args, and then runs CleanAndPrune in the
+// background. The returned job can be used to pause and resume pruning,
+// for example during load spikes, without losing progress, to cancel it,
+// and to collect its result.
+func StartCleanAndPrune(args CleanAndPruneArgs) (*PruneJob, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	job := newPruneJob()
+	args.job = job
+	go func() {
+		stats, err := CleanAndPrune(args)
+		job.finish(stats, err)
+	}()
+	return job, nil
+}
+
+func newPruneJob() *PruneJob {
+	now := time.Now()
+	job := &PruneJob{
+		done: make(chan struct{}),
+		status: PruneJobStatus{
+			State:        PruneJobRunning,
+			Started:      now,
+			LastProgress: now,
+		},
+	}
+	job.resumed = sync.NewCond(&job.mu)
+	return job
+}
+
+// Pause asks the job to stop once it has finished its current batch of
+// transactions. It has no effect if the job is already paused or done.
+func (job *PruneJob) Pause() {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.status.State != PruneJobRunning {
+		return
+	}
+	pruneLogger.Infof("pausing pruning")
+	job.status.State = PruneJobPaused
+	job.pausedAt = time.Now()
+}
+
+// Resume continues a paused job from where it stopped. It has no effect if
+// the job isn't paused.
+func (job *PruneJob) Resume() {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.status.State != PruneJobPaused {
+		return
+	}
+	pruneLogger.Infof("resuming pruning")
+	job.status.State = PruneJobRunning
+	job.status.Paused += time.Since(job.pausedAt)
+	job.resumed.Broadcast()
+}
+
+// Status returns the current state and progress of the job.
+func (job *PruneJob) Status() PruneJobStatus {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	status := job.status
+	if status.State == PruneJobPaused {
+		status.Paused += time.Since(job.pausedAt)
+	}
+	return status
+}
+
+// Cancel asks the job to stop at the end of its current batch, even if it
+// is paused. The job then finishes with ErrPruneCancelled. Work that has
+// already been done is kept. It has no effect if the job is done.
+func (job *PruneJob) Cancel() {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	switch job.status.State {
+	case PruneJobPaused:
+		job.status.Paused += time.Since(job.pausedAt)
+	case PruneJobRunning:
+	default:
+		return
+	}
+	pruneLogger.Infof("cancelling pruning")
+	job.status.State = PruneJobCancelling
+	job.resumed.Broadcast()
+}
+
+// Done returns a channel that is closed when the job has finished.
+func (job *PruneJob) Done() <-chan struct{} {
+	return job.done
+}
+
+// Stats returns the stats of the finished job. Until the job is done, it
+// returns empty stats; use Status to follow its progress.
+func (job *PruneJob) Stats() CleanupStats {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.stats
+}
+
+// Err returns the error the job finished with, which is ErrPruneCancelled
+// if it was cancelled. It returns nil until the job is done.
+func (job *PruneJob) Err() error {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.err
+}
+
+// Wait blocks until the job is done, and returns the result of
+// CleanAndPrune.
+func (job *PruneJob) Wait() (CleanupStats, error) {
+	<-job.done
+	return job.Stats(), job.Err()
+}
+
+// checkpoint is called by the pruners between batches. It blocks while
+// the job is paused, and returns ErrPruneCancelled if the job has been
+// cancelled. It may be called on a nil job.
+func (job *PruneJob) checkpoint() error {
+	if job == nil {
+		return nil
+	}
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	for job.status.State == PruneJobPaused {
+		job.resumed.Wait()
+	}
+	if job.status.State == PruneJobCancelling {
+		return ErrPruneCancelled
+	}
+	return nil
+}
+
+// addProgress records the progress reported by the pruners. It may be
+// called on a nil job.
+func (job *PruneJob) addProgress(msg ProgressMessage) {
+	if job == nil {
+		return
+	}
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.status.LastProgress = time.Now()
+	job.status.TxnsRemoved += msg.TxnsRemoved
+	job.status.DocsCleaned += msg.DocsCleaned
+	if msg.PeakHeapBytes > job.status.PeakHeapBytes {
+		job.status.PeakHeapBytes = msg.PeakHeapBytes
+	}
+	if msg.Phase != "" {
+		job.status.Phase = msg.Phase
+		job.status.Collection = msg.Collection
+		job.status.Batch = msg.Batch
+	}
+}
+
+func (job *PruneJob) finish(stats CleanupStats, err error) {
+	job.mu.Lock()
+	if job.status.State == PruneJobPaused {
+		job.status.Paused += time.Since(job.pausedAt)
+	}
+	if job.status.State == PruneJobCancelling && stderrors.Is(err, ErrPruneCancelled) {
+		// Don't report which pruner noticed the cancellation.
+		err = ErrPruneCancelled
+	}
+	job.status.State = PruneJobDone
+	job.stats = stats
+	job.err = err
+	job.mu.Unlock()
+	close(job.done)
+}
@@ -0,0 +1,107 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"errors"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type PruneJobSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&PruneJobSuite{})
+
+func (*PruneJobSuite) TestPauseAndResume(c *gc.C) {
+	job := newPruneJob()
+	c.Check(job.Status().State, gc.Equals, PruneJobRunning)
+	job.Pause()
+	c.Check(job.Status().State, gc.Equals, PruneJobPaused)
+
+	waited := make(chan struct{})
+	go func() {
+		c.Check(job.checkpoint(), jc.ErrorIsNil)
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		c.Fatalf("checkpoint returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	job.Resume()
+	select {
+	case <-waited:
+	case <-time.After(testing.LongWait):
+		c.Fatalf("checkpoint did not return after Resume")
+	}
+	status := job.Status()
+	c.Check(status.State, gc.Equals, PruneJobRunning)
+	c.Check(status.Paused >= 50*time.Millisecond, jc.IsTrue)
+}
+
+func (*PruneJobSuite) TestNilJobDoesNotBlock(c *gc.C) {
+	var job *PruneJob
+	c.Check(job.checkpoint(), jc.ErrorIsNil)
+	job.addProgress(ProgressMessage{TxnsRemoved: 1})
+}
+
+func (*PruneJobSuite) TestProgressAndFinish(c *gc.C) {
+	job := newPruneJob()
+	job.addProgress(ProgressMessage{TxnsRemoved: 2})
+	job.addProgress(ProgressMessage{TxnsRemoved: 1, DocsCleaned: 3})
+	job.addProgress(ProgressMessage{Phase: PrunePhaseCleaningDocs, Collection: "coll", Batch: 2})
+	job.addProgress(ProgressMessage{PeakHeapBytes: 2048, Batch: 2})
+	job.addProgress(ProgressMessage{PeakHeapBytes: 1024, Batch: 2})
+	job.Pause()
+	job.finish(CleanupStats{TransactionsRemoved: 3}, errors.New("boom"))
+
+	status := job.Status()
+	c.Check(status.State, gc.Equals, PruneJobDone)
+	c.Check(status.TxnsRemoved, gc.Equals, 3)
+	c.Check(status.DocsCleaned, gc.Equals, 3)
+	c.Check(status.Phase, gc.Equals, PrunePhaseCleaningDocs)
+	c.Check(status.Collection, gc.Equals, "coll")
+	c.Check(status.Batch, gc.Equals, 2)
+	c.Check(status.PeakHeapBytes, gc.Equals, int64(2048))
+	// Pausing or resuming a finished job does nothing.
+	job.Pause()
+	job.Resume()
+	c.Check(job.Status().State, gc.Equals, PruneJobDone)
+
+	stats, err := job.Wait()
+	c.Check(stats.TransactionsRemoved, gc.Equals, 3)
+	c.Check(err, gc.ErrorMatches, "boom")
+	c.Check(job.Err(), gc.Equals, err)
+}
+
+func (*PruneJobSuite) TestCancelWhilePaused(c *gc.C) {
+	job := newPruneJob()
+	job.Pause()
+	result := make(chan error)
+	go func() {
+		result <- job.checkpoint()
+	}()
+	job.Cancel()
+	select {
+	case err := <-result:
+		c.Check(err, gc.Equals, ErrPruneCancelled)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("checkpoint did not return after Cancel")
+	}
+	c.Check(job.Status().State, gc.Equals, PruneJobCancelling)
+
+	job.finish(CleanupStats{Passes: 1}, &WorkerError{Worker: "forward", Err: ErrPruneCancelled})
+	select {
+	case <-job.Done():
+	default:
+		c.Fatalf("job not done")
+	}
+	c.Check(job.Err(), gc.Equals, ErrPruneCancelled)
+	c.Check(job.Stats().Passes, gc.Equals, 1)
+}
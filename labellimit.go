@@ -0,0 +1,301 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// LabelLimit bounds how many transactions with a label a Runner runs at
+// once. See RunnerParams.LabelLimits. It is also used to bound the
+// attempts a Runner makes at once, by RunnerParams.InFlightLimit.
+type LabelLimit struct {
+	// MaxConcurrent is the most transactions with the label that are run
+	// at once. 0 means no limit.
+	MaxConcurrent int
+
+	// MaxQueued is the most transactions with the label that wait for
+	// one of those running to finish. Transactions beyond it fail
+	// immediately with an *ErrLabelLimit, or an *ErrRunnerBusy for
+	// InFlightLimit. 0 means none wait.
+	MaxQueued int
+
+	// MaxWait, if not 0, is the longest a transaction waits before
+	// failing in the same way.
+	MaxWait time.Duration
+}
+
+// LabelLimitStats counts the transactions with a label that were subject
+// to a LabelLimit.
+type LabelLimitStats struct {
+	// Admitted is how many transactions were run, and Waited is how many
+	// of them had to wait first.
+	Admitted int64
+	Waited   int64
+
+	// Rejected is how many transactions were refused, because the queue
+	// was full or they waited too long.
+	Rejected int64
+
+	// Running and Queued are the transactions running and waiting when
+	// the stats were taken.
+	Running int
+	Queued  int
+}
+
+// ErrLabelLimit is returned by Run and RunTransaction when a transaction
+// is rejected because too many transactions with its label are running,
+// as configured by RunnerParams.LabelLimits. The transaction hasn't been
+// attempted, and may be tried again later.
+type ErrLabelLimit struct {
+	// Label is the label of the transaction.
+	Label string
+
+	// Running and Queued are the transactions with the label that were
+	// running and waiting when it was rejected.
+	Running int
+	Queued  int
+}
+
+// Error is part of the error interface.
+func (e *ErrLabelLimit) Error() string {
+	return fmt.Sprintf("too many transactions labelled %q (%d running, %d queued)", e.Label, e.Running, e.Queued)
+}
+
+// IsLabelLimit returns true if err is, or was caused by, an
+// *ErrLabelLimit.
+func IsLabelLimit(err error) bool {
+	_, ok := errors.Cause(err).(*ErrLabelLimit)
+	return ok
+}
+
+// ErrRunnerBusy is returned by Run and RunTransaction when a transaction
+// is rejected because the runner is already making as many attempts as
+// RunnerParams.InFlightLimit allows. The transaction hasn't been
+// attempted, and may be tried again later.
+type ErrRunnerBusy struct {
+	// Running and Queued are the attempts that were in flight and
+	// waiting when it was rejected.
+	Running int
+	Queued  int
+}
+
+// Error is part of the error interface.
+func (e *ErrRunnerBusy) Error() string {
+	return fmt.Sprintf("transaction runner busy (%d in flight, %d queued)", e.Running, e.Queued)
+}
+
+// IsRunnerBusy returns true if err is, or was caused by, an
+// *ErrRunnerBusy.
+func IsRunnerBusy(err error) bool {
+	_, ok := errors.Cause(err).(*ErrRunnerBusy)
+	return ok
+}
+
+// inFlightLabel is the label every attempt is counted under by the
+// labelLimiter that enforces RunnerParams.InFlightLimit.
+const inFlightLabel = "(in-flight)"
+
+// callerLabel is the default RunnerParams.LabelKey.
+func callerLabel(transaction *Transaction) string {
+	if transaction.Metadata == nil {
+		return ""
+	}
+	return transaction.Metadata.Caller
+}
+
+// labelSlots tracks the transactions with a label that are running, and
+// those waiting to run, in the order they arrived.
+type labelSlots struct {
+	running int
+	waiters []chan struct{}
+}
+
+// labelLimiter enforces LabelLimits. Slots are handed directly from a
+// finishing transaction to the longest waiting one, so that waiters are
+// served in order.
+type labelLimiter struct {
+	key          func(*Transaction) string
+	limits       map[string]LabelLimit
+	defaultLimit LabelLimit
+
+	// inFlight is true if the limiter enforces InFlightLimit, rejecting
+	// with *ErrRunnerBusy rather than *ErrLabelLimit.
+	inFlight bool
+
+	mu     sync.Mutex
+	labels map[string]*labelSlots
+	stats  map[string]LabelLimitStats
+}
+
+// newLabelLimiter returns a labelLimiter for the label limits in params,
+// or nil if there are none.
+func newLabelLimiter(params RunnerParams) *labelLimiter {
+	if len(params.LabelLimits) == 0 && params.DefaultLabelLimit.MaxConcurrent <= 0 {
+		return nil
+	}
+	l := &labelLimiter{
+		key:          params.LabelKey,
+		limits:       params.LabelLimits,
+		defaultLimit: params.DefaultLabelLimit,
+		labels:       make(map[string]*labelSlots),
+		stats:        make(map[string]LabelLimitStats),
+	}
+	if l.key == nil {
+		l.key = callerLabel
+	}
+	return l
+}
+
+// newInFlightLimiter returns a labelLimiter that enforces limit on every
+// attempt, or nil if limit doesn't bound them.
+func newInFlightLimiter(limit LabelLimit) *labelLimiter {
+	if limit.MaxConcurrent <= 0 {
+		return nil
+	}
+	return &labelLimiter{
+		key:          func(*Transaction) string { return inFlightLabel },
+		defaultLimit: limit,
+		inFlight:     true,
+		labels:       make(map[string]*labelSlots),
+		stats:        make(map[string]LabelLimitStats),
+	}
+}
+
+// acquire waits until transaction may run, and returns a func that must
+// be called once it has, or an *ErrLabelLimit or *ErrRunnerBusy if it may
+// not. It is safe to call on a nil labelLimiter.
+func (l *labelLimiter) acquire(transaction *Transaction) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	label := l.key(transaction)
+	if label == "" {
+		return func() {}, nil
+	}
+	limit, ok := l.limits[label]
+	if !ok {
+		limit = l.defaultLimit
+	}
+	if limit.MaxConcurrent <= 0 {
+		return func() {}, nil
+	}
+	release := func() { l.release(label) }
+
+	l.mu.Lock()
+	slots := l.labels[label]
+	if slots == nil {
+		slots = &labelSlots{}
+		l.labels[label] = slots
+	}
+	if slots.running < limit.MaxConcurrent && len(slots.waiters) == 0 {
+		slots.running++
+		l.record(label, func(stats *LabelLimitStats) { stats.Admitted++ })
+		l.mu.Unlock()
+		return release, nil
+	}
+	if len(slots.waiters) >= limit.MaxQueued {
+		err := l.reject(label, slots)
+		l.mu.Unlock()
+		return nil, err
+	}
+	ready := make(chan struct{})
+	slots.waiters = append(slots.waiters, ready)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if limit.MaxWait > 0 {
+		timer := time.NewTimer(limit.MaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ready:
+	case <-timeout:
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, waiter := range slots.waiters {
+			if waiter == ready {
+				slots.waiters = append(slots.waiters[:i], slots.waiters[i+1:]...)
+				return nil, l.reject(label, slots)
+			}
+		}
+		// The slot was handed over as the wait timed out.
+		l.record(label, func(stats *LabelLimitStats) { stats.Admitted++; stats.Waited++ })
+		return release, nil
+	}
+	l.mu.Lock()
+	l.record(label, func(stats *LabelLimitStats) { stats.Admitted++; stats.Waited++ })
+	l.mu.Unlock()
+	return release, nil
+}
+
+// release hands the slot of a finished transaction to the next waiting
+// one, if any. l.mu must not be held.
+func (l *labelLimiter) release(label string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	slots := l.labels[label]
+	if len(slots.waiters) > 0 {
+		close(slots.waiters[0])
+		slots.waiters = slots.waiters[1:]
+		return
+	}
+	slots.running--
+	if slots.running == 0 {
+		delete(l.labels, label)
+	}
+}
+
+// reject counts a rejected transaction and returns its error. l.mu must
+// be held.
+func (l *labelLimiter) reject(label string, slots *labelSlots) error {
+	l.record(label, func(stats *LabelLimitStats) { stats.Rejected++ })
+	if l.inFlight {
+		return &ErrRunnerBusy{
+			Running: slots.running,
+			Queued:  len(slots.waiters),
+		}
+	}
+	return &ErrLabelLimit{
+		Label:   label,
+		Running: slots.running,
+		Queued:  len(slots.waiters),
+	}
+}
+
+// record updates the stats of label, or of otherLabel once stats are kept
+// for maxStatsLabels labels. l.mu must be held.
+func (l *labelLimiter) record(label string, update func(*LabelLimitStats)) {
+	stats, ok := l.stats[label]
+	if !ok && len(l.stats) >= maxStatsLabels {
+		label = otherLabel
+		stats = l.stats[label]
+	}
+	update(&stats)
+	l.stats[label] = stats
+}
+
+// snapshot returns a copy of the stats, with the transactions running and
+// queued now. It is safe to call on a nil labelLimiter.
+func (l *labelLimiter) snapshot() map[string]LabelLimitStats {
+	stats := make(map[string]LabelLimitStats)
+	if l == nil {
+		return stats
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for label, labelStats := range l.stats {
+		if slots := l.labels[label]; slots != nil {
+			labelStats.Running = slots.running
+			labelStats.Queued = len(slots.waiters)
+		}
+		stats[label] = labelStats
+	}
+	return stats
+}
@@ -0,0 +1,155 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	jujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type LabelLimitSuite struct {
+	jujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&LabelLimitSuite{})
+
+func labelled(caller string) *Transaction {
+	return &Transaction{Metadata: &TxnMetadata{Caller: caller}}
+}
+
+func (s *LabelLimitSuite) TestNoLimits(c *gc.C) {
+	c.Check(newLabelLimiter(RunnerParams{}), gc.IsNil)
+	var l *labelLimiter
+	release, err := l.acquire(labelled("a"))
+	c.Assert(err, jc.ErrorIsNil)
+	release()
+	c.Check(l.snapshot(), gc.HasLen, 0)
+}
+
+func (s *LabelLimitSuite) TestUnlabelledNotLimited(c *gc.C) {
+	l := newLabelLimiter(RunnerParams{DefaultLabelLimit: LabelLimit{MaxConcurrent: 1}})
+	for i := 0; i < 3; i++ {
+		_, err := l.acquire(&Transaction{})
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	c.Check(l.snapshot(), gc.HasLen, 0)
+}
+
+func (s *LabelLimitSuite) TestRejectsBeyondQueue(c *gc.C) {
+	l := newLabelLimiter(RunnerParams{
+		LabelLimits: map[string]LabelLimit{"noisy": {MaxConcurrent: 2}},
+	})
+	release1, err := l.acquire(labelled("noisy"))
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = l.acquire(labelled("noisy"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = l.acquire(labelled("noisy"))
+	c.Check(err, jc.Satisfies, IsLabelLimit)
+	c.Check(errors.Cause(err), gc.DeepEquals, &ErrLabelLimit{Label: "noisy", Running: 2})
+	c.Check(err, gc.ErrorMatches, `too many transactions labelled "noisy" \(2 running, 0 queued\)`)
+
+	// Other labels aren't affected.
+	_, err = l.acquire(labelled("quiet"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	release1()
+	_, err = l.acquire(labelled("noisy"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(l.snapshot(), jc.DeepEquals, map[string]LabelLimitStats{
+		"noisy": {Admitted: 3, Rejected: 1, Running: 2},
+	})
+}
+
+func (s *LabelLimitSuite) TestWaitersServedInOrder(c *gc.C) {
+	l := newLabelLimiter(RunnerParams{
+		DefaultLabelLimit: LabelLimit{MaxConcurrent: 1, MaxQueued: 2},
+	})
+	release, err := l.acquire(labelled("a"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	order := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		i := i
+		go func() {
+			release, err := l.acquire(labelled("a"))
+			c.Check(err, jc.ErrorIsNil)
+			order <- i
+			release()
+		}()
+		// Wait for the goroutine to queue, so the order is known.
+		for l.snapshot()["a"].Queued != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	_, err = l.acquire(labelled("a"))
+	c.Check(err, jc.Satisfies, IsLabelLimit)
+
+	release()
+	c.Check(<-order, gc.Equals, 0)
+	c.Check(<-order, gc.Equals, 1)
+	for l.snapshot()["a"].Admitted != 3 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Check(l.snapshot(), jc.DeepEquals, map[string]LabelLimitStats{
+		"a": {Admitted: 3, Waited: 2, Rejected: 1},
+	})
+}
+
+func (s *LabelLimitSuite) TestMaxWait(c *gc.C) {
+	l := newLabelLimiter(RunnerParams{
+		DefaultLabelLimit: LabelLimit{MaxConcurrent: 1, MaxQueued: 1, MaxWait: 10 * time.Millisecond},
+	})
+	_, err := l.acquire(labelled("a"))
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = l.acquire(labelled("a"))
+	c.Check(err, jc.Satisfies, IsLabelLimit)
+	c.Check(l.snapshot()["a"], gc.Equals, LabelLimitStats{Admitted: 1, Rejected: 1, Running: 1})
+}
+
+func (s *LabelLimitSuite) TestLabelKey(c *gc.C) {
+	l := newLabelLimiter(RunnerParams{
+		DefaultLabelLimit: LabelLimit{MaxConcurrent: 1},
+		LabelKey: func(t *Transaction) string {
+			return t.Metadata.ModelUUID
+		},
+	})
+	_, err := l.acquire(&Transaction{Metadata: &TxnMetadata{Caller: "x", ModelUUID: "tenant"}})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = l.acquire(&Transaction{Metadata: &TxnMetadata{Caller: "y", ModelUUID: "tenant"}})
+	c.Check(err, gc.ErrorMatches, `too many transactions labelled "tenant" .*`)
+}
+
+func (s *LabelLimitSuite) TestInFlightLimit(c *gc.C) {
+	c.Check(newInFlightLimiter(LabelLimit{}), gc.IsNil)
+	l := newInFlightLimiter(LabelLimit{MaxConcurrent: 1, MaxQueued: 1, MaxWait: time.Minute})
+
+	// Every attempt counts, labelled or not.
+	release, err := l.acquire(&Transaction{})
+	c.Assert(err, jc.ErrorIsNil)
+	admitted := make(chan struct{})
+	go func() {
+		release, err := l.acquire(labelled("a"))
+		c.Check(err, jc.ErrorIsNil)
+		close(admitted)
+		release()
+	}()
+	for l.snapshot()[inFlightLabel].Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	_, err = l.acquire(labelled("b"))
+	c.Check(err, jc.Satisfies, IsRunnerBusy)
+	c.Check(err, gc.ErrorMatches, `transaction runner busy \(1 in flight, 1 queued\)`)
+
+	release()
+	<-admitted
+	for l.snapshot()[inFlightLabel].Running != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Check(l.snapshot()[inFlightLabel], gc.Equals, LabelLimitStats{Admitted: 2, Waited: 1, Rejected: 1})
+}
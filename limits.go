@@ -0,0 +1,247 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+)
+
+// txnLimitWarnFraction is how close to a limit a transaction has to be
+// before the TxnLimitObserver is told about it.
+const txnLimitWarnFraction = 0.8
+
+// TxnLimitPolicy determines what a Runner does with a transaction that
+// exceeds RunnerParams.MaxOpsPerTxn or RunnerParams.MaxTxnDocBytes.
+type TxnLimitPolicy int
+
+const (
+	// TxnLimitReject fails the transaction with a *TxnLimitError without
+	// running it. This is the default.
+	TxnLimitReject TxnLimitPolicy = iota
+
+	// TxnLimitSplit runs the operations as a sequence of smaller
+	// transactions, each within the limits. The operations are no longer
+	// applied atomically: if one of the smaller transactions fails, the
+	// ones before it will already have been applied, and the failure is
+	// returned as a *PartialTxnError, which Run doesn't retry. Only use
+	// this for operations that are independent of each other.
+	TxnLimitSplit
+
+	// TxnLimitWarn logs a warning and runs the transaction anyway.
+	TxnLimitWarn
+)
+
+// String returns the name of the policy.
+func (p TxnLimitPolicy) String() string {
+	switch p {
+	case TxnLimitReject:
+		return "reject"
+	case TxnLimitSplit:
+		return "split"
+	case TxnLimitWarn:
+		return "warn"
+	}
+	return fmt.Sprintf("TxnLimitPolicy(%d)", int(p))
+}
+
+// TxnLimitEvent is passed to RunnerParams.TxnLimitObserver whenever a
+// transaction is close to, or over, one of the configured limits.
+type TxnLimitEvent struct {
+	// Ops is the number of operations in the transaction.
+	Ops int
+
+	// DocBytes is the estimated size of the transaction document.
+	DocBytes int
+
+	// MaxOps and MaxDocBytes are the configured limits, 0 if unset.
+	MaxOps      int
+	MaxDocBytes int
+
+	// Exceeded is true if the transaction is over one of the limits,
+	// in which case Policy has been applied to it.
+	Exceeded bool
+
+	// Policy is the configured TxnLimitPolicy.
+	Policy TxnLimitPolicy
+}
+
+// TxnLimitError is returned when a transaction exceeds the configured
+// limits and either the policy is TxnLimitReject, or the transaction
+// cannot be split any further.
+type TxnLimitError struct {
+	Ops         int
+	DocBytes    int
+	MaxOps      int
+	MaxDocBytes int
+}
+
+// Error is part of the error interface.
+func (e *TxnLimitError) Error() string {
+	if e.MaxOps > 0 && e.Ops > e.MaxOps {
+		return fmt.Sprintf("transaction has %d operations, limit is %d", e.Ops, e.MaxOps)
+	}
+	return fmt.Sprintf("transaction document is %d bytes, limit is %d", e.DocBytes, e.MaxDocBytes)
+}
+
+// IsTxnLimitError returns true if err is, or was caused by, a *TxnLimitError.
+func IsTxnLimitError(err error) bool {
+	_, ok := errors.Cause(err).(*TxnLimitError)
+	return ok
+}
+
+// PartialTxnError is returned when a transaction split up by
+// TxnLimitSplit fails after some of the smaller transactions it was split
+// into have been applied. Run doesn't retry it, as running all of the
+// operations again would apply the earlier ones twice.
+type PartialTxnError struct {
+	// Applied is the number of operations that were applied.
+	Applied int
+
+	// Ops is the number of operations in the whole transaction.
+	Ops int
+
+	// Err is the error from the smaller transaction that failed.
+	Err error
+}
+
+// Error is part of the error interface.
+func (e *PartialTxnError) Error() string {
+	return fmt.Sprintf("%v (after %d of %d operations were applied)", e.Err, e.Applied, e.Ops)
+}
+
+// Unwrap returns the error from the smaller transaction that failed.
+func (e *PartialTxnError) Unwrap() error {
+	return e.Err
+}
+
+// IsPartialTxnError returns true if err is, or was caused by, a
+// *PartialTxnError.
+func IsPartialTxnError(err error) bool {
+	_, ok := errors.Cause(err).(*PartialTxnError)
+	return ok
+}
+
+// txnDocSize estimates the size of the mgo/txn document that will hold ops.
+func txnDocSize(ops []txn.Op) (int, error) {
+	data, err := bson.Marshal(struct {
+		Id  bson.ObjectId `bson:"_id"`
+		Ops []txn.Op      `bson:"o"`
+	}{bson.NewObjectId(), ops})
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return len(data), nil
+}
+
+// limitsEnabled returns true if either of the transaction limits is set.
+func (tr *transactionRunner) limitsEnabled() bool {
+	return tr.maxOpsPerTxn > 0 || tr.maxTxnDocBytes > 0
+}
+
+// applyTxnLimits checks ops against the configured limits, and returns the
+// transactions that should be run in their place. Unless the ops are split,
+// that is just ops itself.
+func (tr *transactionRunner) applyTxnLimits(ops []txn.Op) ([][]txn.Op, error) {
+	size := 0
+	if tr.maxTxnDocBytes > 0 {
+		var err error
+		if size, err = txnDocSize(ops); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	exceeded := (tr.maxOpsPerTxn > 0 && len(ops) > tr.maxOpsPerTxn) ||
+		(tr.maxTxnDocBytes > 0 && size > tr.maxTxnDocBytes)
+	approaching := (tr.maxOpsPerTxn > 0 && float64(len(ops)) >= txnLimitWarnFraction*float64(tr.maxOpsPerTxn)) ||
+		(tr.maxTxnDocBytes > 0 && float64(size) >= txnLimitWarnFraction*float64(tr.maxTxnDocBytes))
+	if approaching && tr.txnLimitObserver != nil {
+		tr.txnLimitObserver(TxnLimitEvent{
+			Ops:         len(ops),
+			DocBytes:    size,
+			MaxOps:      tr.maxOpsPerTxn,
+			MaxDocBytes: tr.maxTxnDocBytes,
+			Exceeded:    exceeded,
+			Policy:      tr.txnLimitPolicy,
+		})
+	}
+	if !exceeded {
+		return [][]txn.Op{ops}, nil
+	}
+	limitErr := &TxnLimitError{
+		Ops:         len(ops),
+		DocBytes:    size,
+		MaxOps:      tr.maxOpsPerTxn,
+		MaxDocBytes: tr.maxTxnDocBytes,
+	}
+	switch tr.txnLimitPolicy {
+	case TxnLimitWarn:
+		runnerLogger.Warningf("%v, running it anyway", limitErr)
+		if runnerLogger.IsDebugEnabled() {
+			runnerLogger.Debugf("oversized transaction: %s", tr.formatOps(ops))
+		}
+		return [][]txn.Op{ops}, nil
+	case TxnLimitSplit:
+		chunks, err := tr.splitOps(ops)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		runnerLogger.Warningf("%v, splitting it into %d transactions", limitErr, len(chunks))
+		return chunks, nil
+	}
+	return nil, limitErr
+}
+
+// splitOps greedily groups ops into transactions that are each within the
+// configured limits. It fails if a single op is too large on its own.
+func (tr *transactionRunner) splitOps(ops []txn.Op) ([][]txn.Op, error) {
+	var chunks [][]txn.Op
+	var current []txn.Op
+	for _, op := range ops {
+		candidate := append(current[:len(current):len(current)], op)
+		size, fits, err := tr.withinTxnLimits(candidate)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if !fits && len(current) > 0 {
+			// Start a new transaction with this op.
+			chunks = append(chunks, current)
+			candidate = []txn.Op{op}
+			if size, fits, err = tr.withinTxnLimits(candidate); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		if !fits {
+			return nil, &TxnLimitError{
+				Ops:         1,
+				DocBytes:    size,
+				MaxOps:      tr.maxOpsPerTxn,
+				MaxDocBytes: tr.maxTxnDocBytes,
+			}
+		}
+		current = candidate
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks, nil
+}
+
+// withinTxnLimits returns the estimated document size of ops, and whether
+// ops are within the configured limits.
+func (tr *transactionRunner) withinTxnLimits(ops []txn.Op) (int, bool, error) {
+	if tr.maxOpsPerTxn > 0 && len(ops) > tr.maxOpsPerTxn {
+		return 0, false, nil
+	}
+	if tr.maxTxnDocBytes <= 0 {
+		return 0, true, nil
+	}
+	size, err := txnDocSize(ops)
+	if err != nil {
+		return 0, false, errors.Trace(err)
+	}
+	return size, size <= tr.maxTxnDocBytes, nil
+}
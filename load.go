@@ -0,0 +1,162 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	stderrors "errors"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+const (
+	// loadThrottleThreshold is the load above which we start adding extra
+	// sleep between pruning batches.
+	loadThrottleThreshold = 0.5
+
+	// loadSuspendThreshold is the load at or above which pruning is
+	// suspended until the load drops.
+	loadSuspendThreshold = 1.0
+
+	// defaultLoadPollInterval is how often we check the load while
+	// pruning is suspended.
+	defaultLoadPollInterval = 5 * time.Second
+
+	// defaultMaxLoadSuspend is how long pruning stays suspended waiting
+	// for the load to drop before it gives up.
+	defaultMaxLoadSuspend = 10 * time.Minute
+)
+
+// ErrLoadTooHigh is returned by a pruner that gave up because the database
+// stayed too busy for longer than IncrementalPruneArgs.MaxLoadSuspend.
+var ErrLoadTooHigh = stderrors.New("database load too high to prune")
+
+// LoadMonitor reports how busy the database is, so that pruning can back
+// off when the system is under pressure.
+type LoadMonitor interface {
+	// Load returns the current load as a fraction of capacity. Values of
+	// 0.5 or more cause the pruner to sleep for longer between batches,
+	// and values of 1 or more suspend pruning until the load drops.
+	Load() (float64, error)
+}
+
+// LoadMonitorFunc adapts a function to the LoadMonitor interface.
+type LoadMonitorFunc func() (float64, error)
+
+// Load is defined on LoadMonitor.
+func (f LoadMonitorFunc) Load() (float64, error) {
+	return f()
+}
+
+// NewServerStatusLoadMonitor returns a LoadMonitor that uses the
+// serverStatus command to compare the rate of operations and the number of
+// open connections against the given maximums. The reported load is the
+// larger of the two ratios. A maximum of 0 disables that check.
+func NewServerStatusLoadMonitor(db *mgo.Database, maxOpsPerSecond float64, maxConnections int) LoadMonitor {
+	return &serverStatusLoadMonitor{
+		db:              db,
+		maxOpsPerSecond: maxOpsPerSecond,
+		maxConnections:  maxConnections,
+	}
+}
+
+type serverStatusLoadMonitor struct {
+	db              *mgo.Database
+	maxOpsPerSecond float64
+	maxConnections  int
+
+	mu        sync.Mutex
+	lastOps   int64
+	lastCheck time.Time
+}
+
+type serverStatus struct {
+	Connections struct {
+		Current int `bson:"current"`
+	} `bson:"connections"`
+	OpCounters map[string]int64 `bson:"opcounters"`
+}
+
+// Load is defined on LoadMonitor.
+func (m *serverStatusLoadMonitor) Load() (float64, error) {
+	var status serverStatus
+	if err := m.db.Run(bson.D{{"serverStatus", 1}}, &status); err != nil {
+		return 0, errors.Annotate(err, "reading server status")
+	}
+	load := 0.0
+	if m.maxConnections > 0 {
+		load = float64(status.Connections.Current) / float64(m.maxConnections)
+	}
+	if m.maxOpsPerSecond > 0 {
+		var ops int64
+		for _, count := range status.OpCounters {
+			ops += count
+		}
+		now := time.Now()
+		m.mu.Lock()
+		if !m.lastCheck.IsZero() {
+			elapsed := now.Sub(m.lastCheck).Seconds()
+			if elapsed > 0 {
+				rate := float64(ops-m.lastOps) / elapsed
+				if opsLoad := rate / m.maxOpsPerSecond; opsLoad > load {
+					load = opsLoad
+				}
+			}
+		}
+		m.lastOps = ops
+		m.lastCheck = now
+		m.mu.Unlock()
+	}
+	return load, nil
+}
+
+// waitForLoad checks the load monitor between batches, sleeping for longer
+// when the database is busy. If the load is too high, it blocks until it
+// drops, checking with the job on each poll. It returns false if pruning
+// should stop instead, because the deadline passed while it was suspended,
+// in which case the pruner is marked as having reached its limit, or with
+// ErrLoadTooHigh if it was suspended for longer than maxLoadSuspend.
+func (p *IncrementalPruner) waitForLoad() (bool, error) {
+	if p.loadMonitor == nil {
+		return true, nil
+	}
+	defer checkTime(&p.stats.LoadSleepTime)()
+	suspended := time.Now()
+	for {
+		load, err := p.loadMonitor.Load()
+		if err != nil {
+			pruneLogger.Warningf("unable to check database load, continuing to prune: %v", err)
+			return true, nil
+		}
+		if load >= loadSuspendThreshold {
+			now := time.Now()
+			if !p.deadline.IsZero() && !now.Before(p.deadline) {
+				pruneLogger.Debugf("database load %.2f too high, and out of time, stopping pruning", load)
+				p.limitReached = true
+				return false, nil
+			}
+			if waited := now.Sub(suspended); waited >= p.maxLoadSuspend {
+				pruneLogger.Warningf("database load %.2f still too high after %s, giving up pruning",
+					load, waited.Round(time.Second))
+				return false, ErrLoadTooHigh
+			}
+			pruneLogger.Debugf("database load %.2f too high, suspending pruning", load)
+			time.Sleep(p.loadPollInterval)
+			if err := p.job.checkpoint(); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if load > loadThrottleThreshold {
+			// Scale the extra sleep up to maxBatchSleepTime as the
+			// load approaches the suspend threshold.
+			scale := (load - loadThrottleThreshold) / (loadSuspendThreshold - loadThrottleThreshold)
+			time.Sleep(time.Duration(scale * float64(maxBatchSleepTime)))
+		}
+		return true, nil
+	}
+}
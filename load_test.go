@@ -0,0 +1,138 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"errors"
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type LoadMonitorSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&LoadMonitorSuite{})
+
+func (s *LoadMonitorSuite) makeTxns(c *gc.C, count int) {
+	s.runTxn(c, txn.Op{
+		C:      "docs",
+		Id:     "1",
+		Insert: bson.M{},
+	})
+	for i := 1; i < count; i++ {
+		s.runTxn(c, txn.Op{
+			C:      "docs",
+			Id:     "1",
+			Update: bson.M{},
+		})
+	}
+}
+
+func (s *LoadMonitorSuite) TestSuspendsWhileOverloaded(c *gc.C) {
+	s.makeTxns(c, 25)
+	var loads []float64
+	overloaded := 3
+	monitor := LoadMonitorFunc(func() (float64, error) {
+		load := 0.0
+		if overloaded > 0 {
+			overloaded--
+			load = 1.5
+		}
+		loads = append(loads, load)
+		return load, nil
+	})
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{
+		TxnBatchSize:     10,
+		LoadMonitor:      monitor,
+		LoadPollInterval: time.Millisecond,
+	})
+	stats, err := pruner.Prune(s.txns)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TxnsRemoved, gc.Equals, int64(25))
+	// Two gaps between the three batches, the first of which waits out
+	// the overload.
+	c.Check(loads, jc.DeepEquals, []float64{1.5, 1.5, 1.5, 0, 0})
+	c.Check(stats.LoadSleepTime >= 3*time.Millisecond, jc.IsTrue)
+}
+
+func (s *LoadMonitorSuite) TestGivesUpWhenOverloadedTooLong(c *gc.C) {
+	s.makeTxns(c, 25)
+	monitor := LoadMonitorFunc(func() (float64, error) {
+		return 1.5, nil
+	})
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{
+		TxnBatchSize:     10,
+		LoadMonitor:      monitor,
+		LoadPollInterval: time.Millisecond,
+		MaxLoadSuspend:   5 * time.Millisecond,
+	})
+	stats, err := pruner.Prune(s.txns)
+	c.Check(errors.Is(err, ErrLoadTooHigh), jc.IsTrue)
+	c.Check(stats.TxnsRemoved, gc.Equals, int64(10))
+}
+
+func (s *LoadMonitorSuite) TestStopsAtDeadlineWhileOverloaded(c *gc.C) {
+	s.makeTxns(c, 25)
+	monitor := LoadMonitorFunc(func() (float64, error) {
+		return 1.5, nil
+	})
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{
+		TxnBatchSize:     10,
+		LoadMonitor:      monitor,
+		LoadPollInterval: time.Millisecond,
+		deadline:         time.Now(),
+	})
+	stats, err := pruner.Prune(s.txns)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(pruner.LimitReached(), jc.IsTrue)
+	c.Check(stats.TxnsRemoved, gc.Equals, int64(10))
+}
+
+func (s *LoadMonitorSuite) TestCancelledWhileOverloaded(c *gc.C) {
+	s.makeTxns(c, 25)
+	job := newPruneJob()
+	monitor := LoadMonitorFunc(func() (float64, error) {
+		job.Cancel()
+		return 1.5, nil
+	})
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{
+		TxnBatchSize:     10,
+		LoadMonitor:      monitor,
+		LoadPollInterval: time.Millisecond,
+		job:              job,
+	})
+	stats, err := pruner.Prune(s.txns)
+	c.Check(errors.Is(err, ErrPruneCancelled), jc.IsTrue)
+	c.Check(stats.TxnsRemoved, gc.Equals, int64(10))
+}
+
+func (s *LoadMonitorSuite) TestLoadErrorsDontStopPruning(c *gc.C) {
+	s.makeTxns(c, 25)
+	calls := 0
+	monitor := LoadMonitorFunc(func() (float64, error) {
+		calls++
+		return 0, errors.New("no stats for you")
+	})
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{
+		TxnBatchSize: 10,
+		LoadMonitor:  monitor,
+	})
+	stats, err := pruner.Prune(s.txns)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TxnsRemoved, gc.Equals, int64(25))
+	c.Check(calls, gc.Equals, 2)
+}
+
+func (s *LoadMonitorSuite) TestServerStatusConnections(c *gc.C) {
+	monitor := NewServerStatusLoadMonitor(s.db, 0, 1000000)
+	load, err := monitor.Load()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(load > 0, jc.IsTrue)
+	c.Check(load < loadThrottleThreshold, jc.IsTrue)
+}
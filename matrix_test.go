@@ -0,0 +1,90 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+//go:build txnmatrix
+// +build txnmatrix
+
+package txn_test
+
+import (
+	stdtesting "testing"
+
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+
+	jujutxn "github.com/juju/txn/v3"
+	txntesting "github.com/juju/txn/v3/testing"
+)
+
+// TestMatrix runs the tests of this module against each of the servers
+// listed by the TXN_TEST_MONGODS, TXN_TEST_MONGO_IMAGES and
+// TXN_TEST_MONGO_URIS environment variables (see
+// txntesting.MatrixTargets). Servers given by URI only get a smoke test,
+// as the suites start their own. For example:
+//
+//	TXN_TEST_MONGO_IMAGES=mongo:4.4,mongo:6.0 go test -tags txnmatrix -run TestMatrix .
+func TestMatrix(t *stdtesting.T) {
+	targets, err := txntesting.MatrixTargets(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) == 0 {
+		t.Skipf("set %s, %s or %s to test against other servers",
+			txntesting.MongodsEnv, txntesting.MongoImagesEnv, txntesting.MongoURIsEnv)
+	}
+	defer func() {
+		if err := txntesting.CleanupMatrix(); err != nil {
+			t.Error(err)
+		}
+	}()
+	for _, target := range targets {
+		target := target
+		t.Run(target.Name, func(t *stdtesting.T) {
+			if target.URI != "" {
+				matrixSmokeTest(t, target.URI)
+				return
+			}
+			output, err := txntesting.RunMatrixTests(target, "github.com/juju/txn/v3/...")
+			if err != nil {
+				t.Fatalf("%v\n%s", err, output)
+			}
+			t.Logf("%s", output)
+		})
+	}
+}
+
+// matrixSmokeTest runs and prunes some transactions on the server at uri,
+// in a database of its own.
+func matrixSmokeTest(t *stdtesting.T, uri string) {
+	session, err := mgo.Dial(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	caps, err := jujutxn.DetectServerCapabilities(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%s server version %v, replica set %v", caps.Flavour, caps.Version, caps.ReplicaSet)
+
+	db := session.DB("juju-txn-matrix")
+	defer db.DropDatabase()
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{Database: db})
+	const count = 10
+	for i := 0; i < count; i++ {
+		err := runner.RunTransaction(&jujutxn.Transaction{
+			Ops: []txn.Op{{C: "docs", Id: i, Insert: bson.M{"n": i}}},
+		})
+		if err != nil {
+			t.Fatalf("running txn %d: %v", i, err)
+		}
+	}
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{Txns: db.C("txns")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TransactionsRemoved != count {
+		t.Errorf("pruned %d txns, expected %d", stats.TransactionsRemoved, count)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// maxTxnMetadataBytes is the largest encoded TxnMetadata that may be
+// attached to a transaction. Metadata is stored on every txn document, so
+// it needs to stay small.
+const maxTxnMetadataBytes = 1024
+
+// TxnMetadata describes who ran a transaction. It is stored in the info
+// ("i") field of the txn document, so it can be found again while
+// investigating a transaction, up until the transaction is pruned.
+//
+// Metadata is only recorded for client-side transactions; server-side
+// transactions don't have a txn document to store it on.
+type TxnMetadata struct {
+	// Caller identifies the code or agent that ran the transaction.
+	Caller string `bson:"caller,omitempty"`
+
+	// ModelUUID is the model the transaction applies to.
+	ModelUUID string `bson:"model-uuid,omitempty"`
+
+	// RequestId correlates the transaction with the request that caused
+	// it, eg in application logs.
+	RequestId string `bson:"request-id,omitempty"`
+}
+
+// IsZero returns true if no metadata has been set.
+func (m TxnMetadata) IsZero() bool {
+	return m == TxnMetadata{}
+}
+
+// validate checks that the metadata is small enough to store.
+func (m TxnMetadata) validate() error {
+	data, err := bson.Marshal(m)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(data) > maxTxnMetadataBytes {
+		return errors.NotValidf("transaction metadata of %d bytes (limit %d)", len(data), maxTxnMetadataBytes)
+	}
+	return nil
+}
+
+// selector returns the conditions on a txn document that match the
+// non-empty fields of the metadata.
+func (m TxnMetadata) selector() bson.M {
+	selector := make(bson.M)
+	if m.Caller != "" {
+		selector["i.caller"] = m.Caller
+	}
+	if m.ModelUUID != "" {
+		selector["i.model-uuid"] = m.ModelUUID
+	}
+	if m.RequestId != "" {
+		selector["i.request-id"] = m.RequestId
+	}
+	return selector
+}
+
+// String returns the metadata in a form suitable for logging.
+func (m TxnMetadata) String() string {
+	return fmt.Sprintf("caller=%q model-uuid=%q request-id=%q", m.Caller, m.ModelUUID, m.RequestId)
+}
+
+// TxnMetadataForIds returns the metadata stored on the given transactions.
+// Entries in the change log use the transaction id as their _id, so this
+// can be used to find out who made the changes in a change log entry.
+// Transactions without metadata, or which have been pruned, are omitted
+// from the result.
+func TxnMetadataForIds(txns *mgo.Collection, ids []bson.ObjectId) (map[bson.ObjectId]TxnMetadata, error) {
+	result := make(map[bson.ObjectId]TxnMetadata)
+	iter := txns.Find(bson.M{"_id": bson.M{"$in": ids}, "i": bson.M{"$type": "object"}}).Select(bson.M{"i": 1}).Iter()
+	var doc struct {
+		Id       bson.ObjectId `bson:"_id"`
+		Metadata TxnMetadata   `bson:"i"`
+	}
+	for iter.Next(&doc) {
+		if !doc.Metadata.IsZero() {
+			result[doc.Id] = doc.Metadata
+		}
+		doc.Metadata = TxnMetadata{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return result, nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+const (
+	// defaultMetricsRetention is how long prune metrics are kept if
+	// MetricsExport.Retention isn't set.
+	defaultMetricsRetention = 30 * 24 * time.Hour
+
+	// PruneMetricRun and PruneMetricBatch are the kinds of PruneMetric.
+	PruneMetricRun   = "run"
+	PruneMetricBatch = "batch"
+)
+
+// MetricsExport configures CleanAndPrune to write a PruneMetric document
+// for each run, and optionally for each batch, to a collection, so that
+// pruning can be graphed (eg by Grafana, through a mongo exporter) without
+// adding a metrics endpoint to the process.
+//
+// The collection is created as a time-series collection if it doesn't
+// exist and the server supports them (MongoDB 5.0), and otherwise as a
+// regular collection with a TTL index on the time. Metrics that can't be
+// written are logged, and don't stop pruning.
+type MetricsExport struct {
+	// Collection is the name of the collection, in the same database as
+	// the transactions.
+	Collection string
+
+	// Retention is how long metrics are kept. Defaults to 30 days.
+	Retention time.Duration
+
+	// PerBatch, if true, writes a metric for each batch of transactions
+	// as well as for each run.
+	PerBatch bool
+}
+
+// Validate returns an error if the export can't be used.
+func (e MetricsExport) Validate() error {
+	if e.Collection == "" {
+		return errors.NotValidf("empty metrics Collection")
+	}
+	if e.Retention < 0 {
+		return errors.NotValidf("negative metrics Retention %s", e.Retention)
+	}
+	return nil
+}
+
+// PruneMetricMeta identifies the series a PruneMetric belongs to. It is
+// the metaField of a time-series metrics collection.
+type PruneMetricMeta struct {
+	// Txns is the name of the transactions collection.
+	Txns string `bson:"txns"`
+
+	// Kind is PruneMetricRun or PruneMetricBatch.
+	Kind string `bson:"kind"`
+
+	// Worker is "forward" or "reverse" for a batch, saying which of the
+	// pruners it was processed by.
+	Worker string `bson:"worker,omitempty"`
+}
+
+// PruneMetric is written by CleanAndPrune when MetricsExport is set.
+type PruneMetric struct {
+	// Time is when the run or batch finished.
+	Time time.Time       `bson:"time"`
+	Meta PruneMetricMeta `bson:"meta"`
+
+	// Seconds is how long the run or batch took.
+	Seconds float64 `bson:"seconds"`
+
+	// TxnsRemoved and DocsCleaned count the work done. For a batch,
+	// TxnsRemoved is the number of transactions queued for removal.
+	TxnsRemoved int `bson:"txns-removed"`
+	DocsCleaned int `bson:"docs-cleaned"`
+
+	// Batch is the number of the batch, and TxnsRead the number of
+	// transactions it read. They are only set for batches.
+	Batch    int `bson:"batch,omitempty"`
+	TxnsRead int `bson:"txns-read,omitempty"`
+
+	// The rest are only set for runs.
+	Passes           int   `bson:"passes,omitempty"`
+	StashDocsRemoved int   `bson:"stash-docs-removed,omitempty"`
+	PeakHeapBytes    int64 `bson:"peak-heap-bytes,omitempty"`
+	Failed           bool  `bson:"failed,omitempty"`
+}
+
+// runMetric returns the metric of a CleanAndPrune of txnsName.
+func runMetric(txnsName string, stats CleanupStats, elapsed time.Duration, err error) PruneMetric {
+	return PruneMetric{
+		Time:             time.Now().UTC(),
+		Meta:             PruneMetricMeta{Txns: txnsName, Kind: PruneMetricRun},
+		Seconds:          elapsed.Seconds(),
+		TxnsRemoved:      stats.TransactionsRemoved,
+		DocsCleaned:      stats.DocsCleaned,
+		Passes:           stats.Passes,
+		StashDocsRemoved: stats.StashDocumentsRemoved,
+		PeakHeapBytes:    stats.Pruner.PeakHeapBytes,
+		Failed:           err != nil,
+	}
+}
+
+// metricsWriter writes PruneMetrics. Its methods may be called on a nil
+// writer, which writes nothing.
+type metricsWriter struct {
+	coll     *mgo.Collection
+	txnsName string
+	perBatch bool
+}
+
+// startMetrics prepares the collection configured by export, in the
+// database of txns. If it can't, a warning is logged and nil is returned,
+// so that pruning carries on without metrics.
+func startMetrics(txns *mgo.Collection, export *MetricsExport) *metricsWriter {
+	if export == nil {
+		return nil
+	}
+	retention := export.Retention
+	if retention == 0 {
+		retention = defaultMetricsRetention
+	}
+	if err := ensureMetricsCollection(txns.Database, export.Collection, retention); err != nil {
+		pruneLogger.Warningf("not writing prune metrics: %v", err)
+		return nil
+	}
+	return &metricsWriter{
+		coll:     txns.Database.C(export.Collection),
+		txnsName: txns.Name,
+		perBatch: export.PerBatch,
+	}
+}
+
+// ensureMetricsCollection creates the metrics collection name, or updates
+// the retention of an existing one.
+func ensureMetricsCollection(db *mgo.Database, name string, retention time.Duration) error {
+	iter, err := listCollections(db, bson.M{"name": name})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var info collectionInfo
+	exists := iter.Next(&info)
+	if err := iter.Close(); err != nil {
+		return errors.Annotatef(err, "looking for metrics collection %q", name)
+	}
+	expireAfter := int64(retention / time.Second)
+	switch {
+	case !exists && capabilitiesFor(db).TimeSeries:
+		err = db.Run(bson.D{
+			{"create", name},
+			{"timeseries", bson.D{
+				{"timeField", "time"},
+				{"metaField", "meta"},
+				{"granularity", "minutes"},
+			}},
+			{"expireAfterSeconds", expireAfter},
+		}, nil)
+		return errors.Annotatef(err, "creating time-series collection %q", name)
+	case info.Type == "timeseries":
+		err = db.Run(bson.D{{"collMod", name}, {"expireAfterSeconds", expireAfter}}, nil)
+		return errors.Annotatef(err, "setting retention of %q", name)
+	}
+	err = db.C(name).EnsureIndex(mgo.Index{
+		Key:         []string{"time"},
+		ExpireAfter: retention,
+	})
+	return errors.Annotatef(err, "adding TTL index to %q", name)
+}
+
+// batch writes the metric of a batch, if per-batch metrics are wanted.
+func (m *metricsWriter) batch(worker string, metric PruneMetric) {
+	if m == nil || !m.perBatch {
+		return
+	}
+	metric.Meta = PruneMetricMeta{Txns: m.txnsName, Kind: PruneMetricBatch, Worker: worker}
+	m.write(metric)
+}
+
+// run writes the metric of a run.
+func (m *metricsWriter) run(stats CleanupStats, elapsed time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.write(runMetric(m.txnsName, stats, elapsed, err))
+}
+
+func (m *metricsWriter) write(metric PruneMetric) {
+	if err := m.coll.Insert(metric); err != nil {
+		pruneLogger.Warningf("unable to write prune metric: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type MetricsExportSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&MetricsExportSuite{})
+
+func (s *MetricsExportSuite) makeTxns(c *gc.C, count int) {
+	for i := 0; i < count; i++ {
+		s.runTxn(c, txn.Op{C: "coll", Id: i, Insert: bson.M{}})
+	}
+}
+
+func (s *MetricsExportSuite) TestCleanAndPruneWritesMetrics(c *gc.C) {
+	s.makeTxns(c, 25)
+
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:         s.txns,
+		TxnBatchSize: 10,
+		Metrics: &jujutxn.MetricsExport{
+			Collection: "txns.metrics",
+			Retention:  time.Hour,
+			PerBatch:   true,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	var runs []jujutxn.PruneMetric
+	err = s.db.C("txns.metrics").Find(bson.M{"meta.kind": jujutxn.PruneMetricRun}).All(&runs)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(runs, gc.HasLen, 1)
+	c.Check(runs[0].Meta, gc.Equals, jujutxn.PruneMetricMeta{Txns: "txns", Kind: jujutxn.PruneMetricRun})
+	c.Check(runs[0].TxnsRemoved, gc.Equals, stats.TransactionsRemoved)
+	c.Check(runs[0].Passes, gc.Equals, 1)
+	c.Check(runs[0].Failed, jc.IsFalse)
+
+	var batches []jujutxn.PruneMetric
+	err = s.db.C("txns.metrics").Find(bson.M{"meta.kind": jujutxn.PruneMetricBatch}).Sort("batch").All(&batches)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(batches, gc.HasLen, 3)
+	read := 0
+	for i, batch := range batches {
+		c.Check(batch.Batch, gc.Equals, i+1)
+		c.Check(batch.Meta.Worker, gc.Equals, "forward")
+		read += batch.TxnsRead
+	}
+	c.Check(read, gc.Equals, 25)
+}
+
+func (s *MetricsExportSuite) TestRetention(c *gc.C) {
+	s.makeTxns(c, 1)
+	caps, err := jujutxn.DetectServerCapabilities(s.db.Session)
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:    s.txns,
+		Metrics: &jujutxn.MetricsExport{Collection: "txns.metrics", Retention: time.Hour},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	if caps.TimeSeries {
+		var result struct {
+			Cursor struct {
+				FirstBatch []struct {
+					Type    string `bson:"type"`
+					Options struct {
+						ExpireAfterSeconds int64 `bson:"expireAfterSeconds"`
+					} `bson:"options"`
+				} `bson:"firstBatch"`
+			} `bson:"cursor"`
+		}
+		err := s.db.Run(bson.D{{"listCollections", 1}, {"filter", bson.M{"name": "txns.metrics"}}}, &result)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(result.Cursor.FirstBatch, gc.HasLen, 1)
+		c.Check(result.Cursor.FirstBatch[0].Type, gc.Equals, "timeseries")
+		c.Check(result.Cursor.FirstBatch[0].Options.ExpireAfterSeconds, gc.Equals, int64(3600))
+		return
+	}
+	indexes, err := s.db.C("txns.metrics").Indexes()
+	c.Assert(err, jc.ErrorIsNil)
+	found := false
+	for _, index := range indexes {
+		if len(index.Key) == 1 && index.Key[0] == "time" {
+			found = true
+			c.Check(index.ExpireAfter, gc.Equals, time.Hour)
+		}
+	}
+	c.Check(found, jc.IsTrue)
+}
+
+func (s *MetricsExportSuite) TestInvalidExport(c *gc.C) {
+	_, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:    s.txns,
+		Metrics: &jujutxn.MetricsExport{},
+	})
+	c.Check(err, gc.ErrorMatches, "empty metrics Collection not valid")
+}
+
+type MetricsExportValidateSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&MetricsExportValidateSuite{})
+
+func (*MetricsExportValidateSuite) TestValidate(c *gc.C) {
+	c.Check(jujutxn.MetricsExport{Collection: "txns.metrics"}.Validate(), jc.ErrorIsNil)
+	c.Check(jujutxn.MetricsExport{}.Validate(), gc.ErrorMatches, "empty metrics Collection not valid")
+	err := jujutxn.MetricsExport{Collection: "txns.metrics", Retention: -time.Hour}.Validate()
+	c.Check(err, gc.ErrorMatches, "negative metrics Retention -1h0m0s not valid")
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
@@ -0,0 +1,93 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package mocks_test
+
+import (
+	"errors"
+	stdtesting "testing"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+	"github.com/juju/txn/v3/mocks"
+)
+
+func Test(t *stdtesting.T) {
+	gc.TestingT(t)
+}
+
+type MocksSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&MocksSuite{})
+
+func (*MocksSuite) TestRunner(c *gc.C) {
+	runner := mocks.NewRunner()
+	runner.SetErrors(nil, jujutxn.ErrExcessiveContention)
+	ops := []txn.Op{{C: "coll", Id: "0", Insert: bson.M{}}}
+	source := func(attempt int) ([]txn.Op, error) {
+		c.Check(attempt, gc.Equals, 0)
+		return ops, nil
+	}
+
+	err := runner.Run(source)
+	c.Assert(err, jc.ErrorIsNil)
+	err = runner.Run(source)
+	c.Assert(err, gc.Equals, jujutxn.ErrExcessiveContention)
+	err = runner.Run(func(int) ([]txn.Op, error) {
+		return nil, jujutxn.ErrNoOperations
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	runner.CheckCallNames(c, "Run", "Run", "Run")
+	c.Check(runner.Ops(), jc.DeepEquals, [][]txn.Op{ops, ops, nil})
+}
+
+func (*MocksSuite) TestRemover(c *gc.C) {
+	remover := mocks.NewRemover()
+	remover.SetErrors(nil, nil, errors.New("boom"))
+	c.Assert(remover.Remove("0"), jc.ErrorIsNil)
+	c.Assert(remover.Remove("1"), jc.ErrorIsNil)
+	c.Assert(remover.Flush(), gc.ErrorMatches, "boom")
+	c.Check(remover.Removed(), gc.Equals, 0)
+	c.Assert(remover.Flush(), jc.ErrorIsNil)
+	c.Check(remover.Removed(), gc.Equals, 2)
+
+	c.Assert(remover.Remove("2"), jc.ErrorIsNil)
+	remover.Abort()
+	c.Assert(remover.Flush(), jc.ErrorIsNil)
+	c.Check(remover.Removed(), gc.Equals, 2)
+}
+
+func (*MocksSuite) TestOracle(c *gc.C) {
+	ids := []bson.ObjectId{bson.NewObjectId(), bson.NewObjectId()}
+	oracle := mocks.NewOracle(ids...)
+	completed, err := oracle.CompletedTokens([]string{ids[0].Hex() + "_12345678", "bad"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(completed, jc.DeepEquals, map[string]bool{ids[0].Hex() + "_12345678": true})
+
+	removed, err := oracle.RemoveTxns(ids[:1])
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(removed, gc.Equals, 1)
+	iter, err := oracle.IterTxns()
+	c.Assert(err, jc.ErrorIsNil)
+	id, err := iter.Next()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(id, gc.Equals, ids[1])
+	_, err = iter.Next()
+	c.Check(err, gc.Equals, jujutxn.EOF)
+}
+
+func (*MocksSuite) TestLoadMonitor(c *gc.C) {
+	monitor := mocks.NewLoadMonitor(0.5, 1.2)
+	for _, expect := range []float64{0.5, 1.2, 1.2} {
+		load, err := monitor.Load()
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(load, gc.Equals, expect)
+	}
+}
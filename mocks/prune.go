@@ -0,0 +1,226 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package mocks
+
+import (
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/testing"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+// Pruner is a jujutxn.Pruner.
+type Pruner struct {
+	*testing.Stub
+
+	// PrunerStats is returned by Prune.
+	PrunerStats jujutxn.PrunerStats
+
+	// CollectionPruneStats is returned by CollectionStats.
+	CollectionPruneStats []jujutxn.CollectionPruneStats
+
+	// Limited is returned by LimitReached.
+	Limited bool
+}
+
+var _ jujutxn.Pruner = (*Pruner)(nil)
+
+// NewPruner returns a Pruner with a new Stub.
+func NewPruner() *Pruner {
+	return &Pruner{Stub: &testing.Stub{}}
+}
+
+// Prune is defined on jujutxn.Pruner.
+func (p *Pruner) Prune(txns *mgo.Collection) (jujutxn.PrunerStats, error) {
+	p.MethodCall(p, "Prune", txns)
+	return p.PrunerStats, p.NextErr()
+}
+
+// CollectionStats is defined on jujutxn.Pruner.
+func (p *Pruner) CollectionStats() []jujutxn.CollectionPruneStats {
+	p.MethodCall(p, "CollectionStats")
+	return p.CollectionPruneStats
+}
+
+// LimitReached is defined on jujutxn.Pruner.
+func (p *Pruner) LimitReached() bool {
+	p.MethodCall(p, "LimitReached")
+	return p.Limited
+}
+
+// Remover is a jujutxn.Remover. It counts the documents passed to Remove
+// as removed when Flush succeeds, unless they are discarded by Abort.
+type Remover struct {
+	*testing.Stub
+
+	queued  int
+	removed int
+}
+
+var _ jujutxn.Remover = (*Remover)(nil)
+
+// NewRemover returns a Remover with a new Stub.
+func NewRemover() *Remover {
+	return &Remover{Stub: &testing.Stub{}}
+}
+
+// Remove is defined on jujutxn.Remover.
+func (r *Remover) Remove(id interface{}) error {
+	r.MethodCall(r, "Remove", id)
+	if err := r.NextErr(); err != nil {
+		return err
+	}
+	r.queued++
+	return nil
+}
+
+// Flush is defined on jujutxn.Remover.
+func (r *Remover) Flush() error {
+	r.MethodCall(r, "Flush")
+	if err := r.NextErr(); err != nil {
+		return err
+	}
+	r.removed += r.queued
+	r.queued = 0
+	return nil
+}
+
+// Abort is defined on jujutxn.Remover.
+func (r *Remover) Abort() {
+	r.MethodCall(r, "Abort")
+	r.queued = 0
+}
+
+// Removed is defined on jujutxn.Remover.
+func (r *Remover) Removed() int {
+	r.MethodCall(r, "Removed")
+	return r.removed
+}
+
+// LoadMonitor is a jujutxn.LoadMonitor.
+type LoadMonitor struct {
+	*testing.Stub
+
+	// Loads are returned by successive calls to Load. Once they are used
+	// up, the last one is returned, or 0 if there are none.
+	Loads []float64
+}
+
+var _ jujutxn.LoadMonitor = (*LoadMonitor)(nil)
+
+// NewLoadMonitor returns a LoadMonitor with a new Stub that reports the
+// given loads.
+func NewLoadMonitor(loads ...float64) *LoadMonitor {
+	return &LoadMonitor{Stub: &testing.Stub{}, Loads: loads}
+}
+
+// Load is defined on jujutxn.LoadMonitor.
+func (m *LoadMonitor) Load() (float64, error) {
+	m.MethodCall(m, "Load")
+	var load float64
+	if len(m.Loads) > 0 {
+		load = m.Loads[0]
+		if len(m.Loads) > 1 {
+			m.Loads = m.Loads[1:]
+		}
+	}
+	return load, m.NextErr()
+}
+
+// Oracle is a jujutxn.Oracle over a fixed set of transactions, all of
+// which are completed.
+type Oracle struct {
+	*testing.Stub
+
+	// Txns are the transactions the oracle knows about.
+	Txns []bson.ObjectId
+}
+
+var _ jujutxn.Oracle = (*Oracle)(nil)
+
+// NewOracle returns an Oracle with a new Stub for the given transactions.
+func NewOracle(txns ...bson.ObjectId) *Oracle {
+	return &Oracle{Stub: &testing.Stub{}, Txns: txns}
+}
+
+// Count is defined on jujutxn.Oracle.
+func (o *Oracle) Count() int {
+	o.MethodCall(o, "Count")
+	return len(o.Txns)
+}
+
+// CompletedTokens is defined on jujutxn.Oracle. A token is completed if
+// its transaction is one of Txns.
+func (o *Oracle) CompletedTokens(tokens []string) (map[string]bool, error) {
+	o.MethodCall(o, "CompletedTokens", tokens)
+	if err := o.NextErr(); err != nil {
+		return nil, err
+	}
+	completed := make(map[string]bool)
+	for _, token := range tokens {
+		if len(token) < 24 || !bson.IsObjectIdHex(token[:24]) {
+			continue
+		}
+		id := bson.ObjectIdHex(token[:24])
+		for _, txnId := range o.Txns {
+			if txnId == id {
+				completed[token] = true
+				break
+			}
+		}
+	}
+	return completed, nil
+}
+
+// RemoveTxns is defined on jujutxn.Oracle.
+func (o *Oracle) RemoveTxns(txnIds []bson.ObjectId) (int, error) {
+	o.MethodCall(o, "RemoveTxns", txnIds)
+	if err := o.NextErr(); err != nil {
+		return 0, err
+	}
+	removed := 0
+	kept := o.Txns[:0]
+	for _, txnId := range o.Txns {
+		found := false
+		for _, id := range txnIds {
+			if id == txnId {
+				found = true
+				break
+			}
+		}
+		if found {
+			removed++
+		} else {
+			kept = append(kept, txnId)
+		}
+	}
+	o.Txns = kept
+	return removed, nil
+}
+
+// IterTxns is defined on jujutxn.Oracle.
+func (o *Oracle) IterTxns() (jujutxn.OracleIterator, error) {
+	o.MethodCall(o, "IterTxns")
+	if err := o.NextErr(); err != nil {
+		return nil, err
+	}
+	txns := make([]bson.ObjectId, len(o.Txns))
+	copy(txns, o.Txns)
+	return &oracleIterator{txns: txns}, nil
+}
+
+type oracleIterator struct {
+	txns []bson.ObjectId
+}
+
+// Next is defined on jujutxn.OracleIterator.
+func (i *oracleIterator) Next() (bson.ObjectId, error) {
+	if len(i.txns) == 0 {
+		return "", jujutxn.EOF
+	}
+	id := i.txns[0]
+	i.txns = i.txns[1:]
+	return id, nil
+}
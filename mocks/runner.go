@@ -0,0 +1,157 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package mocks provides test doubles for the interfaces of the txn
+// package, so that code depending on it can be tested without a database
+// or shims of its own.
+//
+// Each double embeds a *testing.Stub, which records the calls made to it
+// and supplies the errors they return (see Stub.SetErrors). Other results
+// are taken from the double's exported fields.
+package mocks
+
+import (
+	"context"
+
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+// Runner is a jujutxn.Runner, which also implements ResumingRunner,
+// StatsRunner and ReadOnlyRunner. Run calls the transaction source once,
+// with attempt 0, and records the operations it returns.
+type Runner struct {
+	*testing.Stub
+
+	// ResumeStats is returned by ResumeTransactionsWithOptions.
+	ResumeStats jujutxn.ResumeStats
+
+	// RunnerStats is returned by Stats.
+	RunnerStats jujutxn.RunnerStats
+
+	// IsReadOnly is returned by ReadOnly, and set by SetReadOnly and
+	// Quiesce.
+	IsReadOnly bool
+
+	// QuiesceReport is returned by Quiesce.
+	QuiesceReport jujutxn.QuiesceReport
+}
+
+var (
+	_ jujutxn.Runner         = (*Runner)(nil)
+	_ jujutxn.ResumingRunner = (*Runner)(nil)
+	_ jujutxn.StatsRunner    = (*Runner)(nil)
+	_ jujutxn.ReadOnlyRunner = (*Runner)(nil)
+)
+
+// NewRunner returns a Runner with a new Stub.
+func NewRunner() *Runner {
+	return &Runner{Stub: &testing.Stub{}}
+}
+
+// RunTransaction is defined on jujutxn.Runner.
+func (r *Runner) RunTransaction(transaction *jujutxn.Transaction) error {
+	r.MethodCall(r, "RunTransaction", transaction)
+	return r.NextErr()
+}
+
+// Run is defined on jujutxn.Runner.
+func (r *Runner) Run(transactions jujutxn.TransactionSource) error {
+	ops, err := transactions(0)
+	if err == jujutxn.ErrNoOperations {
+		ops, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	r.MethodCall(r, "Run", ops)
+	return r.NextErr()
+}
+
+// ResumeTransactions is defined on jujutxn.Runner.
+func (r *Runner) ResumeTransactions() error {
+	r.MethodCall(r, "ResumeTransactions")
+	return r.NextErr()
+}
+
+// ResumeTransactionsWithOptions is defined on jujutxn.ResumingRunner.
+func (r *Runner) ResumeTransactionsWithOptions(opts jujutxn.ResumeOptions) (jujutxn.ResumeStats, error) {
+	r.MethodCall(r, "ResumeTransactionsWithOptions", opts)
+	return r.ResumeStats, r.NextErr()
+}
+
+// MaybePruneTransactions is defined on jujutxn.Runner.
+func (r *Runner) MaybePruneTransactions(opts jujutxn.PruneOptions) error {
+	r.MethodCall(r, "MaybePruneTransactions", opts)
+	return r.NextErr()
+}
+
+// Stats is defined on jujutxn.StatsRunner.
+func (r *Runner) Stats() jujutxn.RunnerStats {
+	r.MethodCall(r, "Stats")
+	return r.RunnerStats
+}
+
+// SetReadOnly is defined on jujutxn.ReadOnlyRunner. It only records the
+// call and sets IsReadOnly; Run and RunTransaction are not affected.
+func (r *Runner) SetReadOnly(readOnly bool) {
+	r.MethodCall(r, "SetReadOnly", readOnly)
+	r.IsReadOnly = readOnly
+}
+
+// ReadOnly is defined on jujutxn.ReadOnlyRunner.
+func (r *Runner) ReadOnly() bool {
+	r.MethodCall(r, "ReadOnly")
+	return r.IsReadOnly
+}
+
+// WaitIdle is defined on jujutxn.ReadOnlyRunner.
+func (r *Runner) WaitIdle(ctx context.Context) error {
+	r.MethodCall(r, "WaitIdle", ctx)
+	return r.NextErr()
+}
+
+// Quiesce is defined on jujutxn.ReadOnlyRunner. It sets IsReadOnly unless
+// it returns an error.
+func (r *Runner) Quiesce(ctx context.Context) (jujutxn.QuiesceReport, error) {
+	r.MethodCall(r, "Quiesce", ctx)
+	if err := r.NextErr(); err != nil {
+		return r.QuiesceReport, err
+	}
+	r.IsReadOnly = true
+	return r.QuiesceReport, nil
+}
+
+// Ops returns the operations recorded by each call to Run.
+func (r *Runner) Ops() [][]txn.Op {
+	var ops [][]txn.Op
+	for _, call := range r.Calls() {
+		if call.FuncName == "Run" {
+			ops = append(ops, call.Args[0].([]txn.Op))
+		}
+	}
+	return ops
+}
+
+// ContentionAdvisor is a jujutxn.ContentionAdvisor.
+type ContentionAdvisor struct {
+	*testing.Stub
+
+	// Advice is returned by Advise.
+	Advice jujutxn.ContentionAdvice
+}
+
+var _ jujutxn.ContentionAdvisor = (*ContentionAdvisor)(nil)
+
+// NewContentionAdvisor returns a ContentionAdvisor with a new Stub.
+func NewContentionAdvisor() *ContentionAdvisor {
+	return &ContentionAdvisor{Stub: &testing.Stub{}}
+}
+
+// Advise is defined on jujutxn.ContentionAdvisor.
+func (a *ContentionAdvisor) Advise(contention jujutxn.Contention) jujutxn.ContentionAdvice {
+	a.MethodCall(a, "Advise", contention)
+	return a.Advice
+}
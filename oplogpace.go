@@ -0,0 +1,161 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// OplogPacing limits how fast pruning writes to the oplog. The oplog is
+// capped, so every entry written by pruning pushes the oldest entries out,
+// shortening the window of time it covers. A delayed or slow secondary
+// that falls further behind than the window can't catch up, and has to be
+// resynced.
+//
+// The oplog written per transaction pruned is estimated, and pruners
+// sleep between batches so that pruning writes at most
+// MaxWindowFractionPerHour of the oplog's size each hour.
+type OplogPacing struct {
+	// MaxWindowFractionPerHour is the most of the oplog window pruning
+	// may consume each hour, greater than 0 and at most 1. For example,
+	// 0.1 lets pruning shorten a 24h window by at most 2.4h each hour.
+	MaxWindowFractionPerHour float64
+
+	// BytesPerTxn is the estimate of the oplog written for each
+	// transaction pruned. Defaults to 1KiB.
+	BytesPerTxn int64
+}
+
+// Validate returns an error if the pacing can't be used.
+func (p OplogPacing) Validate() error {
+	if p.MaxWindowFractionPerHour <= 0 || p.MaxWindowFractionPerHour > 1 {
+		return errors.NotValidf("MaxWindowFractionPerHour %v outside (0, 1]", p.MaxWindowFractionPerHour)
+	}
+	if p.BytesPerTxn < 0 {
+		return errors.NotValidf("negative BytesPerTxn %d", p.BytesPerTxn)
+	}
+	return nil
+}
+
+// oplogStats describes the oplog of a replica set member.
+type oplogStats struct {
+	// MaxSize is the size the oplog is capped at, and Size how much of
+	// it is used, in bytes.
+	MaxSize int64 `bson:"maxSize"`
+	Size    int64 `bson:"size"`
+
+	// Window is the time between the oldest and newest entries.
+	Window time.Duration `bson:"-"`
+}
+
+// readOplogStats reads the size and window of the oplog of the member
+// session is connected to. It fails if the member has no oplog.
+func readOplogStats(session *mgo.Session) (oplogStats, error) {
+	local := session.DB("local")
+	var stats oplogStats
+	if err := local.Run(bson.D{{"collStats", "oplog.rs"}}, &stats); err != nil {
+		return oplogStats{}, errors.Annotate(err, "reading oplog stats")
+	}
+	var first, last struct {
+		Ts bson.MongoTimestamp `bson:"ts"`
+	}
+	oplog := local.C("oplog.rs")
+	if err := oplog.Find(nil).Sort("$natural").Select(bson.M{"ts": 1}).One(&first); err != nil {
+		return oplogStats{}, errors.Annotate(err, "reading oldest oplog entry")
+	}
+	if err := oplog.Find(nil).Sort("-$natural").Select(bson.M{"ts": 1}).One(&last); err != nil {
+		return oplogStats{}, errors.Annotate(err, "reading newest oplog entry")
+	}
+	// The high 32 bits of a timestamp are seconds since the epoch.
+	stats.Window = time.Duration(int64(last.Ts>>32)-int64(first.Ts>>32)) * time.Second
+	return stats, nil
+}
+
+// OplogPacer paces the pruners that share it to an OplogPacing.
+type OplogPacer struct {
+	bytesPerTxn  int64
+	bytesPerHour float64
+
+	mu      sync.Mutex
+	start   time.Time
+	removed int64
+}
+
+// NewOplogPacer reads the oplog of the member session is connected to, and
+// returns an OplogPacer that keeps pruning within pacing of it.
+func NewOplogPacer(session *mgo.Session, pacing OplogPacing) (*OplogPacer, error) {
+	if err := pacing.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	stats, err := readOplogStats(session)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	pacer := newOplogPacer(stats, pacing, time.Now())
+	pruneLogger.Infof("oplog is %dMiB covering %s, pruning at most %d txns per hour",
+		stats.MaxSize>>20, stats.Window, pacer.TxnsPerHour())
+	return pacer, nil
+}
+
+func newOplogPacer(stats oplogStats, pacing OplogPacing, start time.Time) *OplogPacer {
+	bytesPerTxn := pacing.BytesPerTxn
+	if bytesPerTxn == 0 {
+		bytesPerTxn = pruneDiskBytesPerTxn
+	}
+	maxSize := stats.MaxSize
+	if maxSize == 0 {
+		// Older servers only report the size of a full oplog.
+		maxSize = stats.Size
+	}
+	return &OplogPacer{
+		bytesPerTxn:  bytesPerTxn,
+		bytesPerHour: pacing.MaxWindowFractionPerHour * float64(maxSize),
+		start:        start,
+	}
+}
+
+// TxnsPerHour returns how many transactions may be pruned each hour.
+func (p *OplogPacer) TxnsPerHour() int64 {
+	return int64(p.bytesPerHour / float64(p.bytesPerTxn))
+}
+
+// add counts txns transactions as about to be removed.
+func (p *OplogPacer) add(txns int) {
+	p.mu.Lock()
+	p.removed += int64(txns)
+	p.mu.Unlock()
+}
+
+// delay returns how long to wait, at now, for the transactions removed so
+// far to be within the pace.
+func (p *OplogPacer) delay(now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.bytesPerHour <= 0 {
+		return 0
+	}
+	hours := float64(p.removed*p.bytesPerTxn) / p.bytesPerHour
+	due := p.start.Add(time.Duration(hours * float64(time.Hour)))
+	return due.Sub(now)
+}
+
+// waitForOplog sleeps between batches until the transactions removed so
+// far are within the oplog pace.
+func (p *IncrementalPruner) waitForOplog() {
+	if p.oplogPacer == nil {
+		return
+	}
+	delay := p.oplogPacer.delay(time.Now())
+	if delay <= 0 {
+		return
+	}
+	defer checkTime(&p.stats.OplogSleepTime)()
+	pruneLogger.Debugf("pruning ahead of the oplog pace, sleeping for %s", delay)
+	time.Sleep(delay)
+}
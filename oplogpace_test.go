@@ -0,0 +1,102 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type OplogPacingSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&OplogPacingSuite{})
+
+func (*OplogPacingSuite) TestValidate(c *gc.C) {
+	c.Check(OplogPacing{MaxWindowFractionPerHour: 1}.Validate(), jc.ErrorIsNil)
+	err := OplogPacing{}.Validate()
+	c.Check(err, gc.ErrorMatches, `MaxWindowFractionPerHour 0 outside \(0, 1\] not valid`)
+	err = OplogPacing{MaxWindowFractionPerHour: 0.5, BytesPerTxn: -1}.Validate()
+	c.Check(err, gc.ErrorMatches, "negative BytesPerTxn -1 not valid")
+}
+
+func (*OplogPacingSuite) TestTxnsPerHour(c *gc.C) {
+	stats := oplogStats{MaxSize: 1 << 30}
+	pacer := newOplogPacer(stats, OplogPacing{MaxWindowFractionPerHour: 0.1}, time.Now())
+	// A tenth of 1GiB of 1KiB transactions.
+	c.Check(pacer.TxnsPerHour(), gc.Equals, int64(104857))
+
+	// Without maxSize, the size of the full oplog is used.
+	stats = oplogStats{Size: 1 << 20}
+	pacer = newOplogPacer(stats, OplogPacing{MaxWindowFractionPerHour: 1, BytesPerTxn: 256}, time.Now())
+	c.Check(pacer.TxnsPerHour(), gc.Equals, int64(4096))
+}
+
+func (*OplogPacingSuite) TestDelay(c *gc.C) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	stats := oplogStats{MaxSize: 3600}
+	pacer := newOplogPacer(stats, OplogPacing{MaxWindowFractionPerHour: 0.5, BytesPerTxn: 1}, start)
+	// 1800 txns may be pruned per hour, or one every 2s.
+	c.Check(pacer.delay(start), gc.Equals, time.Duration(0))
+	pacer.add(10)
+	c.Check(pacer.delay(start), gc.Equals, 20*time.Second)
+	c.Check(pacer.delay(start.Add(5*time.Second)), gc.Equals, 15*time.Second)
+	pacer.add(5)
+	c.Check(pacer.delay(start.Add(time.Minute)), gc.Equals, -30*time.Second)
+}
+
+func (*OplogPacingSuite) TestNoOplogSize(c *gc.C) {
+	pacer := newOplogPacer(oplogStats{}, OplogPacing{MaxWindowFractionPerHour: 1}, time.Now())
+	pacer.add(100)
+	c.Check(pacer.delay(time.Now()), gc.Equals, time.Duration(0))
+}
+
+type OplogPacerSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&OplogPacerSuite{})
+
+func (s *OplogPacerSuite) makeTxns(c *gc.C, count int) {
+	for i := 0; i < count; i++ {
+		s.runTxn(c, txn.Op{
+			C:      "docs",
+			Id:     i,
+			Insert: bson.M{},
+		})
+	}
+}
+
+func (s *OplogPacerSuite) TestPrunePaced(c *gc.C) {
+	s.makeTxns(c, 25)
+	// 1000 txns may be pruned per second.
+	stats := oplogStats{MaxSize: 3600000}
+	pacer := newOplogPacer(stats, OplogPacing{MaxWindowFractionPerHour: 1, BytesPerTxn: 1}, time.Now())
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{
+		TxnBatchSize: 10,
+		OplogPacer:   pacer,
+	})
+	start := time.Now()
+	pstats, err := pruner.Prune(s.txns)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(pstats.TxnsRemoved, gc.Equals, int64(25))
+	// The second batch waits for the first to be within the pace.
+	c.Check(pstats.OplogSleepTime > 0, jc.IsTrue)
+	c.Check(time.Since(start) >= 20*time.Millisecond, jc.IsTrue)
+}
+
+func (s *OplogPacerSuite) TestReadOplogStats(c *gc.C) {
+	stats, err := readOplogStats(s.db.Session)
+	if err != nil {
+		c.Skip("server has no oplog: " + err.Error())
+	}
+	c.Check(stats.MaxSize > 0, jc.IsTrue)
+	c.Check(stats.Window >= 0, jc.IsTrue)
+}
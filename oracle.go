@@ -47,23 +47,12 @@ type Oracle interface {
 	IterTxns() (OracleIterator, error)
 }
 
-// checkMongoSupportsOut verifies that Mongo supports "$out" in an aggregation
-// pipeline. This was introduced in Mongo 2.6
-// https://docs.mongodb.com/manual/reference/operator/aggregation/out/
+// checkMongoSupportsOut verifies that the server supports "$out" in an
+// aggregation pipeline. See ServerCapabilities.AggregateOut.
 func checkMongoSupportsOut(db *mgo.Database) bool {
-	var dbInfo struct {
-		VersionArray []int `bson:"versionArray"`
-	}
-	if err := db.Run(bson.M{"buildInfo": 1}, &dbInfo); err != nil {
-		return false
-	}
-	logger.Debugf("buildInfo reported: %v", dbInfo.VersionArray)
-	if len(dbInfo.VersionArray) < 2 {
-		return false
-	}
-	// Check if we are at least 2.6
-	v := dbInfo.VersionArray
-	return v[0] > 2 || (v[0] == 2 && v[1] >= 6)
+	caps := capabilitiesFor(db)
+	pruneLogger.Debugf("%s %v supports $out: %v", caps.Flavour, caps.Version, caps.AggregateOut)
+	return caps.AggregateOut
 }
 
 // completedOldTransactionMatch creates a search parameter for transactions
@@ -72,7 +61,7 @@ func checkMongoSupportsOut(db *mgo.Database) bool {
 // The returned object is suitable for being passed to a $match or a Find() operation.
 func completedOldTransactionMatch(timestamp time.Time) bson.M {
 	// This used to use $in but that's much slower than $gte.
-	match := bson.M{"s": bson.M{"$gte": taborted}}
+	match := bson.M{"s": bson.M{"$gte": TxnAborted}}
 	if !timestamp.IsZero() {
 		match["_id"] = bson.M{"$lt": bson.NewObjectIdWithTime(timestamp)}
 	}
@@ -120,7 +109,7 @@ type DBOracle struct {
 // efficient that a $out in the pipeline, but must be used when Mongo doesn't
 // support pipelines.
 func (o *DBOracle) prepareWorkingDirectly() error {
-	logger.Debugf("iterating the transactions collection to build the working set: %q", o.working.Name)
+	pruneLogger.Debugf("iterating the transactions collection to build the working set: %q", o.working.Name)
 	// Make sure the working set is clean
 	o.working.DropCollection()
 	query := o.txns.Find(completedOldTransactionMatch(o.thresholdTime))
@@ -161,7 +150,7 @@ func (o *DBOracle) prepareWorkingDirectly() error {
 			}
 		}
 		if t.isAfter() {
-			logger.Debugf("copied %d documents", docCount)
+			pruneLogger.Debugf("copied %d documents", docCount)
 		}
 	}
 	if err := flush(); err != nil {
@@ -173,7 +162,7 @@ func (o *DBOracle) prepareWorkingDirectly() error {
 // prepareWorkingWithPipeline adds a $out stage to the pipeline, and has mongo
 // populate the working set. This is the preferred method if Mongo supports $out.
 func (o *DBOracle) prepareWorkingWithPipeline() error {
-	logger.Debugf("searching for transactions older than %s", o.thresholdTime)
+	pruneLogger.Debugf("searching for transactions older than %s", o.thresholdTime)
 	pipeline := []bson.M{
 		{"$match": completedOldTransactionMatch(o.thresholdTime)},
 		{"$project": bson.M{"_id": 1}},
@@ -197,7 +186,7 @@ func (o *DBOracle) prepare() (func(), error) {
 
 	// Load the ids of all completed and aborted txns into a separate
 	// temporary collection.
-	logger.Debugf("loading all completed transactions")
+	pruneLogger.Debugf("loading all completed transactions")
 	var err error
 	if o.usingMongoOut {
 		err = o.prepareWorkingWithPipeline()
@@ -225,7 +214,7 @@ func (o *DBOracle) cleanup() {
 		err := o.working.DropCollection()
 		o.working = nil
 		if err != nil {
-			logger.Warningf("cleanup of %q failed: %v", name, err)
+			pruneLogger.Warningf("cleanup of %q failed: %v", name, err)
 		}
 	}
 }
@@ -240,8 +229,11 @@ func (o *DBOracle) CompletedTokens(tokens []string) (map[string]bool, error) {
 	// nonces can also be considered 'completed'. (afaict, they are ignored,
 	// thus won't be applied and can be considered completed.)
 	for _, token := range tokens {
-		objId := txnTokenToId(token)
-		objectIds = append(objectIds, objId)
+		// Malformed tokens don't refer to any transaction, so are
+		// never completed.
+		if tok, err := ParseToken(token); err == nil {
+			objectIds = append(objectIds, tok.Id)
+		}
 	}
 	query := o.working.Find(bson.M{"_id": bson.M{"$in": objectIds}})
 	query = query.Select(bson.M{"_id": 1})
@@ -263,8 +255,8 @@ func (o *DBOracle) CompletedTokens(tokens []string) (map[string]bool, error) {
 	// because multiple tokens could map to a single txn, we iterate the
 	// passed in tokens instead of caching them in the map.
 	for _, token := range tokens {
-		objIdHex := txnTokenToId(token).Hex()
-		if foundIdHex[objIdHex] {
+		tok, err := ParseToken(token)
+		if err == nil && foundIdHex[tok.Id.Hex()] {
 			result[token] = true
 		}
 	}
@@ -352,7 +344,7 @@ func (o *MemOracle) prepare() error {
 	// temporary collection.
 	// Max memory consumed when dealing with 36M transactions was around 4GB
 	// when testing this.
-	logger.Debugf("loading all completed transactions")
+	pruneLogger.Debugf("loading all completed transactions")
 	pipeline := []bson.M{
 		// This used to use $in but that's much slower than $gte.
 		{"$match": completedOldTransactionMatch(o.thresholdTime)},
@@ -375,7 +367,7 @@ func (o *MemOracle) prepare() error {
 		completed[txnId.Id] = struct{}{}
 		docCount++
 		if t.isAfter() {
-			logger.Debugf("loaded %d documents", docCount)
+			pruneLogger.Debugf("loaded %d documents", docCount)
 		}
 	}
 	if err := iter.Close(); err != nil {
@@ -395,8 +387,11 @@ func (o *MemOracle) CompletedTokens(tokens []string) (map[string]bool, error) {
 	// nonces can also be considered 'completed'. (afaict, they are ignored,
 	// thus won't be applied and can be considered completed.)
 	for _, token := range tokens {
-		objId := txnTokenToId(token)
-		if _, ok := o.completed[objId]; ok {
+		tok, err := ParseToken(token)
+		if err != nil {
+			continue
+		}
+		if _, ok := o.completed[tok.Id]; ok {
 			result[token] = true
 			// this isn't exactly the same metric as the other
 			// one, which noticed when the same txn object was
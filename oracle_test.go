@@ -51,7 +51,8 @@ func (s *OracleSuite) TestKnownAndUnknownTxns(c *gc.C) {
 	completedToken2 := completedTxnId.Hex() + "_56780123"
 	pendingToken := s.txnToToken(c, pendingTxnId)
 	unknownToken := "0123456789abcdef78901234_deadbeef"
-	tokens := []string{completedToken1, completedToken2, pendingToken, unknownToken}
+	truncatedToken := completedTxnId.Hex()[:12]
+	tokens := []string{completedToken1, completedToken2, pendingToken, unknownToken, truncatedToken}
 	completed, err := oracle.CompletedTokens(tokens)
 	c.Assert(err, jc.ErrorIsNil)
 	c.Check(completed, jc.DeepEquals, map[string]bool{
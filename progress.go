@@ -0,0 +1,230 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+)
+
+// pruneProgressId is the _id of the document in txns.prune that reports
+// the progress of CleanAndPrune.
+const pruneProgressId = "progress"
+
+// PrunePhase is the stage a CleanAndPrune has reached.
+type PrunePhase string
+
+const (
+	// PrunePhasePruning means transactions are being pruned. It is used
+	// until a pruner reports a more specific phase.
+	PrunePhasePruning PrunePhase = "pruning"
+
+	// PrunePhaseScanning means a batch of completed transactions is being
+	// read.
+	PrunePhaseScanning PrunePhase = "scanning-txns"
+
+	// PrunePhaseCleaningDocs means the tokens of a batch of transactions
+	// are being removed from the txn-queues of the documents they
+	// touched.
+	PrunePhaseCleaningDocs PrunePhase = "cleaning-docs"
+
+	// PrunePhaseRemovingTxns means a batch of transactions is being
+	// removed.
+	PrunePhaseRemovingTxns PrunePhase = "removing-txns"
+
+	// PrunePhaseRemovingStash means stash documents whose txn-queues are
+	// empty are being removed.
+	PrunePhaseRemovingStash PrunePhase = "removing-stash"
+
+	// PrunePhaseDone means pruning finished successfully.
+	PrunePhaseDone PrunePhase = "done"
+
+	// PrunePhaseFailed means pruning stopped with an error.
+	PrunePhaseFailed PrunePhase = "failed"
+)
+
+// PruneProgress is written to the txns.prune collection while
+// CleanAndPrune runs, if CleanAndPruneArgs.ProgressInterval is set, so
+// that monitoring can follow a long prune without reading the logs of the
+// process running it. It is left in its final state when pruning ends.
+type PruneProgress struct {
+	Id string `bson:"_id"`
+
+	// Phase is the stage pruning has reached. While pruning, it is the
+	// phase last reported by a pruner.
+	Phase PrunePhase `bson:"phase"`
+
+	// Collection is the collection whose documents are being cleaned,
+	// and Batch is the batch of transactions being worked on, as last
+	// reported by a pruner.
+	Collection string `bson:"collection,omitempty"`
+	Batch      int    `bson:"batch,omitempty"`
+
+	// Started is when pruning started, and Updated when the document
+	// was last written.
+	Started time.Time `bson:"started"`
+	Updated time.Time `bson:"updated"`
+
+	// Pass is the pass over the transactions being made, starting at 1.
+	Pass int `bson:"pass"`
+
+	// TxnsRemoved and DocsCleaned count the work done so far.
+	TxnsRemoved int `bson:"txns-removed"`
+	DocsCleaned int `bson:"docs-cleaned"`
+
+	// TxnsToPrune is the number of completed transactions that were old
+	// enough to prune when pruning started.
+	TxnsToPrune int `bson:"txns-to-prune"`
+
+	// PeakHeapBytes is the most heap memory the pruning process was seen
+	// to use so far. See PrunerStats.PeakHeapBytes.
+	PeakHeapBytes int64 `bson:"peak-heap-bytes,omitempty"`
+
+	// ETA is when pruning is expected to finish, based on the rate that
+	// transactions have been removed so far. It is zero when there isn't
+	// enough progress to estimate it, or once pruning has ended.
+	ETA time.Time `bson:"eta,omitempty"`
+
+	// Error is the error pruning failed with, if Phase is
+	// PrunePhaseFailed.
+	Error string `bson:"error,omitempty"`
+}
+
+// estimate sets the ETA from the progress made by now.
+func (p *PruneProgress) estimate(now time.Time) {
+	p.ETA = time.Time{}
+	elapsed := now.Sub(p.Started)
+	remaining := p.TxnsToPrune - p.TxnsRemoved
+	if p.TxnsRemoved <= 0 || remaining <= 0 || elapsed <= 0 {
+		return
+	}
+	rate := float64(p.TxnsRemoved) / elapsed.Seconds()
+	p.ETA = now.Add(time.Duration(float64(remaining) / rate * float64(time.Second)))
+}
+
+// ReadPruneProgress returns the progress last written by a CleanAndPrune
+// of txnsName. It returns a NotFound error if none has been written.
+func ReadPruneProgress(db *mgo.Database, txnsName string) (*PruneProgress, error) {
+	var progress PruneProgress
+	err := db.C(txnsPruneC(txnsName)).FindId(pruneProgressId).One(&progress)
+	if err == mgo.ErrNotFound {
+		return nil, errors.NotFoundf("prune progress for %q", txnsName)
+	} else if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &progress, nil
+}
+
+// progressWriter periodically writes a PruneProgress to txns.prune.
+type progressWriter struct {
+	coll *mgo.Collection
+	stop chan struct{}
+	done chan struct{}
+
+	mu       sync.Mutex
+	progress PruneProgress
+}
+
+// startProgressWriter writes the initial progress of a prune of txns, and
+// then rewrites it every interval until finish is called.
+func startProgressWriter(txns *mgo.Collection, txnsToPrune int, interval time.Duration) *progressWriter {
+	now := time.Now()
+	w := &progressWriter{
+		coll: txns.Database.C(txnsPruneC(txns.Name)),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+		progress: PruneProgress{
+			Id:          pruneProgressId,
+			Phase:       PrunePhasePruning,
+			Started:     now,
+			TxnsToPrune: txnsToPrune,
+		},
+	}
+	w.write()
+	go w.loop(interval)
+	return w
+}
+
+func (w *progressWriter) loop(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.write()
+		}
+	}
+}
+
+// write saves a snapshot of the progress.
+func (w *progressWriter) write() {
+	w.mu.Lock()
+	w.progress.Updated = time.Now()
+	if w.progress.Phase != PrunePhaseDone && w.progress.Phase != PrunePhaseFailed {
+		w.progress.estimate(w.progress.Updated)
+	}
+	progress := w.progress
+	w.mu.Unlock()
+	if _, err := w.coll.UpsertId(pruneProgressId, progress); err != nil {
+		pruneLogger.Warningf("unable to write prune progress: %v", err)
+	}
+}
+
+// startPass records that another pass has started. It may be called on a
+// nil writer.
+func (w *progressWriter) startPass() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.progress.Pass++
+}
+
+// addProgress records the progress reported by the pruners. It may be
+// called on a nil writer.
+func (w *progressWriter) addProgress(msg ProgressMessage) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.progress.TxnsRemoved += msg.TxnsRemoved
+	w.progress.DocsCleaned += msg.DocsCleaned
+	if msg.PeakHeapBytes > w.progress.PeakHeapBytes {
+		w.progress.PeakHeapBytes = msg.PeakHeapBytes
+	}
+	if msg.Phase != "" {
+		w.progress.Phase = msg.Phase
+		w.progress.Collection = msg.Collection
+		w.progress.Batch = msg.Batch
+	}
+}
+
+// finish stops the periodic writes, and writes the final progress. It may
+// be called on a nil writer.
+func (w *progressWriter) finish(err error) {
+	if w == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.mu.Lock()
+	w.progress.Phase = PrunePhaseDone
+	w.progress.Collection = ""
+	w.progress.Batch = 0
+	if err != nil {
+		w.progress.Phase = PrunePhaseFailed
+		w.progress.Error = err.Error()
+	}
+	w.progress.ETA = time.Time{}
+	w.mu.Unlock()
+	w.write()
+}
@@ -0,0 +1,86 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type PruneProgressSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&PruneProgressSuite{})
+
+type PruneProgressEstimateSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&PruneProgressEstimateSuite{})
+
+func (*PruneProgressEstimateSuite) TestEstimate(c *gc.C) {
+	started := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	progress := jujutxn.PruneProgress{
+		Started:     started,
+		TxnsRemoved: 100,
+		TxnsToPrune: 400,
+	}
+	now := started.Add(time.Minute)
+	progress.Estimate(now)
+	c.Check(progress.ETA, gc.Equals, now.Add(3*time.Minute))
+
+	progress.TxnsRemoved = 0
+	progress.Estimate(now)
+	c.Check(progress.ETA.IsZero(), jc.IsTrue)
+
+	progress.TxnsRemoved = 400
+	progress.Estimate(now)
+	c.Check(progress.ETA.IsZero(), jc.IsTrue)
+}
+
+func (s *PruneProgressSuite) TestCleanAndPruneWritesProgress(c *gc.C) {
+	_, err := jujutxn.ReadPruneProgress(s.db, "txns")
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+
+	for i := 0; i < 5; i++ {
+		s.runTxn(c, txn.Op{C: "coll", Id: i, Insert: bson.M{}})
+	}
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:             s.txns,
+		ProgressInterval: time.Millisecond,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 5)
+
+	progress, err := jujutxn.ReadPruneProgress(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(progress.Phase, gc.Equals, jujutxn.PrunePhaseDone)
+	c.Check(progress.Pass, gc.Equals, 1)
+	c.Check(progress.TxnsToPrune, gc.Equals, 5)
+	c.Check(progress.TxnsRemoved, gc.Equals, 5)
+	c.Check(progress.ETA.IsZero(), jc.IsTrue)
+	c.Check(progress.Error, gc.Equals, "")
+
+	// The progress document isn't mistaken for a prune record.
+	records, err := jujutxn.PruneHistory(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(records, gc.HasLen, 0)
+}
+
+func (s *PruneProgressSuite) TestInvalidProgressInterval(c *gc.C) {
+	_, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:             s.txns,
+		ProgressInterval: -time.Second,
+	})
+	c.Check(err, gc.ErrorMatches, `ProgressInterval \(-1s\) must not be negative`)
+}
@@ -4,7 +4,10 @@
 package txn
 
 import (
+	stderrors "errors"
 	"fmt"
+	"io"
+	"net"
 	"strings"
 	"sync"
 	"time"
@@ -12,13 +15,11 @@ import (
 	"github.com/juju/errors"
 	"github.com/juju/mgo/v3"
 	"github.com/juju/mgo/v3/bson"
+
+	"github.com/juju/txn/v3/token"
 )
 
 const (
-	// Transaction states copied from mgo/txn.
-	taborted = 5 // Pre-conditions failed, nothing done
-	tapplied = 6 // All changes applied
-
 	// maxBatchDocs defines the maximum MongoDB batch size (in number of documents).
 	maxBatchDocs = 1616
 
@@ -76,16 +77,43 @@ const (
 	queueBatchSize = 200
 )
 
-type pruneStats struct {
-	Id              bson.ObjectId `bson:"_id"`
-	Started         time.Time     `bson:"started"`
-	Completed       time.Time     `bson:"completed"`
-	TxnsBefore      int           `bson:"txns-before"`
-	TxnsAfter       int           `bson:"txns-after"`
-	StashDocsBefore int           `bson:"stash-docs-before"`
-	StashDocsAfter  int           `bson:"stash-docs-after"`
+// PruneRecord is written to the txns.prune collection each time
+// MaybePruneTransactions prunes the database.
+type PruneRecord struct {
+	Id        bson.ObjectId `bson:"_id"`
+	Started   time.Time     `bson:"started"`
+	Completed time.Time     `bson:"completed"`
+
+	// TxnsBefore and TxnsAfter are the size of the txns collection
+	// before and after pruning.
+	TxnsBefore int `bson:"txns-before"`
+	TxnsAfter  int `bson:"txns-after"`
+
+	// StashDocsBefore and StashDocsAfter are the size of the txns.stash
+	// collection before and after pruning.
+	StashDocsBefore int `bson:"stash-docs-before"`
+	StashDocsAfter  int `bson:"stash-docs-after"`
+
+	// Collections records the work done against each collection.
+	Collections []CollectionPruneStats `bson:"collections,omitempty"`
+
+	// Version is the schema version of the record. Records written
+	// before the field was added have a Version of 0, and only contain
+	// the fields above.
+	Version int `bson:"version,omitempty"`
+
+	// Pruner is the full breakdown of the pruner's work, summed over all
+	// passes. Added in version 2.
+	Pruner *PrunerStats `bson:"pruner,omitempty"`
+
+	// PassTimes is how long each pass over the transactions took. Added
+	// in version 2.
+	PassTimes []time.Duration `bson:"pass-times,omitempty"`
 }
 
+// pruneRecordVersion is the Version of the PruneRecords that we write.
+const pruneRecordVersion = 2
+
 func validatePruneOptions(pruneOptions *PruneOptions) {
 	if pruneOptions.PruneFactor == 0 {
 		pruneOptions.PruneFactor = defaultPruneFactor
@@ -125,9 +153,28 @@ func shouldPrune(oldCount, newCount int, pruneOptions PruneOptions) (bool, strin
 	return false, "transactions have not grown significantly"
 }
 
-func maybePrune(db *mgo.Database, txnsName string, pruneOpts PruneOptions) error {
+// PruneResult describes the outcome of MaybePrune.
+type PruneResult struct {
+	// Pruned is true if a prune was required and run.
+	Pruned bool
+
+	// Reason explains why we did or did not prune.
+	Reason string
+
+	// Stats holds the work done while pruning.
+	Stats CleanupStats
+
+	// Warnings holds problems that were recovered from. See
+	// CorruptPruneStatsWarning.
+	Warnings []error
+}
+
+// MaybePrune prunes the txnsName collection if it has grown enough since
+// the last prune, according to pruneOpts. See Runner.MaybePruneTransactions.
+func MaybePrune(db *mgo.Database, txnsName string, pruneOpts PruneOptions) (PruneResult, error) {
+	var result PruneResult
 	validatePruneOptions(&pruneOpts)
-	logger.Debugf("validated pruneOpts: %#v", pruneOpts)
+	pruneLogger.Debugf("validated pruneOpts: %#v", pruneOpts)
 	txnsPrune := db.C(txnsPruneC(txnsName))
 	txns := db.C(txnsName)
 	txnsStashName := txnsName + ".stash"
@@ -135,27 +182,42 @@ func maybePrune(db *mgo.Database, txnsName string, pruneOpts PruneOptions) error
 
 	txnsCount, err := txns.Count()
 	if err != nil {
-		return fmt.Errorf("failed to retrieve starting txns count: %v", err)
+		return result, fmt.Errorf("failed to retrieve starting txns count: %v", err)
 	}
-	lastTxnsCount, err := getPruneLastTxnsCount(txnsPrune)
+	lastStats, warning, err := getPruneLastStats(txnsPrune)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve pruning stats: %v", err)
+		return result, fmt.Errorf("failed to retrieve pruning stats: %v", err)
+	}
+	if warning != nil {
+		result.Warnings = append(result.Warnings, warning)
+	}
+	lastTxnsCount := -1
+	var collPriority map[string]float64
+	if lastStats != nil {
+		lastTxnsCount = lastStats.TxnsAfter
+		collPriority = CollectionPriorities(lastStats.Collections)
 	}
 
 	required, rationale := shouldPrune(lastTxnsCount, txnsCount, pruneOpts)
+	result.Reason = rationale
 
 	if !required {
-		logger.Infof("txns after last prune: %d, txns now: %d, not pruning: %s",
+		pruneLogger.Infof("txns after last prune: %d, txns now: %d, not pruning: %s",
 			lastTxnsCount, txnsCount, rationale)
-		return nil
+		return result, nil
+	}
+	if err := checkDiskSpace(db, txnsCount, pruneOpts); err != nil {
+		result.Reason = err.Error()
+		return result, errors.Trace(err)
 	}
-	logger.Infof("txns after last prune: %d, txns now: %d, pruning: %s",
+	result.Pruned = true
+	pruneLogger.Infof("txns after last prune: %d, txns now: %d, pruning: %s",
 		lastTxnsCount, txnsCount, rationale)
 	started := time.Now()
 
 	stashDocsBefore, err := txnsStash.Count()
 	if err != nil {
-		return fmt.Errorf("failed to retrieve starting %q count: %v", txnsStashName, err)
+		return result, fmt.Errorf("failed to retrieve starting %q count: %v", txnsStashName, err)
 	}
 
 	txnsCountBefore := txnsCount
@@ -169,24 +231,50 @@ func maybePrune(db *mgo.Database, txnsName string, pruneOpts PruneOptions) error
 		MaxTransactionsToProcess: pruneOpts.MaxBatchTransactions,
 		TxnBatchSize:             pruneOpts.SmallBatchTransactionCount,
 		TxnBatchSleepTime:        pruneOpts.BatchTransactionSleepTime,
+		MaxPasses:                pruneOpts.MaxBatches,
+		CollectionPriority:       collPriority,
+		LoadMonitor:              pruneOpts.LoadMonitor,
 	})
+	result.Stats = stats
 	if err != nil {
-		return errors.Trace(err)
+		return result, errors.Trace(err)
 	}
 	txnsCountAfter, err := txns.Count()
 	if err != nil {
-		return fmt.Errorf("failed to retrieve final txns count: %v", err)
+		return result, fmt.Errorf("failed to retrieve final txns count: %v", err)
 	}
 	stashDocsAfter, err := txnsStash.Count()
 	if err != nil {
-		return fmt.Errorf("failed to retrieve final %q count: %v", txnsStashName, err)
+		return result, fmt.Errorf("failed to retrieve final %q count: %v", txnsStashName, err)
 	}
 	elapsed := time.Since(started)
-	logger.Infof("txn pruning complete after %v. txns now: %d, inspected %d collections, %d docs (%d cleaned)\n   removed %d stash docs and %d txn docs",
+	pruneLogger.Infof("txn pruning complete after %v. txns now: %d, inspected %d collections, %d docs (%d cleaned)\n   removed %d stash docs and %d txn docs",
 		elapsed, txnsCountAfter, stats.CollectionsInspected, stats.DocsInspected, stats.DocsCleaned, stats.StashDocumentsRemoved, stats.TransactionsRemoved)
 	completed := time.Now()
-	return writePruneTxnsCount(txnsPrune, started, completed, txnsCountBefore, txnsCountAfter,
-		stashDocsBefore, stashDocsAfter)
+	pstats := stats.Pruner
+	err = writePruneTxnsCount(txnsPrune, PruneRecord{
+		Started:         started,
+		Completed:       completed,
+		TxnsBefore:      txnsCountBefore,
+		TxnsAfter:       txnsCountAfter,
+		StashDocsBefore: stashDocsBefore,
+		StashDocsAfter:  stashDocsAfter,
+		Collections:     stats.Collections,
+		Pruner:          &pstats,
+		PassTimes:       stats.PassTimes,
+	})
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+	if pruneOpts.MaxPruneHistory > 0 || pruneOpts.MaxPruneHistoryAge > 0 {
+		_, err := trimPruneHistory(txnsPrune, pruneOpts.MaxPruneHistory,
+			pruneOpts.MaxPruneHistoryAge, pruneOpts.PruneHistoryExporter)
+		if err != nil {
+			// The prune itself succeeded, so we don't fail because of this.
+			pruneLogger.Warningf("failed to trim prune history: %v", err)
+		}
+	}
+	return result, nil
 }
 
 // CleanAndPruneArgs specifies the parameters required by CleanAndPrune.
@@ -208,11 +296,18 @@ type CleanAndPruneArgs struct {
 	// before this threshold will be pruned.
 	MaxTime time.Time
 
+	// StartAfter, if set, skips the transactions with ids up to and
+	// including it, so that pruning can carry on from the Checkpoint of an
+	// earlier CleanAndPrune.
+	StartAfter bson.ObjectId
+
 	// MaxTransactionsToProcess defines how many completed transactions that we will evaluate in this batch.
 	// A value of 0 indicates we should evaluate all completed transactions.
 	MaxTransactionsToProcess int
 
-	// Multithreaded will start multiple pruning passes concurrently
+	// Multithreaded will start multiple pruning passes concurrently. It
+	// sets how many batches of transactions are processed at once, not
+	// how many collections are read at once; see CollectionConcurrency.
 	Multithreaded bool
 
 	// TxnBatchSize is how many transaction to process at once.
@@ -224,12 +319,191 @@ type CleanAndPruneArgs struct {
 	// The default is to not sleep at all, but this can be configured to reduce
 	// load while pruning.
 	TxnBatchSleepTime time.Duration
+
+	// MaxPasses is the maximum number of passes we will make over the
+	// transactions. Another pass is only started if the previous one
+	// reported ShouldRetry. 0 or negative values are treated as a single
+	// pass.
+	MaxPasses int
+
+	// ErrorBudget is how many transient errors, such as lost connections
+	// or elections, are tolerated. A pass that fails with only transient
+	// errors is followed by another pass, which doesn't count towards
+	// MaxPasses, until the budget is spent. CleanAndPrune then stops and
+	// returns the stats so far with an *ErrorBudgetExceeded. Other errors
+	// always stop pruning. A value of 0 stops at the first error.
+	ErrorBudget int
+
+	// MaxRuntime caps the total time spent across all passes. Once it has
+	// elapsed no further passes will be started, although the current pass
+	// is allowed to complete. A value of 0 indicates no limit.
+	MaxRuntime time.Duration
+
+	// CollectionPriority optionally ranks collections so the most
+	// productive ones are cleaned first. See CollectionPriorities.
+	CollectionPriority map[string]float64
+
+	// LoadMonitor, if not nil, is used to slow down or suspend pruning
+	// while the database is busy.
+	LoadMonitor LoadMonitor
+
+	// MaxLoadSuspend is the longest pruning is suspended by LoadMonitor.
+	// See IncrementalPruneArgs.
+	MaxLoadSuspend time.Duration
+
+	// ScanSession, if not nil, is used to scan the txns collection for
+	// transactions to prune, while writes still go through Txns. See
+	// IncrementalPruneArgs.ScanSession.
+	ScanSession *mgo.Session
+
+	// MaxScanLag is how far the ScanSession member may fall behind the
+	// primary before pruning is stopped. A value of 0 disables the check.
+	MaxScanLag time.Duration
+
+	// ReadWholeDocuments disables the projections used to read only the
+	// fields needed for pruning. See IncrementalPruneArgs.
+	ReadWholeDocuments bool
+
+	// StripInvalidTokens removes malformed tokens from the txn-queue of
+	// documents. See IncrementalPruneArgs.
+	StripInvalidTokens bool
+
+	// CheckMissingTxns counts the tokens for transactions that no longer
+	// exist. See IncrementalPruneArgs.
+	CheckMissingTxns bool
+
+	// MetadataFilter, if not zero, restricts pruning to transactions with
+	// matching metadata. See IncrementalPruneArgs.
+	MetadataFilter TxnMetadata
+
+	// DocFilter, if not nil, is asked whether each document may be
+	// cleaned, and DocFilterFields are the fields it needs to see. See
+	// IncrementalPruneArgs.DocFilter.
+	DocFilter       DocFilter
+	DocFilterFields []string
+
+	// OnRemove, if not nil, is called with each transaction that is about
+	// to be removed. See IncrementalPruneArgs.
+	OnRemove RemoveHook
+
+	// DialInfo, if not nil, is used to dial a dedicated connection for
+	// pruning, rather than copying the session of Txns, so that pruning
+	// doesn't compete with the application for the sockets in its pool.
+	// It should address the same database as Txns.
+	DialInfo *mgo.DialInfo
+
+	// SessionMode is the consistency mode of the pruning session. By
+	// default the mode of the session of Txns (or of DialInfo) is kept.
+	SessionMode PruneSessionMode
+
+	// SyncTimeout and SocketTimeout, if not 0, override the timeouts of
+	// the pruning session (see mgo.Session.SetSyncTimeout and
+	// SetSocketTimeout).
+	SyncTimeout   time.Duration
+	SocketTimeout time.Duration
+
+	// DocBatchSize and DocBatchDeadline control how many documents are
+	// read with each query. See IncrementalPruneArgs.
+	DocBatchSize     int
+	DocBatchDeadline time.Duration
+
+	// CollectionConcurrency, if not 0, is the most collections read at
+	// once, across all the pruners of a run. Each pruner reads the
+	// documents of a batch from several collections at once, up to the
+	// limit. If it is 0, each pruner reads one collection at a time.
+	CollectionConcurrency int
+
+	// IndexHints, if not nil, selects the indexes used by the pruners'
+	// queries, and warns when the server plans to scan a whole
+	// collection instead. See IndexHints.
+	IndexHints *IndexHints
+
+	// ExplainSlowQueries, if not 0, is how long a pruner query may take
+	// before it is explained. The explanations are returned in
+	// CleanupStats.SlowQueries, and the most recent are kept in the
+	// txns.prune collection for ReadSlowQueries and the support bundle.
+	// See IncrementalPruneArgs.ExplainSlowQueries.
+	ExplainSlowQueries time.Duration
+
+	// OplogPacing, if not nil, limits how fast the pruners write to the
+	// oplog, so that pruning doesn't shorten the oplog window faster than
+	// delayed or slow secondaries can tolerate. It is skipped, with a
+	// warning, if the server has no oplog. See OplogPacing.
+	OplogPacing *OplogPacing
+
+	// Compaction, if not nil, estimates the disk space left behind by a
+	// large prune, and recommends or runs compact. See
+	// CompactionPolicy.
+	Compaction *CompactionPolicy
+
+	// StashOrder and BulkStashCleanup select how documents in txns.stash
+	// are processed. See IncrementalPruneArgs.
+	StashOrder       StashOrder
+	BulkStashCleanup bool
+
+	// Archive, if not nil, is written each transaction before it is
+	// pruned. See IncrementalPruneArgs.Archive.
+	Archive *ArchiveWriter
+
+	// ConcurrentPrune selects what to do if another process is already
+	// pruning Txns. Pruners record a heartbeat in the txns.prune
+	// collection so that they can see each other. The default is
+	// ConcurrentPruneIgnore.
+	ConcurrentPrune ConcurrentPruneMode
+
+	// ProgressInterval, if not 0, is how often a PruneProgress is written
+	// to the txns.prune collection while pruning, so that it can be
+	// followed with ReadPruneProgress. The document is left in its final
+	// state when pruning ends.
+	ProgressInterval time.Duration
+
+	// Features, if not nil, restricts the behaviours above to those that
+	// are enabled. See Features.
+	Features *Features
+
+	// ProfileLabels sets pprof labels naming the prune phase while
+	// pruning. See IncrementalPruneArgs.
+	ProfileLabels bool
+
+	// StartCPUProfileOnSlowBatch and CPUProfileDir profile the batch after
+	// one that is slow. See IncrementalPruneArgs.
+	StartCPUProfileOnSlowBatch time.Duration
+	CPUProfileDir              string
+
+	// Metrics, if not nil, writes metrics of the run, and optionally of
+	// each batch, to a collection. See MetricsExport.
+	Metrics *MetricsExport
+
+	// job is set when we are run by StartCleanAndPrune.
+	job *PruneJob
+
+	// deadline is set when MaxRuntime is.
+	deadline time.Time
+
+	// progress is set when ProgressInterval is.
+	progress *progressWriter
+
+	// metrics is set when Metrics is.
+	metrics *metricsWriter
+
+	// joined is set when we are an extra worker alongside another
+	// process's pruner.
+	joined bool
+
+	// cleanOnly and removeOnly are set by CleanDocQueues and PruneTxns.
+	cleanOnly  bool
+	removeOnly bool
 }
 
 func (args *CleanAndPruneArgs) validate() error {
 	if args.Txns == nil {
 		return errors.New("nil Txns not valid")
 	}
+	return args.validateSettings()
+}
+
+// validateSettings checks the tuning settings, and fills in defaults.
+func (args *CleanAndPruneArgs) validateSettings() error {
 	if args.TxnBatchSleepTime < 0 || args.TxnBatchSleepTime > maxBatchSleepTime {
 		return errors.Errorf("TxnBatchSleepTime (%s) must be between 0s and %s",
 			args.TxnBatchSleepTime, maxBatchSleepTime)
@@ -246,6 +520,69 @@ func (args *CleanAndPruneArgs) validate() error {
 		return errors.Errorf("TxnBatchSize %d too big, must be between %d and %d",
 			args.TxnBatchSize, pruneMinTxnBatchSize, pruneMaxTxnBatchSize)
 	}
+	if args.MaxPasses <= 0 {
+		args.MaxPasses = 1
+	}
+	if args.MaxRuntime < 0 {
+		return errors.Errorf("MaxRuntime (%s) must not be negative", args.MaxRuntime)
+	}
+	if args.ProgressInterval < 0 {
+		return errors.Errorf("ProgressInterval (%s) must not be negative", args.ProgressInterval)
+	}
+	if args.ErrorBudget < 0 {
+		return errors.Errorf("ErrorBudget (%d) must not be negative", args.ErrorBudget)
+	}
+	switch args.ConcurrentPrune {
+	case "", ConcurrentPruneIgnore, ConcurrentPruneWait, ConcurrentPruneSkip, ConcurrentPruneJoin:
+	default:
+		return errors.Errorf("unknown ConcurrentPrune mode %q", args.ConcurrentPrune)
+	}
+	if args.MaxScanLag < 0 {
+		return errors.Errorf("MaxScanLag (%s) must not be negative", args.MaxScanLag)
+	}
+	if args.ExplainSlowQueries < 0 {
+		return errors.Errorf("ExplainSlowQueries (%s) must not be negative", args.ExplainSlowQueries)
+	}
+	if args.CollectionConcurrency < 0 {
+		return errors.Errorf("CollectionConcurrency (%d) must not be negative", args.CollectionConcurrency)
+	}
+	if err := args.StashOrder.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if args.IndexHints != nil {
+		if err := args.IndexHints.Validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if args.Metrics != nil {
+		if err := args.Metrics.Validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if args.Compaction != nil {
+		if err := args.Compaction.Validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if args.OplogPacing != nil {
+		if err := args.OplogPacing.Validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	switch args.SessionMode {
+	case "", PruneSessionMonotonic, PruneSessionStrong:
+	default:
+		return errors.Errorf("unknown SessionMode %q", args.SessionMode)
+	}
+	if args.SyncTimeout < 0 {
+		return errors.Errorf("SyncTimeout (%s) must not be negative", args.SyncTimeout)
+	}
+	if args.SocketTimeout < 0 {
+		return errors.Errorf("SocketTimeout (%s) must not be negative", args.SocketTimeout)
+	}
+	if args.Features != nil {
+		args.Features.applyToPrune(args)
+	}
 	return nil
 }
 
@@ -262,22 +599,116 @@ type CleanupStats struct {
 	// DocsCleaned is how many documents we Updated to remove entries from their txn queue.
 	DocsCleaned int
 
+	// DocsFiltered is how many documents were left alone because
+	// DocFilter said to skip them.
+	DocsFiltered int
+
 	// StashDocumentsRemoved is how many total documents we remove from txns.stash
 	StashDocumentsRemoved int
 
 	// StashDocumentsRemoved is how many documents we remove from txns
 	TransactionsRemoved int
 
+	// ConcurrentlyRemoved is how many transactions were queued for removal
+	// but had already been removed, e.g. by a concurrent pruner. They are
+	// not included in TransactionsRemoved.
+	ConcurrentlyRemoved int
+
 	// ShouldRetry indicates that we think this cleanup was not complete due to too many txns to process. We recommend running it again.
 	ShouldRetry bool
+
+	// Passes is how many passes were made over the transactions.
+	Passes int
+
+	// TransientErrors is how many errors were tolerated because of
+	// CleanAndPruneArgs.ErrorBudget.
+	TransientErrors int
+
+	// Collections records the work done against each collection.
+	Collections []CollectionPruneStats
+
+	// SkippedCollections are the collections whose documents couldn't be
+	// cleaned, eg capped collections. The transactions that touched them
+	// are left to be pruned later.
+	SkippedCollections []string
+
+	// Pruner is the full breakdown of the pruner's work.
+	Pruner PrunerStats
+
+	// PassTimes is how long each pass took.
+	PassTimes []time.Duration
+
+	// ConcurrentPrune is the mode that was used because another process
+	// was already pruning. It is empty if there was no other pruner.
+	ConcurrentPrune ConcurrentPruneMode
+
+	// Checkpoint is the id of the last transaction in the furthest batch
+	// that was finished working forwards. Passing it as StartAfter
+	// carries on from there.
+	Checkpoint bson.ObjectId
+
+	// SlowQueries are the queries explained because of
+	// CleanAndPruneArgs.ExplainSlowQueries.
+	SlowQueries []SlowQuery
+
+	// Compaction estimates the space compacting txns and txns.stash
+	// would reclaim, if CleanAndPruneArgs.Compaction is set and enough
+	// transactions were removed.
+	Compaction []CompactionAdvice
+}
+
+// combineCleanupStats aggregates the stats from two passes. ShouldRetry is
+// taken from the later pass, as it reflects what is left to do.
+func combineCleanupStats(a, b CleanupStats) CleanupStats {
+	collections := combineCollectionStats(a.Collections, b.Collections)
+	checkpoint := a.Checkpoint
+	if b.Checkpoint > checkpoint {
+		checkpoint = b.Checkpoint
+	}
+	return CleanupStats{
+		CollectionsInspected:  a.CollectionsInspected + b.CollectionsInspected,
+		DocsInspected:         a.DocsInspected + b.DocsInspected,
+		DocsCleaned:           a.DocsCleaned + b.DocsCleaned,
+		DocsFiltered:          a.DocsFiltered + b.DocsFiltered,
+		StashDocumentsRemoved: a.StashDocumentsRemoved + b.StashDocumentsRemoved,
+		TransactionsRemoved:   a.TransactionsRemoved + b.TransactionsRemoved,
+		ConcurrentlyRemoved:   a.ConcurrentlyRemoved + b.ConcurrentlyRemoved,
+		ShouldRetry:           b.ShouldRetry,
+		Passes:                a.Passes + b.Passes,
+		TransientErrors:       a.TransientErrors + b.TransientErrors,
+		Collections:           collections,
+		SkippedCollections:    skippedCollections(collections),
+		Pruner:                CombineStats(a.Pruner, b.Pruner),
+		PassTimes:             append(a.PassTimes[:len(a.PassTimes):len(a.PassTimes)], b.PassTimes...),
+		ConcurrentPrune:       a.ConcurrentPrune,
+		Checkpoint:            checkpoint,
+		SlowQueries:           append(a.SlowQueries[:len(a.SlowQueries):len(a.SlowQueries)], b.SlowQueries...),
+	}
+}
+
+// skippedCollections returns the names of the collections that couldn't be
+// cleaned.
+func skippedCollections(collections []CollectionPruneStats) []string {
+	var names []string
+	for _, coll := range collections {
+		if coll.Skipped != "" {
+			names = append(names, coll.Name)
+		}
+	}
+	return names
 }
 
-func startReportingThread(stop <-chan struct{}, progressCh chan ProgressMessage) {
+// startReportingThread collects the progress sent on progressCh until stop
+// is closed. The returned channel is closed once it has finished.
+func startReportingThread(stop <-chan struct{}, progressCh chan ProgressMessage, job *PruneJob, progress *progressWriter) <-chan struct{} {
 	tStart := time.Now()
 	next := time.After(15 * time.Second)
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		txnsRemoved := 0
 		docsCleaned := 0
+		var peakHeap int64
 		for {
 			select {
 			case <-stop:
@@ -285,22 +716,70 @@ func startReportingThread(stop <-chan struct{}, progressCh chan ProgressMessage)
 			case msg := <-progressCh:
 				txnsRemoved += msg.TxnsRemoved
 				docsCleaned += msg.DocsCleaned
+				if msg.PeakHeapBytes > peakHeap {
+					peakHeap = msg.PeakHeapBytes
+				}
+				job.addProgress(msg)
+				progress.addProgress(msg)
 			case <-next:
 				txnRate := 0.0
 				since := time.Since(tStart).Seconds()
 				if since > 0 {
 					txnRate = float64(txnsRemoved) / since
 				}
-				logger.Debugf("pruning has removed %d txns (%.0ftxn/s) cleaning %d docs ",
-					txnsRemoved, txnRate, docsCleaned)
+				pruneLogger.Debugf("pruning has removed %d txns (%.0ftxn/s) cleaning %d docs, peak heap %dMiB",
+					txnsRemoved, txnRate, docsCleaned, peakHeap>>20)
 				next = time.After(15 * time.Second)
 			}
 		}
 	}()
+	return done
+}
+
+// PruneSessionMode is the consistency mode of the session used by
+// CleanAndPrune.
+type PruneSessionMode string
+
+const (
+	// PruneSessionMonotonic reads from a secondary until the first write,
+	// and then from the primary.
+	PruneSessionMonotonic PruneSessionMode = "monotonic"
+
+	// PruneSessionStrong reads from and writes to the primary.
+	PruneSessionStrong PruneSessionMode = "strong"
+)
+
+// openPruneSession returns the session that CleanAndPrune should use,
+// configured as args requests. The caller must close it.
+func openPruneSession(args CleanAndPruneArgs) (*mgo.Session, error) {
+	var session *mgo.Session
+	if args.DialInfo != nil {
+		var err error
+		if session, err = mgo.DialWithInfo(args.DialInfo); err != nil {
+			return nil, errors.Annotate(err, "dialing pruning connection")
+		}
+	} else {
+		session = args.Txns.Database.Session.Copy()
+	}
+	switch args.SessionMode {
+	case PruneSessionMonotonic:
+		session.SetMode(mgo.Monotonic, true)
+	case PruneSessionStrong:
+		session.SetMode(mgo.Strong, true)
+	}
+	if args.SyncTimeout > 0 {
+		session.SetSyncTimeout(args.SyncTimeout)
+	}
+	if args.SocketTimeout > 0 {
+		session.SetSocketTimeout(args.SocketTimeout)
+	}
+	return session, nil
 }
 
 // CleanAndPrune runs the cleanup steps, and then follows up with pruning all
-// of the transactions that are no longer referenced.
+// of the transactions that are no longer referenced. If a pass reports that
+// it was not able to process everything, further passes are made up to
+// MaxPasses or MaxRuntime.
 func CleanAndPrune(args CleanAndPruneArgs) (CleanupStats, error) {
 	tStart := time.Now()
 	var stats CleanupStats
@@ -308,175 +787,808 @@ func CleanAndPrune(args CleanAndPruneArgs) (CleanupStats, error) {
 	if err := args.validate(); err != nil {
 		return stats, err
 	}
+	session, err := openPruneSession(args)
+	if err != nil {
+		return stats, errors.Trace(err)
+	}
+	defer session.Close()
+	args.Txns = args.Txns.With(session)
+	lock, mode, err := claimPrune(args)
+	if err != nil {
+		return stats, errors.Trace(err)
+	}
+	stats.ConcurrentPrune = mode
+	switch {
+	case lock != nil:
+		defer lock.release()
+	case mode == ConcurrentPruneSkip:
+		return stats, nil
+	case mode == ConcurrentPruneJoin:
+		args.joined = true
+	}
+	// A joined pruner leaves reporting progress to the pruner it joined.
+	if args.ProgressInterval > 0 && !args.joined {
+		count, err := args.Txns.Find(prunableTxnsMatch(args.MaxTime, args.MetadataFilter)).Count()
+		if err != nil {
+			pruneLogger.Warningf("unable to count txns to prune: %v", err)
+		}
+		args.progress = startProgressWriter(args.Txns, count, args.ProgressInterval)
+	}
+	args.metrics = startMetrics(args.Txns, args.Metrics)
+	stats, err = cleanAndPrunePasses(args, stats, tStart)
+	// A joined pruner leaves compaction to the pruner it joined.
+	if err == nil && args.Compaction != nil && !args.joined {
+		stats.Compaction = adviseCompaction(args.Txns, stats.TransactionsRemoved, *args.Compaction)
+	}
+	args.progress.finish(err)
+	args.metrics.run(stats, time.Since(tStart), err)
+	if err := recordSlowQueries(args.Txns, stats.SlowQueries); err != nil {
+		pruneLogger.Warningf("%v", err)
+	}
+	return stats, err
+}
+
+// CleanDocQueues pulls the tokens of completed transactions from the
+// txn-queues of the documents they touched, and removes the stash
+// documents left empty, but doesn't remove the transactions. It takes the
+// same arguments as CleanAndPrune, and can be run often to keep queues
+// short, with PruneTxns run rarely to remove the transactions. As the
+// transactions are left in place, pass the Checkpoint of each run as the
+// StartAfter of the next, so that only newer transactions are visited.
+// Multithreaded is ignored, as pruners working from both ends would clean
+// every transaction twice.
+func CleanDocQueues(args CleanAndPruneArgs) (CleanupStats, error) {
+	args.cleanOnly = true
+	args.Multithreaded = false
+	return CleanAndPrune(args)
+}
+
+// PruneTxns removes the completed transactions that no document refers
+// to any more, such as those whose tokens were pulled by CleanDocQueues,
+// without writing to the documents. It still reads the documents each
+// transaction touched, to check that its tokens are gone; transactions
+// that are still referenced are counted in PrunerStats.TxnsNotRemoved and
+// left for a later run, so don't pass the Checkpoint of a run that left
+// any as the StartAfter of the next. It takes the same arguments as
+// CleanAndPrune.
+func PruneTxns(args CleanAndPruneArgs) (CleanupStats, error) {
+	args.removeOnly = true
+	return CleanAndPrune(args)
+}
+
+// cleanAndPrunePasses makes passes over the transactions until there is
+// nothing left to do, or a limit is reached.
+func cleanAndPrunePasses(args CleanAndPruneArgs, stats CleanupStats, tStart time.Time) (CleanupStats, error) {
+	if args.MaxRuntime > 0 {
+		args.deadline = tStart.Add(args.MaxRuntime)
+	}
+	var budget errorBudget
+	failedPasses := 0
+	for {
+		passStats, err := cleanAndPrunePass(args)
+		stats = combineCleanupStats(stats, passStats)
+		if err != nil {
+			if err := budget.charge(err, args.ErrorBudget); err != nil {
+				return stats, errors.Trace(err)
+			}
+			stats.TransientErrors = len(budget.errs)
+			failedPasses++
+			pruneLogger.Warningf("pruning pass failed (%d of %d errors tolerated): %v",
+				len(budget.errs), args.ErrorBudget, err)
+			if args.MaxRuntime > 0 && time.Since(tStart) >= args.MaxRuntime {
+				return stats, errors.Trace(err)
+			}
+		} else {
+			if !stats.ShouldRetry {
+				break
+			}
+			if stats.Passes-failedPasses >= args.MaxPasses {
+				pruneLogger.Debugf("pruning incomplete after %d passes", stats.Passes)
+				break
+			}
+			if args.MaxRuntime > 0 && time.Since(tStart) >= args.MaxRuntime {
+				pruneLogger.Debugf("pruning incomplete after %s (%d passes)",
+					time.Since(tStart).Round(time.Millisecond), stats.Passes)
+				break
+			}
+		}
+		if err := args.job.checkpoint(); err != nil {
+			return stats, errors.Trace(err)
+		}
+		if args.cleanOnly && stats.Checkpoint != "" {
+			// The transactions cleaned are still there, so the next
+			// pass carries on after them.
+			args.StartAfter = stats.Checkpoint
+		}
+	}
+	return stats, nil
+}
+
+// cleanAndPrunePass does a single pass of CleanAndPrune.
+func cleanAndPrunePass(args CleanAndPruneArgs) (CleanupStats, error) {
+	tStart := time.Now()
+	stats := CleanupStats{Passes: 1}
+
+	args.progress.startPass()
 	stop := make(chan struct{})
 	progressCh := make(chan ProgressMessage)
-	startReportingThread(stop, progressCh)
+	reported := startReportingThread(stop, progressCh, args.job, args.progress)
 	var wg sync.WaitGroup
 	var mu sync.Mutex
-	var pstats PrunerStats
-	var anyErr error
+	// The forward pruner adds its stats to shard 0, and the reverse one
+	// to shard 1.
+	shards := newStatsShards(2)
+	var errs MultiError
+	maxTxns := args.MaxTransactionsToProcess
+	if args.Multithreaded && !args.joined && maxTxns > 0 {
+		// Split the work between both pruners.
+		maxTxns = (maxTxns + 1) / 2
+	}
+	var scans *ScanLimiter
+	if args.CollectionConcurrency > 0 {
+		// Both pruners share the limit.
+		scans = NewScanLimiter(args.CollectionConcurrency)
+	}
+	var pacer *OplogPacer
+	if args.OplogPacing != nil {
+		// Both pruners share the pace.
+		var err error
+		pacer, err = NewOplogPacer(args.Txns.Database.Session, *args.OplogPacing)
+		if err != nil {
+			pruneLogger.Warningf("not pacing pruning to the oplog: %v", err)
+		}
+	}
 	prune := func(reversed bool) {
 		pruner := NewIncrementalPruner(IncrementalPruneArgs{
-			MaxTime:           args.MaxTime,
-			ProgressChannel:   progressCh,
-			ReverseOrder:      reversed,
-			TxnBatchSize:      args.TxnBatchSize,
-			TxnBatchSleepTime: args.TxnBatchSleepTime,
+			MaxTime:                    args.MaxTime,
+			StartAfter:                 args.StartAfter,
+			ProgressChannel:            progressCh,
+			ReverseOrder:               reversed,
+			MaxTransactionsToProcess:   maxTxns,
+			TxnBatchSize:               args.TxnBatchSize,
+			TxnBatchSleepTime:          args.TxnBatchSleepTime,
+			CollectionPriority:         args.CollectionPriority,
+			LoadMonitor:                args.LoadMonitor,
+			MaxLoadSuspend:             args.MaxLoadSuspend,
+			OplogPacer:                 pacer,
+			ScanSession:                args.ScanSession,
+			MaxScanLag:                 args.MaxScanLag,
+			ReadWholeDocuments:         args.ReadWholeDocuments,
+			StripInvalidTokens:         args.StripInvalidTokens,
+			CheckMissingTxns:           args.CheckMissingTxns,
+			MetadataFilter:             args.MetadataFilter,
+			DocFilter:                  args.DocFilter,
+			DocFilterFields:            args.DocFilterFields,
+			DocBatchSize:               args.DocBatchSize,
+			DocBatchDeadline:           args.DocBatchDeadline,
+			CollectionScans:            scans,
+			IndexHints:                 args.IndexHints,
+			ExplainSlowQueries:         args.ExplainSlowQueries,
+			StashOrder:                 args.StashOrder,
+			BulkStashCleanup:           args.BulkStashCleanup,
+			CleanOnly:                  args.cleanOnly,
+			RemoveOnly:                 args.removeOnly,
+			Archive:                    args.Archive,
+			OnRemove:                   args.OnRemove,
+			ProfileLabels:              args.ProfileLabels,
+			StartCPUProfileOnSlowBatch: args.StartCPUProfileOnSlowBatch,
+			CPUProfileDir:              args.CPUProfileDir,
+			job:                        args.job,
+			deadline:                   args.deadline,
+			metrics:                    args.metrics,
 		})
 		thisPstats, err := pruner.Prune(args.Txns)
+		worker := 0
+		if reversed {
+			worker = 1
+		}
+		shards.add(worker, &thisPstats)
 		mu.Lock()
-		pstats = CombineStats(pstats, thisPstats)
-		if anyErr == nil {
-			anyErr = errors.Trace(err)
-		} else if err != nil {
-			logger.Warningf("second error while handling initial error: %v", err)
+		stats.Collections = combineCollectionStats(stats.Collections, pruner.CollectionStats())
+		stats.SlowQueries = append(stats.SlowQueries, pruner.SlowQueries()...)
+		if pruner.LimitReached() {
+			stats.ShouldRetry = true
+		}
+		if !reversed {
+			stats.Checkpoint = pruner.checkpoint
+		}
+		if err != nil {
+			errs = append(errs, &WorkerError{
+				Worker:     pruner.worker(),
+				FirstTxnId: pruner.firstTxnId,
+				LastTxnId:  pruner.lastTxnId,
+				Err:        errors.Trace(err),
+			})
 		}
 		mu.Unlock()
 		wg.Done()
 	}
-	if args.Multithreaded {
+	switch {
+	case args.joined:
+		// The other pruner is working forwards, so we work backwards.
 		wg.Add(1)
+		prune(true)
+	case args.Multithreaded:
+		wg.Add(2)
 		go prune(true)
+		prune(false)
+	default:
+		wg.Add(1)
+		prune(false)
 	}
-	wg.Add(1)
-	prune(false)
 	wg.Wait()
 	close(stop)
-	if anyErr != nil {
-		return stats, errors.Trace(anyErr)
-	}
-	logger.Infof("pruning removed %d txns and cleaned %d docs in %s.",
-		pstats.TxnsRemoved,
-		pstats.DocQueuesCleaned,
-		time.Since(tStart).Round(time.Millisecond))
-	logger.Debugf("%s", pstats)
+	<-reported
+	pstats := shards.total()
+	// The stats are filled in even if a pruner failed, so that the work
+	// done before the failure is reported.
 	stats.TransactionsRemoved = int(pstats.TxnsRemoved)
+	stats.ConcurrentlyRemoved = int(pstats.TxnsAlreadyRemoved)
 	stats.DocsCleaned = int(pstats.DocQueuesCleaned)
+	stats.DocsFiltered = int(pstats.DocsFiltered)
 	stats.StashDocumentsRemoved = int(pstats.StashDocsRemoved)
 	stats.DocsInspected = int(pstats.DocCacheMisses + pstats.DocCacheHits)
 	stats.CollectionsInspected = int(pstats.CollectionQueries)
+	stats.Pruner = pstats
+	stats.SkippedCollections = skippedCollections(stats.Collections)
+	stats.PassTimes = []time.Duration{time.Since(tStart)}
+	if len(errs) == 1 {
+		return stats, errs[0]
+	} else if len(errs) > 1 {
+		return stats, errs
+	}
+	pruneLogger.Infof("pruning removed %d txns and cleaned %d docs in %s.",
+		pstats.TxnsRemoved,
+		pstats.DocQueuesCleaned,
+		time.Since(tStart).Round(time.Millisecond))
+	pruneLogger.Debugf("%s", pstats)
 	return stats, nil
 }
 
-// getPruneLastTxnsCount will return how many documents were in 'txns' the
-// last time we pruned. It will return -1 if it cannot find a reliable value
-// (no value available, or corrupted document.)
-func getPruneLastTxnsCount(txnsPrune *mgo.Collection) (int, error) {
+// WorkerError records the failure of one of the pruners started by
+// CleanAndPrune, along with the range of transactions it had read.
+type WorkerError struct {
+	// Worker identifies the pruner, either "forward" or "reverse".
+	Worker string
+
+	// FirstTxnId and LastTxnId are the first and last transactions read by
+	// the pruner before it failed. They are empty if no transactions were
+	// read.
+	FirstTxnId bson.ObjectId
+	LastTxnId  bson.ObjectId
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *WorkerError) Error() string {
+	if e.FirstTxnId == "" {
+		return fmt.Sprintf("%s pruner: %v", e.Worker, e.Err)
+	}
+	return fmt.Sprintf("%s pruner (txns %s to %s): %v",
+		e.Worker, e.FirstTxnId.Hex(), e.LastTxnId.Hex(), e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *WorkerError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError holds all of the errors encountered by concurrent pruners.
+type MultiError []error
+
+func (m MultiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(m), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the individual errors.
+func (m MultiError) Unwrap() []error {
+	return m
+}
+
+// Is reports whether any of the errors matches target. errors.Is only
+// looks at Unwrap() []error from Go 1.20, so this makes it work with the
+// older versions we support too.
+func (m MultiError) Is(target error) bool {
+	for _, err := range m {
+		if stderrors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As sets target to the first of the errors that matches it, as
+// errors.As does. See Is.
+func (m MultiError) As(target interface{}) bool {
+	for _, err := range m {
+		if stderrors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorBudgetExceeded is returned by CleanAndPrune when more transient
+// errors occurred than CleanAndPruneArgs.ErrorBudget allows. The stats
+// returned with it cover the work done until then.
+type ErrorBudgetExceeded struct {
+	// Budget is how many errors were tolerated.
+	Budget int
+
+	// Errors are all of the errors that occurred, in order.
+	Errors []error
+}
+
+// Error summarises the errors, giving each distinct message once with the
+// number of times it occurred.
+func (e *ErrorBudgetExceeded) Error() string {
+	var order []string
+	counts := make(map[string]int)
+	for _, err := range e.Errors {
+		msg := err.Error()
+		if counts[msg] == 0 {
+			order = append(order, msg)
+		}
+		counts[msg]++
+	}
+	summary := make([]string, len(order))
+	for i, msg := range order {
+		summary[i] = msg
+		if counts[msg] > 1 {
+			summary[i] = fmt.Sprintf("%s (x%d)", msg, counts[msg])
+		}
+	}
+	return fmt.Sprintf("pruning stopped after %d errors (budget %d): %s",
+		len(e.Errors), e.Budget, strings.Join(summary, "; "))
+}
+
+// Unwrap returns the individual errors.
+func (e *ErrorBudgetExceeded) Unwrap() []error {
+	return e.Errors
+}
+
+// Is reports whether any of the errors matches target. See MultiError.Is.
+func (e *ErrorBudgetExceeded) Is(target error) bool {
+	return MultiError(e.Errors).Is(target)
+}
+
+// As sets target to the first of the errors that matches it. See
+// MultiError.As.
+func (e *ErrorBudgetExceeded) As(target interface{}) bool {
+	return MultiError(e.Errors).As(target)
+}
+
+// errorBudget tracks the transient errors tolerated by CleanAndPrune.
+type errorBudget struct {
+	errs []error
+}
+
+// charge records the errors of a failed pass. It returns nil if they are
+// all transient and within budget, so that pruning can carry on, and
+// otherwise the error to stop with.
+func (b *errorBudget) charge(err error, budget int) error {
+	errs := []error{err}
+	if multi, ok := err.(MultiError); ok {
+		errs = multi
+	}
+	for _, err := range errs {
+		if !isTransientPruneError(err) {
+			return err
+		}
+	}
+	if budget == 0 {
+		return err
+	}
+	b.errs = append(b.errs, errs...)
+	if len(b.errs) > budget {
+		return &ErrorBudgetExceeded{Budget: budget, Errors: b.errs}
+	}
+	return nil
+}
+
+// IsTransientPruneError returns true if CleanAndPrune failed only because
+// of errors that are likely to go away if pruning is tried again, such as
+// a lost connection or a change of primary.
+func IsTransientPruneError(err error) bool {
+	var errs []error
+	switch err := errors.Cause(err).(type) {
+	case MultiError:
+		errs = err
+	case *ErrorBudgetExceeded:
+		errs = err.Errors
+	default:
+		return isTransientPruneError(err)
+	}
+	for _, err := range errs {
+		if !isTransientPruneError(err) {
+			return false
+		}
+	}
+	return len(errs) > 0
+}
+
+// isTransientPruneError returns true if err is likely to go away if
+// pruning is tried again, such as a lost connection or a change of primary.
+func isTransientPruneError(err error) bool {
+	if workerErr, ok := err.(*WorkerError); ok {
+		err = workerErr.Err
+	}
+	err = errors.Cause(err)
+	if err == io.EOF || err == ErrTransientFailure {
+		return true
+	}
+	if mgo.IsRetryable(err) || mgo.IsNotPrimaryError(err) {
+		return true
+	}
+	var netErr net.Error
+	return stderrors.As(err, &netErr)
+}
+
+// CorruptPruneStatsWarning is reported in PruneResult.Warnings when a
+// document in txns.prune could not be decoded. The document is moved into
+// the txns.prune.quarantine collection and a prune is forced.
+type CorruptPruneStatsWarning struct {
+	// DocId is the _id of the corrupt document.
+	DocId interface{}
+
+	// Err is the error decoding the document.
+	Err error
+}
+
+func (w *CorruptPruneStatsWarning) Error() string {
+	return fmt.Sprintf("corrupt prune stats document %v quarantined: %v", w.DocId, w.Err)
+}
+
+// getPruneLastStats returns the stats recorded by the last prune, or nil if
+// there is no reliable record. If the record or the pointer to it cannot be
+// decoded, it is quarantined and a warning is returned along with a nil
+// record.
+func getPruneLastStats(txnsPrune *mgo.Collection) (*PruneRecord, *CorruptPruneStatsWarning, error) {
 	// Retrieve the doc which points to the latest stats entry.
-	var ptrDoc bson.M
-	err := txnsPrune.FindId("last").One(&ptrDoc)
+	var ptrRaw bson.Raw
+	err := txnsPrune.FindId("last").One(&ptrRaw)
 	if err == mgo.ErrNotFound {
-		return -1, nil
+		return nil, nil, nil
 	} else if err != nil {
-		return -1, fmt.Errorf("failed to load pruning stats pointer: %v", err)
+		return nil, nil, fmt.Errorf("failed to load pruning stats pointer: %v", err)
+	}
+	var ptrDoc struct {
+		Id bson.ObjectId `bson:"id"`
+	}
+	if err := ptrRaw.Unmarshal(&ptrDoc); err != nil || !ptrDoc.Id.Valid() {
+		if err == nil {
+			err = errors.New("pointer has no valid id")
+		}
+		return nil, quarantinePruneStats(txnsPrune, "last", ptrRaw, err), nil
 	}
 
 	// Get the stats.
-	var doc pruneStats
-	err = txnsPrune.FindId(ptrDoc["id"]).One(&doc)
+	var raw bson.Raw
+	err = txnsPrune.FindId(ptrDoc.Id).One(&raw)
 	if err == mgo.ErrNotFound {
-		// Pointer was broken. Recover by returning 0 which will force
+		// Pointer was broken. Recover by returning nil which will force
 		// pruning.
-		logger.Warningf("pruning stats pointer was broken - will recover")
-		return -1, nil
+		pruneLogger.Warningf("pruning stats pointer was broken - will recover")
+		return nil, nil, nil
 	} else if err != nil {
-		return -1, fmt.Errorf("failed to load pruning stats: %v", err)
+		return nil, nil, fmt.Errorf("failed to load pruning stats: %v", err)
+	}
+	var doc PruneRecord
+	if err := validatePruneRecord(raw); err != nil {
+		return nil, quarantinePruneStats(txnsPrune, ptrDoc.Id, raw, err), nil
+	}
+	if err := raw.Unmarshal(&doc); err != nil {
+		return nil, quarantinePruneStats(txnsPrune, ptrDoc.Id, raw, err), nil
 	}
-	return doc.TxnsAfter, nil
+	return &doc, nil, nil
 }
 
-func writePruneTxnsCount(
-	txnsPrune *mgo.Collection,
-	started, completed time.Time,
-	txnsBefore, txnsAfter,
-	stashBefore, stashAfter int,
-) error {
-	id := bson.NewObjectId()
-	err := txnsPrune.Insert(pruneStats{
-		Id:              id,
-		Started:         started,
-		Completed:       completed,
-		TxnsBefore:      txnsBefore,
-		TxnsAfter:       txnsAfter,
-		StashDocsBefore: stashBefore,
-		StashDocsAfter:  stashAfter,
+// pruneRecordKinds maps the fields of a PruneRecord document to the bson
+// kinds we accept for them.
+var pruneRecordKinds = map[string][]byte{
+	"_id":               {0x07},
+	"started":           {0x09},
+	"completed":         {0x09},
+	"txns-before":       {0x01, 0x10, 0x12},
+	"txns-after":        {0x01, 0x10, 0x12},
+	"stash-docs-before": {0x01, 0x10, 0x12},
+	"stash-docs-after":  {0x01, 0x10, 0x12},
+	"collections":       {0x04},
+	"version":           {0x01, 0x10, 0x12},
+	"pruner":            {0x03},
+	"pass-times":        {0x04},
+}
+
+// validatePruneRecord checks that the fields of a stored PruneRecord have
+// the expected types. This is needed because bson silently ignores fields
+// that can't be decoded into the target type.
+func validatePruneRecord(raw bson.Raw) error {
+	var elems bson.RawD
+	if err := raw.Unmarshal(&elems); err != nil {
+		return errors.Trace(err)
+	}
+	foundTxnsAfter := false
+	for _, elem := range elems {
+		kinds, ok := pruneRecordKinds[elem.Name]
+		if !ok {
+			continue
+		}
+		valid := false
+		for _, kind := range kinds {
+			if elem.Value.Kind == kind {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return errors.Errorf("field %q has unexpected bson kind 0x%02x", elem.Name, elem.Value.Kind)
+		}
+		if elem.Name == "txns-after" {
+			foundTxnsAfter = true
+		}
+	}
+	if !foundTxnsAfter {
+		return errors.New(`missing field "txns-after"`)
+	}
+	return nil
+}
+
+// quarantinePruneStats moves a corrupt document out of txns.prune so that
+// it doesn't cause problems for future prunes, and returns a warning
+// describing what happened.
+func quarantinePruneStats(txnsPrune *mgo.Collection, id interface{}, raw bson.Raw, decodeErr error) *CorruptPruneStatsWarning {
+	warning := &CorruptPruneStatsWarning{DocId: id, Err: decodeErr}
+	pruneLogger.Warningf("%v", warning)
+	quarantine := txnsPrune.Database.C(txnsPrune.Name + ".quarantine")
+	err := quarantine.Insert(bson.M{
+		"_id":         bson.NewObjectId(),
+		"original-id": id,
+		"doc":         raw,
+		"error":       decodeErr.Error(),
+		"quarantined": time.Now(),
 	})
+	if err != nil {
+		pruneLogger.Warningf("failed to quarantine prune stats document %v: %v", id, err)
+	}
+	if err := txnsPrune.RemoveId(id); err != nil && err != mgo.ErrNotFound {
+		pruneLogger.Warningf("failed to remove corrupt prune stats document %v: %v", id, err)
+	}
+	return warning
+}
+
+func writePruneTxnsCount(txnsPrune *mgo.Collection, record PruneRecord) error {
+	record.Id = bson.NewObjectId()
+	record.Version = pruneRecordVersion
+	err := txnsPrune.Insert(record)
 	if err != nil {
 		return fmt.Errorf("failed to write prune stats: %v", err)
 	}
 
 	// Set pointer to latest stats document.
-	_, err = txnsPrune.UpsertId("last", bson.M{"$set": bson.M{"id": id}})
+	_, err = txnsPrune.UpsertId("last", bson.M{"$set": bson.M{"id": record.Id}})
 	if err != nil {
 		return fmt.Errorf("failed to write prune stats pointer: %v", err)
 	}
 	return nil
 }
 
-func txnsPruneC(txnsName string) string {
-	return txnsName + ".prune"
+// PruneHistory returns the records written by previous prunes of the
+// txnsName collection, oldest first.
+func PruneHistory(db *mgo.Database, txnsName string) ([]PruneRecord, error) {
+	var records []PruneRecord
+	err := db.C(txnsPruneC(txnsName)).Find(pruneRecordMatch()).Sort("_id").All(&records)
+	if err != nil {
+		return nil, errors.Annotate(err, "reading prune history")
+	}
+	return records, nil
 }
 
-// txnCollections takes the list of all collections in a database and
-// filters them to just the ones that may have txn references.
-func txnCollections(inNames []string, txnsName string) []string {
-	// hasTxnReferences returns true if a collection may have
-	// references to txns.
-	hasTxnReferences := func(name string) bool {
-		switch {
-		case name == txnsName+".stash":
-			return true // Need to look in the stash.
-		case name == txnsName, strings.HasPrefix(name, txnsName+"."):
-			// The txns collection and its children shouldn't be considered.
-			return false
-		case name == "statuseshistory":
-			// statuseshistory is a special case that doesn't use txn and does get fairly big, so skip it
-			return false
-		case strings.HasPrefix(name, "system."):
-			// Don't look in system collections.
-			return false
-		default:
-			// Everything else needs to be considered.
-			return true
+// TrimPruneHistory removes old records from the prune history of the
+// txnsName collection. At most keep records are retained (0 for no limit)
+// and records completed more than maxAge ago are removed (0 for no limit).
+// The most recent record is always kept, as it is used to decide when to
+// prune next. If export is not nil it is passed the records before they
+// are removed, and nothing is removed if it returns an error.
+// It returns the number of records removed.
+func TrimPruneHistory(
+	db *mgo.Database,
+	txnsName string,
+	keep int,
+	maxAge time.Duration,
+	export func([]PruneRecord) error,
+) (int, error) {
+	return trimPruneHistory(db.C(txnsPruneC(txnsName)), keep, maxAge, export)
+}
+
+func trimPruneHistory(
+	txnsPrune *mgo.Collection,
+	keep int,
+	maxAge time.Duration,
+	export func([]PruneRecord) error,
+) (int, error) {
+	var ptrDoc struct {
+		Id bson.ObjectId `bson:"id"`
+	}
+	if err := txnsPrune.FindId("last").One(&ptrDoc); err != nil && err != mgo.ErrNotFound {
+		return 0, fmt.Errorf("failed to load pruning stats pointer: %v", err)
+	}
+	var cutoff time.Time
+	if maxAge > 0 {
+		cutoff = time.Now().Add(-maxAge)
+	}
+	var toRemove []PruneRecord
+	var record PruneRecord
+	iter := txnsPrune.Find(pruneRecordMatch()).Sort("-_id").Iter()
+	for i := 0; iter.Next(&record); i++ {
+		if record.Id == ptrDoc.Id {
+			continue
+		}
+		if (keep > 0 && i >= keep) || (!cutoff.IsZero() && record.Completed.Before(cutoff)) {
+			toRemove = append(toRemove, record)
 		}
 	}
-
-	outNames := make([]string, 0, len(inNames))
-	for _, name := range inNames {
-		if hasTxnReferences(name) {
-			outNames = append(outNames, name)
+	if err := iter.Close(); err != nil {
+		return 0, fmt.Errorf("failed to read prune history: %v", err)
+	}
+	if len(toRemove) == 0 {
+		return 0, nil
+	}
+	if export != nil {
+		if err := export(toRemove); err != nil {
+			return 0, errors.Annotate(err, "exporting prune history")
 		}
 	}
-	return outNames
+	ids := make([]bson.ObjectId, len(toRemove))
+	for i, record := range toRemove {
+		ids[i] = record.Id
+	}
+	info, err := txnsPrune.RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to trim prune history: %v", err)
+	}
+	pruneLogger.Debugf("trimmed %d prune history records", info.Removed)
+	return info.Removed, nil
 }
 
-func txnTokenToId(token string) bson.ObjectId {
-	// mgo/txn transaction tokens are the 24 character txn id
-	// followed by "_<nonce>"
-	return bson.ObjectIdHex(token[:24])
+// pruneRecordMatch matches the PruneRecord documents in txns.prune,
+// skipping the "last" pointer document.
+func pruneRecordMatch() bson.M {
+	return bson.M{"_id": bson.M{"$type": "objectId"}}
 }
 
-func newBatchRemover(coll *mgo.Collection) *batchRemover {
+func txnsPruneC(txnsName string) string {
+	return txnsName + ".prune"
+}
+
+// hasTxnReferences returns true if a collection may have references to
+// txns from the txnsName collection.
+func hasTxnReferences(name, txnsName string) bool {
+	switch {
+	case name == txnsName+".stash":
+		return true // Need to look in the stash.
+	case name == txnsName, strings.HasPrefix(name, txnsName+"."):
+		// The txns collection and its children shouldn't be considered.
+		return false
+	case name == "statuseshistory":
+		// statuseshistory is a special case that doesn't use txn and does get fairly big, so skip it
+		return false
+	case strings.HasPrefix(name, "system."):
+		// Don't look in system collections.
+		return false
+	case strings.HasSuffix(name, trashSuffix):
+		// Soft deleted documents are no longer part of any transaction.
+		return false
+	default:
+		// Everything else needs to be considered.
+		return true
+	}
+}
+
+// TxnToken is a parsed mgo/txn transaction token, as found in txn-queue.
+type TxnToken = token.Token
+
+// ParseToken parses a token from a txn-queue, which is the 24 character
+// id of a transaction followed by "_<nonce>". It returns a
+// *token.InvalidTokenError if the token is malformed, eg if it was
+// truncated.
+func ParseToken(s string) (TxnToken, error) {
+	return token.Parse(s)
+}
+
+// RemoveChunking selects how a batch of removals is split up into
+// separate remove filters.
+type RemoveChunking int
+
+const (
+	// ChunkRemovesByCount puts up to 1000 ids in each $in filter.
+	ChunkRemovesByCount RemoveChunking = iota
+
+	// ChunkRemovesBySize also limits the encoded size of the ids in each
+	// $in filter, so that large ids (eg stash ids, which include the
+	// collection name, or composite ids) can't make the filter exceed the
+	// maximum BSON document size.
+	ChunkRemovesBySize
+)
+
+// defaultMaxRemoveFilterBytes is the default limit on the encoded size of
+// the ids in a remove filter when chunking by size. It is well under the
+// 16MiB BSON limit, as servers also add their own overhead to the query.
+const defaultMaxRemoveFilterBytes = 1024 * 1024
+
+// NewRemover returns a Remover that removes documents from coll with
+// the given strategy. See DeleteStrategy.
+func NewRemover(coll *mgo.Collection, strategy DeleteStrategy) Remover {
+	return newBatchRemover(coll, ChunkRemovesByCount, 0, strategy)
+}
+
+func newBatchRemover(coll *mgo.Collection, chunking RemoveChunking, maxBytes int, strategy DeleteStrategy) *batchRemover {
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxRemoveFilterBytes
+	}
 	return &batchRemover{
-		coll: coll,
+		coll:     coll,
+		chunking: chunking,
+		maxBytes: maxBytes,
+		strategy: strategy,
 	}
 }
 
+// Remover removes documents from a collection, batching the removals.
 type Remover interface {
+	// Remove queues the document with the given id to be removed,
+	// removing the queued documents if the batch is full.
 	Remove(id interface{}) error
+
+	// Flush removes the queued documents. If it fails, the documents
+	// stay queued, so Flush can be called again to retry. Flushing an
+	// empty queue does nothing.
 	Flush() error
+
+	// Abort discards the queued documents without removing them. It is
+	// used when removals are abandoned part way, so that they are neither
+	// made later nor counted by Removed.
+	Abort()
+
+	// Removed returns how many documents have been removed.
 	Removed() int
 }
 
 type batchRemover struct {
-	coll    *mgo.Collection
-	queue   []interface{}
-	removed int
+	coll       *mgo.Collection
+	chunking   RemoveChunking
+	maxBytes   int
+	strategy   DeleteStrategy
+	queue      []interface{}
+	queueBytes int
+	removed    int
 }
 
 var _ Remover = (*batchRemover)(nil)
 
 func (r *batchRemover) Remove(id interface{}) error {
+	if r.chunking == ChunkRemovesBySize {
+		size, err := encodedIdSize(id)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		// An id that is bigger than the limit on its own still gets
+		// removed, in a filter by itself.
+		if len(r.queue) > 0 && r.queueBytes+size > r.maxBytes {
+			if err := r.Flush(); err != nil {
+				// Queue the id anyway, so that it isn't lost if
+				// Flush is retried.
+				r.queue = append(r.queue, id)
+				r.queueBytes += size
+				return err
+			}
+		}
+		r.queueBytes += size
+	}
 	r.queue = append(r.queue, id)
 	if len(r.queue) >= maxBulkOps {
 		return r.Flush()
@@ -488,19 +1600,34 @@ func (r *batchRemover) Flush() error {
 	if len(r.queue) < 1 {
 		return nil // Nothing to do
 	}
-	filter := bson.M{"_id": bson.M{"$in": r.queue}}
-	switch result, err := r.coll.RemoveAll(filter); err {
+	switch removed, err := r.strategy.remove(r.coll, r.queue); err {
 	case nil, mgo.ErrNotFound:
 		// It's OK for txns to no longer exist. Another process
 		// may have concurrently pruned them.
-		r.removed += result.Removed
+		r.removed += removed
 		r.queue = r.queue[:0]
+		r.queueBytes = 0
 		return nil
 	default:
 		return err
 	}
 }
 
+// encodedIdSize returns an upper bound on the number of bytes id adds to
+// an $in array.
+func encodedIdSize(id interface{}) (int, error) {
+	data, err := bson.Marshal(bson.D{{"_id", id}})
+	if err != nil {
+		return 0, errors.Annotatef(err, "encoding id %v", id)
+	}
+	return len(data), nil
+}
+
+func (r *batchRemover) Abort() {
+	r.queue = r.queue[:0]
+	r.queueBytes = 0
+}
+
 func (r *batchRemover) Removed() int {
 	return r.removed
 }
@@ -521,8 +1648,7 @@ type bulkRemover struct {
 var _ Remover = (*bulkRemover)(nil)
 
 func (r *bulkRemover) newChunk() {
-	r.chunk = r.coll.Bulk()
-	r.chunk.Unordered()
+	r.chunk = newBulk(r.coll)
 	r.chunkSize = 0
 }
 
@@ -553,6 +1679,10 @@ func (r *bulkRemover) Flush() error {
 	}
 }
 
+func (r *bulkRemover) Abort() {
+	r.newChunk()
+}
+
 func (r *bulkRemover) Removed() int {
 	return r.removed
 }
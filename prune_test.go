@@ -4,12 +4,20 @@
 package txn_test
 
 import (
+	"bytes"
+	stderrors "errors"
+	"io"
+	"net"
 	"time"
 
 	"github.com/juju/clock/testclock"
+	"github.com/juju/errors"
 	"github.com/juju/loggo"
+	"github.com/juju/mgo/v3"
 	"github.com/juju/mgo/v3/bson"
+	mgotesting "github.com/juju/mgo/v3/testing"
 	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 
@@ -27,14 +35,17 @@ func (s *PruneSuite) maybePrune(c *gc.C, pruneFactor float32) {
 	s.maybePruneWithTimestamp(c, pruneFactor, time.Time{})
 }
 
-func (s *PruneSuite) maybePruneWithTimestamp(c *gc.C, pruneFactor float32, timestamp time.Time) {
-	r := jujutxn.NewRunner(jujutxn.RunnerParams{
+func (s *PruneSuite) txnRunner() jujutxn.Runner {
+	return jujutxn.NewRunner(jujutxn.RunnerParams{
 		Database:                  s.db,
 		TransactionCollectionName: s.txns.Name,
 		ChangeLogName:             s.txns.Name + ".log",
 		Clock:                     testclock.NewClock(time.Now()),
 	})
-	err := r.MaybePruneTransactions(jujutxn.PruneOptions{
+}
+
+func (s *PruneSuite) maybePruneWithTimestamp(c *gc.C, pruneFactor float32, timestamp time.Time) {
+	err := s.txnRunner().MaybePruneTransactions(jujutxn.PruneOptions{
 		PruneFactor:                pruneFactor,
 		MinNewTransactions:         1,
 		MaxNewTransactions:         1000,
@@ -484,6 +495,398 @@ func (s *PruneSuite) TestPruningStatsBrokenLastPointer(c *gc.C) {
 		[]jc.SimpleMessage{{loggo.WARNING, `pruning stats pointer was broken .+`}})
 }
 
+func (s *PruneSuite) TestPruningStatsRecordCollections(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 5)
+	s.maybePrune(c, 2.0)
+
+	txnsPrune := s.db.C("txns.prune")
+	var ptr bson.M
+	c.Assert(txnsPrune.FindId("last").One(&ptr), jc.ErrorIsNil)
+	var doc struct {
+		Collections []jujutxn.CollectionPruneStats `bson:"collections"`
+	}
+	c.Assert(txnsPrune.FindId(ptr["id"]).One(&doc), jc.ErrorIsNil)
+	c.Assert(doc.Collections, gc.HasLen, 1)
+	c.Check(doc.Collections[0].Name, gc.Equals, "coll")
+	c.Check(doc.Collections[0].DocsRead, gc.Equals, int64(1))
+	c.Check(doc.Collections[0].DocsCleaned, gc.Equals, int64(1))
+	c.Check(doc.Collections[0].TokensCleaned, gc.Equals, int64(5))
+}
+
+func (s *PruneSuite) TestPruningStatsRecordPrunerStats(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 5)
+	s.maybePrune(c, 2.0)
+
+	txnsPrune := s.db.C("txns.prune")
+	var ptr bson.M
+	c.Assert(txnsPrune.FindId("last").One(&ptr), jc.ErrorIsNil)
+	var record jujutxn.PruneRecord
+	c.Assert(txnsPrune.FindId(ptr["id"]).One(&record), jc.ErrorIsNil)
+	c.Check(record.Version, gc.Equals, 2)
+	c.Assert(record.Pruner, gc.NotNil)
+	c.Check(record.Pruner.TxnsRemoved, gc.Equals, int64(5))
+	c.Check(record.Pruner.DocQueuesCleaned, gc.Equals, int64(1))
+	c.Check(record.Pruner.DocTokensCleaned, gc.Equals, int64(5))
+	c.Check(record.PassTimes, gc.HasLen, 1)
+}
+
+func (s *PruneSuite) TestPruningStatsVersion1Record(c *gc.C) {
+	// Records written before the schema was versioned are still read.
+	id := bson.NewObjectId()
+	txnsPrune := s.db.C("txns.prune")
+	err := txnsPrune.Insert(bson.M{
+		"_id":         id,
+		"started":     time.Now().Add(-time.Minute),
+		"completed":   time.Now(),
+		"txns-before": 10,
+		"txns-after":  5,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(txnsPrune.Insert(bson.M{"_id": "last", "id": id}), jc.ErrorIsNil)
+	history, err := jujutxn.PruneHistory(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.HasLen, 1)
+	c.Check(history[0].Version, gc.Equals, 0)
+	c.Check(history[0].TxnsAfter, gc.Equals, 5)
+	c.Check(history[0].Pruner, gc.IsNil)
+	// The record is used to decide whether to prune.
+	result, err := jujutxn.MaybePrune(s.db, "txns", jujutxn.PruneOptions{PruneFactor: 2.0})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.Pruned, jc.IsFalse)
+	c.Check(result.Warnings, gc.HasLen, 0)
+}
+
+func (s *PruneSuite) TestCleanAndPruneSinglePassShouldRetry(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 25)
+	s.assertCollCount(c, "txns", 25)
+
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:                     s.txns,
+		MaxTransactionsToProcess: 10,
+		TxnBatchSize:             10,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.ShouldRetry, jc.IsTrue)
+	c.Check(stats.Passes, gc.Equals, 1)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 10)
+	s.assertCollCount(c, "txns", 15)
+}
+
+func (s *PruneSuite) TestCleanAndPruneRetriesUntilDone(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 25)
+	s.assertCollCount(c, "txns", 25)
+
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:                     s.txns,
+		MaxTransactionsToProcess: 10,
+		TxnBatchSize:             10,
+		MaxPasses:                10,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.ShouldRetry, jc.IsFalse)
+	c.Check(stats.Passes, gc.Equals, 3)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 25)
+	s.assertCollCount(c, "txns", 0)
+}
+
+func (s *PruneSuite) TestCleanDocQueuesThenPruneTxns(c *gc.C) {
+	txnId := s.runTxn(c, txn.Op{C: "coll", Id: "a", Insert: bson.M{}})
+
+	// The txn can't be removed while its token is in the document.
+	stats, err := jujutxn.PruneTxns(jujutxn.CleanAndPruneArgs{Txns: s.txns})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 0)
+	c.Check(stats.DocsCleaned, gc.Equals, 0)
+	c.Check(stats.Pruner.TxnsNotRemoved, gc.Equals, int64(1))
+	s.assertDocQueue(c, "coll", "a", txnId)
+	s.assertCollCount(c, "txns", 1)
+
+	stats, err = jujutxn.CleanDocQueues(jujutxn.CleanAndPruneArgs{Txns: s.txns})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 0)
+	c.Check(stats.DocsCleaned, gc.Equals, 1)
+	c.Check(stats.Checkpoint, gc.Equals, txnId)
+	s.assertDocQueue(c, "coll", "a")
+	s.assertCollCount(c, "txns", 1)
+
+	stats, err = jujutxn.PruneTxns(jujutxn.CleanAndPruneArgs{Txns: s.txns})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 1)
+	c.Check(stats.DocsCleaned, gc.Equals, 0)
+	s.assertCollCount(c, "txns", 0)
+}
+
+func (s *PruneSuite) TestCleanDocQueuesStartAfter(c *gc.C) {
+	first := s.runTxn(c, txn.Op{C: "coll", Id: "a", Insert: bson.M{}})
+	stats, err := jujutxn.CleanDocQueues(jujutxn.CleanAndPruneArgs{Txns: s.txns})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.Checkpoint, gc.Equals, first)
+
+	second := s.runTxn(c, txn.Op{C: "coll", Id: "b", Insert: bson.M{}})
+	stats, err = jujutxn.CleanDocQueues(jujutxn.CleanAndPruneArgs{
+		Txns:       s.txns,
+		StartAfter: stats.Checkpoint,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.DocsCleaned, gc.Equals, 1)
+	c.Check(stats.Checkpoint, gc.Equals, second)
+	s.assertDocQueue(c, "coll", "b")
+	s.assertCollCount(c, "txns", 2)
+}
+
+func (s *PruneSuite) TestCleanDocQueuesPassesCarryOn(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 25)
+
+	stats, err := jujutxn.CleanDocQueues(jujutxn.CleanAndPruneArgs{
+		Txns:                     s.txns,
+		MaxTransactionsToProcess: 10,
+		TxnBatchSize:             10,
+		MaxPasses:                10,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.ShouldRetry, jc.IsFalse)
+	c.Check(stats.Passes, gc.Equals, 3)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 0)
+	s.assertCollCount(c, "txns", 25)
+}
+
+func (s *PruneSuite) TestStartCleanAndPrune(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 25)
+
+	job, err := jujutxn.StartCleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:                     s.txns,
+		MaxTransactionsToProcess: 10,
+		TxnBatchSize:             10,
+		MaxPasses:                10,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	select {
+	case <-job.Done():
+	case <-time.After(testing.LongWait):
+		c.Fatalf("pruning did not finish")
+	}
+	c.Assert(job.Err(), jc.ErrorIsNil)
+	c.Check(job.Stats().TransactionsRemoved, gc.Equals, 25)
+	c.Check(job.Status().State, gc.Equals, jujutxn.PruneJobDone)
+	s.assertCollCount(c, "txns", 0)
+}
+
+func (s *PruneSuite) TestStartCleanAndPruneInvalidArgs(c *gc.C) {
+	job, err := jujutxn.StartCleanAndPrune(jujutxn.CleanAndPruneArgs{})
+	c.Assert(err, gc.ErrorMatches, "nil Txns not valid")
+	c.Check(job, gc.IsNil)
+}
+
+func (s *PruneSuite) setActivePruner(c *gc.C, heartbeat time.Time) {
+	_, err := s.db.C("txns.prune").UpsertId("active", bson.M{"$set": bson.M{
+		"owner":     "other",
+		"heartbeat": heartbeat,
+	}})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *PruneSuite) TestCleanAndPruneReleasesLock(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 5)
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{Txns: s.txns})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.ConcurrentPrune, gc.Equals, jujutxn.ConcurrentPruneMode(""))
+	c.Check(stats.TransactionsRemoved, gc.Equals, 5)
+	count, err := s.db.C("txns.prune").FindId("active").Count()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(count, gc.Equals, 0)
+}
+
+func (s *PruneSuite) TestCleanAndPruneSkipsWhenAnotherIsPruning(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 5)
+	s.setActivePruner(c, time.Now())
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:            s.txns,
+		ConcurrentPrune: jujutxn.ConcurrentPruneSkip,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.ConcurrentPrune, gc.Equals, jujutxn.ConcurrentPruneSkip)
+	c.Check(stats.Passes, gc.Equals, 0)
+	s.assertCollCount(c, "txns", 5)
+}
+
+func (s *PruneSuite) TestCleanAndPruneJoinsAnotherPruner(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 5)
+	s.setActivePruner(c, time.Now())
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:            s.txns,
+		ConcurrentPrune: jujutxn.ConcurrentPruneJoin,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.ConcurrentPrune, gc.Equals, jujutxn.ConcurrentPruneJoin)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 5)
+	// The other pruner still holds the lock.
+	var doc bson.M
+	c.Assert(s.db.C("txns.prune").FindId("active").One(&doc), jc.ErrorIsNil)
+	c.Check(doc["owner"], gc.Equals, "other")
+}
+
+func (s *PruneSuite) TestCleanAndPruneWaitsForAnotherPruner(c *gc.C) {
+	restore := jujutxn.SetPruneLockTimings(200*time.Millisecond, 10*time.Millisecond)
+	defer restore()
+	s.makeTxnsForNewDoc(c, 5)
+	s.setActivePruner(c, time.Now())
+	start := time.Now()
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:            s.txns,
+		ConcurrentPrune: jujutxn.ConcurrentPruneWait,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	// We waited for the other pruner's heartbeat to go stale.
+	c.Check(time.Since(start) >= 200*time.Millisecond, jc.IsTrue)
+	c.Check(stats.ConcurrentPrune, gc.Equals, jujutxn.ConcurrentPruneWait)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 5)
+}
+
+func (s *PruneSuite) TestCleanAndPruneTakesOverStaleLock(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 5)
+	s.setActivePruner(c, time.Now().Add(-time.Hour))
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:            s.txns,
+		ConcurrentPrune: jujutxn.ConcurrentPruneSkip,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.ConcurrentPrune, gc.Equals, jujutxn.ConcurrentPruneMode(""))
+	c.Check(stats.TransactionsRemoved, gc.Equals, 5)
+}
+
+func (s *PruneSuite) TestCleanAndPruneInvalidConcurrentMode(c *gc.C) {
+	_, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:            s.txns,
+		ConcurrentPrune: "share",
+	})
+	c.Assert(err, gc.ErrorMatches, `unknown ConcurrentPrune mode "share"`)
+}
+
+func (s *PruneSuite) TestCleanAndPruneStopsAtMaxPasses(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 25)
+
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:                     s.txns,
+		MaxTransactionsToProcess: 10,
+		TxnBatchSize:             10,
+		MaxPasses:                2,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.ShouldRetry, jc.IsTrue)
+	c.Check(stats.Passes, gc.Equals, 2)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 20)
+	s.assertCollCount(c, "txns", 5)
+}
+
+func (s *PruneSuite) TestMaybePruneMakesPassesUpToMaxBatches(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 10)
+
+	// MaxBatchTransactions limits the size of each pass, and further
+	// passes are only made when MaxBatches asks for them.
+	r := jujutxn.NewRunner(jujutxn.RunnerParams{Database: s.db})
+	err := r.MaybePruneTransactions(jujutxn.PruneOptions{
+		PruneFactor:          2.0,
+		MinNewTransactions:   1,
+		MaxBatchTransactions: 3,
+		MaxBatches:           10,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	s.assertCollCount(c, "txns", 0)
+}
+
+func (s *PruneSuite) TestPruneHistoryTrimmedByCount(c *gc.C) {
+	var exported []jujutxn.PruneRecord
+	for i := 0; i < 4; i++ {
+		s.makeTxnsForNewDoc(c, 5)
+		err := s.txnRunner().MaybePruneTransactions(jujutxn.PruneOptions{
+			PruneFactor:        1,
+			MinNewTransactions: 1,
+			MaxPruneHistory:    2,
+			PruneHistoryExporter: func(records []jujutxn.PruneRecord) error {
+				exported = append(exported, records...)
+				return nil
+			},
+		})
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	s.assertPruneStatCount(c, 2)
+	c.Check(exported, gc.HasLen, 2)
+
+	history, err := jujutxn.PruneHistory(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(history, gc.HasLen, 2)
+	c.Check(history[0].Id < history[1].Id, jc.IsTrue)
+	c.Check(exported[0].Id < history[0].Id, jc.IsTrue)
+}
+
+func (s *PruneSuite) TestTrimPruneHistoryKeepsLast(c *gc.C) {
+	s.maybePrune(c, 2.0)
+	s.assertPruneStatCount(c, 1)
+
+	removed, err := jujutxn.TrimPruneHistory(s.db, "txns", 0, time.Nanosecond, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(removed, gc.Equals, 0)
+	s.assertPruneStatCount(c, 1)
+}
+
+func (s *PruneSuite) TestTrimPruneHistoryExportFailureKeepsRecords(c *gc.C) {
+	s.maybePrune(c, 2.0)
+	s.makeTxnsForNewDoc(c, 5)
+	s.maybePrune(c, 2.0)
+	s.assertPruneStatCount(c, 2)
+
+	_, err := jujutxn.TrimPruneHistory(s.db, "txns", 1, 0, func([]jujutxn.PruneRecord) error {
+		return errors.New("disk full")
+	})
+	c.Assert(err, gc.ErrorMatches, "exporting prune history: disk full")
+	s.assertPruneStatCount(c, 2)
+}
+
+func (s *PruneSuite) TestPruningStatsCorruptRecordQuarantined(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 10)
+	id := bson.NewObjectId()
+	err := s.db.C("txns.prune").Insert(bson.M{
+		"_id":        id,
+		"txns-after": "not a number",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.db.C("txns.prune").Insert(bson.M{"_id": "last", "id": id})
+	c.Assert(err, jc.ErrorIsNil)
+
+	result, err := jujutxn.MaybePrune(s.db, "txns", jujutxn.PruneOptions{
+		PruneFactor:        2.0,
+		MinNewTransactions: 1,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.Pruned, jc.IsTrue)
+	c.Assert(result.Warnings, gc.HasLen, 1)
+	warning, ok := result.Warnings[0].(*jujutxn.CorruptPruneStatsWarning)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(warning.DocId, gc.Equals, id)
+
+	s.assertCollCount(c, "txns", 0)
+	s.assertCollCount(c, "txns.prune.quarantine", 1)
+	s.assertLastPruneStats(c, 10, 0)
+	s.assertPruneStatCount(c, 1)
+}
+
+func (s *PruneSuite) TestPruningStatsCorruptPointerQuarantined(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 10)
+	err := s.db.C("txns.prune").Insert(bson.M{"_id": "last", "id": 1234})
+	c.Assert(err, jc.ErrorIsNil)
+
+	result, err := jujutxn.MaybePrune(s.db, "txns", jujutxn.PruneOptions{
+		PruneFactor:        2.0,
+		MinNewTransactions: 1,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.Pruned, jc.IsTrue)
+	c.Assert(result.Warnings, gc.HasLen, 1)
+	c.Check(result.Warnings[0], gc.ErrorMatches, `corrupt prune stats document last quarantined: .*`)
+	s.assertCollCount(c, "txns.prune.quarantine", 1)
+	s.assertLastPruneStats(c, 10, 0)
+}
+
 func (s *PruneSuite) makeTxnsForNewDoc(c *gc.C, count int) {
 	id := bson.NewObjectId()
 	s.runTxn(c, txn.Op{
@@ -547,3 +950,192 @@ func (s *PruneSuite) assertPruneStatCount(c *gc.C, expected int) {
 func assertTimeIsRecent(c *gc.C, t time.Time) {
 	c.Assert(time.Now().Sub(t), jc.LessThan, time.Hour)
 }
+
+type WorkerErrorSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&WorkerErrorSuite{})
+
+func (*WorkerErrorSuite) TestWorkerErrorIncludesRange(c *gc.C) {
+	first := bson.ObjectIdHex("5c0000000000000000000001")
+	last := bson.ObjectIdHex("5c0000000000000000000002")
+	err := &jujutxn.WorkerError{
+		Worker:     "reverse",
+		FirstTxnId: first,
+		LastTxnId:  last,
+		Err:        errors.New("boom"),
+	}
+	c.Check(err, gc.ErrorMatches,
+		`reverse pruner \(txns 5c0000000000000000000001 to 5c0000000000000000000002\): boom`)
+}
+
+func (*WorkerErrorSuite) TestMultiErrorIncludesAll(c *gc.C) {
+	cause := errors.New("cause")
+	err := jujutxn.MultiError{
+		&jujutxn.WorkerError{Worker: "forward", Err: cause},
+		&jujutxn.WorkerError{Worker: "reverse", Err: errors.New("other")},
+	}
+	c.Check(err, gc.ErrorMatches,
+		`2 errors occurred: forward pruner: cause; reverse pruner: other`)
+	c.Check(stderrors.Is(err[0], cause), jc.IsTrue)
+}
+
+func (*WorkerErrorSuite) TestMultiErrorIsAs(c *gc.C) {
+	cause := errors.New("cause")
+	err := errors.Trace(jujutxn.MultiError{
+		io.EOF,
+		&jujutxn.WorkerError{Worker: "reverse", Err: cause},
+	})
+	c.Check(stderrors.Is(err, io.EOF), jc.IsTrue)
+	c.Check(stderrors.Is(err, cause), jc.IsTrue)
+	c.Check(stderrors.Is(err, io.ErrUnexpectedEOF), jc.IsFalse)
+	var workerErr *jujutxn.WorkerError
+	c.Assert(stderrors.As(err, &workerErr), jc.IsTrue)
+	c.Check(workerErr.Worker, gc.Equals, "reverse")
+	var budgetErr *jujutxn.ErrorBudgetExceeded
+	c.Check(stderrors.As(err, &budgetErr), jc.IsFalse)
+}
+
+func (*WorkerErrorSuite) TestIsTransientPruneError(c *gc.C) {
+	c.Check(jujutxn.IsTransientPruneError(io.EOF), jc.IsTrue)
+	c.Check(jujutxn.IsTransientPruneError(errors.Trace(io.EOF)), jc.IsTrue)
+	c.Check(jujutxn.IsTransientPruneError(&mgo.QueryError{Code: 11602}), jc.IsTrue)
+	c.Check(jujutxn.IsTransientPruneError(&net.OpError{Op: "read", Err: errors.New("reset")}), jc.IsTrue)
+	c.Check(jujutxn.IsTransientPruneError(&jujutxn.WorkerError{Worker: "forward", Err: io.EOF}), jc.IsTrue)
+	c.Check(jujutxn.IsTransientPruneError(errors.New("boom")), jc.IsFalse)
+	c.Check(jujutxn.IsTransientPruneError(&mgo.QueryError{Code: 2}), jc.IsFalse)
+
+	c.Check(jujutxn.IsTransientPruneError(errors.Trace(jujutxn.MultiError{
+		&jujutxn.WorkerError{Worker: "forward", Err: io.EOF},
+		&jujutxn.WorkerError{Worker: "reverse", Err: io.EOF},
+	})), jc.IsTrue)
+	c.Check(jujutxn.IsTransientPruneError(jujutxn.MultiError{
+		&jujutxn.WorkerError{Worker: "forward", Err: io.EOF},
+		&jujutxn.WorkerError{Worker: "reverse", Err: errors.New("boom")},
+	}), jc.IsFalse)
+	c.Check(jujutxn.IsTransientPruneError(&jujutxn.ErrorBudgetExceeded{
+		Budget: 1,
+		Errors: []error{io.EOF, io.EOF},
+	}), jc.IsTrue)
+}
+
+func (*WorkerErrorSuite) TestErrorBudget(c *gc.C) {
+	var budget jujutxn.ErrorBudget
+	transient := &jujutxn.WorkerError{Worker: "forward", Err: io.EOF}
+	c.Check(budget.Charge(transient, 3), jc.ErrorIsNil)
+	c.Check(budget.Charge(jujutxn.MultiError{transient, transient}, 3), jc.ErrorIsNil)
+	err := budget.Charge(transient, 3)
+	c.Assert(err, gc.FitsTypeOf, &jujutxn.ErrorBudgetExceeded{})
+	c.Check(err.(*jujutxn.ErrorBudgetExceeded).Errors, gc.HasLen, 4)
+	c.Check(err, gc.ErrorMatches, `pruning stopped after 4 errors \(budget 3\): forward pruner: EOF \(x4\)`)
+	c.Check(stderrors.Is(err, io.EOF), jc.IsTrue)
+}
+
+func (*WorkerErrorSuite) TestErrorBudgetStopsOnOtherErrors(c *gc.C) {
+	var budget jujutxn.ErrorBudget
+	other := errors.New("boom")
+	c.Check(budget.Charge(other, 3), gc.Equals, other)
+	multi := jujutxn.MultiError{io.EOF, other}
+	c.Check(budget.Charge(multi, 3), gc.Equals, other)
+	// Without a budget, nothing is tolerated.
+	c.Check(budget.Charge(io.EOF, 0), gc.Equals, io.EOF)
+}
+
+func (s *PruneSuite) TestCleanAndPruneArchivesTxns(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 5)
+	var ids []bson.ObjectId
+	c.Assert(s.txns.Find(nil).Distinct("_id", &ids), jc.ErrorIsNil)
+
+	var buf bytes.Buffer
+	archive, err := jujutxn.NewArchiveWriter(&buf, jujutxn.ArchiveOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:    s.txns,
+		Archive: archive,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(archive.Close(), jc.ErrorIsNil)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 5)
+	s.assertCollCount(c, "txns", 0)
+
+	r, err := jujutxn.NewArchiveReader(&buf)
+	c.Assert(err, jc.ErrorIsNil)
+	var archived []bson.ObjectId
+	var raw bson.Raw
+	for r.Next(&raw) {
+		doc, err := jujutxn.DecodeTxn(raw)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(doc.State, gc.Equals, jujutxn.TxnApplied)
+		archived = append(archived, doc.Id)
+	}
+	c.Assert(r.Err(), jc.ErrorIsNil)
+	c.Check(archived, jc.SameContents, ids)
+}
+
+func (s *PruneSuite) TestCleanAndPruneMetadataFilter(c *gc.C) {
+	run := func(id string, metadata jujutxn.TxnMetadata) bson.ObjectId {
+		txnId := bson.NewObjectId()
+		err := s.runner.Run([]txn.Op{{
+			C:      "coll",
+			Id:     id,
+			Insert: bson.M{},
+		}}, txnId, metadata)
+		c.Assert(err, jc.ErrorIsNil)
+		return txnId
+	}
+	run("a", jujutxn.TxnMetadata{ModelUUID: "dead-model", Caller: "x"})
+	run("b", jujutxn.TxnMetadata{ModelUUID: "dead-model", Caller: "y"})
+	kept := []bson.ObjectId{
+		run("c", jujutxn.TxnMetadata{ModelUUID: "live-model"}),
+		s.runTxn(c, txn.Op{C: "coll", Id: "d", Insert: bson.M{}}),
+	}
+
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:           s.txns,
+		MetadataFilter: jujutxn.TxnMetadata{ModelUUID: "dead-model"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 2)
+	var remaining []bson.ObjectId
+	c.Assert(s.txns.Find(nil).Distinct("_id", &remaining), jc.ErrorIsNil)
+	c.Check(remaining, jc.SameContents, kept)
+}
+
+func (s *PruneSuite) TestCleanAndPruneReadWholeDocuments(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 5)
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:               s.txns,
+		ReadWholeDocuments: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 5)
+	s.assertCollCount(c, "txns", 0)
+}
+
+func (s *PruneSuite) TestCleanAndPruneDedicatedSession(c *gc.C) {
+	s.makeTxnsForNewDoc(c, 5)
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:          s.txns,
+		DialInfo:      mgotesting.MgoServer.DialInfo(),
+		SessionMode:   jujutxn.PruneSessionStrong,
+		SyncTimeout:   time.Minute,
+		SocketTimeout: time.Minute,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TransactionsRemoved, gc.Equals, 5)
+	s.assertCollCount(c, "txns", 0)
+}
+
+func (s *PruneSuite) TestCleanAndPruneInvalidSessionArgs(c *gc.C) {
+	_, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:        s.txns,
+		SessionMode: "eventual",
+	})
+	c.Check(err, gc.ErrorMatches, `unknown SessionMode "eventual"`)
+	_, err = jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:        s.txns,
+		SyncTimeout: -time.Second,
+	})
+	c.Check(err, gc.ErrorMatches, `SyncTimeout \(-1s\) must not be negative`)
+}
@@ -0,0 +1,118 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const (
+	// profileLabelPhase and profileLabelCollection are the pprof labels
+	// set while pruning with ProfileLabels.
+	profileLabelPhase      = "txn-prune-phase"
+	profileLabelCollection = "txn-prune-collection"
+
+	// maxBatchProfiles is the most CPU profiles written by one call to
+	// Prune with StartCPUProfileOnSlowBatch.
+	maxBatchProfiles = 3
+)
+
+// batchProfile is a CPU profile being taken of a batch.
+type batchProfile struct {
+	file  *os.File
+	batch int
+}
+
+// setProfileLabels labels the goroutine with phase and collection, so
+// that CPU profiles attribute the time spent to them. Goroutines started
+// by the pruner inherit the labels.
+func (p *IncrementalPruner) setProfileLabels(phase PrunePhase, collection string) {
+	if !p.profileLabels {
+		return
+	}
+	labels := []string{profileLabelPhase, string(phase)}
+	if collection != "" {
+		labels = append(labels, profileLabelCollection, collection)
+	}
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels(labels...)))
+}
+
+// clearProfileLabels removes the labels set by setProfileLabels.
+func (p *IncrementalPruner) clearProfileLabels() {
+	if p.profileLabels {
+		pprof.SetGoroutineLabels(context.Background())
+	}
+}
+
+// profileSlowBatch is called after each batch, with how long it took. It
+// stops any profile taken of the batch, and starts a profile of the next
+// batch if this one took longer than StartCPUProfileOnSlowBatch.
+func (p *IncrementalPruner) profileSlowBatch(elapsed time.Duration) {
+	if p.slowBatch <= 0 {
+		return
+	}
+	if p.batchProfile != nil {
+		p.stopBatchProfile()
+		return
+	}
+	if elapsed < p.slowBatch || p.batchProfiles >= maxBatchProfiles {
+		return
+	}
+	p.batchProfiles++
+	if err := p.startBatchProfile(); err != nil {
+		pruneLogger.Warningf("batch %d took %s, unable to profile next batch: %v", p.batch, elapsed, err)
+		return
+	}
+	pruneLogger.Infof("batch %d took %s, profiling next batch to %s", p.batch, elapsed, p.batchProfile.file.Name())
+}
+
+func (p *IncrementalPruner) startBatchProfile() error {
+	f, err := os.CreateTemp(p.profileDir, "txn-prune-batch-*.pprof")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// This fails if the process is already being profiled.
+	if err := pprof.StartCPUProfile(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return errors.Trace(err)
+	}
+	p.batchProfile = &batchProfile{file: f, batch: p.batch + 1}
+	return nil
+}
+
+// stopBatchProfile stops the profile started by profileSlowBatch, if
+// there is one.
+func (p *IncrementalPruner) stopBatchProfile() {
+	if p.batchProfile == nil {
+		return
+	}
+	pprof.StopCPUProfile()
+	if err := p.batchProfile.file.Close(); err != nil {
+		pruneLogger.Warningf("writing CPU profile of batch %d: %v", p.batchProfile.batch, err)
+	} else {
+		pruneLogger.Infof("wrote CPU profile of batch %d to %s", p.batchProfile.batch, p.batchProfile.file.Name())
+	}
+	p.batchProfile = nil
+}
+
+// sampleMemory records the heap memory in use, and reports it if it is a
+// new peak. runtime.ReadMemStats briefly stops the world, so it is only
+// called once per batch.
+func (p *IncrementalPruner) sampleMemory() {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	heap := int64(mem.HeapAlloc)
+	if heap <= p.stats.PeakHeapBytes {
+		return
+	}
+	p.stats.PeakHeapBytes = heap
+	p.report(ProgressMessage{PeakHeapBytes: heap, Batch: p.batch})
+}
@@ -0,0 +1,94 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type PruneProfileSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&PruneProfileSuite{})
+
+func (*PruneProfileSuite) TestProfilesBatchAfterSlowBatch(c *gc.C) {
+	dir := c.MkDir()
+	p := NewIncrementalPruner(IncrementalPruneArgs{
+		StartCPUProfileOnSlowBatch: time.Second,
+		CPUProfileDir:              dir,
+	})
+	defer p.stopBatchProfile()
+
+	p.batch = 1
+	p.profileSlowBatch(time.Millisecond)
+	c.Check(p.batchProfile, gc.IsNil)
+
+	p.profileSlowBatch(2 * time.Second)
+	c.Assert(p.batchProfile, gc.NotNil)
+	c.Check(p.batchProfile.batch, gc.Equals, 2)
+
+	// The profile stops after the next batch, however long it takes.
+	p.batch = 2
+	p.profileSlowBatch(time.Millisecond)
+	c.Check(p.batchProfile, gc.IsNil)
+	files, err := filepath.Glob(filepath.Join(dir, "txn-prune-batch-*.pprof"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(files, gc.HasLen, 1)
+	info, err := os.Stat(files[0])
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(info.Size() > 0, jc.IsTrue)
+}
+
+func (*PruneProfileSuite) TestProfilesAreLimited(c *gc.C) {
+	dir := c.MkDir()
+	p := NewIncrementalPruner(IncrementalPruneArgs{
+		StartCPUProfileOnSlowBatch: time.Second,
+		CPUProfileDir:              dir,
+	})
+	defer p.stopBatchProfile()
+	for i := 0; i < 2*(maxBatchProfiles+1); i++ {
+		p.batch++
+		p.profileSlowBatch(2 * time.Second)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "txn-prune-batch-*.pprof"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(files, gc.HasLen, maxBatchProfiles)
+}
+
+func (*PruneProfileSuite) TestDisabled(c *gc.C) {
+	p := NewIncrementalPruner(IncrementalPruneArgs{CPUProfileDir: c.MkDir()})
+	p.profileSlowBatch(time.Hour)
+	c.Check(p.batchProfile, gc.IsNil)
+}
+
+func (*PruneProfileSuite) TestSampleMemory(c *gc.C) {
+	progress := make(chan ProgressMessage, 2)
+	p := NewIncrementalPruner(IncrementalPruneArgs{ProgressChannel: progress})
+	p.batch = 1
+	p.sampleMemory()
+	peak := p.stats.PeakHeapBytes
+	c.Assert(peak > 0, jc.IsTrue)
+	c.Check(<-progress, jc.DeepEquals, ProgressMessage{PeakHeapBytes: peak, Batch: 1})
+
+	// Only a new peak is reported.
+	p.stats.PeakHeapBytes = 1 << 62
+	p.sampleMemory()
+	c.Check(p.stats.PeakHeapBytes, gc.Equals, int64(1<<62))
+	c.Check(progress, gc.HasLen, 0)
+}
+
+func (*PruneProfileSuite) TestCombinePeakHeap(c *gc.C) {
+	a := PrunerStats{PeakHeapBytes: 100, TxnsRemoved: 1}
+	b := PrunerStats{PeakHeapBytes: 50, TxnsRemoved: 2}
+	combined := CombineStats(a, b)
+	c.Check(combined.PeakHeapBytes, gc.Equals, int64(100))
+	c.Check(combined.TxnsRemoved, gc.Equals, int64(3))
+}
@@ -0,0 +1,192 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// PurgeStats reports on the work done by PurgeByDocumentPrefix.
+type PurgeStats struct {
+	// TxnsRemoved is the number of completed transactions removed.
+	TxnsRemoved int
+
+	// TxnsSkipped is the number of completed transactions that touched
+	// documents with the prefix, but were left because they also touched
+	// other documents. They are removed by the next prune.
+	TxnsSkipped int
+
+	// DocsCleaned is the number of documents, including those in the
+	// stash, whose txn-queue had tokens removed.
+	DocsCleaned int
+
+	// StashDocsRemoved is the number of documents with the prefix that
+	// were removed from the stash.
+	StashDocsRemoved int
+}
+
+// purgeTxnDoc holds the fields of a completed transaction that we need to
+// purge it.
+type purgeTxnDoc struct {
+	Id  bson.ObjectId `bson:"_id"`
+	Ops []docKey      `bson:"o"`
+}
+
+// PurgeByDocumentPrefix removes the completed transactions in txnsName
+// that only touched documents whose string ids start with prefix, along
+// with their tokens in the txn-queues of those documents and any stash
+// entries for them that are left empty. It is meant to be used when a
+// tenant, such as a model whose documents share a uuid prefix, is
+// destroyed, so that its transactions don't linger until the next prune.
+//
+// Transactions that haven't completed are left alone, as are completed
+// transactions that also touched documents without the prefix. As with
+// CleanAndPruneArgs.MaxTime, if maxTime isn't zero only transactions
+// created before it are purged, so that recently completed transactions
+// are left for any runners still resuming them.
+func PurgeByDocumentPrefix(db *mgo.Database, txnsName, prefix string, maxTime time.Time) (PurgeStats, error) {
+	var stats PurgeStats
+	if prefix == "" {
+		return stats, errors.NotValidf("empty prefix")
+	}
+	txns := db.C(txnsName)
+	txnsStash := db.C(txnsName + ".stash")
+	idMatch := bson.RegEx{Pattern: "^" + regexp.QuoteMeta(prefix)}
+	match := completedOldTransactionMatch(maxTime)
+	match["o.d"] = idMatch
+	query := txns.Find(match)
+	query.Select(bson.M{"_id": 1, "o.c": 1, "o.d": 1})
+	query.Batch(maxBatchDocs)
+	iter := query.Iter()
+	var batch []purgeTxnDoc
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		cleaned, removed, err := purgeTxns(txns, txnsStash, batch)
+		stats.DocsCleaned += cleaned
+		stats.TxnsRemoved += removed
+		batch = batch[:0]
+		return errors.Trace(err)
+	}
+	var doc purgeTxnDoc
+	for iter.Next(&doc) {
+		if !opsHavePrefix(doc.Ops, prefix) {
+			stats.TxnsSkipped++
+			continue
+		}
+		batch = append(batch, doc)
+		doc = purgeTxnDoc{}
+		if len(batch) >= maxBatchDocs {
+			if err := flush(); err != nil {
+				iter.Close()
+				return stats, errors.Trace(err)
+			}
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return stats, errors.Trace(err)
+	}
+	if err := flush(); err != nil {
+		return stats, errors.Trace(err)
+	}
+	info, err := txnsStash.RemoveAll(bson.M{
+		"_id.id":      idMatch,
+		"txn-queue.0": bson.M{"$exists": 0},
+	})
+	if err != nil {
+		return stats, errors.Trace(err)
+	}
+	stats.StashDocsRemoved = info.Removed
+	pruneLogger.Infof("purged %d txns with document prefix %q, cleaned %d docs and removed %d stash docs",
+		stats.TxnsRemoved, prefix, stats.DocsCleaned, stats.StashDocsRemoved)
+	return stats, nil
+}
+
+// opsHavePrefix returns true if every op is on a document whose id is a
+// string starting with prefix.
+func opsHavePrefix(ops []docKey, prefix string) bool {
+	for _, op := range ops {
+		id, ok := op.DocId.(string)
+		if !ok || !strings.HasPrefix(id, prefix) {
+			return false
+		}
+	}
+	return len(ops) > 0
+}
+
+// purgeTxns pulls the tokens of txnDocs from the documents they touched,
+// and then removes them. It returns the number of documents cleaned and
+// transactions removed.
+func purgeTxns(txns, txnsStash *mgo.Collection, txnDocs []purgeTxnDoc) (int, int, error) {
+	purging := make(map[bson.ObjectId]bool, len(txnDocs))
+	ids := make([]bson.ObjectId, len(txnDocs))
+	keys := make(docKeySet)
+	for i, doc := range txnDocs {
+		purging[doc.Id] = true
+		ids[i] = doc.Id
+		for _, key := range doc.Ops {
+			keys[key] = struct{}{}
+		}
+	}
+	cleaned := 0
+	for key := range keys {
+		found, pulled, err := purgeQueue(txns.Database.C(key.Collection), key.DocId, purging)
+		if err == nil && !found {
+			// Documents that don't exist are in the stash.
+			stashId := stashDocKey{Collection: key.Collection, Id: key.DocId}
+			_, pulled, err = purgeQueue(txnsStash, stashId, purging)
+		}
+		if err != nil {
+			return cleaned, 0, errors.Annotatef(err, "cleaning %v in %q", key.DocId, key.Collection)
+		}
+		if pulled {
+			cleaned++
+		}
+	}
+	// The tokens are gone, so the transactions can be removed.
+	info, err := txns.RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return cleaned, 0, errors.Trace(err)
+	}
+	return cleaned, info.Removed, nil
+}
+
+// purgeQueue pulls the tokens of the purging transactions from the
+// txn-queue of the document with id in coll. It returns whether the
+// document was found, and whether any tokens were pulled.
+func purgeQueue(coll *mgo.Collection, id interface{}, purging map[bson.ObjectId]bool) (bool, bool, error) {
+	var doc struct {
+		Queue []string `bson:"txn-queue"`
+	}
+	err := coll.FindId(id).Select(bson.M{"txn-queue": 1}).One(&doc)
+	if err == mgo.ErrNotFound {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, errors.Trace(err)
+	}
+	var tokens []string
+	for _, tok := range doc.Queue {
+		if parsed, err := ParseToken(tok); err == nil && purging[parsed.Id] {
+			tokens = append(tokens, tok)
+		}
+	}
+	if len(tokens) == 0 {
+		return true, false, nil
+	}
+	err = coll.UpdateId(id, bson.M{"$pullAll": bson.M{"txn-queue": tokens}})
+	if err == mgo.ErrNotFound {
+		// It was removed since we read it.
+		return false, false, nil
+	} else if err != nil {
+		return true, false, errors.Trace(err)
+	}
+	return true, true, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type PurgeSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&PurgeSuite{})
+
+func (s *PurgeSuite) TestPurgeByDocumentPrefix(c *gc.C) {
+	s.runTxn(c, txn.Op{C: "coll", Id: "m1:a", Insert: bson.M{}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "m1:a", Update: bson.M{"$set": bson.M{"x": 1}}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "m1:b", Insert: bson.M{}})
+	s.runTxn(c, txn.Op{C: "coll", Id: "m1:b", Remove: true})
+	shared := s.runTxn(c, txn.Op{
+		C:      "coll",
+		Id:     "m1:a",
+		Update: bson.M{"$set": bson.M{"x": 2}},
+	}, txn.Op{
+		C:      "other",
+		Id:     "a",
+		Insert: bson.M{},
+	})
+	other := s.runTxn(c, txn.Op{C: "coll", Id: "m2:a", Insert: bson.M{}})
+
+	stats, err := jujutxn.PurgeByDocumentPrefix(s.db, "txns", "m1:", time.Time{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats, jc.DeepEquals, jujutxn.PurgeStats{
+		TxnsRemoved:      4,
+		TxnsSkipped:      1,
+		DocsCleaned:      2,
+		StashDocsRemoved: 1,
+	})
+	s.assertTxns(c, shared, other)
+	s.assertDocQueue(c, "coll", "m1:a", shared)
+	s.assertDocQueue(c, "coll", "m2:a", other)
+	s.assertCollCount(c, "txns.stash", 0)
+}
+
+func (s *PurgeSuite) TestPurgeLeavesIncompleteTxns(c *gc.C) {
+	pending := s.runInterruptedTxn(c, txn.Op{C: "coll", Id: "m1:a", Insert: bson.M{}})
+	stats, err := jujutxn.PurgeByDocumentPrefix(s.db, "txns", "m1:", time.Time{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats, jc.DeepEquals, jujutxn.PurgeStats{})
+	s.assertTxns(c, pending)
+}
+
+func (s *PurgeSuite) TestPurgeLeavesNewTxns(c *gc.C) {
+	maxTime := time.Now().Add(-time.Hour)
+	s.runTxnWithTimestamp(c, nil, maxTime.Add(-time.Minute), txn.Op{C: "coll", Id: "m1:a", Insert: bson.M{}})
+	newer := s.runTxn(c, txn.Op{C: "coll", Id: "m1:a", Update: bson.M{"$set": bson.M{"x": 1}}})
+
+	stats, err := jujutxn.PurgeByDocumentPrefix(s.db, "txns", "m1:", maxTime)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TxnsRemoved, gc.Equals, 1)
+	s.assertTxns(c, newer)
+	s.assertDocQueue(c, "coll", "m1:a", newer)
+}
+
+func (s *PurgeSuite) TestPurgePrefixIsLiteral(c *gc.C) {
+	other := s.runTxn(c, txn.Op{C: "coll", Id: "m1:a", Insert: bson.M{}})
+	stats, err := jujutxn.PurgeByDocumentPrefix(s.db, "txns", "m.:", time.Time{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats, jc.DeepEquals, jujutxn.PurgeStats{})
+	s.assertTxns(c, other)
+}
+
+func (s *PurgeSuite) TestPurgeEmptyPrefix(c *gc.C) {
+	_, err := jujutxn.PurgeByDocumentPrefix(s.db, "txns", "", time.Time{})
+	c.Check(err, gc.ErrorMatches, "empty prefix not valid")
+}
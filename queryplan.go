@@ -0,0 +1,297 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// IndexHints selects the indexes used by the pruner's queries, and has
+// the pruner check how the server plans to run them. Query planner
+// regressions have made the server scan whole collections instead of
+// using an index, making pruning many times slower without any error;
+// each query that would scan its collection is logged as a warning and
+// counted in PrunerStats.CollScans.
+//
+// The scan of the transactions is checked once per Prune, and the reads
+// of documents once per collection.
+type IndexHints struct {
+	// Txns is the key of the index to scan the transactions with, as
+	// given to mgo.Query.Hint, eg []string{"_id"}.
+	Txns []string
+
+	// Docs are the keys of the indexes to read documents with, by
+	// collection.
+	Docs map[string][]string
+
+	// Auto, if true, chooses the indexes that aren't given. The
+	// transactions are scanned with an index on {_id, s} if there is
+	// one, and otherwise with the _id index, which matches the order
+	// they are read in. Documents are read with the _id index.
+	Auto bool
+}
+
+// Validate returns an error if any of the hints isn't a valid index key.
+func (h IndexHints) Validate() error {
+	if err := validateIndexKey(h.Txns); err != nil {
+		return errors.Annotate(err, "Txns hint")
+	}
+	for collection, key := range h.Docs {
+		if err := validateIndexKey(key); err != nil {
+			return errors.Annotatef(err, "hint for %q", collection)
+		}
+	}
+	return nil
+}
+
+func validateIndexKey(key []string) error {
+	if key != nil && len(key) == 0 {
+		return errors.NotValidf("empty index key")
+	}
+	for _, field := range key {
+		if strings.TrimLeft(field, "+-") == "" {
+			return errors.NotValidf("index key %q", key)
+		}
+	}
+	return nil
+}
+
+// docs returns the hint for reading documents from collection, or nil if
+// there isn't one. It may be called on nil hints.
+func (h *IndexHints) docs(collection string) []string {
+	if h == nil {
+		return nil
+	}
+	if key, ok := h.Docs[collection]; ok {
+		return key
+	}
+	if h.Auto {
+		return []string{"_id"}
+	}
+	return nil
+}
+
+// autoTxnsHint chooses the index of txns, from its indexes, to scan the
+// transactions with.
+func autoTxnsHint(indexes []mgo.Index) []string {
+	for _, index := range indexes {
+		if reflect.DeepEqual(index.Key, []string{"_id", "s"}) {
+			return index.Key
+		}
+	}
+	return []string{"_id"}
+}
+
+// indexKeyDoc converts an index key, as given to mgo.Query.Hint, to the
+// document sent to the server.
+func indexKeyDoc(key []string) bson.D {
+	doc := make(bson.D, len(key))
+	for i, field := range key {
+		order := 1
+		if strings.HasPrefix(field, "-") {
+			order = -1
+		}
+		doc[i] = bson.DocElem{Name: strings.TrimLeft(field, "+-"), Value: order}
+	}
+	return doc
+}
+
+// queryPlan is a stage of the winning plan reported by explain. The
+// stages that feed it are in InputStage or InputStages. Servers using the
+// slot-based execution engine nest the plan in QueryPlan.
+type queryPlan struct {
+	Stage       string      `bson:"stage"`
+	IndexName   string      `bson:"indexName,omitempty"`
+	InputStage  *queryPlan  `bson:"inputStage,omitempty"`
+	InputStages []queryPlan `bson:"inputStages,omitempty"`
+	QueryPlan   *queryPlan  `bson:"queryPlan,omitempty"`
+}
+
+// collScan returns true if any stage of the plan scans a whole
+// collection.
+func (plan queryPlan) collScan() bool {
+	if plan.Stage == "COLLSCAN" {
+		return true
+	}
+	for _, input := range plan.inputs() {
+		if input.collScan() {
+			return true
+		}
+	}
+	return false
+}
+
+func (plan queryPlan) inputs() []queryPlan {
+	var inputs []queryPlan
+	if plan.QueryPlan != nil {
+		inputs = append(inputs, *plan.QueryPlan)
+	}
+	if plan.InputStage != nil {
+		inputs = append(inputs, *plan.InputStage)
+	}
+	return append(inputs, plan.InputStages...)
+}
+
+// String formats the plan from the last stage to the first, eg
+// "FETCH <- IXSCAN(_id_)".
+func (plan queryPlan) String() string {
+	stage := plan.Stage
+	if plan.IndexName != "" {
+		stage = fmt.Sprintf("%s(%s)", stage, plan.IndexName)
+	}
+	inputs := plan.inputs()
+	switch {
+	case stage == "":
+		// The outer plan of the slot-based engine has no stage.
+		if len(inputs) == 1 {
+			return inputs[0].String()
+		}
+		stage = "?"
+	case len(inputs) == 0:
+		return stage
+	}
+	if len(inputs) == 1 {
+		return stage + " <- " + inputs[0].String()
+	}
+	names := make([]string, len(inputs))
+	for i, input := range inputs {
+		names[i] = input.String()
+	}
+	return fmt.Sprintf("%s <- [%s]", stage, strings.Join(names, ", "))
+}
+
+const (
+	// explainQueryPlanner and explainExecutionStats are the verbosities
+	// of explain used by the pruner.
+	explainQueryPlanner   = "queryPlanner"
+	explainExecutionStats = "executionStats"
+)
+
+// findQuery is a find to be explained.
+type findQuery struct {
+	collection string
+	filter     interface{}
+	sort       interface{}
+	hint       []string
+	limit      int
+}
+
+// command returns the find command of the query.
+func (q findQuery) command() bson.D {
+	find := bson.D{{"find", q.collection}, {"filter", q.filter}}
+	if q.sort != nil {
+		find = append(find, bson.DocElem{"sort", q.sort})
+	}
+	if q.hint != nil {
+		find = append(find, bson.DocElem{"hint", indexKeyDoc(q.hint)})
+	}
+	if q.limit > 0 {
+		find = append(find, bson.DocElem{"limit", q.limit})
+	}
+	return find
+}
+
+// queryExplainer reports how the server would run queries.
+type queryExplainer interface {
+	// explain reads the output of explaining query at verbosity into
+	// result. The query is only run if verbosity asks for execution
+	// stats.
+	explain(query findQuery, verbosity string, result interface{}) error
+}
+
+func (s mgoStore) explain(query findQuery, verbosity string, result interface{}) error {
+	err := s.db.Run(bson.D{{"explain", query.command()}, {"verbosity", verbosity}}, result)
+	return errors.Annotatef(err, "explaining query of %q", query.collection)
+}
+
+// winningPlan returns the plan the server chooses for query, without
+// running it.
+func winningPlan(explainer queryExplainer, query findQuery) (queryPlan, error) {
+	var result struct {
+		QueryPlanner struct {
+			WinningPlan queryPlan `bson:"winningPlan"`
+		} `bson:"queryPlanner"`
+	}
+	if err := explainer.explain(query, explainQueryPlanner, &result); err != nil {
+		return queryPlan{}, errors.Trace(err)
+	}
+	return result.QueryPlanner.WinningPlan, nil
+}
+
+// chooseTxnsHint sets the hint used to scan txns, choosing one from its
+// indexes if it isn't given and IndexHints.Auto is set.
+func (p *IncrementalPruner) chooseTxnsHint(txns *mgo.Collection) {
+	if p.indexHints == nil {
+		return
+	}
+	p.txnsHint = p.indexHints.Txns
+	if p.txnsHint != nil || !p.indexHints.Auto {
+		return
+	}
+	indexes, err := txns.Indexes()
+	if err != nil {
+		pruneLogger.Warningf("unable to read indexes of %q to choose a hint: %v", txns.Name, err)
+		return
+	}
+	p.txnsHint = autoTxnsHint(indexes)
+	pruneLogger.Debugf("scanning %q with index %v", txns.Name, p.txnsHint)
+}
+
+// checkPlan asks the server how it would run query, and warns if it
+// would scan the whole collection.
+func (p *IncrementalPruner) checkPlan(explainer queryExplainer, query findQuery) {
+	plan, err := winningPlan(explainer, query)
+	if err != nil {
+		pruneLogger.Debugf("unable to check query plan: %v", err)
+		return
+	}
+	if !plan.collScan() {
+		pruneLogger.Debugf("query of %q is planned as %s", query.collection, plan)
+		return
+	}
+	p.stats.CollScans++
+	pruneLogger.Warningf("query of %q is planned as a collection scan (%s); "+
+		"set IndexHints to choose an index", query.collection, plan)
+}
+
+// checkDocPlan checks the plan of reading ids from collection, the first
+// time documents are read from it.
+func (p *IncrementalPruner) checkDocPlan(collection string, ids []interface{}, explainer queryExplainer) {
+	if p.indexHints == nil || p.planChecked[collection] {
+		return
+	}
+	p.planChecked[collection] = true
+	if len(ids) > p.docBatchSize {
+		ids = ids[:p.docBatchSize]
+	}
+	p.checkPlan(explainer, p.docsQuery(collection, ids))
+}
+
+// docsQuery is the query that reads the documents in collection whose
+// _id is one of ids.
+func (p *IncrementalPruner) docsQuery(collection string, ids []interface{}) findQuery {
+	return findQuery{
+		collection: collection,
+		filter:     bson.M{"_id": bson.M{"$in": ids}},
+		hint:       p.indexHints.docs(collection),
+	}
+}
+
+// txnsQuery is the scan of the transactions in txnsName, limited to a
+// batch.
+func (p *IncrementalPruner) txnsQuery(txnsName string) findQuery {
+	return findQuery{
+		collection: txnsName,
+		filter:     p.txnsMatch(),
+		sort:       p.txnsSort(),
+		hint:       p.txnsHint,
+		limit:      p.txnBatchSize,
+	}
+}
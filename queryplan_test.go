@@ -0,0 +1,164 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type QueryPlanSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&QueryPlanSuite{})
+
+func (*QueryPlanSuite) TestPlanFromExplain(c *gc.C) {
+	data, err := bson.Marshal(bson.M{
+		"stage": "SORT",
+		"inputStage": bson.M{
+			"stage": "FETCH",
+			"inputStage": bson.M{
+				"stage":     "IXSCAN",
+				"indexName": "s_1",
+			},
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	var plan queryPlan
+	c.Assert(bson.Unmarshal(data, &plan), jc.ErrorIsNil)
+	c.Check(plan.String(), gc.Equals, "SORT <- FETCH <- IXSCAN(s_1)")
+	c.Check(plan.collScan(), jc.IsFalse)
+}
+
+func (*QueryPlanSuite) TestCollScan(c *gc.C) {
+	plan := queryPlan{Stage: "COLLSCAN"}
+	c.Check(plan.collScan(), jc.IsTrue)
+
+	// The slot-based engine nests the plan.
+	plan = queryPlan{QueryPlan: &queryPlan{
+		Stage: "OR",
+		InputStages: []queryPlan{
+			{Stage: "IXSCAN", IndexName: "_id_"},
+			{Stage: "COLLSCAN"},
+		},
+	}}
+	c.Check(plan.collScan(), jc.IsTrue)
+	c.Check(plan.String(), gc.Equals, "OR <- [IXSCAN(_id_), COLLSCAN]")
+}
+
+func (*QueryPlanSuite) TestAutoTxnsHint(c *gc.C) {
+	indexes := []mgo.Index{{Key: []string{"_id"}}, {Key: []string{"s"}}}
+	c.Check(autoTxnsHint(indexes), jc.DeepEquals, []string{"_id"})
+	indexes = append(indexes, mgo.Index{Key: []string{"_id", "s"}})
+	c.Check(autoTxnsHint(indexes), jc.DeepEquals, []string{"_id", "s"})
+}
+
+func (*QueryPlanSuite) TestIndexKeyDoc(c *gc.C) {
+	c.Check(indexKeyDoc([]string{"-_id", "s"}), jc.DeepEquals, bson.D{{"_id", -1}, {"s", 1}})
+}
+
+func (*QueryPlanSuite) TestDocHints(c *gc.C) {
+	var hints *IndexHints
+	c.Check(hints.docs("coll"), gc.IsNil)
+	hints = &IndexHints{Docs: map[string][]string{"coll": {"_id", "txn-queue"}}}
+	c.Check(hints.docs("coll"), jc.DeepEquals, []string{"_id", "txn-queue"})
+	c.Check(hints.docs("other"), gc.IsNil)
+	hints.Auto = true
+	c.Check(hints.docs("other"), jc.DeepEquals, []string{"_id"})
+}
+
+func (*QueryPlanSuite) TestValidate(c *gc.C) {
+	c.Check(IndexHints{Txns: []string{"_id"}}.Validate(), jc.ErrorIsNil)
+	err := IndexHints{Txns: []string{}}.Validate()
+	c.Check(err, gc.ErrorMatches, "Txns hint: empty index key not valid")
+	err = IndexHints{Docs: map[string][]string{"coll": {"-"}}}.Validate()
+	c.Check(err, gc.ErrorMatches, `hint for "coll": index key \["-"\] not valid`)
+}
+
+func (*QueryPlanSuite) TestDocPlanChecked(c *gc.C) {
+	store := &fakeStore{
+		docs: map[string][]bson.M{
+			"coll":  {{"_id": "a", "txn-queue": []string{}}},
+			"other": {{"_id": "b", "txn-queue": []string{}}},
+		},
+		plans: map[string]queryPlan{"coll": {Stage: "COLLSCAN"}},
+	}
+	keys := docKeySet{
+		docKey{Collection: "coll", DocId: "a"}:  {},
+		docKey{Collection: "other", DocId: "b"}: {},
+	}
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{IndexHints: &IndexHints{Auto: true}})
+	for i := 0; i < 2; i++ {
+		docs, err := pruner.lookupDocs(keys, store, "txns.stash")
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(docs, gc.HasLen, 2)
+	}
+	// Each collection is only explained the first time it is read.
+	c.Check(store.explained, jc.SameContents, []string{"coll [_id]", "other [_id]"})
+	c.Check(pruner.stats.CollScans, gc.Equals, int64(1))
+}
+
+func (*QueryPlanSuite) TestNoHintsNoPlans(c *gc.C) {
+	store := &fakeStore{docs: map[string][]bson.M{
+		"coll": {{"_id": "a", "txn-queue": []string{}}},
+	}}
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{})
+	_, err := pruner.lookupDocs(docKeySet{docKey{Collection: "coll", DocId: "a"}: {}}, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(store.explained, gc.HasLen, 0)
+}
+
+func (*QueryPlanSuite) TestExplainSlowQueries(c *gc.C) {
+	fake := &fakeStore{docs: make(map[string][]bson.M)}
+	keys := docKeysFixture(fake, 30)
+	store := slowStore{fakeStore: fake, delay: time.Millisecond}
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{
+		DocBatchSize:       minDocBatchSize,
+		ExplainSlowQueries: time.Millisecond,
+	})
+	docs, err := pruner.lookupDocs(keys, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(docs, gc.HasLen, 30)
+	// Each batch of 10 is slow, but explained only once.
+	c.Check(pruner.stats.SlowQueries, gc.Equals, int64(3))
+	c.Check(fake.explained, gc.HasLen, 3)
+	queries := pruner.SlowQueries()
+	c.Assert(queries, gc.HasLen, 3)
+	c.Check(queries[0].Collection, gc.Equals, "coll")
+	c.Check(queries[0].Worker, gc.Equals, "forward")
+	c.Check(queries[0].Duration >= time.Millisecond, jc.IsTrue)
+	c.Check(string(queries[0].Explain), gc.Equals, `{"queryPlanner":{"winningPlan":{"stage":""}}}`)
+}
+
+func (*QueryPlanSuite) TestExplainSlowQueriesLimited(c *gc.C) {
+	store := &fakeStore{}
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{ExplainSlowQueries: time.Second})
+	query := pruner.docsQuery("coll", []interface{}{"a"})
+	pruner.explainSlowQuery(store, query, time.Millisecond)
+	c.Check(pruner.stats.SlowQueries, gc.Equals, int64(0))
+	for i := 0; i < maxSlowQueryExplains+2; i++ {
+		pruner.explainSlowQuery(store, query, 2*time.Second)
+	}
+	c.Check(pruner.stats.SlowQueries, gc.Equals, int64(maxSlowQueryExplains+2))
+	c.Check(pruner.SlowQueries(), gc.HasLen, maxSlowQueryExplains)
+}
+
+func (*QueryPlanSuite) TestSlowQueryBSON(c *gc.C) {
+	query := SlowQuery{
+		Collection: "coll",
+		Explain:    json.RawMessage(`{"command":{"filter":{"_id":{"$in":["a"]}}}}`),
+	}
+	data, err := bson.Marshal(query)
+	c.Assert(err, jc.ErrorIsNil)
+	var read SlowQuery
+	c.Assert(bson.Unmarshal(data, &read), jc.ErrorIsNil)
+	c.Check(string(read.Explain), gc.Equals, string(query.Explain))
+}
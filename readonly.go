@@ -0,0 +1,168 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WriteGate implements the read-only mode of a Runner. It lets writes
+// through while it isn't read-only, and keeps count of the writes in
+// progress so that they can be waited for. It is exported for use by
+// other implementations of Runner.
+type WriteGate struct {
+	mu       sync.Mutex
+	readOnly bool
+	// modeChanges counts the calls that set readOnly, so that Quiesce
+	// can tell whether the mode was set again while it waited.
+	modeChanges uint64
+	inFlight    int
+	// idle is closed when inFlight drops to 0, and replaced when it
+	// rises from 0.
+	idle chan struct{}
+}
+
+// NewWriteGate returns a WriteGate that lets writes through.
+func NewWriteGate() *WriteGate {
+	idle := make(chan struct{})
+	close(idle)
+	return &WriteGate{idle: idle}
+}
+
+// Enter returns ErrReadOnly if writes are not allowed. Otherwise it
+// records a write in progress, and the caller must call Exit when the
+// write has finished.
+func (g *WriteGate) Enter() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.readOnly {
+		return ErrReadOnly
+	}
+	if g.inFlight == 0 {
+		g.idle = make(chan struct{})
+	}
+	g.inFlight++
+	return nil
+}
+
+// Exit records that a write let through by Enter has finished.
+func (g *WriteGate) Exit() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inFlight--
+	if g.inFlight == 0 {
+		close(g.idle)
+	}
+}
+
+// SetReadOnly sets whether writes are refused. Writes already in progress
+// are not affected.
+func (g *WriteGate) SetReadOnly(readOnly bool) {
+	g.mu.Lock()
+	g.readOnly = readOnly
+	g.modeChanges++
+	g.mu.Unlock()
+}
+
+// ReadOnly returns whether writes are refused.
+func (g *WriteGate) ReadOnly() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.readOnly
+}
+
+// Wait waits until no writes are in progress, or ctx is done, in which
+// case it returns ctx.Err().
+func (g *WriteGate) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	idle := g.idle
+	g.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// InFlight returns the number of writes in progress.
+func (g *WriteGate) InFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.inFlight
+}
+
+// QuiesceReport is returned by Quiesce.
+type QuiesceReport struct {
+	// InFlight is the number of writes that were in progress when
+	// Quiesce was called.
+	InFlight int
+
+	// Drained is true if they have all finished, and so nothing is
+	// being written.
+	Drained bool
+
+	// Waited is how long Quiesce waited for them.
+	Waited time.Duration
+}
+
+// Quiesce makes the gate read-only, and waits for the writes in progress
+// to finish. If ctx is done first, the gate goes back to its previous
+// mode, unless the mode has been set again since, and ctx.Err() is
+// returned with a report that isn't Drained.
+func (g *WriteGate) Quiesce(ctx context.Context) (QuiesceReport, error) {
+	start := time.Now()
+	g.mu.Lock()
+	wasReadOnly := g.readOnly
+	g.readOnly = true
+	g.modeChanges++
+	quiescedMode := g.modeChanges
+	report := QuiesceReport{InFlight: g.inFlight}
+	g.mu.Unlock()
+
+	err := g.Wait(ctx)
+	report.Waited = time.Since(start)
+	if err != nil {
+		g.mu.Lock()
+		if g.modeChanges == quiescedMode {
+			g.readOnly = wasReadOnly
+			g.modeChanges++
+		}
+		g.mu.Unlock()
+		return report, err
+	}
+	report.Drained = true
+	return report, nil
+}
+
+// SetReadOnly is defined on ReadOnlyRunner.
+func (tr *transactionRunner) SetReadOnly(readOnly bool) {
+	if readOnly != tr.gate.ReadOnly() {
+		runnerLogger.Infof("setting runner read-only: %v", readOnly)
+	}
+	tr.gate.SetReadOnly(readOnly)
+}
+
+// ReadOnly is defined on ReadOnlyRunner.
+func (tr *transactionRunner) ReadOnly() bool {
+	return tr.gate.ReadOnly()
+}
+
+// WaitIdle is defined on ReadOnlyRunner.
+func (tr *transactionRunner) WaitIdle(ctx context.Context) error {
+	return tr.gate.Wait(ctx)
+}
+
+// Quiesce is defined on ReadOnlyRunner.
+func (tr *transactionRunner) Quiesce(ctx context.Context) (QuiesceReport, error) {
+	report, err := tr.gate.Quiesce(ctx)
+	if err != nil {
+		runnerLogger.Warningf("runner not quiesced, %d writes still in progress: %v", tr.gate.InFlight(), err)
+		return report, err
+	}
+	runnerLogger.Infof("runner quiesced after waiting %s for %d writes", report.Waited, report.InFlight)
+	return report, nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type ReadOnlySuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&ReadOnlySuite{})
+
+func (*ReadOnlySuite) TestWriteGate(c *gc.C) {
+	gate := NewWriteGate()
+	c.Assert(gate.Wait(context.Background()), jc.ErrorIsNil)
+
+	c.Assert(gate.Enter(), jc.ErrorIsNil)
+	gate.SetReadOnly(true)
+	c.Check(gate.ReadOnly(), jc.IsTrue)
+	c.Check(gate.Enter(), gc.Equals, ErrReadOnly)
+
+	// The write that got in before is still in progress.
+	ctx, cancel := context.WithTimeout(context.Background(), testing.ShortWait)
+	defer cancel()
+	c.Check(gate.Wait(ctx), gc.Equals, context.DeadlineExceeded)
+
+	waited := make(chan error)
+	go func() {
+		waited <- gate.Wait(context.Background())
+	}()
+	gate.Exit()
+	select {
+	case err := <-waited:
+		c.Check(err, jc.ErrorIsNil)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for writes to finish")
+	}
+
+	gate.SetReadOnly(false)
+	c.Check(gate.Enter(), jc.ErrorIsNil)
+	gate.Exit()
+}
+
+func (*ReadOnlySuite) TestRunnerReadOnly(c *gc.C) {
+	runner := NewRunner(RunnerParams{}).(ReadOnlyRunner)
+	runner.SetReadOnly(true)
+	c.Check(runner.ReadOnly(), jc.IsTrue)
+
+	err := runner.Run(func(int) ([]txn.Op, error) {
+		c.Fatalf("transaction source called while read-only")
+		return nil, nil
+	})
+	c.Check(err, gc.Equals, ErrReadOnly)
+	err = runner.RunTransaction(&Transaction{Ops: []txn.Op{{C: "coll", Id: 0, Insert: struct{}{}}}})
+	c.Check(err, gc.Equals, ErrReadOnly)
+	c.Check(runner.ResumeTransactions(), gc.Equals, ErrReadOnly)
+	c.Check(runner.MaybePruneTransactions(PruneOptions{}), gc.Equals, ErrReadOnly)
+	c.Check(runner.WaitIdle(context.Background()), jc.ErrorIsNil)
+
+	runner.SetReadOnly(false)
+	c.Check(runner.ReadOnly(), jc.IsFalse)
+}
+
+func (*ReadOnlySuite) TestQuiesce(c *gc.C) {
+	gate := NewWriteGate()
+	c.Assert(gate.Enter(), jc.ErrorIsNil)
+	c.Assert(gate.Enter(), jc.ErrorIsNil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testing.ShortWait)
+	defer cancel()
+	report, err := gate.Quiesce(ctx)
+	c.Check(err, gc.Equals, context.DeadlineExceeded)
+	c.Check(report.InFlight, gc.Equals, 2)
+	c.Check(report.Drained, jc.IsFalse)
+	// Not having drained, writes are allowed again.
+	c.Check(gate.ReadOnly(), jc.IsFalse)
+
+	type result struct {
+		report QuiesceReport
+		err    error
+	}
+	done := make(chan result)
+	go func() {
+		report, err := gate.Quiesce(context.Background())
+		done <- result{report, err}
+	}()
+	// Wait for Quiesce to block new writes.
+	deadline := time.Now().Add(testing.LongWait)
+	for !gate.ReadOnly() {
+		if time.Now().After(deadline) {
+			c.Fatalf("timed out waiting for the gate to be read-only")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Check(gate.Enter(), gc.Equals, ErrReadOnly)
+	gate.Exit()
+	gate.Exit()
+	select {
+	case r := <-done:
+		c.Assert(r.err, jc.ErrorIsNil)
+		c.Check(r.report.InFlight, gc.Equals, 2)
+		c.Check(r.report.Drained, jc.IsTrue)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for Quiesce")
+	}
+	c.Check(gate.ReadOnly(), jc.IsTrue)
+	c.Check(gate.InFlight(), gc.Equals, 0)
+}
+
+func (*ReadOnlySuite) TestQuiesceKeepsModeSetWhileWaiting(c *gc.C) {
+	gate := NewWriteGate()
+	c.Assert(gate.Enter(), jc.ErrorIsNil)
+	defer gate.Exit()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := gate.Quiesce(ctx)
+		done <- err
+	}()
+	deadline := time.Now().Add(testing.LongWait)
+	for !gate.ReadOnly() {
+		if time.Now().After(deadline) {
+			c.Fatalf("timed out waiting for the gate to be read-only")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Someone else makes the gate read-only while Quiesce waits, so it
+	// must stay that way when Quiesce gives up.
+	gate.SetReadOnly(true)
+	cancel()
+	select {
+	case err := <-done:
+		c.Check(err, gc.Equals, context.Canceled)
+	case <-time.After(testing.LongWait):
+		c.Fatalf("timed out waiting for Quiesce")
+	}
+	c.Check(gate.ReadOnly(), jc.IsTrue)
+}
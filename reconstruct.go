@@ -0,0 +1,243 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+)
+
+// DocState is the state of a document reconstructed from its history.
+type DocState struct {
+	// Exists is true if the document existed at the time.
+	Exists bool
+
+	// Doc holds the fields of the document, without the txn-queue and
+	// txn-revno fields maintained by mgo/txn. It is nil if the document
+	// didn't exist.
+	Doc bson.M
+
+	// Applied are the transactions that were replayed, in order.
+	Applied []bson.ObjectId
+
+	// Problems describes the operations that could not be replayed
+	// deterministically. If it is empty, Doc is exactly what the
+	// transactions wrote.
+	Problems []string
+}
+
+// ReconstructAt replays the applied transactions in history (see
+// DocHistory) that were created at or before t, and returns the state
+// they would have left the document in. Transactions are ordered by
+// creation time, which is the only time recorded for them, so a
+// transaction created just before t may not have been applied until
+// after it.
+//
+// The result is only exact if history starts with the transaction that
+// inserted the document, and every update uses the $set, $unset or $inc
+// operators. Anything else is noted in DocState.Problems, and replayed as
+// well as it can be.
+func ReconstructAt(history []DocChange, t time.Time) DocState {
+	var state DocState
+	known := false
+	problem := func(txnId bson.ObjectId, format string, args ...interface{}) {
+		state.Problems = append(state.Problems, fmt.Sprintf("txn %s: ", txnId.Hex())+fmt.Sprintf(format, args...))
+	}
+	for _, change := range history {
+		txnId := change.Txn.Id
+		if txnId.Time().After(t) {
+			break
+		}
+		switch txnState := change.Txn.State; {
+		case txnState == TxnAborted:
+			continue
+		case txnState != TxnApplied:
+			problem(txnId, "transaction is %s, assuming it was applied", txnState)
+		}
+		for _, op := range change.Ops {
+			switch {
+			case op.Insert != nil:
+				if known && state.Exists {
+					// Inserting an existing document does nothing.
+					continue
+				}
+				doc, err := toDoc(op.Insert)
+				if err != nil {
+					problem(txnId, "cannot read insert: %v", err)
+					doc = bson.M{}
+				}
+				doc["_id"] = op.Id
+				state.Doc = doc
+				state.Exists = true
+				known = true
+			case op.Update != nil:
+				if !known {
+					problem(txnId, "update of a document whose insert is not in the history")
+					state.Doc = bson.M{"_id": op.Id}
+					state.Exists = true
+					known = true
+				}
+				if !state.Exists {
+					// Updating a missing document does nothing.
+					continue
+				}
+				for _, p := range replayUpdate(state.Doc, op.Update) {
+					problem(txnId, "%s", p)
+				}
+			case op.Remove:
+				state.Doc = nil
+				state.Exists = false
+				known = true
+			}
+		}
+		state.Applied = append(state.Applied, txnId)
+	}
+	return state
+}
+
+// toDoc converts an insert or update document into a new bson.M, so that
+// replaying doesn't change the history.
+func toDoc(v interface{}) (bson.M, error) {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m bson.M
+	if err := bson.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// replayUpdate applies update to doc, and returns descriptions of any
+// parts of it that couldn't be applied.
+func replayUpdate(doc bson.M, update interface{}) []string {
+	u, err := toDoc(update)
+	if err != nil {
+		return []string{fmt.Sprintf("cannot read update: %v", err)}
+	}
+	var problems []string
+	for op, arg := range u {
+		fields, ok := arg.(bson.M)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("cannot read %s argument %v", op, arg))
+			continue
+		}
+		for field, value := range fields {
+			switch op {
+			case "$set":
+				setDocField(doc, field, value)
+			case "$unset":
+				unsetDocField(doc, field)
+			case "$inc":
+				current, _ := docField(doc, field)
+				sum, ok := addNumbers(current, value)
+				if !ok {
+					problems = append(problems, fmt.Sprintf("cannot $inc %q (%v) by %v", field, current, value))
+					continue
+				}
+				setDocField(doc, field, sum)
+			default:
+				problems = append(problems, fmt.Sprintf("cannot replay %s of %q", op, field))
+			}
+		}
+	}
+	return problems
+}
+
+func docField(doc bson.M, field string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, part := range strings.Split(field, ".") {
+		m, ok := current.(bson.M)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func setDocField(doc bson.M, field string, value interface{}) {
+	parts := strings.Split(field, ".")
+	m := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part].(bson.M)
+		if !ok {
+			next = bson.M{}
+			m[part] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = value
+}
+
+func unsetDocField(doc bson.M, field string) {
+	parts := strings.Split(field, ".")
+	m := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part].(bson.M)
+		if !ok {
+			return
+		}
+		m = next
+	}
+	delete(m, parts[len(parts)-1])
+}
+
+// addNumbers adds two bson numbers, keeping the wider type.
+func addNumbers(a, b interface{}) (interface{}, bool) {
+	if a == nil {
+		a = 0
+	}
+	switch {
+	case isFloat(a) || isFloat(b):
+		x, okA := asFloat(a)
+		y, okB := asFloat(b)
+		return x + y, okA && okB
+	case isInt64(a) || isInt64(b):
+		x, okA := asInt64(a)
+		y, okB := asInt64(b)
+		return x + y, okA && okB
+	}
+	x, okA := a.(int)
+	y, okB := b.(int)
+	return x + y, okA && okB
+}
+
+func isFloat(v interface{}) bool {
+	_, ok := v.(float64)
+	return ok
+}
+
+func isInt64(v interface{}) bool {
+	_, ok := v.(int64)
+	return ok
+}
+
+func asInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+func asFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
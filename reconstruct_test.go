@@ -0,0 +1,90 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type ReconstructSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&ReconstructSuite{})
+
+var reconstructBase = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func change(minute int, state jujutxn.TxnState, op txn.Op) jujutxn.DocChange {
+	op.C, op.Id = "coll", "a"
+	id := bson.NewObjectIdWithTime(reconstructBase.Add(time.Duration(minute) * time.Minute))
+	return jujutxn.DocChange{
+		Txn: &jujutxn.TxnDoc{Id: id, State: state, Ops: []txn.Op{op}},
+		Ops: []txn.Op{op},
+	}
+}
+
+func at(minute int) time.Time {
+	return reconstructBase.Add(time.Duration(minute) * time.Minute)
+}
+
+func (*ReconstructSuite) TestReplay(c *gc.C) {
+	history := []jujutxn.DocChange{
+		change(0, jujutxn.TxnApplied, txn.Op{Insert: bson.M{"x": 1, "sub": bson.M{"y": "a"}}}),
+		change(1, jujutxn.TxnApplied, txn.Op{Update: bson.M{
+			"$set":   bson.M{"sub.y": "b", "z": true},
+			"$inc":   bson.M{"x": 2},
+			"$unset": bson.M{"gone": 1},
+		}}),
+		change(2, jujutxn.TxnAborted, txn.Op{Update: bson.M{"$set": bson.M{"x": 100}}}),
+		change(3, jujutxn.TxnApplied, txn.Op{Remove: true}),
+		change(4, jujutxn.TxnApplied, txn.Op{Update: bson.M{"$set": bson.M{"x": 5}}}),
+		change(5, jujutxn.TxnApplied, txn.Op{Insert: bson.M{"x": 6}}),
+	}
+
+	state := jujutxn.ReconstructAt(history, at(0).Add(-time.Second))
+	c.Check(state.Exists, jc.IsFalse)
+	c.Check(state.Applied, gc.HasLen, 0)
+
+	state = jujutxn.ReconstructAt(history, at(2))
+	c.Check(state.Problems, gc.HasLen, 0)
+	c.Check(state.Exists, jc.IsTrue)
+	c.Check(state.Doc, jc.DeepEquals, bson.M{
+		"_id": "a",
+		"x":   3,
+		"sub": bson.M{"y": "b"},
+		"z":   true,
+	})
+	c.Check(state.Applied, jc.DeepEquals, []bson.ObjectId{history[0].Txn.Id, history[1].Txn.Id})
+
+	state = jujutxn.ReconstructAt(history, at(4))
+	c.Check(state.Problems, gc.HasLen, 0)
+	c.Check(state.Exists, jc.IsFalse)
+	c.Check(state.Doc, gc.IsNil)
+
+	state = jujutxn.ReconstructAt(history, at(10))
+	c.Check(state.Problems, gc.HasLen, 0)
+	c.Check(state.Doc, jc.DeepEquals, bson.M{"_id": "a", "x": 6})
+}
+
+func (*ReconstructSuite) TestProblems(c *gc.C) {
+	history := []jujutxn.DocChange{
+		change(0, jujutxn.TxnApplied, txn.Op{Update: bson.M{"$set": bson.M{"x": 1}}}),
+		change(1, jujutxn.TxnApplied, txn.Op{Update: bson.M{"$push": bson.M{"list": 1}}}),
+		change(2, jujutxn.TxnApplying, txn.Op{Update: bson.M{"$inc": bson.M{"x": 1}}}),
+	}
+	state := jujutxn.ReconstructAt(history, at(10))
+	c.Check(state.Doc, jc.DeepEquals, bson.M{"_id": "a", "x": 2})
+	c.Assert(state.Problems, gc.HasLen, 3)
+	c.Check(state.Problems[0], gc.Matches, "txn .*: update of a document whose insert is not in the history")
+	c.Check(state.Problems[1], gc.Matches, `txn .*: cannot replay \$push of "list"`)
+	c.Check(state.Problems[2], gc.Matches, "txn .*: transaction is applying, assuming it was applied")
+}
@@ -0,0 +1,176 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+)
+
+// RedactedValue replaces the values scrubbed by a FieldRedactor.
+const RedactedValue = "<redacted>"
+
+// Redactor scrubs sensitive values, such as passwords and secrets, from
+// the documents of ops before they are logged or exported. Ids aren't
+// redacted, as the documents couldn't be identified without them.
+type Redactor interface {
+	// RedactDoc returns doc, the assert, update or inserted document of
+	// an op on collection, with its sensitive values replaced. It must
+	// not modify doc.
+	RedactDoc(collection string, doc bson.D) bson.D
+}
+
+// FieldRedactor is a Redactor that replaces the values of the named
+// fields with RedactedValue, at any depth. A field matches a name if its
+// key, or the last part of its dotted key (as used by update operators),
+// is that name.
+type FieldRedactor struct {
+	// Fields are redacted in every collection.
+	Fields []string
+
+	// Collections holds fields that are only redacted in the collection
+	// they are keyed by.
+	Collections map[string][]string
+}
+
+// RedactDoc is part of the Redactor interface.
+func (r FieldRedactor) RedactDoc(collection string, doc bson.D) bson.D {
+	fields := make(map[string]bool)
+	for _, name := range r.Fields {
+		fields[name] = true
+	}
+	for _, name := range r.Collections[collection] {
+		fields[name] = true
+	}
+	if len(fields) == 0 {
+		return doc
+	}
+	return redactFields(doc, fields)
+}
+
+func redactFields(doc bson.D, fields map[string]bool) bson.D {
+	redacted := make(bson.D, len(doc))
+	for i, elem := range doc {
+		redacted[i].Name = elem.Name
+		last := elem.Name[strings.LastIndex(elem.Name, ".")+1:]
+		if fields[elem.Name] || fields[last] {
+			redacted[i].Value = RedactedValue
+		} else {
+			redacted[i].Value = redactValue(elem.Value, fields)
+		}
+	}
+	return redacted
+}
+
+func redactValue(v interface{}, fields map[string]bool) interface{} {
+	if values, ok := v.([]interface{}); ok {
+		redacted := make([]interface{}, len(values))
+		for i, value := range values {
+			redacted[i] = redactValue(value, fields)
+		}
+		return redacted
+	}
+	if doc, ok := asD(v); ok {
+		return redactFields(doc, fields)
+	}
+	return v
+}
+
+// RedactOps returns a copy of ops with their documents redacted by r, or
+// ops itself if r is nil.
+func RedactOps(r Redactor, ops []txn.Op) []txn.Op {
+	if r == nil {
+		return ops
+	}
+	redacted := make([]txn.Op, len(ops))
+	for i, op := range ops {
+		redacted[i] = op
+		redacted[i].Assert = redactOpDoc(r, op.C, op.Assert)
+		redacted[i].Insert = redactOpDoc(r, op.C, op.Insert)
+		redacted[i].Update = redactOpDoc(r, op.C, op.Update)
+	}
+	return redacted
+}
+
+// RedactTxn returns a copy of doc with the documents of its ops redacted
+// by r, or doc itself if r is nil.
+func RedactTxn(r Redactor, doc *TxnDoc) *TxnDoc {
+	if r == nil {
+		return doc
+	}
+	redacted := *doc
+	redacted.Ops = RedactOps(r, doc.Ops)
+	return &redacted
+}
+
+func redactOpDoc(r Redactor, collection string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	// Asserts of txn.DocExists and txn.DocMissing aren't documents, and
+	// are left alone.
+	doc, ok := asD(v)
+	if !ok {
+		return v
+	}
+	return r.RedactDoc(collection, doc)
+}
+
+// redactTxnRaw returns the raw transaction document with the documents of
+// its ops redacted by r. Fields it doesn't know are kept, so that the
+// transaction can still be read by DecodeTxn.
+func redactTxnRaw(r Redactor, raw bson.Raw) (bson.Raw, error) {
+	var doc bson.D
+	if err := raw.Unmarshal(&doc); err != nil {
+		return bson.Raw{}, errors.Annotate(err, "decoding txn to redact")
+	}
+	for i, elem := range doc {
+		ops, ok := elem.Value.([]interface{})
+		if elem.Name != "o" || !ok {
+			continue
+		}
+		redacted := make([]interface{}, len(ops))
+		for j, op := range ops {
+			redacted[j] = redactRawOp(r, op)
+		}
+		doc[i].Value = redacted
+	}
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return bson.Raw{}, errors.Annotate(err, "encoding redacted txn")
+	}
+	return bson.Raw{Kind: kindDocument, Data: data}, nil
+}
+
+// redactRawOp redacts an op decoded from a raw transaction document,
+// whose fields are named by the bson tags of txn.Op.
+func redactRawOp(r Redactor, op interface{}) interface{} {
+	fields, ok := asD(op)
+	if !ok {
+		return op
+	}
+	var collection string
+	for _, elem := range fields {
+		if elem.Name == "c" {
+			collection, _ = elem.Value.(string)
+		}
+	}
+	redacted := make(bson.D, len(fields))
+	for i, elem := range fields {
+		redacted[i] = elem
+		switch elem.Name {
+		case "a", "i", "u":
+			redacted[i].Value = redactOpDoc(r, collection, elem.Value)
+		}
+	}
+	return redacted
+}
+
+// formatOps formats ops for the runner's logs, redacted by its Redactor.
+func (tr *transactionRunner) formatOps(ops []txn.Op) string {
+	return FormatOps(RedactOps(tr.redactor, ops))
+}
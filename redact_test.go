@@ -0,0 +1,107 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"bytes"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type RedactSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&RedactSuite{})
+
+var testRedactor = FieldRedactor{
+	Fields:      []string{"password"},
+	Collections: map[string][]string{"settings": {"token"}},
+}
+
+func (*RedactSuite) TestRedactDoc(c *gc.C) {
+	doc := bson.D{
+		{"name", "bob"},
+		{"password", "hunter2"},
+		{"creds", bson.M{"password": "x", "user": "bob"}},
+		{"keys", []interface{}{bson.D{{"password", "y"}}, "z"}},
+		{"token", "t"},
+	}
+	c.Check(testRedactor.RedactDoc("users", doc), jc.DeepEquals, bson.D{
+		{"name", "bob"},
+		{"password", RedactedValue},
+		{"creds", bson.D{{"password", RedactedValue}, {"user", "bob"}}},
+		{"keys", []interface{}{bson.D{{"password", RedactedValue}}, "z"}},
+		{"token", "t"},
+	})
+	c.Check(testRedactor.RedactDoc("settings", bson.D{{"token", "t"}}), jc.DeepEquals, bson.D{{"token", RedactedValue}})
+	// The document itself isn't changed.
+	c.Check(doc[1].Value, gc.Equals, "hunter2")
+}
+
+func (*RedactSuite) TestRedactOps(c *gc.C) {
+	ops := []txn.Op{{
+		C:      "users",
+		Id:     "bob",
+		Assert: bson.M{"password": "old"},
+		Update: bson.M{"$set": bson.M{"creds.password": "new", "name": "bob"}},
+	}, {
+		C:      "users",
+		Id:     "alice",
+		Assert: txn.DocMissing,
+		Insert: struct {
+			Password string `bson:"password"`
+		}{"secret"},
+	}}
+	redacted := RedactOps(testRedactor, ops)
+	c.Check(redacted, jc.DeepEquals, []txn.Op{{
+		C:      "users",
+		Id:     "bob",
+		Assert: bson.D{{"password", RedactedValue}},
+		Update: bson.D{{"$set", bson.D{{"creds.password", RedactedValue}, {"name", "bob"}}}},
+	}, {
+		C:      "users",
+		Id:     "alice",
+		Assert: txn.DocMissing,
+		Insert: bson.D{{"password", RedactedValue}},
+	}})
+	c.Check(ops[0].Assert, jc.DeepEquals, bson.M{"password": "old"})
+	c.Check(RedactOps(nil, ops), jc.DeepEquals, ops)
+}
+
+func (*RedactSuite) TestArchive(c *gc.C) {
+	id := bson.NewObjectId()
+	data, err := bson.Marshal(bson.D{
+		{"_id", id},
+		{"s", int(TxnApplied)},
+		{"o", []txn.Op{{
+			C:      "users",
+			Id:     "bob",
+			Insert: bson.D{{"name", "bob"}, {"password", "hunter2"}},
+		}}},
+		{"n", "abcdef01"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	var buf bytes.Buffer
+	w, err := NewArchiveWriter(&buf, ArchiveOptions{Redactor: testRedactor})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(w.WriteRaw([]bson.Raw{{Kind: kindDocument, Data: data}}), jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+
+	r, err := NewArchiveReader(&buf)
+	c.Assert(err, jc.ErrorIsNil)
+	var raw bson.Raw
+	c.Assert(r.Next(&raw), jc.IsTrue)
+	doc, err := DecodeTxn(raw)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.Id, gc.Equals, id)
+	c.Check(doc.Nonce, gc.Equals, "abcdef01")
+	c.Assert(doc.Ops, gc.HasLen, 1)
+	c.Check(doc.Ops[0].Insert, jc.DeepEquals, bson.M{"name": "bob", "password": RedactedValue})
+}
@@ -0,0 +1,85 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// sessionRefresher refreshes a runner's session once enough attempts in a
+// row have failed in the way a stale socket makes them fail, such as after
+// a network blip or a change of primary, so that the next attempt is made
+// on a fresh socket rather than failing in the same way.
+type sessionRefresher struct {
+	refresh func()
+	after   int
+
+	mu          sync.Mutex
+	consecutive int
+	refreshes   int64
+}
+
+// newSessionRefresher returns a sessionRefresher for the settings in
+// params, or nil if sessions aren't to be refreshed.
+func newSessionRefresher(params RunnerParams) *sessionRefresher {
+	if params.RefreshSessionAfter <= 0 || params.Database == nil {
+		return nil
+	}
+	return &sessionRefresher{
+		refresh: params.Database.Session.Refresh,
+		after:   params.RefreshSessionAfter,
+	}
+}
+
+// done records the outcome of an attempt, and refreshes the session if it
+// was the last of too many stale socket errors. It is safe to call on a
+// nil sessionRefresher.
+func (r *sessionRefresher) done(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !isStaleSocketError(err) {
+		r.consecutive = 0
+		return
+	}
+	r.consecutive++
+	if r.consecutive < r.after {
+		return
+	}
+	runnerLogger.Infof("refreshing session after %d attempts in a row failed: %v", r.consecutive, err)
+	r.refresh()
+	r.consecutive = 0
+	r.refreshes++
+}
+
+// refreshCount returns how many times the session has been refreshed. It
+// is safe to call on a nil sessionRefresher.
+func (r *sessionRefresher) refreshCount() int64 {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.refreshes
+}
+
+// isStaleSocketError returns true if err is one that mgo returns when its
+// socket has been closed or stopped responding, which a fresh socket may
+// not suffer from.
+func isStaleSocketError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := errors.Cause(err).Error()
+	if strings.HasSuffix(msg, "unexpected message") || strings.Contains(msg, "Closed explicitly") {
+		return true
+	}
+	// With no server to reach, there is no socket to replace.
+	return isConnectionError(err) && !strings.Contains(msg, "no reachable servers")
+}
@@ -0,0 +1,76 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	stderrors "errors"
+	"io"
+	"net"
+
+	"github.com/juju/errors"
+	jujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type RefreshSuite struct {
+	jujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&RefreshSuite{})
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func (s *RefreshSuite) TestNotConfigured(c *gc.C) {
+	c.Check(newSessionRefresher(RunnerParams{}), gc.IsNil)
+	c.Check(newSessionRefresher(RunnerParams{RefreshSessionAfter: -1}), gc.IsNil)
+	var r *sessionRefresher
+	r.done(io.EOF)
+	c.Check(r.refreshCount(), gc.Equals, int64(0))
+}
+
+func (s *RefreshSuite) TestRefreshesAfterConsecutiveErrors(c *gc.C) {
+	refreshed := 0
+	r := &sessionRefresher{refresh: func() { refreshed++ }, after: 2}
+	r.done(stderrors.New("read tcp 10.0.0.1:37017: i/o timeout"))
+	c.Check(refreshed, gc.Equals, 0)
+	// Other outcomes break the run of errors.
+	r.done(nil)
+	r.done(errors.Annotate(io.EOF, "running transaction"))
+	c.Check(refreshed, gc.Equals, 0)
+	r.done(stderrors.New("unexpected message"))
+	c.Check(refreshed, gc.Equals, 1)
+	c.Check(r.refreshCount(), gc.Equals, int64(1))
+
+	// The count starts again after a refresh.
+	r.done(io.EOF)
+	c.Check(refreshed, gc.Equals, 1)
+	r.done(io.EOF)
+	c.Check(refreshed, gc.Equals, 2)
+}
+
+func (s *RefreshSuite) TestIsStaleSocketError(c *gc.C) {
+	for i, test := range []struct {
+		err    error
+		expect bool
+	}{
+		{nil, false},
+		{io.EOF, true},
+		{timeoutError{}, true},
+		{errors.Trace(timeoutError{}), true},
+		{stderrors.New("read tcp 10.0.0.1:37017: i/o timeout"), true},
+		{stderrors.New("Closed explicitly"), true},
+		{stderrors.New("read tcp 10.0.0.1:37017: connection reset by peer"), true},
+		{stderrors.New("no reachable servers"), false},
+		{ErrExcessiveContention, false},
+	} {
+		c.Logf("test %d: %v", i, test.err)
+		c.Check(isStaleSocketError(test.err), gc.Equals, test.expect)
+	}
+}
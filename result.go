@@ -0,0 +1,124 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"reflect"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+)
+
+// TxnResult describes a transaction applied by RunTransaction, for callers
+// that set Transaction.Result. It lets callers check or cache the versions
+// of the documents they changed without reading them again.
+type TxnResult struct {
+	// Ids are the ids of the transaction documents. There is one, unless
+	// the transaction was split up by TxnLimitSplit.
+	Ids []bson.ObjectId
+
+	// Revnos are the txn-revno values of the documents touched by the
+	// transaction once it was applied, in the order the documents were
+	// first touched. A document's txn-revno increases each time a
+	// transaction changes it, and is negative while it doesn't exist.
+	Revnos []DocRevno
+}
+
+// DocRevno is the txn-revno of a document.
+type DocRevno struct {
+	DocRef
+	Revno int64
+}
+
+// Id returns the id of the last transaction document, or "" if there is
+// none.
+func (r *TxnResult) Id() bson.ObjectId {
+	if len(r.Ids) == 0 {
+		return ""
+	}
+	return r.Ids[len(r.Ids)-1]
+}
+
+// Revno returns the txn-revno of the document with id in collection, and
+// false if the transaction didn't touch it.
+func (r *TxnResult) Revno(collection string, id interface{}) (int64, bool) {
+	for _, revno := range r.Revnos {
+		if revno.Collection == collection && reflect.DeepEqual(revno.Id, id) {
+			return revno.Revno, true
+		}
+	}
+	return 0, false
+}
+
+// record adds the outcome of the transaction id, which applied ops with
+// the txn-revnos mgo/txn saved on its document before applying it.
+func (r *TxnResult) record(id bson.ObjectId, ops []txn.Op, revnos []int64) {
+	r.Ids = append(r.Ids, id)
+	for _, revno := range appliedRevnos(ops, revnos) {
+		found := false
+		for i := range r.Revnos {
+			if r.Revnos[i].Collection == revno.Collection && reflect.DeepEqual(r.Revnos[i].Id, revno.Id) {
+				r.Revnos[i].Revno = revno.Revno
+				found = true
+				break
+			}
+		}
+		if !found {
+			r.Revnos = append(r.Revnos, revno)
+		}
+	}
+}
+
+// appliedRevnos returns the txn-revno of each document touched by ops once
+// they have been applied, given the txn-revno each op was applied at. It
+// follows the changes mgo/txn makes to txn-revno: an update increments
+// it, an insert makes it positive and a remove makes it negative.
+func appliedRevnos(ops []txn.Op, revnos []int64) []DocRevno {
+	var applied []DocRevno
+	for i, op := range ops {
+		if i >= len(revnos) {
+			break
+		}
+		revno := revnos[i]
+		switch {
+		case op.Insert != nil && revno < 0:
+			revno = -revno + 1
+		case op.Update != nil && revno >= 0:
+			revno++
+		case op.Remove && revno >= 0:
+			revno = -revno - 1
+		}
+		found := false
+		for j := range applied {
+			if applied[j].Collection == op.C && reflect.DeepEqual(applied[j].Id, op.Id) {
+				// Later ops on the same document are applied at the
+				// revno the earlier ones left it at.
+				applied[j].Revno = revno
+				found = true
+				break
+			}
+		}
+		if !found {
+			applied = append(applied, DocRevno{DocRef: DocRef{Collection: op.C, Id: op.Id}, Revno: revno})
+		}
+	}
+	return applied
+}
+
+// recordResult fills in transaction.Result for the applied transaction
+// id, from the txn-revnos saved on its document.
+func (tr *transactionRunner) recordResult(db *mgo.Database, transaction *Transaction, id bson.ObjectId) error {
+	var doc struct {
+		Revnos []int64 `bson:"r"`
+	}
+	q := db.C(tr.transactionCollectionName).FindId(id).Select(bson.M{"r": 1})
+	err := tr.withMaxTime(q).One(&doc)
+	if err != nil {
+		return errors.Annotatef(err, "reading revnos of applied txn %s", id.Hex())
+	}
+	transaction.Result.record(id, transaction.Ops, doc.Revnos)
+	return nil
+}
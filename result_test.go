@@ -0,0 +1,126 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type ResultSuite struct {
+	TxnSuite
+	txnRunner jujutxn.Runner
+}
+
+var _ = gc.Suite(&ResultSuite{})
+
+func (s *ResultSuite) SetUpTest(c *gc.C) {
+	s.TxnSuite.SetUpTest(c)
+	s.txnRunner = jujutxn.NewRunner(jujutxn.RunnerParams{Database: s.db})
+}
+
+func (s *ResultSuite) docRevno(c *gc.C, collection string, id interface{}) int64 {
+	var doc struct {
+		Revno int64 `bson:"txn-revno"`
+	}
+	err := s.db.C(collection).FindId(id).One(&doc)
+	c.Assert(err, jc.ErrorIsNil)
+	return doc.Revno
+}
+
+func (s *ResultSuite) TestResult(c *gc.C) {
+	var result jujutxn.TxnResult
+	err := s.txnRunner.RunTransaction(&jujutxn.Transaction{
+		Ops: []txn.Op{
+			{C: "coll", Id: "a", Insert: bson.M{"x": 1}},
+			{C: "coll", Id: "b", Insert: bson.M{"x": 1}},
+		},
+		Result: &result,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result.Ids, gc.HasLen, 1)
+	count, err := s.txns.FindId(result.Id()).Count()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(count, gc.Equals, 1)
+
+	revno, ok := result.Revno("coll", "a")
+	c.Check(ok, jc.IsTrue)
+	c.Check(revno, gc.Equals, s.docRevno(c, "coll", "a"))
+
+	result = jujutxn.TxnResult{}
+	err = s.txnRunner.RunTransaction(&jujutxn.Transaction{
+		Ops: []txn.Op{
+			{C: "coll", Id: "a", Assert: bson.M{"x": 1}, Update: bson.M{"$set": bson.M{"x": 2}}},
+			{C: "coll", Id: "b", Remove: true},
+		},
+		Result: &result,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	revno, ok = result.Revno("coll", "a")
+	c.Check(ok, jc.IsTrue)
+	c.Check(revno, gc.Equals, s.docRevno(c, "coll", "a"))
+	revno, ok = result.Revno("coll", "b")
+	c.Check(ok, jc.IsTrue)
+	c.Check(revno < 0, jc.IsTrue)
+	_, ok = result.Revno("coll", "c")
+	c.Check(ok, jc.IsFalse)
+}
+
+func (s *ResultSuite) TestResultOfSplitTxn(c *gc.C) {
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		Database:       s.db,
+		MaxOpsPerTxn:   1,
+		TxnLimitPolicy: jujutxn.TxnLimitSplit,
+	})
+	var result jujutxn.TxnResult
+	err := runner.RunTransaction(&jujutxn.Transaction{
+		Ops: []txn.Op{
+			{C: "coll", Id: "a", Insert: bson.M{"x": 1}},
+			{C: "coll", Id: "b", Insert: bson.M{"x": 1}},
+		},
+		Result: &result,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.Ids, gc.HasLen, 2)
+	for _, id := range []string{"a", "b"} {
+		revno, ok := result.Revno("coll", id)
+		c.Check(ok, jc.IsTrue)
+		c.Check(revno, gc.Equals, s.docRevno(c, "coll", id))
+	}
+}
+
+func (s *ResultSuite) TestNoResultOnFailure(c *gc.C) {
+	var result jujutxn.TxnResult
+	err := s.txnRunner.RunTransaction(&jujutxn.Transaction{
+		Ops:    []txn.Op{{C: "coll", Id: "a", Assert: txn.DocExists, Update: bson.M{"$set": bson.M{"x": 2}}}},
+		Result: &result,
+	})
+	c.Assert(err, gc.Equals, txn.ErrAborted)
+	c.Check(result.Ids, gc.HasLen, 0)
+	c.Check(result.Id(), gc.Equals, bson.ObjectId(""))
+}
+
+func (s *ResultSuite) TestAppliedRevnos(c *gc.C) {
+	ops := []txn.Op{
+		{C: "coll", Id: "new", Insert: bson.M{}},
+		{C: "coll", Id: "new", Update: bson.M{"$set": bson.M{"x": 1}}},
+		{C: "coll", Id: "old", Update: bson.M{"$set": bson.M{"x": 1}}},
+		{C: "coll", Id: "gone", Remove: true},
+		{C: "other", Id: "old", Assert: txn.DocExists},
+		{C: "coll", Id: "missing", Update: bson.M{"$set": bson.M{"x": 1}}},
+	}
+	// The revno each op is applied at, as assembled by mgo/txn.
+	revnos := []int64{-1, 2, 5, 3, 7, -4}
+	c.Check(jujutxn.AppliedRevnos(ops, revnos), jc.DeepEquals, []jujutxn.DocRevno{
+		{DocRef: jujutxn.DocRef{Collection: "coll", Id: "new"}, Revno: 3},
+		{DocRef: jujutxn.DocRef{Collection: "coll", Id: "old"}, Revno: 6},
+		{DocRef: jujutxn.DocRef{Collection: "coll", Id: "gone"}, Revno: -4},
+		{DocRef: jujutxn.DocRef{Collection: "other", Id: "old"}, Revno: 7},
+		{DocRef: jujutxn.DocRef{Collection: "coll", Id: "missing"}, Revno: -4},
+	})
+}
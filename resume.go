@@ -0,0 +1,201 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+)
+
+// defaultResumePageSize is the number of pending transactions that are
+// read from the database at a time when resuming.
+const defaultResumePageSize = 1000
+
+// ResumeOptions controls how pending transactions are resumed.
+type ResumeOptions struct {
+	// PageSize is the number of pending transaction ids read at a time.
+	// Only one page of ids is held in memory. It defaults to 1000.
+	PageSize int
+
+	// StartAfter, if set, causes only transactions with an id greater
+	// than it to be resumed. Passing the LastId from the ResumeStats of an
+	// earlier, interrupted, call continues from where that call stopped.
+	StartAfter bson.ObjectId
+
+	// Progress, if non-nil, is called after each page has been resumed
+	// with the stats so far.
+	Progress func(ResumeStats)
+
+	// PriorityCollections, if set, causes pending transactions with
+	// operations on any of these collections to be resumed before all
+	// others, so that critical subsystems can recover first.
+	PriorityCollections []string
+}
+
+// ResumeStats reports on the work done by ResumeTransactionsWithOptions.
+type ResumeStats struct {
+	// Pages is the number of pages of pending transactions read.
+	Pages int
+
+	// Resumed is the number of transactions that were resumed.
+	Resumed int
+
+	// PriorityResumed is the number of transactions resumed early because
+	// they touched one of ResumeOptions.PriorityCollections. These are
+	// included in Resumed.
+	PriorityResumed int
+
+	// Aborted is the number of transactions that were aborted when they
+	// were resumed, because their assertions no longer held. These are
+	// resolved, but are not included in Resumed.
+	Aborted int
+
+	// LastId is the id of the last transaction that was resumed
+	// successfully. It can be used as ResumeOptions.StartAfter to continue
+	// from this point.
+	LastId bson.ObjectId
+
+	// Duration is how long resuming took.
+	Duration time.Duration
+}
+
+// resumer is implemented by the mgo/txn runner, but not by the server side
+// transaction runner, which never has pending transactions to resume.
+type resumer interface {
+	Resume(id bson.ObjectId) error
+}
+
+// pendingTxnStates are the states of transactions that need resuming. They
+// are the states mgo/txn's ResumeAll resumes.
+var pendingTxnStates = []TxnState{TxnPreparing, TxnPrepared, TxnApplying}
+
+// ResumeTransactionsWithOptions is defined on ResumingRunner.
+func (tr *transactionRunner) ResumeTransactionsWithOptions(opts ResumeOptions) (ResumeStats, error) {
+	if err := tr.gate.Enter(); err != nil {
+		return ResumeStats{LastId: opts.StartAfter}, err
+	}
+	defer tr.gate.Exit()
+	start := tr.clock.Now()
+	stats := ResumeStats{LastId: opts.StartAfter}
+	runner := tr.newRunner(tr.db)
+	r, ok := runner.(resumer)
+	if !ok {
+		err := runner.ResumeAll()
+		stats.Duration = tr.clock.Now().Sub(start)
+		return stats, errors.Trace(err)
+	}
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultResumePageSize
+	}
+	txns := tr.db.C(tr.transactionCollectionName)
+	report := func() {
+		stats.Duration = tr.clock.Now().Sub(start)
+		if opts.Progress != nil {
+			opts.Progress(stats)
+		}
+	}
+	if len(opts.PriorityCollections) > 0 {
+		// The priority pass doesn't move LastId, as there may still be
+		// other transactions before the ones it resumes.
+		filter := bson.M{"o.c": bson.M{"$in": opts.PriorityCollections}}
+		err := resumePages(r, txns, filter, opts.StartAfter, pageSize, tr.operationTimeout, func(resumed, aborted int, _ bson.ObjectId) {
+			stats.Pages++
+			stats.Resumed += resumed
+			stats.PriorityResumed += resumed
+			stats.Aborted += aborted
+			report()
+		})
+		if err != nil {
+			stats.Duration = tr.clock.Now().Sub(start)
+			return stats, errors.Trace(err)
+		}
+	}
+	err := resumePages(r, txns, nil, opts.StartAfter, pageSize, tr.operationTimeout, func(resumed, aborted int, lastId bson.ObjectId) {
+		stats.Pages++
+		stats.Resumed += resumed
+		stats.Aborted += aborted
+		stats.LastId = lastId
+		report()
+	})
+	stats.Duration = tr.clock.Now().Sub(start)
+	return stats, errors.Trace(err)
+}
+
+// resumePages resumes the pending transactions matching filter with an id
+// greater than startAfter, reading pageSize ids at a time. After each page,
+// or part page if resuming a transaction fails, onPage is called with the
+// number of transactions that were resumed and that aborted, and the id of
+// the last one. If maxTime is non-zero, the server abandons a page query
+// that takes longer than it.
+func resumePages(
+	r resumer,
+	txns *mgo.Collection,
+	filter bson.M,
+	startAfter bson.ObjectId,
+	pageSize int,
+	maxTime time.Duration,
+	onPage func(resumed, aborted int, lastId bson.ObjectId),
+) error {
+	ids := make([]bson.ObjectId, 0, pageSize)
+	lastId := startAfter
+	for {
+		query := bson.M{"s": bson.M{"$in": pendingTxnStates}}
+		for key, value := range filter {
+			query[key] = value
+		}
+		if lastId != "" {
+			query["_id"] = bson.M{"$gt": lastId}
+		}
+		q := txns.Find(query).Select(bson.M{"_id": 1}).Sort("_id").Limit(pageSize)
+		if maxTime > 0 {
+			q.SetMaxTime(maxTime)
+		}
+		iter := q.Iter()
+		var doc struct {
+			Id bson.ObjectId `bson:"_id"`
+		}
+		ids = ids[:0]
+		for iter.Next(&doc) {
+			ids = append(ids, doc.Id)
+		}
+		if err := iter.Close(); err != nil {
+			return errors.Trace(err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		resumed, aborted := 0, 0
+		for _, id := range ids {
+			resumeLogger.Debugf("resuming transaction %s", id.Hex())
+			err := r.Resume(id)
+			switch err {
+			case nil:
+				resumed++
+			case txn.ErrAborted:
+				// Its assertions no longer hold, so it has been aborted,
+				// which resolves it as much as applying it would.
+				resumeLogger.Debugf("transaction %s aborted when resumed", id.Hex())
+				aborted++
+			case mgo.ErrNotFound:
+				// It completed and was pruned since we read the page.
+				resumed++
+			default:
+				if resumed+aborted > 0 {
+					onPage(resumed, aborted, lastId)
+				}
+				return errors.Annotatef(err, "resuming transaction %s", id.Hex())
+			}
+			lastId = id
+		}
+		onPage(resumed, aborted, lastId)
+		if len(ids) < pageSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type ResumeSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&ResumeSuite{})
+
+func (s *ResumeSuite) pendingTxns(c *gc.C, count int) []bson.ObjectId {
+	ids := make([]bson.ObjectId, count)
+	for i := range ids {
+		ids[i] = s.runInterruptedTxn(c, txn.Op{
+			C:      "coll",
+			Id:     i,
+			Insert: bson.M{},
+		})
+	}
+	return ids
+}
+
+func (s *ResumeSuite) pendingCount(c *gc.C) int {
+	count, err := s.txns.Find(bson.M{"s": bson.M{"$in": []int{1, 2, 3, 4}}}).Count()
+	c.Assert(err, jc.ErrorIsNil)
+	return count
+}
+
+func (s *ResumeSuite) TestResumeInPages(c *gc.C) {
+	ids := s.pendingTxns(c, 5)
+	c.Assert(s.pendingCount(c), gc.Equals, 5)
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		Database:      s.db,
+		ChangeLogName: "-",
+	}).(jujutxn.ResumingRunner)
+	var progress []jujutxn.ResumeStats
+	stats, err := runner.ResumeTransactionsWithOptions(jujutxn.ResumeOptions{
+		PageSize: 2,
+		Progress: func(stats jujutxn.ResumeStats) {
+			progress = append(progress, stats)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.Pages, gc.Equals, 3)
+	c.Check(stats.Resumed, gc.Equals, 5)
+	c.Check(stats.LastId, gc.Equals, ids[4])
+	c.Assert(progress, gc.HasLen, 3)
+	c.Check(progress[0].Resumed, gc.Equals, 2)
+	c.Check(progress[0].LastId, gc.Equals, ids[1])
+	c.Check(progress[1].Resumed, gc.Equals, 4)
+	c.Check(progress[1].LastId, gc.Equals, ids[3])
+	c.Check(s.pendingCount(c), gc.Equals, 0)
+	s.assertCollCount(c, "coll", 5)
+}
+
+func (s *ResumeSuite) TestResumeStartAfter(c *gc.C) {
+	ids := s.pendingTxns(c, 4)
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		Database:      s.db,
+		ChangeLogName: "-",
+	}).(jujutxn.ResumingRunner)
+	stats, err := runner.ResumeTransactionsWithOptions(jujutxn.ResumeOptions{
+		StartAfter: ids[1],
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.Pages, gc.Equals, 1)
+	c.Check(stats.Resumed, gc.Equals, 2)
+	c.Check(stats.LastId, gc.Equals, ids[3])
+	c.Check(s.pendingCount(c), gc.Equals, 2)
+	// ResumeTransactions picks up everything else.
+	c.Assert(runner.ResumeTransactions(), jc.ErrorIsNil)
+	c.Check(s.pendingCount(c), gc.Equals, 0)
+}
+
+func (s *ResumeSuite) TestResumeNothingPending(c *gc.C) {
+	s.runTxn(c, txn.Op{
+		C:      "coll",
+		Id:     0,
+		Insert: bson.M{},
+	})
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		Database:      s.db,
+		ChangeLogName: "-",
+	}).(jujutxn.ResumingRunner)
+	stats, err := runner.ResumeTransactionsWithOptions(jujutxn.ResumeOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.Pages, gc.Equals, 0)
+	c.Check(stats.Resumed, gc.Equals, 0)
+	c.Check(stats.LastId, gc.Equals, bson.ObjectId(""))
+}
+
+func (s *ResumeSuite) TestResumePriorityCollections(c *gc.C) {
+	ids := s.pendingTxns(c, 2)
+	s.runInterruptedTxn(c, txn.Op{
+		C:      "leases",
+		Id:     "lease",
+		Insert: bson.M{},
+	})
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		Database:      s.db,
+		ChangeLogName: "-",
+	}).(jujutxn.ResumingRunner)
+	var pendingAfterPage []int
+	stats, err := runner.ResumeTransactionsWithOptions(jujutxn.ResumeOptions{
+		PriorityCollections: []string{"leases", "units"},
+		Progress: func(stats jujutxn.ResumeStats) {
+			pendingAfterPage = append(pendingAfterPage, s.pendingCount(c))
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.Resumed, gc.Equals, 3)
+	c.Check(stats.PriorityResumed, gc.Equals, 1)
+	c.Check(stats.Pages, gc.Equals, 2)
+	// The lease transaction was resumed on its own first.
+	c.Check(pendingAfterPage, jc.DeepEquals, []int{2, 0})
+	c.Check(stats.LastId, gc.Equals, ids[1])
+	s.assertCollCount(c, "leases", 1)
+}
+
+func (s *ResumeSuite) TestResumeAborted(c *gc.C) {
+	s.runTxn(c, txn.Op{
+		C:      "coll",
+		Id:     "a",
+		Insert: bson.M{"x": 1},
+	})
+	// Interrupt a transaction before its assertion is checked, and then
+	// change the document so that the assertion fails when it is resumed.
+	txn.SetChaos(txn.Chaos{
+		KillChance: 1,
+		Breakpoint: "set-prepared",
+	})
+	id := s.runFailingTxn(c, txn.ErrChaos, txn.Op{
+		C:      "coll",
+		Id:     "a",
+		Assert: bson.M{"x": 1},
+		Update: bson.M{"$set": bson.M{"x": 2}},
+	})
+	txn.SetChaos(txn.Chaos{})
+	err := s.db.C("coll").UpdateId("a", bson.M{"$set": bson.M{"x": 3}})
+	c.Assert(err, jc.ErrorIsNil)
+	ids := s.pendingTxns(c, 1)
+
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		Database:      s.db,
+		ChangeLogName: "-",
+	}).(jujutxn.ResumingRunner)
+	stats, err := runner.ResumeTransactionsWithOptions(jujutxn.ResumeOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.Pages, gc.Equals, 1)
+	c.Check(stats.Resumed, gc.Equals, 1)
+	c.Check(stats.Aborted, gc.Equals, 1)
+	c.Check(stats.LastId, gc.Equals, ids[0])
+	c.Check(s.pendingCount(c), gc.Equals, 0)
+	var doc struct {
+		State int `bson:"s"`
+	}
+	c.Assert(s.txns.FindId(id).One(&doc), jc.ErrorIsNil)
+	c.Check(doc.State, gc.Equals, int(jujutxn.TxnAborted))
+	var coll struct {
+		X int `bson:"x"`
+	}
+	c.Assert(s.db.C("coll").FindId("a").One(&coll), jc.ErrorIsNil)
+	c.Check(coll.X, gc.Equals, 3)
+}
@@ -0,0 +1,72 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+)
+
+// AssertRevno returns an op that asserts that the document with id in
+// collection has the txn-revno revno, as returned by ReadRevno or
+// TxnResult.Revno. mgo/txn changes the txn-revno of a document each time a
+// transaction changes it, so the assertion fails if the document has been
+// changed since revno was read. A negative revno asserts that the
+// document doesn't exist, and 0 that it has never been changed by a
+// transaction.
+func AssertRevno(collection string, id interface{}, revno int64) txn.Op {
+	op := txn.Op{C: collection, Id: id}
+	switch {
+	case revno < 0:
+		op.Assert = txn.DocMissing
+	case revno == 0:
+		op.Assert = bson.D{{"txn-revno", bson.D{{"$exists", false}}}}
+	default:
+		op.Assert = bson.D{{"txn-revno", revno}}
+	}
+	return op
+}
+
+// ReadRevno returns the txn-revno of the document with id in coll, 0 if it
+// has never been changed by a transaction, or -1 if it doesn't exist.
+func ReadRevno(coll *mgo.Collection, id interface{}) (int64, error) {
+	var doc struct {
+		Revno int64 `bson:"txn-revno"`
+	}
+	err := coll.FindId(id).Select(bson.M{"txn-revno": 1}).One(&doc)
+	if err == mgo.ErrNotFound {
+		return -1, nil
+	} else if err != nil {
+		return 0, errors.Annotatef(err, "reading txn-revno of %q %v", coll.Name, id)
+	}
+	return doc.Revno, nil
+}
+
+// RevnoSource returns the ops of a transaction that is only to be applied
+// if the document it was built from hasn't changed since revno was read.
+type RevnoSource func(revno int64) ([]txn.Op, error)
+
+// RunWithRevno runs a compare-and-swap transaction on the document with id
+// in coll. Each attempt reads the document's txn-revno, passes it to
+// source, and runs the ops it returns with an AssertRevno op, so that the
+// transaction aborts if the document changed after it was read. Aborted
+// attempts are retried as Runner.Run retries them, with a new revno, until
+// the runner gives up with ErrExcessiveContention. source may return
+// ErrNoOperations if there is nothing to do, or ErrTransientFailure to try
+// again.
+func RunWithRevno(runner Runner, coll *mgo.Collection, id interface{}, source RevnoSource) error {
+	return runner.Run(func(attempt int) ([]txn.Op, error) {
+		revno, err := ReadRevno(coll, id)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		ops, err := source(revno)
+		if err != nil || len(ops) == 0 {
+			return ops, err
+		}
+		return append([]txn.Op{AssertRevno(coll.Name, id, revno)}, ops...), nil
+	})
+}
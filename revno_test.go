@@ -0,0 +1,105 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type RevnoSuite struct {
+	TxnSuite
+	txnRunner jujutxn.Runner
+}
+
+var _ = gc.Suite(&RevnoSuite{})
+
+func (s *RevnoSuite) SetUpTest(c *gc.C) {
+	s.TxnSuite.SetUpTest(c)
+	s.txnRunner = jujutxn.NewRunner(jujutxn.RunnerParams{Database: s.db})
+}
+
+func (s *RevnoSuite) TestAssertRevno(c *gc.C) {
+	c.Check(jujutxn.AssertRevno("coll", "a", -1), jc.DeepEquals, txn.Op{C: "coll", Id: "a", Assert: txn.DocMissing})
+	c.Check(jujutxn.AssertRevno("coll", "a", 0), jc.DeepEquals, txn.Op{
+		C: "coll", Id: "a", Assert: bson.D{{"txn-revno", bson.D{{"$exists", false}}}},
+	})
+	c.Check(jujutxn.AssertRevno("coll", "a", 3), jc.DeepEquals, txn.Op{
+		C: "coll", Id: "a", Assert: bson.D{{"txn-revno", int64(3)}},
+	})
+}
+
+func (s *RevnoSuite) TestReadRevno(c *gc.C) {
+	coll := s.db.C("coll")
+	revno, err := jujutxn.ReadRevno(coll, "a")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(revno, gc.Equals, int64(-1))
+
+	err = coll.Insert(bson.M{"_id": "a"})
+	c.Assert(err, jc.ErrorIsNil)
+	revno, err = jujutxn.ReadRevno(coll, "a")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(revno, gc.Equals, int64(0))
+
+	s.runTxn(c, txn.Op{C: "coll", Id: "b", Insert: bson.M{}})
+	revno, err = jujutxn.ReadRevno(coll, "b")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(revno, jc.GreaterThan, int64(0))
+}
+
+func (s *RevnoSuite) TestAssertRevnoAborts(c *gc.C) {
+	s.runTxn(c, txn.Op{C: "coll", Id: "a", Insert: bson.M{"x": 1}})
+	revno, err := jujutxn.ReadRevno(s.db.C("coll"), "a")
+	c.Assert(err, jc.ErrorIsNil)
+	s.runTxn(c, txn.Op{C: "coll", Id: "a", Update: bson.M{"$set": bson.M{"x": 2}}})
+
+	err = s.txnRunner.RunTransaction(&jujutxn.Transaction{Ops: []txn.Op{
+		jujutxn.AssertRevno("coll", "a", revno),
+		{C: "coll", Id: "a", Update: bson.M{"$set": bson.M{"x": 3}}},
+	}})
+	c.Check(err, gc.Equals, txn.ErrAborted)
+}
+
+func (s *RevnoSuite) TestRunWithRevnoRetries(c *gc.C) {
+	s.runTxn(c, txn.Op{C: "coll", Id: "a", Insert: bson.M{"x": 1}})
+	var seen []int64
+	err := jujutxn.RunWithRevno(s.txnRunner, s.db.C("coll"), "a", func(revno int64) ([]txn.Op, error) {
+		seen = append(seen, revno)
+		if len(seen) == 1 {
+			// Change the document between reading and writing it.
+			s.runTxn(c, txn.Op{C: "coll", Id: "a", Update: bson.M{"$inc": bson.M{"x": 1}}})
+		}
+		return []txn.Op{{C: "coll", Id: "a", Update: bson.M{"$inc": bson.M{"x": 10}}}}, nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(seen, gc.HasLen, 2)
+	c.Check(seen[1], gc.Equals, seen[0]+1)
+
+	var doc struct {
+		X int `bson:"x"`
+	}
+	err = s.db.C("coll").FindId("a").One(&doc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.X, gc.Equals, 12)
+}
+
+func (s *RevnoSuite) TestRunWithRevnoNoOperations(c *gc.C) {
+	err := jujutxn.RunWithRevno(s.txnRunner, s.db.C("coll"), "a", func(revno int64) ([]txn.Op, error) {
+		c.Check(revno, gc.Equals, int64(-1))
+		return nil, jujutxn.ErrNoOperations
+	})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *RevnoSuite) TestRunWithRevnoError(c *gc.C) {
+	err := jujutxn.RunWithRevno(s.txnRunner, s.db.C("coll"), "a", func(revno int64) ([]txn.Op, error) {
+		return nil, errors.New("boom")
+	})
+	c.Assert(err, gc.ErrorMatches, "boom")
+}
@@ -0,0 +1,92 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// NewScanSession returns a copy of session that reads from secondaries
+// matching one of the given tag sets, such as an analytics member, for use
+// as the ScanSession when pruning. The caller is responsible for closing it.
+//
+// Hidden members are not advertised to clients, so they can't be selected
+// by tags. To scan a hidden member, dial it directly (mgo.DialInfo.Direct)
+// and use that session, in Monotonic or Eventual mode, as the ScanSession.
+func NewScanSession(session *mgo.Session, tags ...bson.D) *mgo.Session {
+	scan := session.Copy()
+	scan.SetMode(mgo.Secondary, true)
+	scan.SelectServers(tags...)
+	return scan
+}
+
+// replSetMember is the part of a replSetGetStatus member that we need to
+// work out replication lag.
+type replSetMember struct {
+	Name       string    `bson:"name"`
+	StateStr   string    `bson:"stateStr"`
+	OptimeDate time.Time `bson:"optimeDate"`
+	Self       bool      `bson:"self"`
+}
+
+type replSetStatus struct {
+	Members []replSetMember `bson:"members"`
+}
+
+// replicationLag returns how far the member reporting status is behind the
+// primary, as seen by that member.
+func replicationLag(status replSetStatus) (time.Duration, error) {
+	var self, primary *replSetMember
+	for i := range status.Members {
+		member := &status.Members[i]
+		if member.Self {
+			self = member
+		}
+		if member.StateStr == "PRIMARY" {
+			primary = member
+		}
+	}
+	if self == nil {
+		return 0, errors.New("replica set status does not include this member")
+	}
+	if primary == nil {
+		return 0, errors.New("replica set has no primary")
+	}
+	lag := primary.OptimeDate.Sub(self.OptimeDate)
+	if lag < 0 {
+		lag = 0
+	}
+	return lag, nil
+}
+
+// scanLag returns how far the member that session reads from is behind
+// the primary.
+func scanLag(session *mgo.Session) (time.Duration, error) {
+	var status replSetStatus
+	if err := session.Run(bson.D{{"replSetGetStatus", 1}}, &status); err != nil {
+		return 0, errors.Annotate(err, "reading replica set status")
+	}
+	return replicationLag(status)
+}
+
+// checkScanLag returns an error if the scan session has fallen more than
+// maxLag behind the primary. A maxLag of 0 disables the check.
+func checkScanLag(session *mgo.Session, maxLag time.Duration) error {
+	if maxLag <= 0 {
+		return nil
+	}
+	lag, err := scanLag(session)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if lag > maxLag {
+		return errors.Errorf("scan member is %s behind the primary (max %s)", lag, maxLag)
+	}
+	pruneLogger.Tracef("scan member is %s behind the primary", lag)
+	return nil
+}
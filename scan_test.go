@@ -0,0 +1,97 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type ScanSessionSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&ScanSessionSuite{})
+
+func (s *ScanSessionSuite) TestPruneReadsThroughScanSession(c *gc.C) {
+	s.runTxn(c, txn.Op{
+		C:      "docs",
+		Id:     "1",
+		Insert: bson.M{"key": "value"},
+	})
+	scan := s.Session.Copy()
+	defer scan.Close()
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{ScanSession: scan})
+	stats, err := pruner.Prune(s.txns)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(stats.TxnsRemoved, gc.Equals, int64(1))
+	c.Check(stats.DocQueuesCleaned, gc.Equals, int64(1))
+}
+
+func (s *ScanSessionSuite) TestPruneChecksScanLag(c *gc.C) {
+	s.runTxn(c, txn.Op{
+		C:      "docs",
+		Id:     "1",
+		Insert: bson.M{"key": "value"},
+	})
+	scan := s.Session.Copy()
+	defer scan.Close()
+	// The test server isn't a replica set, so we can't tell how far
+	// behind it is, and must not prune.
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{
+		ScanSession: scan,
+		MaxScanLag:  time.Minute,
+	})
+	_, err := pruner.Prune(s.txns)
+	c.Assert(err, gc.ErrorMatches, "reading replica set status: .*")
+	count, err := s.txns.Count()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(count, gc.Equals, 1)
+}
+
+type ReplicationLagSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&ReplicationLagSuite{})
+
+func (*ReplicationLagSuite) TestLag(c *gc.C) {
+	now := time.Now().Truncate(time.Second)
+	lag, err := replicationLag(replSetStatus{Members: []replSetMember{
+		{Name: "a", StateStr: "PRIMARY", OptimeDate: now},
+		{Name: "b", StateStr: "SECONDARY", OptimeDate: now.Add(-time.Minute), Self: true},
+		{Name: "c", StateStr: "SECONDARY", OptimeDate: now.Add(-time.Hour)},
+	}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(lag, gc.Equals, time.Minute)
+}
+
+func (*ReplicationLagSuite) TestLagOfPrimary(c *gc.C) {
+	now := time.Now().Truncate(time.Second)
+	lag, err := replicationLag(replSetStatus{Members: []replSetMember{
+		{Name: "a", StateStr: "PRIMARY", OptimeDate: now, Self: true},
+		{Name: "b", StateStr: "SECONDARY", OptimeDate: now.Add(-time.Minute)},
+	}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(lag, gc.Equals, time.Duration(0))
+}
+
+func (*ReplicationLagSuite) TestNoPrimary(c *gc.C) {
+	_, err := replicationLag(replSetStatus{Members: []replSetMember{
+		{Name: "b", StateStr: "SECONDARY", Self: true},
+	}})
+	c.Assert(err, gc.ErrorMatches, "replica set has no primary")
+}
+
+func (*ReplicationLagSuite) TestNoSelf(c *gc.C) {
+	_, err := replicationLag(replSetStatus{Members: []replSetMember{
+		{Name: "a", StateStr: "PRIMARY"},
+	}})
+	c.Assert(err, gc.ErrorMatches, "replica set status does not include this member")
+}
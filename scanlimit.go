@@ -0,0 +1,35 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+// ScanLimiter limits how many collections are read at once, across all the
+// pruners that share it. Each collection read holds a cursor open on the
+// server, so reading too many at once floods it with cursors. This is
+// separate from how many batches of transactions are processed at once,
+// which is set by CleanAndPruneArgs.Multithreaded.
+type ScanLimiter struct {
+	slots chan struct{}
+}
+
+// NewScanLimiter returns a ScanLimiter that allows n collections to be
+// read at once. n is at least 1.
+func NewScanLimiter(n int) *ScanLimiter {
+	if n < 1 {
+		n = 1
+	}
+	return &ScanLimiter{slots: make(chan struct{}, n)}
+}
+
+// Limit returns how many collections may be read at once.
+func (l *ScanLimiter) Limit() int {
+	return cap(l.slots)
+}
+
+func (l *ScanLimiter) acquire() {
+	l.slots <- struct{}{}
+}
+
+func (l *ScanLimiter) release() {
+	<-l.slots
+}
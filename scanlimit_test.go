@@ -0,0 +1,82 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type ScanLimiterSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&ScanLimiterSuite{})
+
+func (*ScanLimiterSuite) TestLimit(c *gc.C) {
+	c.Check(NewScanLimiter(3).Limit(), gc.Equals, 3)
+	c.Check(NewScanLimiter(0).Limit(), gc.Equals, 1)
+}
+
+// scanCountingStore is a fakeStore that records how many collections are
+// being read at once. Its iterators are slow, so that reads overlap.
+type scanCountingStore struct {
+	*fakeStore
+	mu      sync.Mutex
+	reading int
+	most    int
+}
+
+func (s *scanCountingStore) findIds(collection string, ids interface{}, fields bson.M) docIter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reading++
+	if s.reading > s.most {
+		s.most = s.reading
+	}
+	iter := s.fakeStore.findIds(collection, ids, fields)
+	return &scanCountingIter{docIter: slowIter{docIter: iter, delay: time.Millisecond}, store: s}
+}
+
+type scanCountingIter struct {
+	docIter
+	store *scanCountingStore
+}
+
+func (it *scanCountingIter) Close() error {
+	it.store.mu.Lock()
+	it.store.reading--
+	it.store.mu.Unlock()
+	return it.docIter.Close()
+}
+
+func (*ScanLimiterSuite) TestPrunerReadsCollectionsConcurrently(c *gc.C) {
+	store := &scanCountingStore{fakeStore: &fakeStore{docs: make(map[string][]bson.M)}}
+	keys := make(docKeySet)
+	for i := 0; i < 4; i++ {
+		collection := fmt.Sprintf("coll%d", i)
+		for j := 0; j < 5; j++ {
+			id := fmt.Sprintf("doc-%d", j)
+			store.docs[collection] = append(store.docs[collection], bson.M{"_id": id, "txn-queue": []string{}})
+			keys[docKey{Collection: collection, DocId: id}] = struct{}{}
+		}
+	}
+	// The missing document is looked for in the stash.
+	keys[docKey{Collection: "coll0", DocId: "gone"}] = struct{}{}
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{CollectionScans: NewScanLimiter(2)})
+	docs, err := pruner.lookupDocs(keys, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(docs, gc.HasLen, 20)
+	c.Check(pruner.stats.DocReads, gc.Equals, int64(20))
+	c.Check(pruner.stats.CollectionQueries, gc.Equals, int64(4))
+	c.Check(pruner.stats.DocStillMissing, gc.Equals, int64(1))
+	c.Check(pruner.CollectionStats(), gc.HasLen, 4)
+	c.Check(store.most, gc.Equals, 2)
+}
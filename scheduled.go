@@ -0,0 +1,370 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+)
+
+const (
+	defaultScheduledURL               = "localhost:27017"
+	defaultScheduledSlice             = 5 * time.Minute
+	defaultScheduledDialTimeout       = 10 * time.Second
+	defaultScheduledHeartbeatInterval = 10 * time.Second
+	defaultScheduledHeartbeatStall    = 5 * time.Minute
+
+	// heartbeatMissedLimit is how many heartbeats can be missed before
+	// the health endpoint reports a failure.
+	heartbeatMissedLimit = 3
+)
+
+// ScheduledPruneConfig configures RunScheduledPrune.
+type ScheduledPruneConfig struct {
+	// URL is the mongo URL to connect to. It defaults to localhost:27017.
+	URL string
+
+	// Database is the database holding the transactions. It is required.
+	Database string
+
+	// TxnsName is the name of the txns collection. It defaults to "txns".
+	TxnsName string
+
+	// Slice is how long to prune for. It defaults to 5 minutes.
+	Slice time.Duration
+
+	// DialTimeout is how long to wait to connect to mongo. It defaults
+	// to 10 seconds.
+	DialTimeout time.Duration
+
+	// HeartbeatFile, if set, is a file that the time is written to every
+	// HeartbeatInterval, so that a liveness probe can check its age.
+	HeartbeatFile string
+
+	// HeartbeatAddr, if set, is an address to serve /healthz on for
+	// liveness probes. It reports a failure once heartbeats have been
+	// missed.
+	HeartbeatAddr string
+
+	// HeartbeatInterval is how often to heartbeat. It defaults to 10
+	// seconds.
+	HeartbeatInterval time.Duration
+
+	// HeartbeatStallTimeout is how long pruning can go without reporting
+	// any progress before heartbeats stop, so that a prune that is stuck
+	// on the server, or suspended for load, fails its liveness probe. It
+	// defaults to 5 minutes.
+	HeartbeatStallTimeout time.Duration
+
+	// PruneOptions tunes how pruning is done. See PruneBudgeted.
+	PruneOptions PruneOptions
+}
+
+func (config *ScheduledPruneConfig) validate() error {
+	if config.Database == "" {
+		return errors.NotValidf("missing Database")
+	}
+	if config.URL == "" {
+		config.URL = defaultScheduledURL
+	}
+	if config.TxnsName == "" {
+		config.TxnsName = "txns"
+	}
+	if config.Slice == 0 {
+		config.Slice = defaultScheduledSlice
+	}
+	if config.DialTimeout == 0 {
+		config.DialTimeout = defaultScheduledDialTimeout
+	}
+	if config.HeartbeatInterval == 0 {
+		config.HeartbeatInterval = defaultScheduledHeartbeatInterval
+	}
+	if config.HeartbeatStallTimeout == 0 {
+		config.HeartbeatStallTimeout = defaultScheduledHeartbeatStall
+	}
+	if config.Slice < 0 {
+		return errors.Errorf("Slice (%s) must not be negative", config.Slice)
+	}
+	if config.DialTimeout < 0 {
+		return errors.Errorf("DialTimeout (%s) must not be negative", config.DialTimeout)
+	}
+	if config.HeartbeatInterval < 0 {
+		return errors.Errorf("HeartbeatInterval (%s) must not be negative", config.HeartbeatInterval)
+	}
+	if config.HeartbeatStallTimeout < 0 {
+		return errors.Errorf("HeartbeatStallTimeout (%s) must not be negative", config.HeartbeatStallTimeout)
+	}
+	return nil
+}
+
+// scheduledPruneSettings is the format of the file named by
+// TXN_PRUNE_CONFIG. Durations are written like "5m".
+type scheduledPruneSettings struct {
+	URL                   string `json:"url"`
+	Database              string `json:"database"`
+	TxnsName              string `json:"txns"`
+	Slice                 string `json:"slice"`
+	DialTimeout           string `json:"dial-timeout"`
+	HeartbeatFile         string `json:"heartbeat-file"`
+	HeartbeatAddr         string `json:"heartbeat-addr"`
+	HeartbeatInterval     string `json:"heartbeat-interval"`
+	HeartbeatStallTimeout string `json:"heartbeat-stall-timeout"`
+}
+
+// ScheduledPruneConfigFromEnv reads a ScheduledPruneConfig from the
+// environment. If TXN_PRUNE_CONFIG names a JSON file, the config is read
+// from it first, and then overridden by these variables:
+//
+//	TXN_PRUNE_URL, TXN_PRUNE_DATABASE, TXN_PRUNE_TXNS, TXN_PRUNE_SLICE,
+//	TXN_PRUNE_DIAL_TIMEOUT, TXN_PRUNE_HEARTBEAT_FILE,
+//	TXN_PRUNE_HEARTBEAT_ADDR, TXN_PRUNE_HEARTBEAT_INTERVAL and
+//	TXN_PRUNE_HEARTBEAT_STALL_TIMEOUT.
+//
+// The file uses the lower case names without the prefix, with "-" in
+// place of "_", and "txns" for TXN_PRUNE_TXNS.
+func ScheduledPruneConfigFromEnv() (ScheduledPruneConfig, error) {
+	return scheduledPruneConfigFromEnv(os.Getenv)
+}
+
+func scheduledPruneConfigFromEnv(getenv func(string) string) (ScheduledPruneConfig, error) {
+	var config ScheduledPruneConfig
+	var settings scheduledPruneSettings
+	if path := getenv("TXN_PRUNE_CONFIG"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config, errors.Annotate(err, "reading prune config")
+		}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return config, errors.Annotatef(err, "parsing prune config %q", path)
+		}
+	}
+	for name, field := range map[string]*string{
+		"TXN_PRUNE_URL":                     &settings.URL,
+		"TXN_PRUNE_DATABASE":                &settings.Database,
+		"TXN_PRUNE_TXNS":                    &settings.TxnsName,
+		"TXN_PRUNE_SLICE":                   &settings.Slice,
+		"TXN_PRUNE_DIAL_TIMEOUT":            &settings.DialTimeout,
+		"TXN_PRUNE_HEARTBEAT_FILE":          &settings.HeartbeatFile,
+		"TXN_PRUNE_HEARTBEAT_ADDR":          &settings.HeartbeatAddr,
+		"TXN_PRUNE_HEARTBEAT_INTERVAL":      &settings.HeartbeatInterval,
+		"TXN_PRUNE_HEARTBEAT_STALL_TIMEOUT": &settings.HeartbeatStallTimeout,
+	} {
+		if value := getenv(name); value != "" {
+			*field = value
+		}
+	}
+	config.URL = settings.URL
+	config.Database = settings.Database
+	config.TxnsName = settings.TxnsName
+	config.HeartbeatFile = settings.HeartbeatFile
+	config.HeartbeatAddr = settings.HeartbeatAddr
+	for _, d := range []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"slice", settings.Slice, &config.Slice},
+		{"dial timeout", settings.DialTimeout, &config.DialTimeout},
+		{"heartbeat interval", settings.HeartbeatInterval, &config.HeartbeatInterval},
+		{"heartbeat stall timeout", settings.HeartbeatStallTimeout, &config.HeartbeatStallTimeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		value, err := time.ParseDuration(d.value)
+		if err != nil {
+			return config, errors.Annotatef(err, "parsing %s", d.name)
+		}
+		*d.field = value
+	}
+	return config, nil
+}
+
+// RunScheduledPrune connects to mongo and prunes for a slice of time with
+// PruneBudgeted. It is meant to be the whole of a program that is run on
+// a schedule in a container, eg by a Kubernetes CronJob:
+//
+//	config, err := txn.ScheduledPruneConfigFromEnv()
+//	if err == nil {
+//		_, err = txn.RunScheduledPrune(config)
+//	}
+//
+// While it runs, it heartbeats for liveness probes as configured, for as
+// long as pruning keeps making progress. On
+// SIGTERM or SIGINT, it stops pruning at the end of the current batch and
+// records its checkpoint, so the next run carries on from there.
+func RunScheduledPrune(config ScheduledPruneConfig) (BudgetedPruneResult, error) {
+	var result BudgetedPruneResult
+	if err := config.validate(); err != nil {
+		return result, errors.Trace(err)
+	}
+	hb, err := startHeartbeat(config.HeartbeatFile, config.HeartbeatAddr,
+		config.HeartbeatInterval, config.HeartbeatStallTimeout)
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+	defer hb.stop()
+
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	defer close(finished)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case sig := <-signals:
+			pruneLogger.Infof("received %v, stopping pruning", sig)
+			close(stop)
+		case <-finished:
+		}
+	}()
+
+	session, err := mgo.DialWithTimeout(config.URL, config.DialTimeout)
+	if err != nil {
+		return result, errors.Annotate(err, "connecting to mongo")
+	}
+	defer session.Close()
+	result, err = pruneBudgeted(session.DB(config.Database), config.TxnsName,
+		config.Slice, config.PruneOptions, stop, hb.watch)
+	return result, errors.Trace(err)
+}
+
+// heartbeat records that a scheduled prune is still alive, for liveness
+// probes.
+type heartbeat struct {
+	file     string
+	interval time.Duration
+	stall    time.Duration
+	server   *http.Server
+	stopCh   chan struct{}
+	done     chan struct{}
+
+	mu      sync.Mutex
+	last    time.Time
+	job     *PruneJob
+	stalled bool
+}
+
+// startHeartbeat beats every interval until stop is called. It writes the
+// time to file, and serves /healthz on addr, if they are set. Once a job
+// is being watched, it only beats while the job has reported progress
+// within stall.
+func startHeartbeat(file, addr string, interval, stall time.Duration) (*heartbeat, error) {
+	hb := &heartbeat{
+		file:     file,
+		interval: interval,
+		stall:    stall,
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if addr != "" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, errors.Annotate(err, "listening for health checks")
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", hb)
+		hb.server = &http.Server{Handler: mux}
+		go func() {
+			if err := hb.server.Serve(listener); err != http.ErrServerClosed {
+				pruneLogger.Warningf("health check server stopped: %v", err)
+			}
+		}()
+	}
+	hb.beat(time.Now())
+	go hb.loop()
+	return hb, nil
+}
+
+func (hb *heartbeat) loop() {
+	defer close(hb.done)
+	ticker := time.NewTicker(hb.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hb.stopCh:
+			return
+		case now := <-ticker.C:
+			if hb.alive(now) {
+				hb.beat(now)
+			}
+		}
+	}
+}
+
+// watch ties the heartbeat to the progress of job.
+func (hb *heartbeat) watch(job *PruneJob) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.job = job
+}
+
+// alive reports whether the watched job, if any, is still making
+// progress. A paused or finished job isn't expected to.
+func (hb *heartbeat) alive(now time.Time) bool {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	if hb.job == nil {
+		return true
+	}
+	status := hb.job.Status()
+	if status.State == PruneJobPaused || status.State == PruneJobDone {
+		return true
+	}
+	idle := now.Sub(status.LastProgress)
+	if idle <= hb.stall {
+		hb.stalled = false
+		return true
+	}
+	if !hb.stalled {
+		pruneLogger.Warningf("pruning has made no progress for %s, stopping heartbeats", idle.Round(time.Second))
+		hb.stalled = true
+	}
+	return false
+}
+
+func (hb *heartbeat) beat(now time.Time) {
+	hb.mu.Lock()
+	hb.last = now
+	hb.mu.Unlock()
+	if hb.file == "" {
+		return
+	}
+	data := []byte(now.UTC().Format(time.RFC3339) + "\n")
+	if err := os.WriteFile(hb.file, data, 0644); err != nil {
+		pruneLogger.Warningf("unable to write heartbeat: %v", err)
+	}
+}
+
+// ServeHTTP reports whether heartbeats are still being made.
+func (hb *heartbeat) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	hb.mu.Lock()
+	age := time.Since(hb.last)
+	hb.mu.Unlock()
+	if age > heartbeatMissedLimit*hb.interval {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "last heartbeat %s ago\n", age.Round(time.Second))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (hb *heartbeat) stop() {
+	close(hb.stopCh)
+	<-hb.done
+	if hb.server != nil {
+		hb.server.Close()
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type ScheduledPruneSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&ScheduledPruneSuite{})
+
+func (*ScheduledPruneSuite) TestConfigFromEnv(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "prune.json")
+	err := os.WriteFile(path, []byte(`{
+		"url": "mongo:27017",
+		"database": "juju",
+		"slice": "1m",
+		"heartbeat-file": "/tmp/heartbeat"
+	}`), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	env := map[string]string{
+		"TXN_PRUNE_CONFIG":             path,
+		"TXN_PRUNE_SLICE":              "2m",
+		"TXN_PRUNE_HEARTBEAT_INTERVAL": "5s",
+	}
+	config, err := scheduledPruneConfigFromEnv(func(name string) string {
+		return env[name]
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(config, jc.DeepEquals, ScheduledPruneConfig{
+		URL:               "mongo:27017",
+		Database:          "juju",
+		Slice:             2 * time.Minute,
+		HeartbeatFile:     "/tmp/heartbeat",
+		HeartbeatInterval: 5 * time.Second,
+	})
+
+	c.Assert(config.validate(), jc.ErrorIsNil)
+	c.Check(config.TxnsName, gc.Equals, "txns")
+	c.Check(config.DialTimeout, gc.Equals, defaultScheduledDialTimeout)
+}
+
+func (*ScheduledPruneSuite) TestConfigFromEnvBadDuration(c *gc.C) {
+	_, err := scheduledPruneConfigFromEnv(func(name string) string {
+		if name == "TXN_PRUNE_SLICE" {
+			return "soon"
+		}
+		return ""
+	})
+	c.Check(err, gc.ErrorMatches, `parsing slice: time: invalid duration "soon"`)
+}
+
+func (*ScheduledPruneSuite) TestValidate(c *gc.C) {
+	config := ScheduledPruneConfig{}
+	c.Check(config.validate(), gc.ErrorMatches, "missing Database not valid")
+	config = ScheduledPruneConfig{Database: "juju", Slice: -time.Second}
+	c.Check(config.validate(), gc.ErrorMatches, `Slice \(-1s\) must not be negative`)
+}
+
+func (*ScheduledPruneSuite) TestHeartbeat(c *gc.C) {
+	file := filepath.Join(c.MkDir(), "heartbeat")
+	hb, err := startHeartbeat(file, "", time.Minute, time.Minute)
+	c.Assert(err, jc.ErrorIsNil)
+	defer hb.stop()
+	data, err := os.ReadFile(file)
+	c.Assert(err, jc.ErrorIsNil)
+	beat, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(time.Since(beat) < time.Minute, jc.IsTrue)
+
+	rec := httptest.NewRecorder()
+	hb.ServeHTTP(rec, nil)
+	c.Check(rec.Code, gc.Equals, http.StatusOK)
+
+	hb.beat(time.Now().Add(-time.Hour))
+	rec = httptest.NewRecorder()
+	hb.ServeHTTP(rec, nil)
+	c.Check(rec.Code, gc.Equals, http.StatusServiceUnavailable)
+}
+
+func (*ScheduledPruneSuite) TestHeartbeatFollowsProgress(c *gc.C) {
+	hb := &heartbeat{stall: time.Minute}
+	c.Check(hb.alive(time.Now().Add(time.Hour)), jc.IsTrue)
+
+	job := newPruneJob()
+	hb.watch(job)
+	c.Check(hb.alive(time.Now()), jc.IsTrue)
+	// A job that is stuck, eg waiting for the server or for load to
+	// drop, stops the heartbeat.
+	c.Check(hb.alive(time.Now().Add(2*time.Minute)), jc.IsFalse)
+
+	job.addProgress(ProgressMessage{Phase: PrunePhaseScanning, Batch: 1})
+	c.Check(hb.alive(time.Now().Add(30*time.Second)), jc.IsTrue)
+
+	job.Pause()
+	c.Check(hb.alive(time.Now().Add(time.Hour)), jc.IsTrue)
+	job.Resume()
+	job.finish(CleanupStats{}, nil)
+	c.Check(hb.alive(time.Now().Add(time.Hour)), jc.IsTrue)
+}
@@ -0,0 +1,127 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+const (
+	// slowQueriesId is the _id of the document in txns.prune that keeps
+	// the most recent SlowQueries.
+	slowQueriesId = "slow-queries"
+
+	// maxSlowQueriesKept is how many SlowQueries are kept in txns.prune.
+	maxSlowQueriesKept = 20
+
+	// maxSlowQueryExplains is the most queries explained by one pruner,
+	// as explaining with execution stats runs the query again.
+	maxSlowQueryExplains = 5
+)
+
+// SlowQuery is a pruner query that took longer than ExplainSlowQueries,
+// with the server's explanation of how it ran it.
+type SlowQuery struct {
+	// Time is when the query finished.
+	Time time.Time `bson:"time" json:"time"`
+
+	// Collection is the collection that was queried, Worker the pruner
+	// that queried it, and Batch the batch of transactions it was for.
+	Collection string `bson:"collection" json:"collection"`
+	Worker     string `bson:"worker" json:"worker"`
+	Batch      int    `bson:"batch" json:"batch"`
+
+	// Duration is how long the query took.
+	Duration time.Duration `bson:"duration" json:"duration"`
+
+	// Explain is the output of explain, with execution stats, for the
+	// query, as JSON. It is kept as JSON because it has fields starting
+	// with "$", which older servers don't store. A slow read of
+	// transactions is explained as the scan of a single batch from the
+	// start, as the cursor it was read from can't be explained.
+	Explain json.RawMessage `bson:"explain" json:"explain"`
+}
+
+// explainSlowQuery explains query, which took elapsed, if it took longer
+// than ExplainSlowQueries. It may be called while reading several
+// collections at once.
+func (p *IncrementalPruner) explainSlowQuery(explainer queryExplainer, query findQuery, elapsed time.Duration) {
+	if p.explainSlow <= 0 || elapsed < p.explainSlow {
+		return
+	}
+	p.readMu.Lock()
+	p.stats.SlowQueries++
+	explain := p.slowExplains < maxSlowQueryExplains
+	if explain {
+		p.slowExplains++
+	}
+	p.readMu.Unlock()
+	if !explain {
+		pruneLogger.Debugf("query of %q took %s", query.collection, elapsed)
+		return
+	}
+	var result bson.M
+	if err := explainer.explain(query, explainExecutionStats, &result); err != nil {
+		pruneLogger.Warningf("query of %q took %s, unable to explain it: %v", query.collection, elapsed, err)
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		pruneLogger.Warningf("query of %q took %s, unable to encode its explanation: %v", query.collection, elapsed, err)
+		return
+	}
+	pruneLogger.Debugf("query of %q took %s, explained as: %s", query.collection, elapsed, data)
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	p.slowQueries = append(p.slowQueries, SlowQuery{
+		Time:       time.Now().UTC(),
+		Collection: query.collection,
+		Worker:     p.worker(),
+		Batch:      p.batch,
+		Duration:   elapsed,
+		Explain:    data,
+	})
+}
+
+// SlowQueries returns the queries explained because they took longer
+// than ExplainSlowQueries.
+func (p *IncrementalPruner) SlowQueries() []SlowQuery {
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	return append([]SlowQuery(nil), p.slowQueries...)
+}
+
+// recordSlowQueries adds queries to those kept in the txns.prune
+// collection for txns, keeping the most recent.
+func recordSlowQueries(txns *mgo.Collection, queries []SlowQuery) error {
+	if len(queries) == 0 {
+		return nil
+	}
+	_, err := txns.Database.C(txnsPruneC(txns.Name)).UpsertId(slowQueriesId, bson.M{
+		"$push": bson.M{"queries": bson.M{
+			"$each":  queries,
+			"$slice": -maxSlowQueriesKept,
+		}},
+	})
+	return errors.Annotate(err, "recording slow queries")
+}
+
+// ReadSlowQueries returns the most recent queries explained by
+// CleanAndPrune because they were slow, oldest first. It returns an empty
+// list if there aren't any.
+func ReadSlowQueries(db *mgo.Database, txnsName string) ([]SlowQuery, error) {
+	var doc struct {
+		Queries []SlowQuery `bson:"queries"`
+	}
+	err := db.C(txnsPruneC(txnsName)).FindId(slowQueriesId).One(&doc)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, errors.Annotate(err, "reading slow queries")
+	}
+	return doc.Queries, nil
+}
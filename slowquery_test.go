@@ -0,0 +1,55 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type SlowQuerySuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&SlowQuerySuite{})
+
+func (s *SlowQuerySuite) TestCleanAndPruneExplainsSlowQueries(c *gc.C) {
+	for i := 0; i < 5; i++ {
+		s.runTxn(c, txn.Op{C: "coll", Id: i, Insert: bson.M{}})
+	}
+	queries, err := jujutxn.ReadSlowQueries(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(queries, gc.HasLen, 0)
+
+	// Every query is slow.
+	stats, err := jujutxn.CleanAndPrune(jujutxn.CleanAndPruneArgs{
+		Txns:               s.txns,
+		ExplainSlowQueries: time.Nanosecond,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(stats.SlowQueries, gc.Not(gc.HasLen), 0)
+	c.Check(stats.Pruner.SlowQueries >= int64(len(stats.SlowQueries)), jc.IsTrue)
+	c.Check(stats.SlowQueries[0].Collection, gc.Equals, "txns")
+	c.Check(stats.SlowQueries[0].Worker, gc.Equals, "forward")
+	var explain struct {
+		ExecutionStats struct {
+			NReturned int `json:"nReturned"`
+		} `json:"executionStats"`
+	}
+	c.Assert(json.Unmarshal(stats.SlowQueries[0].Explain, &explain), jc.ErrorIsNil)
+	c.Check(explain.ExecutionStats.NReturned, gc.Equals, 5)
+
+	queries, err = jujutxn.ReadSlowQueries(s.db, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(queries, gc.HasLen, len(stats.SlowQueries))
+	c.Check(queries[0].Collection, gc.Equals, "txns")
+	c.Check(string(queries[0].Explain), gc.Equals, string(stats.SlowQueries[0].Explain))
+}
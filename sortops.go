@@ -0,0 +1,51 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+)
+
+// sortOps returns a copy of ops sorted by collection and then document id,
+// and whether that changed their order. The sort is stable, so operations
+// on the same document stay in the order they were given. Ids are ordered
+// by their bson encoding, which is arbitrary but the same in every
+// process, and that is all that matters for concurrent transactions to
+// queue on their documents in the same order.
+func sortOps(ops []txn.Op) ([]txn.Op, bool) {
+	keys := make([][]byte, len(ops))
+	for i, op := range ops {
+		data, err := bson.Marshal(bson.D{{"_id", op.Id}})
+		if err != nil {
+			// mgo/txn will fail to encode the id too, so leave
+			// the ops as they are for it to report.
+			return ops, false
+		}
+		keys[i] = data
+	}
+	order := make([]int, len(ops))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := ops[order[i]], ops[order[j]]
+		if a.C != b.C {
+			return a.C < b.C
+		}
+		return bytes.Compare(keys[order[i]], keys[order[j]]) < 0
+	})
+	sorted := make([]txn.Op, len(ops))
+	changed := false
+	for i, from := range order {
+		sorted[i] = ops[from]
+		if from != i {
+			changed = true
+		}
+	}
+	return sorted, changed
+}
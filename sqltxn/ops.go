@@ -0,0 +1,311 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package sqltxn
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+)
+
+// toM converts a document given to a txn.Op (a struct, bson.M, bson.D,
+// ...) into a bson.M by round-tripping it through bson, so that field
+// names and types match what would have been stored in mongo.
+func toM(doc interface{}) (bson.M, error) {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var m bson.M
+	if err := bson.Unmarshal(data, &m); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return m, nil
+}
+
+// assertionHolds returns true if the assertion of an op holds for doc,
+// which is nil if the document is missing.
+func assertionHolds(doc bson.M, assert interface{}) (bool, error) {
+	switch assert {
+	case nil:
+		return true, nil
+	case txn.DocExists:
+		return doc != nil, nil
+	case txn.DocMissing:
+		return doc == nil, nil
+	}
+	if doc == nil {
+		return false, nil
+	}
+	return matches(doc, assert)
+}
+
+// matches returns true if doc satisfies the assertion query. Only equality
+// on (dotted) field names, and the $eq, $ne, $exists, $in and $nin
+// operators are supported, as the query can't be run by a SQL server.
+func matches(doc bson.M, query interface{}) (bool, error) {
+	q, err := toM(query)
+	if err != nil {
+		return false, errors.Annotate(err, "reading assertion")
+	}
+	for field, cond := range q {
+		if strings.HasPrefix(field, "$") {
+			return false, errors.NotSupportedf("assertion operator %q", field)
+		}
+		value, present := lookup(doc, field)
+		ok, err := matchField(value, present, cond)
+		if err != nil {
+			return false, errors.Annotatef(err, "field %q", field)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func matchField(value interface{}, present bool, cond interface{}) (bool, error) {
+	ops, ok := cond.(bson.M)
+	if !ok || !hasOperators(ops) {
+		return present && equal(value, cond), nil
+	}
+	for op, arg := range ops {
+		var ok bool
+		switch op {
+		case "$eq":
+			ok = present && equal(value, arg)
+		case "$ne":
+			ok = !present || !equal(value, arg)
+		case "$exists":
+			ok = present == truthy(arg)
+		case "$in", "$nin":
+			list, isList := arg.([]interface{})
+			if !isList {
+				return false, errors.NotValidf("%s argument %v", op, arg)
+			}
+			found := false
+			for _, item := range list {
+				if present && equal(value, item) {
+					found = true
+					break
+				}
+			}
+			ok = found == (op == "$in")
+		default:
+			return false, errors.NotSupportedf("assertion operator %q", op)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// equal returns true if a and b hold the same value, comparing numbers
+// by value as mongo does, so that an int assertion matches an int64 or
+// float64 field.
+func equal(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	switch a := a.(type) {
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case bson.M:
+		b, ok := b.(bson.M)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, found := b[key]
+			if !found || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// number returns v as a float64 if it is one of the numeric types that
+// bson decodes to.
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func hasOperators(m bson.M) bool {
+	for key := range m {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	}
+	return v != nil
+}
+
+// lookup returns the value of a dotted field name in doc.
+func lookup(doc bson.M, field string) (interface{}, bool) {
+	parts := strings.Split(field, ".")
+	var current interface{} = doc
+	for _, part := range parts {
+		m, ok := current.(bson.M)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// applyUpdate applies an update document to doc. Only the $set, $unset and
+// $inc operators are supported.
+func applyUpdate(doc bson.M, update interface{}) error {
+	u, err := toM(update)
+	if err != nil {
+		return errors.Annotate(err, "reading update")
+	}
+	for op, arg := range u {
+		fields, ok := arg.(bson.M)
+		if !ok {
+			return errors.NotValidf("%s argument %v", op, arg)
+		}
+		for field, value := range fields {
+			if field == "_id" {
+				return errors.NotValidf("update of _id")
+			}
+			switch op {
+			case "$set":
+				if err := setField(doc, field, value); err != nil {
+					return errors.Trace(err)
+				}
+			case "$unset":
+				unsetField(doc, field)
+			case "$inc":
+				current, _ := lookup(doc, field)
+				sum, err := add(current, value)
+				if err != nil {
+					return errors.Annotatef(err, "$inc of %q", field)
+				}
+				if err := setField(doc, field, sum); err != nil {
+					return errors.Trace(err)
+				}
+			default:
+				return errors.NotSupportedf("update operator %q", op)
+			}
+		}
+	}
+	return nil
+}
+
+func setField(doc bson.M, field string, value interface{}) error {
+	parts := strings.Split(field, ".")
+	m := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part]
+		if !ok {
+			child := bson.M{}
+			m[part] = child
+			m = child
+			continue
+		}
+		if m, ok = next.(bson.M); !ok {
+			return errors.Errorf("cannot set %q: %q is not a document", field, part)
+		}
+	}
+	m[parts[len(parts)-1]] = value
+	return nil
+}
+
+func unsetField(doc bson.M, field string) {
+	parts := strings.Split(field, ".")
+	m := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part].(bson.M)
+		if !ok {
+			return
+		}
+		m = next
+	}
+	delete(m, parts[len(parts)-1])
+}
+
+// add implements $inc for the numeric types bson decodes to.
+func add(current, delta interface{}) (interface{}, error) {
+	switch d := delta.(type) {
+	case int:
+		switch c := current.(type) {
+		case nil:
+			return d, nil
+		case int:
+			return c + d, nil
+		case int64:
+			return c + int64(d), nil
+		case float64:
+			return c + float64(d), nil
+		}
+	case int64:
+		switch c := current.(type) {
+		case nil:
+			return d, nil
+		case int:
+			return int64(c) + d, nil
+		case int64:
+			return c + d, nil
+		case float64:
+			return c + float64(d), nil
+		}
+	case float64:
+		switch c := current.(type) {
+		case nil:
+			return d, nil
+		case int:
+			return float64(c) + d, nil
+		case int64:
+			return float64(c) + d, nil
+		case float64:
+			return c + d, nil
+		}
+	default:
+		return nil, errors.NotValidf("non-numeric increment %v", delta)
+	}
+	return nil, errors.NotValidf("increment of non-numeric value %v", current)
+}
@@ -0,0 +1,141 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package sqltxn
+
+import (
+	stdtesting "testing"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func Test(t *stdtesting.T) {
+	gc.TestingT(t)
+}
+
+type OpsSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&OpsSuite{})
+
+func (*OpsSuite) TestMatches(c *gc.C) {
+	doc := bson.M{"_id": "a", "life": 0, "tags": bson.M{"env": "prod"}}
+	for i, test := range []struct {
+		query   interface{}
+		matches bool
+	}{
+		{bson.M{"life": 0}, true},
+		{bson.D{{"life", 1}}, false},
+		{bson.M{"tags.env": "prod"}, true},
+		{bson.M{"tags.env": "dev"}, false},
+		{bson.M{"life": bson.M{"$ne": 1}}, true},
+		{bson.M{"missing": bson.M{"$ne": 1}}, true},
+		{bson.M{"missing": bson.M{"$exists": false}}, true},
+		{bson.M{"life": bson.M{"$exists": false}}, false},
+		{bson.M{"life": bson.M{"$in": []int{0, 1}}}, true},
+		{bson.M{"life": bson.M{"$nin": []int{0, 1}}}, false},
+		{struct {
+			Life int `bson:"life"`
+		}{0}, true},
+	} {
+		c.Logf("test %d: %v", i, test.query)
+		ok, err := matches(doc, test.query)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(ok, gc.Equals, test.matches)
+	}
+}
+
+func (*OpsSuite) TestMatchesNumbersByValue(c *gc.C) {
+	doc := bson.M{"life": int64(1), "ratio": 0.5, "counts": []interface{}{1, 2}}
+	for i, test := range []struct {
+		query   interface{}
+		matches bool
+	}{
+		{bson.M{"life": 1}, true},
+		{bson.M{"life": 1.0}, true},
+		{bson.M{"life": int64(2)}, false},
+		{bson.M{"life": "1"}, false},
+		{bson.M{"ratio": 0.5}, true},
+		{bson.M{"ratio": 0}, false},
+		{bson.M{"counts": []interface{}{int64(1), 2.0}}, true},
+		{bson.M{"life": bson.M{"$eq": 1.0}}, true},
+		{bson.M{"life": bson.M{"$ne": 1}}, false},
+		{bson.M{"life": bson.M{"$in": []float64{0, 1}}}, true},
+		{bson.M{"life": bson.M{"$nin": []int64{1}}}, false},
+	} {
+		c.Logf("test %d: %v", i, test.query)
+		ok, err := matches(doc, test.query)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(ok, gc.Equals, test.matches)
+	}
+}
+
+func (*OpsSuite) TestMatchesUnsupported(c *gc.C) {
+	_, err := matches(bson.M{}, bson.M{"life": bson.M{"$gt": 0}})
+	c.Assert(err, gc.ErrorMatches, `field "life": assertion operator "\$gt" not supported`)
+	_, err = matches(bson.M{}, bson.M{"$or": []bson.M{{"a": 1}}})
+	c.Assert(err, gc.ErrorMatches, `assertion operator "\$or" not supported`)
+}
+
+func (*OpsSuite) TestApplyUpdate(c *gc.C) {
+	doc := bson.M{"_id": "a", "count": 1, "old": true}
+	err := applyUpdate(doc, bson.D{
+		{"$set", bson.M{"name": "x", "sub.field": 2}},
+		{"$unset", bson.M{"old": 1}},
+		{"$inc", bson.M{"count": 2, "new": 1.5}},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc, jc.DeepEquals, bson.M{
+		"_id":   "a",
+		"count": 3,
+		"name":  "x",
+		"sub":   bson.M{"field": 2},
+		"new":   1.5,
+	})
+}
+
+func (*OpsSuite) TestApplyUpdateErrors(c *gc.C) {
+	err := applyUpdate(bson.M{}, bson.M{"$push": bson.M{"list": 1}})
+	c.Check(err, gc.ErrorMatches, `update operator "\$push" not supported`)
+	err = applyUpdate(bson.M{}, bson.M{"$set": bson.M{"_id": 1}})
+	c.Check(err, gc.ErrorMatches, `update of _id not valid`)
+	err = applyUpdate(bson.M{"name": "x"}, bson.M{"$inc": bson.M{"name": 1}})
+	c.Check(err, gc.ErrorMatches, `\$inc of "name": increment of non-numeric value x not valid`)
+}
+
+func (*OpsSuite) TestEncodeIdIsStable(c *gc.C) {
+	a, err := encodeId(bson.D{{"x", 1}, {"y", "z"}})
+	c.Assert(err, jc.ErrorIsNil)
+	b, err := encodeId(bson.D{{"x", 1}, {"y", "z"}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(a, jc.DeepEquals, b)
+}
+
+func (*OpsSuite) TestAssertionHolds(c *gc.C) {
+	doc := bson.M{"_id": "a", "life": 0}
+	for i, test := range []struct {
+		doc    bson.M
+		assert interface{}
+		holds  bool
+	}{
+		{doc, nil, true},
+		{nil, nil, true},
+		{doc, txn.DocExists, true},
+		{nil, txn.DocExists, false},
+		{doc, txn.DocMissing, false},
+		{nil, txn.DocMissing, true},
+		{doc, bson.M{"life": 0}, true},
+		{doc, bson.M{"life": 1}, false},
+		{nil, bson.M{"life": bson.M{"$exists": false}}, false},
+	} {
+		c.Logf("test %d: %v %v", i, test.doc, test.assert)
+		holds, err := assertionHolds(test.doc, test.assert)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(holds, gc.Equals, test.holds)
+	}
+}
@@ -0,0 +1,344 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package sqltxn is an experimental backend for the transaction runner
+// that stores documents in a SQL database, such as SQLite or Dqlite,
+// instead of mongo. It keeps the txn.Op based API, so that model code
+// written against jujutxn.Runner can be moved to a SQL store unchanged.
+//
+// Each document is stored as BSON in a single table, keyed on its
+// collection and the BSON encoding of its _id. All of the operations in a
+// transaction are asserted, and then applied, inside a single SQL
+// transaction, so none of mgo/txn's client side protocol (txn-queues,
+// stash, txns collection) is needed, and there is nothing to resume or
+// prune.
+//
+// Assertions can't be run as mongo queries, so they are evaluated in Go.
+// Only equality and the $eq, $ne, $exists, $in and $nin operators are
+// supported, and updates may only use $set, $unset and $inc. Transactions
+// can't carry Metadata or ask for a Result.
+//
+// The same evaluation is used by Sandbox, which applies transactions to
+// in-memory documents to preview their effects without any database.
+package sqltxn
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+const (
+	// defaultTableName is the name of the table that holds the documents.
+	defaultTableName = "txn_docs"
+
+	// defaultNumberTransactionRetries is how many times Run tries to
+	// apply a transaction whose assertions fail.
+	defaultNumberTransactionRetries = 3
+)
+
+// RunnerParams are used to construct a Runner. Only DB is mandatory.
+type RunnerParams struct {
+	// DB is the SQL database holding the documents. It must use the
+	// SQLite dialect (eg SQLite or Dqlite).
+	DB *sql.DB
+
+	// TableName is the table that holds the documents. It defaults to
+	// "txn_docs".
+	TableName string
+
+	// RunTransactionObserver, if not nil, is called after each attempt to
+	// run a transaction.
+	RunTransactionObserver func(jujutxn.Transaction)
+}
+
+// Runner runs transactions against a SQL database. It implements
+// jujutxn.Runner, as well as ResumingRunner, StatsRunner and
+// ReadOnlyRunner.
+type Runner struct {
+	db                     *sql.DB
+	table                  string
+	nrRetries              int
+	runTransactionObserver func(jujutxn.Transaction)
+	gate                   *jujutxn.WriteGate
+}
+
+var (
+	_ jujutxn.Runner         = (*Runner)(nil)
+	_ jujutxn.ResumingRunner = (*Runner)(nil)
+	_ jujutxn.StatsRunner    = (*Runner)(nil)
+	_ jujutxn.ReadOnlyRunner = (*Runner)(nil)
+)
+
+// NewRunner returns a Runner for the given parameters. Call EnsureSchema
+// before using it for the first time.
+func NewRunner(params RunnerParams) *Runner {
+	table := params.TableName
+	if table == "" {
+		table = defaultTableName
+	}
+	return &Runner{
+		db:                     params.DB,
+		table:                  table,
+		nrRetries:              defaultNumberTransactionRetries,
+		runTransactionObserver: params.RunTransactionObserver,
+		gate:                   jujutxn.NewWriteGate(),
+	}
+}
+
+// EnsureSchema creates the table that holds the documents, if it doesn't
+// already exist.
+func (r *Runner) EnsureSchema() error {
+	_, err := r.db.Exec(`CREATE TABLE IF NOT EXISTS ` + r.table + ` (
+	collection TEXT NOT NULL,
+	id BLOB NOT NULL,
+	doc BLOB NOT NULL,
+	PRIMARY KEY (collection, id)
+)`)
+	return errors.Annotate(err, "creating documents table")
+}
+
+// FindId reads the document with the given id in collection into result.
+// It returns an error satisfying errors.IsNotFound if there is no such
+// document.
+func (r *Runner) FindId(collection string, id, result interface{}) error {
+	key, err := encodeId(id)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var data []byte
+	row := r.db.QueryRow(`SELECT doc FROM `+r.table+` WHERE collection = ? AND id = ?`, collection, key)
+	if err := row.Scan(&data); err == sql.ErrNoRows {
+		return errors.NotFoundf("document %v in %q", id, collection)
+	} else if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(bson.Unmarshal(data, result))
+}
+
+// Run is defined on jujutxn.Runner.
+func (r *Runner) Run(transactions jujutxn.TransactionSource) error {
+	if r.gate.ReadOnly() {
+		return jujutxn.ErrReadOnly
+	}
+	for i := 0; i < r.nrRetries; i++ {
+		ops, err := transactions(i)
+		if err == jujutxn.ErrTransientFailure {
+			continue
+		}
+		if err == jujutxn.ErrNoOperations {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(ops) == 0 {
+			return nil
+		}
+		err = r.RunTransaction(&jujutxn.Transaction{Ops: ops, Attempt: i})
+		if err != txn.ErrAborted {
+			return err
+		}
+	}
+	return jujutxn.ErrExcessiveContention
+}
+
+// RunTransaction is defined on jujutxn.Runner. It returns txn.ErrAborted
+// if any of the assertions fail, in which case nothing is changed.
+//
+// There are no transaction documents to store Metadata on, nor txn-revnos
+// to fill in a Result with, so transactions that set either are rejected
+// with an error satisfying errors.IsNotSupported.
+func (r *Runner) RunTransaction(transaction *jujutxn.Transaction) error {
+	if transaction.Metadata != nil && !transaction.Metadata.IsZero() {
+		return errors.NotSupportedf("transaction metadata")
+	}
+	if transaction.Result != nil {
+		return errors.NotSupportedf("transaction result")
+	}
+	if err := r.gate.Enter(); err != nil {
+		return err
+	}
+	defer r.gate.Exit()
+	start := time.Now()
+	err := r.runOps(transaction.Ops)
+	if r.runTransactionObserver != nil {
+		t := *transaction
+		t.Error = err
+		t.Duration = time.Since(start)
+		r.runTransactionObserver(t)
+	}
+	return err
+}
+
+// ResumeTransactions is defined on jujutxn.Runner. Transactions are never
+// left part way through, so there is nothing to do.
+func (r *Runner) ResumeTransactions() error {
+	return nil
+}
+
+// ResumeTransactionsWithOptions is defined on jujutxn.ResumingRunner.
+func (r *Runner) ResumeTransactionsWithOptions(opts jujutxn.ResumeOptions) (jujutxn.ResumeStats, error) {
+	return jujutxn.ResumeStats{}, nil
+}
+
+// MaybePruneTransactions is defined on jujutxn.Runner. No transaction
+// records are kept, so there is nothing to prune.
+func (r *Runner) MaybePruneTransactions(pruneOpts jujutxn.PruneOptions) error {
+	return nil
+}
+
+// Stats is defined on jujutxn.StatsRunner. Documents are removed in place,
+// so nothing is ever stashed.
+func (r *Runner) Stats() jujutxn.RunnerStats {
+	return jujutxn.RunnerStats{}
+}
+
+// SetReadOnly is defined on jujutxn.ReadOnlyRunner.
+func (r *Runner) SetReadOnly(readOnly bool) {
+	r.gate.SetReadOnly(readOnly)
+}
+
+// ReadOnly is defined on jujutxn.ReadOnlyRunner.
+func (r *Runner) ReadOnly() bool {
+	return r.gate.ReadOnly()
+}
+
+// WaitIdle is defined on jujutxn.ReadOnlyRunner.
+func (r *Runner) WaitIdle(ctx context.Context) error {
+	return r.gate.Wait(ctx)
+}
+
+// Quiesce is defined on jujutxn.ReadOnlyRunner.
+func (r *Runner) Quiesce(ctx context.Context) (jujutxn.QuiesceReport, error) {
+	return r.gate.Quiesce(ctx)
+}
+
+// runOps applies ops in a single SQL transaction. As with mgo/txn, every
+// assertion is checked against the documents as they were before the
+// transaction, and the operations are only applied if all of them hold.
+func (r *Runner) runOps(ops []txn.Op) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return errors.Annotate(err, "starting transaction")
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	for _, op := range ops {
+		if err := r.assertOp(tx, op); err != nil {
+			return err
+		}
+	}
+	for _, op := range ops {
+		if err := r.applyOp(tx, op); err != nil {
+			return err
+		}
+	}
+	return errors.Annotate(tx.Commit(), "committing transaction")
+}
+
+// assertOp returns txn.ErrAborted if the assertion of op doesn't hold.
+func (r *Runner) assertOp(tx *sql.Tx, op txn.Op) error {
+	if op.Assert == nil {
+		return nil
+	}
+	key, err := encodeId(op.Id)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	doc, err := r.readDoc(tx, op.C, key)
+	if err != nil {
+		return errors.Annotatef(err, "reading %v in %q", op.Id, op.C)
+	}
+	ok, err := assertionHolds(doc, op.Assert)
+	if err != nil {
+		return errors.Annotatef(err, "asserting on %v in %q", op.Id, op.C)
+	}
+	if !ok {
+		return txn.ErrAborted
+	}
+	return nil
+}
+
+// applyOp applies the insert, update or remove of op.
+func (r *Runner) applyOp(tx *sql.Tx, op txn.Op) error {
+	key, err := encodeId(op.Id)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	doc, err := r.readDoc(tx, op.C, key)
+	if err != nil {
+		return errors.Annotatef(err, "reading %v in %q", op.Id, op.C)
+	}
+	switch {
+	case op.Insert != nil:
+		// As with mgo/txn, inserting an existing document is a no-op.
+		if doc != nil {
+			return nil
+		}
+		newDoc, err := toM(op.Insert)
+		if err != nil {
+			return errors.Annotatef(err, "inserting %v in %q", op.Id, op.C)
+		}
+		newDoc["_id"] = op.Id
+		return r.writeDoc(tx, op.C, key, newDoc, false)
+	case op.Update != nil:
+		if doc == nil {
+			return nil
+		}
+		if err := applyUpdate(doc, op.Update); err != nil {
+			return errors.Annotatef(err, "updating %v in %q", op.Id, op.C)
+		}
+		return r.writeDoc(tx, op.C, key, doc, true)
+	case op.Remove:
+		_, err := tx.Exec(`DELETE FROM `+r.table+` WHERE collection = ? AND id = ?`, op.C, key)
+		return errors.Annotatef(err, "removing %v from %q", op.Id, op.C)
+	}
+	return nil
+}
+
+func (r *Runner) readDoc(tx *sql.Tx, collection string, key []byte) (bson.M, error) {
+	var data []byte
+	row := tx.QueryRow(`SELECT doc FROM `+r.table+` WHERE collection = ? AND id = ?`, collection, key)
+	if err := row.Scan(&data); err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return doc, nil
+}
+
+func (r *Runner) writeDoc(tx *sql.Tx, collection string, key []byte, doc bson.M, exists bool) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if exists {
+		_, err = tx.Exec(`UPDATE `+r.table+` SET doc = ? WHERE collection = ? AND id = ?`, data, collection, key)
+	} else {
+		_, err = tx.Exec(`INSERT INTO `+r.table+` (collection, id, doc) VALUES (?, ?, ?)`, collection, key, data)
+	}
+	return errors.Trace(err)
+}
+
+// encodeId returns the key used to store a document with the given id.
+func encodeId(id interface{}) ([]byte, error) {
+	data, err := bson.Marshal(bson.D{{"_id", id}})
+	if err != nil {
+		return nil, errors.Annotatef(err, "encoding id %v", id)
+	}
+	return data, nil
+}
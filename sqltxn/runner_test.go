@@ -0,0 +1,40 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package sqltxn
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type RunnerSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&RunnerSuite{})
+
+func (*RunnerSuite) TestRunTransactionRejectsMetadata(c *gc.C) {
+	// The transaction is rejected before the database is used.
+	runner := NewRunner(RunnerParams{})
+	err := runner.RunTransaction(&jujutxn.Transaction{
+		Ops:      []txn.Op{{C: "coll", Id: "a", Insert: bson.M{}}},
+		Metadata: &jujutxn.TxnMetadata{Caller: "test"},
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+}
+
+func (*RunnerSuite) TestRunTransactionRejectsResult(c *gc.C) {
+	runner := NewRunner(RunnerParams{})
+	err := runner.RunTransaction(&jujutxn.Transaction{
+		Ops:    []txn.Op{{C: "coll", Id: "a", Insert: bson.M{}}},
+		Result: &jujutxn.TxnResult{},
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+}
@@ -0,0 +1,243 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package sqltxn
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+)
+
+// Sandbox applies transactions to in-memory copies of documents, using the
+// same assertion and update evaluation as Runner, so that the effect of
+// operations can be previewed, or op builders unit tested, without a
+// database. Like Runner, it supports a subset of mongo's query and update
+// operators.
+type Sandbox struct {
+	// docs holds the documents of each collection, keyed on their
+	// encoded ids.
+	docs map[string]map[string]bson.M
+}
+
+// NewSandbox returns an empty Sandbox.
+func NewSandbox() *Sandbox {
+	return &Sandbox{docs: make(map[string]map[string]bson.M)}
+}
+
+// Add copies doc, which must have an _id, into collection in the sandbox,
+// replacing any document with the same id.
+func (s *Sandbox) Add(collection string, doc interface{}) error {
+	m, err := toM(doc)
+	if err != nil {
+		return errors.Annotatef(err, "adding document to %q", collection)
+	}
+	id, ok := m["_id"]
+	if !ok {
+		return errors.NotValidf("document without _id")
+	}
+	return errors.Trace(s.put(collection, id, m))
+}
+
+// Load copies the documents with the given ids from coll into the
+// sandbox, leaving out the fields maintained by mgo/txn. Ids that aren't
+// found are left missing.
+func (s *Sandbox) Load(coll *mgo.Collection, ids ...interface{}) error {
+	iter := coll.Find(bson.M{"_id": bson.M{"$in": ids}}).Iter()
+	var doc bson.M
+	for iter.Next(&doc) {
+		delete(doc, "txn-queue")
+		delete(doc, "txn-revno")
+		if err := s.put(coll.Name, doc["_id"], doc); err != nil {
+			iter.Close()
+			return errors.Trace(err)
+		}
+		doc = nil
+	}
+	return errors.Annotatef(iter.Close(), "loading documents from %q", coll.Name)
+}
+
+// Doc returns a copy of the document with the given id, and whether it
+// exists.
+func (s *Sandbox) Doc(collection string, id interface{}) (bson.M, bool, error) {
+	key, err := encodeId(id)
+	if err != nil {
+		return nil, false, errors.Trace(err)
+	}
+	doc, ok := s.docs[collection][string(key)]
+	if !ok {
+		return nil, false, nil
+	}
+	doc, err = toM(doc)
+	return doc, true, errors.Trace(err)
+}
+
+func (s *Sandbox) put(collection string, id interface{}, doc bson.M) error {
+	key, err := encodeId(id)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	coll, ok := s.docs[collection]
+	if !ok {
+		coll = make(map[string]bson.M)
+		s.docs[collection] = coll
+	}
+	coll[string(key)] = doc
+	return nil
+}
+
+// AssertionOutcome is the result of checking an operation's assertion.
+type AssertionOutcome struct {
+	// Op is the index of the operation.
+	Op int
+
+	// Collection and Id identify the document asserted on.
+	Collection string
+	Id         interface{}
+
+	// Passed is true if the assertion held.
+	Passed bool
+}
+
+// SandboxDoc is the state of a document after a transaction.
+type SandboxDoc struct {
+	Collection string
+	Id         interface{}
+
+	// Exists is false if the document is missing, in which case Doc is
+	// nil.
+	Exists bool
+	Doc    bson.M
+}
+
+// SandboxResult reports what applying a transaction did.
+type SandboxResult struct {
+	// Applied is true if every assertion held, so the operations were
+	// applied. If it is false, the transaction would have been aborted,
+	// and the sandbox is unchanged.
+	Applied bool
+
+	// Assertions has the outcome of each operation with an assertion,
+	// in order.
+	Assertions []AssertionOutcome
+
+	// Docs are the documents touched by the operations, in the order
+	// they were first touched. If the transaction was aborted, they are
+	// as they were before it.
+	Docs []SandboxDoc
+}
+
+// Apply runs ops against the sandbox. As with mgo/txn, every assertion is
+// checked against the documents as they were before the transaction, and
+// the operations are only applied if all of them hold. An error is
+// returned if an assertion or update uses an operator that isn't
+// supported, in which case the sandbox is unchanged.
+func (s *Sandbox) Apply(ops []txn.Op) (SandboxResult, error) {
+	var result SandboxResult
+	result.Applied = true
+	for i, op := range ops {
+		if op.Assert == nil {
+			continue
+		}
+		doc, _, err := s.Doc(op.C, op.Id)
+		if err != nil {
+			return SandboxResult{}, errors.Trace(err)
+		}
+		passed, err := assertionHolds(doc, op.Assert)
+		if err != nil {
+			return SandboxResult{}, errors.Annotatef(err, "asserting on %v in %q", op.Id, op.C)
+		}
+		result.Assertions = append(result.Assertions, AssertionOutcome{
+			Op:         i,
+			Collection: op.C,
+			Id:         op.Id,
+			Passed:     passed,
+		})
+		if !passed {
+			result.Applied = false
+		}
+	}
+
+	// Apply the ops to copies of the documents, so that the sandbox is
+	// only changed if they all succeed.
+	type touched struct {
+		collection string
+		id         interface{}
+		doc        bson.M
+	}
+	var order []string
+	docs := make(map[string]*touched)
+	for _, op := range ops {
+		key, err := encodeId(op.Id)
+		if err != nil {
+			return SandboxResult{}, errors.Trace(err)
+		}
+		docKey := op.C + "\x00" + string(key)
+		t, ok := docs[docKey]
+		if !ok {
+			doc, _, err := s.Doc(op.C, op.Id)
+			if err != nil {
+				return SandboxResult{}, errors.Trace(err)
+			}
+			t = &touched{collection: op.C, id: op.Id, doc: doc}
+			docs[docKey] = t
+			order = append(order, docKey)
+		}
+		if !result.Applied {
+			continue
+		}
+		switch {
+		case op.Insert != nil:
+			// As with mgo/txn, inserting an existing document is a no-op.
+			if t.doc != nil {
+				continue
+			}
+			doc, err := toM(op.Insert)
+			if err != nil {
+				return SandboxResult{}, errors.Annotatef(err, "inserting %v in %q", op.Id, op.C)
+			}
+			doc["_id"] = op.Id
+			t.doc = doc
+		case op.Update != nil:
+			if t.doc == nil {
+				continue
+			}
+			if err := applyUpdate(t.doc, op.Update); err != nil {
+				return SandboxResult{}, errors.Annotatef(err, "updating %v in %q", op.Id, op.C)
+			}
+		case op.Remove:
+			t.doc = nil
+		}
+	}
+	for _, docKey := range order {
+		t := docs[docKey]
+		result.Docs = append(result.Docs, SandboxDoc{
+			Collection: t.collection,
+			Id:         t.id,
+			Exists:     t.doc != nil,
+			Doc:        t.doc,
+		})
+	}
+	if !result.Applied {
+		return result, nil
+	}
+	for _, docKey := range order {
+		t := docs[docKey]
+		if t.doc == nil {
+			key, _ := encodeId(t.id)
+			delete(s.docs[t.collection], string(key))
+			continue
+		}
+		// Keep our own copy, so that callers can't change the sandbox
+		// through the result.
+		doc, err := toM(t.doc)
+		if err != nil {
+			return SandboxResult{}, errors.Trace(err)
+		}
+		if err := s.put(t.collection, t.id, doc); err != nil {
+			return SandboxResult{}, errors.Trace(err)
+		}
+	}
+	return result, nil
+}
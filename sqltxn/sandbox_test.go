@@ -0,0 +1,146 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package sqltxn
+
+import (
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type SandboxSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&SandboxSuite{})
+
+func (*SandboxSuite) TestApply(c *gc.C) {
+	sandbox := NewSandbox()
+	err := sandbox.Add("machines", bson.M{"_id": "0", "life": 0, "n": 1})
+	c.Assert(err, jc.ErrorIsNil)
+
+	result, err := sandbox.Apply([]txn.Op{{
+		C:      "machines",
+		Id:     "0",
+		Assert: bson.M{"life": 0},
+		Update: bson.M{"$inc": bson.M{"n": 1}},
+	}, {
+		C:      "machines",
+		Id:     "1",
+		Assert: txn.DocMissing,
+		Insert: bson.M{"life": 0},
+	}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result, jc.DeepEquals, SandboxResult{
+		Applied: true,
+		Assertions: []AssertionOutcome{
+			{Op: 0, Collection: "machines", Id: "0", Passed: true},
+			{Op: 1, Collection: "machines", Id: "1", Passed: true},
+		},
+		Docs: []SandboxDoc{
+			{Collection: "machines", Id: "0", Exists: true, Doc: bson.M{"_id": "0", "life": 0, "n": 2}},
+			{Collection: "machines", Id: "1", Exists: true, Doc: bson.M{"_id": "1", "life": 0}},
+		},
+	})
+	doc, exists, err := sandbox.Doc("machines", "1")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(exists, jc.IsTrue)
+	c.Check(doc, jc.DeepEquals, bson.M{"_id": "1", "life": 0})
+
+	result, err = sandbox.Apply([]txn.Op{{
+		C:      "machines",
+		Id:     "0",
+		Assert: txn.DocExists,
+		Remove: true,
+	}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.Applied, jc.IsTrue)
+	c.Check(result.Docs, jc.DeepEquals, []SandboxDoc{{Collection: "machines", Id: "0"}})
+	_, exists, err = sandbox.Doc("machines", "0")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(exists, jc.IsFalse)
+}
+
+func (*SandboxSuite) TestApplyAborted(c *gc.C) {
+	sandbox := NewSandbox()
+	err := sandbox.Add("machines", bson.M{"_id": "0", "life": 1})
+	c.Assert(err, jc.ErrorIsNil)
+
+	result, err := sandbox.Apply([]txn.Op{{
+		C:      "machines",
+		Id:     "1",
+		Assert: txn.DocMissing,
+		Insert: bson.M{"life": 0},
+	}, {
+		C:      "machines",
+		Id:     "0",
+		Assert: bson.M{"life": 0},
+		Update: bson.M{"$set": bson.M{"life": 2}},
+	}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result, jc.DeepEquals, SandboxResult{
+		Assertions: []AssertionOutcome{
+			{Op: 0, Collection: "machines", Id: "1", Passed: true},
+			{Op: 1, Collection: "machines", Id: "0", Passed: false},
+		},
+		Docs: []SandboxDoc{
+			{Collection: "machines", Id: "1"},
+			{Collection: "machines", Id: "0", Exists: true, Doc: bson.M{"_id": "0", "life": 1}},
+		},
+	})
+	_, exists, err := sandbox.Doc("machines", "1")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(exists, jc.IsFalse)
+}
+
+func (*SandboxSuite) TestAssertionsSeeDocsBeforeTransaction(c *gc.C) {
+	sandbox := NewSandbox()
+	// The second op's assertion is checked before the first op inserts
+	// the document, so the transaction is aborted.
+	result, err := sandbox.Apply([]txn.Op{{
+		C:      "machines",
+		Id:     "0",
+		Insert: bson.M{"life": 0},
+	}, {
+		C:      "machines",
+		Id:     "0",
+		Assert: txn.DocExists,
+		Update: bson.M{"$set": bson.M{"life": 1}},
+	}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(result.Applied, jc.IsFalse)
+	c.Check(result.Assertions, jc.DeepEquals, []AssertionOutcome{
+		{Op: 1, Collection: "machines", Id: "0", Passed: false},
+	})
+	_, exists, err := sandbox.Doc("machines", "0")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(exists, jc.IsFalse)
+}
+
+func (*SandboxSuite) TestApplyUnsupported(c *gc.C) {
+	sandbox := NewSandbox()
+	err := sandbox.Add("machines", bson.M{"_id": "0", "n": 1})
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = sandbox.Apply([]txn.Op{{
+		C:      "machines",
+		Id:     "0",
+		Update: bson.M{"$set": bson.M{"n": 2}},
+	}, {
+		C:      "machines",
+		Id:     "0",
+		Update: bson.M{"$push": bson.M{"tags": "a"}},
+	}})
+	c.Assert(err, gc.ErrorMatches, `updating 0 in "machines": update operator "\$push" not supported`)
+	doc, _, err := sandbox.Doc("machines", "0")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc, jc.DeepEquals, bson.M{"_id": "0", "n": 1})
+}
+
+func (*SandboxSuite) TestAddWithoutId(c *gc.C) {
+	err := NewSandbox().Add("machines", bson.M{"n": 1})
+	c.Assert(err, gc.ErrorMatches, "document without _id not valid")
+}
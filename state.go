@@ -0,0 +1,55 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import "fmt"
+
+// TxnState is the state of a transaction document, as stored in the "s"
+// field by mgo/txn.
+type TxnState int
+
+// Transaction states copied from mgo/txn.
+const (
+	TxnPreparing TxnState = 1 // One or more documents not prepared
+	TxnPrepared  TxnState = 2 // Prepared but not yet ready to run
+	TxnAborting  TxnState = 3 // Assertions failed, cleaning up
+	TxnApplying  TxnState = 4 // Changes are in progress
+	TxnAborted   TxnState = 5 // Pre-conditions failed, nothing done
+	TxnApplied   TxnState = 6 // All changes applied
+)
+
+var txnStateNames = map[TxnState]string{
+	TxnPreparing: "preparing",
+	TxnPrepared:  "prepared",
+	TxnAborting:  "aborting",
+	TxnApplying:  "applying",
+	TxnAborted:   "aborted",
+	TxnApplied:   "applied",
+}
+
+// String returns the name of the state.
+func (s TxnState) String() string {
+	if name, ok := txnStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// Valid returns true if s is one of the states used by mgo/txn.
+func (s TxnState) Valid() bool {
+	_, ok := txnStateNames[s]
+	return ok
+}
+
+// IsCompleted returns true if the transaction has finished, either by
+// being applied or aborted. Completed transactions may be pruned.
+func (s TxnState) IsCompleted() bool {
+	return s == TxnAborted || s == TxnApplied
+}
+
+// IsPending returns true if the transaction has not yet finished, and
+// would be resumed by ResumeTransactions.
+func (s TxnState) IsPending() bool {
+	return s >= TxnPreparing && s <= TxnApplying
+}
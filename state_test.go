@@ -0,0 +1,48 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type TxnStateSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&TxnStateSuite{})
+
+func (*TxnStateSuite) TestString(c *gc.C) {
+	c.Check(jujutxn.TxnPreparing.String(), gc.Equals, "preparing")
+	c.Check(jujutxn.TxnApplied.String(), gc.Equals, "applied")
+	c.Check(jujutxn.TxnState(42).String(), gc.Equals, "unknown(42)")
+}
+
+func (*TxnStateSuite) TestPredicates(c *gc.C) {
+	for _, test := range []struct {
+		state     jujutxn.TxnState
+		valid     bool
+		pending   bool
+		completed bool
+	}{
+		{jujutxn.TxnState(0), false, false, false},
+		{jujutxn.TxnPreparing, true, true, false},
+		{jujutxn.TxnPrepared, true, true, false},
+		{jujutxn.TxnAborting, true, true, false},
+		{jujutxn.TxnApplying, true, true, false},
+		{jujutxn.TxnAborted, true, false, true},
+		{jujutxn.TxnApplied, true, false, true},
+		{jujutxn.TxnState(7), false, false, false},
+	} {
+		c.Logf("state %v", test.state)
+		c.Check(test.state.Valid(), gc.Equals, test.valid)
+		c.Check(test.state.IsPending(), gc.Equals, test.pending)
+		c.Check(test.state.IsCompleted(), gc.Equals, test.completed)
+	}
+	c.Check(jujutxn.TxnApplied.IsCompleted(), jc.IsTrue)
+}
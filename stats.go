@@ -0,0 +1,205 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"sync"
+
+	"github.com/juju/mgo/v3/txn"
+)
+
+const (
+	// maxStatsLabels is the most labels that LabelStats are kept for.
+	// Transactions with other labels are counted under otherLabel.
+	maxStatsLabels = 1000
+
+	// otherLabel is the label that transactions are counted under once
+	// maxStatsLabels have been seen.
+	otherLabel = "(other)"
+)
+
+// RunnerStats counts work done by a Runner since it was created.
+type RunnerStats struct {
+	// Stash records, for each collection, how many of its documents
+	// were moved into and out of the txns.stash collection. Frequent
+	// moves come from documents being repeatedly removed and recreated,
+	// which fills the stash and the txn-queues of the stashed documents.
+	Stash map[string]StashStats
+
+	// Sorted is how many transactions had their operations sorted, as
+	// configured by RunnerParams.SortOps, and Reordered is how many of
+	// them weren't already in order.
+	Sorted    int64
+	Reordered int64
+
+	// Labels counts the transactions run with RunTransaction, for each
+	// TxnMetadata.Caller they were labelled with, to show which
+	// operations generate the most transactions. Unlabelled transactions
+	// aren't counted. Labels should come from a small set of values, such
+	// as the names of operations; after the first 1000, transactions are
+	// counted under "(other)".
+	Labels map[string]LabelStats
+
+	// LabelLimits counts the transactions admitted and rejected for each
+	// label bounded by RunnerParams.LabelLimits, keyed by
+	// RunnerParams.LabelKey.
+	LabelLimits map[string]LabelLimitStats
+
+	// InFlight counts the attempts admitted and rejected by
+	// RunnerParams.InFlightLimit.
+	InFlight LabelLimitStats
+
+	// Breaker reports the state of the circuit breaker configured by
+	// RunnerParams.BreakerFailures.
+	Breaker BreakerStats
+
+	// SessionRefreshes is how many times the runner refreshed its
+	// session after repeated stale socket errors. See
+	// RunnerParams.RefreshSessionAfter.
+	SessionRefreshes int64
+}
+
+// LabelStats counts the transactions run with a label.
+type LabelStats struct {
+	// Txns is how many transactions were run, counting those with an
+	// Attempt of 0.
+	Txns int64
+
+	// Attempts is how many attempts were made to run them.
+	Attempts int64
+
+	// Aborts is how many attempts were aborted because their assertions
+	// failed.
+	Aborts int64
+
+	// Ops is the total number of operations in the attempts.
+	Ops int64
+}
+
+// MeanAttempts returns the mean number of attempts made per transaction.
+func (s LabelStats) MeanAttempts() float64 {
+	if s.Txns == 0 {
+		return 0
+	}
+	return float64(s.Attempts) / float64(s.Txns)
+}
+
+// MeanOps returns the mean number of operations per attempt.
+func (s LabelStats) MeanOps() float64 {
+	if s.Attempts == 0 {
+		return 0
+	}
+	return float64(s.Ops) / float64(s.Attempts)
+}
+
+// StashStats counts the documents of a collection moved through
+// txns.stash by applied transactions.
+type StashStats struct {
+	// Stashed is how many documents were removed, moving their txn-queue
+	// into the stash.
+	Stashed int64
+
+	// Unstashed is how many documents were inserted, moving their
+	// txn-queue out of the stash. Inserting a document that already
+	// exists does nothing, but is still counted.
+	Unstashed int64
+}
+
+// runnerStats accumulates RunnerStats for a transactionRunner.
+type runnerStats struct {
+	mu        sync.Mutex
+	stash     map[string]StashStats
+	sorted    int64
+	reordered int64
+	labels    map[string]LabelStats
+}
+
+// recordSorted counts a transaction whose operations were sorted.
+func (s *runnerStats) recordSorted(reordered bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sorted++
+	if reordered {
+		s.reordered++
+	}
+}
+
+// recordApplied counts the stash moves made by ops, which have been
+// applied by a client-side transaction.
+func (s *runnerStats) recordApplied(ops []txn.Op) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, op := range ops {
+		if op.Insert == nil && !op.Remove {
+			continue
+		}
+		if s.stash == nil {
+			s.stash = make(map[string]StashStats)
+		}
+		stats := s.stash[op.C]
+		if op.Remove {
+			stats.Stashed++
+		} else {
+			stats.Unstashed++
+		}
+		s.stash[op.C] = stats
+	}
+}
+
+// recordLabelled counts an attempt to run transaction, which finished
+// with err, against its label.
+func (s *runnerStats) recordLabelled(transaction *Transaction, err error) {
+	if transaction.Metadata == nil || transaction.Metadata.Caller == "" {
+		return
+	}
+	label := transaction.Metadata.Caller
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.labels == nil {
+		s.labels = make(map[string]LabelStats)
+	}
+	stats, ok := s.labels[label]
+	if !ok && len(s.labels) >= maxStatsLabels {
+		label = otherLabel
+		stats = s.labels[label]
+	}
+	if transaction.Attempt == 0 {
+		stats.Txns++
+	}
+	stats.Attempts++
+	if err == txn.ErrAborted {
+		stats.Aborts++
+	}
+	stats.Ops += int64(len(transaction.Ops))
+	s.labels[label] = stats
+}
+
+// snapshot returns a copy of the stats.
+func (s *runnerStats) snapshot() RunnerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := RunnerStats{
+		Stash:     make(map[string]StashStats, len(s.stash)),
+		Sorted:    s.sorted,
+		Reordered: s.reordered,
+	}
+	for coll, stash := range s.stash {
+		stats.Stash[coll] = stash
+	}
+	stats.Labels = make(map[string]LabelStats, len(s.labels))
+	for label, labelStats := range s.labels {
+		stats.Labels[label] = labelStats
+	}
+	return stats
+}
+
+// Stats is defined on StatsRunner.
+func (tr *transactionRunner) Stats() RunnerStats {
+	stats := tr.stats.snapshot()
+	stats.LabelLimits = tr.labelLimiter.snapshot()
+	stats.InFlight = tr.inFlightLimiter.snapshot()[inFlightLabel]
+	stats.Breaker = tr.breaker.snapshot()
+	stats.SessionRefreshes = tr.refresher.refreshCount()
+	return stats
+}
@@ -0,0 +1,38 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type RunnerStatsSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&RunnerStatsSuite{})
+
+func (*RunnerStatsSuite) TestLabelOverflow(c *gc.C) {
+	var stats runnerStats
+	for i := 0; i < maxStatsLabels+2; i++ {
+		stats.recordLabelled(&Transaction{
+			Metadata: &TxnMetadata{Caller: fmt.Sprintf("op-%d", i)},
+		}, nil)
+	}
+	// Labels that have been seen before are still counted separately.
+	stats.recordLabelled(&Transaction{Metadata: &TxnMetadata{Caller: "op-0"}}, nil)
+
+	labels := stats.snapshot().Labels
+	c.Check(labels, gc.HasLen, maxStatsLabels+1)
+	c.Check(labels[otherLabel].Txns, gc.Equals, int64(2))
+	c.Check(labels["op-0"].Txns, gc.Equals, int64(2))
+}
+
+func (*RunnerStatsSuite) TestMeansOfNothing(c *gc.C) {
+	c.Check(LabelStats{}.MeanAttempts(), gc.Equals, 0.0)
+	c.Check(LabelStats{}.MeanOps(), gc.Equals, 0.0)
+}
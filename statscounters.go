@@ -0,0 +1,60 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// removalCounters count the work of the goroutines that remove txns,
+// several of which may run at once, alongside the rest of the pruner.
+// They are counted atomically, and only added to PrunerStats when the
+// stats are wanted, so that the removals don't contend on a lock.
+type removalCounters struct {
+	removed        int64
+	alreadyRemoved int64
+	removeTime     int64
+}
+
+// add counts a removal.
+func (c *removalCounters) add(removed, alreadyRemoved int, elapsed time.Duration) {
+	atomic.AddInt64(&c.removed, int64(removed))
+	atomic.AddInt64(&c.alreadyRemoved, int64(alreadyRemoved))
+	atomic.AddInt64(&c.removeTime, int64(elapsed))
+}
+
+// addTo moves the counts into stats.
+func (c *removalCounters) addTo(stats *PrunerStats) {
+	stats.TxnsRemoved += atomic.SwapInt64(&c.removed, 0)
+	stats.TxnsAlreadyRemoved += atomic.SwapInt64(&c.alreadyRemoved, 0)
+	stats.TxnRemoveTime += time.Duration(atomic.SwapInt64(&c.removeTime, 0))
+}
+
+// statsShards collects the stats of concurrent workers without a lock:
+// each worker adds to its own shard, and the shards are only combined
+// when the total is wanted.
+type statsShards struct {
+	shards []PrunerStats
+}
+
+func newStatsShards(workers int) *statsShards {
+	return &statsShards{shards: make([]PrunerStats, workers)}
+}
+
+// add adds stats to the shard of worker, which no other goroutine may add
+// to at the same time.
+func (s *statsShards) add(worker int, stats *PrunerStats) {
+	s.shards[worker].Add(stats)
+}
+
+// total combines the shards. It must not be called while they are being
+// added to.
+func (s *statsShards) total() PrunerStats {
+	var total PrunerStats
+	for i := range s.shards {
+		total.Add(&s.shards[i])
+	}
+	return total
+}
@@ -0,0 +1,124 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	jujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type StatsCountersSuite struct {
+	jujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&StatsCountersSuite{})
+
+// numberedStats returns stats whose fields are numbered from 1.
+func numberedStats() PrunerStats {
+	var stats PrunerStats
+	v := reflect.ValueOf(&stats).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		v.Field(i).SetInt(int64(i + 1))
+	}
+	return stats
+}
+
+func (*StatsCountersSuite) TestAddCoversEveryField(c *gc.C) {
+	stats := numberedStats()
+	other := numberedStats()
+	stats.Add(&other)
+	v := reflect.ValueOf(stats)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		expected := int64(2 * (i + 1))
+		if name == "PeakHeapBytes" {
+			expected = int64(i + 1)
+		}
+		c.Check(v.Field(i).Int(), gc.Equals, expected, gc.Commentf("field %s", name))
+	}
+	c.Check(CombineStats(numberedStats(), numberedStats()), jc.DeepEquals, stats)
+}
+
+func (*StatsCountersSuite) TestRemovalCounters(c *gc.C) {
+	counters := &removalCounters{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counters.add(3, 1, time.Millisecond)
+		}()
+	}
+	wg.Wait()
+	stats := PrunerStats{TxnsRemoved: 5}
+	counters.addTo(&stats)
+	c.Check(stats.TxnsRemoved, gc.Equals, int64(35))
+	c.Check(stats.TxnsAlreadyRemoved, gc.Equals, int64(10))
+	c.Check(stats.TxnRemoveTime, gc.Equals, 10*time.Millisecond)
+	// The counts are moved, so aren't added twice.
+	counters.addTo(&stats)
+	c.Check(stats.TxnsRemoved, gc.Equals, int64(35))
+}
+
+func (*StatsCountersSuite) TestStatsShards(c *gc.C) {
+	shards := newStatsShards(2)
+	var wg sync.WaitGroup
+	for worker := 0; worker < 2; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				shards.add(worker, &PrunerStats{DocReads: 1, PeakHeapBytes: int64(worker*100 + i)})
+			}
+		}(worker)
+	}
+	wg.Wait()
+	total := shards.total()
+	c.Check(total.DocReads, gc.Equals, int64(200))
+	c.Check(total.PeakHeapBytes, gc.Equals, int64(199))
+}
+
+func BenchmarkCombineStats(b *testing.B) {
+	var total PrunerStats
+	stats := numberedStats()
+	for i := 0; i < b.N; i++ {
+		total = CombineStats(total, stats)
+	}
+}
+
+func BenchmarkAddStats(b *testing.B) {
+	var total PrunerStats
+	stats := numberedStats()
+	for i := 0; i < b.N; i++ {
+		total.Add(&stats)
+	}
+}
+
+func BenchmarkMergeStatsLocked(b *testing.B) {
+	var mu sync.Mutex
+	var total PrunerStats
+	stats := numberedStats()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mu.Lock()
+			total = CombineStats(total, stats)
+			mu.Unlock()
+		}
+	})
+}
+
+func BenchmarkRemovalCounters(b *testing.B) {
+	counters := &removalCounters{}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			counters.add(100, 1, time.Millisecond)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// diffHighlightPercent is how much a stat must change by to be marked in
+// the PrunerStatsDiff report.
+const diffHighlightPercent = 10
+
+// PrunerStatDiff is the change in one field of PrunerStats.
+type PrunerStatDiff struct {
+	// Field is the name of the PrunerStats field.
+	Field string
+
+	// Before and After are the values of the field. Durations are in
+	// nanoseconds.
+	Before int64
+	After  int64
+
+	// Duration is true if the field is a time.Duration.
+	Duration bool
+}
+
+// Percent returns the change as a percentage of Before. It returns false
+// if Before is 0, as then there is no percentage.
+func (d PrunerStatDiff) Percent() (float64, bool) {
+	if d.Before == 0 {
+		return 0, false
+	}
+	return float64(d.After-d.Before) / float64(d.Before) * 100, true
+}
+
+// Significant returns true if the stat changed by at least 10%, or became
+// non-zero.
+func (d PrunerStatDiff) Significant() bool {
+	if d.Before == d.After {
+		return false
+	}
+	percent, ok := d.Percent()
+	return !ok || math.Abs(percent) >= diffHighlightPercent
+}
+
+func (d PrunerStatDiff) format(value int64) string {
+	if d.Duration {
+		return fmt.Sprintf("%.3f", time.Duration(value).Round(time.Millisecond).Seconds())
+	}
+	return fmt.Sprint(value)
+}
+
+// PrunerStatsDiff compares two PrunerStats, field by field. It is
+// returned by DiffPrunerStats.
+type PrunerStatsDiff []PrunerStatDiff
+
+// DiffPrunerStats compares the stats of two prunes, eg before and after
+// tuning, returning the fields that are non-zero in either, in the order
+// they are declared in PrunerStats.
+func DiffPrunerStats(a, b PrunerStats) PrunerStatsDiff {
+	durationType := reflect.TypeOf(time.Second)
+	va := reflect.ValueOf(a)
+	vb := reflect.ValueOf(b)
+	t := va.Type()
+	var diff PrunerStatsDiff
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		d := PrunerStatDiff{
+			Field:    field.Name,
+			Before:   va.Field(i).Int(),
+			After:    vb.Field(i).Int(),
+			Duration: field.Type == durationType,
+		}
+		if d.Before == 0 && d.After == 0 {
+			continue
+		}
+		diff = append(diff, d)
+	}
+	return diff
+}
+
+// String formats the diff as a table of the before and after values with
+// the percentage change, aligned like PrunerStats.String. Changes of 10%
+// or more are marked with a "*".
+func (diff PrunerStatsDiff) String() string {
+	type row struct {
+		field, before, after, change, mark string
+	}
+	rows := make([]row, len(diff))
+	var fieldWidth, beforeWidth, afterWidth, changeWidth int
+	for i, d := range diff {
+		r := row{
+			field:  d.Field,
+			before: d.format(d.Before),
+			after:  d.format(d.After),
+		}
+		if percent, ok := d.Percent(); !ok {
+			r.change = "new"
+		} else if d.Before != d.After {
+			r.change = fmt.Sprintf("%+.1f%%", percent)
+		}
+		if d.Significant() {
+			r.mark = " *"
+		}
+		fieldWidth = maxInt(fieldWidth, len(r.field))
+		beforeWidth = maxInt(beforeWidth, len(r.before))
+		afterWidth = maxInt(afterWidth, len(r.after))
+		changeWidth = maxInt(changeWidth, len(r.change))
+		rows[i] = r
+	}
+	lines := []string{"PrunerStatsDiff("}
+	for _, r := range rows {
+		line := fmt.Sprintf("  %*s: %*s -> %*s", fieldWidth, r.field, beforeWidth, r.before, afterWidth, r.after)
+		if r.change != "" {
+			line += fmt.Sprintf("  %*s%s", changeWidth, r.change, r.mark)
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, ")")
+	return strings.Join(lines, "\n")
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
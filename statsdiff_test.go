@@ -0,0 +1,65 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type StatsDiffSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&StatsDiffSuite{})
+
+func (*StatsDiffSuite) TestDiffPrunerStats(c *gc.C) {
+	before := PrunerStats{
+		DocReadTime: 2 * time.Second,
+		DocReads:    1000,
+		TxnsRemoved: 500,
+	}
+	after := PrunerStats{
+		DocReadTime:  1500 * time.Millisecond,
+		DocReads:     1050,
+		TxnsRemoved:  500,
+		StashQueries: 3,
+	}
+	diff := DiffPrunerStats(before, after)
+	c.Check(diff, jc.DeepEquals, PrunerStatsDiff{
+		{Field: "DocReadTime", Before: int64(2 * time.Second), After: int64(1500 * time.Millisecond), Duration: true},
+		{Field: "DocReads", Before: 1000, After: 1050},
+		{Field: "StashQueries", Before: 0, After: 3},
+		{Field: "TxnsRemoved", Before: 500, After: 500},
+	})
+	c.Check(diff.String(), gc.Equals, `
+PrunerStatsDiff(
+   DocReadTime: 2.000 -> 1.500  -25.0% *
+      DocReads:  1000 ->  1050   +5.0%
+  StashQueries:     0 ->     3     new *
+   TxnsRemoved:   500 ->   500
+)`[1:])
+}
+
+func (*StatsDiffSuite) TestPercent(c *gc.C) {
+	percent, ok := PrunerStatDiff{Before: 200, After: 50}.Percent()
+	c.Check(ok, jc.IsTrue)
+	c.Check(percent, gc.Equals, -75.0)
+	_, ok = PrunerStatDiff{Before: 0, After: 50}.Percent()
+	c.Check(ok, jc.IsFalse)
+
+	c.Check(PrunerStatDiff{Before: 100, After: 109}.Significant(), jc.IsFalse)
+	c.Check(PrunerStatDiff{Before: 100, After: 90}.Significant(), jc.IsTrue)
+	c.Check(PrunerStatDiff{Before: 0, After: 1}.Significant(), jc.IsTrue)
+	c.Check(PrunerStatDiff{Before: 5, After: 5}.Significant(), jc.IsFalse)
+}
+
+func (*StatsDiffSuite) TestEmpty(c *gc.C) {
+	diff := DiffPrunerStats(PrunerStats{}, PrunerStats{})
+	c.Check(diff, gc.HasLen, 0)
+	c.Check(diff.String(), gc.Equals, "PrunerStatsDiff(\n)")
+}
@@ -0,0 +1,139 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// The pruner only needs a few operations from the database. They are
+// described by the narrow interfaces below, so that the algorithm doesn't
+// depend on mgo directly, and can be run against other drivers, in-memory
+// fakes, or instrumented wrappers.
+
+// docIter iterates over the documents returned by a query. *mgo.Iter
+// implements it.
+type docIter interface {
+	Next(result interface{}) bool
+	Err() error
+	Close() error
+}
+
+// docFinder reads documents.
+type docFinder interface {
+	// findIds returns the given fields of the documents in collection
+	// whose _id is one of ids.
+	findIds(collection string, ids interface{}, fields bson.M) docIter
+}
+
+// docSizer reports on the size of documents.
+type docSizer interface {
+	// avgDocSize returns the average size in bytes of the documents in
+	// collection.
+	avgDocSize(collection string) (int64, error)
+}
+
+// docReader is everything needed to read documents. Its methods may be
+// called concurrently, for different collections.
+type docReader interface {
+	docFinder
+	docSizer
+	queryExplainer
+}
+
+// bulkWriter changes documents. Both methods must be safe to call
+// concurrently.
+type bulkWriter interface {
+	// updateId applies update to the document in collection with the
+	// given id. It returns mgo.ErrNotFound if there is no such document.
+	updateId(collection string, id, update interface{}) error
+
+	// updateAll applies update to the documents in collection matching
+	// selector, and returns how many matched.
+	updateAll(collection string, selector, update interface{}) (int, error)
+
+	// removeAll removes the documents in collection matching selector,
+	// and returns how many were removed.
+	removeAll(collection string, selector interface{}) (int, error)
+}
+
+// collectionLister lists the collections in a database.
+type collectionLister interface {
+	// listCollections returns an iterator over the collection infos
+	// (which have at least a "name" field) that match filter, which may
+	// be nil.
+	listCollections(filter bson.M) (docIter, error)
+}
+
+// pruneStore is everything the pruner needs from the database.
+type pruneStore interface {
+	docReader
+	bulkWriter
+}
+
+// mgoStore implements the pruner's interfaces using mgo.
+type mgoStore struct {
+	db *mgo.Database
+
+	// hints, if not nil, selects the indexes documents are read with.
+	hints *IndexHints
+}
+
+var (
+	_ pruneStore       = mgoStore{}
+	_ collectionLister = mgoStore{}
+)
+
+func (s mgoStore) findIds(collection string, ids interface{}, fields bson.M) docIter {
+	query := s.db.C(collection).Find(bson.M{"_id": bson.M{"$in": ids}})
+	query.Select(fields)
+	if hint := s.hints.docs(collection); hint != nil {
+		query.Hint(hint...)
+	}
+	query.Batch(queryDocBatchSize)
+	return query.Iter()
+}
+
+func (s mgoStore) avgDocSize(collection string) (int64, error) {
+	var result struct {
+		AvgObjSize float64 `bson:"avgObjSize"`
+	}
+	if err := s.db.Run(bson.D{{"collStats", collection}}, &result); err != nil {
+		return 0, errors.Trace(err)
+	}
+	return int64(result.AvgObjSize), nil
+}
+
+func (s mgoStore) updateId(collection string, id, update interface{}) error {
+	return s.db.C(collection).UpdateId(id, update)
+}
+
+func (s mgoStore) updateAll(collection string, selector, update interface{}) (int, error) {
+	info, err := s.db.C(collection).UpdateAll(selector, update)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return info.Matched, nil
+}
+
+func (s mgoStore) removeAll(collection string, selector interface{}) (int, error) {
+	// Removes may run concurrently, so give each its own socket.
+	session := s.db.Session.Copy()
+	defer session.Close()
+	info, err := s.db.With(session).C(collection).RemoveAll(selector)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return info.Removed, nil
+}
+
+func (s mgoStore) listCollections(filter bson.M) (docIter, error) {
+	iter, err := listCollections(s.db, filter)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return iter, nil
+}
@@ -0,0 +1,631 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+	"github.com/juju/lru"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+// fakeStore is an in-memory pruneStore.
+type fakeStore struct {
+	docs    map[string][]bson.M
+	sizes   map[string]int64
+	fields  []bson.M
+	updates []string
+
+	// plans holds the query plans explained, by collection.
+	plans     map[string]queryPlan
+	explained []string
+
+	// updateErrs holds the errors returned by updates to collections.
+	updateErrs map[string]error
+}
+
+var _ pruneStore = (*fakeStore)(nil)
+
+func (s *fakeStore) findIds(collection string, ids interface{}, fields bson.M) docIter {
+	s.fields = append(s.fields, fields)
+	var found []bson.M
+	idList := reflect.ValueOf(ids)
+	for _, doc := range s.docs[collection] {
+		for i := 0; i < idList.Len(); i++ {
+			if sameId(idList.Index(i).Interface(), doc["_id"]) {
+				found = append(found, doc)
+			}
+		}
+	}
+	return &fakeIter{docs: found}
+}
+
+// explain reports the plan in plans, or an empty plan, for any query.
+func (s *fakeStore) explain(query findQuery, verbosity string, result interface{}) error {
+	s.explained = append(s.explained, fmt.Sprintf("%s %v", query.collection, query.hint))
+	data, err := bson.Marshal(bson.M{
+		"queryPlanner": bson.M{"winningPlan": s.plans[query.collection]},
+	})
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, result)
+}
+
+func (s *fakeStore) avgDocSize(collection string) (int64, error) {
+	size, ok := s.sizes[collection]
+	if !ok {
+		return 0, errors.NotFoundf("collection %q", collection)
+	}
+	return size, nil
+}
+
+// sameId compares ids by their bson encoding, as mongo would.
+func sameId(a, b interface{}) bool {
+	dataA, errA := bson.Marshal(bson.M{"_id": a})
+	dataB, errB := bson.Marshal(bson.M{"_id": b})
+	return errA == nil && errB == nil && string(dataA) == string(dataB)
+}
+
+func (s *fakeStore) updateId(collection string, id, update interface{}) error {
+	if err := s.updateErrs[collection]; err != nil {
+		return err
+	}
+	for _, doc := range s.docs[collection] {
+		if sameId(id, doc["_id"]) {
+			s.updates = append(s.updates, collection)
+			return nil
+		}
+	}
+	return mgo.ErrNotFound
+}
+
+// updateAll only supports selecting documents by {"_id": {"$in": ids}}.
+func (s *fakeStore) updateAll(collection string, selector, update interface{}) (int, error) {
+	ids := reflect.ValueOf(selector.(bson.M)["_id"].(bson.M)["$in"])
+	matched := 0
+	for _, doc := range s.docs[collection] {
+		for i := 0; i < ids.Len(); i++ {
+			if sameId(ids.Index(i).Interface(), doc["_id"]) {
+				matched++
+			}
+		}
+	}
+	s.updates = append(s.updates, "all:"+collection)
+	return matched, nil
+}
+
+// removeAll only removes documents selected by {"_id": {"$in": ids}}.
+// Other selectors remove nothing.
+func (s *fakeStore) removeAll(collection string, selector interface{}) (int, error) {
+	idSel, ok := selector.(bson.M)["_id"].(bson.M)
+	if !ok {
+		return 0, nil
+	}
+	ids := reflect.ValueOf(idSel["$in"])
+	var kept []bson.M
+	for _, doc := range s.docs[collection] {
+		remove := false
+		for i := 0; i < ids.Len(); i++ {
+			if sameId(ids.Index(i).Interface(), doc["_id"]) {
+				remove = true
+			}
+		}
+		if !remove {
+			kept = append(kept, doc)
+		}
+	}
+	removed := len(s.docs[collection]) - len(kept)
+	s.docs[collection] = kept
+	return removed, nil
+}
+
+type fakeIter struct {
+	docs []bson.M
+	err  error
+}
+
+func (it *fakeIter) Next(result interface{}) bool {
+	if it.err != nil || len(it.docs) == 0 {
+		return false
+	}
+	data, err := bson.Marshal(it.docs[0])
+	if err == nil {
+		err = bson.Unmarshal(data, result)
+	}
+	it.docs = it.docs[1:]
+	it.err = err
+	return err == nil
+}
+
+func (it *fakeIter) Err() error {
+	return it.err
+}
+
+func (it *fakeIter) Close() error {
+	return it.err
+}
+
+type PruneStoreSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&PruneStoreSuite{})
+
+func (*PruneStoreSuite) TestLookupAndCleanupDocs(c *gc.C) {
+	txnId := bson.NewObjectId()
+	otherId := bson.NewObjectId()
+	token := txnId.Hex() + "_12345678"
+	otherToken := otherId.Hex() + "_12345678"
+	store := &fakeStore{docs: map[string][]bson.M{
+		"coll": {
+			{"_id": "a", "txn-queue": []string{token, otherToken}},
+		},
+		"txns.stash": {
+			{"_id": bson.D{{"c", "coll"}, {"id", "b"}}, "txn-queue": []string{token}},
+		},
+	}}
+	keyA := docKey{Collection: "coll", DocId: "a"}
+	keyB := docKey{Collection: "coll", DocId: "b"}
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{})
+	docs, err := pruner.lookupDocs(docKeySet{keyA: {}, keyB: {}}, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(docs, gc.HasLen, 2)
+	c.Check(docs[keyA].Queue, jc.DeepEquals, []string{token, otherToken})
+	c.Check(docs[keyB].Queue, jc.DeepEquals, []string{token})
+	c.Check(pruner.stats.DocReads, gc.Equals, int64(1))
+	c.Check(pruner.stats.StashDocReads, gc.Equals, int64(1))
+
+	txns := []txnDoc{{Id: txnId, Ops: []docKey{keyA, keyB}}}
+	cleaning := map[bson.ObjectId]struct{}{txnId: {}}
+	err = pruner.cleanupDocs(docs, txns, cleaning, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	// b isn't in coll, so it is cleaned in the stash.
+	c.Check(store.updates, jc.DeepEquals, []string{"coll", "txns.stash"})
+	c.Check(docs[keyA].Queue, jc.DeepEquals, []string{otherToken})
+	c.Check(pruner.stats.DocQueuesCleaned, gc.Equals, int64(2))
+}
+
+func (*PruneStoreSuite) stashFixture() (*fakeStore, []txnDoc, map[bson.ObjectId]struct{}) {
+	txnId := bson.NewObjectId()
+	token := txnId.Hex() + "_12345678"
+	store := &fakeStore{docs: map[string][]bson.M{
+		"coll": {
+			{"_id": "a", "txn-queue": []string{token}},
+		},
+		"txns.stash": {
+			{"_id": bson.D{{"c", "coll"}, {"id", "b"}}, "txn-queue": []string{token}},
+			{"_id": bson.D{{"c", "coll"}, {"id", "c"}}, "txn-queue": []string{token}},
+		},
+	}}
+	ops := []docKey{
+		{Collection: "coll", DocId: "b"},
+		{Collection: "coll", DocId: "a"},
+		{Collection: "coll", DocId: "c"},
+	}
+	txns := []txnDoc{{Id: txnId, Ops: ops}}
+	return store, txns, map[bson.ObjectId]struct{}{txnId: {}}
+}
+
+func (s *PruneStoreSuite) cleanWithOrder(c *gc.C, args IncrementalPruneArgs) (*fakeStore, *IncrementalPruner) {
+	store, txns, cleaning := s.stashFixture()
+	pruner := NewIncrementalPruner(args)
+	keys := make(docKeySet)
+	for _, key := range txns[0].Ops {
+		keys[key] = struct{}{}
+	}
+	docs, err := pruner.lookupDocs(keys, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(docs, gc.HasLen, 3)
+	err = pruner.cleanupDocs(docs, txns, cleaning, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(pruner.stats.DocQueuesCleaned, gc.Equals, int64(3))
+	return store, pruner
+}
+
+func (s *PruneStoreSuite) TestStashOrder(c *gc.C) {
+	store, pruner := s.cleanWithOrder(c, IncrementalPruneArgs{})
+	c.Check(store.updates, jc.DeepEquals, []string{"txns.stash", "coll", "txns.stash"})
+	c.Check(pruner.stats.CollectionQueries, gc.Equals, int64(1))
+
+	store, pruner = s.cleanWithOrder(c, IncrementalPruneArgs{StashOrder: StashLast})
+	c.Check(store.updates, jc.DeepEquals, []string{"coll", "txns.stash", "txns.stash"})
+
+	store, pruner = s.cleanWithOrder(c, IncrementalPruneArgs{StashOrder: StashFirst})
+	c.Check(store.updates, jc.DeepEquals, []string{"txns.stash", "txns.stash", "coll"})
+	// Only "a" had to be read from its collection.
+	c.Check(pruner.stats.StashDocReads, gc.Equals, int64(2))
+	c.Check(pruner.stats.DocReads, gc.Equals, int64(1))
+}
+
+func (s *PruneStoreSuite) TestBulkStashCleanup(c *gc.C) {
+	store, pruner := s.cleanWithOrder(c, IncrementalPruneArgs{BulkStashCleanup: true})
+	c.Check(store.updates, jc.DeepEquals, []string{"all:txns.stash", "coll"})
+	c.Check(pruner.stats.StashBulkCleanups, gc.Equals, int64(1))
+
+	store, _ = s.cleanWithOrder(c, IncrementalPruneArgs{BulkStashCleanup: true, StashOrder: StashLast})
+	c.Check(store.updates, jc.DeepEquals, []string{"coll", "all:txns.stash"})
+}
+
+func (*PruneStoreSuite) TestStashOrderValidate(c *gc.C) {
+	c.Check(StashOrder("").Validate(), jc.ErrorIsNil)
+	c.Check(StashFirst.Validate(), jc.ErrorIsNil)
+	c.Check(StashOrder("sideways").Validate(), gc.ErrorMatches, `stash order "sideways" not valid`)
+}
+
+func (*PruneStoreSuite) TestLargeDocSize(c *gc.C) {
+	store := &fakeStore{
+		docs: map[string][]bson.M{
+			"big":   {{"_id": "a", "txn-queue": []string{}}},
+			"small": {{"_id": "a", "txn-queue": []string{}}},
+		},
+		sizes: map[string]int64{"big": 100000, "small": 100},
+	}
+	var logs loggo.TestWriter
+	c.Assert(loggo.RegisterWriter("large-doc-test", loggo.NewMinimumLevelWriter(&logs, loggo.WARNING)), jc.ErrorIsNil)
+	defer loggo.RemoveWriter("large-doc-test")
+
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{})
+	keys := docKeySet{
+		{Collection: "big", DocId: "a"}:   {},
+		{Collection: "small", DocId: "a"}: {},
+		{Collection: "other", DocId: "a"}: {},
+	}
+	for i := 0; i < 2; i++ {
+		_, err := pruner.lookupDocs(keys, store, "txns.stash")
+		c.Assert(err, jc.ErrorIsNil)
+		pruner.docCache = docCache{cache: lru.New(pruneDocCacheSize)}
+	}
+	stats := pruner.CollectionStats()
+	c.Assert(stats, gc.HasLen, 3)
+	c.Check(stats[0].Name, gc.Equals, "big")
+	c.Check(stats[0].AvgDocSize, gc.Equals, int64(100000))
+	c.Check(stats[1].AvgDocSize, gc.Equals, int64(0))
+	c.Check(stats[2].AvgDocSize, gc.Equals, int64(100))
+
+	c.Assert(logs.Log(), gc.HasLen, 1)
+	c.Check(logs.Log()[0].Message, gc.Matches, `documents in "big" average 100000 bytes \(over 65536\).*`)
+}
+
+func (s *PruneStoreSuite) TestProjection(c *gc.C) {
+	store, _ := s.cleanWithOrder(c, IncrementalPruneArgs{})
+	c.Assert(store.fields, gc.HasLen, 2)
+	for _, fields := range store.fields {
+		c.Check(fields, jc.DeepEquals, bson.M{"_id": 1, "txn-queue": 1})
+	}
+
+	store, _ = s.cleanWithOrder(c, IncrementalPruneArgs{ReadWholeDocuments: true})
+	c.Assert(store.fields, gc.HasLen, 2)
+	for _, fields := range store.fields {
+		c.Check(fields, gc.IsNil)
+	}
+}
+
+func (*PruneStoreSuite) TestInvalidTokens(c *gc.C) {
+	txnId := bson.NewObjectId()
+	token := txnId.Hex() + "_12345678"
+	truncated := txnId.Hex()[:10]
+	store := &fakeStore{docs: map[string][]bson.M{
+		"coll": {
+			{"_id": "a", "txn-queue": []string{truncated, token}},
+		},
+	}}
+	keyA := docKey{Collection: "coll", DocId: "a"}
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{})
+	docs, err := pruner.lookupDocs(docKeySet{keyA: {}}, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(pruner.stats.InvalidTokens, gc.Equals, int64(1))
+
+	txns := []txnDoc{{Id: txnId, Ops: []docKey{keyA}}}
+	cleaning := map[bson.ObjectId]struct{}{txnId: {}}
+	err = pruner.cleanupDocs(docs, txns, cleaning, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	// The invalid token doesn't stop the valid one being cleaned, and
+	// is left in the queue.
+	c.Check(docs[keyA].Queue, jc.DeepEquals, []string{truncated})
+	c.Check(pruner.stats.DocTokensCleaned, gc.Equals, int64(1))
+}
+
+func (*PruneStoreSuite) TestStripInvalidTokens(c *gc.C) {
+	txnId := bson.NewObjectId()
+	token := txnId.Hex() + "_12345678"
+	truncated := txnId.Hex()[:10]
+	store := &fakeStore{docs: map[string][]bson.M{
+		"coll": {
+			{"_id": "a", "txn-queue": []string{truncated, token}},
+		},
+	}}
+	keyA := docKey{Collection: "coll", DocId: "a"}
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{StripInvalidTokens: true})
+	docs, err := pruner.lookupDocs(docKeySet{keyA: {}}, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+
+	txns := []txnDoc{{Id: txnId, Ops: []docKey{keyA}}}
+	cleaning := map[bson.ObjectId]struct{}{txnId: {}}
+	err = pruner.cleanupDocs(docs, txns, cleaning, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(docs[keyA].Queue, gc.HasLen, 0)
+	c.Check(pruner.stats.InvalidTokens, gc.Equals, int64(1))
+	c.Check(pruner.stats.InvalidTokensRemoved, gc.Equals, int64(1))
+	c.Check(pruner.stats.DocTokensCleaned, gc.Equals, int64(2))
+}
+
+func (*PruneStoreSuite) TestMissingTxnTokens(c *gc.C) {
+	cleanedId := bson.NewObjectId()
+	existingId := bson.NewObjectId()
+	missingId := bson.NewObjectId()
+	store := &fakeStore{docs: map[string][]bson.M{
+		"coll": {
+			{"_id": "a", "txn-queue": []string{
+				cleanedId.Hex() + "_12345678",
+				existingId.Hex() + "_12345678",
+				missingId.Hex() + "_12345678",
+				"garbage",
+			}},
+			{"_id": "b", "txn-queue": []string{missingId.Hex() + "_87654321"}},
+		},
+		"txns": {
+			{"_id": existingId},
+		},
+	}}
+	keys := docKeySet{
+		{Collection: "coll", DocId: "a"}: {},
+		{Collection: "coll", DocId: "b"}: {},
+	}
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{CheckMissingTxns: true})
+	docs, err := pruner.lookupDocs(keys, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	cleaning := map[bson.ObjectId]struct{}{cleanedId: {}}
+	err = pruner.countMissingTxnTokens(docs, cleaning, store, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	// Tokens for transactions being cleaned, and malformed tokens, aren't
+	// counted as missing.
+	c.Check(pruner.stats.MissingTxnTokens, gc.Equals, int64(2))
+	c.Check(pruner.stats.InvalidTokens, gc.Equals, int64(1))
+}
+
+func (*PruneStoreSuite) TestOnRemove(c *gc.C) {
+	txnId := bson.NewObjectId()
+	store := &fakeStore{docs: map[string][]bson.M{
+		"txns": {{
+			"_id": txnId,
+			"s":   int(TxnApplied),
+			"o":   []bson.M{{"c": "coll", "d": "a", "u": bson.M{"$set": bson.M{"x": 1}}}},
+		}},
+	}}
+	var removed []*TxnDoc
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{
+		OnRemove: func(doc *TxnDoc) error {
+			removed = append(removed, doc)
+			return nil
+		},
+	})
+	err := pruner.archiveTxns([]bson.ObjectId{txnId}, store, "txns")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(removed, gc.HasLen, 1)
+	c.Check(removed[0].Id, gc.Equals, txnId)
+	c.Check(removed[0].State, gc.Equals, TxnApplied)
+	c.Assert(removed[0].Ops, gc.HasLen, 1)
+	c.Check(removed[0].Ops[0].C, gc.Equals, "coll")
+	c.Check(removed[0].Ops[0].Id, gc.Equals, "a")
+
+	pruner = NewIncrementalPruner(IncrementalPruneArgs{
+		OnRemove: func(*TxnDoc) error {
+			return errors.New("ledger unavailable")
+		},
+	})
+	err = pruner.archiveTxns([]bson.ObjectId{txnId}, store, "txns")
+	c.Check(err, gc.ErrorMatches, `remove hook for txn `+txnId.Hex()+`: ledger unavailable`)
+}
+
+func (*PruneStoreSuite) TestTxnsAlreadyRemoved(c *gc.C) {
+	present := bson.NewObjectId()
+	store := &fakeStore{docs: map[string][]bson.M{
+		"txns": {{"_id": present}},
+	}}
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{})
+	errorCh := make(chan error, 1)
+	var wg sync.WaitGroup
+	// The second txn was removed by someone else.
+	pruner.removeTxns([]bson.ObjectId{present, bson.NewObjectId()}, store, "txns", errorCh, &wg)
+	wg.Wait()
+	pruner.removals.addTo(&pruner.stats)
+	c.Assert(errorCh, gc.HasLen, 0)
+	c.Check(store.docs["txns"], gc.HasLen, 0)
+	c.Check(pruner.stats.TxnsRemoved, gc.Equals, int64(1))
+	c.Check(pruner.stats.TxnsAlreadyRemoved, gc.Equals, int64(1))
+}
+
+func (*PruneStoreSuite) TestSkipsCappedCollection(c *gc.C) {
+	cappedTxn := bson.NewObjectId()
+	otherTxn := bson.NewObjectId()
+	store := &fakeStore{
+		docs: map[string][]bson.M{
+			"capped": {{"_id": "a", "txn-queue": []string{cappedTxn.Hex() + "_12345678"}}},
+			"coll":   {{"_id": "b", "txn-queue": []string{otherTxn.Hex() + "_12345678"}}},
+			"txns":   {{"_id": cappedTxn}, {"_id": otherTxn}},
+		},
+		updateErrs: map[string]error{
+			"capped": &mgo.LastError{
+				Code: 10003,
+				Err:  "Cannot change the size of a document in a capped collection: 60 != 40",
+			},
+		},
+	}
+	iter := &fakeIter{docs: []bson.M{
+		{"_id": cappedTxn, "s": int(TxnApplied), "o": []bson.M{{"c": "capped", "d": "a"}}},
+		{"_id": otherTxn, "s": int(TxnApplied), "o": []bson.M{{"c": "coll", "d": "b"}}},
+	}}
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{})
+	errorCh := make(chan error, 1)
+	var wg sync.WaitGroup
+	_, err := pruner.pruneNextBatch(iter, store, "txns", "txns.stash", errorCh, &wg)
+	c.Assert(err, jc.ErrorIsNil)
+	wg.Wait()
+	pruner.removals.addTo(&pruner.stats)
+	c.Assert(errorCh, gc.HasLen, 0)
+	c.Check(store.docs["txns"], jc.DeepEquals, []bson.M{{"_id": cappedTxn}})
+	c.Check(pruner.stats.TxnsRemoved, gc.Equals, int64(1))
+	c.Check(pruner.stats.TxnsNotRemoved, gc.Equals, int64(1))
+	c.Check(pruner.stats.DocQueuesCleaned, gc.Equals, int64(1))
+	c.Check(skippedCollections(pruner.CollectionStats()), jc.DeepEquals, []string{"capped"})
+}
+
+func (s *PruneStoreSuite) TestProgressPhases(c *gc.C) {
+	store, txns, cleaning := s.stashFixture()
+	progress := make(chan ProgressMessage, 10)
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{
+		ProgressChannel: progress,
+		StashOrder:      StashLast,
+	})
+	pruner.batch = 1
+	keys := make(docKeySet)
+	for _, key := range txns[0].Ops {
+		keys[key] = struct{}{}
+	}
+	docs, err := pruner.lookupDocs(keys, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	err = pruner.cleanupDocs(docs, txns, cleaning, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	close(progress)
+	var msgs []ProgressMessage
+	for msg := range progress {
+		msgs = append(msgs, msg)
+	}
+	c.Check(msgs, jc.DeepEquals, []ProgressMessage{
+		{Phase: PrunePhaseCleaningDocs, Collection: "coll", Batch: 1},
+		{DocsCleaned: 3, Batch: 1},
+	})
+}
+
+// slowStore is a fakeStore whose iterators take delay to read each
+// document.
+type slowStore struct {
+	*fakeStore
+	delay time.Duration
+}
+
+func (s slowStore) findIds(collection string, ids interface{}, fields bson.M) docIter {
+	return slowIter{docIter: s.fakeStore.findIds(collection, ids, fields), delay: s.delay}
+}
+
+type slowIter struct {
+	docIter
+	delay time.Duration
+}
+
+func (it slowIter) Next(result interface{}) bool {
+	time.Sleep(it.delay)
+	return it.docIter.Next(result)
+}
+
+func docKeysFixture(store *fakeStore, n int) docKeySet {
+	keys := make(docKeySet)
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("doc-%d", i)
+		store.docs["coll"] = append(store.docs["coll"], bson.M{"_id": id, "txn-queue": []string{}})
+		keys[docKey{Collection: "coll", DocId: id}] = struct{}{}
+	}
+	return keys
+}
+
+func (*PruneStoreSuite) TestDocBatchSize(c *gc.C) {
+	store := &fakeStore{docs: make(map[string][]bson.M)}
+	keys := docKeysFixture(store, 25)
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{DocBatchSize: 10})
+	docs, err := pruner.lookupDocs(keys, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(docs, gc.HasLen, 25)
+	c.Check(pruner.stats.CollectionQueries, gc.Equals, int64(3))
+	c.Check(pruner.stats.DocReads, gc.Equals, int64(25))
+	c.Check(pruner.stats.DocBatchSplits, gc.Equals, int64(0))
+}
+
+func (*PruneStoreSuite) TestDocBatchDeadlineSplitsBatches(c *gc.C) {
+	fake := &fakeStore{docs: make(map[string][]bson.M)}
+	keys := docKeysFixture(fake, 30)
+	store := slowStore{fakeStore: fake, delay: 2 * time.Millisecond}
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{
+		DocBatchSize:     30,
+		DocBatchDeadline: time.Millisecond,
+	})
+	docs, err := pruner.lookupDocs(keys, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	// Every document is still read, once.
+	c.Check(docs, gc.HasLen, 30)
+	c.Check(pruner.stats.DocReads, gc.Equals, int64(30))
+	c.Check(pruner.stats.DocStillMissing, gc.Equals, int64(0))
+	// Batches of 30 and 15 were cut short after a document, and then
+	// batches of 10 can't be split any further: 10, 10 and 7.
+	c.Check(pruner.stats.DocBatchSplits, gc.Equals, int64(2))
+	c.Check(pruner.stats.CollectionQueries, gc.Equals, int64(5))
+	c.Check(pruner.docBatchSize, gc.Equals, minDocBatchSize)
+}
+
+func (*PruneStoreSuite) TestDocFilter(c *gc.C) {
+	migrating := bson.NewObjectId()
+	other := bson.NewObjectId()
+	token := migrating.Hex() + "_12345678"
+	otherToken := other.Hex() + "_12345678"
+	store := &fakeStore{docs: map[string][]bson.M{
+		"coll": {
+			{"_id": "a", "txn-queue": []string{token}, "migrating": true},
+			{"_id": "b", "txn-queue": []string{token}},
+			{"_id": "c", "txn-queue": []string{otherToken}},
+		},
+	}}
+	keyA := docKey{Collection: "coll", DocId: "a"}
+	keyB := docKey{Collection: "coll", DocId: "b"}
+	keyC := docKey{Collection: "coll", DocId: "c"}
+	var filtered []string
+	pruner := NewIncrementalPruner(IncrementalPruneArgs{
+		DocFilter: func(collection string, raw bson.Raw) bool {
+			var doc struct {
+				Id        string `bson:"_id"`
+				Migrating bool   `bson:"migrating"`
+			}
+			c.Assert(raw.Unmarshal(&doc), jc.ErrorIsNil)
+			if doc.Migrating {
+				filtered = append(filtered, collection+"/"+doc.Id)
+			}
+			return !doc.Migrating
+		},
+		DocFilterFields: []string{"migrating"},
+	})
+	txns := []txnDoc{
+		{Id: migrating, Ops: []docKey{keyA, keyB}},
+		{Id: other, Ops: []docKey{keyC}},
+	}
+	for i := 0; i < 2; i++ {
+		docs, err := pruner.lookupDocs(docKeySet{keyA: {}, keyB: {}, keyC: {}}, store, "txns.stash")
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(docs, gc.HasLen, 2)
+	}
+	// The filter is asked every time, as the cache isn't used.
+	c.Check(filtered, jc.DeepEquals, []string{"coll/a", "coll/a"})
+	c.Check(pruner.stats.DocCacheHits, gc.Equals, int64(0))
+	c.Check(pruner.stats.DocsFiltered, gc.Equals, int64(2))
+	c.Check(pruner.stats.DocStillMissing, gc.Equals, int64(0))
+	c.Check(store.fields[0], jc.DeepEquals, bson.M{"_id": 1, "txn-queue": 1, "migrating": 1})
+
+	docs, err := pruner.lookupDocs(docKeySet{keyA: {}, keyB: {}, keyC: {}}, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	cleaning := map[bson.ObjectId]struct{}{migrating: {}, other: {}}
+	err = pruner.cleanupDocs(docs, txns, cleaning, store, "txns.stash")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(store.updates, jc.DeepEquals, []string{"coll", "coll"})
+	c.Check(pruner.stats.DocsMissing, gc.Equals, int64(0))
+	// The transaction that touched a is kept.
+	c.Check(pruner.touchesFilteredDoc(txns[0]), jc.IsTrue)
+	c.Check(pruner.touchesFilteredDoc(txns[1]), jc.IsFalse)
+}
@@ -0,0 +1,336 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+const (
+	// stuckTxnAge is how long a transaction must have been pending before
+	// the support bundle reports it as stuck.
+	stuckTxnAge = time.Hour
+
+	// maxStuckTxns is the most stuck transactions listed in the support
+	// bundle. They are all counted.
+	maxStuckTxns = 100
+
+	// supportGrowthWindow is the window TxnGrowthRate is measured over
+	// for the support bundle.
+	supportGrowthWindow = 24 * time.Hour
+
+	// errCodeNamespaceNotFound is returned by mongo for a collection that
+	// doesn't exist.
+	errCodeNamespaceNotFound = 26
+)
+
+// SupportManifest is written to manifest.json in a support bundle. It
+// says what the bundle holds, and which reports couldn't be collected.
+type SupportManifest struct {
+	Database string    `json:"database"`
+	TxnsName string    `json:"txns"`
+	Created  time.Time `json:"created"`
+
+	// Reports are the names of the files in the bundle.
+	Reports []string `json:"reports"`
+
+	// Errors maps the names of the reports that couldn't be collected to
+	// why not. Those reports are left out of the bundle.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// QueueDepth summarises the txn-queues of the documents in a collection.
+type QueueDepth struct {
+	Collection string `json:"collection"`
+
+	// Docs is the number of documents with a non-empty txn-queue.
+	Docs int `json:"docs"`
+
+	// Tokens is the total length of their txn-queues.
+	Tokens int `json:"tokens"`
+
+	// MaxLength is the length of the longest txn-queue.
+	MaxLength int `json:"max-length"`
+}
+
+// StuckTxns lists the transactions that have been pending for a long
+// time, and so are probably blocking the documents they touch.
+type StuckTxns struct {
+	// OlderThan is how long a transaction must have been pending for to
+	// be counted.
+	OlderThan time.Duration `json:"older-than"`
+
+	// Count is the number of stuck transactions.
+	Count int `json:"count"`
+
+	// Txns are the oldest of them, up to 100.
+	Txns []StuckTxn `json:"txns"`
+}
+
+// StuckTxn describes a transaction in StuckTxns.
+type StuckTxn struct {
+	Id          bson.ObjectId `json:"id"`
+	State       string        `json:"state"`
+	Created     time.Time     `json:"created"`
+	Collections []string      `json:"collections"`
+	Ops         int           `json:"ops"`
+	Metadata    *TxnMetadata  `json:"metadata,omitempty"`
+	Problems    []string      `json:"problems,omitempty"`
+}
+
+// RecentStats is the recent activity on the txns collection.
+type RecentStats struct {
+	// States counts the transactions in each state.
+	States map[string]int `json:"states"`
+
+	// Growth is how fast the collection has grown over the last day.
+	Growth GrowthEstimate `json:"growth"`
+
+	// Progress and Checkpoint are those last written by CleanAndPrune
+	// and PruneBudgeted, if any.
+	Progress   *PruneProgress   `json:"progress,omitempty"`
+	Checkpoint *PruneCheckpoint `json:"checkpoint,omitempty"`
+}
+
+// CollectSupportBundle gathers the reports that are needed to diagnose
+// problems with the transactions in txnsName, and writes them to w as a
+// gzipped tarball of JSON files:
+//
+//	manifest.json          SupportManifest
+//	prune-history.json     the PruneHistory
+//	queue-depth.json       a QueueDepth for each collection with txn-queues
+//	stuck-txns.json        StuckTxns pending for more than an hour
+//	index-status.json      the indexes of the txns collections
+//	capabilities.json      the ServerCapabilities
+//	recent-stats.json      RecentStats
+//	slow-queries.json      the SlowQueries explained by recent prunes
+//
+// A report that can't be collected is left out and recorded in the
+// manifest, so that as much as possible is gathered from a database that
+// is in trouble. An error is only returned if w can't be written to.
+// Finding the queue depths reads every document with a txn-queue, so it
+// can take a while on a big database.
+func CollectSupportBundle(db *mgo.Database, txnsName string, w io.Writer) error {
+	manifest := SupportManifest{
+		Database: db.Name,
+		TxnsName: txnsName,
+		Created:  time.Now().UTC(),
+		Errors:   make(map[string]string),
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, report := range []struct {
+		name    string
+		collect func() (interface{}, error)
+	}{
+		{"prune-history.json", func() (interface{}, error) {
+			return PruneHistory(db, txnsName)
+		}},
+		{"queue-depth.json", func() (interface{}, error) {
+			return queueDepths(db, txnsName)
+		}},
+		{"stuck-txns.json", func() (interface{}, error) {
+			return stuckTxns(db.C(txnsName), time.Now().Add(-stuckTxnAge))
+		}},
+		{"index-status.json", func() (interface{}, error) {
+			return indexStatus(db, txnsName)
+		}},
+		{"capabilities.json", func() (interface{}, error) {
+			return DetectServerCapabilities(db.Session)
+		}},
+		{"recent-stats.json", func() (interface{}, error) {
+			return recentStats(db, txnsName)
+		}},
+		{"slow-queries.json", func() (interface{}, error) {
+			return ReadSlowQueries(db, txnsName)
+		}},
+	} {
+		value, err := report.collect()
+		if err != nil {
+			logger.Warningf("support bundle: unable to collect %s: %v", report.name, err)
+			manifest.Errors[report.name] = err.Error()
+			continue
+		}
+		if err := writeBundleFile(tw, report.name, manifest.Created, value); err != nil {
+			return errors.Trace(err)
+		}
+		manifest.Reports = append(manifest.Reports, report.name)
+	}
+	if err := writeBundleFile(tw, "manifest.json", manifest.Created, manifest); err != nil {
+		return errors.Trace(err)
+	}
+	if err := tw.Close(); err != nil {
+		return errors.Annotate(err, "writing support bundle")
+	}
+	return errors.Annotate(gz.Close(), "writing support bundle")
+}
+
+// writeBundleFile writes value to tw as the JSON file name.
+func writeBundleFile(tw *tar.Writer, name string, modTime time.Time, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return errors.Annotatef(err, "encoding %s", name)
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	})
+	if err == nil {
+		_, err = tw.Write(data)
+	}
+	return errors.Annotatef(err, "writing %s", name)
+}
+
+// queueDepths returns the QueueDepth of each collection that may hold
+// references to transactions in txnsName, and has documents with a
+// txn-queue.
+func queueDepths(db *mgo.Database, txnsName string) ([]QueueDepth, error) {
+	it, err := NewTxnCollectionIterator(db.C(txnsName), nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	depths := []QueueDepth{}
+	var name string
+	for it.Next(&name) {
+		var result struct {
+			Docs      int `bson:"docs"`
+			Tokens    int `bson:"tokens"`
+			MaxLength int `bson:"max"`
+		}
+		err := db.C(name).Pipe([]bson.M{
+			{"$match": bson.M{"txn-queue.0": bson.M{"$exists": true}}},
+			{"$project": bson.M{"n": bson.M{"$size": "$txn-queue"}}},
+			{"$group": bson.M{
+				"_id":    nil,
+				"docs":   bson.M{"$sum": 1},
+				"tokens": bson.M{"$sum": "$n"},
+				"max":    bson.M{"$max": "$n"},
+			}},
+		}).One(&result)
+		if err == mgo.ErrNotFound {
+			continue
+		} else if err != nil {
+			it.Close()
+			return nil, errors.Annotatef(err, "reading txn-queues of %q", name)
+		}
+		depths = append(depths, QueueDepth{
+			Collection: name,
+			Docs:       result.Docs,
+			Tokens:     result.Tokens,
+			MaxLength:  result.MaxLength,
+		})
+	}
+	return depths, errors.Trace(it.Close())
+}
+
+// stuckTxns returns the transactions in txns that were created before
+// threshold and are still pending.
+func stuckTxns(txns *mgo.Collection, threshold time.Time) (StuckTxns, error) {
+	stuck := StuckTxns{
+		OlderThan: stuckTxnAge,
+		Txns:      []StuckTxn{},
+	}
+	query := txns.Find(bson.M{
+		"_id": bson.M{"$lt": bson.NewObjectIdWithTime(threshold)},
+		"s":   bson.M{"$in": pendingTxnStates},
+	})
+	count, err := query.Count()
+	if err != nil {
+		return stuck, errors.Annotate(err, "counting stuck transactions")
+	}
+	stuck.Count = count
+	iter := query.Sort("_id").Limit(maxStuckTxns).Iter()
+	var raw bson.Raw
+	for iter.Next(&raw) {
+		doc := DecodeTxnLenient(raw)
+		seen := make(map[string]bool)
+		var collections []string
+		for _, op := range doc.Ops {
+			if !seen[op.C] {
+				seen[op.C] = true
+				collections = append(collections, op.C)
+			}
+		}
+		stuck.Txns = append(stuck.Txns, StuckTxn{
+			Id:          doc.Id,
+			State:       doc.State.String(),
+			Created:     doc.Id.Time().UTC(),
+			Collections: collections,
+			Ops:         len(doc.Ops),
+			Metadata:    doc.Metadata,
+			Problems:    doc.Problems,
+		})
+	}
+	if err := iter.Close(); err != nil {
+		return stuck, errors.Annotate(err, "reading stuck transactions")
+	}
+	return stuck, nil
+}
+
+// indexStatus returns the indexes of txnsName and the collections that
+// go with it, by collection name. Collections that don't exist are left
+// out.
+func indexStatus(db *mgo.Database, txnsName string) (map[string][]mgo.Index, error) {
+	status := make(map[string][]mgo.Index)
+	for _, name := range []string{txnsName, txnsName + ".stash", txnsPruneC(txnsName)} {
+		indexes, err := db.C(name).Indexes()
+		if isNamespaceNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, errors.Annotatef(err, "reading indexes of %q", name)
+		}
+		status[name] = indexes
+	}
+	return status, nil
+}
+
+// isNamespaceNotFound returns true if err says that a collection doesn't
+// exist.
+func isNamespaceNotFound(err error) bool {
+	switch err := errors.Cause(err).(type) {
+	case *mgo.QueryError:
+		return err.Code == errCodeNamespaceNotFound
+	case *mgo.LastError:
+		return err.Code == errCodeNamespaceNotFound
+	}
+	return false
+}
+
+// recentStats returns the RecentStats of txnsName.
+func recentStats(db *mgo.Database, txnsName string) (RecentStats, error) {
+	stats := RecentStats{States: make(map[string]int)}
+	var counts []struct {
+		State TxnState `bson:"_id"`
+		Count int      `bson:"count"`
+	}
+	err := db.C(txnsName).Pipe([]bson.M{
+		{"$group": bson.M{"_id": "$s", "count": bson.M{"$sum": 1}}},
+	}).All(&counts)
+	if err != nil {
+		return stats, errors.Annotate(err, "counting transactions by state")
+	}
+	for _, count := range counts {
+		stats.States[count.State.String()] = count.Count
+	}
+	if stats.Growth, err = TxnGrowthRate(db, txnsName, supportGrowthWindow); err != nil {
+		return stats, errors.Trace(err)
+	}
+	if stats.Progress, err = ReadPruneProgress(db, txnsName); err != nil && !errors.IsNotFound(err) {
+		return stats, errors.Trace(err)
+	}
+	if stats.Checkpoint, err = ReadPruneCheckpoint(db, txnsName); err != nil && !errors.IsNotFound(err) {
+		return stats, errors.Trace(err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type SupportBundleSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&SupportBundleSuite{})
+
+// readBundle returns the contents of the files in a support bundle.
+func readBundle(c *gc.C, data []byte) map[string][]byte {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	c.Assert(err, jc.ErrorIsNil)
+	tr := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		content, err := io.ReadAll(tr)
+		c.Assert(err, jc.ErrorIsNil)
+		files[header.Name] = content
+	}
+	return files
+}
+
+func (s *SupportBundleSuite) TestCollectSupportBundle(c *gc.C) {
+	s.runTxn(c, txn.Op{C: "coll", Id: 0, Insert: bson.M{}})
+	s.runTxn(c, txn.Op{C: "coll", Id: 1, Insert: bson.M{}})
+
+	var buf bytes.Buffer
+	err := jujutxn.CollectSupportBundle(s.db, "txns", &buf)
+	c.Assert(err, jc.ErrorIsNil)
+	files := readBundle(c, buf.Bytes())
+
+	var manifest jujutxn.SupportManifest
+	c.Assert(json.Unmarshal(files["manifest.json"], &manifest), jc.ErrorIsNil)
+	c.Check(manifest.TxnsName, gc.Equals, "txns")
+	c.Check(manifest.Errors, gc.HasLen, 0)
+	c.Check(manifest.Reports, jc.SameContents, []string{
+		"prune-history.json",
+		"queue-depth.json",
+		"stuck-txns.json",
+		"index-status.json",
+		"capabilities.json",
+		"recent-stats.json",
+		"slow-queries.json",
+	})
+	for _, name := range manifest.Reports {
+		c.Check(files[name], gc.Not(gc.HasLen), 0, gc.Commentf("%s", name))
+	}
+
+	var depths []jujutxn.QueueDepth
+	c.Assert(json.Unmarshal(files["queue-depth.json"], &depths), jc.ErrorIsNil)
+	c.Check(depths, jc.DeepEquals, []jujutxn.QueueDepth{{
+		Collection: "coll",
+		Docs:       2,
+		Tokens:     2,
+		MaxLength:  1,
+	}})
+
+	var stuck jujutxn.StuckTxns
+	c.Assert(json.Unmarshal(files["stuck-txns.json"], &stuck), jc.ErrorIsNil)
+	c.Check(stuck.Count, gc.Equals, 0)
+
+	var stats jujutxn.RecentStats
+	c.Assert(json.Unmarshal(files["recent-stats.json"], &stats), jc.ErrorIsNil)
+	c.Check(stats.States, jc.DeepEquals, map[string]int{"applied": 2})
+	c.Check(stats.Growth.CurrentCount, gc.Equals, 2)
+}
@@ -0,0 +1,142 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// The environment variables read by MatrixTargets. Each holds a comma
+// separated list.
+const (
+	// MongodsEnv lists paths to mongod binaries.
+	MongodsEnv = "TXN_TEST_MONGODS"
+
+	// MongoImagesEnv lists docker images that run mongod, such as
+	// "mongo:4.4".
+	MongoImagesEnv = "TXN_TEST_MONGO_IMAGES"
+
+	// MongoURIsEnv lists the URIs of running servers.
+	MongoURIsEnv = "TXN_TEST_MONGO_URIS"
+)
+
+// matrixLabel labels the docker containers started for the matrix, so
+// that CleanupMatrix can find them.
+const matrixLabel = "juju-txn-test-matrix"
+
+// MatrixTarget is a MongoDB server that the tests can be run against, to
+// check a server version before upgrading to it or to this package.
+type MatrixTarget struct {
+	// Name identifies the target in test output.
+	Name string
+
+	// Mongod is the path of a mongod binary, which the test harness
+	// starts a server from for each test package (see JUJU_MONGOD).
+	Mongod string
+
+	// URI is the address of a running server, if Mongod isn't set. The
+	// test harness can't use a running server, so only tests written
+	// for a URI, such as smoke tests, can be run against it.
+	URI string
+}
+
+// MatrixTargets returns the targets listed by MongodsEnv, MongoImagesEnv
+// and MongoURIsEnv. For each docker image, a script that runs mongod from
+// the image is written to dir and used as the target's Mongod.
+func MatrixTargets(dir string) ([]MatrixTarget, error) {
+	var targets []MatrixTarget
+	for _, path := range splitEnv(MongodsEnv) {
+		targets = append(targets, MatrixTarget{Name: path, Mongod: path})
+	}
+	for _, image := range splitEnv(MongoImagesEnv) {
+		path, err := DockerMongod(dir, image)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		targets = append(targets, MatrixTarget{Name: image, Mongod: path})
+	}
+	for _, uri := range splitEnv(MongoURIsEnv) {
+		targets = append(targets, MatrixTarget{Name: uri, URI: uri})
+	}
+	return targets, nil
+}
+
+func splitEnv(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// DockerMongod writes a script to dir that runs mongod from the docker
+// image, as the current user and on the host network, and returns its
+// path. The test harness keeps its data in the temporary directory, so it
+// is mounted at the same path in the container. Docker doesn't pass on
+// the signal the harness kills the script with, so call CleanupMatrix to
+// remove the containers once the tests are done.
+func DockerMongod(dir, image string) (string, error) {
+	docker, err := exec.LookPath("docker")
+	if err != nil {
+		return "", errors.Annotate(err, "running mongod from docker")
+	}
+	tmp := os.TempDir()
+	script := fmt.Sprintf(`#!/bin/sh
+exec %s run --rm -i --network host --user %d:%d --label %s -v %s:%s %s mongod "$@"
+`, docker, os.Getuid(), os.Getgid(), matrixLabel, tmp, tmp, image)
+	name := strings.NewReplacer("/", "_", ":", "_").Replace(image)
+	path := filepath.Join(dir, "mongod-"+name)
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		return "", errors.Annotatef(err, "writing mongod script for %q", image)
+	}
+	return path, nil
+}
+
+// RunMatrixTests runs go test on pkgs with the mongod of target, and
+// returns the output. It fails if target has no Mongod, or if the tests
+// fail.
+func RunMatrixTests(target MatrixTarget, pkgs ...string) ([]byte, error) {
+	if target.Mongod == "" {
+		return nil, errors.NotSupportedf("running the test packages against %q", target.Name)
+	}
+	args := append([]string{"test", "-count=1"}, pkgs...)
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(os.Environ(), "JUJU_MONGOD="+target.Mongod)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return output, errors.Annotatef(err, "testing against %q", target.Name)
+	}
+	return output, nil
+}
+
+// CleanupMatrix removes any docker containers left running by the mongod
+// scripts of DockerMongod. It does nothing if docker isn't installed.
+func CleanupMatrix() error {
+	docker, err := exec.LookPath("docker")
+	if err != nil {
+		return nil
+	}
+	output, err := exec.Command(docker, "ps", "-aq", "--filter", "label="+matrixLabel).Output()
+	if err != nil {
+		return errors.Annotate(err, "listing test containers")
+	}
+	ids := strings.Fields(string(output))
+	if len(ids) == 0 {
+		return nil
+	}
+	args := append([]string{"rm", "-f"}, ids...)
+	if output, err := exec.Command(docker, args...).CombinedOutput(); err != nil {
+		return errors.Annotatef(err, "removing test containers: %s", output)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package token parses and formats the transaction tokens that mgo/txn
+// stores in the txn-queue field of documents.
+//
+// A token is the 24 character hex id of a transaction, followed by an
+// underscore and a nonce of hex characters, eg:
+//
+//	5c8a7b9e1d2f3a4b5c6d7e8f_1a2b3c4d
+//
+// mgo/txn always generates 8 character nonces, but any non-empty hex
+// nonce is accepted.
+package token
+
+import (
+	"fmt"
+
+	"github.com/juju/mgo/v3/bson"
+)
+
+const (
+	// idLength is the length of the hex transaction id.
+	idLength = 24
+
+	// separator separates the transaction id from the nonce.
+	separator = '_'
+)
+
+// Token is a parsed transaction token.
+type Token struct {
+	// Id is the id of the transaction in the txns collection.
+	Id bson.ObjectId
+
+	// Nonce distinguishes between flushers that raced to prepare the
+	// transaction.
+	Nonce string
+}
+
+// New returns the token for the given transaction id and nonce.
+func New(id bson.ObjectId, nonce string) Token {
+	return Token{Id: id, Nonce: nonce}
+}
+
+// String returns the token in the form stored in txn-queue.
+func (t Token) String() string {
+	return t.Id.Hex() + string(separator) + t.Nonce
+}
+
+// Validate returns an error if the token could not have been produced by
+// mgo/txn.
+func (t Token) Validate() error {
+	if !t.Id.Valid() {
+		return &InvalidTokenError{Token: t.String(), Reason: "invalid transaction id"}
+	}
+	if t.Nonce == "" {
+		return &InvalidTokenError{Token: t.String(), Reason: "missing nonce"}
+	}
+	if !isHex(t.Nonce) {
+		return &InvalidTokenError{Token: t.String(), Reason: "nonce is not hex"}
+	}
+	return nil
+}
+
+// InvalidTokenError is returned when a string is not a valid token.
+type InvalidTokenError struct {
+	// Token is the string that failed to parse.
+	Token string
+
+	// Reason describes what was wrong with it.
+	Reason string
+}
+
+func (e *InvalidTokenError) Error() string {
+	return fmt.Sprintf("invalid txn token %q: %s", e.Token, e.Reason)
+}
+
+// Parse parses a token from a txn-queue. It never panics, whatever the
+// input.
+func Parse(s string) (Token, error) {
+	if len(s) < idLength+2 {
+		return Token{}, &InvalidTokenError{Token: s, Reason: "too short"}
+	}
+	if s[idLength] != separator {
+		return Token{}, &InvalidTokenError{Token: s, Reason: "missing separator"}
+	}
+	idHex := s[:idLength]
+	if !isHex(idHex) {
+		return Token{}, &InvalidTokenError{Token: s, Reason: "transaction id is not hex"}
+	}
+	nonce := s[idLength+1:]
+	if !isHex(nonce) {
+		return Token{}, &InvalidTokenError{Token: s, Reason: "nonce is not hex"}
+	}
+	return Token{Id: bson.ObjectIdHex(idHex), Nonce: nonce}, nil
+}
+
+// Id returns just the transaction id from a token.
+func Id(s string) (bson.ObjectId, error) {
+	t, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return t.Id, nil
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case '0' <= c && c <= '9':
+		case 'a' <= c && c <= 'f':
+		case 'A' <= c && c <= 'F':
+		default:
+			return false
+		}
+	}
+	return true
+}
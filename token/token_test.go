@@ -0,0 +1,102 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package token_test
+
+import (
+	stdtesting "testing"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/txn/v3/token"
+)
+
+func Test(t *stdtesting.T) {
+	gc.TestingT(t)
+}
+
+type TokenSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&TokenSuite{})
+
+func (*TokenSuite) TestParse(c *gc.C) {
+	tok, err := token.Parse("5c8a7b9e1d2f3a4b5c6d7e8f_1a2b3c4d")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(tok.Id, gc.Equals, bson.ObjectIdHex("5c8a7b9e1d2f3a4b5c6d7e8f"))
+	c.Check(tok.Nonce, gc.Equals, "1a2b3c4d")
+	c.Check(tok.String(), gc.Equals, "5c8a7b9e1d2f3a4b5c6d7e8f_1a2b3c4d")
+	c.Check(tok.Validate(), jc.ErrorIsNil)
+}
+
+func (*TokenSuite) TestRoundTrip(c *gc.C) {
+	id := bson.NewObjectId()
+	tok := token.New(id, "deadbeef")
+	parsed, err := token.Parse(tok.String())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(parsed, gc.Equals, tok)
+}
+
+func (*TokenSuite) TestId(c *gc.C) {
+	id, err := token.Id("5c8a7b9e1d2f3a4b5c6d7e8f_1a2b3c4d")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(id.Hex(), gc.Equals, "5c8a7b9e1d2f3a4b5c6d7e8f")
+}
+
+func (*TokenSuite) TestParseInvalid(c *gc.C) {
+	for i, test := range []struct {
+		token  string
+		reason string
+	}{
+		{"", "too short"},
+		{"5c8a7b9e1d2f", "too short"},
+		{"5c8a7b9e1d2f3a4b5c6d7e8f", "too short"},
+		{"5c8a7b9e1d2f3a4b5c6d7e8f_", "too short"},
+		{"5c8a7b9e1d2f3a4b5c6d7e8f-1a2b3c4d", "missing separator"},
+		{"5c8a7b9e1d2f3a4b5c6d7e8g_1a2b3c4d", "transaction id is not hex"},
+		{"5c8a7b9e1d2f3a4b5c6d7e8f_1a2b3c4z", "nonce is not hex"},
+	} {
+		c.Logf("test %d: %q", i, test.token)
+		_, err := token.Parse(test.token)
+		c.Assert(err, gc.FitsTypeOf, &token.InvalidTokenError{})
+		c.Check(err.(*token.InvalidTokenError).Reason, gc.Equals, test.reason)
+	}
+}
+
+func (*TokenSuite) TestValidate(c *gc.C) {
+	c.Check(token.Token{}.Validate(), gc.ErrorMatches, `invalid txn token .*: invalid transaction id`)
+	c.Check(token.New(bson.NewObjectId(), "").Validate(), gc.ErrorMatches, `.*: missing nonce`)
+	c.Check(token.New(bson.NewObjectId(), "xyz").Validate(), gc.ErrorMatches, `.*: nonce is not hex`)
+}
+
+// FuzzParse checks that Parse never panics, and that whatever it accepts
+// formats back to a token that parses the same. Malformed tokens found in
+// the wild should be added to testdata/fuzz/FuzzParse.
+func FuzzParse(f *stdtesting.F) {
+	for _, seed := range []string{
+		"5c8a7b9e1d2f3a4b5c6d7e8f_1a2b3c4d",
+		"5c8a7b9e1d2f3a4b5c6d7e8f_",
+		"5c8a7b9e1d2f3a4b5c6d7e8f",
+		"5c8a7b9e",
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *stdtesting.T, s string) {
+		tok, err := token.Parse(s)
+		if err != nil {
+			return
+		}
+		again, err := token.Parse(tok.String())
+		if err != nil {
+			t.Fatalf("cannot parse formatted token %q: %v", tok.String(), err)
+		}
+		if again != tok {
+			t.Fatalf("token %q parsed as %#v, then %#v", s, tok, again)
+		}
+	})
+}
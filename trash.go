@@ -0,0 +1,148 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// trashSuffix is appended to the name of a collection to get the name of
+// the collection that its soft deleted documents are moved to.
+const trashSuffix = ".trash"
+
+// TrashDoc is a document that was soft deleted by a trash Remover.
+type TrashDoc struct {
+	// Id is the _id of the removed document.
+	Id interface{} `bson:"_id"`
+
+	// Deleted is when the document was removed.
+	Deleted time.Time `bson:"deleted"`
+
+	// Doc is the document as it was when it was removed.
+	Doc bson.Raw `bson:"doc"`
+}
+
+// TrashCollection returns the collection that NewTrashRemover moves the
+// documents removed from coll to.
+func TrashCollection(coll *mgo.Collection) *mgo.Collection {
+	return coll.Database.C(coll.Name + trashSuffix)
+}
+
+// NewTrashRemover returns a Remover that soft deletes documents from coll
+// by moving them into its trash collection (see TrashCollection), stamped
+// with the time they were removed. This gives a window in which documents
+// removed by an aggressive cleanup can be recovered. Use PurgeTrash to
+// permanently remove them once they are old enough.
+//
+// Documents are copied to the trash before they are removed, so if the
+// removal fails a document may end up in both collections, but it is never
+// lost.
+func NewTrashRemover(coll *mgo.Collection) Remover {
+	return newTrashRemover(coll, ChunkRemovesByCount, 0, DeleteStrategy{})
+}
+
+func newTrashRemover(coll *mgo.Collection, chunking RemoveChunking, maxBytes int, strategy DeleteStrategy) *trashRemover {
+	return &trashRemover{
+		coll:    coll,
+		trash:   TrashCollection(coll),
+		remover: newBatchRemover(coll, chunking, maxBytes, strategy),
+	}
+}
+
+type trashRemover struct {
+	coll    *mgo.Collection
+	trash   *mgo.Collection
+	remover *batchRemover
+	queue   []interface{}
+}
+
+var _ Remover = (*trashRemover)(nil)
+
+func (r *trashRemover) Remove(id interface{}) error {
+	r.queue = append(r.queue, id)
+	if len(r.queue) >= maxBulkOps {
+		return r.Flush()
+	}
+	return nil
+}
+
+func (r *trashRemover) Flush() error {
+	if len(r.queue) > 0 {
+		if err := r.copyToTrash(); err != nil {
+			return errors.Trace(err)
+		}
+		// Hand the ids over to the remover, which keeps any it fails to
+		// remove queued, so a retry doesn't copy them to the trash twice.
+		ids := r.queue
+		r.queue = nil
+		for i, id := range ids {
+			if err := r.remover.Remove(id); err != nil {
+				r.queue = append(r.queue, ids[i+1:]...)
+				return errors.Trace(err)
+			}
+		}
+	}
+	return errors.Trace(r.remover.Flush())
+}
+
+func (r *trashRemover) Abort() {
+	r.queue = r.queue[:0]
+	r.remover.Abort()
+}
+
+// copyToTrash copies the queued documents that still exist into the trash.
+func (r *trashRemover) copyToTrash() error {
+	deleted := time.Now()
+	bulk := newBulk(r.trash)
+	count := 0
+	iter := r.coll.Find(bson.M{"_id": bson.M{"$in": r.queue}}).Iter()
+	var raw bson.Raw
+	for iter.Next(&raw) {
+		var doc struct {
+			Id bson.Raw `bson:"_id"`
+		}
+		if err := raw.Unmarshal(&doc); err != nil {
+			iter.Close()
+			return errors.Annotate(err, "reading document id")
+		}
+		// A document may have been trashed before, eg if it was
+		// recreated by a later transaction; keep the latest copy.
+		bulk.Upsert(bson.D{{"_id", doc.Id}}, TrashDoc{Id: doc.Id, Deleted: deleted, Doc: raw})
+		count++
+	}
+	if err := iter.Close(); err != nil {
+		return errors.Annotatef(err, "reading documents to trash from %q", r.coll.Name)
+	}
+	if count == 0 {
+		return nil
+	}
+	if _, err := bulk.Run(); err != nil {
+		return errors.Annotatef(err, "copying documents to %q", r.trash.Name)
+	}
+	return nil
+}
+
+func (r *trashRemover) Removed() int {
+	return r.remover.Removed()
+}
+
+// PurgeTrash permanently removes the documents that were moved to the trash
+// collection of coll more than retention ago, and returns how many were
+// removed.
+func PurgeTrash(coll *mgo.Collection, retention time.Duration) (int, error) {
+	if retention < 0 {
+		return 0, errors.NotValidf("negative retention %s", retention)
+	}
+	trash := TrashCollection(coll)
+	info, err := trash.RemoveAll(bson.M{"deleted": bson.M{"$lt": time.Now().Add(-retention)}})
+	if err != nil {
+		return 0, errors.Annotatef(err, "purging %q", trash.Name)
+	}
+	pruneLogger.Debugf("purged %d documents from %q", info.Removed, trash.Name)
+	return info.Removed, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"time"
+
+	"github.com/juju/mgo/v3/bson"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type TrashSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&TrashSuite{})
+
+func (s *TrashSuite) TestTrashRemoverMovesDocs(c *gc.C) {
+	coll := s.db.C("docs")
+	c.Assert(coll.Insert(
+		bson.M{"_id": "a", "key": "value"},
+		bson.M{"_id": bson.D{{"x", 1}, {"y", 2}}, "key": "composite"},
+		bson.M{"_id": "keep"},
+	), jc.ErrorIsNil)
+
+	remover := jujutxn.NewTrashRemover(coll)
+	c.Assert(remover.Remove("a"), jc.ErrorIsNil)
+	c.Assert(remover.Remove(bson.D{{"x", 1}, {"y", 2}}), jc.ErrorIsNil)
+	c.Assert(remover.Remove("missing"), jc.ErrorIsNil)
+	c.Assert(remover.Flush(), jc.ErrorIsNil)
+	c.Check(remover.Removed(), gc.Equals, 2)
+	s.assertCollCount(c, "docs", 1)
+
+	var trashed jujutxn.TrashDoc
+	trash := jujutxn.TrashCollection(coll)
+	c.Check(trash.Name, gc.Equals, "docs.trash")
+	c.Assert(trash.FindId("a").One(&trashed), jc.ErrorIsNil)
+	c.Check(trashed.Deleted.IsZero(), jc.IsFalse)
+	var doc bson.M
+	c.Assert(trashed.Doc.Unmarshal(&doc), jc.ErrorIsNil)
+	c.Check(doc, jc.DeepEquals, bson.M{"_id": "a", "key": "value"})
+	s.assertCollCount(c, "docs.trash", 2)
+}
+
+func (s *TrashSuite) TestTrashRemoverAbort(c *gc.C) {
+	coll := s.db.C("docs")
+	c.Assert(coll.Insert(bson.M{"_id": "a"}), jc.ErrorIsNil)
+
+	remover := jujutxn.NewTrashRemover(coll)
+	c.Assert(remover.Remove("a"), jc.ErrorIsNil)
+	remover.Abort()
+	c.Assert(remover.Flush(), jc.ErrorIsNil)
+	c.Check(remover.Removed(), gc.Equals, 0)
+	s.assertCollCount(c, "docs", 1)
+	s.assertCollCount(c, "docs.trash", 0)
+}
+
+func (s *TrashSuite) TestPurgeTrashHonoursRetention(c *gc.C) {
+	coll := s.db.C("docs")
+	trash := jujutxn.TrashCollection(coll)
+	now := time.Now()
+	c.Assert(trash.Insert(
+		bson.M{"_id": "old", "deleted": now.Add(-2 * time.Hour), "doc": bson.M{"_id": "old"}},
+		bson.M{"_id": "new", "deleted": now.Add(-time.Minute), "doc": bson.M{"_id": "new"}},
+	), jc.ErrorIsNil)
+
+	purged, err := jujutxn.PurgeTrash(coll, time.Hour)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(purged, gc.Equals, 1)
+	var ids []struct {
+		Id string `bson:"_id"`
+	}
+	c.Assert(trash.Find(nil).All(&ids), jc.ErrorIsNil)
+	c.Assert(ids, gc.HasLen, 1)
+	c.Check(ids[0].Id, gc.Equals, "new")
+}
+
+func (s *TrashSuite) TestPurgeTrashNegativeRetention(c *gc.C) {
+	_, err := jujutxn.PurgeTrash(s.db.C("docs"), -time.Hour)
+	c.Assert(err, gc.ErrorMatches, "negative retention -1h0m0s not valid")
+}
@@ -13,6 +13,7 @@
 package txn
 
 import (
+	"context"
 	stderrors "errors"
 	"math/rand"
 	"strings"
@@ -26,7 +27,14 @@ import (
 	"github.com/juju/mgo/v3/txn"
 )
 
-var logger = loggo.GetLogger("juju.txn")
+// Logging is split between sub-loggers of "juju.txn", so that each can be
+// configured independently, eg "juju.txn.prune=DEBUG".
+var (
+	logger       = loggo.GetLogger("juju.txn")
+	runnerLogger = logger.Child("runner")
+	pruneLogger  = logger.Child("prune")
+	resumeLogger = logger.Child("resume")
+)
 
 const (
 	// defaultClientTxnRetries is the default number of times a transaction will be retried
@@ -65,6 +73,15 @@ var (
 	// ErrTransientFailure is returned by TransactionSource implementations to signal that
 	// the transaction list could not be built but the caller should retry.
 	ErrTransientFailure = stderrors.New("transient failure")
+
+	// ErrReadOnly is returned by a Runner that has been made read-only
+	// with SetReadOnly, instead of making any changes to the database.
+	ErrReadOnly = stderrors.New("transaction runner is read-only")
+
+	// ErrBackendUnavailable is returned by a Runner whose circuit breaker
+	// is open, because recent attempts couldn't reach the database,
+	// instead of making another attempt. See RunnerParams.BreakerFailures.
+	ErrBackendUnavailable = stderrors.New("database unavailable; try again soon")
 )
 
 // TransactionSource defines a function that can return transaction operations to run.
@@ -112,6 +129,37 @@ type PruneOptions struct {
 	// processing batches of transactions. This allows us to avoid excess load
 	// on the system while pruning.
 	BatchTransactionSleepTime time.Duration
+
+	// MaxPruneHistory is the number of prune records to keep in the
+	// txns.prune collection. Older records are removed after each prune.
+	// A value of 0 keeps every record.
+	MaxPruneHistory int
+
+	// MaxPruneHistoryAge causes prune records older than this to be removed
+	// after each prune. A value of 0 keeps records regardless of age.
+	MaxPruneHistoryAge time.Duration
+
+	// PruneHistoryExporter, if non-nil, is called with the prune records
+	// that are about to be trimmed, so they can be archived elsewhere. If
+	// it returns an error the records are not removed.
+	PruneHistoryExporter func([]PruneRecord) error
+
+	// LoadMonitor, if not nil, is used to slow down or suspend pruning
+	// while the database is busy.
+	LoadMonitor LoadMonitor
+
+	// MinFreeDiskBytes, if not 0, is how much disk must be left free by
+	// pruning. Before pruning, the space free on the filesystem holding
+	// the database is compared with an estimate of the space pruning
+	// could use, mostly for oplog entries, which have filled disks
+	// before. If there isn't room, pruning is refused with an
+	// *InsufficientDiskError. Servers that don't report disk space
+	// aren't checked.
+	MinFreeDiskBytes int64
+
+	// DiskCheckWarnOnly, if true, logs a warning instead of refusing to
+	// prune when MinFreeDiskBytes wouldn't be left free.
+	DiskCheckWarnOnly bool
 }
 
 // Runner instances applies operations to collections in a database.
@@ -138,6 +186,55 @@ type Runner interface {
 	MaybePruneTransactions(pruneOpts PruneOptions) error
 }
 
+// ResumingRunner is a Runner that can resume pending transactions a page at
+// a time. The Runner returned by NewRunner implements it.
+type ResumingRunner interface {
+	Runner
+
+	// ResumeTransactionsWithOptions resumes pending transactions in pages,
+	// in transaction id order, reporting progress as it goes.
+	ResumeTransactionsWithOptions(opts ResumeOptions) (ResumeStats, error)
+}
+
+// StatsRunner is a Runner that reports on its work. The Runner returned by
+// NewRunner implements it.
+type StatsRunner interface {
+	Runner
+
+	// Stats returns counts of the work done by the runner.
+	Stats() RunnerStats
+}
+
+// ReadOnlyRunner is a Runner that can be stopped from writing, such as
+// while a backup is taken. The Runner returned by NewRunner implements it.
+type ReadOnlyRunner interface {
+	Runner
+
+	// SetReadOnly switches read-only mode on or off. While it is on,
+	// Run, RunTransaction, ResumeTransactions and MaybePruneTransactions
+	// return ErrReadOnly without contacting the database, so that
+	// nothing is written during backups, restores or migrations.
+	// Operations already in progress are allowed to finish; use
+	// WaitIdle to wait for them.
+	SetReadOnly(readOnly bool)
+
+	// ReadOnly returns whether read-only mode is on.
+	ReadOnly() bool
+
+	// WaitIdle waits until no operations that write to the database are
+	// in progress, or until ctx is done, in which case it returns
+	// ctx.Err().
+	WaitIdle(ctx context.Context) error
+
+	// Quiesce drains the runner before a consistent backup is taken. It
+	// switches read-only mode on, so that new operations are refused
+	// with ErrReadOnly, and waits for those in progress to complete or
+	// abort. If ctx is done first, the runner goes back to its previous
+	// mode and ctx.Err() is returned. Once the backup has been taken,
+	// call SetReadOnly(false) to allow writes again.
+	Quiesce(ctx context.Context) (QuiesceReport, error)
+}
+
 type txnRunner interface {
 	Run([]txn.Op, bson.ObjectId, interface{}) error
 	ChangeLog(*mgo.Collection)
@@ -165,10 +262,43 @@ type transactionRunner struct {
 	retryFuzzPercent       int
 	pauseFunc              func(duration time.Duration)
 
-	newRunner func() txnRunner
+	maxOpsPerTxn     int
+	maxTxnDocBytes   int
+	txnLimitPolicy   TxnLimitPolicy
+	txnLimitObserver func(TxnLimitEvent)
+
+	maxTxnQueueLength int
+	maxTxnQueueAge    time.Duration
+
+	idSource func() bson.ObjectId
+
+	operationTimeout time.Duration
+
+	contentionAdvisor ContentionAdvisor
+
+	sortOps bool
+
+	redactor Redactor
+
+	labelLimiter    *labelLimiter
+	inFlightLimiter *labelLimiter
+
+	breaker   *circuitBreaker
+	refresher *sessionRefresher
+
+	stats runnerStats
+
+	gate *WriteGate
+
+	newRunner func(db *mgo.Database) txnRunner
 }
 
-var _ Runner = (*transactionRunner)(nil)
+var (
+	_ Runner         = (*transactionRunner)(nil)
+	_ ResumingRunner = (*transactionRunner)(nil)
+	_ StatsRunner    = (*transactionRunner)(nil)
+	_ ReadOnlyRunner = (*transactionRunner)(nil)
+)
 
 // Transaction is a struct that is passed to RunTransactionObserver whenever a
 // transaction is run.
@@ -181,6 +311,14 @@ type Transaction struct {
 	Duration time.Duration
 	// Attempt is the current attempt to apply the operation.
 	Attempt int
+	// Metadata, if set, is stored on the txn document to record who ran
+	// the transaction.
+	Metadata *TxnMetadata
+	// Result, if set, is filled in by RunTransaction once the transaction
+	// has been applied, with its id and the txn-revnos of the documents
+	// it touched. It is left empty for server-side transactions, which
+	// don't have a txn document.
+	Result *TxnResult
 }
 
 // RunnerParams are used to construct a new transaction runner.
@@ -213,6 +351,15 @@ type RunnerParams struct {
 	// back to client-side transactions if they are not supported.
 	ServerSideTransactions bool
 
+	// Capabilities, if non-nil, overrides the capabilities detected by
+	// DetectServerCapabilities, for both the runner and any pruning done
+	// through it. This is for servers which misreport what they support.
+	Capabilities *ServerCapabilities
+
+	// Features, if non-nil, restricts the behaviours above to those that
+	// are enabled. See Features.
+	Features *Features
+
 	// MaxRetryAttempts is the number of times a transaction will be retried
 	// when there is an invariant assertion failure.
 	MaxRetryAttempts int
@@ -228,17 +375,132 @@ type RunnerParams struct {
 	// PauseFunc, if non-nil, overrides the default function to sleep
 	// for the specified duration.
 	PauseFunc func(duration time.Duration)
+
+	// MaxOpsPerTxn is the maximum number of operations in a single
+	// transaction. A value of 0 means no limit.
+	MaxOpsPerTxn int
+
+	// MaxTxnDocBytes is the maximum estimated size of the transaction
+	// document written to the txns collection. A value of 0 means no limit.
+	MaxTxnDocBytes int
+
+	// TxnLimitPolicy decides what happens to a transaction that exceeds
+	// MaxOpsPerTxn or MaxTxnDocBytes. It defaults to TxnLimitReject.
+	TxnLimitPolicy TxnLimitPolicy
+
+	// TxnLimitObserver, if non-nil, is called whenever a transaction is
+	// within 80% of, or over, one of the limits.
+	TxnLimitObserver func(TxnLimitEvent)
+
+	// MaxTxnQueueLength, if non-zero, makes Run and RunTransaction fail
+	// immediately with an *ErrDirtyDoc if any document in the transaction
+	// has more than this many tokens in its txn-queue.
+	MaxTxnQueueLength int
+
+	// MaxTxnQueueAge, if non-zero, makes Run and RunTransaction fail
+	// immediately with an *ErrDirtyDoc if the oldest token in any
+	// document's txn-queue belongs to a transaction older than this.
+	MaxTxnQueueAge time.Duration
+
+	// IdSource, if non-nil, is called to allocate the id of each
+	// transaction document. Ids must be unique, and should increase over
+	// time as pruning and resuming work in id order. If nil, mgo/txn
+	// allocates a new ObjectId for each transaction.
+	IdSource func() bson.ObjectId
+
+	// OperationTimeout, if non-zero, is sent as maxTimeMS with the
+	// queries the runner makes itself: the dirty document check, reading
+	// a transaction's result, checking assertions after an abort, and
+	// finding transactions to resume. The server gives up on any that
+	// take longer, and the attempt fails with the server's error.
+	//
+	// It does not apply to the queries and updates made by mgo/txn
+	// itself, which can't carry maxTimeMS. To bound those, set a socket
+	// timeout on the session instead, bearing in mind that a timed out
+	// operation carries on running on the server, and that a flush that
+	// is cut off part way leaves its transactions preparing or applying
+	// until they are resumed.
+	OperationTimeout time.Duration
+
+	// ContentionAdvisor, if non-nil, is consulted by Run after each
+	// attempt that fails because of contention, to decide how to make
+	// the next one.
+	ContentionAdvisor ContentionAdvisor
+
+	// SortOps, if true, makes RunTransaction sort the operations of each
+	// transaction by collection and document id before running it, so
+	// that concurrent transactions on the same documents queue on them
+	// in the same order and are less likely to abort each other. The
+	// operations on each document are kept in the order they were
+	// given. As sorting happens for every attempt, it overrides
+	// ContentionAdvice.ContendedFirst. RunnerStats.Reordered counts the
+	// transactions whose order was changed.
+	SortOps bool
+
+	// Redactor, if not nil, redacts the ops the runner logs.
+	Redactor Redactor
+
+	// LabelLimits bounds how many transactions with each label
+	// RunTransaction runs at once, so that one busy caller or tenant of a
+	// shared runner can't starve the others. Transactions with labels
+	// that have no entry are bounded by DefaultLabelLimit, and
+	// transactions without a label aren't bounded. Transactions that
+	// can't run fail with an *ErrLabelLimit, and are counted in
+	// RunnerStats.LabelLimits.
+	LabelLimits       map[string]LabelLimit
+	DefaultLabelLimit LabelLimit
+
+	// LabelKey, if not nil, returns the label of a transaction for
+	// LabelLimits, or "" if it has none. It defaults to the Caller of the
+	// transaction's Metadata; return its ModelUUID to bound each tenant.
+	LabelKey func(*Transaction) string
+
+	// InFlightLimit, if its MaxConcurrent is not 0, bounds how many
+	// attempts RunTransaction makes at once, whatever their labels, with
+	// a queue of up to MaxQueued attempts that wait up to MaxWait for
+	// their turn. This smooths out bursts, such as every worker retrying
+	// at once after a leadership change, that would otherwise contend on
+	// the same documents. Attempts that can't be made fail with an
+	// *ErrRunnerBusy, and are counted in RunnerStats.InFlight.
+	InFlightLimit LabelLimit
+
+	// BreakerFailures, if not 0, is how many attempts in a row may fail
+	// to reach the database before the runner's circuit breaker opens.
+	// While it is open, Run and RunTransaction fail immediately with
+	// ErrBackendUnavailable, rather than piling up retries against a
+	// dead primary. After BreakerCooldown, a single attempt is let
+	// through to test the connection; the breaker closes if it reaches
+	// the database, and opens again if not. The breaker's state is
+	// reported in RunnerStats.Breaker.
+	BreakerFailures int
+
+	// BreakerCooldown is how long the circuit breaker stays open.
+	// Defaults to 30 seconds.
+	BreakerCooldown time.Duration
+
+	// RefreshSessionAfter, if not 0, is how many attempts in a row may
+	// fail with errors that come from a stale socket, such as "i/o
+	// timeout" after a network blip, before the runner refreshes its
+	// session so that the next attempt is made on a new socket.
+	// RunnerStats.SessionRefreshes counts the refreshes.
+	RefreshSessionAfter int
 }
 
 // NewRunner returns a Runner which runs transactions for the database specified in params.
 // Collection names used to manage the transactions and change log may also be specified in
 // params, but if not, default values will be used.
 func NewRunner(params RunnerParams) Runner {
+	if params.Features != nil {
+		params.Features.applyToRunner(&params)
+	}
 	sstxn := params.ServerSideTransactions
+	if params.Capabilities != nil {
+		setCapabilities(params.Database, *params.Capabilities)
+	}
 	if sstxn {
-		sstxn = SupportsServerSideTransactions(params.Database)
+		sstxn = runnerSupportsTransactions(params)
 		if !sstxn {
-			logger.Warningf("server-side transactions requested, but database does not support them")
+			runnerLogger.Warningf("server-side transactions requested, but database does not support them")
 		}
 	}
 	txnRunner := &transactionRunner{
@@ -252,6 +514,19 @@ func NewRunner(params RunnerParams) Runner {
 		retryBackoff:              params.RetryBackoff,
 		retryFuzzPercent:          params.RetryFuzzPercent,
 		pauseFunc:                 params.PauseFunc,
+		maxOpsPerTxn:              params.MaxOpsPerTxn,
+		maxTxnDocBytes:            params.MaxTxnDocBytes,
+		txnLimitPolicy:            params.TxnLimitPolicy,
+		txnLimitObserver:          params.TxnLimitObserver,
+		maxTxnQueueLength:         params.MaxTxnQueueLength,
+		maxTxnQueueAge:            params.MaxTxnQueueAge,
+		idSource:                  params.IdSource,
+		operationTimeout:          params.OperationTimeout,
+		contentionAdvisor:         params.ContentionAdvisor,
+		sortOps:                   params.SortOps,
+		redactor:                  params.Redactor,
+		labelLimiter:              newLabelLimiter(params),
+		inFlightLimiter:           newInFlightLimiter(params.InFlightLimit),
 	}
 	if txnRunner.transactionCollectionName == "" {
 		txnRunner.transactionCollectionName = defaultTxnCollectionName
@@ -279,19 +554,21 @@ func NewRunner(params RunnerParams) Runner {
 	txnRunner.testHooks = make(chan ([]TestHook), 1)
 	txnRunner.testHooks <- nil
 	txnRunner.newRunner = txnRunner.newRunnerImpl
+	txnRunner.gate = NewWriteGate()
 	if txnRunner.clock == nil {
 		// We allow callers to pass in a nil clock because it is only used if
 		// they also specify a RunTransactionObserver.
 		txnRunner.clock = clock.WallClock
 	}
+	txnRunner.breaker = newCircuitBreaker(params, txnRunner.clock)
+	txnRunner.refresher = newSessionRefresher(params)
 	return txnRunner
 }
 
-func (tr *transactionRunner) newRunnerImpl() txnRunner {
-	db := tr.db
+func (tr *transactionRunner) newRunnerImpl(db *mgo.Database) txnRunner {
 	var runner txnRunner
 	if tr.serverSideTransactions {
-		runner = sstxn.NewRunner(db, logger)
+		runner = sstxn.NewRunner(db, runnerLogger)
 	} else {
 		runner = txn.NewRunner(db.C(tr.transactionCollectionName))
 	}
@@ -301,12 +578,30 @@ func (tr *transactionRunner) newRunnerImpl() txnRunner {
 	return runner
 }
 
+// withMaxTime sets the runner's operation timeout, if any, as the
+// maxTimeMS of q.
+func (tr *transactionRunner) withMaxTime(q *mgo.Query) *mgo.Query {
+	if tr.operationTimeout > 0 {
+		q.SetMaxTime(tr.operationTimeout)
+	}
+	return q
+}
+
 // Run is defined on Runner.
 func (tr *transactionRunner) Run(transactions TransactionSource) error {
+	if tr.gate.ReadOnly() {
+		// Don't even ask for the operations, as building them may
+		// need the database.
+		return ErrReadOnly
+	}
 	var lastErr error
+	var advice ContentionAdvice
+	var contended []DocRef
 	for i := 0; i < tr.nrRetries; i++ {
 		// If we are retrying, give other txns a chance to have a go.
-		if i > 0 && tr.serverSideTransactions {
+		if i > 0 && advice.Backoff > 0 {
+			tr.pauseFunc(tr.jitter(advice.Backoff))
+		} else if i > 0 && tr.serverSideTransactions {
 			tr.backoff(i)
 		}
 		ops, err := transactions(i)
@@ -323,6 +618,9 @@ func (tr *transactionRunner) Run(transactions TransactionSource) error {
 			// Treat this the same as ErrNoOperations but don't suppress other errors.
 			return nil
 		}
+		if advice.ContendedFirst {
+			ops = contendedFirst(ops, contended)
+		}
 		if err = tr.RunTransaction(&Transaction{
 			Ops:     ops,
 			Attempt: i,
@@ -343,6 +641,16 @@ func (tr *transactionRunner) Run(transactions TransactionSource) error {
 			}
 		}
 		lastErr = err
+		advice = ContentionAdvice{}
+		if tr.contentionAdvisor != nil && i < tr.nrRetries-1 && isContention(err) {
+			advice, contended = tr.adviseContention(i, ops, err)
+			if advice.GiveUp {
+				if runnerLogger.IsDebugEnabled() {
+					runnerLogger.Debugf("giving up on contended transaction after attempt %d: %s", i, tr.formatOps(ops))
+				}
+				break
+			}
+		}
 	}
 	if lastErr == txn.ErrAborted {
 		return ErrExcessiveContention
@@ -355,21 +663,98 @@ func (tr *transactionRunner) backoff(attempt int) {
 	// a bit of fuzz for good measure.
 	dur := tr.retryBackoff * time.Duration(attempt)
 
-	// fuzzFactor is between -1.0 and 1.0 * fuzzPercent
-	fuzzFactor := 2.0 * (0.5 - rand.Float32()) * float32(tr.retryFuzzPercent) / 100.0
-
 	// Include a random amount of time as well.
-	dur += time.Duration(fuzzFactor * float32(tr.retryBackoff))
+	dur += time.Duration(tr.fuzzFactor() * float32(tr.retryBackoff))
 
 	tr.pauseFunc(dur)
 }
 
+// jitter returns dur adjusted by a random amount of up to the retry fuzz
+// percentage either way.
+func (tr *transactionRunner) jitter(dur time.Duration) time.Duration {
+	return dur + time.Duration(tr.fuzzFactor()*float32(dur))
+}
+
+// fuzzFactor returns a random value between -1.0 and 1.0 * fuzzPercent.
+func (tr *transactionRunner) fuzzFactor() float32 {
+	return 2.0 * (0.5 - rand.Float32()) * float32(tr.retryFuzzPercent) / 100.0
+}
+
 func (tr *transactionRunner) pause(dur time.Duration) {
 	time.Sleep(dur)
 }
 
 // RunTransaction is defined on Runner.
 func (tr *transactionRunner) RunTransaction(transaction *Transaction) error {
+	if err := tr.gate.Enter(); err != nil {
+		return err
+	}
+	defer tr.gate.Exit()
+	// Fail fast while the database is unreachable, rather than queueing
+	// for a slot.
+	if err := tr.breaker.allow(); err != nil {
+		return err
+	}
+	// Wait for a slot for the label first, so that transactions waiting
+	// on a busy label don't hold up the others.
+	releaseLabel, err := tr.labelLimiter.acquire(transaction)
+	if err != nil {
+		tr.breaker.cancel()
+		return err
+	}
+	defer releaseLabel()
+	releaseInFlight, err := tr.inFlightLimiter.acquire(transaction)
+	if err != nil {
+		tr.breaker.cancel()
+		return err
+	}
+	defer releaseInFlight()
+	err = tr.runTransactionWithLimits(transaction)
+	tr.breaker.done(err)
+	tr.refresher.done(err)
+	tr.stats.recordLabelled(transaction, err)
+	return err
+}
+
+// runTransactionWithLimits runs transaction, after sorting its operations
+// and splitting it up as configured.
+func (tr *transactionRunner) runTransactionWithLimits(transaction *Transaction) error {
+	if tr.sortOps {
+		sorted := *transaction
+		var reordered bool
+		sorted.Ops, reordered = sortOps(transaction.Ops)
+		tr.stats.recordSorted(reordered)
+		transaction = &sorted
+	}
+	if !tr.limitsEnabled() {
+		return tr.runTransaction(transaction)
+	}
+	chunks, err := tr.applyTxnLimits(transaction.Ops)
+	if err != nil {
+		return err
+	}
+	if len(chunks) == 1 {
+		return tr.runTransaction(transaction)
+	}
+	// The chunks share transaction.Result, which collects the ids and
+	// revnos of each of them as they are applied.
+	applied := 0
+	for _, ops := range chunks {
+		chunk := *transaction
+		chunk.Ops = ops
+		if err := tr.runTransaction(&chunk); err != nil {
+			if applied == 0 {
+				// Nothing has been applied, so it can be retried.
+				return err
+			}
+			return &PartialTxnError{Applied: applied, Ops: len(transaction.Ops), Err: err}
+		}
+		applied += len(ops)
+	}
+	return nil
+}
+
+func (tr *transactionRunner) runTransaction(transaction *Transaction) error {
 	testHooks := <-tr.testHooks
 	tr.testHooks <- nil
 	if len(testHooks) > 0 {
@@ -378,9 +763,9 @@ func (tr *transactionRunner) RunTransaction(transaction *Transaction) error {
 		// in a production run, something is wrong.
 		defer func() {
 			if testHooks[0].After != nil {
-				logger.Infof("transaction 'after' hook start")
+				runnerLogger.Infof("transaction 'after' hook start")
 				testHooks[0].After()
-				logger.Infof("transaction 'after' hook end")
+				runnerLogger.Infof("transaction 'after' hook end")
 			}
 			if <-tr.testHooks != nil {
 				panic("concurrent use of transaction hooks")
@@ -388,14 +773,46 @@ func (tr *transactionRunner) RunTransaction(transaction *Transaction) error {
 			tr.testHooks <- testHooks[1:]
 		}()
 		if testHooks[0].Before != nil {
-			logger.Infof("transaction 'before' hook start")
+			runnerLogger.Infof("transaction 'before' hook start")
 			testHooks[0].Before()
-			logger.Infof("transaction 'before' hook end")
+			runnerLogger.Infof("transaction 'before' hook end")
 		}
 	}
+	db := tr.db
+	if tr.dirtyDocsEnabled() {
+		if err := tr.checkDirtyDocs(db, transaction.Ops); err != nil {
+			return err
+		}
+	}
+	var id bson.ObjectId
+	if tr.idSource != nil {
+		id = tr.idSource()
+	}
+	wantResult := transaction.Result != nil && !tr.serverSideTransactions
+	if wantResult && id == "" {
+		// The id is needed to find the revnos once it has been applied.
+		id = bson.NewObjectId()
+	}
+	var info interface{}
+	if transaction.Metadata != nil && !transaction.Metadata.IsZero() {
+		if err := transaction.Metadata.validate(); err != nil {
+			return err
+		}
+		info = *transaction.Metadata
+	}
 	start := tr.clock.Now()
-	runner := tr.newRunner()
-	err := runner.Run(transaction.Ops, "", nil)
+	runner := tr.newRunner(db)
+	err := runner.Run(transaction.Ops, id, info)
+	if err == nil && !tr.serverSideTransactions {
+		// Server-side transactions don't use the stash.
+		tr.stats.recordApplied(transaction.Ops)
+	}
+	if err == nil && wantResult {
+		if resultErr := tr.recordResult(db, transaction, id); resultErr != nil {
+			// The transaction was applied, so don't fail it.
+			runnerLogger.Warningf("%v", resultErr)
+		}
+	}
 	if tr.runTransactionObserver != nil {
 		transaction.Error = err
 		transaction.Duration = tr.clock.Now().Sub(start)
@@ -406,13 +823,18 @@ func (tr *transactionRunner) RunTransaction(transaction *Transaction) error {
 
 // ResumeTransactions is defined on Runner.
 func (tr *transactionRunner) ResumeTransactions() error {
-	runner := tr.newRunner()
-	return runner.ResumeAll()
+	_, err := tr.ResumeTransactionsWithOptions(ResumeOptions{})
+	return err
 }
 
 // MaybePruneTransactions is defined on Runner.
 func (tr *transactionRunner) MaybePruneTransactions(pruneOpts PruneOptions) error {
-	return maybePrune(tr.db, tr.transactionCollectionName, pruneOpts)
+	if err := tr.gate.Enter(); err != nil {
+		return err
+	}
+	defer tr.gate.Exit()
+	_, err := MaybePrune(tr.db, tr.transactionCollectionName, pruneOpts)
+	return err
 }
 
 // TestHook holds a pair of functions to be called before and after a
@@ -429,6 +851,22 @@ func TestHooks(runner Runner) chan ([]TestHook) {
 	return runner.(*transactionRunner).testHooks
 }
 
+// runnerSupportsTransactions returns whether the runner for params can use
+// server-side transactions. The server is probed afresh rather than using
+// cached capabilities, as its topology may have changed since it was last
+// seen (eg it was restarted as a replica set).
+func runnerSupportsTransactions(params RunnerParams) bool {
+	if params.Capabilities != nil {
+		return params.Capabilities.Transactions
+	}
+	caps, err := DetectServerCapabilities(params.Database.Session)
+	if err != nil {
+		runnerLogger.Warningf("unable to probe server capabilities: %v", err)
+		return false
+	}
+	return caps.Transactions
+}
+
 // SupportsServerSideTransactions lets you know if the given database can support
 // server-side transactions.
 func SupportsServerSideTransactions(db *mgo.Database) bool {
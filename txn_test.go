@@ -6,9 +6,11 @@ package txn_test
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/juju/clock/testclock"
+	"github.com/juju/loggo"
 	"github.com/juju/mgo/v3"
 	"github.com/juju/mgo/v3/bson"
 	mgotesting "github.com/juju/mgo/v3/testing"
@@ -207,6 +209,66 @@ func (s *txnSuite) TestRun(c *gc.C) {
 	c.Assert(found, gc.DeepEquals, doc)
 }
 
+func (s *txnSuite) TestStashStats(c *gc.C) {
+	c.Check(s.txnRunner.(jujutxn.StatsRunner).Stats().Stash, gc.HasLen, 0)
+	for i := 0; i < 2; i++ {
+		err := s.txnRunner.RunTransaction(&jujutxn.Transaction{Ops: []txn.Op{{
+			C:      s.collection.Name,
+			Id:     "1",
+			Assert: txn.DocMissing,
+			Insert: simpleDoc{"1", "Foo"},
+		}}})
+		c.Assert(err, jc.ErrorIsNil)
+		err = s.txnRunner.RunTransaction(&jujutxn.Transaction{Ops: []txn.Op{{
+			C:      s.collection.Name,
+			Id:     "1",
+			Assert: txn.DocExists,
+			Remove: true,
+		}}})
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	// An aborted transaction moves nothing.
+	err := s.txnRunner.RunTransaction(&jujutxn.Transaction{Ops: []txn.Op{{
+		C:      s.collection.Name,
+		Id:     "1",
+		Assert: txn.DocExists,
+		Remove: true,
+	}}})
+	c.Assert(err, gc.Equals, txn.ErrAborted)
+
+	stats := s.txnRunner.(jujutxn.StatsRunner).Stats()
+	if s.supportsSST {
+		c.Check(stats.Stash, gc.HasLen, 0)
+		return
+	}
+	c.Check(stats.Stash, jc.DeepEquals, map[string]jujutxn.StashStats{
+		s.collection.Name: {Stashed: 2, Unstashed: 2},
+	})
+}
+
+func (s *txnSuite) TestOperationTimeout(c *gc.C) {
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		Database:               s.collection.Database,
+		ServerSideTransactions: s.supportsSST,
+		MaxTxnQueueLength:      10,
+		OperationTimeout:       10 * time.Second,
+	})
+	err := runner.RunTransaction(&jujutxn.Transaction{Ops: []txn.Op{{
+		C:      s.collection.Name,
+		Id:     "1",
+		Assert: txn.DocMissing,
+		Insert: simpleDoc{"1", "Foo"},
+	}}})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = runner.(jujutxn.ResumingRunner).ResumeTransactionsWithOptions(jujutxn.ResumeOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+
+	var found simpleDoc
+	err = s.collection.FindId("1").One(&found)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(found, gc.DeepEquals, simpleDoc{"1", "Foo"})
+}
+
 func (s *txnSuite) setDocName(c *gc.C, id, name string) {
 	ops := []txn.Op{{
 		C:      s.collection.Name,
@@ -574,11 +636,466 @@ func (s *txnSuite) TestRunTransactionObserver(c *gc.C) {
 	c.Check(calls[1].Attempt, gc.Equals, 1)
 }
 
+func (s *txnSuite) TestMaxOpsPerTxnReject(c *gc.C) {
+	var events []jujutxn.TxnLimitEvent
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		MaxOpsPerTxn: 4,
+		TxnLimitObserver: func(event jujutxn.TxnLimitEvent) {
+			events = append(events, event)
+		},
+	})
+	fake := &fakeRunner{}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	err := runner.RunTransaction(&jujutxn.Transaction{Ops: make([]txn.Op, 5)})
+	c.Assert(err, gc.ErrorMatches, "transaction has 5 operations, limit is 4")
+	c.Check(jujutxn.IsTxnLimitError(err), jc.IsTrue)
+	c.Check(fake.ran, gc.HasLen, 0)
+	// Transactions close to the limit are reported, but still run.
+	err = runner.RunTransaction(&jujutxn.Transaction{Ops: make([]txn.Op, 4)})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(fake.ran, gc.HasLen, 1)
+	err = runner.RunTransaction(&jujutxn.Transaction{Ops: make([]txn.Op, 2)})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(events, jc.DeepEquals, []jujutxn.TxnLimitEvent{{
+		Ops:      5,
+		MaxOps:   4,
+		Exceeded: true,
+		Policy:   jujutxn.TxnLimitReject,
+	}, {
+		Ops:    4,
+		MaxOps: 4,
+		Policy: jujutxn.TxnLimitReject,
+	}})
+}
+
+func (s *txnSuite) TestMaxOpsPerTxnRejectNotRetried(c *gc.C) {
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{MaxOpsPerTxn: 1})
+	fake := &fakeRunner{}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	tries := 0
+	err := runner.Run(func(int) ([]txn.Op, error) {
+		tries++
+		return make([]txn.Op, 2), nil
+	})
+	c.Check(jujutxn.IsTxnLimitError(err), jc.IsTrue)
+	c.Check(tries, gc.Equals, 1)
+}
+
+func (s *txnSuite) TestMaxOpsPerTxnSplit(c *gc.C) {
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		MaxOpsPerTxn:   2,
+		TxnLimitPolicy: jujutxn.TxnLimitSplit,
+	})
+	fake := &fakeRunner{}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	ops := []txn.Op{{Id: 0}, {Id: 1}, {Id: 2}, {Id: 3}, {Id: 4}}
+	err := runner.RunTransaction(&jujutxn.Transaction{Ops: ops})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(fake.ran, jc.DeepEquals, [][]txn.Op{ops[0:2], ops[2:4], ops[4:5]})
+}
+
+func (s *txnSuite) TestSplitStopsAtFirstError(c *gc.C) {
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		MaxOpsPerTxn:   1,
+		TxnLimitPolicy: jujutxn.TxnLimitSplit,
+	})
+	fake := &fakeRunner{errors: []error{nil, txn.ErrAborted}}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	err := runner.RunTransaction(&jujutxn.Transaction{Ops: make([]txn.Op, 3)})
+	c.Assert(err, gc.ErrorMatches, `transaction aborted \(after 1 of 3 operations were applied\)`)
+	c.Check(jujutxn.IsPartialTxnError(err), jc.IsTrue)
+	c.Check(errors.Is(err, txn.ErrAborted), jc.IsTrue)
+	c.Check(fake.ran, gc.HasLen, 2)
+}
+
+func (s *txnSuite) TestSplitFirstChunkErrorUnwrapped(c *gc.C) {
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		MaxOpsPerTxn:   1,
+		TxnLimitPolicy: jujutxn.TxnLimitSplit,
+	})
+	fake := &fakeRunner{errors: []error{txn.ErrAborted}}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	err := runner.RunTransaction(&jujutxn.Transaction{Ops: make([]txn.Op, 3)})
+	c.Assert(err, gc.Equals, txn.ErrAborted)
+	c.Check(fake.ran, gc.HasLen, 1)
+}
+
+func (s *txnSuite) TestRunDoesNotRetryPartialSplit(c *gc.C) {
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		MaxOpsPerTxn:   1,
+		TxnLimitPolicy: jujutxn.TxnLimitSplit,
+	})
+	fake := &fakeRunner{errors: []error{nil, txn.ErrAborted}}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	tries := 0
+	err := runner.Run(func(int) ([]txn.Op, error) {
+		tries++
+		return make([]txn.Op, 3), nil
+	})
+	c.Check(jujutxn.IsPartialTxnError(err), jc.IsTrue)
+	c.Check(tries, gc.Equals, 1)
+	c.Check(fake.ran, gc.HasLen, 2)
+}
+
+func (s *txnSuite) TestMaxTxnDocBytesSplit(c *gc.C) {
+	big := strings.Repeat("x", 400)
+	ops := []txn.Op{
+		{C: "coll", Id: "0", Insert: bson.M{"data": big}},
+		{C: "coll", Id: "1", Insert: bson.M{"data": big}},
+		{C: "coll", Id: "2", Insert: bson.M{"data": big}},
+	}
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		MaxTxnDocBytes: 1000,
+		TxnLimitPolicy: jujutxn.TxnLimitSplit,
+	})
+	fake := &fakeRunner{}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	err := runner.RunTransaction(&jujutxn.Transaction{Ops: ops})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(fake.ran, jc.DeepEquals, [][]txn.Op{ops[0:2], ops[2:3]})
+}
+
+func (s *txnSuite) TestMaxTxnDocBytesSingleOpTooLarge(c *gc.C) {
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		MaxTxnDocBytes: 100,
+		TxnLimitPolicy: jujutxn.TxnLimitSplit,
+	})
+	fake := &fakeRunner{}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	err := runner.RunTransaction(&jujutxn.Transaction{Ops: []txn.Op{
+		{C: "coll", Id: "0", Insert: bson.M{"data": strings.Repeat("x", 200)}},
+	}})
+	c.Assert(err, gc.ErrorMatches, "transaction document is [0-9]+ bytes, limit is 100")
+	c.Check(fake.ran, gc.HasLen, 0)
+}
+
+func (s *txnSuite) TestContentionAdvisor(c *gc.C) {
+	s.insertDoc(c, "hot", "Foo")
+	var contentions []jujutxn.Contention
+	var pauses []time.Duration
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		Database: s.collection.Database,
+		PauseFunc: func(dur time.Duration) {
+			pauses = append(pauses, dur)
+		},
+		ContentionAdvisor: jujutxn.ContentionAdvisorFunc(func(contention jujutxn.Contention) jujutxn.ContentionAdvice {
+			contentions = append(contentions, contention)
+			return jujutxn.ContentionAdvice{
+				Backoff:        100 * time.Millisecond,
+				ContendedFirst: true,
+			}
+		}),
+	})
+	fake := &fakeRunner{errors: []error{txn.ErrAborted, nil}}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	err := runner.Run(func(int) ([]txn.Op, error) {
+		return []txn.Op{{
+			C:      s.collection.Name,
+			Id:     "cold",
+			Assert: txn.DocMissing,
+			Insert: bson.M{},
+		}, {
+			C:      s.collection.Name,
+			Id:     "hot",
+			Assert: txn.DocMissing,
+			Insert: bson.M{},
+		}}, nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(contentions, gc.HasLen, 1)
+	c.Check(contentions[0].Attempt, gc.Equals, 0)
+	c.Check(contentions[0].Err, gc.Equals, txn.ErrAborted)
+	c.Check(contentions[0].Contended, jc.DeepEquals, []jujutxn.DocRef{{Collection: s.collection.Name, Id: "hot"}})
+	c.Assert(pauses, gc.HasLen, 1)
+	c.Check(pauses[0] >= 80*time.Millisecond && pauses[0] <= 120*time.Millisecond, jc.IsTrue)
+	c.Assert(fake.ran, gc.HasLen, 2)
+	c.Check(fake.ran[1][0].Id, gc.Equals, "hot")
+	c.Check(fake.ran[1][1].Id, gc.Equals, "cold")
+}
+
+func (s *txnSuite) TestContentionAdvisorGiveUp(c *gc.C) {
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		Database: s.collection.Database,
+		ContentionAdvisor: jujutxn.ContentionAdvisorFunc(func(jujutxn.Contention) jujutxn.ContentionAdvice {
+			return jujutxn.ContentionAdvice{GiveUp: true}
+		}),
+	})
+	fake := &fakeRunner{errors: []error{txn.ErrAborted, nil}}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	err := runner.Run(func(int) ([]txn.Op, error) {
+		return []txn.Op{{
+			C:      s.collection.Name,
+			Id:     "1",
+			Insert: bson.M{},
+		}}, nil
+	})
+	c.Assert(err, gc.Equals, jujutxn.ErrExcessiveContention)
+	c.Check(fake.ran, gc.HasLen, 1)
+}
+
+func (s *txnSuite) TestSortOps(c *gc.C) {
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		Database: s.collection.Database,
+		SortOps:  true,
+	})
+	fake := &fakeRunner{}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	ops := []txn.Op{
+		{C: "b", Id: "1", Insert: bson.M{}},
+		{C: "a", Id: "2", Update: bson.M{"$set": bson.M{"n": 1}}},
+		{C: "a", Id: "1", Insert: bson.M{}},
+		{C: "a", Id: "2", Update: bson.M{"$set": bson.M{"n": 2}}},
+	}
+	err := runner.RunTransaction(&jujutxn.Transaction{Ops: ops})
+	c.Assert(err, jc.ErrorIsNil)
+	err = runner.RunTransaction(&jujutxn.Transaction{Ops: fake.ran[0]})
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(fake.ran, gc.HasLen, 2)
+	c.Check(fake.ran[0], jc.DeepEquals, []txn.Op{ops[2], ops[1], ops[3], ops[0]})
+	c.Check(fake.ran[1], jc.DeepEquals, fake.ran[0])
+	// The caller's ops are left alone.
+	c.Check(ops[0].C, gc.Equals, "b")
+	stats := runner.(jujutxn.StatsRunner).Stats()
+	c.Check(stats.Sorted, gc.Equals, int64(2))
+	c.Check(stats.Reordered, gc.Equals, int64(1))
+}
+
+func (s *txnSuite) TestLabelStats(c *gc.C) {
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{})
+	fake := &fakeRunner{errors: []error{txn.ErrAborted, nil}}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	metadata := &jujutxn.TxnMetadata{Caller: "set-status"}
+	ops := []txn.Op{{C: "a", Id: "1"}, {C: "a", Id: "2"}}
+	for attempt := 0; attempt < 2; attempt++ {
+		runner.RunTransaction(&jujutxn.Transaction{
+			Ops:      ops,
+			Attempt:  attempt,
+			Metadata: metadata,
+		})
+	}
+	// Unlabelled transactions aren't counted.
+	err := runner.RunTransaction(&jujutxn.Transaction{Ops: ops})
+	c.Assert(err, jc.ErrorIsNil)
+
+	stats := runner.(jujutxn.StatsRunner).Stats().Labels
+	c.Check(stats, jc.DeepEquals, map[string]jujutxn.LabelStats{
+		"set-status": {Txns: 1, Attempts: 2, Aborts: 1, Ops: 4},
+	})
+	c.Check(stats["set-status"].MeanAttempts(), gc.Equals, 2.0)
+	c.Check(stats["set-status"].MeanOps(), gc.Equals, 2.0)
+}
+
+func (s *txnSuite) TestTxnLimitWarn(c *gc.C) {
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		MaxOpsPerTxn:   1,
+		TxnLimitPolicy: jujutxn.TxnLimitWarn,
+	})
+	fake := &fakeRunner{}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	err := runner.RunTransaction(&jujutxn.Transaction{Ops: make([]txn.Op, 3)})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(fake.ran, gc.HasLen, 1)
+	c.Check(fake.ran[0], gc.HasLen, 3)
+}
+
+func (s *txnSuite) TestDirtyDocQueueLength(c *gc.C) {
+	queue := []string{
+		bson.NewObjectId().Hex() + "_01234567",
+		bson.NewObjectId().Hex() + "_01234567",
+		bson.NewObjectId().Hex() + "_01234567",
+	}
+	err := s.collection.Insert(bson.M{"_id": "dirty", "txn-queue": queue})
+	c.Assert(err, jc.ErrorIsNil)
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		Database:          s.collection.Database,
+		MaxTxnQueueLength: 2,
+	})
+	fake := &fakeRunner{}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	tries := 0
+	err = runner.Run(func(int) ([]txn.Op, error) {
+		tries++
+		return []txn.Op{{
+			C:      s.collection.Name,
+			Id:     "clean",
+			Insert: bson.M{},
+		}, {
+			C:      s.collection.Name,
+			Id:     "dirty",
+			Update: bson.M{"$set": bson.M{"name": "foo"}},
+		}}, nil
+	})
+	c.Assert(err, gc.FitsTypeOf, &jujutxn.ErrDirtyDoc{})
+	c.Check(jujutxn.IsDirtyDoc(err), jc.IsTrue)
+	dirty := err.(*jujutxn.ErrDirtyDoc)
+	c.Check(dirty.Collection, gc.Equals, s.collection.Name)
+	c.Check(dirty.Id, gc.Equals, "dirty")
+	c.Check(dirty.QueueLength, gc.Equals, 3)
+	c.Check(dirty.OldestToken, gc.Equals, queue[0])
+	c.Check(tries, gc.Equals, 1)
+	c.Check(fake.ran, gc.HasLen, 0)
+}
+
+func (s *txnSuite) TestDirtyDocQueueAge(c *gc.C) {
+	now := time.Now()
+	old := bson.NewObjectIdWithTime(now.Add(-2 * time.Hour))
+	err := s.collection.Insert(bson.M{"_id": "1", "txn-queue": []string{old.Hex() + "_01234567"}})
+	c.Assert(err, jc.ErrorIsNil)
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		Database:       s.collection.Database,
+		Clock:          testclock.NewClock(now),
+		MaxTxnQueueAge: time.Hour,
+	})
+	fake := &fakeRunner{}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	ops := []txn.Op{{
+		C:      s.collection.Name,
+		Id:     "1",
+		Update: bson.M{"$set": bson.M{"name": "foo"}},
+	}}
+	err = runner.RunTransaction(&jujutxn.Transaction{Ops: ops})
+	c.Assert(jujutxn.IsDirtyDoc(err), jc.IsTrue)
+	c.Check(err.(*jujutxn.ErrDirtyDoc).Age > time.Hour, jc.IsTrue)
+	c.Check(fake.ran, gc.HasLen, 0)
+
+	// A recent queue is fine.
+	recent := bson.NewObjectIdWithTime(now.Add(-time.Minute))
+	err = s.collection.UpdateId("1", bson.M{"$set": bson.M{"txn-queue": []string{recent.Hex() + "_01234567"}}})
+	c.Assert(err, jc.ErrorIsNil)
+	err = runner.RunTransaction(&jujutxn.Transaction{Ops: ops})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(fake.ran, gc.HasLen, 1)
+}
+
+func (s *txnSuite) TestIdSource(c *gc.C) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var allocated []bson.ObjectId
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		Database: s.collection.Database,
+		IdSource: func() bson.ObjectId {
+			id := bson.NewObjectIdWithTime(base.Add(time.Duration(len(allocated)) * time.Second))
+			allocated = append(allocated, id)
+			return id
+		},
+	})
+	for i := 0; i < 2; i++ {
+		err := runner.RunTransaction(&jujutxn.Transaction{Ops: []txn.Op{{
+			C:      s.collection.Name,
+			Id:     i,
+			Insert: bson.M{},
+		}}})
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	c.Assert(allocated, gc.HasLen, 2)
+	var ids []bson.ObjectId
+	var doc struct {
+		Id bson.ObjectId `bson:"_id"`
+	}
+	iter := s.collection.Database.C("txns").Find(nil).Sort("_id").Iter()
+	for iter.Next(&doc) {
+		ids = append(ids, doc.Id)
+	}
+	c.Assert(iter.Close(), jc.ErrorIsNil)
+	c.Check(ids, jc.DeepEquals, allocated)
+}
+
+func (s *txnSuite) TestIdSourceUsedForEachAttempt(c *gc.C) {
+	next := 0
+	ids := []bson.ObjectId{bson.NewObjectId(), bson.NewObjectId()}
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		IdSource: func() bson.ObjectId {
+			id := ids[next]
+			next++
+			return id
+		},
+	})
+	fake := &fakeRunner{errors: []error{txn.ErrAborted, nil}}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	err := runner.Run(func(int) ([]txn.Op, error) {
+		return []txn.Op{{}}, nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(fake.ids, jc.DeepEquals, ids)
+}
+
+func (s *txnSuite) TestRunTransactionMetadata(c *gc.C) {
+	metadata := jujutxn.TxnMetadata{
+		Caller:    "unit-test",
+		ModelUUID: "deadbeef-0bad-400d-8000-4b1d0d06f00d",
+		RequestId: "42",
+	}
+	err := s.txnRunner.RunTransaction(&jujutxn.Transaction{
+		Ops: []txn.Op{{
+			C:      s.collection.Name,
+			Id:     "1",
+			Insert: bson.M{},
+		}},
+		Metadata: &metadata,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	if s.supportsSST {
+		// Server side transactions don't have txn documents.
+		return
+	}
+	db := s.collection.Database
+	var raw bson.Raw
+	c.Assert(db.C("txns").Find(nil).One(&raw), jc.ErrorIsNil)
+	doc, err := jujutxn.DecodeTxn(raw)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(doc.Metadata, gc.NotNil)
+	c.Check(*doc.Metadata, gc.Equals, metadata)
+
+	// The change log entry can be tied back to the metadata.
+	var logEntry struct {
+		Id bson.ObjectId `bson:"_id"`
+	}
+	c.Assert(db.C("txns.log").Find(nil).One(&logEntry), jc.ErrorIsNil)
+	c.Check(logEntry.Id, gc.Equals, doc.Id)
+	found, err := jujutxn.TxnMetadataForIds(db.C("txns"), []bson.ObjectId{logEntry.Id, bson.NewObjectId()})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(found, jc.DeepEquals, map[bson.ObjectId]jujutxn.TxnMetadata{doc.Id: metadata})
+}
+
+func (s *txnSuite) TestRunTransactionMetadataTooLarge(c *gc.C) {
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{})
+	fake := &fakeRunner{}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	err := runner.RunTransaction(&jujutxn.Transaction{
+		Ops:      []txn.Op{{}},
+		Metadata: &jujutxn.TxnMetadata{Caller: strings.Repeat("x", 2000)},
+	})
+	c.Assert(err, gc.ErrorMatches, `transaction metadata of [0-9]+ bytes \(limit 1024\) not valid`)
+	c.Check(fake.ran, gc.HasLen, 0)
+}
+
+func (s *txnSuite) TestRunnerLogsToRunnerLogger(c *gc.C) {
+	var tw loggo.TestWriter
+	c.Assert(loggo.RegisterWriter("test", loggo.NewMinimumLevelWriter(&tw, loggo.WARNING)), gc.IsNil)
+	defer loggo.RemoveWriter("test")
+	// Turning off the prune logger doesn't affect the runner.
+	c.Assert(loggo.ConfigureLoggers("juju.txn.prune=CRITICAL"), jc.ErrorIsNil)
+	defer loggo.ConfigureLoggers("juju.txn.prune=UNSPECIFIED")
+
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{
+		MaxOpsPerTxn:   1,
+		TxnLimitPolicy: jujutxn.TxnLimitWarn,
+	})
+	fake := &fakeRunner{}
+	jujutxn.SetRunnerFunc(runner, fake.new)
+	err := runner.RunTransaction(&jujutxn.Transaction{Ops: make([]txn.Op, 2)})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(tw.Log(), gc.HasLen, 1)
+	c.Check(tw.Log()[0].Module, gc.Equals, "juju.txn.runner")
+}
+
 type fakeRunner struct {
 	jujutxn.TxnRunner
 	errors    []error
 	durations []time.Duration
 	clock     *testclock.Clock
+	ran       [][]txn.Op
+	ids       []bson.ObjectId
 }
 
 // Since a new transaction runner is created each time the code
@@ -588,7 +1105,9 @@ func (f *fakeRunner) new() jujutxn.TxnRunner {
 	return f
 }
 
-func (f *fakeRunner) Run([]txn.Op, bson.ObjectId, interface{}) error {
+func (f *fakeRunner) Run(ops []txn.Op, id bson.ObjectId, _ interface{}) error {
+	f.ran = append(f.ran, ops)
+	f.ids = append(f.ids, id)
 	if len(f.durations) > 0 && f.clock != nil {
 		f.clock.Advance(f.durations[0])
 		f.durations = f.durations[1:]
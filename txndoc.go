@@ -0,0 +1,425 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+)
+
+// bson element kinds that we need to check when decoding.
+const (
+	kindDouble     = 0x01
+	kindString     = 0x02
+	kindDocument   = 0x03
+	kindArray      = 0x04
+	kindObjectId   = 0x07
+	kindBool       = 0x08
+	kindDateTime   = 0x09
+	kindNull       = 0x0A
+	kindInt32      = 0x10
+	kindTimestamp  = 0x11
+	kindInt64      = 0x12
+	kindDecimal128 = 0x13
+)
+
+// TxnDoc is a fully decoded mgo/txn transaction document.
+type TxnDoc struct {
+	// Id is the id of the transaction.
+	Id bson.ObjectId
+
+	// State is the current state of the transaction.
+	State TxnState
+
+	// Info is the optional information supplied when the transaction
+	// was run.
+	Info interface{}
+
+	// Metadata is set if Info holds TxnMetadata.
+	Metadata *TxnMetadata
+
+	// Ops are the operations that make up the transaction.
+	Ops []txn.Op
+
+	// Nonce is the nonce of the flusher that prepared the transaction.
+	// It is empty until the transaction has been prepared.
+	Nonce string
+
+	// Revnos are the txn-revnos of the documents affected by the
+	// transaction, in the same order as Ops. They are only set once the
+	// transaction is being applied.
+	Revnos []int64
+
+	// Problems lists the parts of the document that could not be decoded.
+	// It is only populated by DecodeTxnLenient.
+	Problems []string
+
+	// opIds holds the raw "d" value of each op, in the same order as
+	// Ops, so that ids can be compared without re-encoding them.
+	opIds []bson.Raw
+}
+
+// TxnDecodeError is returned by DecodeTxn when the document does not
+// match the mgo/txn transaction schema.
+type TxnDecodeError struct {
+	// Problems lists everything that was wrong with the document.
+	Problems []string
+}
+
+func (e *TxnDecodeError) Error() string {
+	return fmt.Sprintf("invalid txn document: %s", strings.Join(e.Problems, "; "))
+}
+
+// DecodeTxn decodes a raw mgo/txn transaction document. It returns a
+// *TxnDecodeError if the document contains unknown fields, fields of the
+// wrong type, or is missing required fields.
+func DecodeTxn(raw bson.Raw) (*TxnDoc, error) {
+	doc := decodeTxn(raw)
+	if len(doc.Problems) > 0 {
+		return nil, &TxnDecodeError{Problems: doc.Problems}
+	}
+	return doc, nil
+}
+
+// DecodeTxnLenient decodes as much of a raw transaction document as it
+// can, recording anything it could not decode in TxnDoc.Problems rather
+// than failing. It is intended for forensic tooling that needs to look at
+// damaged data.
+func DecodeTxnLenient(raw bson.Raw) *TxnDoc {
+	return decodeTxn(raw)
+}
+
+func decodeTxn(raw bson.Raw) (doc *TxnDoc) {
+	doc = &TxnDoc{}
+	problem := func(format string, args ...interface{}) {
+		doc.Problems = append(doc.Problems, fmt.Sprintf(format, args...))
+	}
+	defer recoverMalformed(problem)
+	if raw.Kind == 0 {
+		// Allow callers to pass the output of bson.Marshal directly.
+		raw.Kind = kindDocument
+	}
+	if raw.Kind != kindDocument {
+		problem("expected a document, got bson kind 0x%02x", raw.Kind)
+		return doc
+	}
+	var elems bson.RawD
+	if err := raw.Unmarshal(&elems); err != nil {
+		problem("%v", err)
+		return doc
+	}
+	seen := make(map[string]bool, len(elems))
+	for _, elem := range elems {
+		seen[elem.Name] = true
+		value := elem.Value
+		switch elem.Name {
+		case "_id":
+			if value.Kind != kindObjectId {
+				problem("_id has bson kind 0x%02x, expected ObjectId", value.Kind)
+				continue
+			}
+			value.Unmarshal(&doc.Id)
+		case "s":
+			state, ok := decodeInt(value)
+			if !ok {
+				problem("s has bson kind 0x%02x, expected a number", value.Kind)
+				continue
+			}
+			doc.State = TxnState(state)
+			if !doc.State.Valid() {
+				problem("unknown state %d", state)
+			}
+		case "i":
+			if err := value.Unmarshal(&doc.Info); err != nil {
+				problem("i: %v", err)
+				continue
+			}
+			if value.Kind == kindDocument {
+				var metadata TxnMetadata
+				if err := value.Unmarshal(&metadata); err == nil && !metadata.IsZero() {
+					doc.Metadata = &metadata
+				}
+			}
+		case "o":
+			if value.Kind != kindArray {
+				problem("o has bson kind 0x%02x, expected an array", value.Kind)
+				continue
+			}
+			var ops []bson.Raw
+			if err := value.Unmarshal(&ops); err != nil {
+				problem("o: %v", err)
+				continue
+			}
+			for i, rawOp := range ops {
+				op, opProblems := decodeTxnOp(rawOp)
+				for _, p := range opProblems {
+					problem("o.%d: %s", i, p)
+				}
+				doc.Ops = append(doc.Ops, op)
+				var id struct {
+					Id bson.Raw `bson:"d"`
+				}
+				if rawOp.Kind == kindDocument {
+					rawOp.Unmarshal(&id)
+				}
+				doc.opIds = append(doc.opIds, id.Id)
+			}
+		case "n":
+			if value.Kind != kindString {
+				problem("n has bson kind 0x%02x, expected a string", value.Kind)
+				continue
+			}
+			value.Unmarshal(&doc.Nonce)
+		case "r":
+			if value.Kind != kindArray {
+				problem("r has bson kind 0x%02x, expected an array", value.Kind)
+				continue
+			}
+			var revnos []bson.Raw
+			value.Unmarshal(&revnos)
+			for i, rawRevno := range revnos {
+				revno, ok := decodeInt(rawRevno)
+				if !ok {
+					problem("r.%d has bson kind 0x%02x, expected a number", i, rawRevno.Kind)
+				}
+				doc.Revnos = append(doc.Revnos, revno)
+			}
+		default:
+			problem("unknown field %q", elem.Name)
+		}
+	}
+	for _, required := range []string{"_id", "s", "o"} {
+		if !seen[required] {
+			problem("missing field %q", required)
+		}
+	}
+	return doc
+}
+
+func decodeTxnOp(raw bson.Raw) (txn.Op, []string) {
+	var op txn.Op
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if raw.Kind != kindDocument {
+		problem("expected a document, got bson kind 0x%02x", raw.Kind)
+		return op, problems
+	}
+	var elems bson.RawD
+	if err := raw.Unmarshal(&elems); err != nil {
+		problem("%v", err)
+		return op, problems
+	}
+	seen := make(map[string]bool, len(elems))
+	for _, elem := range elems {
+		seen[elem.Name] = true
+		value := elem.Value
+		var err error
+		switch elem.Name {
+		case "c":
+			if value.Kind != kindString {
+				problem("c has bson kind 0x%02x, expected a string", value.Kind)
+				continue
+			}
+			err = value.Unmarshal(&op.C)
+		case "d":
+			err = value.Unmarshal(&op.Id)
+		case "a":
+			err = value.Unmarshal(&op.Assert)
+		case "i":
+			err = value.Unmarshal(&op.Insert)
+		case "u":
+			err = value.Unmarshal(&op.Update)
+		case "r":
+			if value.Kind != kindBool {
+				problem("r has bson kind 0x%02x, expected a bool", value.Kind)
+				continue
+			}
+			err = value.Unmarshal(&op.Remove)
+		default:
+			problem("unknown field %q", elem.Name)
+		}
+		if err != nil {
+			problem("%s: %v", elem.Name, err)
+		}
+	}
+	for _, required := range []string{"c", "d"} {
+		if !seen[required] {
+			problem("missing field %q", required)
+		}
+	}
+	return op, problems
+}
+
+// recoverMalformed reports a panic from the bson package, which it raises
+// for some malformed documents, as a problem.
+func recoverMalformed(problem func(format string, args ...interface{})) {
+	if r := recover(); r != nil {
+		problem("malformed bson: %v", r)
+	}
+}
+
+// StashDoc is a decoded document from the txns.stash collection, which
+// holds the txn-queues of documents that don't currently exist.
+type StashDoc struct {
+	// Collection and Id identify the missing document.
+	Collection string
+	Id         interface{}
+
+	// Queue is the txn-queue of the document.
+	Queue []string
+
+	// Revno is the txn-revno of the document.
+	Revno int64
+
+	// Insert and Remove are the transactions that are inserting the
+	// document, or last removed it, if set.
+	Insert bson.ObjectId
+	Remove bson.ObjectId
+
+	// Problems lists the parts of the document that could not be decoded.
+	// It is only populated by DecodeStashDocLenient.
+	Problems []string
+}
+
+// StashDecodeError is returned by DecodeStashDoc when the document does
+// not match the mgo/txn stash schema.
+type StashDecodeError struct {
+	// Problems lists everything that was wrong with the document.
+	Problems []string
+}
+
+func (e *StashDecodeError) Error() string {
+	return fmt.Sprintf("invalid stash document: %s", strings.Join(e.Problems, "; "))
+}
+
+// DecodeStashDoc decodes a raw txns.stash document. It returns a
+// *StashDecodeError if the document contains unknown fields, fields of the
+// wrong type, or is missing required fields.
+func DecodeStashDoc(raw bson.Raw) (*StashDoc, error) {
+	doc := decodeStashDoc(raw)
+	if len(doc.Problems) > 0 {
+		return nil, &StashDecodeError{Problems: doc.Problems}
+	}
+	return doc, nil
+}
+
+// DecodeStashDocLenient decodes as much of a raw stash document as it
+// can, recording anything it could not decode in StashDoc.Problems.
+func DecodeStashDocLenient(raw bson.Raw) *StashDoc {
+	return decodeStashDoc(raw)
+}
+
+func decodeStashDoc(raw bson.Raw) (doc *StashDoc) {
+	doc = &StashDoc{}
+	problem := func(format string, args ...interface{}) {
+		doc.Problems = append(doc.Problems, fmt.Sprintf(format, args...))
+	}
+	defer recoverMalformed(problem)
+	if raw.Kind == 0 {
+		raw.Kind = kindDocument
+	}
+	if raw.Kind != kindDocument {
+		problem("expected a document, got bson kind 0x%02x", raw.Kind)
+		return doc
+	}
+	var elems bson.RawD
+	if err := raw.Unmarshal(&elems); err != nil {
+		problem("%v", err)
+		return doc
+	}
+	seen := make(map[string]bool, len(elems))
+	for _, elem := range elems {
+		seen[elem.Name] = true
+		value := elem.Value
+		switch elem.Name {
+		case "_id":
+			var key struct {
+				Collection *string     `bson:"c"`
+				Id         interface{} `bson:"id"`
+			}
+			if value.Kind != kindDocument {
+				problem("_id has bson kind 0x%02x, expected a document", value.Kind)
+				continue
+			}
+			if err := value.Unmarshal(&key); err != nil {
+				problem("_id: %v", err)
+				continue
+			}
+			if key.Collection == nil {
+				problem("_id is missing the collection")
+			} else {
+				doc.Collection = *key.Collection
+			}
+			if key.Id == nil {
+				problem("_id is missing the document id")
+			}
+			doc.Id = key.Id
+		case "txn-queue":
+			if value.Kind != kindArray {
+				problem("txn-queue has bson kind 0x%02x, expected an array", value.Kind)
+				continue
+			}
+			var tokens []bson.Raw
+			if err := value.Unmarshal(&tokens); err != nil {
+				problem("txn-queue: %v", err)
+				continue
+			}
+			for i, rawToken := range tokens {
+				var tok string
+				if rawToken.Kind != kindString || rawToken.Unmarshal(&tok) != nil {
+					problem("txn-queue.%d has bson kind 0x%02x, expected a string", i, rawToken.Kind)
+					continue
+				}
+				doc.Queue = append(doc.Queue, tok)
+			}
+		case "txn-revno":
+			revno, ok := decodeInt(value)
+			if !ok {
+				problem("txn-revno has bson kind 0x%02x, expected a number", value.Kind)
+				continue
+			}
+			doc.Revno = revno
+		case "txn-insert", "txn-remove":
+			if value.Kind != kindObjectId {
+				problem("%s has bson kind 0x%02x, expected ObjectId", elem.Name, value.Kind)
+				continue
+			}
+			if elem.Name == "txn-insert" {
+				value.Unmarshal(&doc.Insert)
+			} else {
+				value.Unmarshal(&doc.Remove)
+			}
+		default:
+			problem("unknown field %q", elem.Name)
+		}
+	}
+	if !seen["_id"] {
+		problem("missing field %q", "_id")
+	}
+	return doc
+}
+
+// decodeInt decodes any bson numeric value as an int64.
+func decodeInt(raw bson.Raw) (int64, bool) {
+	switch raw.Kind {
+	case kindInt32, kindInt64:
+		var v int64
+		if err := raw.Unmarshal(&v); err != nil {
+			return 0, false
+		}
+		return v, true
+	case kindDouble:
+		var v float64
+		if err := raw.Unmarshal(&v); err != nil {
+			return 0, false
+		}
+		return int64(v), true
+	}
+	return 0, false
+}
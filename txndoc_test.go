@@ -0,0 +1,235 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	stdtesting "testing"
+
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type DecodeTxnSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&DecodeTxnSuite{})
+
+func marshalRaw(c *gc.C, doc interface{}) bson.Raw {
+	data, err := bson.Marshal(doc)
+	c.Assert(err, jc.ErrorIsNil)
+	return bson.Raw{Kind: 0x03, Data: data}
+}
+
+func (*DecodeTxnSuite) TestDecodeComplete(c *gc.C) {
+	id := bson.NewObjectId()
+	raw := marshalRaw(c, bson.D{
+		{"_id", id},
+		{"s", 6},
+		{"i", bson.M{"caller": "test"}},
+		{"o", []bson.D{{
+			{"c", "coll"},
+			{"d", "doc-1"},
+			{"a", "d-"},
+			{"i", bson.M{"name": "foo"}},
+		}, {
+			{"c", "other"},
+			{"d", 2},
+			{"r", true},
+		}}},
+		{"n", "deadbeef"},
+		{"r", []int64{-1, 4}},
+	})
+	doc, err := jujutxn.DecodeTxn(raw)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.Id, gc.Equals, id)
+	c.Check(doc.State, gc.Equals, jujutxn.TxnApplied)
+	c.Check(doc.Info, jc.DeepEquals, bson.M{"caller": "test"})
+	c.Check(doc.Nonce, gc.Equals, "deadbeef")
+	c.Check(doc.Revnos, jc.DeepEquals, []int64{-1, 4})
+	c.Assert(doc.Ops, gc.HasLen, 2)
+	c.Check(doc.Ops[0], jc.DeepEquals, txn.Op{
+		C:      "coll",
+		Id:     "doc-1",
+		Assert: txn.DocMissing,
+		Insert: bson.M{"name": "foo"},
+	})
+	c.Check(doc.Ops[1], jc.DeepEquals, txn.Op{
+		C:      "other",
+		Id:     2,
+		Remove: true,
+	})
+	c.Check(doc.Problems, gc.HasLen, 0)
+}
+
+func (*DecodeTxnSuite) TestStrictRejectsUnknownFields(c *gc.C) {
+	raw := marshalRaw(c, bson.D{
+		{"_id", bson.NewObjectId()},
+		{"s", 1},
+		{"o", []bson.D{{{"c", "coll"}, {"d", 1}, {"x", 1}}}},
+		{"extra", true},
+	})
+	_, err := jujutxn.DecodeTxn(raw)
+	c.Assert(err, gc.FitsTypeOf, &jujutxn.TxnDecodeError{})
+	c.Check(err.(*jujutxn.TxnDecodeError).Problems, jc.DeepEquals, []string{
+		`o.0: unknown field "x"`,
+		`unknown field "extra"`,
+	})
+}
+
+func (*DecodeTxnSuite) TestStrictRejectsBadTypes(c *gc.C) {
+	raw := marshalRaw(c, bson.D{
+		{"_id", "not-an-objectid"},
+		{"s", 9},
+		{"o", "not-an-array"},
+	})
+	_, err := jujutxn.DecodeTxn(raw)
+	c.Check(err, gc.ErrorMatches, `invalid txn document: _id has bson kind 0x02, expected ObjectId; `+
+		`unknown state 9; o has bson kind 0x02, expected an array`)
+}
+
+func (*DecodeTxnSuite) TestLenientKeepsWhatItCan(c *gc.C) {
+	id := bson.NewObjectId()
+	raw := marshalRaw(c, bson.D{
+		{"_id", id},
+		{"o", []bson.D{{{"c", "coll"}, {"d", 1}}}},
+		{"n", 1234},
+	})
+	doc := jujutxn.DecodeTxnLenient(raw)
+	c.Check(doc.Id, gc.Equals, id)
+	c.Check(doc.Ops, gc.HasLen, 1)
+	c.Check(doc.Problems, jc.DeepEquals, []string{
+		"n has bson kind 0x10, expected a string",
+		`missing field "s"`,
+	})
+}
+
+func (*DecodeTxnSuite) TestNotADocument(c *gc.C) {
+	doc := jujutxn.DecodeTxnLenient(bson.Raw{Kind: 0x02, Data: []byte{1, 0, 0, 0, 0}})
+	c.Check(doc.Problems, jc.DeepEquals, []string{"expected a document, got bson kind 0x02"})
+}
+
+func (*DecodeTxnSuite) TestDecodeMetadata(c *gc.C) {
+	raw := marshalRaw(c, bson.D{
+		{"_id", bson.NewObjectId()},
+		{"s", 6},
+		{"i", jujutxn.TxnMetadata{Caller: "test", RequestId: "1"}},
+		{"o", []bson.D{{{"c", "coll"}, {"d", 1}}}},
+	})
+	doc, err := jujutxn.DecodeTxn(raw)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.Metadata, jc.DeepEquals, &jujutxn.TxnMetadata{Caller: "test", RequestId: "1"})
+
+	// Other info documents aren't mistaken for metadata.
+	raw = marshalRaw(c, bson.D{
+		{"_id", bson.NewObjectId()},
+		{"s", 6},
+		{"i", bson.M{"something": "else"}},
+		{"o", []bson.D{{{"c", "coll"}, {"d", 1}}}},
+	})
+	doc, err = jujutxn.DecodeTxn(raw)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.Metadata, gc.IsNil)
+}
+
+func (*DecodeTxnSuite) TestDecodeStashDoc(c *gc.C) {
+	insert := bson.NewObjectId()
+	raw := marshalRaw(c, bson.D{
+		{"_id", bson.D{{"c", "coll"}, {"id", "doc-1"}}},
+		{"txn-queue", []string{"5c8a7b9e1d2f3a4b5c6d7e8f_1a2b3c4d"}},
+		{"txn-revno", -1},
+		{"txn-insert", insert},
+	})
+	doc, err := jujutxn.DecodeStashDoc(raw)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc, jc.DeepEquals, &jujutxn.StashDoc{
+		Collection: "coll",
+		Id:         "doc-1",
+		Queue:      []string{"5c8a7b9e1d2f3a4b5c6d7e8f_1a2b3c4d"},
+		Revno:      -1,
+		Insert:     insert,
+	})
+}
+
+func (*DecodeTxnSuite) TestDecodeStashDocProblems(c *gc.C) {
+	raw := marshalRaw(c, bson.D{
+		{"_id", bson.D{{"id", "doc-1"}}},
+		{"txn-queue", []interface{}{"5c8a7b9e1d2f3a4b5c6d7e8f_1a2b3c4d", 1}},
+		{"extra", true},
+	})
+	_, err := jujutxn.DecodeStashDoc(raw)
+	c.Assert(err, gc.FitsTypeOf, &jujutxn.StashDecodeError{})
+	c.Check(err.(*jujutxn.StashDecodeError).Problems, jc.DeepEquals, []string{
+		"_id is missing the collection",
+		"txn-queue.1 has bson kind 0x10, expected a string",
+		`unknown field "extra"`,
+	})
+	doc := jujutxn.DecodeStashDocLenient(raw)
+	c.Check(doc.Id, gc.Equals, "doc-1")
+	c.Check(doc.Queue, jc.DeepEquals, []string{"5c8a7b9e1d2f3a4b5c6d7e8f_1a2b3c4d"})
+}
+
+func (*DecodeTxnSuite) TestDecodeTruncated(c *gc.C) {
+	raw := marshalRaw(c, bson.D{{"_id", bson.NewObjectId()}, {"s", 6}, {"o", []bson.D{}}})
+	raw.Data = raw.Data[:len(raw.Data)-3]
+	doc := jujutxn.DecodeTxnLenient(raw)
+	c.Check(doc.Problems, gc.Not(gc.HasLen), 0)
+	stash := jujutxn.DecodeStashDocLenient(raw)
+	c.Check(stash.Problems, gc.Not(gc.HasLen), 0)
+}
+
+// fuzzDocSeeds are valid documents to start fuzzing the decoders from.
+func fuzzDocSeeds(f *stdtesting.F) {
+	for _, doc := range []interface{}{
+		bson.D{
+			{"_id", bson.NewObjectId()},
+			{"s", 6},
+			{"o", []bson.D{{{"c", "coll"}, {"d", "doc-1"}, {"a", "d-"}, {"i", bson.M{"name": "foo"}}}}},
+			{"n", "deadbeef"},
+			{"r", []int64{-1}},
+		},
+		bson.D{
+			{"_id", bson.D{{"c", "coll"}, {"id", "doc-1"}}},
+			{"txn-queue", []string{"5c8a7b9e1d2f3a4b5c6d7e8f_1a2b3c4d"}},
+			{"txn-revno", -1},
+		},
+	} {
+		data, err := bson.Marshal(doc)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+}
+
+// FuzzDecodeTxn checks that decoding a txn document never panics. Damaged
+// documents found in the wild should be added to
+// testdata/fuzz/FuzzDecodeTxn.
+func FuzzDecodeTxn(f *stdtesting.F) {
+	fuzzDocSeeds(f)
+	f.Fuzz(func(t *stdtesting.T, data []byte) {
+		raw := bson.Raw{Kind: 0x03, Data: data}
+		doc := jujutxn.DecodeTxnLenient(raw)
+		if _, err := jujutxn.DecodeTxn(raw); (err == nil) != (len(doc.Problems) == 0) {
+			t.Fatalf("DecodeTxn disagrees with DecodeTxnLenient: %v, %q", err, doc.Problems)
+		}
+	})
+}
+
+// FuzzDecodeStashDoc checks that decoding a stash document never panics.
+func FuzzDecodeStashDoc(f *stdtesting.F) {
+	fuzzDocSeeds(f)
+	f.Fuzz(func(t *stdtesting.T, data []byte) {
+		raw := bson.Raw{Kind: 0x03, Data: data}
+		doc := jujutxn.DecodeStashDocLenient(raw)
+		if _, err := jujutxn.DecodeStashDoc(raw); (err == nil) != (len(doc.Problems) == 0) {
+			t.Fatalf("DecodeStashDoc disagrees with DecodeStashDocLenient: %v, %q", err, doc.Problems)
+		}
+	})
+}
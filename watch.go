@@ -0,0 +1,304 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+)
+
+// docWatchInterval is how often a DocWatcher reads the change log.
+const docWatchInterval = time.Second
+
+// RevnoChange is sent by a DocWatcher when a transaction changes a
+// watched document.
+type RevnoChange struct {
+	// Collection and Id identify the document. Ids that are documents
+	// or arrays are left as their bson.Raw encoding, as decoding them
+	// would lose their field order.
+	Collection string
+	Id         interface{}
+
+	// Revno is the txn-revno of the document after the change. It is
+	// negative if the document was removed.
+	Revno int64
+
+	// Txn is the transaction that made the change.
+	Txn bson.ObjectId
+}
+
+// DocWatcher reports changes to documents, as recorded in the change log
+// of the runners that change them (see RunnerParams.ChangeLogName). It is
+// returned by StartDocWatcher.
+type DocWatcher struct {
+	poll     func() ([]RevnoChange, error)
+	interval time.Duration
+	stopCh   chan struct{}
+	done     chan struct{}
+
+	mu      sync.Mutex
+	stopped bool
+	watches map[string][]chan RevnoChange
+}
+
+// StartDocWatcher reads the change log changeLogName every second, and
+// sends the changes made since it started to the channels returned by
+// WatchDoc. The change log must be a capped collection, as it is read in
+// the order it was written. Failures to read it are logged and retried.
+// Call Stop to stop watching.
+func StartDocWatcher(db *mgo.Database, changeLogName string) *DocWatcher {
+	reader := &changeLogReader{db: db, name: changeLogName}
+	return startDocWatcher(reader.poll, docWatchInterval)
+}
+
+func startDocWatcher(poll func() ([]RevnoChange, error), interval time.Duration) *DocWatcher {
+	w := &DocWatcher{
+		poll:     poll,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+		watches:  make(map[string][]chan RevnoChange),
+	}
+	go w.loop()
+	return w
+}
+
+// WatchDoc returns a channel that receives a RevnoChange each time the
+// document with id in collection is changed. Changes that haven't been
+// received are replaced by later ones, so a slow receiver sees the latest
+// revno rather than every change. To avoid missing changes made just
+// before watching, read the document's revno with ReadRevno after calling
+// WatchDoc. The channel is closed by Unwatch or Stop.
+func (w *DocWatcher) WatchDoc(collection string, id interface{}) <-chan RevnoChange {
+	ch := make(chan RevnoChange, 1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		close(ch)
+		return ch
+	}
+	key := watchKey(collection, id)
+	w.watches[key] = append(w.watches[key], ch)
+	return ch
+}
+
+// Unwatch stops sending changes to ch, a channel returned by WatchDoc,
+// and closes it.
+func (w *DocWatcher) Unwatch(ch <-chan RevnoChange) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for key, chans := range w.watches {
+		for i, watch := range chans {
+			if watch != ch {
+				continue
+			}
+			close(watch)
+			chans = append(chans[:i], chans[i+1:]...)
+			if len(chans) == 0 {
+				delete(w.watches, key)
+			} else {
+				w.watches[key] = chans
+			}
+			return
+		}
+	}
+}
+
+// Stop stops the watcher, waits for it to finish any poll in progress,
+// and closes the channels of all the watches.
+func (w *DocWatcher) Stop() {
+	close(w.stopCh)
+	<-w.done
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	for key, chans := range w.watches {
+		for _, ch := range chans {
+			close(ch)
+		}
+		delete(w.watches, key)
+	}
+}
+
+func (w *DocWatcher) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.check()
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check reads the changes made since the last check, and sends those to
+// watched documents.
+func (w *DocWatcher) check() {
+	changes, err := w.poll()
+	if err != nil {
+		runnerLogger.Warningf("unable to read txn change log: %v", err)
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, change := range changes {
+		for _, ch := range w.watches[watchKey(change.Collection, change.Id)] {
+			send(ch, change)
+		}
+	}
+}
+
+// send sends change to ch without blocking, replacing the change waiting
+// in ch if it hasn't been received. Only the watcher sends on ch, so
+// there is room once the waiting change has been taken.
+func send(ch chan RevnoChange, change RevnoChange) {
+	select {
+	case ch <- change:
+		return
+	default:
+	}
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- change
+}
+
+// watchKey returns the key that watches of the document with id in
+// collection are kept under. Ids are compared by their bson encoding, as
+// mgo/txn does, so that the ids read from the change log, which are
+// either simple values or left encoded, match those given to WatchDoc.
+func watchKey(collection string, id interface{}) string {
+	data, err := bson.Marshal(bson.D{{"id", id}})
+	if err != nil {
+		return collection
+	}
+	return collection + "\x00" + string(data)
+}
+
+// changeLogReader reads the entries added to a change log since it was
+// last read.
+type changeLogReader struct {
+	db   *mgo.Database
+	name string
+
+	// last is the id of the newest entry read, and started is true once
+	// it has been found.
+	last    bson.ObjectId
+	started bool
+}
+
+// poll returns the changes in the entries added since the last poll, in
+// the order they were written. The first poll returns none, as it only
+// finds where the log ends.
+func (r *changeLogReader) poll() ([]RevnoChange, error) {
+	session := r.db.Session.Copy()
+	defer session.Close()
+	// Read back from the newest entry until the last one seen, as mgo/txn
+	// ids are allocated when transactions are created, not when they are
+	// applied and logged, so they aren't in the order of the log.
+	iter := r.db.With(session).C(r.name).Find(nil).Sort("-$natural").Iter()
+	var entries []bson.Raw
+	var raw bson.Raw
+	var newest bson.ObjectId
+	for iter.Next(&raw) {
+		var id struct {
+			Id bson.ObjectId `bson:"_id"`
+		}
+		if err := raw.Unmarshal(&id); err != nil {
+			iter.Close()
+			return nil, errors.Annotate(err, "decoding change log entry")
+		}
+		if newest == "" {
+			newest = id.Id
+		}
+		if !r.started || id.Id == r.last {
+			break
+		}
+		entries = append(entries, raw)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, errors.Annotatef(err, "reading %q", r.name)
+	}
+	if newest != "" {
+		r.last = newest
+	}
+	r.started = true
+	var changes []RevnoChange
+	for i := len(entries) - 1; i >= 0; i-- {
+		entryChanges, err := parseChangeLogEntry(entries[i])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		changes = append(changes, entryChanges...)
+	}
+	return changes, nil
+}
+
+// parseChangeLogEntry returns the changes recorded by a change log entry,
+// which mgo/txn writes as:
+//
+//	{"_id": <txn id>, <collection>: {"d": [<doc id>, ...], "r": [<doc revno>, ...]}}
+func parseChangeLogEntry(raw bson.Raw) ([]RevnoChange, error) {
+	var fields bson.RawD
+	if err := raw.Unmarshal(&fields); err != nil {
+		return nil, errors.Annotate(err, "decoding change log entry")
+	}
+	var txnId bson.ObjectId
+	var changes []RevnoChange
+	for _, field := range fields {
+		if field.Name == "_id" {
+			if err := field.Value.Unmarshal(&txnId); err != nil {
+				return nil, errors.Annotate(err, "decoding change log entry id")
+			}
+			continue
+		}
+		var docs struct {
+			Ids    []bson.Raw `bson:"d"`
+			Revnos []int64    `bson:"r"`
+		}
+		if err := field.Value.Unmarshal(&docs); err != nil {
+			return nil, errors.Annotatef(err, "decoding change log entry for %q", field.Name)
+		}
+		if len(docs.Ids) != len(docs.Revnos) {
+			return nil, errors.Errorf("change log entry for %q has %d ids and %d revnos", field.Name, len(docs.Ids), len(docs.Revnos))
+		}
+		for i, rawId := range docs.Ids {
+			id, err := decodeChangeLogId(rawId)
+			if err != nil {
+				return nil, errors.Annotatef(err, "decoding change log entry for %q", field.Name)
+			}
+			changes = append(changes, RevnoChange{
+				Collection: field.Name,
+				Id:         id,
+				Revno:      docs.Revnos[i],
+			})
+		}
+	}
+	for i := range changes {
+		changes[i].Txn = txnId
+	}
+	return changes, nil
+}
+
+// decodeChangeLogId decodes a document id read from the change log. Ids
+// that wouldn't be encoded the same way again once decoded, such as
+// documents, are left encoded.
+func decodeChangeLogId(raw bson.Raw) (interface{}, error) {
+	id, err := hashableDocId(raw)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, ok := id.(rawDocId); ok {
+		return raw, nil
+	}
+	return id, nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2026 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package txn_test
+
+import (
+	"time"
+
+	"github.com/juju/mgo/v3"
+	"github.com/juju/mgo/v3/bson"
+	"github.com/juju/mgo/v3/txn"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	jujutxn "github.com/juju/txn/v3"
+)
+
+type WatchSuite struct {
+	TxnSuite
+}
+
+var _ = gc.Suite(&WatchSuite{})
+
+// nextChange returns the next change sent on ch, failing if there isn't
+// one soon.
+func nextChange(c *gc.C, ch <-chan jujutxn.RevnoChange) jujutxn.RevnoChange {
+	select {
+	case change, ok := <-ch:
+		c.Assert(ok, jc.IsTrue)
+		return change
+	case <-time.After(10 * time.Second):
+		c.Fatalf("no change received")
+	}
+	return jujutxn.RevnoChange{}
+}
+
+func assertNoChange(c *gc.C, ch <-chan jujutxn.RevnoChange) {
+	select {
+	case change := <-ch:
+		c.Fatalf("unexpected change %+v", change)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func (s *WatchSuite) TestWatchDoc(c *gc.C) {
+	err := s.db.C("txns.log").Create(&mgo.CollectionInfo{Capped: true, MaxBytes: 1 << 20})
+	c.Assert(err, jc.ErrorIsNil)
+	runner := jujutxn.NewRunner(jujutxn.RunnerParams{Database: s.db})
+	run := func(ops ...txn.Op) {
+		err := runner.RunTransaction(&jujutxn.Transaction{Ops: ops})
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	run(txn.Op{C: "coll", Id: "a", Insert: bson.M{}})
+
+	w := jujutxn.StartDocWatcher(s.db, "txns.log")
+	defer w.Stop()
+	ch := w.WatchDoc("coll", "a")
+	other := w.WatchDoc("coll", "b")
+	// Wait for the watcher to find the end of the log.
+	time.Sleep(100 * time.Millisecond)
+
+	run(txn.Op{C: "coll", Id: "a", Update: bson.M{"$set": bson.M{"x": 1}}})
+	change := nextChange(c, ch)
+	c.Check(change.Collection, gc.Equals, "coll")
+	c.Check(change.Id, gc.Equals, "a")
+	revno, err := jujutxn.ReadRevno(s.db.C("coll"), "a")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(change.Revno, gc.Equals, revno)
+
+	run(txn.Op{C: "coll", Id: "a", Remove: true})
+	change = nextChange(c, ch)
+	c.Check(change.Revno < 0, jc.IsTrue)
+	assertNoChange(c, other)
+
+	w.Unwatch(ch)
+	_, ok := <-ch
+	c.Check(ok, jc.IsFalse)
+}
+
+func (s *WatchSuite) TestCoalescesChanges(c *gc.C) {
+	polls := make(chan []jujutxn.RevnoChange)
+	w := jujutxn.StartDocWatcherWithPoll(func() ([]jujutxn.RevnoChange, error) {
+		return <-polls, nil
+	}, time.Millisecond)
+	ch := w.WatchDoc("coll", 1)
+	polls <- nil
+	polls <- []jujutxn.RevnoChange{
+		{Collection: "coll", Id: 1, Revno: 2},
+		{Collection: "coll", Id: 2, Revno: 2},
+		{Collection: "coll", Id: 1, Revno: 3},
+	}
+	polls <- []jujutxn.RevnoChange{{Collection: "coll", Id: 1, Revno: 4}}
+	// Let the watcher finish sending the last poll's changes.
+	polls <- nil
+	c.Check(nextChange(c, ch).Revno, gc.Equals, int64(4))
+	assertNoChange(c, ch)
+
+	// Unblock the poll in progress, so that the watcher can stop.
+	close(polls)
+	w.Stop()
+	_, ok := <-ch
+	c.Check(ok, jc.IsFalse)
+
+	// Watches after stopping are closed straight away.
+	_, ok = <-w.WatchDoc("coll", 1)
+	c.Check(ok, jc.IsFalse)
+}
+
+func (s *WatchSuite) TestParseChangeLogEntry(c *gc.C) {
+	txnId := bson.NewObjectId()
+	data, err := bson.Marshal(bson.D{
+		{"_id", txnId},
+		{"coll", bson.D{{"d", []interface{}{"a", 1}}, {"r", []int64{2, -3}}}},
+		{"other", bson.D{{"d", []interface{}{"a"}}, {"r", []int64{5}}}},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	changes, err := jujutxn.ParseChangeLogEntry(bson.Raw{Kind: 0x03, Data: data})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(changes, jc.DeepEquals, []jujutxn.RevnoChange{
+		{Collection: "coll", Id: "a", Revno: 2, Txn: txnId},
+		{Collection: "coll", Id: 1, Revno: -3, Txn: txnId},
+		{Collection: "other", Id: "a", Revno: 5, Txn: txnId},
+	})
+
+	data, err = bson.Marshal(bson.D{
+		{"_id", txnId},
+		{"coll", bson.D{{"d", []interface{}{"a", "b"}}, {"r", []int64{2}}}},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = jujutxn.ParseChangeLogEntry(bson.Raw{Kind: 0x03, Data: data})
+	c.Check(err, gc.ErrorMatches, `change log entry for "coll" has 2 ids and 1 revnos`)
+}
+
+func (s *WatchSuite) TestWatchDocumentId(c *gc.C) {
+	id := bson.D{{"a", 1}, {"b", bson.D{{"c", 2}, {"d", 3}}}}
+	data, err := bson.Marshal(bson.D{
+		{"_id", bson.NewObjectId()},
+		{"coll", bson.D{
+			{"d", []interface{}{id, bson.D{{"b", bson.D{{"c", 2}, {"d", 3}}}, {"a", 1}}}},
+			{"r", []int64{2, 7}},
+		}},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	changes, err := jujutxn.ParseChangeLogEntry(bson.Raw{Kind: 0x03, Data: data})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(changes, gc.HasLen, 2)
+	c.Check(changes[0].Id, gc.FitsTypeOf, bson.Raw{})
+
+	polls := make(chan []jujutxn.RevnoChange, 2)
+	w := jujutxn.StartDocWatcherWithPoll(func() ([]jujutxn.RevnoChange, error) {
+		return <-polls, nil
+	}, time.Millisecond)
+	ch := w.WatchDoc("coll", id)
+	// The same fields in another order are a different document, so
+	// only the first change is sent.
+	polls <- changes
+	c.Check(nextChange(c, ch).Revno, gc.Equals, int64(2))
+	assertNoChange(c, ch)
+	close(polls)
+	w.Stop()
+}